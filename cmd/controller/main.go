@@ -19,20 +19,36 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"sort"
 	"time"
 
+	"github.com/caicloud/loadbalancer-controller/config"
 	lbcontroller "github.com/caicloud/loadbalancer-controller/controller"
+	"github.com/caicloud/loadbalancer-controller/pkg/admin"
+	"github.com/caicloud/loadbalancer-controller/pkg/custommetrics"
+	"github.com/caicloud/loadbalancer-controller/pkg/health"
+	"github.com/caicloud/loadbalancer-controller/pkg/leaderelection"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	"github.com/caicloud/loadbalancer-controller/pkg/metrics"
 	"github.com/caicloud/loadbalancer-controller/pkg/tprclient"
+	"github.com/caicloud/loadbalancer-controller/pkg/util/canary"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+	"github.com/caicloud/loadbalancer-controller/provider"
 	_ "github.com/caicloud/loadbalancer-controller/provider/providers"
+	"github.com/caicloud/loadbalancer-controller/proxy"
 	_ "github.com/caicloud/loadbalancer-controller/proxy/proxies"
 	"github.com/caicloud/loadbalancer-controller/version"
-	log "github.com/zoumo/logdog"
 	"gopkg.in/urfave/cli.v1"
+	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 )
 
 // RunController start lb controller
@@ -48,21 +64,65 @@ func RunController(opts *Options, stopCh <-chan struct{}) error {
 		"debug":                 opts.Debug,
 		"kubconfig":             opts.Kubeconfig,
 		"additionalTolerations": opts.Cfg.AdditionalTolerations,
+		"leaderElect":           opts.LeaderElection.LeaderElect,
+		"metricsAddress":        opts.MetricsAddress,
+		"healthAddress":         opts.HealthAddress,
+		"customMetricsAddress":  opts.CustomMetrics.Address,
+		"adminAddress":          opts.Admin.Address,
+		"retryStateFile":        opts.RetryStateFile,
+		"configFile":            opts.ConfigFile,
+		"pauseAdoption":         opts.PauseAdoption,
 	})
 
+	if opts.ConfigFile != "" {
+		if err := opts.Cfg.LoadFile(opts.ConfigFile); err != nil {
+			log.Fatal("Load config file error", log.Fields{"err": err})
+			return err
+		}
+	}
+	if err := validateConfig(opts.Cfg); err != nil {
+		log.Fatal("Invalid configuration", log.Fields{"err": err})
+		return err
+	}
+
+	logOpts, _ := opts.Cfg.Log.Options()
 	if opts.Debug {
-		log.ApplyOptions(log.DebugLevel)
-	} else {
-		log.ApplyOptions(log.InfoLevel)
+		logOpts.Level = log.DebugLevel
+	}
+	if err := log.Configure(logOpts); err != nil {
+		log.Fatal("Configure logger error", log.Fields{"err": err})
+		return err
+	}
+	if (opts.CustomMetrics.TLSCertFile == "") != (opts.CustomMetrics.TLSKeyFile == "") {
+		err := fmt.Errorf("custom metrics tls cert file and private key file must be specified together")
+		log.Fatal("Invalid configuration", log.Fields{"err": err})
+		return err
+	}
+	if (opts.Admin.TLSCertFile == "") != (opts.Admin.TLSKeyFile == "") {
+		err := fmt.Errorf("admin tls cert file and private key file must be specified together")
+		log.Fatal("Invalid configuration", log.Fields{"err": err})
+		return err
+	}
+
+	if opts.RetryStateFile != "" {
+		if err := controllerutil.LoadRetryState(opts.RetryStateFile); err != nil {
+			log.Fatal("Load retry state error", log.Fields{"err": err})
+			return err
+		}
+	}
+
+	if opts.PauseAdoption {
+		controllerutil.PauseAdoption()
 	}
 
 	// build config
-	log.Infof("load kubeconfig from %s", opts.Kubeconfig)
+	log.Info("Load kubeconfig", log.Fields{"path": opts.Kubeconfig})
 	config, err := clientcmd.BuildConfigFromFlags("", opts.Kubeconfig)
 	if err != nil {
 		log.Fatal("Create kubeconfig error", log.Fields{"err": err})
 		return err
 	}
+	config.UserAgent = opts.Cfg.Identity.UserAgent
 
 	// create clientset
 	clientset, err := kubernetes.NewForConfig(config)
@@ -78,14 +138,139 @@ func RunController(opts *Options, stopCh <-chan struct{}) error {
 		return err
 	}
 
+	// create event recorder
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, apiv1.EventSource{Component: "loadbalancer-controller"})
+
+	health.WatchInformers(opts.InformerFailureTimeout)
+
+	if opts.HealthAddress != "" {
+		go func() {
+			err := http.ListenAndServe(opts.HealthAddress, health.NewServeMux())
+			log.Error("Health server exited", log.Fields{"err": err})
+		}()
+	}
+
+	if opts.MetricsAddress != "" {
+		http.HandleFunc("/debug/adoption", controllerutil.ServeAdoption)
+		http.HandleFunc("/debug/canary", canary.ServeCanary)
+		http.HandleFunc("/debug/queues", controllerutil.ServeQueues)
+		http.Handle("/metrics", metrics.Handler())
+		// expvar registers the metrics handler on /debug/vars
+		go func() {
+			err := http.ListenAndServe(opts.MetricsAddress, nil)
+			log.Error("Metrics server exited", log.Fields{"err": err})
+		}()
+	}
+
+	if opts.CustomMetrics.Address != "" {
+		mux := http.NewServeMux()
+		mux.Handle(custommetrics.Prefix, custommetrics.NewHandler())
+		mux.Handle(custommetrics.Prefix+"/", custommetrics.NewHandler())
+		go func() {
+			var err error
+			if opts.CustomMetrics.TLSCertFile != "" {
+				err = http.ListenAndServeTLS(opts.CustomMetrics.Address, opts.CustomMetrics.TLSCertFile, opts.CustomMetrics.TLSKeyFile, mux)
+			} else {
+				err = http.ListenAndServe(opts.CustomMetrics.Address, mux)
+			}
+			log.Error("Custom metrics server exited", log.Fields{"err": err})
+		}()
+	}
+
+	// the admin endpoints change the state of controller and loadbalancers,
+	// they are only served to the authorized users on a separate address
+	var adminMux *admin.ServeMux
+	if opts.Admin.Address != "" {
+		adminMux = admin.NewServeMux(clientset)
+		adminMux.HandleFunc("/admin/adoption", controllerutil.ServeAdoptionSwitch)
+		adminMux.HandleFunc("/admin/canary", canary.ServeCanaryResume)
+		go func() {
+			var err error
+			if opts.Admin.TLSCertFile != "" {
+				err = http.ListenAndServeTLS(opts.Admin.Address, opts.Admin.TLSCertFile, opts.Admin.TLSKeyFile, adminMux)
+			} else {
+				err = http.ListenAndServe(opts.Admin.Address, adminMux)
+			}
+			log.Error("Admin server exited", log.Fields{"err": err})
+		}()
+	}
+
 	opts.Cfg.Client = clientset
 	opts.Cfg.TPRClient = tprclientset
-	// start a controller on instances of lb
-	controller := lbcontroller.NewLoadBalancerController(opts.Cfg)
+	opts.Cfg.RestConfig = config
+	opts.Cfg.Recorder = recorder
+	leading := health.NewGate("leader", "waiting for leadership")
+	run := func(stop <-chan struct{}) {
+		leading.Open()
+		// start a controller on instances of lb
+		controller := lbcontroller.NewLoadBalancerController(opts.Cfg)
+		if opts.MetricsAddress != "" {
+			http.HandleFunc("/debug/ownership/", controller.ServeOwnership)
+			http.HandleFunc("/debug/resync", controller.ServeResync)
+			http.HandleFunc("/debug/loadbalancers", controller.ServeLoadBalancers)
+		}
+		if adminMux != nil {
+			adminMux.HandleFunc("/admin/bulk", controller.ServeBulk)
+			adminMux.HandleFunc("/admin/takeover/", controller.ServeTakeover)
+			adminMux.HandleFunc("/admin/resync/", controller.ServeForceResync)
+		}
+		controller.Run(opts.Cfg.ConcurrentLoadBalancerSyncs, stop)
+	}
+
+	if !opts.LeaderElection.LeaderElect {
+		run(stopCh)
+		return nil
+	}
+
+	return runWithLeaderElection(opts, clientset, run)
+}
+
+// validateConfig validates configuration and the sections of all plugins,
+// so that misconfigurations are found at startup instead of first sync
+func validateConfig(cfg config.Configuration) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := proxy.ValidateConfig(cfg); err != nil {
+		return err
+	}
+	return provider.ValidateConfig(cfg)
+}
+
+// runWithLeaderElection runs the controller only when it is the leader
+func runWithLeaderElection(opts *Options, clientset kubernetes.Interface, run func(stop <-chan struct{})) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatal("Get hostname error", log.Fields{"err": err})
+		return err
+	}
+	// add a uniquifier so that two processes on the same host don't accidentally both become active
+	identity := hostname + "_" + rand.String(5)
 
-	controller.Run(5, stopCh)
+	le, err := leaderelection.NewLeaderElector(leaderelection.Config{
+		Client:        clientset,
+		Namespace:     opts.LeaderElection.Namespace,
+		Name:          opts.LeaderElection.Name,
+		Identity:      identity,
+		LeaseDuration: opts.LeaderElection.LeaseDuration,
+		RenewDeadline: opts.LeaderElection.RenewDeadline,
+		RetryPeriod:   opts.LeaderElection.RetryPeriod,
+		Callbacks: leaderelection.Callbacks{
+			OnStartedLeading: run,
+			OnStoppedLeading: func() {
+				log.Fatal("Leader election lost", log.Fields{"identity": identity})
+			},
+		},
+	})
+	if err != nil {
+		log.Fatal("Create leader elector error", log.Fields{"err": err})
+		return err
+	}
 
-	return nil
+	le.Run()
+	return fmt.Errorf("leader election lost")
 }
 
 func main() {
@@ -17,16 +17,53 @@ limitations under the License.
 package main
 
 import (
+	"time"
+
 	"github.com/caicloud/loadbalancer-controller/config"
-	log "github.com/zoumo/logdog"
 	"gopkg.in/urfave/cli.v1"
 )
 
 // Options contains controller options
 type Options struct {
-	Kubeconfig string
-	Debug      bool
-	Cfg        config.Configuration
+	Kubeconfig     string
+	ConfigFile     string
+	Debug          bool
+	MetricsAddress string
+	HealthAddress  string
+	CustomMetrics  CustomMetrics
+	Admin          Admin
+	RetryStateFile string
+	PauseAdoption  bool
+	LeaderElection LeaderElection
+	Cfg            config.Configuration
+
+	// InformerFailureTimeout is how long an informer fails to list or watch
+	// before the controller exits, 0 disables exiting
+	InformerFailureTimeout time.Duration
+}
+
+// CustomMetrics contains options of custom metrics API server
+type CustomMetrics struct {
+	Address     string
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+// Admin contains options of the server of admin endpoints
+type Admin struct {
+	Address     string
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+// LeaderElection contains leader election options
+type LeaderElection struct {
+	LeaderElect   bool
+	Namespace     string
+	Name          string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
 }
 
 // NewOptions reutrns a new Options
@@ -44,15 +81,124 @@ func (opts *Options) AddFlags(app *cli.App) {
 			Usage:       "Path to a kube config. Only required if out-of-cluster.",
 			Destination: &opts.Kubeconfig,
 		},
+		cli.StringFlag{
+			Name:        "config",
+			Usage:       "Path to a config `file` in yaml or json with sections of plugins, the values in file override flags",
+			EnvVar:      "CONFIG_FILE",
+			Destination: &opts.ConfigFile,
+		},
 		cli.BoolFlag{
 			Name:        "debug",
-			Usage:       "Run with debug mode",
+			Usage:       "Run with debug mode, it overrides the default log level with debug",
 			Destination: &opts.Debug,
 		},
+		cli.StringFlag{
+			Name:        "metrics-address",
+			Usage:       "The `address` to expose metrics on /debug/vars and in Prometheus format on /metrics, loadbalancers with their workloads and sync errors on /debug/loadbalancers, pending keys of queues on /debug/queues, ownership trees on /debug/ownership/{namespace}/{name}, next resync times on /debug/resync, the state of adoption switch on /debug/adoption and the state of canary rollouts on /debug/canary, disabled if empty",
+			EnvVar:      "METRICS_ADDRESS",
+			Value:       ":8080",
+			Destination: &opts.MetricsAddress,
+		},
+		cli.StringFlag{
+			Name:        "health-address",
+			Usage:       "The `address` to serve liveness checks on /healthz and readiness checks on /readyz, disabled if empty",
+			EnvVar:      "HEALTH_ADDRESS",
+			Value:       ":8081",
+			Destination: &opts.HealthAddress,
+		},
+		cli.StringFlag{
+			Name:        "custom-metrics-address",
+			Usage:       "The `address` to serve the IPVS connections of loadbalancers in custom metrics API custom.metrics.k8s.io/v1alpha1 for HorizontalPodAutoscaler, disabled if empty",
+			EnvVar:      "CUSTOM_METRICS_ADDRESS",
+			Destination: &opts.CustomMetrics.Address,
+		},
+		cli.StringFlag{
+			Name:        "custom-metrics-tls-cert-file",
+			Usage:       "The certificate `file` of custom metrics API server, required by the aggregator of apiserver, served in plain HTTP if empty",
+			EnvVar:      "CUSTOM_METRICS_TLS_CERT_FILE",
+			Destination: &opts.CustomMetrics.TLSCertFile,
+		},
+		cli.StringFlag{
+			Name:        "custom-metrics-tls-private-key-file",
+			Usage:       "The private key `file` matching the certificate of custom metrics API server",
+			EnvVar:      "CUSTOM_METRICS_TLS_PRIVATE_KEY_FILE",
+			Destination: &opts.CustomMetrics.TLSKeyFile,
+		},
+		cli.StringFlag{
+			Name:        "admin-address",
+			Usage:       "The `address` to serve bulk operations on /admin/bulk, the adoption switch on /admin/adoption, resumes of canary rollouts on /admin/canary, takeovers from other controllers on /admin/takeover/{namespace}/{name} and forced resyncs on /admin/resync/{namespace}/{name}, disabled if empty. The bearer tokens of requests are reviewed by TokenReview, and the paths by SubjectAccessReview of nonResourceURLs",
+			EnvVar:      "ADMIN_ADDRESS",
+			Destination: &opts.Admin.Address,
+		},
+		cli.StringFlag{
+			Name:        "admin-tls-cert-file",
+			Usage:       "The certificate `file` of admin server, served in plain HTTP if empty",
+			EnvVar:      "ADMIN_TLS_CERT_FILE",
+			Destination: &opts.Admin.TLSCertFile,
+		},
+		cli.StringFlag{
+			Name:        "admin-tls-private-key-file",
+			Usage:       "The private key `file` matching the certificate of admin server",
+			EnvVar:      "ADMIN_TLS_PRIVATE_KEY_FILE",
+			Destination: &opts.Admin.TLSKeyFile,
+		},
+		cli.StringFlag{
+			Name:        "retry-state-file",
+			Usage:       "Persist the retry state of loadbalancers to `file` to keep it stable across restarts, disabled if empty",
+			EnvVar:      "RETRY_STATE_FILE",
+			Destination: &opts.RetryStateFile,
+		},
 		cli.BoolFlag{
-			Name:        "log-force-color",
-			Usage:       "Force log to output with colore",
-			Destination: &log.ForceColor,
+			Name:        "pause-adoption",
+			Usage:       "Start with adoption of orphan deployments and daemonsets paused, it can be resumed by POST /admin/adoption?paused=false on admin address",
+			EnvVar:      "PAUSE_ADOPTION",
+			Destination: &opts.PauseAdoption,
+		},
+		// leader election
+		cli.BoolFlag{
+			Name:        "leader-elect",
+			Usage:       "Start a leader election client and gain leadership before executing the main loop",
+			EnvVar:      "LEADER_ELECT",
+			Destination: &opts.LeaderElection.LeaderElect,
+		},
+		cli.StringFlag{
+			Name:        "leader-elect-namespace",
+			Usage:       "`Namespace` of the ConfigMap used as leader election lock",
+			EnvVar:      "LEADER_ELECT_NAMESPACE",
+			Value:       "kube-system",
+			Destination: &opts.LeaderElection.Namespace,
+		},
+		cli.StringFlag{
+			Name:        "leader-elect-name",
+			Usage:       "`Name` of the ConfigMap used as leader election lock",
+			EnvVar:      "LEADER_ELECT_NAME",
+			Value:       "loadbalancer-controller",
+			Destination: &opts.LeaderElection.Name,
+		},
+		cli.DurationFlag{
+			Name:        "informer-failure-timeout",
+			Usage:       "The `duration` an informer keeps failing to list or watch before the controller exits with code 3 (forbidden), 4 (resource not found) or 5 (apiserver unreachable), 0 disables exiting",
+			EnvVar:      "INFORMER_FAILURE_TIMEOUT",
+			Value:       5 * time.Minute,
+			Destination: &opts.InformerFailureTimeout,
+		},
+		cli.DurationFlag{
+			Name:        "leader-elect-lease-duration",
+			Usage:       "The `duration` that non-leader candidates will wait after observing a leadership renewal until attempting to acquire leadership",
+			Value:       15 * time.Second,
+			Destination: &opts.LeaderElection.LeaseDuration,
+		},
+		cli.DurationFlag{
+			Name:        "leader-elect-renew-deadline",
+			Usage:       "The `interval` between attempts by the acting master to renew a leadership slot before it stops leading",
+			Value:       10 * time.Second,
+			Destination: &opts.LeaderElection.RenewDeadline,
+		},
+		cli.DurationFlag{
+			Name:        "leader-elect-retry-period",
+			Usage:       "The `duration` the clients should wait between attempting acquisition and renewal of a leadership",
+			Value:       2 * time.Second,
+			Destination: &opts.LeaderElection.RetryPeriod,
 		},
 	}
 
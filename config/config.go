@@ -17,12 +17,21 @@ limitations under the License.
 package config
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
+	"github.com/juju/ratelimit"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
 	"github.com/caicloud/loadbalancer-controller/pkg/toleration"
 	"github.com/caicloud/loadbalancer-controller/pkg/tprclient"
+	stringsutil "github.com/caicloud/loadbalancer-controller/pkg/util/strings"
 	cli "gopkg.in/urfave/cli.v1"
 )
 
@@ -30,9 +39,17 @@ const (
 	defaultIpvsdrImage         = "cargo.caicloud.io/caicloud/loadbalancer-provider-ipvsdr:v0.2.0"
 	defaultHTTPBackendImage    = "cargo.caicloud.io/caicloud/default-http-backend:v0.1.0"
 	defaultNginxIngressImage   = "cargo.caicloud.io/caicloud/nginx-ingress-controller:0.9.0-beta.11"
+	defaultNginxIngressV1Image = "cargo.caicloud.io/caicloud/nginx-ingress-controller:v1.1.1"
 	defaultIngressSidecarImage = "cargo.caicloud.io/caicloud/ingress-controller-sidecar:v0.2.1"
 )
 
+// Policies of anti-affinity between provider pods of different loadbalancers
+const (
+	AntiAffinityNone      = "none"
+	AntiAffinityPreferred = "preferred"
+	AntiAffinityRequired  = "required"
+)
+
 type additionalTolerations []string
 
 func (a *additionalTolerations) Set(value string) error {
@@ -52,39 +69,437 @@ func (a *additionalTolerations) String() string {
 
 // Configuration contains the global config of controller
 type Configuration struct {
-	Client                kubernetes.Interface
-	TPRClient             tprclient.Interface
+	Client    kubernetes.Interface
+	TPRClient tprclient.Interface
+	// RestConfig is the config of clients, plugins build their own clients
+	// from it if Identity.PerPlugin is enabled
+	RestConfig            *rest.Config
+	Recorder              record.EventRecorder
 	AdditionalTolerations additionalTolerations
-	Proxies               Proxies
-	Providers             Providers
+	StatusView            bool
+	Bootstrap             bool
+	// StatusViewSources is a comma separated list of the system namespaces in
+	// which the loadbalancers are mirrored into tenant namespaces
+	StatusViewSources string
+	// AuditDiff logs and counts the fields where the desired objects differ
+	// from the live ones but are not reconciled by plugins
+	AuditDiff bool
+	// DryRun syncs all loadbalancers in dry run mode, the plugins log and
+	// record the changes they would make without writing, and the background
+	// loops such as garbage collection only log their planned changes
+	DryRun bool
+	// HeapsterService is the heapster service (namespace/name) which the
+	// metrics for autoscaling are got from
+	HeapsterService string
+	// PriorityClassName is the default priority class of pods generated by
+	// plugins, it is overridden by the template of loadbalancer
+	PriorityClassName string
+	// ResyncPeriod is the seconds between periodic resyncs of a loadbalancer,
+	// the resyncs of loadbalancers are smeared across the period
+	ResyncPeriod int
+	// GCPeriod is the seconds between garbage collections of the resources
+	// orphaned by deleted loadbalancers
+	GCPeriod int
+	// InformerResyncPeriod is the seconds between resyncs of informers, which
+	// redeliver all the cached objects to event handlers
+	InformerResyncPeriod int
+	// StatusBatchDelay is the milliseconds the status fragments of a
+	// loadbalancer are batched before they are written in one patch, 0
+	// writes the status at once
+	StatusBatchDelay int
+	// ConcurrentLoadBalancerSyncs is the number of workers syncing
+	// loadbalancers in controller
+	ConcurrentLoadBalancerSyncs int
+	RateLimiter                 RateLimiter
+	Rollout                     Rollout
+	Log                         Log
+	Monitoring                  Monitoring
+	NetworkPolicy               NetworkPolicy
+	Namespaces                  Namespaces
+	Security                    Security
+	Handoff                     Handoff
+	Identity                    Identity
+	Quota                       Quota
+	Proxies                     Proxies
+	Providers                   Providers
+}
+
+// RateLimiter contains all cli flags of the rate limiter of work queues
+type RateLimiter struct {
+	// BaseDelay is the milliseconds of the first retry of a failed item,
+	// it is doubled by each failure
+	BaseDelay int `json:"baseDelay,omitempty"`
+	// MaxDelay is the max seconds between retries of a failed item
+	MaxDelay int `json:"maxDelay,omitempty"`
+	// QPS is the overall rate of retries of a queue
+	QPS int `json:"qps,omitempty"`
+	// Burst is the bucket size of the overall rate of retries
+	Burst int `json:"burst,omitempty"`
+	// FailureThreshold is the number of consecutive failures of an item
+	// before its retries are degraded to SlowRetryInterval
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// SlowRetryInterval is the seconds between retries of an item failing
+	// more than FailureThreshold times in a row
+	SlowRetryInterval int `json:"slowRetryInterval,omitempty"`
+}
+
+// New returns a rate limiter for work queues, it has both overall and per-item
+// rate limiting like workqueue.DefaultControllerRateLimiter
+func (r RateLimiter) New() workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(time.Duration(r.BaseDelay)*time.Millisecond, time.Duration(r.MaxDelay)*time.Second),
+		&workqueue.BucketRateLimiter{Bucket: ratelimit.NewBucketWithRate(float64(r.QPS), int64(r.Burst))},
+	)
+}
+
+// Log contains all cli flags of logging
+type Log struct {
+	// Format is the format of log entries, one of text, json and glog
+	Format string `json:"format,omitempty"`
+	// Level is the default level of loggers, one of debug, info, notice,
+	// warn, error and fatal
+	Level string `json:"level,omitempty"`
+	// PluginLevels is a comma separated list of plugin=level overriding
+	// Level for the plugins, e.g. ipvsdr=debug,nginx=warn
+	PluginLevels string `json:"pluginLevels,omitempty"`
+	// ForceColor forces text format to output with color
+	ForceColor bool `json:"forceColor,omitempty"`
+}
+
+// Options returns the options of loggers, error is returned if the level or
+// format is unknown
+func (l Log) Options() (log.Options, error) {
+	level, err := log.ParseLevel(l.Level)
+	if err != nil {
+		return log.Options{}, fmt.Errorf("log.level: %v", err)
+	}
+	levels, err := log.ParseLevels(l.PluginLevels)
+	if err != nil {
+		return log.Options{}, fmt.Errorf("log.pluginLevels: %v", err)
+	}
+	if !stringsutil.StringInSlice(l.Format, log.Formats) {
+		return log.Options{}, fmt.Errorf("log.format must be one of %s", strings.Join(log.Formats, ", "))
+	}
+	return log.Options{
+		Format:     l.Format,
+		Level:      level,
+		Levels:     levels,
+		ForceColor: l.ForceColor,
+	}, nil
+}
+
+// Monitoring contains all cli flags of the monitoring objects generated for
+// loadbalancers, a PrometheusRule of alerts and a ConfigMap of Grafana dashboard
+type Monitoring struct {
+	// Enabled enables generating the monitoring objects
+	Enabled bool `json:"enabled,omitempty"`
+	// RulesTemplate is the path of text/template rendering the spec of
+	// PrometheusRule in yaml, the builtin template is used if it is empty
+	RulesTemplate string `json:"rulesTemplate,omitempty"`
+	// DashboardTemplate is the path of text/template rendering the Grafana
+	// dashboard in json, the builtin template is used if it is empty
+	DashboardTemplate string `json:"dashboardTemplate,omitempty"`
+	// RuleLabels is a comma separated list of key=value labeling PrometheusRules,
+	// so that they are selected by the ruleSelector of Prometheus
+	RuleLabels string `json:"ruleLabels,omitempty"`
+	// DashboardLabels is a comma separated list of key=value labeling dashboard
+	// ConfigMaps, so that they are discovered by the sidecar of Grafana
+	DashboardLabels string `json:"dashboardLabels,omitempty"`
+	// PodMonitors enables generating PodMonitors of prometheus operator for
+	// the pods of plugins exposing metrics and the controller itself
+	PodMonitors bool `json:"podMonitors,omitempty"`
+	// PodMonitorLabels is a comma separated list of key=value labeling
+	// PodMonitors, so that they are selected by the podMonitorSelector of
+	// Prometheus
+	PodMonitorLabels string `json:"podMonitorLabels,omitempty"`
+	// ControllerNamespace is the namespace of controller pods
+	ControllerNamespace string `json:"controllerNamespace,omitempty"`
+	// ControllerSelector is a comma separated list of key=value selecting the
+	// controller pods, which expose metrics on the port named metrics. No
+	// PodMonitor of controller is generated if it is empty
+	ControllerSelector string `json:"controllerSelector,omitempty"`
+}
+
+// PodMonitorLabelSet returns the labels of PodMonitors, they are validated
+func (m Monitoring) PodMonitorLabelSet() map[string]string {
+	set, _ := labels.ConvertSelectorToLabelsMap(m.PodMonitorLabels)
+	return set
+}
+
+// NetworkPolicy contains all cli flags of the NetworkPolicies generated by
+// plugins for the pods they create
+type NetworkPolicy struct {
+	// Enabled enables generating NetworkPolicies, which allow ingress to the
+	// declared ports of pods and egress to EgressCIDRs only
+	Enabled bool `json:"enabled,omitempty"`
+	// EgressCIDRs is a comma separated list of CIDRs the pods connect to,
+	// e.g. the service and pod CIDRs of cluster and the address of api server
+	EgressCIDRs string `json:"egressCIDRs,omitempty"`
+}
+
+// CIDRs returns the egress CIDRs in a slice
+func (n NetworkPolicy) CIDRs() []string {
+	var cidrs []string
+	for _, cidr := range strings.Split(n.EgressCIDRs, ",") {
+		if cidr = strings.TrimSpace(cidr); cidr != "" {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs
+}
+
+// Namespaces contains all cli flags of the namespaces in which loadbalancers
+// are reconciled, the informers of namespaced objects are restricted to them
+// for multi-tenant clusters. The objects referenced in other namespaces are
+// not seen by plugins
+type Namespaces struct {
+	// Allow is a comma separated list of namespaces watched, all namespaces
+	// are watched if it is empty
+	Allow string `json:"allow,omitempty"`
+	// Deny is a comma separated list of namespaces not watched, it is
+	// exclusive with Allow
+	Deny string `json:"deny,omitempty"`
+}
+
+// Allowed returns the namespaces watched in a slice
+func (n Namespaces) Allowed() []string {
+	return splitList(n.Allow)
+}
+
+// Denied returns the namespaces not watched in a slice
+func (n Namespaces) Denied() []string {
+	return splitList(n.Deny)
+}
+
+// Watched returns true if the loadbalancers in namespace are reconciled
+func (n Namespaces) Watched(namespace string) bool {
+	if allowed := n.Allowed(); len(allowed) != 0 {
+		return stringsutil.StringInSlice(namespace, allowed)
+	}
+	return !stringsutil.StringInSlice(namespace, n.Denied())
+}
+
+// StatusViewSourceNamespaces returns the namespaces in which the loadbalancers
+// are mirrored into tenant namespaces in a slice
+func (c *Configuration) StatusViewSourceNamespaces() []string {
+	return splitList(c.StatusViewSources)
+}
+
+// splitList splits a comma separated list, the empty items are dropped
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Security contains all cli flags of the identity and privileges of pods
+// generated by plugins
+type Security struct {
+	// ServiceAccounts enables generating a ServiceAccount with a Role granting
+	// the minimal permissions for the pods of each loadbalancer, the default
+	// ServiceAccount of namespace is used if it is disabled
+	ServiceAccounts bool `json:"serviceAccounts,omitempty"`
+	// ProxyClusterRole is the ClusterRole bound to the ServiceAccounts of
+	// proxies for watching ingresses, services and endpoints in cluster,
+	// nothing is bound if it is empty
+	ProxyClusterRole string `json:"proxyClusterRole,omitempty"`
+	// Unprivileged drops privileged mode of containers in favor of the
+	// capabilities they need, e.g. NET_ADMIN and NET_RAW
+	Unprivileged bool `json:"unprivileged,omitempty"`
+}
+
+// Handoff contains all cli flags of the ownership handoff between controllers,
+// e.g. a fork running alongside upstream during migration
+type Handoff struct {
+	// ControllerID is the identity of controller in the owner annotation of
+	// loadbalancers, the unowned ones are claimed by the controller with
+	// identity. The controller without identity reconciles unowned ones only
+	ControllerID string `json:"controllerID,omitempty"`
+	// LeaseNamespace is the namespace of the lease ConfigMaps of controllers
+	LeaseNamespace string `json:"leaseNamespace,omitempty"`
+	// LeaseDuration is the seconds a controller is considered alive after it
+	// renewed its lease, the loadbalancers of dead controller are taken over
+	// without handshake
+	LeaseDuration int `json:"leaseDuration,omitempty"`
+}
+
+// Identity contains all cli flags of the identity of controller in requests
+// to api server, which is recorded as userAgent in audit events. The client
+// predates server-side apply, so the user agent also stands for the field
+// manager until writes are migrated to apply
+type Identity struct {
+	// UserAgent is the user agent of requests sent by controller
+	UserAgent string `json:"userAgent,omitempty"`
+	// PerPlugin suffixes UserAgent with the name of plugin sending requests,
+	// e.g. loadbalancer-controller/ipvsdr, so that changes are attributed to
+	// plugins in audit logs
+	PerPlugin bool `json:"perPlugin,omitempty"`
+}
+
+// PluginClients returns the clients used by plugin, they identify the plugin
+// in user agent if Identity.PerPlugin is enabled
+func (c Configuration) PluginClients(plugin string) (kubernetes.Interface, tprclient.Interface) {
+	if !c.Identity.PerPlugin || c.RestConfig == nil {
+		return c.Client, c.TPRClient
+	}
+
+	config := *c.RestConfig
+	config.UserAgent = c.Identity.UserAgent + "/" + plugin
+	client, err := kubernetes.NewForConfig(&config)
+	if err != nil {
+		log.Error("Create kubernetes client of plugin error, fall back to the shared one", log.Fields{"plugin": plugin, "err": err})
+		return c.Client, c.TPRClient
+	}
+	tprClient, err := tprclient.NewForConfig(&config)
+	if err != nil {
+		log.Error("Create tpr client of plugin error, fall back to the shared one", log.Fields{"plugin": plugin, "err": err})
+		return c.Client, c.TPRClient
+	}
+	return client, tprClient
+}
+
+// Quota contains all cli flags of the quotas of loadbalancers, the oldest
+// loadbalancers are admitted first, the others are not reconciled until the
+// quota is available
+type Quota struct {
+	// Namespace is the max number of loadbalancers in a namespace, 0 means unlimited
+	Namespace int `json:"namespace,omitempty"`
+	// Cluster is the max number of loadbalancers in cluster, 0 means unlimited
+	Cluster int `json:"cluster,omitempty"`
+	// ConfigMap (namespace/name) overrides the quotas at runtime, the keys
+	// are cluster, namespace and namespace.<name> for a specific namespace
+	ConfigMap string `json:"configMap,omitempty"`
+}
+
+// Rollout contains all cli flags of staged rollout of canary images
+type Rollout struct {
+	// CanaryPercentage is the percentage of loadbalancers receiving the canary
+	// images of plugins, in addition to the ones annotated as canary
+	CanaryPercentage int `json:"canaryPercentage,omitempty"`
+	// CanaryProgressDeadline is the seconds a canary workload has to become
+	// available, otherwise the rollout of canary image is paused
+	CanaryProgressDeadline int `json:"canaryProgressDeadline,omitempty"`
 }
 
 // Proxies contains all cli flags of proxies
 type Proxies struct {
-	DefaultHTTPBackend    string
-	DefaultSSLCertificate string
-	Sidecar               IngressSidecar
-	Nginx                 ProxyNginx
+	DefaultHTTPBackend    string         `json:"defaultHTTPBackend,omitempty"`
+	DefaultSSLCertificate string         `json:"defaultSSLCertificate,omitempty"`
+	Sidecar               IngressSidecar `json:"sidecar,omitempty"`
+	Nginx                 ProxyNginx     `json:"nginx,omitempty"`
 }
 
 // IngressSidecar contains all cli flags of ingress controller sidecar
 type IngressSidecar struct {
-	Image string
+	Image string `json:"image,omitempty"`
 }
 
 // ProxyNginx contains all cli flags of nginx proxy
 type ProxyNginx struct {
-	Image string
+	Image string `json:"image,omitempty"`
+	// CanaryImage is rolled out to canary loadbalancers before it replaces Image
+	CanaryImage string `json:"canaryImage,omitempty"`
+	// ShutdownTimeout is the seconds nginx workers wait for long-lived
+	// connections such as websockets to close when a proxy pod is stopped
+	ShutdownTimeout int `json:"shutdownTimeout,omitempty"`
+	// IngressAPI is the API of Ingress watched by nginx ingress controller,
+	// one of auto, extensions/v1beta1 and networking.k8s.io/v1
+	IngressAPI string `json:"ingressAPI,omitempty"`
+	// IngressV1Image is the image of nginx ingress controller which watches
+	// networking.k8s.io/v1 Ingress, it replaces Image on modern clusters
+	IngressV1Image string `json:"ingressV1Image,omitempty"`
+	// WAFImage is the image of nginx ingress controller built with ModSecurity,
+	// it replaces the image of loadbalancers enabling WAF if it is set
+	WAFImage string `json:"wafImage,omitempty"`
+	// Workers is the number of loadbalancers synced concurrently by nginx proxy
+	Workers int `json:"workers,omitempty"`
 }
 
 // Providers contains all cli flags of providers
 type Providers struct {
-	Ipvsdr ProviderIpvsdr
+	// AntiAffinity is the scheduling policy between provider pods of different
+	// loadbalancers, one of none, preferred and required
+	AntiAffinity string         `json:"antiAffinity,omitempty"`
+	Ipvsdr       ProviderIpvsdr `json:"ipvsdr,omitempty"`
+	Azure        ProviderCloud  `json:"azure,omitempty"`
+	GCE          ProviderCloud  `json:"gce,omitempty"`
+	// External contains the plugins serving out-of-tree providers
+	External ProviderExternal `json:"external,omitempty"`
 }
 
 // ProviderIpvsdr contains all cli flags of ipvsdr providers
 type ProviderIpvsdr struct {
-	Image string
+	Image string `json:"image,omitempty"`
+	// CanaryImage is rolled out to canary loadbalancers before it replaces Image
+	CanaryImage string `json:"canaryImage,omitempty"`
+	// InitImage is the image of init container which loads ipvs modules and
+	// sets sysctls before provider starts, so that the provider container can
+	// run without privileges. The provider runs privileged if it is empty
+	InitImage string `json:"initImage,omitempty"`
+	// ReservedVRIDs is a comma separated list of VRIDs or VRID ranges used
+	// by keepalived outside of this controller, e.g. 1-10,100
+	ReservedVRIDs string `json:"reservedVRIDs,omitempty"`
+	// VipPools is a comma separated list of CIDRs which vips are allocated from
+	VipPools string `json:"vipPools,omitempty"`
+	// ProbeImage is the image used to probe whether the vip is already in use
+	// on the network before provisioning, the probe is disabled if it is empty
+	ProbeImage string `json:"probeImage,omitempty"`
+	// ExporterImage is the image of ipvs exporter sidecar run in the pods of
+	// loadbalancers enabling metrics, the sidecar is not run if it is empty
+	ExporterImage string `json:"exporterImage,omitempty"`
+	// DrainTimeout is the seconds a terminating provider pod waits for
+	// existing connections to bleed off after it is signaled to drain
+	DrainTimeout int `json:"drainTimeout,omitempty"`
+	// Workers is the number of loadbalancers synced concurrently by ipvsdr provider
+	Workers int `json:"workers,omitempty"`
+	// ReleaseCooldown is the seconds a released vip or VRID is quarantined
+	// before it is allocated again, so that ARP caches of switches and VRRP
+	// peers forget the previous owner
+	ReleaseCooldown int `json:"releaseCooldown,omitempty"`
+	// DataplaneBackend is the default netfilter backend of helper rules of
+	// provider pods, auto, iptables or nftables, it is overridden by spec
+	DataplaneBackend string `json:"dataplaneBackend,omitempty"`
+}
+
+// ProviderCloud contains all cli flags of cloud providers
+type ProviderCloud struct {
+	// Workers is the number of loadbalancers synced concurrently by the cloud provider
+	Workers int `json:"workers,omitempty"`
+}
+
+// ProviderExternal contains all cli flags of the external provider
+type ProviderExternal struct {
+	// Endpoints is a comma separated list of external plugins in the format
+	// of name=url, e.g. f5=http://f5-plugin.kube-system:8080
+	Endpoints string `json:"endpoints,omitempty"`
+	// Timeout is the seconds a call to external plugin may take
+	Timeout int `json:"timeout,omitempty"`
+	// Workers is the number of loadbalancers synced concurrently by the external provider
+	Workers int `json:"workers,omitempty"`
+}
+
+// Plugins returns the endpoints of external plugins indexed by name
+func (e ProviderExternal) Plugins() (map[string]string, error) {
+	plugins := make(map[string]string)
+	for _, pair := range strings.Split(e.Endpoints, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("%q is not in the format of name=url", pair)
+		}
+		name := strings.TrimSpace(parts[0])
+		if _, ok := plugins[name]; ok {
+			return nil, fmt.Errorf("plugin %v is duplicated", name)
+		}
+		plugins[name] = strings.TrimSpace(parts[1])
+	}
+	return plugins, nil
 }
 
 // AddFlags add flags to app
@@ -98,6 +513,314 @@ func (c *Configuration) AddFlags(app *cli.App) {
 			EnvVar: "ADDITIONAL_TOLERATIONS",
 			Value:  &c.AdditionalTolerations,
 		},
+		cli.BoolFlag{
+			Name:        "status-view",
+			Usage:       "Mirror a read-only LoadBalancerStatusView into tenant namespaces listed in the annotation of LoadBalancers in --status-view-sources",
+			EnvVar:      "STATUS_VIEW",
+			Destination: &c.StatusView,
+		},
+		cli.StringFlag{
+			Name:        "status-view-sources",
+			Usage:       "A comma separated list of system `namespaces` in which the LoadBalancers are mirrored into tenant namespaces, the LoadBalancers in other namespaces are never mirrored",
+			EnvVar:      "STATUS_VIEW_SOURCES",
+			Destination: &c.StatusViewSources,
+		},
+		cli.BoolFlag{
+			Name:        "monitoring",
+			Usage:       "Generate a PrometheusRule of alerts and a ConfigMap of Grafana dashboard owned by each LoadBalancer",
+			EnvVar:      "MONITORING",
+			Destination: &c.Monitoring.Enabled,
+		},
+		cli.StringFlag{
+			Name:        "monitoring-rules-template",
+			Usage:       "Path to a text/template `file` rendering the spec of PrometheusRule in yaml, the builtin template is used if empty",
+			EnvVar:      "MONITORING_RULES_TEMPLATE",
+			Destination: &c.Monitoring.RulesTemplate,
+		},
+		cli.StringFlag{
+			Name:        "monitoring-dashboard-template",
+			Usage:       "Path to a text/template `file` rendering the Grafana dashboard in json, the builtin template is used if empty",
+			EnvVar:      "MONITORING_DASHBOARD_TEMPLATE",
+			Destination: &c.Monitoring.DashboardTemplate,
+		},
+		cli.StringFlag{
+			Name:        "monitoring-rule-labels",
+			Usage:       "A comma separated list of `key=value` labels of PrometheusRules, selected by the ruleSelector of Prometheus",
+			EnvVar:      "MONITORING_RULE_LABELS",
+			Value:       "role=alert-rules",
+			Destination: &c.Monitoring.RuleLabels,
+		},
+		cli.StringFlag{
+			Name:        "monitoring-dashboard-labels",
+			Usage:       "A comma separated list of `key=value` labels of dashboard ConfigMaps, discovered by the sidecar of Grafana",
+			EnvVar:      "MONITORING_DASHBOARD_LABELS",
+			Value:       "grafana_dashboard=1",
+			Destination: &c.Monitoring.DashboardLabels,
+		},
+		cli.BoolFlag{
+			Name:        "monitoring-pod-monitors",
+			Usage:       "Generate PodMonitors of prometheus operator for the pods of loadbalancers and the controller",
+			EnvVar:      "MONITORING_POD_MONITORS",
+			Destination: &c.Monitoring.PodMonitors,
+		},
+		cli.StringFlag{
+			Name:        "monitoring-pod-monitor-labels",
+			Usage:       "A comma separated list of `key=value` labels of PodMonitors, selected by the podMonitorSelector of Prometheus",
+			EnvVar:      "MONITORING_POD_MONITOR_LABELS",
+			Destination: &c.Monitoring.PodMonitorLabels,
+		},
+		cli.StringFlag{
+			Name:        "monitoring-controller-namespace",
+			Usage:       "`Namespace` of controller pods, where the PodMonitor of controller is generated",
+			EnvVar:      "MONITORING_CONTROLLER_NAMESPACE",
+			Value:       "kube-system",
+			Destination: &c.Monitoring.ControllerNamespace,
+		},
+		cli.StringFlag{
+			Name:        "monitoring-controller-selector",
+			Usage:       "A comma separated list of `key=value` labels selecting controller pods, which expose metrics on the port named metrics. No PodMonitor of controller is generated if empty",
+			EnvVar:      "MONITORING_CONTROLLER_SELECTOR",
+			Destination: &c.Monitoring.ControllerSelector,
+		},
+		cli.BoolFlag{
+			Name:        "network-policy",
+			Usage:       "Generate NetworkPolicies restricting the ingress and egress of pods created by plugins",
+			EnvVar:      "NETWORK_POLICY",
+			Destination: &c.NetworkPolicy.Enabled,
+		},
+		cli.StringFlag{
+			Name:        "network-policy-egress-cidrs",
+			Usage:       "A comma separated list of `CIDRs` which the pods created by plugins connect to, e.g. the service and pod CIDRs and the address of api server",
+			EnvVar:      "NETWORK_POLICY_EGRESS_CIDRS",
+			Destination: &c.NetworkPolicy.EgressCIDRs,
+		},
+		cli.StringFlag{
+			Name:        "namespaces",
+			Usage:       "A comma separated list of `namespaces` in which loadbalancers are watched and reconciled, all namespaces if empty",
+			EnvVar:      "NAMESPACES",
+			Destination: &c.Namespaces.Allow,
+		},
+		cli.StringFlag{
+			Name:        "ignore-namespaces",
+			Usage:       "A comma separated list of `namespaces` in which loadbalancers are not watched, exclusive with --namespaces",
+			EnvVar:      "IGNORE_NAMESPACES",
+			Destination: &c.Namespaces.Deny,
+		},
+		cli.BoolFlag{
+			Name:        "service-accounts",
+			Usage:       "Generate a ServiceAccount with the minimal Role for the pods of each loadbalancer instead of using the default one",
+			EnvVar:      "SERVICE_ACCOUNTS",
+			Destination: &c.Security.ServiceAccounts,
+		},
+		cli.StringFlag{
+			Name:        "proxy-cluster-role",
+			Usage:       "`ClusterRole` bound to the ServiceAccounts of proxies for watching ingresses, services and endpoints, nothing is bound if empty",
+			EnvVar:      "PROXY_CLUSTER_ROLE",
+			Value:       "loadbalancer-proxy",
+			Destination: &c.Security.ProxyClusterRole,
+		},
+		cli.BoolFlag{
+			Name:        "unprivileged-pods",
+			Usage:       "Run containers of generated pods with the capabilities they need, e.g. NET_ADMIN and NET_RAW, instead of privileged mode",
+			EnvVar:      "UNPRIVILEGED_PODS",
+			Destination: &c.Security.Unprivileged,
+		},
+		cli.StringFlag{
+			Name:        "controller-id",
+			Usage:       "`Identity` of this controller owning loadbalancers, the ones owned by other controllers are not reconciled, unowned ones are claimed if it is set",
+			EnvVar:      "CONTROLLER_ID",
+			Destination: &c.Handoff.ControllerID,
+		},
+		cli.StringFlag{
+			Name:        "controller-lease-namespace",
+			Usage:       "`Namespace` of the lease ConfigMaps of controllers",
+			EnvVar:      "CONTROLLER_LEASE_NAMESPACE",
+			Value:       "kube-system",
+			Destination: &c.Handoff.LeaseNamespace,
+		},
+		cli.IntFlag{
+			Name:        "controller-lease-duration",
+			Usage:       "`Seconds` a controller is considered alive after renewing its lease, loadbalancers of dead controllers are taken over without handshake",
+			EnvVar:      "CONTROLLER_LEASE_DURATION",
+			Value:       60,
+			Destination: &c.Handoff.LeaseDuration,
+		},
+		cli.StringFlag{
+			Name:        "user-agent",
+			Usage:       "`User agent` of requests to api server, recorded in audit events",
+			EnvVar:      "USER_AGENT",
+			Value:       "loadbalancer-controller",
+			Destination: &c.Identity.UserAgent,
+		},
+		cli.BoolFlag{
+			Name:        "user-agent-per-plugin",
+			Usage:       "Suffix the user agent with the name of plugin sending requests, e.g. loadbalancer-controller/ipvsdr",
+			EnvVar:      "USER_AGENT_PER_PLUGIN",
+			Destination: &c.Identity.PerPlugin,
+		},
+		cli.IntFlag{
+			Name:        "quota-namespace",
+			Usage:       "Max `number` of loadbalancers in a namespace, 0 means unlimited",
+			EnvVar:      "QUOTA_NAMESPACE",
+			Destination: &c.Quota.Namespace,
+		},
+		cli.IntFlag{
+			Name:        "quota-cluster",
+			Usage:       "Max `number` of loadbalancers in cluster, 0 means unlimited",
+			EnvVar:      "QUOTA_CLUSTER",
+			Destination: &c.Quota.Cluster,
+		},
+		cli.StringFlag{
+			Name:        "quota-configmap",
+			Usage:       "`ConfigMap` (namespace/name) overriding quotas at runtime with keys cluster, namespace and namespace.<name>",
+			EnvVar:      "QUOTA_CONFIGMAP",
+			Destination: &c.Quota.ConfigMap,
+		},
+		cli.BoolFlag{
+			Name:        "bootstrap",
+			Usage:       "Create or update the LoadBalancer resource at startup and refuse to run until it is served",
+			EnvVar:      "BOOTSTRAP",
+			Destination: &c.Bootstrap,
+		},
+		cli.BoolFlag{
+			Name:        "audit-diff",
+			Usage:       "Log at debug level and count in metrics the fields where generated objects differ from live ones but are not reconciled",
+			EnvVar:      "AUDIT_DIFF",
+			Destination: &c.AuditDiff,
+		},
+		cli.BoolFlag{
+			Name:        "dry-run",
+			Usage:       "Log and record in events the changes plugins would make to loadbalancers without writing, for validating upgrades. Garbage collection, label migration, autoscaling, status views, lease renewal and PodMonitor of controller only log their changes",
+			EnvVar:      "DRY_RUN",
+			Destination: &c.DryRun,
+		},
+		cli.StringFlag{
+			Name:        "heapster-service",
+			Usage:       "Heapster `Service` (namespace/name) providing metrics of proxy pods for autoscaling",
+			EnvVar:      "HEAPSTER_SERVICE",
+			Value:       "kube-system/heapster",
+			Destination: &c.HeapsterService,
+		},
+		cli.StringFlag{
+			Name:        "priority-class-name",
+			Usage:       "Default `PriorityClass` of pods generated by plugins, e.g. system-cluster-critical, overridden by the template of LoadBalancer",
+			EnvVar:      "PRIORITY_CLASS_NAME",
+			Destination: &c.PriorityClassName,
+		},
+		cli.IntFlag{
+			Name:        "resync-period",
+			Usage:       "`Seconds` between periodic resyncs of a loadbalancer, smeared across loadbalancers by a hash based offset, 0 disables periodic resyncs",
+			EnvVar:      "RESYNC_PERIOD",
+			Value:       600,
+			Destination: &c.ResyncPeriod,
+		},
+		cli.IntFlag{
+			Name:        "informer-resync-period",
+			Usage:       "`Seconds` between resyncs of informers redelivering all cached objects to event handlers, 0 disables informer resyncs",
+			EnvVar:      "INFORMER_RESYNC_PERIOD",
+			Destination: &c.InformerResyncPeriod,
+		},
+		cli.IntFlag{
+			Name:        "gc-period",
+			Usage:       "`Seconds` between garbage collections of deployments, configmaps and node labels orphaned by deleted loadbalancers, 0 disables garbage collection",
+			EnvVar:      "GC_PERIOD",
+			Value:       600,
+			Destination: &c.GCPeriod,
+		},
+		cli.IntFlag{
+			Name:        "concurrent-loadbalancer-syncs",
+			Usage:       "The `number` of loadbalancers synced concurrently by controller",
+			EnvVar:      "CONCURRENT_LOADBALANCER_SYNCS",
+			Value:       5,
+			Destination: &c.ConcurrentLoadBalancerSyncs,
+		},
+		cli.IntFlag{
+			Name:        "status-batch-delay",
+			Usage:       "`Milliseconds` the status of a loadbalancer reported by controller and plugins is batched before it is written in one patch, 0 writes the status at once",
+			EnvVar:      "STATUS_BATCH_DELAY",
+			Value:       500,
+			Destination: &c.StatusBatchDelay,
+		},
+		cli.IntFlag{
+			Name:        "rate-limiter-base-delay",
+			Usage:       "`Milliseconds` before the first retry of a failed loadbalancer, doubled by each failure",
+			EnvVar:      "RATE_LIMITER_BASE_DELAY",
+			Value:       5,
+			Destination: &c.RateLimiter.BaseDelay,
+		},
+		cli.IntFlag{
+			Name:        "rate-limiter-max-delay",
+			Usage:       "Max `seconds` between retries of a failed loadbalancer",
+			EnvVar:      "RATE_LIMITER_MAX_DELAY",
+			Value:       1000,
+			Destination: &c.RateLimiter.MaxDelay,
+		},
+		cli.IntFlag{
+			Name:        "rate-limiter-qps",
+			Usage:       "Overall `QPS` of retries of each work queue",
+			EnvVar:      "RATE_LIMITER_QPS",
+			Value:       10,
+			Destination: &c.RateLimiter.QPS,
+		},
+		cli.IntFlag{
+			Name:        "rate-limiter-burst",
+			Usage:       "Overall `burst` of retries of each work queue",
+			EnvVar:      "RATE_LIMITER_BURST",
+			Value:       100,
+			Destination: &c.RateLimiter.Burst,
+		},
+		cli.IntFlag{
+			Name:        "rate-limiter-failure-threshold",
+			Usage:       "The `number` of consecutive failures of a loadbalancer before its retries slow down to rate-limiter-slow-retry-interval with a warning event",
+			EnvVar:      "RATE_LIMITER_FAILURE_THRESHOLD",
+			Value:       5,
+			Destination: &c.RateLimiter.FailureThreshold,
+		},
+		cli.IntFlag{
+			Name:        "rate-limiter-slow-retry-interval",
+			Usage:       "`Seconds` between retries of a loadbalancer failing more than rate-limiter-failure-threshold times in a row",
+			EnvVar:      "RATE_LIMITER_SLOW_RETRY_INTERVAL",
+			Value:       300,
+			Destination: &c.RateLimiter.SlowRetryInterval,
+		},
+		cli.StringFlag{
+			Name:        "log-format",
+			Usage:       "`Format` of log entries, one of text, json and glog",
+			EnvVar:      "LOG_FORMAT",
+			Value:       "text",
+			Destination: &c.Log.Format,
+		},
+		cli.StringFlag{
+			Name:        "log-level",
+			Usage:       "Default `level` of logs, one of debug, info, notice, warn, error and fatal",
+			EnvVar:      "LOG_LEVEL",
+			Value:       "info",
+			Destination: &c.Log.Level,
+		},
+		cli.StringFlag{
+			Name:        "log-plugin-levels",
+			Usage:       "A comma separated list of `plugin=level` overriding the log level of plugins, e.g. ipvsdr=debug,nginx=warn",
+			EnvVar:      "LOG_PLUGIN_LEVELS",
+			Destination: &c.Log.PluginLevels,
+		},
+		cli.BoolFlag{
+			Name:        "log-force-color",
+			Usage:       "Force log in text format to output with color",
+			Destination: &c.Log.ForceColor,
+		},
+		cli.IntFlag{
+			Name:        "canary-percentage",
+			Usage:       "`Percentage` of loadbalancers receiving canary images of proxies and providers first",
+			EnvVar:      "CANARY_PERCENTAGE",
+			Destination: &c.Rollout.CanaryPercentage,
+		},
+		cli.IntFlag{
+			Name:        "canary-progress-deadline",
+			Usage:       "`Seconds` for canary proxies and providers to become available before the rollout is paused",
+			EnvVar:      "CANARY_PROGRESS_DEADLINE",
+			Value:       600,
+			Destination: &c.Rollout.CanaryProgressDeadline,
+		},
 		// proxies
 		cli.StringFlag{
 			Name:        "default-http-backend",
@@ -127,6 +850,54 @@ func (c *Configuration) AddFlags(app *cli.App) {
 			Value:       defaultNginxIngressImage,
 			Destination: &c.Proxies.Nginx.Image,
 		},
+		cli.StringFlag{
+			Name:        "proxy-nginx-canary",
+			Usage:       "Canary `Image` of nginx ingress controller, rolled out to canary loadbalancers first",
+			EnvVar:      "PROXY_NGINX_CANARY",
+			Destination: &c.Proxies.Nginx.CanaryImage,
+		},
+		cli.IntFlag{
+			Name:        "proxy-nginx-shutdown-timeout",
+			Usage:       "`Seconds` to wait for long-lived connections to close before stopping a nginx proxy pod, 0 disables graceful shutdown",
+			EnvVar:      "PROXY_NGINX_SHUTDOWN_TIMEOUT",
+			Value:       60,
+			Destination: &c.Proxies.Nginx.ShutdownTimeout,
+		},
+		cli.StringFlag{
+			Name:        "proxy-nginx-ingress-api",
+			Usage:       "`API` of Ingress watched by nginx ingress controller, one of auto, extensions/v1beta1 and networking.k8s.io/v1, auto selects networking.k8s.io/v1 if it is served by the cluster",
+			EnvVar:      "PROXY_NGINX_INGRESS_API",
+			Value:       "auto",
+			Destination: &c.Proxies.Nginx.IngressAPI,
+		},
+		cli.StringFlag{
+			Name:        "proxy-nginx-ingress-v1",
+			Usage:       "`Image` of nginx ingress controller watching networking.k8s.io/v1 Ingress",
+			EnvVar:      "PROXY_NGINX_INGRESS_V1",
+			Value:       defaultNginxIngressV1Image,
+			Destination: &c.Proxies.Nginx.IngressV1Image,
+		},
+		cli.StringFlag{
+			Name:        "proxy-nginx-waf",
+			Usage:       "`Image` of nginx ingress controller built with ModSecurity, used by loadbalancers enabling WAF",
+			EnvVar:      "PROXY_NGINX_WAF",
+			Destination: &c.Proxies.Nginx.WAFImage,
+		},
+		cli.IntFlag{
+			Name:        "proxy-nginx-workers",
+			Usage:       "The `number` of loadbalancers synced concurrently by nginx proxy",
+			EnvVar:      "PROXY_NGINX_WORKERS",
+			Value:       1,
+			Destination: &c.Proxies.Nginx.Workers,
+		},
+		// providers
+		cli.StringFlag{
+			Name:        "provider-anti-affinity",
+			Usage:       "`Policy` (none, preferred or required) of spreading provider pods of different loadbalancers across nodes",
+			EnvVar:      "PROVIDER_ANTI_AFFINITY",
+			Value:       AntiAffinityPreferred,
+			Destination: &c.Providers.AntiAffinity,
+		},
 		// ipvsdr
 		cli.StringFlag{
 			Name:        "provider-ipvsdr",
@@ -135,6 +906,107 @@ func (c *Configuration) AddFlags(app *cli.App) {
 			Value:       defaultIpvsdrImage,
 			Destination: &c.Providers.Ipvsdr.Image,
 		},
+		cli.StringFlag{
+			Name:        "provider-ipvsdr-canary",
+			Usage:       "Canary `Image` of ipvsdr provider, rolled out to canary loadbalancers first",
+			EnvVar:      "PROVIDER_IPVS_DR_CANARY",
+			Destination: &c.Providers.Ipvsdr.CanaryImage,
+		},
+		cli.StringFlag{
+			Name:        "provider-ipvsdr-init",
+			Usage:       "`Image` of init container loading ipvs modules for ipvsdr provider, the provider container drops privileges if it is set",
+			EnvVar:      "PROVIDER_IPVS_DR_INIT",
+			Destination: &c.Providers.Ipvsdr.InitImage,
+		},
+		cli.StringFlag{
+			Name:        "provider-ipvsdr-reserved-vrids",
+			Usage:       "A comma separated list of `VRIDs` or ranges (e.g. 1-10,100) which will never be allocated to ipvsdr provider",
+			EnvVar:      "PROVIDER_IPVS_DR_RESERVED_VRIDS",
+			Destination: &c.Providers.Ipvsdr.ReservedVRIDs,
+		},
+		cli.StringFlag{
+			Name:        "provider-ipvsdr-vip-pools",
+			Usage:       "A comma separated list of `CIDRs` which vips are allocated from when ipvsdr vip is empty",
+			EnvVar:      "PROVIDER_IPVS_DR_VIP_POOLS",
+			Destination: &c.Providers.Ipvsdr.VipPools,
+		},
+		cli.StringFlag{
+			Name:        "provider-ipvsdr-arp-probe",
+			Usage:       "`Image` containing arping to detect vip conflicts before provisioning ipvsdr provider, the check is disabled if it is empty",
+			EnvVar:      "PROVIDER_IPVS_DR_ARP_PROBE",
+			Destination: &c.Providers.Ipvsdr.ProbeImage,
+		},
+		cli.StringFlag{
+			Name:        "provider-ipvsdr-exporter",
+			Usage:       "`Image` of ipvs exporter sidecar exporting the traffic of vips for the ipvsdr loadbalancers enabling metrics, no sidecar is run if it is empty",
+			EnvVar:      "PROVIDER_IPVS_DR_EXPORTER",
+			Destination: &c.Providers.Ipvsdr.ExporterImage,
+		},
+		cli.IntFlag{
+			Name:        "provider-ipvsdr-drain-timeout",
+			Usage:       "`Seconds` to wait for connections to bleed off before stopping an ipvsdr provider pod when scaling down or relocating",
+			EnvVar:      "PROVIDER_IPVS_DR_DRAIN_TIMEOUT",
+			Value:       30,
+			Destination: &c.Providers.Ipvsdr.DrainTimeout,
+		},
+		cli.IntFlag{
+			Name:        "provider-ipvsdr-workers",
+			Usage:       "The `number` of loadbalancers synced concurrently by ipvsdr provider",
+			EnvVar:      "PROVIDER_IPVS_DR_WORKERS",
+			Value:       1,
+			Destination: &c.Providers.Ipvsdr.Workers,
+		},
+		cli.IntFlag{
+			Name:        "provider-ipvsdr-release-cooldown",
+			Usage:       "`Seconds` a vip or VRID released by a deleted ipvsdr provider is quarantined before it is allocated again, 0 disables quarantine",
+			EnvVar:      "PROVIDER_IPVS_DR_RELEASE_COOLDOWN",
+			Value:       300,
+			Destination: &c.Providers.Ipvsdr.ReleaseCooldown,
+		},
+		cli.StringFlag{
+			Name:        "provider-ipvsdr-dataplane-backend",
+			Usage:       "Default `backend` of netfilter rules installed by ipvsdr provider, auto, iptables or nftables. Auto detects the one supported by each node",
+			EnvVar:      "PROVIDER_IPVS_DR_DATAPLANE_BACKEND",
+			Value:       "iptables",
+			Destination: &c.Providers.Ipvsdr.DataplaneBackend,
+		},
+		// azure
+		cli.IntFlag{
+			Name:        "provider-azure-workers",
+			Usage:       "The `number` of loadbalancers synced concurrently by azure provider",
+			EnvVar:      "PROVIDER_AZURE_WORKERS",
+			Value:       1,
+			Destination: &c.Providers.Azure.Workers,
+		},
+		// gce
+		cli.IntFlag{
+			Name:        "provider-gce-workers",
+			Usage:       "The `number` of loadbalancers synced concurrently by gce provider",
+			EnvVar:      "PROVIDER_GCE_WORKERS",
+			Value:       1,
+			Destination: &c.Providers.GCE.Workers,
+		},
+		// external
+		cli.StringFlag{
+			Name:        "provider-external-endpoints",
+			Usage:       "Comma separated `list` of external provider plugins in the format of name=url",
+			EnvVar:      "PROVIDER_EXTERNAL_ENDPOINTS",
+			Destination: &c.Providers.External.Endpoints,
+		},
+		cli.IntFlag{
+			Name:        "provider-external-timeout",
+			Usage:       "The `seconds` a call to external provider plugin may take",
+			EnvVar:      "PROVIDER_EXTERNAL_TIMEOUT",
+			Value:       30,
+			Destination: &c.Providers.External.Timeout,
+		},
+		cli.IntFlag{
+			Name:        "provider-external-workers",
+			Usage:       "The `number` of loadbalancers synced concurrently by external provider",
+			EnvVar:      "PROVIDER_EXTERNAL_WORKERS",
+			Value:       1,
+			Destination: &c.Providers.External.Workers,
+		},
 	}
 	app.Flags = append(app.Flags, flags...)
 }
@@ -0,0 +1,262 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// FileAPIVersion is the version of config file format
+	FileAPIVersion = "loadbalancer.caicloud.io/v1alpha1"
+	// FileKind is the kind of config file
+	FileKind = "ControllerConfiguration"
+)
+
+// File is the config file of controller, in yaml or json. Each plugin has its
+// own section, the values in file override the values of cli flags
+type File struct {
+	APIVersion    string         `json:"apiVersion"`
+	Kind          string         `json:"kind"`
+	RateLimiter   *RateLimiter   `json:"rateLimiter,omitempty"`
+	Rollout       *Rollout       `json:"rollout,omitempty"`
+	Log           *Log           `json:"log,omitempty"`
+	Monitoring    *Monitoring    `json:"monitoring,omitempty"`
+	NetworkPolicy *NetworkPolicy `json:"networkPolicy,omitempty"`
+	Namespaces    *Namespaces    `json:"namespaces,omitempty"`
+	Security      *Security      `json:"security,omitempty"`
+	Handoff       *Handoff       `json:"handoff,omitempty"`
+	Identity      *Identity      `json:"identity,omitempty"`
+	Quota         *Quota         `json:"quota,omitempty"`
+	Proxies       *Proxies       `json:"proxies,omitempty"`
+	Providers     *Providers     `json:"providers,omitempty"`
+}
+
+// LoadFile loads the config file into configuration, unknown keys are rejected
+func (c *Configuration) LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	js, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return fmt.Errorf("config file %s: %v", path, err)
+	}
+
+	// decode into the current values, so that unset keys keep the flag values
+	file := File{
+		RateLimiter:   &c.RateLimiter,
+		Rollout:       &c.Rollout,
+		Log:           &c.Log,
+		Monitoring:    &c.Monitoring,
+		NetworkPolicy: &c.NetworkPolicy,
+		Namespaces:    &c.Namespaces,
+		Security:      &c.Security,
+		Handoff:       &c.Handoff,
+		Identity:      &c.Identity,
+		Quota:         &c.Quota,
+		Proxies:       &c.Proxies,
+		Providers:     &c.Providers,
+	}
+	decoder := json.NewDecoder(bytes.NewReader(js))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return fmt.Errorf("config file %s: %v", path, err)
+	}
+
+	if file.APIVersion != FileAPIVersion {
+		return fmt.Errorf("config file %s: unsupported apiVersion %q, expected %q", path, file.APIVersion, FileAPIVersion)
+	}
+	if file.Kind != FileKind {
+		return fmt.Errorf("config file %s: unsupported kind %q, expected %q", path, file.Kind, FileKind)
+	}
+	return nil
+}
+
+// Validate validates the common part of configuration, the sections of
+// plugins are validated by plugins
+func (c *Configuration) Validate() error {
+	if err := ValidateKey("heapsterService", c.HeapsterService); err != nil {
+		return err
+	}
+	if c.PriorityClassName != "" {
+		if errs := validation.IsDNS1123Subdomain(c.PriorityClassName); len(errs) > 0 {
+			return fmt.Errorf("priorityClassName: %s", strings.Join(errs, ", "))
+		}
+	}
+	if c.ResyncPeriod < 0 {
+		return fmt.Errorf("resyncPeriod must be non-negative")
+	}
+	if c.InformerResyncPeriod < 0 {
+		return fmt.Errorf("informerResyncPeriod must be non-negative")
+	}
+	if c.GCPeriod < 0 {
+		return fmt.Errorf("gcPeriod must be non-negative")
+	}
+	if c.ConcurrentLoadBalancerSyncs <= 0 {
+		return fmt.Errorf("concurrentLoadBalancerSyncs must be positive")
+	}
+	if c.StatusBatchDelay < 0 {
+		return fmt.Errorf("statusBatchDelay must be non-negative")
+	}
+	if c.RateLimiter.BaseDelay <= 0 || c.RateLimiter.MaxDelay <= 0 {
+		return fmt.Errorf("rateLimiter.baseDelay and rateLimiter.maxDelay must be positive")
+	}
+	if c.RateLimiter.QPS <= 0 || c.RateLimiter.Burst <= 0 {
+		return fmt.Errorf("rateLimiter.qps and rateLimiter.burst must be positive")
+	}
+	if c.RateLimiter.FailureThreshold <= 0 || c.RateLimiter.SlowRetryInterval <= 0 {
+		return fmt.Errorf("rateLimiter.failureThreshold and rateLimiter.slowRetryInterval must be positive")
+	}
+	if _, err := c.Log.Options(); err != nil {
+		return err
+	}
+	if err := c.Monitoring.Validate(); err != nil {
+		return err
+	}
+	if err := c.NetworkPolicy.Validate(); err != nil {
+		return err
+	}
+	if err := c.Namespaces.Validate(); err != nil {
+		return err
+	}
+	if c.StatusView && len(c.StatusViewSourceNamespaces()) == 0 {
+		return fmt.Errorf("statusViewSources must not be empty if statusView is enabled")
+	}
+	for _, namespace := range c.StatusViewSourceNamespaces() {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return fmt.Errorf("statusViewSources: %s: %s", namespace, strings.Join(errs, ", "))
+		}
+	}
+	if c.Handoff.ControllerID != "" {
+		if errs := validation.IsDNS1123Label(c.Handoff.ControllerID); len(errs) > 0 {
+			return fmt.Errorf("handoff.controllerID: %s", strings.Join(errs, ", "))
+		}
+	}
+	if c.Handoff.LeaseNamespace == "" {
+		return fmt.Errorf("handoff.leaseNamespace must not be empty")
+	}
+	if c.Handoff.LeaseDuration <= 0 {
+		return fmt.Errorf("handoff.leaseDuration must be positive")
+	}
+	if c.Identity.UserAgent == "" {
+		return fmt.Errorf("identity.userAgent must not be empty")
+	}
+	if c.Quota.Namespace < 0 || c.Quota.Cluster < 0 {
+		return fmt.Errorf("quota.namespace and quota.cluster must be non-negative")
+	}
+	if c.Quota.ConfigMap != "" {
+		if err := ValidateKey("quota.configMap", c.Quota.ConfigMap); err != nil {
+			return err
+		}
+		// the ConfigMap is read from cache
+		if namespace := strings.Split(c.Quota.ConfigMap, "/")[0]; !c.Namespaces.Watched(namespace) {
+			return fmt.Errorf("quota.configMap: namespace %s is not watched", namespace)
+		}
+	}
+	if c.Rollout.CanaryPercentage < 0 || c.Rollout.CanaryPercentage > 100 {
+		return fmt.Errorf("rollout.canaryPercentage must be between 0 and 100")
+	}
+	if c.Rollout.CanaryProgressDeadline <= 0 {
+		return fmt.Errorf("rollout.canaryProgressDeadline must be positive")
+	}
+	switch c.Providers.AntiAffinity {
+	case AntiAffinityNone, AntiAffinityPreferred, AntiAffinityRequired:
+	default:
+		return fmt.Errorf("providers.antiAffinity: unknown policy %q, expected one of none, preferred and required", c.Providers.AntiAffinity)
+	}
+	return nil
+}
+
+// ValidateKey validates the value of field is in the format of namespace/name
+func ValidateKey(field, value string) error {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("%s: %q is not in the format of namespace/name", field, value)
+	}
+	return nil
+}
+
+// Validate validates the labels and templates of monitoring objects, the
+// templates are parsed so that syntax errors are found at startup
+func (m Monitoring) Validate() error {
+	if _, err := labels.ConvertSelectorToLabelsMap(m.RuleLabels); err != nil {
+		return fmt.Errorf("monitoring.ruleLabels: %v", err)
+	}
+	if _, err := labels.ConvertSelectorToLabelsMap(m.DashboardLabels); err != nil {
+		return fmt.Errorf("monitoring.dashboardLabels: %v", err)
+	}
+	if _, err := labels.ConvertSelectorToLabelsMap(m.PodMonitorLabels); err != nil {
+		return fmt.Errorf("monitoring.podMonitorLabels: %v", err)
+	}
+	if _, err := labels.ConvertSelectorToLabelsMap(m.ControllerSelector); err != nil {
+		return fmt.Errorf("monitoring.controllerSelector: %v", err)
+	}
+	if m.PodMonitors && m.ControllerSelector != "" && m.ControllerNamespace == "" {
+		return fmt.Errorf("monitoring.controllerNamespace must be set to monitor controller")
+	}
+	if m.RulesTemplate != "" {
+		if _, err := template.ParseFiles(m.RulesTemplate); err != nil {
+			return fmt.Errorf("monitoring.rulesTemplate: %v", err)
+		}
+	}
+	if m.DashboardTemplate != "" {
+		if _, err := template.ParseFiles(m.DashboardTemplate); err != nil {
+			return fmt.Errorf("monitoring.dashboardTemplate: %v", err)
+		}
+	}
+	return nil
+}
+
+// Validate validates the egress CIDRs of NetworkPolicies, they must not be
+// empty if enabled, otherwise the pods can not reach api server
+func (n NetworkPolicy) Validate() error {
+	cidrs := n.CIDRs()
+	if n.Enabled && len(cidrs) == 0 {
+		return fmt.Errorf("networkPolicy.egressCIDRs must not be empty if networkPolicy is enabled")
+	}
+	for _, cidr := range cidrs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("networkPolicy.egressCIDRs: %v", err)
+		}
+	}
+	return nil
+}
+
+// Validate validates that the namespaces are valid names, and only one of
+// allow list and deny list is set
+func (n Namespaces) Validate() error {
+	if len(n.Allowed()) != 0 && len(n.Denied()) != 0 {
+		return fmt.Errorf("namespaces.allow and namespaces.deny can not be used at the same time")
+	}
+	for _, namespace := range append(n.Allowed(), n.Denied()...) {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return fmt.Errorf("namespaces: %s: %s", namespace, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/autoscaling"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/errors"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	autoscalingPeriod = 30 * time.Second
+	// do not scale again within the windows after the last scaling
+	upscaleForbiddenWindow   = 3 * time.Minute
+	downscaleForbiddenWindow = 5 * time.Minute
+)
+
+// autoscale computes the desired replicas of loadbalancers with autoscaling
+func (lbc *LoadBalancerController) autoscale() {
+	lbs, err := lbc.lbLister.List(labels.Everything())
+	if err != nil {
+		log.Error("List loadbalancers error", log.Fields{"err": err})
+		return
+	}
+	for _, lb := range lbs {
+		if lb.Spec.Autoscaling == nil || lb.DeletionTimestamp != nil || !lbutil.IsOwned(lb) {
+			continue
+		}
+		if err := lbc.autoscaleLoadBalancer(lb); err != nil {
+			log.Warn("Autoscale loadbalancer error", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "err": err})
+		}
+	}
+}
+
+func (lbc *LoadBalancerController) autoscaleLoadBalancer(lb *netv1alpha1.LoadBalancer) error {
+	spec := lb.Spec.Autoscaling
+	if spec.MinReplicas == nil {
+		// defaults have not been written back
+		return nil
+	}
+
+	// proxy pods handle the traffic
+	selector := labels.Set{
+		netv1alpha1.LabelKeyCreatedBy: fmt.Sprintf(netv1alpha1.LabelValueFormatCreateby, lb.Namespace, lb.Name),
+		netv1alpha1.LabelKeyProxy:     string(lb.Spec.Proxy.Type),
+	}.AsSelector()
+	pods, err := lbc.podLister.Pods(lb.Namespace).List(selector)
+	if err != nil {
+		return err
+	}
+	ready := make([]*apiv1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		if lbutil.ComputePodStatus(pod).Ready {
+			ready = append(ready, pod)
+		}
+	}
+
+	var average int32
+	switch spec.Metric.Type {
+	case netv1alpha1.AutoscalingMetricCPU:
+		average, err = lbc.metricsClient.GetCPUUtilization(lb.Namespace, selector, ready)
+	case netv1alpha1.AutoscalingMetricConnections:
+		average, err = lbc.metricsClient.GetConnections(lb.Namespace, ready)
+	default:
+		err = fmt.Errorf("unknown metric type %v", spec.Metric.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	current, _ := lbutil.CalculateReplicas(lb)
+	desired := autoscaling.DesiredReplicas(current, average, spec.Metric.TargetAverage, *spec.MinReplicas, spec.MaxReplicas)
+
+	now := metav1.Now()
+	old := lb.Status.Autoscaling
+	if old != nil && old.LastScaleTime != nil && desired != old.DesiredReplicas {
+		window := downscaleForbiddenWindow
+		if desired > old.DesiredReplicas {
+			window = upscaleForbiddenWindow
+		}
+		if now.Sub(old.LastScaleTime.Time) < window {
+			desired = old.DesiredReplicas
+		}
+	}
+
+	status := &netv1alpha1.AutoscalingStatus{
+		DesiredReplicas: desired,
+		CurrentAverage:  &average,
+	}
+	scaled := old == nil || old.DesiredReplicas != desired
+	if scaled {
+		status.LastScaleTime = &now
+	} else {
+		status.LastScaleTime = old.LastScaleTime
+		if old.CurrentAverage != nil && *old.CurrentAverage == average {
+			return nil
+		}
+	}
+
+	if lbutil.IsDryRun(lb) {
+		if desired != current {
+			log.Info("Dry run, would autoscale loadbalancer", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "from": current, "to": desired, "average": average})
+		}
+		return nil
+	}
+
+	updated, err := lbutil.UpdateLBWithRetries(
+		lbc.tprClient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
+		lb.Namespace,
+		lb.Name,
+		func(lb *netv1alpha1.LoadBalancer) error {
+			if lb.Spec.Autoscaling == nil {
+				return errors.ErrPreconditionViolated
+			}
+			lb.Status.Autoscaling = status
+			return nil
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if desired != current {
+		log.Info("Autoscale loadbalancer", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "from": current, "to": desired, "average": average})
+		lbc.recorder.Eventf(lb, apiv1.EventTypeNormal, lbutil.EventReasonScaled, "Autoscale replicas from %d to %d, %s average %d, target %d",
+			current, desired, spec.Metric.Type, average, spec.Metric.TargetAverage)
+		// status changes do not trigger sync, nodes and plugins need to be synced
+		lbc.helper.Enqueue(updated)
+	}
+	return nil
+}
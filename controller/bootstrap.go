@@ -0,0 +1,138 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+const (
+	resourceServedTimeout = 60 * time.Second
+)
+
+// updateThirdPartyResource adds the missing versions and corrects the
+// description of the existing ThirdPartyResource
+func (lbc *LoadBalancerController) updateThirdPartyResource(tpr *v1beta1.ThirdPartyResource) error {
+	tprs := lbc.kubeClient.ExtensionsV1beta1().ThirdPartyResources()
+	old, err := tprs.Get(tpr.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, version := range tpr.Versions {
+		found := false
+		for _, v := range old.Versions {
+			if v.Name == version.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			old.Versions = append(old.Versions, version)
+			changed = true
+		}
+	}
+	if old.Description != tpr.Description {
+		old.Description = tpr.Description
+		changed = true
+	}
+
+	if !changed {
+		log.Info("ThirdPartyResource is up to date", log.Fields{"tpr": tpr.Name})
+		return nil
+	}
+
+	if _, err := tprs.Update(old); err != nil {
+		return err
+	}
+	log.Notice("Update ThirdPartyResource successfully", log.Fields{"tpr": tpr.Name, "versions": old.Versions})
+	return nil
+}
+
+// waitForResourceServed waits until apiserver serves the loadbalancer resource
+// with the expected version and kind
+func (lbc *LoadBalancerController) waitForResourceServed(stopCh <-chan struct{}) error {
+	groupVersion := netv1alpha1.SchemeGroupVersion.String()
+	log.Info("Wait for LoadBalancer resource served", log.Fields{"groupVersion": groupVersion})
+
+	var lastErr error
+	err := wait.PollImmediate(time.Second, resourceServedTimeout, func() (bool, error) {
+		select {
+		case <-stopCh:
+			return false, fmt.Errorf("stopped")
+		default:
+		}
+
+		resources, err := lbc.kubeClient.Discovery().ServerResourcesForGroupVersion(groupVersion)
+		if err != nil {
+			lastErr = err
+			return false, nil
+		}
+		for _, resource := range resources.APIResources {
+			if resource.Name != netv1alpha1.LoadBalancerPlural {
+				continue
+			}
+			if resource.Kind != netv1alpha1.LoadBalancerKind {
+				// schema mismatch, waiting makes no sense
+				return false, fmt.Errorf("resource %s is served as kind %s, expected %s", resource.Name, resource.Kind, netv1alpha1.LoadBalancerKind)
+			}
+			return true, nil
+		}
+		lastErr = fmt.Errorf("resource %s not found in %s", netv1alpha1.LoadBalancerPlural, groupVersion)
+		return false, nil
+	})
+
+	if err == wait.ErrWaitTimeout && lastErr != nil {
+		return fmt.Errorf("timeout waiting for resource served: %v", lastErr)
+	}
+	return err
+}
+
+// printMigrationStatus logs how many existing loadbalancers have been
+// reconciled by controller
+func (lbc *LoadBalancerController) printMigrationStatus() {
+	lbs, err := lbc.tprClient.NetworkingV1alpha1().LoadBalancers(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		log.Warn("Unable to list loadbalancers for migration status", log.Fields{"err": err})
+		return
+	}
+
+	reconciled := 0
+	pending := make([]string, 0)
+	for _, lb := range lbs.Items {
+		if lb.Status.ProxyStatus.Deployment != "" || lb.Status.ProxyStatus.DaemonSet != "" {
+			reconciled++
+			continue
+		}
+		pending = append(pending, lb.Namespace+"/"+lb.Name)
+	}
+
+	log.Notice("LoadBalancer migration status", log.Fields{
+		"total":      len(lbs.Items),
+		"reconciled": reconciled,
+		"pending":    pending,
+	})
+}
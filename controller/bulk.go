@@ -0,0 +1,183 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/labels"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Actions of bulk operations
+const (
+	// bulkActionPause stops reconciling the loadbalancers
+	bulkActionPause = "pause"
+	// bulkActionResume resumes reconciling the loadbalancers
+	bulkActionResume = "resume"
+	// bulkActionResync re-reconciles the loadbalancers by controller and plugins
+	bulkActionResync = "resync"
+	// bulkActionPin overrides the proxy and provider images of the loadbalancers
+	bulkActionPin = "pin"
+	// bulkActionUnpin removes the image overrides of the loadbalancers
+	bulkActionUnpin = "unpin"
+)
+
+const (
+	defaultBulkConcurrency = 5
+	maxBulkConcurrency     = 20
+)
+
+// bulkResult is the result of a bulk operation on a loadbalancer
+type bulkResult struct {
+	LoadBalancer string `json:"loadbalancer"`
+	Error        string `json:"error,omitempty"`
+}
+
+// bulkOperation is an action applied to the loadbalancers selected by labels
+type bulkOperation struct {
+	action        string
+	proxyImage    string
+	providerImage string
+}
+
+// ServeBulk applies the action (pause, resume, resync, pin or unpin) to all the
+// loadbalancers matching the label selector on POST /admin/bulk of the admin
+// server, all of them if the selector is empty. The loadbalancers are operated
+// with the bounded concurrency, and pin takes the images from proxyImage and
+// providerImage
+func (lbc *LoadBalancerController) ServeBulk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "expect POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	op := bulkOperation{
+		action:        r.FormValue("action"),
+		proxyImage:    r.FormValue("proxyImage"),
+		providerImage: r.FormValue("providerImage"),
+	}
+	switch op.action {
+	case bulkActionPause, bulkActionResume, bulkActionResync, bulkActionUnpin:
+	case bulkActionPin:
+		if op.proxyImage == "" && op.providerImage == "" {
+			http.Error(w, "pin expects proxyImage or providerImage", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, fmt.Sprintf("unknown action %q", op.action), http.StatusBadRequest)
+		return
+	}
+
+	selector, err := labels.Parse(r.FormValue("selector"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	concurrency := defaultBulkConcurrency
+	if v := r.FormValue("concurrency"); v != "" {
+		concurrency, err = strconv.Atoi(v)
+		if err != nil || concurrency <= 0 || concurrency > maxBulkConcurrency {
+			http.Error(w, fmt.Sprintf("concurrency must be between 1 and %d", maxBulkConcurrency), http.StatusBadRequest)
+			return
+		}
+	}
+
+	lbs, err := lbc.lbLister.List(selector)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(lbs, func(i, j int) bool {
+		return lbs[i].Namespace+"/"+lbs[i].Name < lbs[j].Namespace+"/"+lbs[j].Name
+	})
+
+	log.Notice("Start bulk operation", log.Fields{"action": op.action, "selector": selector.String(), "loadbalancers": len(lbs)})
+
+	results := make([]bulkResult, len(lbs))
+	workqueue.Parallelize(concurrency, len(lbs), func(i int) {
+		key, _ := controllerutil.KeyFunc(lbs[i])
+		results[i].LoadBalancer = key
+		if err := lbc.applyBulkOperation(lbs[i], op); err != nil {
+			log.Error("Bulk operation error", log.Fields{"action": op.action, "lb": key, "err": err})
+			results[i].Error = err.Error()
+		}
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(results)
+}
+
+// applyBulkOperation applies the action of op to lb
+func (lbc *LoadBalancerController) applyBulkOperation(lb *netv1alpha1.LoadBalancer, op bulkOperation) error {
+	if op.action == bulkActionResync {
+		return lbc.ForceResync(lb.Namespace, lb.Name)
+	}
+
+	var reason, message string
+	update := func(lb *netv1alpha1.LoadBalancer) error {
+		switch op.action {
+		case bulkActionPause:
+			if lb.Annotations == nil {
+				lb.Annotations = make(map[string]string)
+			}
+			lb.Annotations[netv1alpha1.AnnotationKeyPaused] = "true"
+			reason, message = lbutil.EventReasonPaused, "Reconciliation is paused by bulk operation"
+		case bulkActionResume:
+			delete(lb.Annotations, netv1alpha1.AnnotationKeyPaused)
+			reason, message = lbutil.EventReasonResumed, "Reconciliation is resumed by bulk operation"
+		case bulkActionPin:
+			if op.proxyImage != "" {
+				lb.Spec.Proxy.Image = op.proxyImage
+			}
+			if op.providerImage != "" {
+				if lb.Spec.Providers.Ipvsdr == nil {
+					return fmt.Errorf("provider image can only be pinned for ipvsdr provider")
+				}
+				lb.Spec.Providers.Ipvsdr.Image = op.providerImage
+			}
+			reason, message = lbutil.EventReasonImagePinned, fmt.Sprintf("Images are pinned by bulk operation, proxy %q provider %q", op.proxyImage, op.providerImage)
+		case bulkActionUnpin:
+			lb.Spec.Proxy.Image = ""
+			if lb.Spec.Providers.Ipvsdr != nil {
+				lb.Spec.Providers.Ipvsdr.Image = ""
+			}
+			reason, message = lbutil.EventReasonImagePinned, "Images are unpinned by bulk operation"
+		}
+		return nil
+	}
+
+	updated, err := lbutil.UpdateLBWithRetries(lbc.tprClient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb.Namespace, lb.Name, update)
+	if err != nil {
+		return err
+	}
+	lbc.recorder.Event(updated, apiv1.EventTypeNormal, reason, message)
+	return nil
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+	"github.com/caicloud/loadbalancer-controller/provider"
+	"github.com/caicloud/loadbalancer-controller/proxy"
+)
+
+// plan syncs the plugins of lb in dry run mode, they log and record the
+// changes they would make. The controller itself writes nothing, so the
+// ownership, defaults, quota, nodes and finalizer of lb are left as is
+func (lbc *LoadBalancerController) plan(lb *netv1alpha1.LoadBalancer) error {
+	if !lbutil.IsOwned(lb) {
+		// the ownership is not claimed in dry run mode
+		log.Debug("LoadBalancer in dry run mode is not owned, skip", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name})
+		return nil
+	}
+
+	nlb, err := lbc.clone(lb)
+	if err != nil {
+		return err
+	}
+	log.Debug("Sync loadbalancer in dry run mode", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name})
+	proxy.OnSync(nlb)
+	provider.OnSync(nlb)
+	return nil
+}
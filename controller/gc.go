@@ -0,0 +1,264 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	"github.com/caicloud/loadbalancer-controller/pkg/metrics"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+// uniqueLabelKeyPrefix is the prefix of the unique label keys of loadbalancers on nodes
+var uniqueLabelKeyPrefix = netv1alpha1.LoadBalancerName + "." + netv1alpha1.AlphaGroupName + "/"
+
+// collectGarbage deletes the deployments, daemonsets, configmaps and
+// clusterrolebindings labeled with LabelKeyCreatedBy, and removes the labels
+// and taints from nodes, whose loadbalancer no longer exists. They are orphaned if the controller crashes
+// in the middle of cleanup. Nothing is deleted in dry run mode
+func (lbc *LoadBalancerController) collectGarbage() {
+	log.Debug("Start collecting garbage of loadbalancers")
+
+	req, err := labels.NewRequirement(netv1alpha1.LabelKeyCreatedBy, selection.Exists, nil)
+	if err != nil {
+		log.Error("Create garbage selector error", log.Fields{"err": err})
+		return
+	}
+	selector := labels.NewSelector().Add(*req)
+
+	if err := lbc.collectDeployments(selector); err != nil {
+		log.Error("Collect orphaned deployments error", log.Fields{"err": err})
+	}
+	if err := lbc.collectDaemonSets(selector); err != nil {
+		log.Error("Collect orphaned daemonsets error", log.Fields{"err": err})
+	}
+	if err := lbc.collectConfigMaps(selector); err != nil {
+		log.Error("Collect orphaned configmaps error", log.Fields{"err": err})
+	}
+	if err := lbc.collectClusterRoleBindings(selector); err != nil {
+		log.Error("Collect orphaned clusterrolebindings error", log.Fields{"err": err})
+	}
+	if err := lbc.collectNodes(); err != nil {
+		log.Error("Collect orphaned node labels error", log.Fields{"err": err})
+	}
+}
+
+// orphaned returns true if the loadbalancer identified by value in format
+// LabelValueFormatCreateby does not exist. Namespace can not contain dot,
+// so the value is split at the first one. The loadbalancers in namespaces
+// not watched are unknown, so they are never orphaned
+func (lbc *LoadBalancerController) orphaned(value string) bool {
+	parts := strings.SplitN(value, ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		// not created by us
+		return false
+	}
+	if !lbc.scope.Watched(parts[0]) {
+		return false
+	}
+	_, err := lbc.lbLister.LoadBalancers(parts[0]).Get(parts[1])
+	return errors.IsNotFound(err)
+}
+
+func (lbc *LoadBalancerController) collectDeployments(selector labels.Selector) error {
+	ds, err := lbc.dLister.List(selector)
+	if err != nil {
+		return err
+	}
+	policy := metav1.DeletePropagationForeground
+	for _, d := range ds {
+		createdBy := d.Labels[netv1alpha1.LabelKeyCreatedBy]
+		if d.DeletionTimestamp != nil || !lbc.orphaned(createdBy) {
+			continue
+		}
+		fields := log.Fields{"d.ns": d.Namespace, "d.name": d.Name, "createdBy": createdBy}
+		if lbutil.DryRun() {
+			log.Notice("Dry run, would delete orphaned deployment", fields)
+			continue
+		}
+		log.Notice("Delete orphaned deployment", fields)
+		err := lbc.kubeClient.ExtensionsV1beta1().Deployments(d.Namespace).Delete(d.Name, &metav1.DeleteOptions{
+			PropagationPolicy: &policy,
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		metrics.GarbageCollected.Add("deployment", 1)
+	}
+	return nil
+}
+
+func (lbc *LoadBalancerController) collectDaemonSets(selector labels.Selector) error {
+	dss, err := lbc.dsLister.List(selector)
+	if err != nil {
+		return err
+	}
+	policy := metav1.DeletePropagationForeground
+	for _, ds := range dss {
+		createdBy := ds.Labels[netv1alpha1.LabelKeyCreatedBy]
+		if ds.DeletionTimestamp != nil || !lbc.orphaned(createdBy) {
+			continue
+		}
+		fields := log.Fields{"ds.ns": ds.Namespace, "ds.name": ds.Name, "createdBy": createdBy}
+		if lbutil.DryRun() {
+			log.Notice("Dry run, would delete orphaned daemonset", fields)
+			continue
+		}
+		log.Notice("Delete orphaned daemonset", fields)
+		err := lbc.kubeClient.ExtensionsV1beta1().DaemonSets(ds.Namespace).Delete(ds.Name, &metav1.DeleteOptions{
+			PropagationPolicy: &policy,
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		metrics.GarbageCollected.Add("daemonset", 1)
+	}
+	return nil
+}
+
+func (lbc *LoadBalancerController) collectConfigMaps(selector labels.Selector) error {
+	cms, err := lbc.cmLister.List(selector)
+	if err != nil {
+		return err
+	}
+	for _, cm := range cms {
+		createdBy := cm.Labels[netv1alpha1.LabelKeyCreatedBy]
+		if cm.DeletionTimestamp != nil || !lbc.orphaned(createdBy) {
+			continue
+		}
+		fields := log.Fields{"cm.ns": cm.Namespace, "cm.name": cm.Name, "createdBy": createdBy}
+		if lbutil.DryRun() {
+			log.Notice("Dry run, would delete orphaned configmap", fields)
+			continue
+		}
+		log.Notice("Delete orphaned configmap", fields)
+		err := lbc.kubeClient.CoreV1().ConfigMaps(cm.Namespace).Delete(cm.Name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		metrics.GarbageCollected.Add("configmap", 1)
+	}
+	return nil
+}
+
+// collectClusterRoleBindings deletes the ClusterRoleBindings of proxies,
+// which are cluster scoped and not owned by loadbalancers. They are listed
+// from apiserver since they are not cached by informers
+func (lbc *LoadBalancerController) collectClusterRoleBindings(selector labels.Selector) error {
+	crbs, err := lbc.kubeClient.RbacV1beta1().ClusterRoleBindings().List(metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, crb := range crbs.Items {
+		createdBy := crb.Labels[netv1alpha1.LabelKeyCreatedBy]
+		if crb.DeletionTimestamp != nil || !lbc.orphaned(createdBy) {
+			continue
+		}
+		fields := log.Fields{"crb.name": crb.Name, "createdBy": createdBy}
+		if lbutil.DryRun() {
+			log.Notice("Dry run, would delete orphaned clusterrolebinding", fields)
+			continue
+		}
+		log.Notice("Delete orphaned clusterrolebinding", fields)
+		err := lbc.kubeClient.RbacV1beta1().ClusterRoleBindings().Delete(crb.Name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		metrics.GarbageCollected.Add("clusterrolebinding", 1)
+	}
+	return nil
+}
+
+// collectNodes removes the unique labels and dedicated taints of the
+// loadbalancers which no longer exist from nodes
+func (lbc *LoadBalancerController) collectNodes() error {
+	nodes, err := lbc.nodeLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		copy, err := scheme.Scheme.DeepCopy(node)
+		if err != nil {
+			return err
+		}
+		copyNode := copy.(*apiv1.Node)
+
+		for key, value := range copyNode.Labels {
+			if value != "true" || !strings.HasPrefix(key, uniqueLabelKeyPrefix) {
+				continue
+			}
+			if lbc.orphaned(strings.TrimPrefix(key, uniqueLabelKeyPrefix)) {
+				delete(copyNode.Labels, key)
+			}
+		}
+
+		taints := make([]apiv1.Taint, 0, len(copyNode.Spec.Taints))
+		for _, taint := range copyNode.Spec.Taints {
+			if taint.Key == netv1alpha1.TaintKey && lbc.orphaned(taint.Value) {
+				continue
+			}
+			taints = append(taints, taint)
+		}
+		if len(taints) != len(copyNode.Spec.Taints) {
+			copyNode.Spec.Taints = taints
+		}
+
+		if reflect.DeepEqual(node.Labels, copyNode.Labels) && reflect.DeepEqual(node.Spec.Taints, copyNode.Spec.Taints) {
+			continue
+		}
+
+		orginal, _ := json.Marshal(node)
+		modified, _ := json.Marshal(copyNode)
+		patch, err := strategicpatch.CreateTwoWayMergePatch(orginal, modified, node)
+		if err != nil {
+			return err
+		}
+		if lbutil.DryRun() {
+			log.Notice("Dry run, would remove orphaned labels and taints from node", log.Fields{
+				"node":  node.Name,
+				"patch": string(patch),
+			})
+			continue
+		}
+		if _, err := lbc.kubeClient.CoreV1().Nodes().Patch(node.Name, types.StrategicMergePatchType, patch); err != nil {
+			return fmt.Errorf("patch node %v error: %v", node.Name, err)
+		}
+		log.Notice("Remove orphaned labels and taints from node", log.Fields{
+			"node":  node.Name,
+			"patch": string(patch),
+		})
+		metrics.GarbageCollected.Add("node", 1)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// leaseNameFormat is the name of lease ConfigMap of controller identity
+	leaseNameFormat = "loadbalancer-controller-lease-%s"
+	leaseKeyHolder  = "holder"
+	leaseKeyRenew   = "renewTime"
+)
+
+// The ownership of a loadbalancer is handed off between controllers by a
+// handshake on its annotations:
+//
+// 1. The controller taking over writes its identity in AnnotationKeyHandoff
+// 2. The owner releases the loadbalancer after the current sync by moving the
+//    identity to AnnotationKeyController and removing AnnotationKeyHandoff
+// 3. The new owner reconciles the loadbalancer from then on
+//
+// Each controller with identity renews a lease, the loadbalancers of a
+// controller whose lease expired are taken over without handshake.
+
+// reconcileOwnership claims the unowned loadbalancer and releases the one
+// requested by another controller, false is returned if this controller
+// does not reconcile lb. The update of annotations triggers another sync
+func (lbc *LoadBalancerController) reconcileOwnership(lb *netv1alpha1.LoadBalancer) (bool, error) {
+	id := lbutil.ControllerID()
+	owner := lb.Annotations[netv1alpha1.AnnotationKeyController]
+	handoff := lb.Annotations[netv1alpha1.AnnotationKeyHandoff]
+
+	switch {
+	case owner == "" && id != "":
+		log.Notice("Claim loadbalancer", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "controller": id})
+		err := lbc.setOwner(lb, id)
+		if err == nil {
+			lbc.recorder.Eventf(lb, apiv1.EventTypeNormal, lbutil.EventReasonClaimed, "Claimed by controller %s", id)
+		}
+		return false, err
+	case owner == id && handoff != "" && handoff != id:
+		log.Notice("Hand off loadbalancer", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "from": id, "to": handoff})
+		err := lbc.setOwner(lb, handoff)
+		if err == nil {
+			lbc.recorder.Eventf(lb, apiv1.EventTypeNormal, lbutil.EventReasonHandedOff, "Handed off from controller %q to %s", id, handoff)
+		}
+		return false, err
+	}
+	return owner == id, nil
+}
+
+// setOwner moves the ownership of lb to controller id
+func (lbc *LoadBalancerController) setOwner(lb *netv1alpha1.LoadBalancer, id string) error {
+	_, err := lbutil.UpdateLBWithRetries(lbc.tprClient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb.Namespace, lb.Name,
+		func(lb *netv1alpha1.LoadBalancer) error {
+			if lb.Annotations == nil {
+				lb.Annotations = make(map[string]string)
+			}
+			lb.Annotations[netv1alpha1.AnnotationKeyController] = id
+			delete(lb.Annotations, netv1alpha1.AnnotationKeyHandoff)
+			return nil
+		})
+	return err
+}
+
+// renewLease renews the lease of this controller
+func (lbc *LoadBalancerController) renewLease() {
+	id := lbutil.ControllerID()
+	name := fmt.Sprintf(leaseNameFormat, id)
+	data := map[string]string{
+		leaseKeyHolder: id,
+		leaseKeyRenew:  time.Now().UTC().Format(time.RFC3339),
+	}
+
+	if lbutil.DryRun() {
+		log.Debug("Dry run, would renew controller lease", log.Fields{"controller": id, "lease": name})
+		return
+	}
+
+	cms := lbc.kubeClient.CoreV1().ConfigMaps(lbc.leaseNamespace)
+	cm, err := cms.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = cms.Create(&apiv1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: lbc.leaseNamespace,
+			},
+			Data: data,
+		})
+	} else if err == nil {
+		cm.Data = data
+		_, err = cms.Update(cm)
+	}
+	if err != nil {
+		log.Error("Renew controller lease error", log.Fields{"controller": id, "err": err})
+	}
+}
+
+// leaseExpired returns true if the controller id has not renewed its lease in
+// lease duration, or it never held a lease
+func (lbc *LoadBalancerController) leaseExpired(id string) (bool, error) {
+	name := fmt.Sprintf(leaseNameFormat, id)
+	cm, err := lbc.kubeClient.CoreV1().ConfigMaps(lbc.leaseNamespace).Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	renewed, err := time.Parse(time.RFC3339, cm.Data[leaseKeyRenew])
+	if err != nil {
+		return true, nil
+	}
+	return time.Since(renewed) > lbc.leaseDuration, nil
+}
+
+// takeoverResult is the response of takeover
+type takeoverResult struct {
+	Owner   string `json:"owner"`
+	Handoff string `json:"handoff,omitempty"`
+	// State is one of owned, claimed, requested and forced
+	State string `json:"state"`
+}
+
+// Takeover transfers the ownership of loadbalancer to this controller. The
+// owner is requested to hand it off if it is alive, otherwise it is taken
+// over immediately
+func (lbc *LoadBalancerController) Takeover(namespace, name string) (*takeoverResult, error) {
+	id := lbutil.ControllerID()
+	lb, err := lbc.lbLister.LoadBalancers(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	owner := lb.Annotations[netv1alpha1.AnnotationKeyController]
+	if owner == id {
+		return &takeoverResult{Owner: owner, State: "owned"}, nil
+	}
+
+	state := "claimed"
+	if owner != "" {
+		expired, err := lbc.leaseExpired(owner)
+		if err != nil {
+			return nil, err
+		}
+		state = "forced"
+		if !expired {
+			state = "requested"
+		}
+	}
+
+	if state == "requested" {
+		log.Notice("Request handoff of loadbalancer", log.Fields{"lb.ns": namespace, "lb.name": name, "from": owner, "to": id})
+		_, err = lbutil.UpdateLBWithRetries(lbc.tprClient.NetworkingV1alpha1().LoadBalancers(namespace), namespace, name,
+			func(lb *netv1alpha1.LoadBalancer) error {
+				if lb.Annotations == nil {
+					lb.Annotations = make(map[string]string)
+				}
+				lb.Annotations[netv1alpha1.AnnotationKeyHandoff] = id
+				return nil
+			})
+		if err != nil {
+			return nil, err
+		}
+		return &takeoverResult{Owner: owner, Handoff: id, State: state}, nil
+	}
+
+	log.Notice("Take over loadbalancer", log.Fields{"lb.ns": namespace, "lb.name": name, "from": owner, "to": id, "state": state})
+	if err := lbc.setOwner(lb, id); err != nil {
+		return nil, err
+	}
+	lbc.recorder.Eventf(lb, apiv1.EventTypeNormal, lbutil.EventReasonClaimed, "Taken over by controller %s from %q", id, owner)
+	return &takeoverResult{Owner: id, State: state}, nil
+}
+
+// ServeTakeover takes over the loadbalancer on POST /admin/takeover/{namespace}/{name}
+// of the admin server, it responds 202 if the handoff is requested and waits
+// for the owner
+func (lbc *LoadBalancerController) ServeTakeover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "expect POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if lbutil.ControllerID() == "" {
+		http.Error(w, "controller has no identity, set --controller-id", http.StatusBadRequest)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/takeover"), "/"), "/")
+	if len(parts) != 2 {
+		http.Error(w, "expect /admin/takeover/{namespace}/{name}", http.StatusBadRequest)
+		return
+	}
+
+	result, err := lbc.Takeover(parts[0], parts[1])
+	if errors.IsNotFound(err) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if result.State == "requested" {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(result)
+}
+
+// ownershipChanged returns true if the owner or the handoff request of
+// loadbalancer changed
+func ownershipChanged(old, cur *netv1alpha1.LoadBalancer) bool {
+	return old.Annotations[netv1alpha1.AnnotationKeyController] != cur.Annotations[netv1alpha1.AnnotationKeyController] ||
+		old.Annotations[netv1alpha1.AnnotationKeyHandoff] != cur.Annotations[netv1alpha1.AnnotationKeyHandoff]
+}
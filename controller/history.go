@@ -0,0 +1,275 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	revisionComponent    = "history"
+	revisionNameFormat   = "%s-revision-%08x"
+	revisionDataKey      = "spec"
+	revisionHistoryLimit = 10
+)
+
+// revisionSpec is the part of spec generating the workloads of proxy and
+// providers, it is recorded in each revision and restored by rollback
+type revisionSpec struct {
+	Proxy          netv1alpha1.ProxySpec       `json:"proxy"`
+	Providers      netv1alpha1.ProvidersSpec   `json:"providers"`
+	DeployMode     netv1alpha1.DeployMode      `json:"deployMode,omitempty"`
+	Template       *netv1alpha1.TemplateSpec   `json:"template,omitempty"`
+	UpdateStrategy *netv1alpha1.UpdateStrategy `json:"updateStrategy,omitempty"`
+}
+
+func newRevisionSpec(lb *netv1alpha1.LoadBalancer) revisionSpec {
+	return revisionSpec{
+		Proxy:          lb.Spec.Proxy,
+		Providers:      lb.Spec.Providers,
+		DeployMode:     lb.Spec.DeployMode,
+		Template:       lb.Spec.Template,
+		UpdateStrategy: lb.Spec.UpdateStrategy,
+	}
+}
+
+// apply restores the recorded part of spec
+func (r revisionSpec) apply(spec *netv1alpha1.LoadBalancerSpec) {
+	spec.Proxy = r.Proxy
+	spec.Providers = r.Providers
+	spec.DeployMode = r.DeployMode
+	spec.Template = r.Template
+	spec.UpdateStrategy = r.UpdateStrategy
+}
+
+// revisionNumber returns the number of revision in its label, 0 if invalid
+func revisionNumber(cm *apiv1.ConfigMap) int64 {
+	n, _ := strconv.ParseInt(cm.Labels[netv1alpha1.LabelKeyRevision], 10, 64)
+	return n
+}
+
+// listRevisions returns the revisions of lb sorted from the oldest
+func (lbc *LoadBalancerController) listRevisions(lb *netv1alpha1.LoadBalancer) ([]*apiv1.ConfigMap, error) {
+	selector := labels.SelectorFromSet(labels.Set{
+		netv1alpha1.LabelKeyCreatedBy: fmt.Sprintf(netv1alpha1.LabelValueFormatCreateby, lb.Namespace, lb.Name),
+	})
+	cms, err := lbc.cmLister.ConfigMaps(lb.Namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	revisions := make([]*apiv1.ConfigMap, 0, len(cms))
+	for _, cm := range cms {
+		if revisionNumber(cm) > 0 && cm.DeletionTimestamp == nil {
+			revisions = append(revisions, cm)
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisionNumber(revisions[i]) < revisionNumber(revisions[j])
+	})
+	return revisions, nil
+}
+
+// recordRevision records the spec generating the workloads of lb as a new
+// revision if it differs from the latest one. An older revision with the same
+// spec is bumped instead, and the oldest ones beyond the limit are deleted
+func (lbc *LoadBalancerController) recordRevision(lb *netv1alpha1.LoadBalancer) error {
+	data, err := json.Marshal(newRevisionSpec(lb))
+	if err != nil {
+		return err
+	}
+	revisions, err := lbc.listRevisions(lb)
+	if err != nil {
+		return err
+	}
+
+	next := int64(1)
+	if len(revisions) != 0 {
+		latest := revisions[len(revisions)-1]
+		if latest.Data[revisionDataKey] == string(data) {
+			return lbc.setRevision(lb, revisionNumber(latest))
+		}
+		next = revisionNumber(latest) + 1
+	}
+
+	cms := lbc.kubeClient.CoreV1().ConfigMaps(lb.Namespace)
+	hash := fnv.New32a()
+	hash.Write(data)
+	name := fmt.Sprintf(revisionNameFormat, lb.Name, hash.Sum32())
+
+	var kept []*apiv1.ConfigMap
+	bumped := false
+	for _, cm := range revisions {
+		if cm.Name != name {
+			kept = append(kept, cm)
+			continue
+		}
+		copied := *cm
+		copied.Labels = make(map[string]string, len(cm.Labels))
+		for k, v := range cm.Labels {
+			copied.Labels[k] = v
+		}
+		copied.Labels[netv1alpha1.LabelKeyRevision] = strconv.FormatInt(next, 10)
+		log.Info("Bump revision of loadbalancer", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "from": revisionNumber(cm), "to": next})
+		if _, err := cms.Update(&copied); err != nil {
+			return err
+		}
+		bumped = true
+	}
+	if !bumped {
+		revision := &apiv1.ConfigMap{
+			ObjectMeta: revisionMeta(lb, name, next),
+			Data:       map[string]string{revisionDataKey: string(data)},
+		}
+		log.Info("Record revision of loadbalancer", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "revision": next})
+		if _, err := cms.Create(revision); err != nil {
+			return err
+		}
+	}
+
+	// the new revision is kept in addition to the older ones
+	for len(kept) >= revisionHistoryLimit {
+		err := cms.Delete(kept[0].Name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		kept = kept[1:]
+	}
+	return lbc.setRevision(lb, next)
+}
+
+func revisionMeta(lb *netv1alpha1.LoadBalancer, name string, revision int64) metav1.ObjectMeta {
+	selector := map[string]string{
+		netv1alpha1.LabelKeyCreatedBy: fmt.Sprintf(netv1alpha1.LabelValueFormatCreateby, lb.Namespace, lb.Name),
+	}
+	objLabels := lbutil.WithArtifactLabels(selector, lb, revisionComponent)
+	objLabels[netv1alpha1.LabelKeyRevision] = strconv.FormatInt(revision, 10)
+	t := true
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: lb.Namespace,
+		Labels:    objLabels,
+		OwnerReferences: []metav1.OwnerReference{
+			{
+				APIVersion:         netv1alpha1.SchemeGroupVersion.String(),
+				Kind:               netv1alpha1.LoadBalancerKind,
+				Name:               lb.Name,
+				UID:                lb.UID,
+				Controller:         &t,
+				BlockOwnerDeletion: &t,
+			},
+		},
+	}
+}
+
+// setRevision writes the number of the latest revision to status
+func (lbc *LoadBalancerController) setRevision(lb *netv1alpha1.LoadBalancer, revision int64) error {
+	return lbutil.WriteStatus(lbc.tprClient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, func(status *netv1alpha1.LoadBalancerStatus) bool {
+		if status.Revision == revision {
+			return false
+		}
+		status.Revision = revision
+		return true
+	})
+}
+
+// rollback restores the spec generating the workloads of lb from the revision
+// in the rollback-to annotation, and removes the annotation. It returns true
+// if lb is updated
+func (lbc *LoadBalancerController) rollback(lb *netv1alpha1.LoadBalancer) (bool, error) {
+	value, ok := lb.Annotations[netv1alpha1.AnnotationKeyRollbackTo]
+	if !ok {
+		return false, nil
+	}
+
+	target, err := lbc.rollbackTarget(lb, value)
+	if err != nil {
+		return false, err
+	}
+
+	var spec revisionSpec
+	if target != nil {
+		if err := json.Unmarshal([]byte(target.Data[revisionDataKey]), &spec); err != nil {
+			lbc.recorder.Eventf(lb, apiv1.EventTypeWarning, lbutil.EventReasonRollbackFailed, "Revision %d is corrupted: %v", revisionNumber(target), err)
+			target = nil
+		}
+	}
+
+	_, err = lbutil.UpdateLBWithRetries(
+		lbc.tprClient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
+		lb.Namespace,
+		lb.Name,
+		func(lb *netv1alpha1.LoadBalancer) error {
+			delete(lb.Annotations, netv1alpha1.AnnotationKeyRollbackTo)
+			if target != nil {
+				spec.apply(&lb.Spec)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		log.Error("Roll back loadbalancer error", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "err": err})
+		return false, err
+	}
+	if target != nil {
+		log.Info("Roll back loadbalancer", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "revision": revisionNumber(target)})
+		lbc.recorder.Eventf(lb, apiv1.EventTypeNormal, lbutil.EventReasonRolledBack, "Roll back to revision %d", revisionNumber(target))
+	}
+	return true, nil
+}
+
+// rollbackTarget returns the revision of lb requested by value, nil is
+// returned and a Warning event is recorded if there is no such revision
+func (lbc *LoadBalancerController) rollbackTarget(lb *netv1alpha1.LoadBalancer, value string) (*apiv1.ConfigMap, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		lbc.recorder.Eventf(lb, apiv1.EventTypeWarning, lbutil.EventReasonRollbackFailed, "Invalid revision %q to roll back to", value)
+		return nil, nil
+	}
+	revisions, err := lbc.listRevisions(lb)
+	if err != nil {
+		return nil, err
+	}
+
+	if n == 0 {
+		// the previous revision
+		if len(revisions) < 2 {
+			lbc.recorder.Event(lb, apiv1.EventTypeWarning, lbutil.EventReasonRollbackFailed, "No previous revision to roll back to")
+			return nil, nil
+		}
+		return revisions[len(revisions)-2], nil
+	}
+	for _, cm := range revisions {
+		if revisionNumber(cm) == n {
+			return cm, nil
+		}
+	}
+	lbc.recorder.Eventf(lb, apiv1.EventTypeWarning, lbutil.EventReasonRollbackFailed, "Revision %d to roll back to does not exist", n)
+	return nil, nil
+}
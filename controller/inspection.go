@@ -0,0 +1,125 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/kubernetes/pkg/controller"
+)
+
+// loadBalancerState is the controller's view of a loadbalancer
+type loadBalancerState struct {
+	Key      string `json:"key"`
+	Deleting bool   `json:"deleting,omitempty"`
+	Paused   bool   `json:"paused,omitempty"`
+	DryRun   bool   `json:"dryRun,omitempty"`
+	// Workloads are the deployments and daemonsets created for the loadbalancer
+	Workloads []workloadState `json:"workloads"`
+	// SyncErrors are the last sync errors of the loadbalancer keyed by queue
+	SyncErrors map[string]controllerutil.SyncError `json:"syncErrors,omitempty"`
+}
+
+// workloadState is a deployment or daemonset created for a loadbalancer
+type workloadState struct {
+	Kind  string `json:"kind"`
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+	Ready string `json:"ready"`
+}
+
+// ServeLoadBalancers prints all the loadbalancers with the workloads claimed
+// by them and their last sync errors on /debug/loadbalancers, assembled from
+// informer caches
+func (lbc *LoadBalancerController) ServeLoadBalancers(w http.ResponseWriter, r *http.Request) {
+	lbs, err := lbc.lbLister.List(labels.Everything())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(lbs, func(i, j int) bool {
+		return lbs[i].Namespace+"/"+lbs[i].Name < lbs[j].Namespace+"/"+lbs[j].Name
+	})
+
+	states := make([]loadBalancerState, 0, len(lbs))
+	for _, lb := range lbs {
+		state, err := lbc.loadBalancerState(lb)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		states = append(states, state)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(states)
+}
+
+func (lbc *LoadBalancerController) loadBalancerState(lb *netv1alpha1.LoadBalancer) (loadBalancerState, error) {
+	key, _ := controllerutil.KeyFunc(lb)
+	state := loadBalancerState{
+		Key:        key,
+		Deleting:   lb.DeletionTimestamp != nil,
+		Paused:     lbutil.IsPaused(lb),
+		DryRun:     lbutil.IsDryRun(lb),
+		Workloads:  make([]workloadState, 0),
+		SyncErrors: controllerutil.SyncErrors(key),
+	}
+
+	selector := labels.Set{
+		netv1alpha1.LabelKeyCreatedBy: fmt.Sprintf(netv1alpha1.LabelValueFormatCreateby, lb.Namespace, lb.Name),
+	}.AsSelector()
+
+	ds, err := lbc.dLister.Deployments(lb.Namespace).List(selector)
+	if err != nil {
+		return state, err
+	}
+	for _, d := range ds {
+		state.Workloads = append(state.Workloads, workloadState{
+			Kind:  "Deployment",
+			Name:  d.Name,
+			Owner: ownerDetail(lb.UID, controller.GetControllerOf(d)),
+			Ready: fmt.Sprintf("%d/%d", d.Status.AvailableReplicas, *d.Spec.Replicas),
+		})
+	}
+	dss, err := lbc.dsLister.DaemonSets(lb.Namespace).List(selector)
+	if err != nil {
+		return state, err
+	}
+	for _, d := range dss {
+		state.Workloads = append(state.Workloads, workloadState{
+			Kind:  "DaemonSet",
+			Name:  d.Name,
+			Owner: ownerDetail(lb.UID, controller.GetControllerOf(d)),
+			Ready: fmt.Sprintf("%d/%d", d.Status.NumberReady, d.Status.DesiredNumberScheduled),
+		})
+	}
+	sort.Slice(state.Workloads, func(i, j int) bool {
+		return state.Workloads[i].Kind+state.Workloads[i].Name < state.Workloads[j].Kind+state.Workloads[j].Name
+	})
+	return state, nil
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// patchFunc patches the object with name in namespace
+type patchFunc func(namespace, name string, data []byte) error
+
+// migrateLabels adds the versioned labels to the objects generated before the
+// labeling scheme is bumped. Only the labels in metadata are patched, selectors
+// and pod templates are left untouched so that no pod is restarted, templates
+// are relabeled on the next rollout of the workload
+func (lbc *LoadBalancerController) migrateLabels() {
+	req, err := labels.NewRequirement(netv1alpha1.LabelKeyCreatedBy, selection.Exists, nil)
+	if err != nil {
+		log.Error("Create migration selector error", log.Fields{"err": err})
+		return
+	}
+	selector := labels.NewSelector().Add(*req)
+
+	var objs []metav1.Object
+	ds, err := lbc.dLister.List(selector)
+	if err != nil {
+		log.Error("List deployments for label migration error", log.Fields{"err": err})
+	}
+	objs = objs[:0]
+	for _, d := range ds {
+		objs = append(objs, d)
+	}
+	lbc.migrateObjectLabels("deployment", objs, func(namespace, name string, data []byte) error {
+		_, err := lbc.kubeClient.ExtensionsV1beta1().Deployments(namespace).Patch(name, types.MergePatchType, data)
+		return err
+	})
+
+	dss, err := lbc.dsLister.List(selector)
+	if err != nil {
+		log.Error("List daemonsets for label migration error", log.Fields{"err": err})
+	}
+	objs = objs[:0]
+	for _, d := range dss {
+		objs = append(objs, d)
+	}
+	lbc.migrateObjectLabels("daemonset", objs, func(namespace, name string, data []byte) error {
+		_, err := lbc.kubeClient.ExtensionsV1beta1().DaemonSets(namespace).Patch(name, types.MergePatchType, data)
+		return err
+	})
+
+	cms, err := lbc.cmLister.List(selector)
+	if err != nil {
+		log.Error("List configmaps for label migration error", log.Fields{"err": err})
+	}
+	objs = objs[:0]
+	for _, cm := range cms {
+		objs = append(objs, cm)
+	}
+	lbc.migrateObjectLabels("configmap", objs, func(namespace, name string, data []byte) error {
+		_, err := lbc.kubeClient.CoreV1().ConfigMaps(namespace).Patch(name, types.MergePatchType, data)
+		return err
+	})
+
+	svcs, err := lbc.svcLister.List(selector)
+	if err != nil {
+		log.Error("List services for label migration error", log.Fields{"err": err})
+	}
+	objs = objs[:0]
+	for _, svc := range svcs {
+		objs = append(objs, svc)
+	}
+	lbc.migrateObjectLabels("service", objs, func(namespace, name string, data []byte) error {
+		_, err := lbc.kubeClient.CoreV1().Services(namespace).Patch(name, types.MergePatchType, data)
+		return err
+	})
+
+	// labels of running pods are mutable, patching them does not restart pods
+	pods, err := lbc.podLister.List(selector)
+	if err != nil {
+		log.Error("List pods for label migration error", log.Fields{"err": err})
+	}
+	objs = objs[:0]
+	for _, pod := range pods {
+		objs = append(objs, pod)
+	}
+	lbc.migrateObjectLabels("pod", objs, func(namespace, name string, data []byte) error {
+		_, err := lbc.kubeClient.CoreV1().Pods(namespace).Patch(name, types.MergePatchType, data)
+		return err
+	})
+}
+
+func (lbc *LoadBalancerController) migrateObjectLabels(kind string, objs []metav1.Object, patch patchFunc) {
+	migrated, failed := 0, 0
+	for _, obj := range objs {
+		if obj.GetDeletionTimestamp() != nil {
+			continue
+		}
+		missing := lbutil.MissingArtifactLabels(obj.GetLabels())
+		if len(missing) == 0 {
+			continue
+		}
+		data, _ := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"labels": missing,
+			},
+		})
+		if lbutil.DryRun() {
+			log.Info("Dry run, would migrate labels", log.Fields{"kind": kind, "ns": obj.GetNamespace(), "name": obj.GetName(), "labels": missing})
+			continue
+		}
+		if err := patch(obj.GetNamespace(), obj.GetName(), data); err != nil && !errors.IsNotFound(err) {
+			log.Error("Migrate labels error", log.Fields{"kind": kind, "ns": obj.GetNamespace(), "name": obj.GetName(), "err": err})
+			failed++
+			continue
+		}
+		migrated++
+	}
+	if migrated > 0 || failed > 0 {
+		log.Notice("Migrate labels to current version", log.Fields{"kind": kind, "version": netv1alpha1.LabelVersion, "migrated": migrated, "failed": failed})
+	}
+}
@@ -24,31 +24,49 @@ import (
 
 	"github.com/caicloud/loadbalancer-controller/config"
 	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/autoscaling"
+	"github.com/caicloud/loadbalancer-controller/pkg/health"
 	"github.com/caicloud/loadbalancer-controller/pkg/informers"
 	netlisters "github.com/caicloud/loadbalancer-controller/pkg/listers/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
 	"github.com/caicloud/loadbalancer-controller/pkg/tprclient"
+	"github.com/caicloud/loadbalancer-controller/pkg/util/audit"
 	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
 	"github.com/caicloud/loadbalancer-controller/pkg/util/taints"
 	"github.com/caicloud/loadbalancer-controller/pkg/util/validation"
 	"github.com/caicloud/loadbalancer-controller/provider"
 	"github.com/caicloud/loadbalancer-controller/proxy"
-	log "github.com/zoumo/logdog"
 
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	extensionslisters "k8s.io/client-go/listers/extensions/v1beta1"
 	apiv1 "k8s.io/client-go/pkg/api/v1"
 	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 )
 
+// finalizer blocks the deletion of loadbalancer until labels and taints are removed from nodes
+var finalizer = fmt.Sprintf(netv1alpha1.FinalizerFormat, "nodes")
+
+// readiness gates reported on /readyz
+var (
+	cachesSynced       = health.NewGate("caches", "waiting for informer caches to sync")
+	pluginsInitialized = health.NewGate("plugins", "proxies and providers are not initialized")
+)
+
 // LoadBalancerController is responsible for synchronizing LoadBalancer objects stored
 // in the system with actual running proxies and providers.
 type LoadBalancerController struct {
@@ -59,23 +77,136 @@ type LoadBalancerController struct {
 	lbLister   netlisters.LoadBalancerLister
 	nodeLister corelisters.NodeLister
 
-	queue  workqueue.RateLimitingInterface
-	helper *controllerutil.Helper
+	// scope is the namespaces watched by informers
+	scope informers.NamespaceScope
+
+	// listers used to assemble ownership tree
+	dLister   extensionslisters.DeploymentLister
+	dsLister  extensionslisters.DaemonSetLister
+	rsLister  extensionslisters.ReplicaSetLister
+	podLister corelisters.PodLister
+	cmLister  corelisters.ConfigMapLister
+	svcLister corelisters.ServiceLister
+
+	queue    workqueue.RateLimitingInterface
+	helper   *controllerutil.Helper
+	recorder record.EventRecorder
+
+	// statusWriter batches the status of loadbalancers, nil if disabled
+	statusWriter *lbutil.StatusWriter
+
+	// bootstrap enables updating and verifying the resource at startup
+	bootstrap bool
+
+	// statusView enables mirroring LoadBalancerStatusView into tenant namespaces
+	// from the loadbalancers in viewSources
+	statusView  bool
+	viewSources sets.String
+	viewQueue   workqueue.RateLimitingInterface
+	viewHelper  *controllerutil.Helper
+
+	// monitoring generates alerts and dashboards of loadbalancers, nil if disabled
+	monitoring       *monitoring
+	monitoringQueue  workqueue.RateLimitingInterface
+	monitoringHelper *controllerutil.Helper
+	// podMonitoring generates the PodMonitor of controller pods if enabled
+	podMonitoring config.Monitoring
+
+	// metricsClient gets the metrics of proxy pods for autoscaling
+	metricsClient autoscaling.MetricsClient
+
+	// resync schedules periodic resyncs, nil if disabled
+	resync *resyncSchedule
+
+	// gcPeriod is the period of garbage collection, 0 if disabled
+	gcPeriod time.Duration
+
+	// quota limits the number of loadbalancers, see quota.go
+	quota config.Quota
+
+	// leaseNamespace and leaseDuration configure the lease of controller
+	// identity, see handoff.go
+	leaseNamespace string
+	leaseDuration  time.Duration
 }
 
 // NewLoadBalancerController creates a new LoadBalancerController.
 func NewLoadBalancerController(cfg config.Configuration) *LoadBalancerController {
 	// TODO register metrics
 
+	// the informers are restricted to the namespaces owned by controller
+	scope := informers.NamespaceScope{
+		Allow: cfg.Namespaces.Allowed(),
+		Deny:  cfg.Namespaces.Denied(),
+	}
 	lbc := &LoadBalancerController{
-		kubeClient: cfg.Client,
-		tprClient:  cfg.TPRClient,
-		factory:    informers.NewSharedInformerFactory(cfg.Client, cfg.TPRClient, 0),
-		queue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "loadbalancer"),
+		kubeClient:  cfg.Client,
+		tprClient:   cfg.TPRClient,
+		recorder:    cfg.Recorder,
+		factory:     informers.NewScopedSharedInformerFactory(cfg.Client, cfg.TPRClient, time.Duration(cfg.InformerResyncPeriod)*time.Second, scope),
+		scope:       scope,
+		queue:       workqueue.NewNamedRateLimitingQueue(cfg.RateLimiter.New(), "loadbalancer"),
+		statusView:  cfg.StatusView,
+		viewSources: sets.NewString(cfg.StatusViewSourceNamespaces()...),
+		bootstrap:   cfg.Bootstrap,
+		gcPeriod:    time.Duration(cfg.GCPeriod) * time.Second,
+		quota:       cfg.Quota,
+
+		podMonitoring: cfg.Monitoring,
+
+		leaseNamespace: cfg.Handoff.LeaseNamespace,
+		leaseDuration:  time.Duration(cfg.Handoff.LeaseDuration) * time.Second,
 	}
 
+	lbutil.SetControllerID(cfg.Handoff.ControllerID)
+	audit.SetEnabled(cfg.AuditDiff)
+	lbutil.SetDryRun(cfg.DryRun)
+	lbutil.SetPriorityClassName(cfg.PriorityClassName)
+	controllerutil.SetSlowRetry(cfg.RateLimiter.FailureThreshold, time.Duration(cfg.RateLimiter.SlowRetryInterval)*time.Second)
+
 	// setup lb controller helper
 	lbc.helper = controllerutil.NewHelperForKeyFunc(&netv1alpha1.LoadBalancer{}, lbc.queue, lbc.syncLoadBalancer, controllerutil.PassthroughKeyFunc)
+	lbc.helper.Name = "loadbalancer"
+	lbc.helper.SyncFailureHandler = lbutil.NewSyncFailureHandler(lbc.helper.Name, lbc.tprClient, lbc.recorder)
+
+	// plugins report the results of reconciles to the controller, the hints
+	// of requeue sync the whole loadbalancer again
+	lbutil.SetAggregator(lbutil.NewAggregator(lbc.tprClient, lbc.recorder, func(lb *netv1alpha1.LoadBalancer, after time.Duration) {
+		lbc.helper.EnqueueAfter(lb, after)
+	}))
+
+	// the status reported by controller and plugins is batched and written
+	// in one patch per loadbalancer
+	if cfg.StatusBatchDelay > 0 {
+		lbc.statusWriter = lbutil.NewStatusWriter(lbc.tprClient, cfg.RateLimiter.New(), time.Duration(cfg.StatusBatchDelay)*time.Millisecond)
+		lbutil.SetStatusWriter(lbc.statusWriter)
+	}
+
+	heapsterNamespace, heapsterName, err := cache.SplitMetaNamespaceKey(cfg.HeapsterService)
+	if err != nil {
+		log.Fatal("Invalid heapster service", log.Fields{"service": cfg.HeapsterService, "err": err})
+	}
+	lbc.metricsClient = autoscaling.NewHeapsterMetricsClient(cfg.Client, heapsterNamespace, heapsterName)
+
+	if cfg.ResyncPeriod > 0 {
+		lbc.resync = newResyncSchedule(time.Duration(cfg.ResyncPeriod) * time.Second)
+	}
+
+	if lbc.statusView {
+		lbc.viewQueue = workqueue.NewNamedRateLimitingQueue(cfg.RateLimiter.New(), "loadbalancer-status-view")
+		lbc.viewHelper = controllerutil.NewHelperForKeyFunc(&netv1alpha1.LoadBalancer{}, lbc.viewQueue, lbc.syncStatusView, controllerutil.PassthroughKeyFunc)
+		lbc.viewHelper.Name = "loadbalancer-status-view"
+	}
+
+	if cfg.Monitoring.Enabled {
+		lbc.monitoring, err = newMonitoring(cfg.Monitoring)
+		if err != nil {
+			log.Fatal("Invalid monitoring configuration", log.Fields{"err": err})
+		}
+		lbc.monitoringQueue = workqueue.NewNamedRateLimitingQueue(cfg.RateLimiter.New(), "loadbalancer-monitoring")
+		lbc.monitoringHelper = controllerutil.NewHelperForKeyFunc(&netv1alpha1.LoadBalancer{}, lbc.monitoringQueue, lbc.syncMonitoring, controllerutil.PassthroughKeyFunc)
+		lbc.monitoringHelper.Name = "loadbalancer-monitoring"
+	}
 
 	// setup informer
 	lbinformer := lbc.factory.Networking().V1alpha1().LoadBalancer()
@@ -86,12 +217,35 @@ func NewLoadBalancerController(cfg config.Configuration) *LoadBalancerController
 	})
 
 	lbc.lbLister = lbinformer.Lister()
-	lbc.nodeLister = lbc.factory.Core().V1().Nodes().Lister()
+	nodeInformer := lbc.factory.Core().V1().Nodes()
+	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    lbc.addNode,
+		UpdateFunc: lbc.updateNode,
+		DeleteFunc: lbc.deleteNode,
+	})
+	lbc.nodeLister = nodeInformer.Lister()
+	lbc.dLister = lbc.factory.Extensions().V1beta1().Deployments().Lister()
+	lbc.dsLister = lbc.factory.Extensions().V1beta1().DaemonSets().Lister()
+	lbc.rsLister = lbc.factory.Extensions().V1beta1().ReplicaSets().Lister()
+	lbc.podLister = lbc.factory.Core().V1().Pods().Lister()
+	cmInformer := lbc.factory.Core().V1().ConfigMaps()
+	if cfg.Quota.ConfigMap != "" {
+		cmInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: lbc.updateQuotaConfigMap,
+			UpdateFunc: func(oldObj, curObj interface{}) {
+				lbc.updateQuotaConfigMap(curObj)
+			},
+			DeleteFunc: lbc.updateQuotaConfigMap,
+		})
+	}
+	lbc.cmLister = cmInformer.Lister()
+	lbc.svcLister = lbc.factory.Core().V1().Services().Lister()
 
 	// setup proxies
 	proxy.Init(cfg, lbc.factory)
 	// setup providers
 	provider.Init(cfg, lbc.factory)
+	pluginsInitialized.Open()
 
 	return lbc
 }
@@ -109,6 +263,15 @@ func (lbc *LoadBalancerController) Run(workers int, stopCh <-chan struct{}) {
 		return
 	}
 
+	if lbc.bootstrap {
+		// refuse to reconcile if the resource is not served as expected
+		if err := lbc.waitForResourceServed(stopCh); err != nil {
+			log.Error("Bootstrap loadbalancer resource error", log.Fields{"err": err})
+			return
+		}
+		lbc.printMigrationStatus()
+	}
+
 	// start shared informer
 	log.Info("Startting informer factory")
 	lbc.factory.Start(stopCh)
@@ -123,6 +286,10 @@ func (lbc *LoadBalancerController) Run(workers int, stopCh <-chan struct{}) {
 		}
 	}
 	log.Info("All caches have synced, Running LoadBalancer Controller ...", log.Fields{"worker": workers})
+	cachesSynced.Open()
+
+	// relabel objects generated with an earlier labeling scheme
+	go lbc.migrateLabels()
 
 	defer func() {
 		log.Info("Shuttingdown controller queue")
@@ -132,6 +299,35 @@ func (lbc *LoadBalancerController) Run(workers int, stopCh <-chan struct{}) {
 	// start loadbalancer worker
 	lbc.helper.Run(workers, stopCh)
 
+	if lbc.statusWriter != nil {
+		defer lbc.statusWriter.ShutDown()
+		lbc.statusWriter.Run(workers, stopCh)
+	}
+
+	go wait.Until(lbc.autoscale, autoscalingPeriod, stopCh)
+
+	if lbc.gcPeriod > 0 {
+		go wait.Until(lbc.collectGarbage, lbc.gcPeriod, stopCh)
+	}
+
+	if lbc.podMonitoring.PodMonitors && lbc.podMonitoring.ControllerSelector != "" {
+		go wait.Until(lbc.ensureControllerPodMonitor, controllerPodMonitorPeriod, stopCh)
+	}
+
+	if lbutil.ControllerID() != "" {
+		go wait.Until(lbc.renewLease, lbc.leaseDuration/3, stopCh)
+	}
+
+	if lbc.statusView {
+		defer lbc.viewHelper.ShutDown()
+		lbc.viewHelper.Run(1, stopCh)
+	}
+
+	if lbc.monitoring != nil {
+		defer lbc.monitoringHelper.ShutDown()
+		lbc.monitoringHelper.Run(1, stopCh)
+	}
+
 	// run proxy
 	proxy.Run(stopCh)
 	// run providers
@@ -154,10 +350,36 @@ func (lbc *LoadBalancerController) ensureResource() error {
 		Description: "A specification of loadbalancer to provider load balancing for ingress",
 	}
 
+	if err := lbc.ensureThirdPartyResource(tpr); err != nil {
+		return err
+	}
+
+	if !lbc.statusView {
+		return nil
+	}
+
+	viewTPR := &v1beta1.ThirdPartyResource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: netv1alpha1.LoadBalancerStatusViewTPRName + "." + netv1alpha1.AlphaGroupName,
+		},
+		Versions: []v1beta1.APIVersion{
+			{Name: netv1alpha1.Version},
+		},
+		Description: "A read-only view of loadbalancer status for tenants",
+	}
+
+	return lbc.ensureThirdPartyResource(viewTPR)
+}
+
+func (lbc *LoadBalancerController) ensureThirdPartyResource(tpr *v1beta1.ThirdPartyResource) error {
 	_, err := lbc.kubeClient.ExtensionsV1beta1().ThirdPartyResources().Create(tpr)
 
+	if errors.IsAlreadyExists(err) && lbc.bootstrap {
+		return lbc.updateThirdPartyResource(tpr)
+	}
+
 	if errors.IsAlreadyExists(err) {
-		log.Info("Skip the creation for ThirdPartyResource LoadBalancer because it has already been created")
+		log.Info("Skip the creation for ThirdPartyResource because it has already been created", log.Fields{"tpr": tpr.Name})
 		return nil
 	}
 
@@ -165,7 +387,7 @@ func (lbc *LoadBalancerController) ensureResource() error {
 		return err
 	}
 
-	log.Info("Create ThirdPartyResource LoadBalancer successfully")
+	log.Info("Create ThirdPartyResource successfully", log.Fields{"tpr": tpr.Name})
 
 	return nil
 }
@@ -178,12 +400,6 @@ func (lbc *LoadBalancerController) syncLoadBalancer(obj interface{}) error {
 		return fmt.Errorf("expect loadbalancer, got %v", obj)
 	}
 
-	// Validate loadbalancer scheme
-	if err := validation.ValidateLoadBalancer(lb); err != nil {
-		log.Debug("invalid loadbalancer scheme", log.Fields{"err": err})
-		return err
-	}
-
 	key, _ := controllerutil.KeyFunc(lb)
 
 	startTime := time.Now()
@@ -193,7 +409,16 @@ func (lbc *LoadBalancerController) syncLoadBalancer(obj interface{}) error {
 
 	nlb, err := lbc.lbLister.LoadBalancers(lb.Namespace).Get(lb.Name)
 	if errors.IsNotFound(err) {
+		if !lbutil.IsOwned(lb) {
+			return nil
+		}
 		log.Warn("LoadBalancer has been deleted", log.Fields{"lb": key})
+		if lbc.resync != nil {
+			lbc.resync.forget(key)
+		}
+		if lbutil.IsDryRun(lb) {
+			return lbc.plan(lb)
+		}
 		// deleted
 		return lbc.sync(lb, true)
 	}
@@ -209,9 +434,108 @@ func (lbc *LoadBalancerController) syncLoadBalancer(obj interface{}) error {
 	}
 	lb = nlb
 
+	if lb.DeletionTimestamp == nil {
+		// validate loadbalancer scheme with defaults resolved, the defaults are
+		// written back to spec below. The cleanup of a loadbalancer being
+		// deleted never depends on a valid spec
+		resolved, err := lbc.clone(lb)
+		if err != nil {
+			return err
+		}
+		netv1alpha1.SetLoadBalancerDefaults(resolved)
+		if err := validation.ValidateLoadBalancer(resolved); err != nil {
+			log.Debug("invalid loadbalancer scheme", log.Fields{"err": err})
+			return err
+		}
+	}
+
+	if lbutil.IsDryRun(lb) {
+		lbc.scheduleResync(lb)
+		return lbc.plan(lb)
+	}
+
+	if owned, err := lbc.reconcileOwnership(lb); err != nil || !owned {
+		// owned by another controller, or the update will trigger another sync
+		return err
+	}
+
+	if lb.DeletionTimestamp != nil {
+		log.Info("LoadBalancer is being deleted", log.Fields{"lb": key})
+		return lbc.sync(lb, true)
+	}
+
+	lbc.scheduleResync(lb)
+
+	if lbutil.IsPaused(lb) {
+		log.Info("LoadBalancer is paused", log.Fields{"lb": key})
+		return nil
+	}
+
+	if rolled, err := lbc.rollback(lb); err != nil || rolled {
+		// the update will trigger another sync
+		return err
+	}
+
+	if defaulted, err := lbc.setDefaults(lb); err != nil || defaulted {
+		// the update will trigger another sync
+		return err
+	}
+
+	if admitted, err := lbc.admitQuota(lb); err != nil || !admitted {
+		// exceeding quota, or the update will trigger another sync
+		return err
+	}
+
+	if changed, err := lbc.selectNodes(lb); err != nil || changed {
+		// the update will trigger another sync
+		return err
+	}
+
+	err = lbutil.AddFinalizer(lbc.tprClient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, finalizer)
+	if err != nil {
+		log.Error("Add finalizer error", log.Fields{"lb": key, "err": err})
+		return err
+	}
+
+	if err := lbc.recordRevision(lb); err != nil {
+		// history is best effort, it does not block syncing
+		log.Warn("Record revision of loadbalancer error", log.Fields{"lb": key, "err": err})
+	}
+
 	return lbc.sync(lb, false)
 }
 
+// setDefaults writes the defaults back to spec, so that users see the fully
+// resolved spec instead of defaults hidden in controller and plugins.
+// It returns true if lb is updated
+func (lbc *LoadBalancerController) setDefaults(lb *netv1alpha1.LoadBalancer) (bool, error) {
+	resolved, err := lbc.clone(lb)
+	if err != nil {
+		return false, err
+	}
+	netv1alpha1.SetLoadBalancerDefaults(resolved)
+	if apiequality.Semantic.DeepEqual(resolved.Spec, lb.Spec) {
+		return false, nil
+	}
+
+	log.Info("Set defaults of loadbalancer spec", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name})
+	_, err = lbutil.UpdateLBWithRetries(
+		lbc.tprClient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
+		lb.Namespace,
+		lb.Name,
+		func(lb *netv1alpha1.LoadBalancer) error {
+			netv1alpha1.SetLoadBalancerDefaults(lb)
+			return nil
+		},
+	)
+	if err != nil {
+		log.Error("Update loadbalancer defaults error", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "err": err})
+		return false, err
+	}
+	lbc.recorder.Event(lb, apiv1.EventTypeNormal, lbutil.EventReasonDefaulted, "Set defaults of spec")
+	return true, nil
+}
+
 func (lbc *LoadBalancerController) sync(lb *netv1alpha1.LoadBalancer, deleted bool) error {
 
 	nlb, err := lbc.clone(lb)
@@ -237,8 +561,17 @@ func (lbc *LoadBalancerController) sync(lb *netv1alpha1.LoadBalancer, deleted bo
 
 	// sync nodes
 	err = lbc.syncNodes(lb)
+	if err != nil {
+		lbc.recorder.Eventf(lb, apiv1.EventTypeWarning, lbutil.EventReasonSyncFailed, "Sync nodes failed: %v", err)
+		return err
+	}
+
+	if deleted {
+		// labels and taints have been removed from nodes
+		return lbutil.RemoveFinalizer(lbc.tprClient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, finalizer)
+	}
 
-	return err
+	return nil
 }
 
 func (lbc *LoadBalancerController) syncNodes(lb *netv1alpha1.LoadBalancer) error {
@@ -291,6 +624,8 @@ func (lbc *LoadBalancerController) addLoadBalancer(obj interface{}) {
 	lb := obj.(*netv1alpha1.LoadBalancer)
 	log.Info("Adding LoadBalancer", log.Fields{"name": lb.Name})
 	lbc.helper.Enqueue(lb)
+	lbc.enqueueStatusView(lb)
+	lbc.enqueueMonitoring(lb)
 }
 
 func (lbc *LoadBalancerController) updateLoadBalancer(oldObj, curObj interface{}) {
@@ -303,7 +638,45 @@ func (lbc *LoadBalancerController) updateLoadBalancer(oldObj, curObj interface{}
 		return
 	}
 
-	if reflect.DeepEqual(old.Spec, cur.Spec) {
+	if !reflect.DeepEqual(old.Status, cur.Status) || !reflect.DeepEqual(old.Annotations, cur.Annotations) {
+		lbc.enqueueStatusView(cur)
+	}
+	if !reflect.DeepEqual(old.Spec, cur.Spec) || cur.DeletionTimestamp != nil || lbutil.IsPaused(old) != lbutil.IsPaused(cur) || lbutil.IsDryRun(old) != lbutil.IsDryRun(cur) {
+		lbc.enqueueMonitoring(cur)
+	}
+
+	if ownershipChanged(old, cur) {
+		log.Info("Ownership of LoadBalancer changed", log.Fields{"lb.name": cur.Name, "lb.ns": cur.Namespace})
+		lbc.helper.Enqueue(cur)
+		lbc.enqueueMonitoring(cur)
+		return
+	}
+
+	if cur.DeletionTimestamp != nil {
+		// finalizers block the deletion, plugins need to clean up
+		log.Info("Deleting LoadBalancer", log.Fields{"lb.name": cur.Name, "lb.ns": cur.Namespace})
+		lbc.helper.Enqueue(cur)
+		if old.DeletionTimestamp == nil {
+			// the quota used by lb is released
+			lbc.enqueueQuotaExceeded()
+		}
+		return
+	}
+
+	if lbutil.IsQuotaExceeded(old) != lbutil.IsQuotaExceeded(cur) {
+		// admitted or blocked by quota, plugins need to be synced
+		lbc.helper.Enqueue(cur)
+		return
+	}
+
+	if lbutil.IsDryRun(old) != lbutil.IsDryRun(cur) {
+		// entering dry run plans the changes, leaving it makes them
+		lbc.helper.Enqueue(cur)
+		return
+	}
+
+	// nodes in status are picked by controller, plugins need to be synced
+	if reflect.DeepEqual(old.Spec, cur.Spec) && reflect.DeepEqual(old.Status.Nodes, cur.Status.Nodes) {
 		return
 	}
 
@@ -318,7 +691,9 @@ func (lbc *LoadBalancerController) updateLoadBalancer(oldObj, curObj interface{}
 		_, err = lbc.tprClient.NetworkingV1alpha1().LoadBalancers(cur.Namespace).Update(revert)
 		if err != nil {
 			log.Error("revert loadbalancer type error", log.Fields{"err": err})
+			return
 		}
+		lbc.recorder.Eventf(cur, apiv1.EventTypeWarning, lbutil.EventReasonUpdated, "Forbidden to change the type of loadbalancer from %s to %s, revert it", old.Spec.Type, cur.Spec.Type)
 
 		return
 	}
@@ -346,6 +721,9 @@ func (lbc *LoadBalancerController) deleteLoadBalancer(obj interface{}) {
 	log.Info("Deleting LoadBalancer", log.Fields{"lb.name": lb.Name, "lb.ns": lb.Namespace})
 
 	lbc.helper.Enqueue(lb)
+	lbc.enqueueStatusView(lb)
+	lbc.enqueueMonitoring(lb)
+	lbc.enqueueQuotaExceeded()
 }
 
 func (lbc *LoadBalancerController) clone(lb *netv1alpha1.LoadBalancer) (*netv1alpha1.LoadBalancer, error) {
@@ -358,7 +736,7 @@ func (lbc *LoadBalancerController) clone(lb *netv1alpha1.LoadBalancer) (*netv1al
 	nlb, ok := lbi.(*netv1alpha1.LoadBalancer)
 	if !ok {
 		nerr := fmt.Errorf("expected loadbalancer, got %#v", lbi)
-		log.Error(nerr)
+		log.Error("Unexpected type of copied loadbalancer", log.Fields{"lb.name": lb.Name, "err": nerr})
 		return nil, err
 	}
 	return nlb, nil
@@ -397,7 +775,7 @@ func (lbc *LoadBalancerController) doLabelAndTaints(nodesToDelete []*apiv1.Node,
 			}
 			_, err = lbc.kubeClient.CoreV1().Nodes().Patch(node.Name, types.StrategicMergePatchType, patch)
 			if err != nil {
-				log.Errorf("update node err: %v", err)
+				log.Error("Update node error", log.Fields{"node": node.Name, "err": err})
 				return err
 			}
 			log.Notice("Delete labels and taints from old nodes", log.Fields{
@@ -438,7 +816,7 @@ func (lbc *LoadBalancerController) doLabelAndTaints(nodesToDelete []*apiv1.Node,
 			}
 			_, err = lbc.kubeClient.CoreV1().Nodes().Patch(node.Name, types.StrategicMergePatchType, patch)
 			if err != nil {
-				log.Errorf("update node err: %v", err)
+				log.Error("Update node error", log.Fields{"node": node.Name, "err": err})
 				return err
 			}
 			log.Notice("Ensure labels and taints for requested nodes", log.Fields{
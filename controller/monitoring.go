@@ -0,0 +1,444 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/caicloud/loadbalancer-controller/config"
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+	"github.com/ghodss/yaml"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// prometheusRuleAPIVersion is the group version of PrometheusRule of prometheus operator
+	prometheusRuleAPIVersion = "monitoring.coreos.com/v1"
+	prometheusRuleKind       = "PrometheusRule"
+	prometheusRuleResource   = "prometheusrules"
+
+	alertsNameSuffix    = "-loadbalancer-alerts"
+	dashboardNameSuffix = "-loadbalancer-dashboard"
+	monitoringComponent = "monitoring"
+
+	// controllerPodMonitorName is the name of PodMonitor of controller pods
+	controllerPodMonitorName = "loadbalancer-controller"
+	// controllerPodMonitorPeriod is the period of correcting the PodMonitor
+	// of controller pods
+	controllerPodMonitorPeriod = 10 * time.Minute
+)
+
+// defaultRulesTemplate renders the alerts on vip downtime, frequent failovers
+// and replica shortfalls from kube-state-metrics and the metrics of controller.
+// The templates of alerting rules are escaped from text/template
+const defaultRulesTemplate = `groups:
+- name: loadbalancer-{{ .Namespace }}-{{ .Name }}
+  rules:
+  - alert: LoadBalancerProxyReplicasShortfall
+    expr: |
+      (sum(kube_deployment_status_replicas_available{namespace="{{ .Namespace }}",deployment=~"{{ .Proxy }}-.*"}) or vector(0))
+      + (sum(kube_daemonset_status_number_ready{namespace="{{ .Namespace }}",daemonset=~"{{ .Proxy }}.*"}) or vector(0))
+      < (sum(kube_deployment_spec_replicas{namespace="{{ .Namespace }}",deployment=~"{{ .Proxy }}-.*"}) or vector(0))
+      + (sum(kube_daemonset_status_desired_number_scheduled{namespace="{{ .Namespace }}",daemonset=~"{{ .Proxy }}.*"}) or vector(0))
+    for: 15m
+    labels:
+      severity: warning
+    annotations:
+      summary: Proxy of loadbalancer {{ .Namespace }}/{{ .Name }} has fewer ready replicas than desired
+{{- if .Provider }}
+  - alert: LoadBalancerProviderReplicasShortfall
+    expr: |
+      (sum(kube_deployment_status_replicas_available{namespace="{{ .Namespace }}",deployment=~"{{ .Provider }}-.*"}) or vector(0))
+      + (sum(kube_daemonset_status_number_ready{namespace="{{ .Namespace }}",daemonset=~"{{ .Provider }}.*"}) or vector(0))
+      < (sum(kube_deployment_spec_replicas{namespace="{{ .Namespace }}",deployment=~"{{ .Provider }}-.*"}) or vector(0))
+      + (sum(kube_daemonset_status_desired_number_scheduled{namespace="{{ .Namespace }}",daemonset=~"{{ .Provider }}.*"}) or vector(0))
+    for: 15m
+    labels:
+      severity: warning
+    annotations:
+      summary: Provider of loadbalancer {{ .Namespace }}/{{ .Name }} has fewer ready replicas than desired
+  - alert: LoadBalancerVipDown
+    expr: |
+      (sum(kube_deployment_status_replicas_available{namespace="{{ .Namespace }}",deployment=~"{{ .Provider }}-.*"}) or vector(0))
+      + (sum(kube_daemonset_status_number_ready{namespace="{{ .Namespace }}",daemonset=~"{{ .Provider }}.*"}) or vector(0))
+      == 0
+    for: 1m
+    labels:
+      severity: critical
+    annotations:
+      summary: Vip {{ join .Vips ", " }} of loadbalancer {{ .Namespace }}/{{ .Name }} is down
+  - alert: LoadBalancerFrequentFailover
+    expr: increase(loadbalancer_ipvsdr_failovers{loadbalancer="{{ .Namespace }}/{{ .Name }}"}[1h]) > 3
+    labels:
+      severity: warning
+    annotations:
+      summary: Vip of loadbalancer {{ .Namespace }}/{{ .Name }} failed over {{ "{{ $value }}" }} times in the last hour
+{{- end }}
+`
+
+// defaultDashboardTemplate renders a Grafana dashboard of ready replicas and failovers
+const defaultDashboardTemplate = `{
+  "title": "LoadBalancer {{ .Namespace }}/{{ .Name }}",
+  "uid": "lb-{{ .UID }}",
+  "tags": ["loadbalancer"],
+  "timezone": "browser",
+  "schemaVersion": 16,
+  "refresh": "30s",
+  "time": {"from": "now-6h", "to": "now"},
+  "panels": [
+    {
+      "id": 1,
+      "type": "graph",
+      "title": "Proxy ready replicas",
+      "gridPos": {"x": 0, "y": 0, "w": 12, "h": 8},
+      "targets": [
+        {"expr": "sum(kube_deployment_status_replicas_available{namespace=\"{{ .Namespace }}\",deployment=~\"{{ .Proxy }}-.*\"}) or sum(kube_daemonset_status_number_ready{namespace=\"{{ .Namespace }}\",daemonset=~\"{{ .Proxy }}.*\"})", "legendFormat": "ready"}
+      ]
+    }{{ if .Provider }},
+    {
+      "id": 2,
+      "type": "graph",
+      "title": "Provider ready replicas",
+      "gridPos": {"x": 12, "y": 0, "w": 12, "h": 8},
+      "targets": [
+        {"expr": "sum(kube_deployment_status_replicas_available{namespace=\"{{ .Namespace }}\",deployment=~\"{{ .Provider }}-.*\"}) or sum(kube_daemonset_status_number_ready{namespace=\"{{ .Namespace }}\",daemonset=~\"{{ .Provider }}.*\"})", "legendFormat": "ready"}
+      ]
+    },
+    {
+      "id": 3,
+      "type": "graph",
+      "title": "Failovers of vip {{ join .Vips ", " }}",
+      "gridPos": {"x": 0, "y": 8, "w": 24, "h": 8},
+      "targets": [
+        {"expr": "increase(loadbalancer_ipvsdr_failovers{loadbalancer=\"{{ .Namespace }}/{{ .Name }}\"}[1h])", "legendFormat": "failovers"}
+      ]
+    }{{ end }}
+  ]
+}
+`
+
+// monitoring generates the PrometheusRule and the ConfigMap of Grafana
+// dashboard for each loadbalancer
+type monitoring struct {
+	rules           *template.Template
+	dashboard       *template.Template
+	ruleLabels      labels.Set
+	dashboardLabels labels.Set
+}
+
+// monitoringData is passed to the templates of monitoring objects
+type monitoringData struct {
+	Namespace string
+	Name      string
+	UID       string
+	// Proxy is the name prefix of proxy deployments and daemonsets
+	Proxy string
+	// Provider is the name prefix of provider deployments and daemonsets,
+	// empty if the provider runs no pods
+	Provider string
+	Vips     []string
+}
+
+// newMonitoring parses the templates of monitoring objects, the configuration
+// has been validated
+func newMonitoring(cfg config.Monitoring) (*monitoring, error) {
+	m := &monitoring{}
+	var err error
+	if m.rules, err = parseMonitoringTemplate("rules", cfg.RulesTemplate, defaultRulesTemplate); err != nil {
+		return nil, err
+	}
+	if m.dashboard, err = parseMonitoringTemplate("dashboard", cfg.DashboardTemplate, defaultDashboardTemplate); err != nil {
+		return nil, err
+	}
+	if m.ruleLabels, err = labels.ConvertSelectorToLabelsMap(cfg.RuleLabels); err != nil {
+		return nil, err
+	}
+	if m.dashboardLabels, err = labels.ConvertSelectorToLabelsMap(cfg.DashboardLabels); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func parseMonitoringTemplate(name, path, builtin string) (*template.Template, error) {
+	t := template.New(name).Funcs(template.FuncMap{"join": strings.Join}).Option("missingkey=error")
+	if path == "" {
+		return t.Parse(builtin)
+	}
+	return t.ParseFiles(path)
+}
+
+func newMonitoringData(lb *netv1alpha1.LoadBalancer) *monitoringData {
+	data := &monitoringData{
+		Namespace: lb.Namespace,
+		Name:      lb.Name,
+		UID:       string(lb.UID),
+		Proxy:     fmt.Sprintf("%s-proxy-%s", lb.Name, lb.Spec.Proxy.Type),
+	}
+	if ipvsdr := lb.Spec.Providers.Ipvsdr; ipvsdr != nil {
+		data.Provider = lb.Name + "-provider-ipvsdr"
+		if ipvsdr.Vip != "" {
+			data.Vips = append(data.Vips, ipvsdr.Vip)
+		}
+		data.Vips = append(data.Vips, ipvsdr.Vips...)
+	}
+	return data
+}
+
+func (lbc *LoadBalancerController) enqueueMonitoring(lb *netv1alpha1.LoadBalancer) {
+	if lbc.monitoring == nil {
+		return
+	}
+	lbc.monitoringHelper.Enqueue(lb)
+}
+
+// syncMonitoring ensures the monitoring objects of loadbalancer, they are
+// deleted along with the loadbalancer
+func (lbc *LoadBalancerController) syncMonitoring(obj interface{}) error {
+	lb, ok := obj.(*netv1alpha1.LoadBalancer)
+	if !ok {
+		return fmt.Errorf("expect loadbalancer, got %v", obj)
+	}
+	if !lbutil.IsOwned(lb) {
+		return nil
+	}
+
+	nlb, err := lbc.lbLister.LoadBalancers(lb.Namespace).Get(lb.Name)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if errors.IsNotFound(err) || nlb.UID != lb.UID || nlb.DeletionTimestamp != nil {
+		return lbc.deleteMonitoring(lb)
+	}
+	lb = nlb
+	if lbutil.IsPaused(lb) || lbutil.IsDryRun(lb) {
+		return nil
+	}
+
+	data := newMonitoringData(lb)
+	if err := lbc.ensureDashboard(lb, data); err != nil {
+		return err
+	}
+	return lbc.ensurePrometheusRule(lb, data)
+}
+
+func (lbc *LoadBalancerController) monitoringMeta(lb *netv1alpha1.LoadBalancer, name string, extra labels.Set) metav1.ObjectMeta {
+	selector := map[string]string{
+		netv1alpha1.LabelKeyCreatedBy: fmt.Sprintf(netv1alpha1.LabelValueFormatCreateby, lb.Namespace, lb.Name),
+	}
+	objLabels := lbutil.WithArtifactLabels(selector, lb, monitoringComponent)
+	for k, v := range extra {
+		objLabels[k] = v
+	}
+	t := true
+	return metav1.ObjectMeta{
+		Name:      name,
+		Namespace: lb.Namespace,
+		Labels:    objLabels,
+		OwnerReferences: []metav1.OwnerReference{
+			{
+				APIVersion:         netv1alpha1.SchemeGroupVersion.String(),
+				Kind:               netv1alpha1.LoadBalancerKind,
+				Name:               lb.Name,
+				UID:                lb.UID,
+				Controller:         &t,
+				BlockOwnerDeletion: &t,
+			},
+		},
+	}
+}
+
+func (lbc *LoadBalancerController) ensureDashboard(lb *netv1alpha1.LoadBalancer, data *monitoringData) error {
+	var buf bytes.Buffer
+	if err := lbc.monitoring.dashboard.Execute(&buf, data); err != nil {
+		return fmt.Errorf("render dashboard of loadbalancer %v/%v error: %v", lb.Namespace, lb.Name, err)
+	}
+	// reject the dashboards Grafana can not load
+	if !json.Valid(buf.Bytes()) {
+		return fmt.Errorf("rendered dashboard of loadbalancer %v/%v is not valid json", lb.Namespace, lb.Name)
+	}
+
+	name := lb.Name + dashboardNameSuffix
+	desired := &apiv1.ConfigMap{
+		ObjectMeta: lbc.monitoringMeta(lb, name, lbc.monitoring.dashboardLabels),
+		Data: map[string]string{
+			fmt.Sprintf("%s-%s.json", lb.Namespace, lb.Name): buf.String(),
+		},
+	}
+
+	cms := lbc.kubeClient.CoreV1().ConfigMaps(lb.Namespace)
+	cm, err := lbc.cmLister.ConfigMaps(lb.Namespace).Get(name)
+	if errors.IsNotFound(err) {
+		log.Info("Create dashboard of loadbalancer", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "cm.name": name})
+		_, err = cms.Create(desired)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if reflect.DeepEqual(cm.Data, desired.Data) && labelsContain(cm.Labels, desired.Labels) {
+		return nil
+	}
+	copied := *cm
+	copied.Labels = make(map[string]string, len(cm.Labels)+len(desired.Labels))
+	for k, v := range cm.Labels {
+		copied.Labels[k] = v
+	}
+	for k, v := range desired.Labels {
+		copied.Labels[k] = v
+	}
+	copied.Data = desired.Data
+	log.Info("Update dashboard of loadbalancer", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "cm.name": name})
+	_, err = cms.Update(&copied)
+	return err
+}
+
+// ensurePrometheusRule ensures the PrometheusRule through REST API, there is no
+// client of prometheus operator. Nothing is generated if it is not served
+func (lbc *LoadBalancerController) ensurePrometheusRule(lb *netv1alpha1.LoadBalancer, data *monitoringData) error {
+	var buf bytes.Buffer
+	if err := lbc.monitoring.rules.Execute(&buf, data); err != nil {
+		return fmt.Errorf("render rules of loadbalancer %v/%v error: %v", lb.Namespace, lb.Name, err)
+	}
+	specJSON, err := yaml.YAMLToJSON(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("rendered rules of loadbalancer %v/%v is not valid yaml: %v", lb.Namespace, lb.Name, err)
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(specJSON, &spec); err != nil {
+		return fmt.Errorf("rendered rules of loadbalancer %v/%v is not an object: %v", lb.Namespace, lb.Name, err)
+	}
+
+	name := lb.Name + alertsNameSuffix
+	meta := lbc.monitoringMeta(lb, name, lbc.monitoring.ruleLabels)
+	client := lbc.kubeClient.CoreV1().RESTClient()
+	path := fmt.Sprintf("/apis/%s/namespaces/%s/%s", prometheusRuleAPIVersion, lb.Namespace, prometheusRuleResource)
+
+	raw, err := client.Get().AbsPath(path, name).Do().Raw()
+	if errors.IsNotFound(err) {
+		body, _ := json.Marshal(map[string]interface{}{
+			"apiVersion": prometheusRuleAPIVersion,
+			"kind":       prometheusRuleKind,
+			"metadata":   meta,
+			"spec":       spec,
+		})
+		log.Info("Create alerts of loadbalancer", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "rule.name": name})
+		err = client.Post().AbsPath(path).Body(body).Do().Error()
+		if errors.IsNotFound(err) {
+			log.Warn("PrometheusRule is not served, skip generating alerts of loadbalancer", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name})
+			return nil
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	var existing struct {
+		Metadata metav1.ObjectMeta      `json:"metadata"`
+		Spec     map[string]interface{} `json:"spec"`
+	}
+	if err := json.Unmarshal(raw, &existing); err != nil {
+		return err
+	}
+	if reflect.DeepEqual(existing.Spec, spec) && labelsContain(existing.Metadata.Labels, meta.Labels) {
+		return nil
+	}
+
+	updated := existing.Metadata
+	if updated.Labels == nil {
+		updated.Labels = make(map[string]string)
+	}
+	for k, v := range meta.Labels {
+		updated.Labels[k] = v
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": prometheusRuleAPIVersion,
+		"kind":       prometheusRuleKind,
+		"metadata":   updated,
+		"spec":       spec,
+	})
+	log.Info("Update alerts of loadbalancer", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "rule.name": name})
+	return client.Put().AbsPath(path, name).Body(body).Do().Error()
+}
+
+// deleteMonitoring deletes the monitoring objects of deleted loadbalancer,
+// they are owned by loadbalancer but TPRs are not collected by apiserver
+func (lbc *LoadBalancerController) deleteMonitoring(lb *netv1alpha1.LoadBalancer) error {
+	name := lb.Name + dashboardNameSuffix
+	err := lbc.kubeClient.CoreV1().ConfigMaps(lb.Namespace).Delete(name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	name = lb.Name + alertsNameSuffix
+	path := fmt.Sprintf("/apis/%s/namespaces/%s/%s", prometheusRuleAPIVersion, lb.Namespace, prometheusRuleResource)
+	err = lbc.kubeClient.CoreV1().RESTClient().Delete().AbsPath(path, name).Do().Error()
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// ensureControllerPodMonitor ensures the PodMonitor scraping the metrics of
+// controller pods, it is not owned by any loadbalancer and kept until it is
+// deleted by hand
+func (lbc *LoadBalancerController) ensureControllerPodMonitor() {
+	cfg := lbc.podMonitoring
+	pods, err := labels.ConvertSelectorToLabelsMap(cfg.ControllerSelector)
+	if err != nil {
+		log.Error("Invalid selector of controller pods", log.Fields{"selector": cfg.ControllerSelector, "err": err})
+		return
+	}
+	meta := metav1.ObjectMeta{
+		Name:      controllerPodMonitorName,
+		Namespace: cfg.ControllerNamespace,
+		Labels:    cfg.PodMonitorLabelSet(),
+	}
+	endpoints := []lbutil.PodMetricsEndpoint{
+		{Port: "metrics", Path: "/metrics"},
+	}
+	if lbutil.DryRun() {
+		log.Debug("Dry run, would ensure PodMonitor of controller", log.Fields{"ns": meta.Namespace, "name": meta.Name})
+		return
+	}
+	if _, err := lbutil.EnsurePodMonitor(lbc.kubeClient, meta, pods, endpoints); err != nil {
+		log.Error("Ensure PodMonitor of controller error", log.Fields{"err": err})
+	}
+}
+
+// labelsContain returns true if all the labels in subset are in set
+func labelsContain(set, subset map[string]string) bool {
+	for k, v := range subset {
+		if set[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"sort"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+	stringsutil "github.com/caicloud/loadbalancer-controller/pkg/util/strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/errors"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// selectNodes observes the readiness of nodes and picks nodes by selector,
+// the results are recorded in status so that controller and plugins agree
+// on the nodes. It returns true if the status is changed
+func (lbc *LoadBalancerController) selectNodes(lb *netv1alpha1.LoadBalancer) (bool, error) {
+	spec := lb.Spec.Nodes
+	status := netv1alpha1.NodesStatus{}
+
+	if len(spec.Names) == 0 && len(spec.Selector) != 0 {
+		replicas := 1
+		if spec.Replicas != nil {
+			replicas = int(*spec.Replicas)
+		}
+		selector := labels.SelectorFromSet(labels.Set(spec.Selector))
+
+		// keep the selected nodes as long as they are ready and matching
+		for _, name := range lb.Status.Nodes.Selected {
+			node, err := lbc.nodeLister.Get(name)
+			if err != nil || !nodeReady(node) || !selector.Matches(labels.Set(node.Labels)) {
+				continue
+			}
+			if len(status.Selected) < replicas {
+				status.Selected = append(status.Selected, name)
+			}
+		}
+
+		nodes, err := lbc.nodeLister.List(selector)
+		if err != nil {
+			return false, err
+		}
+		sort.Sort(nodesByName(nodes))
+		for _, node := range nodes {
+			if len(status.Selected) >= replicas {
+				break
+			}
+			if nodeReady(node) && !stringsutil.StringInSlice(node.Name, status.Selected) {
+				status.Selected = append(status.Selected, node.Name)
+			}
+		}
+	}
+
+	for _, name := range append(append([]string{}, spec.Names...), spec.Standby...) {
+		node, err := lbc.nodeLister.Get(name)
+		if err != nil || !nodeReady(node) {
+			status.Unready = append(status.Unready, name)
+		}
+	}
+	sort.Strings(status.Unready)
+
+	if reflect.DeepEqual(lb.Status.Nodes, status) {
+		return false, nil
+	}
+
+	log.Info("Nodes of loadbalancer changed", log.Fields{"lb.name": lb.Name, "lb.ns": lb.Namespace, "selected": status.Selected, "unready": status.Unready})
+	_, err := lbutil.UpdateLBWithRetries(
+		lbc.tprClient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
+		lb.Namespace,
+		lb.Name,
+		func(lb *netv1alpha1.LoadBalancer) error {
+			if reflect.DeepEqual(lb.Status.Nodes, status) {
+				return errors.ErrPreconditionViolated
+			}
+			lb.Status.Nodes = status
+			return nil
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	lbc.recorder.Eventf(lb, apiv1.EventTypeNormal, lbutil.EventReasonNodesChanged, "Nodes changed, selected: %v, unready: %v", status.Selected, status.Unready)
+	return true, nil
+}
+
+func nodeReady(node *apiv1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == apiv1.NodeReady {
+			return c.Status == apiv1.ConditionTrue
+		}
+	}
+	return false
+}
+
+type nodesByName []*apiv1.Node
+
+func (s nodesByName) Len() int           { return len(s) }
+func (s nodesByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s nodesByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// nodeRelated returns true if the node is used by lb or may be picked by lb
+func nodeRelated(lb *netv1alpha1.LoadBalancer, node *apiv1.Node) bool {
+	spec := lb.Spec.Nodes
+	if stringsutil.StringInSlice(node.Name, spec.Names) ||
+		stringsutil.StringInSlice(node.Name, spec.Standby) ||
+		stringsutil.StringInSlice(node.Name, lb.Status.Nodes.Selected) {
+		return true
+	}
+	return len(spec.Names) == 0 && len(spec.Selector) != 0 &&
+		labels.SelectorFromSet(labels.Set(spec.Selector)).Matches(labels.Set(node.Labels))
+}
+
+func (lbc *LoadBalancerController) enqueueLoadBalancersForNode(node *apiv1.Node) {
+	lbs, err := lbc.lbLister.List(labels.Everything())
+	if err != nil {
+		return
+	}
+	for _, lb := range lbs {
+		if nodeRelated(lb, node) {
+			lbc.helper.Enqueue(lb)
+		}
+	}
+}
+
+func (lbc *LoadBalancerController) addNode(obj interface{}) {
+	lbc.enqueueLoadBalancersForNode(obj.(*apiv1.Node))
+}
+
+func (lbc *LoadBalancerController) updateNode(oldObj, curObj interface{}) {
+	old := oldObj.(*apiv1.Node)
+	cur := curObj.(*apiv1.Node)
+	if nodeReady(old) == nodeReady(cur) && reflect.DeepEqual(old.Labels, cur.Labels) {
+		return
+	}
+	lbc.enqueueLoadBalancersForNode(old)
+	lbc.enqueueLoadBalancersForNode(cur)
+}
+
+func (lbc *LoadBalancerController) deleteNode(obj interface{}) {
+	node, ok := obj.(*apiv1.Node)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
+		}
+		node, ok = tombstone.Obj.(*apiv1.Node)
+		if !ok {
+			return
+		}
+	}
+	lbc.enqueueLoadBalancersForNode(node)
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kubernetes/pkg/controller"
+)
+
+// ownershipNode is a node in the ownership tree of loadbalancer
+type ownershipNode struct {
+	kind     string
+	name     string
+	detail   string
+	children []*ownershipNode
+}
+
+func (n *ownershipNode) add(child *ownershipNode) *ownershipNode {
+	n.children = append(n.children, child)
+	return child
+}
+
+func (n *ownershipNode) print(buf *bytes.Buffer, depth int) {
+	buf.WriteString(strings.Repeat("  ", depth))
+	fmt.Fprintf(buf, "%s %s", n.kind, n.name)
+	if n.detail != "" {
+		fmt.Fprintf(buf, " (%s)", n.detail)
+	}
+	buf.WriteString("\n")
+	for _, child := range n.children {
+		child.print(buf, depth+1)
+	}
+}
+
+// ServeOwnership prints the ownership tree of the loadbalancer requested
+// by /debug/ownership/{namespace}/{name}, assembled from informer caches
+func (lbc *LoadBalancerController) ServeOwnership(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/debug/ownership"), "/"), "/")
+	if len(parts) != 2 {
+		http.Error(w, "expect /debug/ownership/{namespace}/{name}", http.StatusBadRequest)
+		return
+	}
+
+	tree, err := lbc.ownershipTree(parts[0], parts[1])
+	if errors.IsNotFound(err) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	tree.print(buf, 0)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// ownershipTree assembles deployments -> replicasets -> pods, configmaps,
+// services and labeled nodes of the loadbalancer
+func (lbc *LoadBalancerController) ownershipTree(namespace, name string) (*ownershipNode, error) {
+	lb, err := lbc.lbLister.LoadBalancers(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &ownershipNode{kind: "LoadBalancer", name: namespace + "/" + name}
+	if lb.DeletionTimestamp != nil {
+		root.detail = "deleting, finalizers: " + strings.Join(lb.Finalizers, ",")
+	}
+
+	selector := labels.Set{
+		netv1alpha1.LabelKeyCreatedBy: fmt.Sprintf(netv1alpha1.LabelValueFormatCreateby, lb.Namespace, lb.Name),
+	}.AsSelector()
+
+	// deployments -> replicasets -> pods
+	ds, err := lbc.dLister.Deployments(namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	rss, err := lbc.rsLister.ReplicaSets(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	pods, err := lbc.podLister.Pods(namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i].Name < ds[j].Name })
+	for _, d := range ds {
+		dNode := root.add(&ownershipNode{
+			kind:   "Deployment",
+			name:   d.Name,
+			detail: fmt.Sprintf("%s, replicas %d/%d", ownerDetail(lb.UID, controller.GetControllerOf(d)), d.Status.AvailableReplicas, *d.Spec.Replicas),
+		})
+		for _, rs := range rss {
+			if ref := controller.GetControllerOf(rs); ref == nil || ref.UID != d.UID {
+				continue
+			}
+			rsNode := dNode.add(&ownershipNode{
+				kind:   "ReplicaSet",
+				name:   rs.Name,
+				detail: fmt.Sprintf("replicas %d/%d", rs.Status.ReadyReplicas, *rs.Spec.Replicas),
+			})
+			for _, pod := range pods {
+				if ref := controller.GetControllerOf(pod); ref == nil || ref.UID != rs.UID {
+					continue
+				}
+				status := lbutil.ComputePodStatus(pod)
+				rsNode.add(&ownershipNode{
+					kind:   "Pod",
+					name:   pod.Name,
+					detail: fmt.Sprintf("%s, node %s", status.Reason, pod.Spec.NodeName),
+				})
+			}
+		}
+	}
+
+	cms, err := lbc.cmLister.ConfigMaps(namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, cm := range cms {
+		root.add(&ownershipNode{kind: "ConfigMap", name: cm.Name, detail: ownerDetail(lb.UID, controller.GetControllerOf(cm))})
+	}
+
+	svcs, err := lbc.svcLister.Services(namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range svcs {
+		root.add(&ownershipNode{kind: "Service", name: svc.Name, detail: ownerDetail(lb.UID, controller.GetControllerOf(svc))})
+	}
+
+	nodes, err := lbc.getNodesForLoadBalancer(lb)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		root.add(&ownershipNode{kind: "Node", name: node.Name, detail: "labeled, " + lbutil.GetNodeInternalIP(node)})
+	}
+
+	return root, nil
+}
+
+// ownerDetail describes whether the object is controlled by the loadbalancer
+func ownerDetail(uid types.UID, ref *metav1.OwnerReference) string {
+	switch {
+	case ref == nil:
+		return "orphan"
+	case ref.UID != uid:
+		return fmt.Sprintf("controlled by %s %s", ref.Kind, ref.Name)
+	default:
+		return "controlled"
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/labels"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// keys of the quota ConfigMap overriding the flags
+	quotaKeyCluster         = "cluster"
+	quotaKeyNamespace       = "namespace"
+	quotaKeyNamespacePrefix = "namespace."
+
+	reasonNamespaceQuotaExceeded = "NamespaceQuotaExceeded"
+	reasonClusterQuotaExceeded   = "ClusterQuotaExceeded"
+)
+
+// quotaLimits returns the max number of loadbalancers in namespace and in
+// cluster, 0 means unlimited. The values in quota ConfigMap override flags
+func (lbc *LoadBalancerController) quotaLimits(namespace string) (int, int) {
+	nsLimit, clusterLimit := lbc.quota.Namespace, lbc.quota.Cluster
+	if lbc.quota.ConfigMap == "" {
+		return nsLimit, clusterLimit
+	}
+
+	cmNamespace, cmName, _ := cache.SplitMetaNamespaceKey(lbc.quota.ConfigMap)
+	cm, err := lbc.cmLister.ConfigMaps(cmNamespace).Get(cmName)
+	if err != nil {
+		// fall back to flags
+		return nsLimit, clusterLimit
+	}
+
+	parse := func(key string, value *int) {
+		s, ok := cm.Data[key]
+		if !ok {
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 0 {
+			log.Warn("Invalid quota in ConfigMap, ignore it", log.Fields{"cm": lbc.quota.ConfigMap, "key": key, "value": s})
+			return
+		}
+		*value = n
+	}
+	parse(quotaKeyCluster, &clusterLimit)
+	parse(quotaKeyNamespace, &nsLimit)
+	parse(quotaKeyNamespacePrefix+namespace, &nsLimit)
+	return nsLimit, clusterLimit
+}
+
+// quotaEnabled returns true if any quota is configured
+func (lbc *LoadBalancerController) quotaEnabled() bool {
+	return lbc.quota.Namespace > 0 || lbc.quota.Cluster > 0 || lbc.quota.ConfigMap != ""
+}
+
+// checkQuota admits the loadbalancers oldest first until the quota of their
+// namespace or cluster is used up, so that the existing ones are never
+// blocked by new ones. It returns the reason and message if lb is not admitted
+func (lbc *LoadBalancerController) checkQuota(lb *netv1alpha1.LoadBalancer) (string, string, error) {
+	lbs, err := lbc.lbLister.List(labels.Everything())
+	if err != nil {
+		return "", "", err
+	}
+	active := make([]*netv1alpha1.LoadBalancer, 0, len(lbs))
+	for _, l := range lbs {
+		if l.DeletionTimestamp == nil {
+			active = append(active, l)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		ti, tj := active[i].CreationTimestamp, active[j].CreationTimestamp
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		ki, _ := controllerutil.KeyFunc(active[i])
+		kj, _ := controllerutil.KeyFunc(active[j])
+		return ki < kj
+	})
+
+	_, clusterLimit := lbc.quotaLimits("")
+	limits := make(map[string]int)
+	namespaces := make(map[string]int)
+	cluster := 0
+	for _, l := range active {
+		nsLimit, ok := limits[l.Namespace]
+		if !ok {
+			nsLimit, _ = lbc.quotaLimits(l.Namespace)
+			limits[l.Namespace] = nsLimit
+		}
+
+		var reason, message string
+		switch {
+		case nsLimit > 0 && namespaces[l.Namespace] >= nsLimit:
+			reason = reasonNamespaceQuotaExceeded
+			message = fmt.Sprintf("namespace %s has used up its quota of %d loadbalancers", l.Namespace, nsLimit)
+		case clusterLimit > 0 && cluster >= clusterLimit:
+			reason = reasonClusterQuotaExceeded
+			message = fmt.Sprintf("cluster has used up its quota of %d loadbalancers", clusterLimit)
+		default:
+			namespaces[l.Namespace]++
+			cluster++
+		}
+		if l.UID == lb.UID {
+			return reason, message, nil
+		}
+	}
+	// lb is not in cache yet, it is admitted after it is observed
+	return "", "", nil
+}
+
+// admitQuota updates the QuotaExceeded condition of lb, false is returned if
+// lb exceeds the quota or the update of condition will trigger another sync
+func (lbc *LoadBalancerController) admitQuota(lb *netv1alpha1.LoadBalancer) (bool, error) {
+	if !lbc.quotaEnabled() {
+		if lbutil.GetCondition(lb.Status, netv1alpha1.LoadBalancerQuotaExceeded) == nil {
+			return true, nil
+		}
+		// quota has been disabled
+		err := lbutil.RemoveConditions(lbc.tprClient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, netv1alpha1.LoadBalancerQuotaExceeded)
+		if err != nil {
+			return false, err
+		}
+		return !lbutil.IsQuotaExceeded(lb), nil
+	}
+
+	reason, message, err := lbc.checkQuota(lb)
+	if err != nil {
+		return false, err
+	}
+	exceeded := lbutil.IsQuotaExceeded(lb)
+
+	if reason == "" {
+		if !exceeded {
+			return true, nil
+		}
+		log.Info("LoadBalancer is admitted by quota", log.Fields{"lb.name": lb.Name, "lb.ns": lb.Namespace})
+		condition := lbutil.NewCondition(netv1alpha1.LoadBalancerQuotaExceeded, apiv1.ConditionFalse, "WithinQuota", "")
+		// plugins must observe the condition before they are synced
+		return false, lbutil.UpdateConditions(lbc.tprClient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, condition)
+	}
+
+	if !exceeded {
+		log.Warn("LoadBalancer exceeds quota, skip reconciling", log.Fields{"lb.name": lb.Name, "lb.ns": lb.Namespace, "reason": reason})
+		lbc.recorder.Eventf(lb, apiv1.EventTypeWarning, lbutil.EventReasonQuotaExceeded, "Not reconciled: %s", message)
+	}
+	condition := lbutil.NewCondition(netv1alpha1.LoadBalancerQuotaExceeded, apiv1.ConditionTrue, reason, message)
+	return false, lbutil.UpdateConditions(lbc.tprClient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, condition)
+}
+
+// enqueueQuotaExceeded enqueues the loadbalancers exceeding quota, they may
+// be admitted after a loadbalancer is deleted or the quota is changed
+func (lbc *LoadBalancerController) enqueueQuotaExceeded() {
+	if !lbc.quotaEnabled() {
+		return
+	}
+	lbs, err := lbc.lbLister.List(labels.Everything())
+	if err != nil {
+		return
+	}
+	for _, lb := range lbs {
+		if lbutil.IsQuotaExceeded(lb) {
+			lbc.helper.Enqueue(lb)
+		}
+	}
+}
+
+// updateQuotaConfigMap enqueues all loadbalancers when the quota ConfigMap
+// changes, the lowered quota blocks the newest ones
+func (lbc *LoadBalancerController) updateQuotaConfigMap(obj interface{}) {
+	cm, ok := obj.(*apiv1.ConfigMap)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			return
+		}
+		if cm, ok = tombstone.Obj.(*apiv1.ConfigMap); !ok {
+			return
+		}
+	}
+	if key, _ := controllerutil.KeyFunc(cm); key != lbc.quota.ConfigMap {
+		return
+	}
+
+	log.Info("Quota ConfigMap changed, resync loadbalancers", log.Fields{"cm": lbc.quota.ConfigMap})
+	lbs, err := lbc.lbLister.List(labels.Everything())
+	if err != nil {
+		return
+	}
+	for _, lb := range lbs {
+		lbc.helper.Enqueue(lb)
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+	"github.com/caicloud/loadbalancer-controller/provider"
+	"github.com/caicloud/loadbalancer-controller/proxy"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// resyncSchedule schedules periodic resyncs of loadbalancers. Each of them is
+// resynced at a fixed offset in the period derived from the hash of its key,
+// so that the resyncs are smeared across the period instead of bursting
+type resyncSchedule struct {
+	period time.Duration
+
+	lock sync.Mutex
+	// next is keyed by loadbalancer key
+	next map[string]time.Time
+}
+
+func newResyncSchedule(period time.Duration) *resyncSchedule {
+	return &resyncSchedule{
+		period: period,
+		next:   make(map[string]time.Time),
+	}
+}
+
+// offset returns the deterministic offset of key in the period
+func (r *resyncSchedule) offset(key string) time.Duration {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return time.Duration(uint64(h.Sum32()) * uint64(r.period) >> 32)
+}
+
+// schedule returns the delay to the next resync of key after now, false is
+// returned if the next resync has been scheduled
+func (r *resyncSchedule) schedule(key string, now time.Time) (time.Duration, bool) {
+	offset := r.offset(key)
+	slot := now.Add(-offset).Truncate(r.period).Add(offset)
+	if !slot.After(now) {
+		slot = slot.Add(r.period)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.next[key].Equal(slot) {
+		return 0, false
+	}
+	r.next[key] = slot
+	return slot.Sub(now), true
+}
+
+// forget removes the schedule of key
+func (r *resyncSchedule) forget(key string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.next, key)
+}
+
+// scheduleResync enqueues lb at its next resync time
+func (lbc *LoadBalancerController) scheduleResync(lb *netv1alpha1.LoadBalancer) {
+	if lbc.resync == nil {
+		return
+	}
+	key, _ := controllerutil.KeyFunc(lb)
+	if after, ok := lbc.resync.schedule(key, time.Now()); ok {
+		lbc.helper.EnqueueAfter(lb, after)
+	}
+}
+
+// ForceResync re-reconciles the loadbalancer by controller and all the
+// plugins immediately, regardless of the periodic resync
+func (lbc *LoadBalancerController) ForceResync(namespace, name string) error {
+	lb, err := lbc.lbLister.LoadBalancers(namespace).Get(name)
+	if err != nil {
+		return err
+	}
+	log.Info("Force resyncing loadbalancer", log.Fields{"lb.ns": namespace, "lb.name": name})
+	lbc.helper.Enqueue(lb)
+	if err := proxy.ForceResync(namespace, name); err != nil {
+		return err
+	}
+	return provider.ForceResync(namespace, name)
+}
+
+// ServeForceResync re-reconciles the loadbalancer requested by
+// POST /admin/resync/{namespace}/{name} of the admin server
+func (lbc *LoadBalancerController) ServeForceResync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "expect POST", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/resync"), "/"), "/")
+	if len(parts) != 2 {
+		http.Error(w, "expect /admin/resync/{namespace}/{name}", http.StatusBadRequest)
+		return
+	}
+
+	err := lbc.ForceResync(parts[0], parts[1])
+	if errors.IsNotFound(err) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ServeResync prints the next resync time of loadbalancers on /debug/resync
+func (lbc *LoadBalancerController) ServeResync(w http.ResponseWriter, r *http.Request) {
+	next := make(map[string]time.Time)
+	if lbc.resync != nil {
+		lbc.resync.lock.Lock()
+		for key, t := range lbc.resync.next {
+			next[key] = t
+		}
+		lbc.resync.lock.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(next)
+}
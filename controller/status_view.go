@@ -0,0 +1,201 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func (lbc *LoadBalancerController) enqueueStatusView(lb *netv1alpha1.LoadBalancer) {
+	if !lbc.statusView {
+		return
+	}
+	lbc.viewHelper.Enqueue(lb)
+}
+
+// syncStatusView mirrors the trimmed status of loadbalancer into the tenant
+// namespaces, and deletes the stale views. Only the loadbalancers in the
+// configured source namespaces are mirrored, and only the views created from
+// the loadbalancer are touched
+func (lbc *LoadBalancerController) syncStatusView(obj interface{}) error {
+	lb, ok := obj.(*netv1alpha1.LoadBalancer)
+	if !ok {
+		return fmt.Errorf("expect loadbalancer, got %v", obj)
+	}
+	if !lbutil.IsOwned(lb) {
+		return nil
+	}
+
+	tenants := sets.NewString()
+	nlb, err := lbc.lbLister.LoadBalancers(lb.Namespace).Get(lb.Name)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && nlb.UID == lb.UID && nlb.DeletionTimestamp == nil {
+		lb = nlb
+		if lbc.viewSources.Has(lb.Namespace) {
+			tenants = tenantNamespaces(lb)
+		}
+	}
+
+	// the views are planned but not written in dry run mode
+	dryRun := lbutil.IsDryRun(lb)
+	views := lbc.tprClient.NetworkingV1alpha1()
+	viewName := fmt.Sprintf(netv1alpha1.LabelValueFormatCreateby, lb.Namespace, lb.Name)
+	desired := generateStatusView(lb)
+
+	// delete the stale views
+	selector := labels.Set{
+		netv1alpha1.LabelKeyCreatedBy: viewName,
+	}
+	existing, err := views.LoadBalancerStatusViews(metav1.NamespaceAll).List(metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, view := range existing.Items {
+		if tenants.Has(view.Namespace) || !mirroredFrom(&view, lb) {
+			continue
+		}
+		if dryRun {
+			log.Info("Dry run, would delete stale LoadBalancerStatusView", log.Fields{"view.ns": view.Namespace, "view.name": view.Name})
+			continue
+		}
+		log.Info("Delete stale LoadBalancerStatusView", log.Fields{"view.ns": view.Namespace, "view.name": view.Name})
+		err := views.LoadBalancerStatusViews(view.Namespace).Delete(view.Name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	// ensure views in tenant namespaces
+	for _, ns := range tenants.List() {
+		view, err := views.LoadBalancerStatusViews(ns).Get(viewName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			if dryRun {
+				log.Info("Dry run, would create LoadBalancerStatusView", log.Fields{"view.ns": ns, "view.name": viewName})
+				continue
+			}
+			view = desired
+			view.Namespace = ns
+			log.Info("Create LoadBalancerStatusView", log.Fields{"view.ns": ns, "view.name": viewName})
+			if _, err := views.LoadBalancerStatusViews(ns).Create(view); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !mirroredFrom(view, lb) {
+			log.Warn("LoadBalancerStatusView is not mirrored from loadbalancer, skip it", log.Fields{"view.ns": ns, "view.name": viewName, "lb.ns": lb.Namespace, "lb.name": lb.Name})
+			continue
+		}
+
+		if reflect.DeepEqual(view.Status, desired.Status) {
+			continue
+		}
+		if dryRun {
+			log.Info("Dry run, would update LoadBalancerStatusView", log.Fields{"view.ns": ns, "view.name": viewName})
+			continue
+		}
+		view.Labels = desired.Labels
+		view.Status = desired.Status
+		log.Info("Update LoadBalancerStatusView", log.Fields{"view.ns": ns, "view.name": viewName})
+		if _, err := views.LoadBalancerStatusViews(ns).Update(view); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mirroredFrom returns true if view is created by controller from lb
+func mirroredFrom(view *netv1alpha1.LoadBalancerStatusView, lb *netv1alpha1.LoadBalancer) bool {
+	return view.Annotations[netv1alpha1.AnnotationKeySourceUID] == string(lb.UID)
+}
+
+// tenantNamespaces returns the namespaces listed in lb's annotation
+func tenantNamespaces(lb *netv1alpha1.LoadBalancer) sets.String {
+	tenants := sets.NewString()
+	for _, ns := range strings.Split(lb.Annotations[netv1alpha1.AnnotationKeyTenantNamespaces], ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" || ns == lb.Namespace {
+			continue
+		}
+		tenants.Insert(ns)
+	}
+	return tenants
+}
+
+func generateStatusView(lb *netv1alpha1.LoadBalancer) *netv1alpha1.LoadBalancerStatusView {
+	createdBy := fmt.Sprintf(netv1alpha1.LabelValueFormatCreateby, lb.Namespace, lb.Name)
+
+	view := &netv1alpha1.LoadBalancerStatusView{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: netv1alpha1.SchemeGroupVersion.String(),
+			Kind:       netv1alpha1.LoadBalancerStatusViewKind,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: createdBy,
+			Labels: map[string]string{
+				netv1alpha1.LabelKeyCreatedBy: createdBy,
+			},
+			Annotations: map[string]string{
+				netv1alpha1.AnnotationKeySourceUID: string(lb.UID),
+			},
+		},
+		Status: netv1alpha1.LoadBalancerStatusViewStatus{
+			Namespace:          lb.Namespace,
+			Name:               lb.Name,
+			Type:               lb.Spec.Type,
+			IngressClass:       lb.Status.ProxyStatus.IngressClass,
+			ProxyReplicas:      lb.Status.ProxyStatus.Replicas,
+			ProxyReadyReplicas: lb.Status.ProxyStatus.ReadyReplicas,
+		},
+	}
+
+	providers := lb.Status.ProvidersStatuses
+	if providers.Ipvsdr != nil && providers.Ipvsdr.Vip != "" {
+		view.Status.Addresses = append(view.Status.Addresses, providers.Ipvsdr.Vip)
+		for _, s := range providers.Ipvsdr.Vips {
+			if s.Vip != providers.Ipvsdr.Vip {
+				view.Status.Addresses = append(view.Status.Addresses, s.Vip)
+			}
+		}
+	}
+	if providers.Azure != nil && providers.Azure.ExternalIP != "" {
+		view.Status.Addresses = append(view.Status.Addresses, providers.Azure.ExternalIP)
+	}
+	if providers.GCE != nil && providers.GCE.ExternalIP != "" {
+		view.Status.Addresses = append(view.Status.Addresses, providers.GCE.ExternalIP)
+	}
+
+	return view
+}
@@ -20,8 +20,9 @@ import (
 	"fmt"
 
 	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
-	"github.com/caicloud/loadbalancer-controller/pkg/util/validation"
-	log "github.com/zoumo/logdog"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+	stringsutil "github.com/caicloud/loadbalancer-controller/pkg/util/strings"
 	apiv1 "k8s.io/client-go/pkg/api/v1"
 )
 
@@ -33,13 +34,9 @@ type VerifiedNodes struct {
 	Labels         map[string]string
 }
 
+// getVerifiedNodes computes the nodes of lb with their labels and taints, the
+// spec has been validated by syncLoadBalancer unless lb is being deleted
 func (lbc *LoadBalancerController) getVerifiedNodes(lb *netv1alpha1.LoadBalancer) (*VerifiedNodes, error) {
-
-	err := validation.ValidateLoadBalancer(lb)
-	if err != nil {
-		return nil, err
-	}
-
 	ran := &VerifiedNodes{
 		TaintsToAdd:    []apiv1.Taint{},
 		TaintsToDelete: []apiv1.Taint{},
@@ -51,7 +48,7 @@ func (lbc *LoadBalancerController) getVerifiedNodes(lb *netv1alpha1.LoadBalancer
 		fmt.Sprintf(netv1alpha1.UniqueLabelKeyFormat, lb.Namespace, lb.Name): "true",
 	}
 
-	if len(lb.Spec.Nodes.Names) == 0 {
+	if len(lbutil.NodeNames(lb)) == 0 {
 		// if Nodes is not fill in, we should delete taint by key
 		// no matter what effect it is
 		ran.TaintsToDelete = append(ran.TaintsToDelete, apiv1.Taint{
@@ -76,8 +73,25 @@ func (lbc *LoadBalancerController) getVerifiedNodes(lb *netv1alpha1.LoadBalancer
 			})
 		}
 
+		names := lbutil.ActiveNodeNames(lb)
+		surge := []string{}
+		for _, name := range names {
+			if !stringsutil.StringInSlice(name, lbutil.NodeNames(lb)) {
+				surge = append(surge, name)
+			}
+		}
+		if len(surge) != 0 {
+			log.Info("Surge replicas onto standby nodes for maintenance or unready nodes", log.Fields{
+				"lb.name":     lb.Name,
+				"lb.ns":       lb.Namespace,
+				"maintenance": lb.Spec.Nodes.Maintenance,
+				"unready":     lb.Status.Nodes.Unready,
+				"surge":       surge,
+			})
+		}
+
 		// get valid nodes
-		for _, name := range lb.Spec.Nodes.Names {
+		for _, name := range names {
 			// get node
 			node, err := lbc.nodeLister.Get(name)
 			if err != nil {
@@ -0,0 +1,128 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package admin serves the endpoints changing the state of controller, e.g.
+// bulk operations and takeovers of loadbalancers. Every request is
+// authenticated by a TokenReview of its bearer token and authorized by a
+// SubjectAccessReview of its path, so access is granted by RBAC rules of
+// nonResourceURLs, e.g. verb post on /admin/*
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	"k8s.io/client-go/kubernetes"
+	authenticationv1 "k8s.io/client-go/pkg/apis/authentication/v1"
+	authorizationv1 "k8s.io/client-go/pkg/apis/authorization/v1"
+)
+
+// Prefix is the prefix of paths of admin endpoints
+const Prefix = "/admin/"
+
+// ServeMux is a mux serving admin endpoints to the authorized users only
+type ServeMux struct {
+	client kubernetes.Interface
+	mux    *http.ServeMux
+}
+
+// NewServeMux returns a mux reviewing the tokens and accesses of requests by client
+func NewServeMux(client kubernetes.Interface) *ServeMux {
+	return &ServeMux{
+		client: client,
+		mux:    http.NewServeMux(),
+	}
+}
+
+// HandleFunc registers the handler for the pattern, which must be under Prefix
+func (m *ServeMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	if !strings.HasPrefix(pattern, Prefix) {
+		panic(fmt.Sprintf("admin endpoint %s is not under %s", pattern, Prefix))
+	}
+	m.mux.HandleFunc(pattern, handler)
+}
+
+// ServeHTTP serves the request if the user is allowed to access its path
+func (m *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		http.Error(w, "expect a bearer token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := m.authenticate(token)
+	if err != nil {
+		log.Warn("Authenticate admin request error", log.Fields{"path": r.URL.Path, "err": err})
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	allowed, err := m.authorize(user, r)
+	if err != nil {
+		log.Warn("Authorize admin request error", log.Fields{"path": r.URL.Path, "user": user.Username, "err": err})
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if !allowed {
+		log.Warn("Admin request is forbidden", log.Fields{"path": r.URL.Path, "method": r.Method, "user": user.Username})
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	log.Info("Serve admin request", log.Fields{"path": r.URL.Path, "method": r.Method, "user": user.Username})
+	m.mux.ServeHTTP(w, r)
+}
+
+// authenticate returns the user of token
+func (m *ServeMux) authenticate(token string) (authenticationv1.UserInfo, error) {
+	review, err := m.client.AuthenticationV1().TokenReviews().Create(&authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	})
+	if err != nil {
+		return authenticationv1.UserInfo{}, err
+	}
+	if !review.Status.Authenticated {
+		return authenticationv1.UserInfo{}, fmt.Errorf("token is not authenticated: %s", review.Status.Error)
+	}
+	return review.Status.User, nil
+}
+
+// authorize returns true if user is allowed to access the path of request
+// with the verb of its method in lower case, e.g. post
+func (m *ServeMux) authorize(user authenticationv1.UserInfo, r *http.Request) (bool, error) {
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review, err := m.client.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			Groups: user.Groups,
+			Extra:  extra,
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+				Path: r.URL.Path,
+				Verb: strings.ToLower(r.Method),
+			},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
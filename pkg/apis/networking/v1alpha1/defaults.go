@@ -0,0 +1,109 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
+)
+
+// DefaultProxyUser is the UID of non-root proxy, the www-data user of nginx
+// ingress controller image
+const DefaultProxyUser int64 = 101
+
+// DefaultIpvsdrMetricsPort is the port of ipvs exporter in provider pods
+const DefaultIpvsdrMetricsPort int32 = 9110
+
+// SetLoadBalancerDefaults fills in the defaults of LoadBalancer spec, so that
+// a minimal manifest can be resolved to the full spec
+func SetLoadBalancerDefaults(lb *LoadBalancer) {
+	spec := &lb.Spec
+
+	if spec.Type == "" {
+		spec.Type = LoadBalancerTypeExternal
+		if spec.Providers.Service != nil {
+			spec.Type = LoadBalancerTypeInternal
+		}
+	}
+
+	if spec.Nodes.Replicas == nil && len(spec.Nodes.Names) == 0 && (spec.Type == LoadBalancerTypeInternal || len(spec.Nodes.Selector) != 0) {
+		replicas := int32(1)
+		spec.Nodes.Replicas = &replicas
+	}
+
+	if spec.Autoscaling != nil && spec.Autoscaling.MinReplicas == nil {
+		minReplicas := int32(1)
+		spec.Autoscaling.MinReplicas = &minReplicas
+	}
+
+	if spec.DeployMode == "" {
+		spec.DeployMode = DeployModeDeployment
+	}
+
+	if spec.Proxy.Type == "" {
+		spec.Proxy.Type = ProxyTypeNginx
+	}
+
+	if spec.Proxy.IngressClass == "" {
+		spec.Proxy.IngressClass = fmt.Sprintf(LabelValueFormatCreateby, lb.Namespace, lb.Name)
+	}
+
+	if sc := spec.Proxy.SecurityContext; sc != nil && sc.RunAsNonRoot {
+		if sc.RunAsUser == nil {
+			uid := DefaultProxyUser
+			sc.RunAsUser = &uid
+		}
+		if sc.NetBindService == nil {
+			netBindService := true
+			sc.NetBindService = &netBindService
+		}
+	}
+
+	if spec.Proxy.NetworkMode == "" {
+		spec.Proxy.NetworkMode = NetworkModePod
+		if spec.Type == LoadBalancerTypeExternal {
+			spec.Proxy.NetworkMode = NetworkModeHost
+		}
+	}
+
+	if ipvsdr := spec.Providers.Ipvsdr; ipvsdr != nil {
+		if ipvsdr.Scheduler == "" {
+			ipvsdr.Scheduler = IpvsSchedulerRR
+		}
+		if ipvsdr.NetworkMode == "" {
+			ipvsdr.NetworkMode = NetworkModeHost
+		}
+		for i := range ipvsdr.Ports {
+			if ipvsdr.Ports[i].Protocol == "" {
+				ipvsdr.Ports[i].Protocol = apiv1.ProtocolTCP
+			}
+		}
+		if len(ipvsdr.Resources.Limits) == 0 && len(ipvsdr.Resources.Requests) == 0 {
+			ipvsdr.Resources = apiv1.ResourceRequirements{
+				Limits: apiv1.ResourceList{
+					apiv1.ResourceCPU:    resource.MustParse("200m"),
+					apiv1.ResourceMemory: resource.MustParse("50Mi"),
+				},
+			}
+		}
+		if ipvsdr.Metrics != nil && ipvsdr.Metrics.Port == 0 {
+			ipvsdr.Metrics.Port = DefaultIpvsdrMetricsPort
+		}
+	}
+}
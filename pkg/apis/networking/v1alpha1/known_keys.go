@@ -23,6 +23,11 @@ var (
 	// loadbalancer.net.alpha.caicloud.io/proxy
 	LabelKeyProxy = fmt.Sprintf("%s.%s/%s", LoadBalancerName, AlphaGroupName, "proxy")
 
+	// LabelKeyProxyColor is the color of proxy pods in blue/green deployment,
+	// the Service of cloud providers selects the pods of the active one
+	// loadbalancer.net.alpha.caicloud.io/proxy-color
+	LabelKeyProxyColor = fmt.Sprintf("%s.%s/%s", LoadBalancerName, AlphaGroupName, "proxy-color")
+
 	// LabelKeyProvider for all loadbalancer providers
 	// loadbalancer.net.alpha.caicloud.io/provider
 	LabelKeyProvider = fmt.Sprintf("%s.%s/%s", LoadBalancerName, AlphaGroupName, "provider")
@@ -32,6 +37,16 @@ var (
 	// LabelValueFormatCreateby - namespace.name
 	LabelValueFormatCreateby = "%s.%s"
 
+	// LabelKeyVersion is the version of labeling scheme of the objects generated
+	// for loadbalancers, the objects are relabeled when it is bumped
+	// loadbalancer.net.alpha.caicloud.io/label-version
+	LabelKeyVersion = fmt.Sprintf("%s.%s/label-version", LoadBalancerName, AlphaGroupName)
+
+	// LabelKeyRevision is the number of the revision of spec recorded in a
+	// ConfigMap, it is bumped when an older revision is applied again
+	// loadbalancer.net.alpha.caicloud.io/revision
+	LabelKeyRevision = fmt.Sprintf("%s.%s/revision", LoadBalancerName, AlphaGroupName)
+
 	// UniqueLabelKeyFormat ...
 	// loadbalancer.net.alpha.caicloud.io/namespace.name
 	UniqueLabelKeyFormat = LoadBalancerName + "." + AlphaGroupName + "/" + "%s.%s"
@@ -41,4 +56,161 @@ var (
 	TaintKey = fmt.Sprintf("%s.%s/dedicated", LoadBalancerName, AlphaGroupName)
 	// TaintValueFormat - namespace.name
 	TaintValueFormat = "%s.%s"
+
+	// AnnotationKeyNodeAddresses records the addresses of nodes selected by loadbalancer
+	// in pod template, pods will be recreated to reload config when the addresses changed
+	// loadbalancer.net.alpha.caicloud.io/node-addresses
+	AnnotationKeyNodeAddresses = fmt.Sprintf("%s.%s/node-addresses", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyTenantNamespaces is a comma separated list of namespaces
+	// which the LoadBalancerStatusView will be mirrored into
+	// loadbalancer.net.alpha.caicloud.io/tenant-namespaces
+	AnnotationKeyTenantNamespaces = fmt.Sprintf("%s.%s/tenant-namespaces", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeySourceUID records the uid of loadbalancer on the
+	// LoadBalancerStatusViews mirrored from it, the views without it are
+	// not created by controller and never touched
+	// loadbalancer.net.alpha.caicloud.io/source-uid
+	AnnotationKeySourceUID = fmt.Sprintf("%s.%s/source-uid", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyAllocatedVip records the vip allocated from pools automatically
+	// loadbalancer.net.alpha.caicloud.io/allocated-vip
+	AnnotationKeyAllocatedVip = fmt.Sprintf("%s.%s/allocated-vip", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyProbedVip records the vip probed by an arp probe job
+	// loadbalancer.net.alpha.caicloud.io/probed-vip
+	AnnotationKeyProbedVip = fmt.Sprintf("%s.%s/probed-vip", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyManagedPorts is a comma separated list of ports written into
+	// tcp and udp services ConfigMaps of proxy by the controller, the other ports
+	// in ConfigMaps are left untouched
+	// loadbalancer.net.alpha.caicloud.io/managed-ports
+	AnnotationKeyManagedPorts = fmt.Sprintf("%s.%s/managed-ports", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyCanary marks the loadbalancer as canary with value "true",
+	// which receives the canary images of plugins first
+	// loadbalancer.net.alpha.caicloud.io/canary
+	AnnotationKeyCanary = fmt.Sprintf("%s.%s/canary", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyPaused marks the loadbalancer as paused with value "true",
+	// the controller and plugins stop reconciling it except the deletion
+	// loadbalancer.net.alpha.caicloud.io/paused
+	AnnotationKeyPaused = fmt.Sprintf("%s.%s/paused", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyDryRun marks the loadbalancer as dry run with value "true",
+	// the plugins log and record the changes they would make instead of writing
+	// loadbalancer.net.alpha.caicloud.io/dry-run
+	AnnotationKeyDryRun = fmt.Sprintf("%s.%s/dry-run", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyController is the identity of the controller owning the
+	// loadbalancer, the other controllers do not reconcile it
+	// loadbalancer.net.alpha.caicloud.io/controller
+	AnnotationKeyController = fmt.Sprintf("%s.%s/controller", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyHandoff is the identity of the controller requesting to take
+	// over the loadbalancer, the owner releases it after the current sync
+	// loadbalancer.net.alpha.caicloud.io/handoff-to
+	AnnotationKeyHandoff = fmt.Sprintf("%s.%s/handoff-to", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyVRRPState is published on provider pods by the provider
+	// container with the VRRP state of the instance, MASTER, BACKUP or FAULT
+	// loadbalancer.net.alpha.caicloud.io/vrrp-state
+	AnnotationKeyVRRPState = fmt.Sprintf("%s.%s/vrrp-state", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyActiveConnections is published on provider pods by the provider
+	// container with the number of active IPVS connections on the vip
+	// loadbalancer.net.alpha.caicloud.io/active-connections
+	AnnotationKeyActiveConnections = fmt.Sprintf("%s.%s/active-connections", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyInactiveConnections is published on provider pods by the provider
+	// container with the number of inactive IPVS connections on the vip
+	// loadbalancer.net.alpha.caicloud.io/inactive-connections
+	AnnotationKeyInactiveConnections = fmt.Sprintf("%s.%s/inactive-connections", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyLastHealthCheck is published on provider pods by the provider
+	// container with the RFC3339 time it last checked the backends
+	// loadbalancer.net.alpha.caicloud.io/last-health-check
+	AnnotationKeyLastHealthCheck = fmt.Sprintf("%s.%s/last-health-check", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyDSCP is published on provider pods by the provider container
+	// with the DSCP mark applied on the traffic egressing the vips, it is
+	// removed when the traffic is no longer marked
+	// loadbalancer.net.alpha.caicloud.io/dscp
+	AnnotationKeyDSCP = fmt.Sprintf("%s.%s/dscp", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyDataplaneBackend is published on provider pods by the
+	// provider container with the netfilter backend in use, iptables or nftables
+	// loadbalancer.net.alpha.caicloud.io/dataplane-backend
+	AnnotationKeyDataplaneBackend = fmt.Sprintf("%s.%s/dataplane-backend", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyDataplaneCapabilities is published on provider pods by the
+	// provider container with a comma separated list of netfilter backends
+	// supported by the kernel of node
+	// loadbalancer.net.alpha.caicloud.io/dataplane-capabilities
+	AnnotationKeyDataplaneCapabilities = fmt.Sprintf("%s.%s/dataplane-capabilities", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyRollbackTo rolls the spec generating the workloads of
+	// loadbalancer back to the revision, 0 means the previous one. It is
+	// removed once the rollback is done
+	// loadbalancer.net.alpha.caicloud.io/rollback-to
+	AnnotationKeyRollbackTo = fmt.Sprintf("%s.%s/rollback-to", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyTLSChecksum is set on the pod template of proxy with the
+	// checksum of certificates mounted into it, the pods are rolled to
+	// reload the certificates when they are rotated
+	// loadbalancer.net.alpha.caicloud.io/tls-checksum
+	AnnotationKeyTLSChecksum = fmt.Sprintf("%s.%s/tls-checksum", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyWAFChecksum is set on the pod template of proxy with the
+	// checksum of custom WAF rules mounted into it, the pods are rolled to
+	// reload the rules when they are changed
+	// loadbalancer.net.alpha.caicloud.io/waf-checksum
+	AnnotationKeyWAFChecksum = fmt.Sprintf("%s.%s/waf-checksum", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyPriorityClass is set on the pod template with the priority
+	// class of pods, which is written into the pod spec along with the template
+	// loadbalancer.net.alpha.caicloud.io/priority-class
+	AnnotationKeyPriorityClass = fmt.Sprintf("%s.%s/priority-class", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyNodeWeight is set on nodes with the weight of node as real
+	// server of ipvsdr providers, the weights in spec of loadbalancer override it
+	// loadbalancer.net.alpha.caicloud.io/weight
+	AnnotationKeyNodeWeight = fmt.Sprintf("%s.%s/weight", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyManagedEntries is set on the workloads of plugins with the
+	// names of containers, init containers and volumes rendered by the plugin,
+	// the other ones are added by other actors and kept by patches
+	// loadbalancer.net.alpha.caicloud.io/managed-entries
+	AnnotationKeyManagedEntries = fmt.Sprintf("%s.%s/managed-entries", LoadBalancerName, AlphaGroupName)
+
+	// AnnotationKeyExternalReplicas is set on the deployment of a plugin by
+	// users with value "true" if its replicas are managed by another actor,
+	// e.g. a HorizontalPodAutoscaler, plugins do not correct them then
+	// loadbalancer.net.alpha.caicloud.io/external-replicas
+	AnnotationKeyExternalReplicas = fmt.Sprintf("%s.%s/external-replicas", LoadBalancerName, AlphaGroupName)
+
+	// FinalizerFormat is the format of finalizers added to loadbalancer by controller
+	// and plugins, deletion is blocked until they clean up their resources
+	// loadbalancer.net.alpha.caicloud.io/ipvsdr
+	FinalizerFormat = LoadBalancerName + "." + AlphaGroupName + "/" + "%s"
+)
+
+// Recommended labels of kubernetes set on the objects generated for loadbalancers,
+// they are never used in selectors which are immutable
+const (
+	// LabelKeyAppName is the name of application, always LabelValueAppName
+	LabelKeyAppName = "app.kubernetes.io/name"
+	// LabelKeyAppInstance is the name of loadbalancer
+	LabelKeyAppInstance = "app.kubernetes.io/instance"
+	// LabelKeyAppComponent is the plugin which generates the object, e.g. proxy-nginx
+	LabelKeyAppComponent = "app.kubernetes.io/component"
+	// LabelKeyAppManagedBy is the tool managing the object, always LabelValueManagedBy
+	LabelKeyAppManagedBy = "app.kubernetes.io/managed-by"
+
+	// LabelValueAppName is the value of LabelKeyAppName
+	LabelValueAppName = "loadbalancer"
+	// LabelValueManagedBy is the value of LabelKeyAppManagedBy
+	LabelValueManagedBy = "loadbalancer-controller"
+	// LabelVersion is the current value of LabelKeyVersion
+	LabelVersion = "2"
 )
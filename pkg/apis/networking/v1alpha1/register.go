@@ -41,6 +41,15 @@ const (
 
 	// LoadBalancerKind for TypeMeta
 	LoadBalancerKind = "LoadBalancer"
+
+	// LoadBalancerStatusViewTPRName for third party resource
+	LoadBalancerStatusViewTPRName = "load-balancer-status-view"
+
+	// LoadBalancerStatusViewPlural is plural of loadbalancer status view
+	LoadBalancerStatusViewPlural = "loadbalancerstatusviews"
+
+	// LoadBalancerStatusViewKind for TypeMeta
+	LoadBalancerStatusViewKind = "LoadBalancerStatusView"
 )
 
 var (
@@ -70,6 +79,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&LoadBalancer{},
 		&LoadBalancerList{},
+		&LoadBalancerStatusView{},
+		&LoadBalancerStatusViewList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
@@ -18,6 +18,7 @@ package v1alpha1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	apiv1 "k8s.io/client-go/pkg/api/v1"
 )
 
@@ -64,6 +65,144 @@ type LoadBalancerSpec struct {
 	Proxy ProxySpec `json:"proxy"`
 	// Specification of the desired behavior of the providers
 	Providers ProvidersSpec `json:"providers"`
+	// Autoscaling scales the replicas of proxy and providers with traffic,
+	// the replicas are picked from nodes in order when Names is filled in
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+	// DeployMode determines the kind of workload running proxy and provider
+	// pods, valid options are: Deployment, DaemonSet. DaemonSet runs a pod on
+	// every node of the loadbalancer, defaults to Deployment
+	// +optional
+	DeployMode DeployMode `json:"deployMode,omitempty"`
+	// Template customizes the placement of proxy and provider pods
+	// +optional
+	Template *TemplateSpec `json:"template,omitempty"`
+	// UpdateStrategy determines how proxy and provider pods are replaced when
+	// they are updated, defaults to RollingUpdate with 1 max unavailable and surge
+	// +optional
+	UpdateStrategy *UpdateStrategy `json:"updateStrategy,omitempty"`
+	// TCPRules exposes tcp services on ports of the proxy
+	// +optional
+	TCPRules []L4Rule `json:"tcpRules,omitempty"`
+	// UDPRules exposes udp services on ports of the proxy
+	// +optional
+	UDPRules []L4Rule `json:"udpRules,omitempty"`
+}
+
+// L4Rule maps a port of the proxy to a port of service
+type L4Rule struct {
+	// Port is the port listened by the proxy, it can not be 80 or 443
+	Port int32 `json:"port"`
+	// Namespace of service, defaults to the namespace of loadbalancer
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// ServiceName is the name of service
+	ServiceName string `json:"serviceName"`
+	// ServicePort is the name or number of the service port
+	ServicePort intstr.IntOrString `json:"servicePort"`
+}
+
+// UpdateStrategyType ...
+type UpdateStrategyType string
+
+const (
+	// UpdateStrategyRollingUpdate replaces pods gradually
+	UpdateStrategyRollingUpdate UpdateStrategyType = "RollingUpdate"
+	// UpdateStrategyOnDelete replaces pods only when they are deleted manually,
+	// it is only supported in DaemonSet mode
+	UpdateStrategyOnDelete UpdateStrategyType = "OnDelete"
+)
+
+// UpdateStrategy is a description of how pods are replaced
+type UpdateStrategy struct {
+	// Type of update strategy, defaults to RollingUpdate
+	// +optional
+	Type UpdateStrategyType `json:"type,omitempty"`
+	// RollingUpdate is used when type is RollingUpdate
+	// +optional
+	RollingUpdate *RollingUpdateStrategy `json:"rollingUpdate,omitempty"`
+}
+
+// RollingUpdateStrategy is a description of rolling update
+type RollingUpdateStrategy struct {
+	// MaxUnavailable is the number or percentage of pods which can be
+	// unavailable during the update, defaults to 1
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	// MaxSurge is the number or percentage of pods which can be created above
+	// the replicas during the update, defaults to 1. It is ignored in DaemonSet mode
+	// +optional
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+}
+
+// TemplateSpec is a description of the placement of proxy and provider pods,
+// it is merged into the pods generated by controller
+type TemplateSpec struct {
+	// Tolerations are appended to the tolerations of loadbalancer taints
+	// +optional
+	Tolerations []apiv1.Toleration `json:"tolerations,omitempty"`
+	// NodeSelector must match the nodes which pods run on
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Affinity is merged with the generated one, the required node selector terms
+	// are combined with the nodes of loadbalancer, and the other terms are appended
+	// +optional
+	Affinity *apiv1.Affinity `json:"affinity,omitempty"`
+	// PriorityClassName is the priority class of pods, it overrides the
+	// default one of controller
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+}
+
+// DeployMode ...
+type DeployMode string
+
+const (
+	// DeployModeDeployment runs pods in a Deployment with anti-affinity
+	DeployModeDeployment DeployMode = "Deployment"
+	// DeployModeDaemonSet runs pods in a DaemonSet on all nodes of loadbalancer
+	DeployModeDaemonSet DeployMode = "DaemonSet"
+)
+
+// NetworkMode is the network which pods of a component run in
+type NetworkMode string
+
+const (
+	// NetworkModeHost runs pods in the network namespace of node
+	NetworkModeHost NetworkMode = "Host"
+	// NetworkModePod runs pods in their own network namespace, the ports
+	// are exposed on node by host ports if the loadbalancer is external
+	NetworkModePod NetworkMode = "Pod"
+)
+
+// AutoscalingSpec is a description of autoscaling
+type AutoscalingSpec struct {
+	// MinReplicas is the lower limit of replicas, defaults to 1
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	// MaxReplicas is the upper limit of replicas, it can not exceed
+	// the number of nodes when Names is filled in
+	MaxReplicas int32 `json:"maxReplicas"`
+	// Metric of proxy pods to scale on
+	Metric AutoscalingMetric `json:"metric"`
+}
+
+// AutoscalingMetricType ...
+type AutoscalingMetricType string
+
+const (
+	// AutoscalingMetricCPU scales on the cpu utilization of proxy pods
+	AutoscalingMetricCPU AutoscalingMetricType = "CPU"
+	// AutoscalingMetricConnections scales on the active connections of proxy pods
+	AutoscalingMetricConnections AutoscalingMetricType = "Connections"
+)
+
+// AutoscalingMetric is a description of the metric to scale on
+type AutoscalingMetric struct {
+	Type AutoscalingMetricType `json:"type"`
+	// TargetAverage is the target average value of metric per proxy pod,
+	// it is the percentage of requested cpu for CPU
+	TargetAverage int32 `json:"targetAverage"`
 }
 
 // LoadBalancerType ...
@@ -88,19 +227,277 @@ type NodesSpec struct {
 	Names []string `json:"names,omitempty"`
 	// +optional
 	Effect *apiv1.TaintEffect `json:"dedicated,omitempty"`
+	// Standby is a name list of nodes used to surge replicas when some of
+	// the nodes in Names are under maintenance
+	// +optional
+	Standby []string `json:"standby,omitempty"`
+	// Maintenance is a name list of nodes in Names which are under planned
+	// maintenance, a standby node will be taken for each of them until they
+	// are removed from the list
+	// +optional
+	Maintenance []string `json:"maintenance,omitempty"`
+	// Selector picks Replicas of ready nodes by labels when Names is empty,
+	// an unready node is replaced by another one automatically
+	// +optional
+	Selector map[string]string `json:"selector,omitempty"`
+	// Weights are the weights of nodes as real servers of the ipvsdr provider,
+	// e.g. 0 drains a node before maintenance and a small one shifts traffic
+	// onto a new node gradually. They override the weights annotated on nodes,
+	// the nodes without weight have the default weight 1
+	// +optional
+	Weights map[string]int32 `json:"weights,omitempty"`
 }
 
 // ProxySpec is a description of a proxy
 type ProxySpec struct {
 	Type ProxyType `json:"type"`
+	// Profile is a preset of body size, buffer and timeout settings for a class of
+	// workloads, valid options are: small, standard, large-uploads, websockets.
+	// The settings in Config override the ones in profile
+	// +optional
+	Profile ProxyProfile `json:"profile,omitempty"`
+	// SessionAffinity sticks the requests of a client to the same backend,
+	// valid options are: None, Cookie, SourceIP. It defaults to Cookie, the
+	// settings in Config override it
+	// +optional
+	SessionAffinity ProxySessionAffinity `json:"sessionAffinity,omitempty"`
+	// Logging configures the access log and error log of proxy, the settings
+	// in Config override it
+	// +optional
+	Logging *ProxyLogging `json:"logging,omitempty"`
+	// AccessControl restricts the clients allowed to access the proxy by
+	// source address and GeoIP country
+	// +optional
+	AccessControl *ProxyAccessControl `json:"accessControl,omitempty"`
+	// Limits limits the rate of requests and the number of connections of
+	// each client address, the requests exceeding them are responded with 429
+	// +optional
+	Limits *ProxyLimits `json:"limits,omitempty"`
+	// WAF enables the ModSecurity web application firewall in proxy
+	// +optional
+	WAF *ProxyWAF `json:"waf,omitempty"`
+	// BlueGreen runs a green proxy on some nodes of loadbalancer besides the
+	// blue one on the others, the providers route traffic to the active one.
+	// It is not supported in DaemonSet mode
+	// +optional
+	BlueGreen *ProxyBlueGreen `json:"blueGreen,omitempty"`
+	// Image overrides the proxy image of controller, it is used to pin or
+	// canary a version of proxy for the loadbalancer
+	// +optional
+	Image string `json:"image,omitempty"`
+	// NetworkMode is the network of proxy pods, defaults to Host for external
+	// loadbalancer and Pod for internal one
+	// +optional
+	NetworkMode NetworkMode `json:"networkMode,omitempty"`
+	// IngressClass is the class of Ingresses served by the proxy, defaults to
+	// <namespace>.<name> of the loadbalancer. It must be unique in cluster,
+	// the proxy of a later loadbalancer with the same class is not synced
+	// +optional
+	IngressClass string `json:"ingressClass,omitempty"`
+	// TLS is a list of certificates mounted into proxy pods at
+	// /etc/nginx/tls/<secret>/, the pods are rolled when they are rotated.
+	// The default one is served for requests matching no Ingress instead
+	// of the default certificate of controller
+	// +optional
+	TLS []ProxyTLS `json:"tls,omitempty"`
+	// SecurityContext runs the proxy container as a non-root user, it runs
+	// as root if it is nil
+	// +optional
+	SecurityContext *ProxySecurityContext `json:"securityContext,omitempty"`
 	// Config contains the optional config of proxy
 	Config map[string]string `json:"config,omitempty"`
 	// Compute Resources required by this container.
-	// Cannot be updated.
 	// +optional
 	Resources apiv1.ResourceRequirements `json:"resources,omitempty"`
 }
 
+// ProxyColor is the color of a proxy in blue/green deployment
+type ProxyColor string
+
+const (
+	// ProxyColorBlue is the proxy running on the nodes of loadbalancer
+	// except the green ones
+	ProxyColorBlue ProxyColor = "blue"
+	// ProxyColorGreen is the proxy running on the green nodes
+	ProxyColorGreen ProxyColor = "green"
+)
+
+// ProxyBlueGreen maintains a green proxy besides the blue one, the config of
+// the idle proxy can be overhauled and verified before traffic is switched
+// to it by flipping Active
+type ProxyBlueGreen struct {
+	// Active is the color of proxy serving traffic, defaults to blue. The
+	// nodes of the idle proxy are drained by zero weight in providers
+	// +optional
+	Active ProxyColor `json:"active,omitempty"`
+	// Green describes the green proxy
+	Green ProxyGreen `json:"green"`
+}
+
+// ProxyGreen describes the green proxy, it shares the spec of proxy except
+// the overrides below
+type ProxyGreen struct {
+	// Nodes are the nodes in names of loadbalancer running green proxy, the
+	// blue proxy runs on the others. Both proxies listen on the host ports,
+	// so a node runs only one of them
+	Nodes []string `json:"nodes"`
+	// Image overrides the image of green proxy
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Config is merged over the config of proxy for green proxy
+	// +optional
+	Config map[string]string `json:"config,omitempty"`
+}
+
+// ProxyTLS references a certificate in loadbalancer's namespace, either a
+// kubernetes.io/tls secret or a cert-manager Certificate
+type ProxyTLS struct {
+	// SecretName is the name of kubernetes.io/tls secret
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+	// Certificate is the name of cert-manager Certificate, the secret issued
+	// for it is used. It is exclusive with SecretName
+	// +optional
+	Certificate string `json:"certificate,omitempty"`
+	// Default serves the certificate for requests matching no Ingress, at
+	// most one certificate is default
+	// +optional
+	Default bool `json:"default,omitempty"`
+}
+
+// ProxySecurityContext describes the user and capabilities of proxy container
+type ProxySecurityContext struct {
+	// RunAsNonRoot requires the proxy container to run as a non-root user
+	RunAsNonRoot bool `json:"runAsNonRoot"`
+	// RunAsUser is the UID of proxy container, defaults to DefaultProxyUser
+	// +optional
+	RunAsUser *int64 `json:"runAsUser,omitempty"`
+	// NetBindService adds NET_BIND_SERVICE capability and drops the others,
+	// so that a non-root proxy can listen on ports below 1024, defaults to true
+	// +optional
+	NetBindService *bool `json:"netBindService,omitempty"`
+}
+
+// ProxyProfile ...
+type ProxyProfile string
+
+const (
+	// ProxyProfileSmall for small requests with short timeouts
+	ProxyProfileSmall ProxyProfile = "small"
+	// ProxyProfileStandard for common web applications
+	ProxyProfileStandard ProxyProfile = "standard"
+	// ProxyProfileLargeUploads for large request bodies and slow uploads
+	ProxyProfileLargeUploads ProxyProfile = "large-uploads"
+	// ProxyProfileWebsockets for long-lived connections
+	ProxyProfileWebsockets ProxyProfile = "websockets"
+)
+
+// ProxyLogging describes the access log and error log of proxy
+type ProxyLogging struct {
+	// Format is the format of access log, valid options are: text, json.
+	// It defaults to text, the combined format of nginx with upstream info
+	// +optional
+	Format ProxyLogFormat `json:"format,omitempty"`
+	// Destination is where the logs are written, stdout or a syslog endpoint
+	// in the form of syslog://host:port, defaults to stdout
+	// +optional
+	Destination string `json:"destination,omitempty"`
+	// SamplingRate is the percent of requests written to access log in
+	// [1, 100], defaults to 100
+	// +optional
+	SamplingRate *int32 `json:"samplingRate,omitempty"`
+	// ErrorLogLevel is the level of error log, valid options are: debug,
+	// info, notice, warn, error, crit. It defaults to notice
+	// +optional
+	ErrorLogLevel string `json:"errorLogLevel,omitempty"`
+}
+
+// ProxyWAF describes the ModSecurity web application firewall of proxy
+type ProxyWAF struct {
+	// Mode is the engine mode of ModSecurity, valid options are: On,
+	// DetectionOnly. It defaults to On, DetectionOnly logs the requests
+	// matching rules without blocking them
+	// +optional
+	Mode ProxyWAFMode `json:"mode,omitempty"`
+	// CoreRuleSet enables the OWASP ModSecurity Core Rule Set
+	// +optional
+	CoreRuleSet bool `json:"coreRuleSet,omitempty"`
+	// RulesConfigMap is the name of ConfigMap in loadbalancer's namespace
+	// containing custom rules, each key ending with .conf is a rule file.
+	// The proxy pods are rolled when the rules are changed
+	// +optional
+	RulesConfigMap string `json:"rulesConfigMap,omitempty"`
+}
+
+// ProxyWAFMode is the engine mode of ModSecurity
+type ProxyWAFMode string
+
+const (
+	// ProxyWAFModeOn blocks the requests matching rules
+	ProxyWAFModeOn ProxyWAFMode = "On"
+	// ProxyWAFModeDetectionOnly logs the requests matching rules only
+	ProxyWAFModeDetectionOnly ProxyWAFMode = "DetectionOnly"
+)
+
+// ProxyLimits describes the limits applied to each client address of proxy
+type ProxyLimits struct {
+	// RequestsPerSecond is the rate of requests allowed, 0 means unlimited
+	// +optional
+	RequestsPerSecond int32 `json:"requestsPerSecond,omitempty"`
+	// Burst is the number of requests exceeding the rate served without delay,
+	// the excessive ones are rejected. It defaults to 0
+	// +optional
+	Burst int32 `json:"burst,omitempty"`
+	// Connections is the number of concurrent connections allowed, 0 means
+	// unlimited
+	// +optional
+	Connections int32 `json:"connections,omitempty"`
+}
+
+// ProxyAccessControl describes the clients allowed to access the proxy, the
+// denied requests are responded with 403. A client must pass all of the lists
+type ProxyAccessControl struct {
+	// Allow is a list of CIDRs allowed to access the proxy, all sources are
+	// allowed if it is empty
+	// +optional
+	Allow []string `json:"allow,omitempty"`
+	// Deny is a list of CIDRs denied to access the proxy, it wins over Allow
+	// +optional
+	Deny []string `json:"deny,omitempty"`
+	// AllowCountries is a list of ISO 3166 alpha-2 country codes resolved by
+	// GeoIP allowed to access the proxy, all countries are allowed if it is
+	// empty. The clients of unknown country are denied if it is set
+	// +optional
+	AllowCountries []string `json:"allowCountries,omitempty"`
+	// DenyCountries is a list of ISO 3166 alpha-2 country codes resolved by
+	// GeoIP denied to access the proxy
+	// +optional
+	DenyCountries []string `json:"denyCountries,omitempty"`
+}
+
+// ProxyLogFormat is the format of access log of proxy
+type ProxyLogFormat string
+
+const (
+	// ProxyLogFormatText is the combined format of nginx with upstream info
+	ProxyLogFormatText ProxyLogFormat = "text"
+	// ProxyLogFormatJSON writes a json object per request
+	ProxyLogFormatJSON ProxyLogFormat = "json"
+)
+
+// ProxySessionAffinity is the session affinity of proxy
+type ProxySessionAffinity string
+
+const (
+	// ProxySessionAffinityNone balances each request
+	ProxySessionAffinityNone ProxySessionAffinity = "None"
+	// ProxySessionAffinityCookie sticks a client to the backend recorded in cookie
+	ProxySessionAffinityCookie ProxySessionAffinity = "Cookie"
+	// ProxySessionAffinitySourceIP sticks a client to the backend picked by
+	// the hash of its address
+	ProxySessionAffinitySourceIP ProxySessionAffinity = "SourceIP"
+)
+
 // ProxyType ...
 type ProxyType string
 
@@ -123,6 +520,10 @@ type ProvidersSpec struct {
 	Aliyun *AliyunProvider `json:"aliyun,omitempty"`
 	// azure
 	Azure *AzureProvider `json:"azure,omitempty"`
+	// google compute engine
+	GCE *GCEProvider `json:"gce,omitempty"`
+	// out-of-tree provider served by an external plugin
+	External *ExternalProvider `json:"external,omitempty"`
 }
 
 // ServiceProvider is a k8s service provider
@@ -135,10 +536,232 @@ type ServiceProvider struct {
 
 // IpvsdrProvider is a ipvs dr provider
 type IpvsdrProvider struct {
-	// Virtual IP Address
+	// Virtual IP Address, it is allocated from the pools of controller if empty
+	// +optional
 	Vip string `json:"vip"`
+	// Vips are additional virtual IP addresses served along with Vip, e.g. an
+	// internal address besides the external one. Each of them runs its own
+	// VRRP instance with a VRID allocated in the network
+	// +optional
+	Vips []string `json:"vips,omitempty"`
 	// ipvs shceduler algorithm type
 	Scheduler IpvsScheduler `json:"scheduler"`
+	// NetworkMode is the network of provider pods, only Host is supported as
+	// the vip is served on the interfaces of node, defaults to Host
+	// +optional
+	NetworkMode NetworkMode `json:"networkMode,omitempty"`
+	// IPVS tunes persistence, connection synchronization and timeouts of ipvs,
+	// provider pods reload it without restart when it is changed
+	// +optional
+	IPVS *IpvsParameters `json:"ipvs,omitempty"`
+	// VRRP tunes the advert interval and failover detection of VRRP instances,
+	// provider pods reload it without restart when it is changed
+	// +optional
+	VRRP *VRRPParameters `json:"vrrp,omitempty"`
+	// DSCP is the differentiated services code point in [0, 63] marked by
+	// provider pods on the traffic egressing the vips, so that it is
+	// prioritized across WAN. The marks are applied with iptables and
+	// reloaded without restart, nil leaves the traffic unmarked
+	// +optional
+	DSCP *int32 `json:"dscp,omitempty"`
+	// DataplaneBackend is the netfilter backend of the helper rules installed
+	// by provider pods next to ipvs, valid options are: auto, iptables,
+	// nftables. It defaults to the backend of controller, auto detects the
+	// one supported by the kernel of each node
+	// +optional
+	DataplaneBackend DataplaneBackend `json:"dataplaneBackend,omitempty"`
+	// Ports is a list of ports and port ranges forwarded to proxy with
+	// health checks, all ports of the vips are forwarded if it is empty.
+	// They must not overlap with the ports of other loadbalancers running
+	// on the same nodes
+	// +optional
+	Ports []IpvsdrPort `json:"ports,omitempty"`
+	// Network is the name of the L2 network which the vip lives in,
+	// VRIDs are unique among loadbalancers in the same network
+	// +optional
+	Network string `json:"network,omitempty"`
+	// Shared allows the vip to be shared with other loadbalancers in the same
+	// network which also enable sharing, their ports must not overlap. The
+	// oldest one runs the VRRP instance and forwards the ports of all of them
+	// +optional
+	Shared bool `json:"shared,omitempty"`
+	// VipEndpoints creates a headless Service named <lb>-vip without selector
+	// and the Endpoints of it, which point to the vips and the forwarded
+	// ports, so that DNS and service meshes in cluster can target the vip
+	// +optional
+	VipEndpoints bool `json:"vipEndpoints,omitempty"`
+	// Compute Resources required by the provider container,
+	// defaults to 200m cpu and 50Mi memory limits
+	// +optional
+	Resources apiv1.ResourceRequirements `json:"resources,omitempty"`
+	// QoS describes the quality of service of provider pods, latency spikes
+	// under node pressure may cause VRRP advert misses and spurious failovers
+	// +optional
+	QoS *ProviderQoS `json:"qos,omitempty"`
+	// Image overrides the provider image of controller, it is used to pin or
+	// canary a version of provider for the loadbalancer
+	// +optional
+	Image string `json:"image,omitempty"`
+	// InitImage overrides the init image of controller, which loads ipvs
+	// modules so that the provider container runs without privileges
+	// +optional
+	InitImage string `json:"initImage,omitempty"`
+	// Metrics runs an ipvs exporter sidecar in provider pods, which exports
+	// the connections, packets and bytes of the virtual and real servers of
+	// the vips. It requires the exporter image of controller
+	// +optional
+	Metrics *IpvsdrMetrics `json:"metrics,omitempty"`
+}
+
+// IpvsdrMetrics configures the ipvs exporter sidecar of provider pods
+type IpvsdrMetrics struct {
+	// Port is the port of metrics in host network, it must not be used by
+	// other loadbalancers on the same nodes, defaults to
+	// DefaultIpvsdrMetricsPort
+	// +optional
+	Port int32 `json:"port,omitempty"`
+}
+
+// DataplaneBackend is the netfilter backend of helper rules of ipvsdr provider
+type DataplaneBackend string
+
+const (
+	// DataplaneBackendAuto prefers nftables if it is supported by the kernel
+	// of node, otherwise falls back to iptables
+	DataplaneBackendAuto DataplaneBackend = "auto"
+	// DataplaneBackendIPTables installs the rules with iptables
+	DataplaneBackendIPTables DataplaneBackend = "iptables"
+	// DataplaneBackendNFTables installs the rules with nftables
+	DataplaneBackendNFTables DataplaneBackend = "nftables"
+)
+
+// ProviderQoS describes the quality of service of provider pods
+type ProviderQoS struct {
+	// Guaranteed enforces requests equal to limits for cpu and memory, so that
+	// pods are in Guaranteed QoS class, which are the last to be throttled and
+	// killed under node pressure
+	// +optional
+	Guaranteed bool `json:"guaranteed,omitempty"`
+	// CPUPinning requires integral cpus in Guaranteed QoS class, so that kubelet
+	// with static cpu manager policy pins exclusive cpus to the provider container
+	// +optional
+	CPUPinning bool `json:"cpuPinning,omitempty"`
+}
+
+// IpvsdrPort is a port forwarded by ipvs to the real servers
+type IpvsdrPort struct {
+	// Port is the port of virtual server and real servers
+	Port int32 `json:"port"`
+	// EndPort forwards the range of ports from Port to EndPort inclusive,
+	// health check and backend are not supported by a range
+	// +optional
+	EndPort int32 `json:"endPort,omitempty"`
+	// Protocol is the protocol of port, TCP or UDP, defaults to TCP
+	// +optional
+	Protocol apiv1.Protocol `json:"protocol,omitempty"`
+	// HealthCheck describes how to check the real servers,
+	// the unhealthy real server is removed from ipvs pool
+	// +optional
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+	// Backend is the service which the port forwards to directly, bypassing
+	// the proxy. The ready endpoints of service are the real servers
+	// +optional
+	Backend *IpvsdrBackend `json:"backend,omitempty"`
+}
+
+// IpvsdrBackend is a service whose endpoints are the real servers of a port
+type IpvsdrBackend struct {
+	// Namespace of service, defaults to the namespace of loadbalancer
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// ServiceName is the name of service
+	ServiceName string `json:"serviceName"`
+	// ServicePort is the name or number of the service port
+	ServicePort intstr.IntOrString `json:"servicePort"`
+}
+
+// HealthCheckType is the type of health check
+type HealthCheckType string
+
+const (
+	// HealthCheckTypeTCP checks real server by tcp connect
+	HealthCheckTypeTCP HealthCheckType = "tcp"
+	// HealthCheckTypeHTTP checks real server by http get
+	HealthCheckTypeHTTP HealthCheckType = "http"
+)
+
+// HealthCheck describes a health check of real server
+type HealthCheck struct {
+	// Type is the type of health check, tcp or http
+	Type HealthCheckType `json:"type"`
+	// Path is the http path to access, only for http type
+	// +optional
+	Path string `json:"path,omitempty"`
+	// StatusCode is the expected http status code, only for http type,
+	// defaults to 200
+	// +optional
+	StatusCode int32 `json:"statusCode,omitempty"`
+	// TimeoutSeconds is the connect timeout of check, defaults to 3
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+	// Retry is the number of retries before real server marked as unhealthy,
+	// defaults to 3
+	// +optional
+	Retry int32 `json:"retry,omitempty"`
+	// DelayBeforeRetrySeconds is the delay before retry, defaults to 3
+	// +optional
+	DelayBeforeRetrySeconds int32 `json:"delayBeforeRetrySeconds,omitempty"`
+}
+
+// IpvsParameters tunes the ipvs of provider pods
+type IpvsParameters struct {
+	// PersistenceTimeout is the seconds connections from the same client are
+	// forwarded to the same real server, 0 disables persistence
+	// +optional
+	PersistenceTimeout int32 `json:"persistenceTimeout,omitempty"`
+	// SyncDaemon runs the ipvs connection synchronization daemon, so that the
+	// established connections survive failover of vip
+	// +optional
+	SyncDaemon bool `json:"syncDaemon,omitempty"`
+	// TCPTimeout is the seconds an established tcp connection is kept idle,
+	// 0 keeps the default of kernel
+	// +optional
+	TCPTimeout int32 `json:"tcpTimeout,omitempty"`
+	// TCPFinTimeout is the seconds a tcp connection is kept after FIN is
+	// received, 0 keeps the default of kernel
+	// +optional
+	TCPFinTimeout int32 `json:"tcpFinTimeout,omitempty"`
+	// UDPTimeout is the seconds an udp connection is kept idle, 0 keeps the
+	// default of kernel
+	// +optional
+	UDPTimeout int32 `json:"udpTimeout,omitempty"`
+	// MaxConnections is the upper threshold of connections of a real server,
+	// the server receives no new connections once it is reached, 0 means
+	// unlimited
+	// +optional
+	MaxConnections int32 `json:"maxConnections,omitempty"`
+}
+
+// VRRPParameters tunes the timing of VRRP instances of ipvsdr provider. A
+// BACKUP takes over the vip after missing adverts for about 3 advert
+// intervals, so an interval of 200ms detects the failure of MASTER in less
+// than 1s at the cost of more adverts on the network. The members sharing
+// a vip follow the parameters of the owner
+type VRRPParameters struct {
+	// AdvertInterval is the milliseconds between VRRP adverts, it must be a
+	// multiple of 10 in [50, 10000], 0 keeps the default of provider (1000)
+	// +optional
+	AdvertInterval int32 `json:"advertInterval,omitempty"`
+	// Fall is the number of consecutive failed health checks of node before
+	// the instance enters FAULT and gives up the vip, 0 keeps the default of
+	// provider
+	// +optional
+	Fall int32 `json:"fall,omitempty"`
+	// Rise is the number of consecutive succeeded health checks of node
+	// before the instance in FAULT competes for the vip again, 0 keeps the
+	// default of provider
+	// +optional
+	Rise int32 `json:"rise,omitempty"`
 }
 
 // IpvsScheduler is ipvs shceduler algorithm type
@@ -166,9 +789,34 @@ type AliyunProvider struct {
 	Name string `json:"name,omitempty"`
 }
 
-// AzureProvider ...
+// AzureProvider is a azure cloud load balancer provider
 type AzureProvider struct {
 	Name string `json:"name,omitempty"`
+	// ResourceGroup is the azure resource group where the load balancer is created
+	// +optional
+	ResourceGroup string `json:"resourceGroup,omitempty"`
+	// Internal requests an internal load balancer without public ip
+	// +optional
+	Internal bool `json:"internal,omitempty"`
+}
+
+// GCEProvider is a google compute engine load balancer provider
+type GCEProvider struct {
+	Name string `json:"name,omitempty"`
+	// Internal requests an internal load balancer without public ip
+	// +optional
+	Internal bool `json:"internal,omitempty"`
+}
+
+// ExternalProvider is a load balancer provisioned by an external plugin, e.g.
+// a hardware load balancer, the reconciliation is proxied to the endpoint of
+// the plugin registered in controller
+type ExternalProvider struct {
+	// Name is the name of the external plugin registered in controller
+	Name string `json:"name"`
+	// Parameters are passed to the plugin as is, they are interpreted by the plugin
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
 }
 
 // LoadBalancerStatus represents the current status of a LoadBalancer
@@ -177,16 +825,186 @@ type LoadBalancerStatus struct {
 	ProxyStatus ProxyStatus `json:"proxyStatus"`
 	// +optional
 	ProvidersStatuses ProvidersStatuses `json:"providersStatuses"`
+	// Conditions represent the latest available observations of loadbalancer's state
+	// +optional
+	Conditions []LoadBalancerCondition `json:"conditions,omitempty"`
+	// Autoscaling is the latest observation of autoscaling
+	// +optional
+	Autoscaling *AutoscalingStatus `json:"autoscaling,omitempty"`
+	// Nodes is the latest observation of nodes
+	// +optional
+	Nodes NodesStatus `json:"nodes,omitempty"`
+	// SyncFailures are the consecutive failures of syncing the loadbalancer by
+	// controller and plugins, an entry is removed once the sync succeeds again
+	// +optional
+	SyncFailures []SyncFailure `json:"syncFailures,omitempty"`
+	// Revision is the number of the latest revision of the spec generating
+	// the workloads, the revisions are kept in ConfigMaps labeled with the
+	// revision number
+	// +optional
+	Revision int64 `json:"revision,omitempty"`
+}
+
+// SyncFailure represents the consecutive failures of syncing a loadbalancer
+// by a component
+type SyncFailure struct {
+	// Component is the controller or plugin failing to sync, e.g. loadbalancer,
+	// provider-ipvsdr or proxy-nginx
+	Component string `json:"component"`
+	// Count is the number of consecutive failures
+	Count int `json:"count"`
+	// LastError is the error of the last failure
+	LastError string `json:"lastError"`
+	// LastFailureTime is the time of the last failure
+	LastFailureTime metav1.Time `json:"lastFailureTime"`
+	// SlowRetry is true if the retries are slowed down after too many failures
+	// +optional
+	SlowRetry bool `json:"slowRetry,omitempty"`
+}
+
+// NodesStatus represents the current status of nodes
+type NodesStatus struct {
+	// Selected is a name list of nodes picked by Selector
+	// +optional
+	Selected []string `json:"selected,omitempty"`
+	// Unready is a name list of nodes in Names and Standby which are not
+	// ready, a standby node will be taken for each of them in Names
+	// +optional
+	Unready []string `json:"unready,omitempty"`
+}
+
+// AutoscalingStatus represents the current status of autoscaling
+type AutoscalingStatus struct {
+	// DesiredReplicas is the replicas computed by autoscaling
+	DesiredReplicas int32 `json:"desiredReplicas"`
+	// CurrentAverage is the last observed average value of metric per proxy pod
+	// +optional
+	CurrentAverage *int32 `json:"currentAverage,omitempty"`
+	// LastScaleTime is the last time autoscaling changed the replicas
+	// +optional
+	LastScaleTime *metav1.Time `json:"lastScaleTime,omitempty"`
+}
+
+// LoadBalancerConditionType is the type of loadbalancer condition
+type LoadBalancerConditionType string
+
+// These are valid conditions of loadbalancer
+const (
+	// LoadBalancerReady means all the other conditions of loadbalancer are true
+	LoadBalancerReady LoadBalancerConditionType = "Ready"
+	// LoadBalancerProxyConfigured means the proxy has been synced with spec
+	LoadBalancerProxyConfigured LoadBalancerConditionType = "ProxyConfigured"
+	// LoadBalancerProxyAvailable means all the proxy pods are ready
+	LoadBalancerProxyAvailable LoadBalancerConditionType = "ProxyAvailable"
+	// LoadBalancerProviderConfigured means the provider has been synced with spec
+	LoadBalancerProviderConfigured LoadBalancerConditionType = "ProviderConfigured"
+	// LoadBalancerProviderAvailable means all the provider pods are ready
+	LoadBalancerProviderAvailable LoadBalancerConditionType = "ProviderAvailable"
+	// LoadBalancerVIPAssigned means the vip or external ip is serving traffic
+	LoadBalancerVIPAssigned LoadBalancerConditionType = "VIPAssigned"
+	// LoadBalancerVIPConflict means the vip is already answering on the
+	// network before provisioning, the loadbalancer is healthy when it is false
+	LoadBalancerVIPConflict LoadBalancerConditionType = "VIPConflict"
+	// LoadBalancerMissingReference means a secret referenced by spec does not
+	// exist, the loadbalancer is healthy when it is false
+	LoadBalancerMissingReference LoadBalancerConditionType = "MissingReference"
+	// LoadBalancerVRIDAllocated means a VRID unique in the network has been
+	// allocated to the ipvsdr provider
+	LoadBalancerVRIDAllocated LoadBalancerConditionType = "VRIDAllocated"
+	// LoadBalancerVipAllocated means a vip has been allocated from pools
+	// to the ipvsdr provider whose vip is empty
+	LoadBalancerVipAllocated LoadBalancerConditionType = "VipAllocated"
+	// LoadBalancerImageUnavailable means the image of all provider pods can
+	// not be pulled, which is missing or unauthorized in registry
+	LoadBalancerImageUnavailable LoadBalancerConditionType = "ImageUnavailable"
+	// LoadBalancerIngressClassConflict means the ingress class of proxy is
+	// used by an earlier loadbalancer, the loadbalancer is healthy when it is false
+	LoadBalancerIngressClassConflict LoadBalancerConditionType = "IngressClassConflict"
+	// LoadBalancerQuotaExceeded means the loadbalancer exceeds the quota of its
+	// namespace or cluster and is not reconciled, the loadbalancer is healthy
+	// when it is false
+	LoadBalancerQuotaExceeded LoadBalancerConditionType = "QuotaExceeded"
+	// LoadBalancerDataplaneUnsupported means the dataplane backend in spec is
+	// not supported by the nodes of some provider pods, the loadbalancer is
+	// healthy when it is false
+	LoadBalancerDataplaneUnsupported LoadBalancerConditionType = "DataplaneUnsupported"
+	// LoadBalancerDSCPApplied means the DSCP mark in spec has been applied by
+	// all the ready provider pods, it is reported only if the mark is set
+	LoadBalancerDSCPApplied LoadBalancerConditionType = "DSCPApplied"
+)
+
+// LoadBalancerCondition describes the state of a loadbalancer at a certain point
+type LoadBalancerCondition struct {
+	// Type of loadbalancer condition
+	Type LoadBalancerConditionType `json:"type"`
+	// Status of the condition, one of True, False, Unknown
+	Status apiv1.ConditionStatus `json:"status"`
+	// The last time the condition transitioned from one status to another
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// The reason for the condition's last transition
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// A human readable message indicating details about the transition
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // ProxyStatus represents the current status of a Proxy
 type ProxyStatus struct {
 	PodStatuses  `json:",inline"`
 	Deployment   string `json:"deployment,omitempty"`
+	DaemonSet    string `json:"daemonSet,omitempty"`
 	IngressClass string `json:"ingressClass,omitempty"`
 	ConfigMap    string `json:"configMap,omitempty"`
 	TCPConfigMap string `json:"tcpConfigMap,omitempty"`
 	UDPConfigMap string `json:"udpConfigMap,omitempty"`
+	// TLS reports the certificates in spec with their expiry
+	TLS []ProxyTLSStatus `json:"tls,omitempty"`
+	// SessionAffinity is the effective session affinity of proxy
+	SessionAffinity ProxySessionAffinity `json:"sessionAffinity,omitempty"`
+	// WAF reports the web application firewall of proxy, nil if disabled
+	WAF *ProxyWAFStatus `json:"waf,omitempty"`
+	// BlueGreen reports the green proxy, the pods above are the blue ones
+	BlueGreen *ProxyBlueGreenStatus `json:"blueGreen,omitempty"`
+}
+
+// ProxyBlueGreenStatus represents the current status of blue/green proxies
+type ProxyBlueGreenStatus struct {
+	// Active is the color of proxy serving traffic
+	Active ProxyColor `json:"active"`
+	// Green is the pods of green proxy
+	Green PodStatuses `json:"green"`
+	// GreenDeployment is the deployment of green proxy
+	GreenDeployment string `json:"greenDeployment,omitempty"`
+	// GreenConfigMap is the ConfigMap of nginx config of green proxy
+	GreenConfigMap string `json:"greenConfigMap,omitempty"`
+}
+
+// ProxyWAFStatus represents the current status of the web application firewall of proxy
+type ProxyWAFStatus struct {
+	// Mode is the effective engine mode of ModSecurity
+	Mode ProxyWAFMode `json:"mode"`
+	// CoreRuleSet is true if the OWASP Core Rule Set is enabled
+	CoreRuleSet bool `json:"coreRuleSet,omitempty"`
+	// Rules are the custom rule files loaded from RulesConfigMap
+	Rules []string `json:"rules,omitempty"`
+	// Message explains why the custom rules can not be loaded
+	Message string `json:"message,omitempty"`
+}
+
+// ProxyTLSStatus represents the current status of a certificate of proxy
+type ProxyTLSStatus struct {
+	// SecretName is the secret of certificate
+	SecretName string `json:"secretName"`
+	// Certificate is the cert-manager Certificate issuing the secret
+	Certificate string `json:"certificate,omitempty"`
+	// DNSNames are the subject alternative names of certificate
+	DNSNames []string `json:"dnsNames,omitempty"`
+	// NotAfter is the expiry of certificate
+	NotAfter *metav1.Time `json:"notAfter,omitempty"`
+	// Message explains why the certificate can not be read
+	Message string `json:"message,omitempty"`
 }
 
 // ProvidersStatuses represents the current status of Providers
@@ -199,6 +1017,10 @@ type ProvidersStatuses struct {
 	Aliyun *AliyunProviderStatus `json:"aliyun,omitempty"`
 	// azure
 	Azure *AzureProviderStatus `json:"azure,omitempty"`
+	// google compute engine
+	GCE *GCEProviderStatus `json:"gce,omitempty"`
+	// out-of-tree provider served by an external plugin
+	External *ExternalProviderStatus `json:"external,omitempty"`
 }
 
 // ServiceProviderStatus represents the current status of the service provider
@@ -209,16 +1031,94 @@ type ServiceProviderStatus struct {
 type IpvsdrProviderStatus struct {
 	PodStatuses `json:",inline"`
 	Deployment  string `json:"deployment,omitempty"`
+	DaemonSet   string `json:"daemonSet,omitempty"`
 	Vip         string `json:"vip"`
 	Vrid        *int   `json:"vrid,omitempty"`
+	// Vips are the status of all vips including the primary one
+	Vips []IpvsdrVipStatus `json:"vips,omitempty"`
+	// Master is the node of the ready pod holding the vip as VRRP MASTER,
+	// more than one nodes are separated by comma when split brain happens
+	Master string `json:"master,omitempty"`
+	// ActiveConnections is the sum of active IPVS connections of ready pods
+	ActiveConnections int64 `json:"activeConnections"`
+	// InactiveConnections is the sum of inactive IPVS connections of ready pods
+	InactiveConnections int64 `json:"inactiveConnections"`
+	// PersistenceTimeout is the effective seconds connections from the same
+	// client are forwarded to the same real server, 0 if disabled
+	PersistenceTimeout int32 `json:"persistenceTimeout,omitempty"`
+	// LastHealthCheckTime is the latest time a pod checked the backends
+	LastHealthCheckTime *metav1.Time `json:"lastHealthCheckTime,omitempty"`
+	// Instances are the runtime status published by provider pods
+	Instances []IpvsdrInstanceStatus `json:"instances,omitempty"`
+}
+
+// IpvsdrVipStatus represents the current status of a vip of ipvsdr provider
+type IpvsdrVipStatus struct {
+	Vip string `json:"vip"`
+	// Vrid is the VRID of VRRP instance of vip, -1 if allocation failed
+	Vrid *int `json:"vrid,omitempty"`
+	// Message is the reason why the vip is not served
+	Message string `json:"message,omitempty"`
+}
+
+// IpvsdrInstanceStatus represents the runtime status published by an ipvsdr pod
+type IpvsdrInstanceStatus struct {
+	PodName             string       `json:"podName"`
+	NodeName            string       `json:"nodeName"`
+	State               VRRPState    `json:"state,omitempty"`
+	ActiveConnections   int64        `json:"activeConnections"`
+	InactiveConnections int64        `json:"inactiveConnections"`
+	LastHealthCheckTime *metav1.Time `json:"lastHealthCheckTime,omitempty"`
+	// DSCP is the mark applied by the pod on the traffic egressing the vips
+	DSCP *int32 `json:"dscp,omitempty"`
+	// DataplaneBackend is the backend in use by the pod
+	DataplaneBackend DataplaneBackend `json:"dataplaneBackend,omitempty"`
+	// DataplaneCapabilities are the backends supported by the kernel of node
+	DataplaneCapabilities []DataplaneBackend `json:"dataplaneCapabilities,omitempty"`
 }
 
+// VRRPState is the VRRP state of an ipvsdr instance
+type VRRPState string
+
+// These are the valid VRRP states of an ipvsdr instance
+const (
+	VRRPStateMaster VRRPState = "MASTER"
+	VRRPStateBackup VRRPState = "BACKUP"
+	VRRPStateFault  VRRPState = "FAULT"
+)
+
 // AliyunProviderStatus represents the current status of the aliyun provider
 type AliyunProviderStatus struct {
 }
 
 // AzureProviderStatus represents the current status of the azure provider
 type AzureProviderStatus struct {
+	CloudProviderStatus `json:",inline"`
+}
+
+// GCEProviderStatus represents the current status of the gce provider
+type GCEProviderStatus struct {
+	CloudProviderStatus `json:",inline"`
+}
+
+// ExternalProviderStatus represents the current status of an external provider
+type ExternalProviderStatus struct {
+	// Name is the name of the external plugin
+	Name string `json:"name"`
+	// Addresses are the addresses served by the load balancer of plugin
+	Addresses []string `json:"addresses,omitempty"`
+	// Ready is true if the plugin has finished provisioning
+	Ready bool `json:"ready"`
+	// Message is the human readable status reported by the plugin
+	Message string `json:"message,omitempty"`
+}
+
+// CloudProviderStatus represents the current status of a cloud load balancer
+type CloudProviderStatus struct {
+	// Service is the name of service which requests the cloud load balancer
+	Service string `json:"service,omitempty"`
+	// ExternalIP is the ip address assigned by cloud provider
+	ExternalIP string `json:"externalIP,omitempty"`
 }
 
 // PodStatuses represents the current statuses of a list of pods
@@ -227,6 +1127,30 @@ type PodStatuses struct {
 	TotalReplicas int32       `json:"totalReplicas"`
 	ReadyReplicas int32       `json:"readyReplicas"`
 	Statuses      []PodStatus `json:"podStatuses"`
+	// Rollout is the progress of the rollout of image or config in progress
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+}
+
+// RolloutStatus represents the progress of a rollout of pods
+type RolloutStatus struct {
+	// Replicas is the number of desired pods
+	Replicas int32 `json:"replicas"`
+	// UpdatedReplicas is the number of pods running the latest template
+	UpdatedReplicas int32 `json:"updatedReplicas"`
+	// ReadyReplicas is the number of ready pods running the latest template
+	ReadyReplicas int32 `json:"readyReplicas"`
+	// TotalReplicas is the number of pods running any template
+	TotalReplicas int32 `json:"totalReplicas"`
+	// Percentage is the percentage of desired pods updated and ready
+	Percentage int32 `json:"percentage"`
+	// StartTime is the creation time of the first pod running the latest template
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// EstimatedCompletionTime is estimated by the average startup time of
+	// the updated pods, it is not set until one of them is ready
+	// +optional
+	EstimatedCompletionTime *metav1.Time `json:"estimatedCompletionTime,omitempty"`
 }
 
 // PodStatus represents the current status of pods
@@ -240,3 +1164,41 @@ type PodStatus struct {
 	Reason          string `json:"reason"`
 	Message         string `json:"message"`
 }
+
+// LoadBalancerStatusViewList is a collection of LoadBalancerStatusView
+type LoadBalancerStatusViewList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []LoadBalancerStatusView `json:"items"`
+}
+
+// LoadBalancerStatusView is a trimmed, read-only copy of the status of a
+// LoadBalancer managed in another namespace. It is mirrored into tenant
+// namespaces so that application teams can see the status without access
+// to the LoadBalancer itself.
+type LoadBalancerStatusView struct {
+	metav1.TypeMeta `json:",inline"`
+	// Standard object's metadata.
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	// Populated by the system.
+	// Read-only.
+	Status LoadBalancerStatusViewStatus `json:"status,omitempty"`
+}
+
+// LoadBalancerStatusViewStatus represents the trimmed status of a LoadBalancer
+type LoadBalancerStatusViewStatus struct {
+	// Namespace of the LoadBalancer
+	Namespace string `json:"namespace"`
+	// Name of the LoadBalancer
+	Name string `json:"name"`
+	// Type of the LoadBalancer
+	Type LoadBalancerType `json:"type"`
+	// IngressClass used by proxy
+	IngressClass string `json:"ingressClass,omitempty"`
+	// Addresses are the vips or external ips of LoadBalancer
+	Addresses []string `json:"addresses,omitempty"`
+	// ProxyReplicas is the desired replicas of proxy
+	ProxyReplicas int32 `json:"proxyReplicas"`
+	// ProxyReadyReplicas is the ready replicas of proxy
+	ProxyReadyReplicas int32 `json:"proxyReadyReplicas"`
+}
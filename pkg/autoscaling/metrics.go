@@ -0,0 +1,162 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaling
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// ConnectionsMetricName is the custom metric of active connections exported by proxy pods
+const ConnectionsMetricName = "custom/connections"
+
+// metricsWindow is how far back the custom metrics are looked up
+const metricsWindow = 2 * time.Minute
+
+// MetricsClient gets the metrics of pods
+type MetricsClient interface {
+	// GetCPUUtilization returns the average utilization of requested cpu of pods in percentage
+	GetCPUUtilization(namespace string, selector labels.Selector, pods []*v1.Pod) (int32, error)
+	// GetConnections returns the average active connections of pods
+	GetConnections(namespace string, pods []*v1.Pod) (int32, error)
+}
+
+// podMetricsList is the response of heapster metrics api
+type podMetricsList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Containers []struct {
+			Name  string          `json:"name"`
+			Usage v1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// metricResultList is the response of heapster model api
+type metricResultList struct {
+	Items []struct {
+		Metrics []struct {
+			Timestamp time.Time `json:"timestamp"`
+			Value     int64     `json:"value"`
+		} `json:"metrics"`
+	} `json:"items"`
+}
+
+type heapsterMetricsClient struct {
+	client    kubernetes.Interface
+	namespace string
+	service   string
+}
+
+// NewHeapsterMetricsClient creates a MetricsClient which gets metrics from heapster service
+func NewHeapsterMetricsClient(client kubernetes.Interface, namespace, service string) MetricsClient {
+	return &heapsterMetricsClient{
+		client:    client,
+		namespace: namespace,
+		service:   service,
+	}
+}
+
+func (h *heapsterMetricsClient) get(path string, params map[string]string, into interface{}) error {
+	data, err := h.client.CoreV1().Services(h.namespace).ProxyGet("http", h.service, "", path, params).DoRaw()
+	if err != nil {
+		return fmt.Errorf("failed to get metrics from heapster: %v", err)
+	}
+	return json.Unmarshal(data, into)
+}
+
+func (h *heapsterMetricsClient) GetCPUUtilization(namespace string, selector labels.Selector, pods []*v1.Pod) (int32, error) {
+	if len(pods) == 0 {
+		return 0, fmt.Errorf("no pods to get metrics from")
+	}
+
+	requests := make(map[string]int64, len(pods))
+	for _, pod := range pods {
+		var request int64
+		for _, c := range pod.Spec.Containers {
+			quantity, ok := c.Resources.Requests[v1.ResourceCPU]
+			if !ok {
+				return 0, fmt.Errorf("missing cpu request of container %v of pod %v", c.Name, pod.Name)
+			}
+			request += quantity.MilliValue()
+		}
+		requests[pod.Name] = request
+	}
+
+	metrics := podMetricsList{}
+	path := fmt.Sprintf("/apis/metrics/v1alpha1/namespaces/%s/pods", namespace)
+	if err := h.get(path, map[string]string{"labelSelector": selector.String()}, &metrics); err != nil {
+		return 0, err
+	}
+
+	var usage, request int64
+	for _, item := range metrics.Items {
+		r, ok := requests[item.Metadata.Name]
+		if !ok {
+			continue
+		}
+		for _, c := range item.Containers {
+			quantity := c.Usage[v1.ResourceCPU]
+			usage += quantity.MilliValue()
+		}
+		request += r
+	}
+	if request == 0 {
+		return 0, fmt.Errorf("no cpu metrics of pods")
+	}
+	return int32(usage * 100 / request), nil
+}
+
+func (h *heapsterMetricsClient) GetConnections(namespace string, pods []*v1.Pod) (int32, error) {
+	if len(pods) == 0 {
+		return 0, fmt.Errorf("no pods to get metrics from")
+	}
+
+	names := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+	}
+
+	results := metricResultList{}
+	path := fmt.Sprintf("/api/v1/model/namespaces/%s/pod-list/%s/metrics/%s", namespace, strings.Join(names, ","), ConnectionsMetricName)
+	params := map[string]string{"start": time.Now().Add(-metricsWindow).UTC().Format(time.RFC3339)}
+	if err := h.get(path, params, &results); err != nil {
+		return 0, err
+	}
+
+	var sum, count int64
+	for _, item := range results.Items {
+		if len(item.Metrics) == 0 {
+			continue
+		}
+		// use the latest value
+		sum += item.Metrics[len(item.Metrics)-1].Value
+		count++
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("no %v metrics of pods", ConnectionsMetricName)
+	}
+	return int32(sum / count), nil
+}
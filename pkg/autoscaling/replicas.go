@@ -0,0 +1,41 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaling
+
+import (
+	"math"
+)
+
+// tolerance is the ratio of the average to the target within which no scaling happens
+const tolerance = 0.1
+
+// DesiredReplicas computes the replicas bringing the average of metric to
+// the target, it is clamped to [min, max]
+func DesiredReplicas(current, average, target, min, max int32) int32 {
+	desired := current
+	ratio := float64(average) / float64(target)
+	if math.Abs(ratio-1) > tolerance {
+		desired = int32(math.Ceil(ratio * float64(current)))
+	}
+	if desired < min {
+		desired = min
+	}
+	if desired > max {
+		desired = max
+	}
+	return desired
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package custommetrics serves snapshots of the IPVS connection counts of
+// loadbalancers in the shape of custom metrics API custom.metrics.k8s.io/v1alpha1,
+// so that HorizontalPodAutoscaler can scale backends on the connections at vip
+// by an Object metric targeting the loadbalancer
+package custommetrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// GroupName is the group of custom metrics API
+	GroupName = "custom.metrics.k8s.io"
+	// Version is the version of custom metrics API
+	Version = "v1alpha1"
+
+	// ActiveConnectionsMetricName is the metric of active IPVS connections at the vips of loadbalancer
+	ActiveConnectionsMetricName = "ipvs_active_connections"
+	// InactiveConnectionsMetricName is the metric of inactive IPVS connections at the vips of loadbalancer
+	InactiveConnectionsMetricName = "ipvs_inactive_connections"
+)
+
+// resourceName is the resource of loadbalancers in paths of custom metrics API
+var resourceName = netv1alpha1.LoadBalancerPlural + "." + netv1alpha1.AlphaGroupName
+
+// MetricValueList is a list of values for a given metric for some set of objects
+type MetricValueList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MetricValue `json:"items"`
+}
+
+// MetricValue is the metric value for some object
+type MetricValue struct {
+	metav1.TypeMeta `json:",inline"`
+	// DescribedObject is a reference to the object this metric pertains to
+	DescribedObject v1.ObjectReference `json:"describedObject"`
+	MetricName      string             `json:"metricName"`
+	// Timestamp is the time the snapshot was taken
+	Timestamp metav1.Time `json:"timestamp"`
+	// WindowSeconds is unset, the values are gauges instead of rates
+	WindowSeconds *int64            `json:"window,omitempty"`
+	Value         resource.Quantity `json:"value"`
+}
+
+// snapshot is the connection counts of a loadbalancer at a point of time
+type snapshot struct {
+	active    int64
+	inactive  int64
+	timestamp time.Time
+}
+
+var (
+	mu        sync.RWMutex
+	snapshots = make(map[string]map[string]snapshot)
+)
+
+// Set records the snapshot of connection counts of the loadbalancer, it is
+// called on every sync of status aggregated from the provider pods
+func Set(namespace, name string, active, inactive int64) {
+	mu.Lock()
+	defer mu.Unlock()
+	if snapshots[namespace] == nil {
+		snapshots[namespace] = make(map[string]snapshot)
+	}
+	snapshots[namespace][name] = snapshot{
+		active:    active,
+		inactive:  inactive,
+		timestamp: time.Now(),
+	}
+}
+
+// Delete forgets the snapshot of the loadbalancer
+func Delete(namespace, name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(snapshots[namespace], name)
+	if len(snapshots[namespace]) == 0 {
+		delete(snapshots, namespace)
+	}
+}
+
+// values returns the values of metric of the loadbalancer with name in namespace,
+// or all the loadbalancers in namespace if name is *, sorted by name
+func values(namespace, name, metric string) []MetricValue {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := []string{}
+	if name == "*" {
+		for n := range snapshots[namespace] {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+	} else if _, ok := snapshots[namespace][name]; ok {
+		names = append(names, name)
+	}
+
+	items := make([]MetricValue, 0, len(names))
+	for _, n := range names {
+		s := snapshots[namespace][n]
+		value := s.active
+		if metric == InactiveConnectionsMetricName {
+			value = s.inactive
+		}
+		items = append(items, MetricValue{
+			DescribedObject: v1.ObjectReference{
+				Kind:       netv1alpha1.LoadBalancerKind,
+				APIVersion: netv1alpha1.SchemeGroupVersion.String(),
+				Namespace:  namespace,
+				Name:       n,
+			},
+			MetricName: metric,
+			Timestamp:  metav1.NewTime(s.timestamp),
+			Value:      *resource.NewQuantity(value, resource.DecimalSI),
+		})
+	}
+	return items
+}
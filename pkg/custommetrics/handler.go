@@ -0,0 +1,131 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package custommetrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Prefix is the path prefix of custom metrics API served by Handler
+var Prefix = "/apis/" + GroupName + "/" + Version
+
+// Handler serves the discovery of custom metrics API on Prefix and the values
+// of metrics on Prefix/namespaces/{namespace}/loadbalancers.net.alpha.caicloud.io/{name}/{metric},
+// name can be * for all the loadbalancers in namespace
+type Handler struct{}
+
+// NewHandler returns a new custom metrics API handler
+func NewHandler() http.Handler {
+	return &Handler{}
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, Prefix) {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, Prefix), "/")
+	if path == "" {
+		writeJSON(w, http.StatusOK, discovery())
+		return
+	}
+
+	// namespaces/{namespace}/{resource}/{name}/{metric}
+	parts := strings.Split(path, "/")
+	if len(parts) != 5 || parts[0] != "namespaces" {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, fmt.Sprintf("the server could not find the requested resource %v", r.URL.Path))
+		return
+	}
+	namespace, resource, name, metric := parts[1], parts[2], parts[3], parts[4]
+	if resource != resourceName {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, fmt.Sprintf("resource %v is not supported", resource))
+		return
+	}
+	if metric != ActiveConnectionsMetricName && metric != InactiveConnectionsMetricName {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, fmt.Sprintf("metric %v is not supported", metric))
+		return
+	}
+
+	items := values(namespace, name, metric)
+	if name != "*" && len(items) == 0 {
+		writeStatus(w, http.StatusNotFound, metav1.StatusReasonNotFound, fmt.Sprintf("metric %v of loadbalancer %v/%v is not available", metric, namespace, name))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &MetricValueList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "MetricValueList",
+			APIVersion: GroupName + "/" + Version,
+		},
+		ListMeta: metav1.ListMeta{
+			SelfLink: r.URL.Path,
+		},
+		Items: items,
+	})
+}
+
+// discovery returns the metrics served as resources in format {resource}/{metric}
+func discovery() *metav1.APIResourceList {
+	list := &metav1.APIResourceList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "APIResourceList",
+			APIVersion: "v1",
+		},
+		GroupVersion: GroupName + "/" + Version,
+	}
+	for _, metric := range []string{ActiveConnectionsMetricName, InactiveConnectionsMetricName} {
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name:       resourceName + "/" + metric,
+			Namespaced: true,
+			Kind:       "MetricValueList",
+			Verbs:      metav1.Verbs{"get"},
+		})
+	}
+	return list
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason metav1.StatusReason, message string) {
+	writeJSON(w, code, &metav1.Status{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Status",
+			APIVersion: "v1",
+		},
+		Status:  metav1.StatusFailure,
+		Message: message,
+		Reason:  reason,
+		Code:    int32(code),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(obj)
+}
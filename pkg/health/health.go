@@ -0,0 +1,129 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// CheckFunc returns an error if the component is not healthy
+type CheckFunc func() error
+
+type checks struct {
+	lock  sync.RWMutex
+	funcs map[string]CheckFunc
+}
+
+var (
+	liveness  = &checks{funcs: make(map[string]CheckFunc)}
+	readiness = &checks{funcs: make(map[string]CheckFunc)}
+)
+
+// AddLivenessCheck adds a check to /healthz, the controller is restarted if
+// it fails, e.g. workers of a workqueue are stuck
+func AddLivenessCheck(name string, check CheckFunc) {
+	liveness.add(name, check)
+}
+
+// AddReadinessCheck adds a check to /readyz, the controller is not ready to
+// reconcile if it fails, e.g. caches are not synced
+func AddReadinessCheck(name string, check CheckFunc) {
+	readiness.add(name, check)
+}
+
+func (c *checks) add(name string, check CheckFunc) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.funcs[name] = check
+}
+
+// checkResult is the result of a check in response
+type checkResult struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message,omitempty"`
+}
+
+type response struct {
+	Healthy bool          `json:"healthy"`
+	Checks  []checkResult `json:"checks"`
+}
+
+func (c *checks) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	c.lock.RLock()
+	names := make([]string, 0, len(c.funcs))
+	for name := range c.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resp := response{Healthy: true, Checks: make([]checkResult, 0, len(names))}
+	for _, name := range names {
+		result := checkResult{Name: name, Healthy: true}
+		if err := c.funcs[name](); err != nil {
+			result.Healthy = false
+			result.Message = err.Error()
+			resp.Healthy = false
+		}
+		resp.Checks = append(resp.Checks, result)
+	}
+	c.lock.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !resp.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// NewServeMux returns a mux serving /healthz and /readyz
+func NewServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", liveness)
+	mux.Handle("/readyz", readiness)
+	return mux
+}
+
+// Gate is a readiness check which passes once it is opened
+type Gate struct {
+	opened  int32
+	message string
+}
+
+// NewGate adds a closed gate to /readyz, message is reported until it is opened
+func NewGate(name, message string) *Gate {
+	g := &Gate{message: message}
+	AddReadinessCheck(name, g.check)
+	return g
+}
+
+// Open opens the gate
+func (g *Gate) Open() {
+	atomic.StoreInt32(&g.opened, 1)
+}
+
+func (g *Gate) check() error {
+	if atomic.LoadInt32(&g.opened) == 0 {
+		return fmt.Errorf("%s", g.message)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+)
+
+// The exit codes of controller when informers fail persistently, so that
+// orchestration and alerting can tell the causes apart
+const (
+	// ExitCodeForbidden means the list or watch is forbidden, e.g. RBAC of
+	// controller is revoked
+	ExitCodeForbidden = 3
+	// ExitCodeResourceNotFound means the resource is not served, e.g. the
+	// ThirdPartyResource or CRD is deleted
+	ExitCodeResourceNotFound = 4
+	// ExitCodeUnreachable means apiserver can not be reached or failed
+	ExitCodeUnreachable = 5
+)
+
+// recoveryGap is the quiet period after which a failing informer is considered
+// recovered, the reflector retries list and watch every second
+const recoveryGap = 15 * time.Second
+
+// informerFailure records the continuous failures of list and watch of an informer
+type informerFailure struct {
+	code  int
+	first time.Time
+	last  time.Time
+	err   string
+}
+
+// InformerWatchdog watches the list and watch errors of informers, reported
+// through utilruntime.HandleError. The controller is not ready once an
+// informer keeps failing, and it exits if the failure lasts for timeout
+type InformerWatchdog struct {
+	timeout time.Duration
+	// exit is called with the exit code, os.Exit by default
+	exit func(int)
+
+	lock     sync.Mutex
+	failures map[string]*informerFailure
+}
+
+// WatchInformers installs an InformerWatchdog, the controller never exits on
+// informer failures if timeout is 0
+func WatchInformers(timeout time.Duration) *InformerWatchdog {
+	w := &InformerWatchdog{
+		timeout:  timeout,
+		exit:     os.Exit,
+		failures: make(map[string]*informerFailure),
+	}
+	utilruntime.ErrorHandlers = append(utilruntime.ErrorHandlers, w.handleError)
+	AddReadinessCheck("informers", w.check)
+	return w
+}
+
+// handleError records the error if it is a failure of list or watch, and
+// exits if the informer has been failing for timeout
+func (w *InformerWatchdog) handleError(err error) {
+	key, ok := informerKey(err.Error())
+	if !ok {
+		return
+	}
+	code := exitCode(err.Error())
+	now := time.Now()
+
+	w.lock.Lock()
+	f, ok := w.failures[key]
+	if !ok || now.Sub(f.last) > recoveryGap || f.code != code {
+		f = &informerFailure{code: code, first: now}
+		w.failures[key] = f
+	}
+	f.last = now
+	f.err = err.Error()
+	persistent := w.timeout > 0 && now.Sub(f.first) >= w.timeout
+	w.lock.Unlock()
+
+	if persistent {
+		log.Error("Informer keeps failing, exit", log.Fields{"informer": key, "since": f.first, "exitCode": code, "err": err})
+		w.exit(code)
+	}
+}
+
+// check fails if any informer has been failing for more than recovery gap
+func (w *InformerWatchdog) check() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	now := time.Now()
+	failing := make([]string, 0)
+	for key, f := range w.failures {
+		if now.Sub(f.last) > recoveryGap {
+			delete(w.failures, key)
+			continue
+		}
+		if now.Sub(f.first) >= recoveryGap {
+			failing = append(failing, fmt.Sprintf("%s: %s", key, f.err))
+		}
+	}
+	if len(failing) != 0 {
+		return fmt.Errorf("informers keep failing: %s", strings.Join(failing, "; "))
+	}
+	return nil
+}
+
+// informerKey returns the reflector and type of a list or watch failure,
+// the reflector formats it as "<name>: Failed to list <type>: <err>"
+func informerKey(msg string) (string, bool) {
+	for _, verb := range []string{": Failed to list ", ": Failed to watch "} {
+		i := strings.Index(msg, verb)
+		if i < 0 {
+			continue
+		}
+		rest := msg[i+len(verb):]
+		if j := strings.Index(rest, ":"); j >= 0 {
+			rest = rest[:j]
+		}
+		return msg[:i] + " " + rest, true
+	}
+	return "", false
+}
+
+// exitCode classifies the failure by the message of api status error, which
+// is wrapped in text by the reflector
+func exitCode(msg string) int {
+	switch {
+	case strings.Contains(msg, "is forbidden") || strings.Contains(msg, "Unauthorized"):
+		return ExitCodeForbidden
+	case strings.Contains(msg, "the server could not find the requested resource"):
+		return ExitCodeResourceNotFound
+	}
+	return ExitCodeUnreachable
+}
@@ -23,8 +23,8 @@ import (
 
 	informerinternal "github.com/caicloud/loadbalancer-controller/pkg/informers/internalinterfaces"
 	"github.com/caicloud/loadbalancer-controller/pkg/informers/networking"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
 	"github.com/caicloud/loadbalancer-controller/pkg/tprclient"
-	log "github.com/zoumo/logdog"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -52,6 +52,8 @@ type sharedInformerFactory struct {
 
 	lock          sync.Mutex
 	defaultResync time.Duration
+	// scope restricts the namespaces of namespaced objects
+	scope NamespaceScope
 
 	informers map[reflect.Type]cache.SharedIndexInformer
 	// startedInformers is used for tracking which informers have been started.
@@ -61,10 +63,17 @@ type sharedInformerFactory struct {
 
 // NewSharedInformerFactory constructs a new instance of sharedInformerFactory
 func NewSharedInformerFactory(client kubernetes.Interface, tprclient tprclient.Interface, defaultResync time.Duration) SharedInformerFactory {
+	return NewScopedSharedInformerFactory(client, tprclient, defaultResync, NamespaceScope{})
+}
+
+// NewScopedSharedInformerFactory constructs a new instance of sharedInformerFactory
+// whose informers of namespaced objects are restricted to the namespaces of scope
+func NewScopedSharedInformerFactory(client kubernetes.Interface, tprclient tprclient.Interface, defaultResync time.Duration, scope NamespaceScope) SharedInformerFactory {
 	return &sharedInformerFactory{
 		client:           client,
 		tprclient:        tprclient,
 		defaultResync:    defaultResync,
+		scope:            scope,
 		informers:        make(map[reflect.Type]cache.SharedIndexInformer),
 		startedInformers: make(map[reflect.Type]bool),
 	}
@@ -119,7 +128,9 @@ func (f *sharedInformerFactory) InformerFor(obj runtime.Object, newFunc internal
 	if exists {
 		return informer
 	}
-	informer = newFunc(f.client, f.defaultResync)
+	informer = f.newInformer(obj, func() cache.SharedIndexInformer {
+		return newFunc(f.client, f.defaultResync)
+	})
 	f.informers[informerType] = informer
 
 	return informer
@@ -137,12 +148,29 @@ func (f *sharedInformerFactory) TPRInformerFor(obj runtime.Object, newFunc infor
 		return informer
 	}
 
-	informer = newFunc(f.tprclient, f.defaultResync)
+	informer = f.newInformer(obj, func() cache.SharedIndexInformer {
+		return newFunc(f.tprclient, f.defaultResync)
+	})
 	f.informers[informerType] = informer
 
 	return informer
 }
 
+// newInformer creates the informer of obj in the namespaces of scope if it is
+// restricted, otherwise the cluster wide one is created by newFunc
+func (f *sharedInformerFactory) newInformer(obj runtime.Object, newFunc func() cache.SharedIndexInformer) cache.SharedIndexInformer {
+	if f.scope.unrestricted() {
+		return newFunc()
+	}
+	newListWatch, ok := f.listWatchFuncFor(obj)
+	if !ok {
+		// cluster scoped objects are not restricted
+		return newFunc()
+	}
+	log.Debug("Scope informer to namespaces", log.Fields{"type": reflect.TypeOf(obj), "allow": f.scope.Allow, "deny": f.scope.Deny})
+	return f.newScopedInformer(obj, newListWatch)
+}
+
 // Client returns kubernetes clientset
 func (f *sharedInformerFactory) Client() kubernetes.Interface {
 	return f.client
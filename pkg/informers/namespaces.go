@@ -0,0 +1,273 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informers
+
+import (
+	"sync"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	stringsutil "github.com/caicloud/loadbalancer-controller/pkg/util/strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/pkg/api/v1"
+	batchv1 "k8s.io/client-go/pkg/apis/batch/v1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NamespaceScope restricts the namespaces of the objects cached by informers.
+// The namespaced objects are listed and watched in each namespace of Allow,
+// or in all namespaces except the ones of Deny. Cluster scoped objects, e.g.
+// nodes, are not restricted. All namespaces are watched if both are empty
+type NamespaceScope struct {
+	Allow []string
+	Deny  []string
+}
+
+// Watched returns true if the objects in namespace are watched
+func (s NamespaceScope) Watched(namespace string) bool {
+	if len(s.Allow) != 0 {
+		return stringsutil.StringInSlice(namespace, s.Allow)
+	}
+	return !stringsutil.StringInSlice(namespace, s.Deny)
+}
+
+// unrestricted returns true if all namespaces are watched
+func (s NamespaceScope) unrestricted() bool {
+	return len(s.Allow) == 0 && len(s.Deny) == 0
+}
+
+// listWatchFunc returns the ListWatch of the objects in namespace
+type listWatchFunc func(namespace string) *cache.ListWatch
+
+// listWatchFuncFor returns the listWatchFunc of the namespaced objects of the
+// type of obj, false is returned if the type is cluster scoped or unknown
+func (f *sharedInformerFactory) listWatchFuncFor(obj runtime.Object) (listWatchFunc, bool) {
+	var getter cache.Getter
+	var resource string
+	switch obj.(type) {
+	case *netv1alpha1.LoadBalancer:
+		// loadbalancers are decoded by the typed client
+		return func(namespace string) *cache.ListWatch {
+			return &cache.ListWatch{
+				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+					return f.tprclient.NetworkingV1alpha1().LoadBalancers(namespace).List(options)
+				},
+				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+					return f.tprclient.NetworkingV1alpha1().LoadBalancers(namespace).Watch(options)
+				},
+			}
+		}, true
+	case *v1.Pod:
+		getter, resource = f.client.CoreV1().RESTClient(), "pods"
+	case *v1.ConfigMap:
+		getter, resource = f.client.CoreV1().RESTClient(), "configmaps"
+	case *v1.Secret:
+		getter, resource = f.client.CoreV1().RESTClient(), "secrets"
+	case *v1.Service:
+		getter, resource = f.client.CoreV1().RESTClient(), "services"
+	case *v1.Endpoints:
+		getter, resource = f.client.CoreV1().RESTClient(), "endpoints"
+	case *extensions.Deployment:
+		getter, resource = f.client.ExtensionsV1beta1().RESTClient(), "deployments"
+	case *extensions.DaemonSet:
+		getter, resource = f.client.ExtensionsV1beta1().RESTClient(), "daemonsets"
+	case *extensions.ReplicaSet:
+		getter, resource = f.client.ExtensionsV1beta1().RESTClient(), "replicasets"
+	case *batchv1.Job:
+		getter, resource = f.client.BatchV1().RESTClient(), "jobs"
+	default:
+		return nil, false
+	}
+	return func(namespace string) *cache.ListWatch {
+		return cache.NewListWatchFromClient(getter, resource, namespace, fields.Everything())
+	}, true
+}
+
+// newScopedInformer creates an informer of the objects of the type of obj in
+// the namespaces of scope
+func (f *sharedInformerFactory) newScopedInformer(obj runtime.Object, newListWatch listWatchFunc) cache.SharedIndexInformer {
+	var lw cache.ListerWatcher
+	if len(f.scope.Allow) != 0 {
+		lws := make(namespacesListWatch, 0, len(f.scope.Allow))
+		for _, namespace := range f.scope.Allow {
+			lws = append(lws, newListWatch(namespace))
+		}
+		lw = lws
+	} else {
+		lw = &deniedListWatch{ListWatch: newListWatch(metav1.NamespaceAll), scope: f.scope}
+	}
+	return cache.NewSharedIndexInformer(lw, obj, f.defaultResync, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+// namespacesListWatch lists and watches the objects in several namespaces
+type namespacesListWatch []*cache.ListWatch
+
+// List lists the objects in all namespaces into the list of the first one,
+// whose resource version is the oldest, so that no event is missed by the
+// watches started from it
+func (lws namespacesListWatch) List(options metav1.ListOptions) (runtime.Object, error) {
+	var list runtime.Object
+	var items []runtime.Object
+	for _, lw := range lws {
+		l, err := lw.List(options)
+		if err != nil {
+			return nil, err
+		}
+		objs, err := meta.ExtractList(l)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, objs...)
+		if list == nil {
+			list = l
+		}
+	}
+	if err := meta.SetList(list, items); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Watch watches the objects in all namespaces
+func (lws namespacesListWatch) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	watches := make([]watch.Interface, 0, len(lws))
+	for _, lw := range lws {
+		w, err := lw.Watch(options)
+		if err != nil {
+			for _, started := range watches {
+				started.Stop()
+			}
+			return nil, err
+		}
+		watches = append(watches, w)
+	}
+	return newMergedWatch(watches), nil
+}
+
+// mergedWatch merges the events of several watches, it is stopped once any
+// of them ends, so that the reflector relists and watches again
+type mergedWatch struct {
+	watches []watch.Interface
+	result  chan watch.Event
+	stopCh  chan struct{}
+	once    sync.Once
+}
+
+func newMergedWatch(watches []watch.Interface) *mergedWatch {
+	m := &mergedWatch{
+		watches: watches,
+		result:  make(chan watch.Event),
+		stopCh:  make(chan struct{}),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(watches))
+	for _, w := range watches {
+		go func(w watch.Interface) {
+			defer wg.Done()
+			defer m.Stop()
+			for {
+				select {
+				case event, ok := <-w.ResultChan():
+					if !ok {
+						return
+					}
+					select {
+					case m.result <- event:
+					case <-m.stopCh:
+						return
+					}
+				case <-m.stopCh:
+					return
+				}
+			}
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		close(m.result)
+	}()
+	return m
+}
+
+// Stop stops all watches
+func (m *mergedWatch) Stop() {
+	m.once.Do(func() {
+		close(m.stopCh)
+		for _, w := range m.watches {
+			w.Stop()
+		}
+	})
+}
+
+// ResultChan returns the merged events
+func (m *mergedWatch) ResultChan() <-chan watch.Event {
+	return m.result
+}
+
+// deniedListWatch lists and watches the objects in all namespaces, the ones
+// in the namespaces denied by scope are filtered out
+type deniedListWatch struct {
+	*cache.ListWatch
+	scope NamespaceScope
+}
+
+// List lists the objects in the namespaces watched
+func (lw *deniedListWatch) List(options metav1.ListOptions) (runtime.Object, error) {
+	list, err := lw.ListWatch.List(options)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]runtime.Object, 0, len(objs))
+	for _, obj := range objs {
+		if lw.watched(obj) {
+			items = append(items, obj)
+		}
+	}
+	if err := meta.SetList(list, items); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Watch watches the objects in the namespaces watched
+func (lw *deniedListWatch) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	w, err := lw.ListWatch.Watch(options)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		return event, event.Type == watch.Error || lw.watched(event.Object)
+	}), nil
+}
+
+func (lw *deniedListWatch) watched(obj runtime.Object) bool {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return true
+	}
+	return lw.scope.Watched(accessor.GetNamespace())
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipam
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// ParsePools parses a comma separated list of IPv4 CIDRs
+func ParsePools(value string) ([]*net.IPNet, error) {
+	pools := make([]*net.IPNet, 0)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		_, pool, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, err
+		}
+		if pool.IP.To4() == nil {
+			return nil, fmt.Errorf("only IPv4 pool is supported: %v", part)
+		}
+		pools = append(pools, pool)
+	}
+	return pools, nil
+}
+
+// Allocator allocates addresses from pools. The addresses in use are given
+// by caller, allocations not yet observed by caller are recorded in memory.
+// The released addresses are quarantined for a cool-down before reuse
+type Allocator struct {
+	lock     sync.Mutex
+	pools    []*net.IPNet
+	cooldown time.Duration
+	// allocated is keyed by owner
+	allocated map[string]string
+	// coolingDown is the time when the cool-down of address ends
+	coolingDown map[string]time.Time
+}
+
+// NewAllocator creates a new Allocator for pools, the released addresses are
+// not allocated again within cooldown
+func NewAllocator(pools []*net.IPNet, cooldown time.Duration) *Allocator {
+	return &Allocator{
+		pools:       pools,
+		cooldown:    cooldown,
+		allocated:   make(map[string]string),
+		coolingDown: make(map[string]time.Time),
+	}
+}
+
+// Allocate returns the address allocated to owner, a new one is allocated
+// from pools if the owner has none. The network and broadcast addresses of
+// pools are never allocated
+func (a *Allocator) Allocate(owner string, used sets.String) (string, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if ip, ok := a.allocated[owner]; ok && !used.Has(ip) {
+		return ip, nil
+	}
+
+	inUse := sets.NewString(used.List()...)
+	a.expire()
+	for ip := range a.coolingDown {
+		inUse.Insert(ip)
+	}
+	for o, ip := range a.allocated {
+		if o != owner {
+			inUse.Insert(ip)
+		}
+	}
+
+	for _, pool := range a.pools {
+		ones, bits := pool.Mask.Size()
+		size := uint32(1) << uint(bits-ones)
+		base := binary.BigEndian.Uint32(pool.IP.To4())
+		for i := uint32(1); i+1 < size; i++ {
+			ip := make(net.IP, net.IPv4len)
+			binary.BigEndian.PutUint32(ip, base+i)
+			if inUse.Has(ip.String()) {
+				continue
+			}
+			a.allocated[owner] = ip.String()
+			return ip.String(), nil
+		}
+	}
+
+	return "", fmt.Errorf("no available address in pools %v", a.pools)
+}
+
+// Release forgets the address allocated to owner, it is quarantined along
+// with the addresses which owner was using
+func (a *Allocator) Release(owner string, addresses ...string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if ip, ok := a.allocated[owner]; ok {
+		addresses = append(addresses, ip)
+	}
+	delete(a.allocated, owner)
+
+	if a.cooldown <= 0 {
+		return
+	}
+	until := time.Now().Add(a.cooldown)
+	for _, ip := range addresses {
+		if a.contains(ip) {
+			a.coolingDown[ip] = until
+		}
+	}
+}
+
+// Quarantined returns the number of addresses in cool-down
+func (a *Allocator) Quarantined() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.expire()
+	return len(a.coolingDown)
+}
+
+// expire forgets the addresses whose cool-down ended
+func (a *Allocator) expire() {
+	now := time.Now()
+	for ip, until := range a.coolingDown {
+		if !now.Before(until) {
+			delete(a.coolingDown, ip)
+		}
+	}
+}
+
+// contains returns true if ip is in pools
+func (a *Allocator) contains(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, pool := range a.pools {
+		if pool.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
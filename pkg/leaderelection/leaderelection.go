@@ -0,0 +1,259 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package leaderelection implements leader election of a set of controllers
+// using an annotation on a ConfigMap as the lock. It follows the same record
+// format as k8s.io/client-go/tools/leaderelection, so the lock can be inspected
+// by the same tooling.
+package leaderelection
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// LeaderElectionRecordAnnotationKey is the annotation key of leader election record
+	LeaderElectionRecordAnnotationKey = "control-plane.alpha.kubernetes.io/leader"
+)
+
+// Record is the record that is stored in the leader election annotation.
+type Record struct {
+	HolderIdentity       string      `json:"holderIdentity"`
+	LeaseDurationSeconds int         `json:"leaseDurationSeconds"`
+	AcquireTime          metav1.Time `json:"acquireTime"`
+	RenewTime            metav1.Time `json:"renewTime"`
+	LeaderTransitions    int         `json:"leaderTransitions"`
+}
+
+// Callbacks are callbacks that are triggered during certain lifecycle
+// events of the LeaderElector
+type Callbacks struct {
+	// OnStartedLeading is called when a LeaderElector client starts leading
+	OnStartedLeading func(stop <-chan struct{})
+	// OnStoppedLeading is called when a LeaderElector client stops leading
+	OnStoppedLeading func()
+}
+
+// Config contains the configuration of leader elector
+type Config struct {
+	Client kubernetes.Interface
+	// Namespace and Name of the ConfigMap used as lock
+	Namespace string
+	Name      string
+	// Identity is the unique identity of this candidate
+	Identity string
+
+	// LeaseDuration is the duration that non-leader candidates will
+	// wait to force acquire leadership.
+	LeaseDuration time.Duration
+	// RenewDeadline is the duration that the acting master will retry
+	// refreshing leadership before giving up.
+	RenewDeadline time.Duration
+	// RetryPeriod is the duration the LeaderElector clients should wait
+	// between tries of actions.
+	RetryPeriod time.Duration
+
+	Callbacks Callbacks
+}
+
+// LeaderElector is a leader election client.
+type LeaderElector struct {
+	config Config
+
+	observedRecord Record
+	observedTime   time.Time
+}
+
+// NewLeaderElector creates a LeaderElector from a Config
+func NewLeaderElector(config Config) (*LeaderElector, error) {
+	if config.LeaseDuration <= config.RenewDeadline {
+		return nil, fmt.Errorf("leaseDuration must be greater than renewDeadline")
+	}
+	if config.RenewDeadline <= config.RetryPeriod {
+		return nil, fmt.Errorf("renewDeadline must be greater than retryPeriod")
+	}
+	if config.Callbacks.OnStartedLeading == nil {
+		return nil, fmt.Errorf("OnStartedLeading callback must not be nil")
+	}
+	if config.Callbacks.OnStoppedLeading == nil {
+		return nil, fmt.Errorf("OnStoppedLeading callback must not be nil")
+	}
+	if config.Identity == "" {
+		return nil, fmt.Errorf("identity must not be empty")
+	}
+	return &LeaderElector{
+		config: config,
+	}, nil
+}
+
+// Run starts the leader election loop, it blocks until leadership is lost
+func (le *LeaderElector) Run() {
+	defer func() {
+		utilruntime.HandleCrash()
+		le.config.Callbacks.OnStoppedLeading()
+	}()
+	le.acquire()
+	stop := make(chan struct{})
+	go le.config.Callbacks.OnStartedLeading(stop)
+	le.renew()
+	close(stop)
+}
+
+// acquire loops calling tryAcquireOrRenew and returns immediately when tryAcquireOrRenew succeeds.
+func (le *LeaderElector) acquire() {
+	stop := make(chan struct{})
+	log.Info("Attempting to acquire leader lease", log.Fields{"lock": le.lockName()})
+	wait.JitterUntil(func() {
+		succeeded := le.tryAcquireOrRenew()
+		if !succeeded {
+			log.Debug("Failed to acquire lease", log.Fields{"lock": le.lockName(), "leader": le.observedRecord.HolderIdentity})
+			return
+		}
+		log.Info("Successfully acquired lease", log.Fields{"lock": le.lockName(), "identity": le.config.Identity})
+		close(stop)
+	}, le.config.RetryPeriod, 1.2, true, stop)
+}
+
+// renew loops calling tryAcquireOrRenew and returns immediately when tryAcquireOrRenew fails.
+func (le *LeaderElector) renew() {
+	stop := make(chan struct{})
+	wait.Until(func() {
+		err := wait.PollImmediate(le.config.RetryPeriod, le.config.RenewDeadline, func() (bool, error) {
+			return le.tryAcquireOrRenew(), nil
+		})
+		if err == nil {
+			return
+		}
+		log.Error("Failed to renew lease", log.Fields{"lock": le.lockName(), "err": err})
+		close(stop)
+	}, 0, stop)
+}
+
+// tryAcquireOrRenew tries to acquire a leader lease if it is not already acquired,
+// else it tries to renew the lease if it has already been acquired. Returns true
+// on success else returns false.
+func (le *LeaderElector) tryAcquireOrRenew() bool {
+	now := metav1.Now()
+	record := Record{
+		HolderIdentity:       le.config.Identity,
+		LeaseDurationSeconds: int(le.config.LeaseDuration / time.Second),
+		RenewTime:            now,
+		AcquireTime:          now,
+	}
+
+	configMaps := le.config.Client.CoreV1().ConfigMaps(le.config.Namespace)
+
+	// 1. obtain or create the lock
+	cm, err := configMaps.Get(le.config.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		cm, err = le.newLock(record)
+		if err != nil {
+			log.Error("Error initially creating leader election record", log.Fields{"err": err})
+			return false
+		}
+		_, err = configMaps.Create(cm)
+		if err != nil {
+			log.Error("Error initially creating leader election record", log.Fields{"err": err})
+			return false
+		}
+		le.observedRecord = record
+		le.observedTime = time.Now()
+		return true
+	}
+	if err != nil {
+		log.Error("Error retrieving resource lock", log.Fields{"lock": le.lockName(), "err": err})
+		return false
+	}
+
+	oldRecord := Record{}
+	if raw, found := cm.Annotations[LeaderElectionRecordAnnotationKey]; found {
+		if err := json.Unmarshal([]byte(raw), &oldRecord); err != nil {
+			log.Error("Error unmarshal leader election record", log.Fields{"err": err})
+			return false
+		}
+	}
+
+	// 2. record exists, check identity & time
+	if !reflect.DeepEqual(le.observedRecord, oldRecord) {
+		le.observedRecord = oldRecord
+		le.observedTime = time.Now()
+	}
+	if le.observedTime.Add(le.config.LeaseDuration).After(now.Time) &&
+		oldRecord.HolderIdentity != le.config.Identity {
+		// lock is held by others and has not expired
+		return false
+	}
+
+	// 3. we're going to try to update. The leaderElectionRecord is set to it's default
+	// here. Let's correct it before updating.
+	if oldRecord.HolderIdentity == le.config.Identity {
+		record.AcquireTime = oldRecord.AcquireTime
+		record.LeaderTransitions = oldRecord.LeaderTransitions
+	} else {
+		record.LeaderTransitions = oldRecord.LeaderTransitions + 1
+	}
+
+	raw, err := json.Marshal(record)
+	if err != nil {
+		log.Error("Error marshal leader election record", log.Fields{"err": err})
+		return false
+	}
+	if cm.Annotations == nil {
+		cm.Annotations = map[string]string{}
+	}
+	cm.Annotations[LeaderElectionRecordAnnotationKey] = string(raw)
+
+	// update the lock itself, update will fail if the lock has been changed by others
+	if _, err := configMaps.Update(cm); err != nil {
+		log.Error("Failed to update lock", log.Fields{"lock": le.lockName(), "err": err})
+		return false
+	}
+	le.observedRecord = record
+	le.observedTime = time.Now()
+	return true
+}
+
+func (le *LeaderElector) newLock(record Record) (*v1.ConfigMap, error) {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: le.config.Namespace,
+			Name:      le.config.Name,
+			Annotations: map[string]string{
+				LeaderElectionRecordAnnotationKey: string(raw),
+			},
+		},
+	}, nil
+}
+
+func (le *LeaderElector) lockName() string {
+	return le.config.Namespace + "/" + le.config.Name
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/zoumo/logdog"
+)
+
+// Formats of log entries
+const (
+	// FormatText writes human readable entries with logdog
+	FormatText = "text"
+	// FormatJSON writes an entry per line in json, fields are at top level
+	// so that log pipelines can index them
+	FormatJSON = "json"
+	// FormatGlog writes entries with glog, in the same format as kubernetes components
+	FormatGlog = "glog"
+)
+
+// Formats are all the supported formats
+var Formats = []string{FormatText, FormatJSON, FormatGlog}
+
+// NewBackend returns the builtin backend of format
+func NewBackend(format string, forceColor bool) (Backend, error) {
+	switch format {
+	case FormatText, "":
+		logdog.ForceColor = forceColor
+		return newTextBackend(), nil
+	case FormatJSON:
+		return &jsonBackend{out: os.Stderr}, nil
+	case FormatGlog:
+		// glog writes to files by default
+		flag.Set("logtostderr", "true")
+		return glogBackend{}, nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, must be one of %s", format, strings.Join(Formats, ", "))
+}
+
+var logdogLevels = map[Level]logdog.Level{
+	DebugLevel:  logdog.DebugLevel,
+	InfoLevel:   logdog.InfoLevel,
+	NoticeLevel: logdog.NoticeLevel,
+	WarnLevel:   logdog.WarnLevel,
+	ErrorLevel:  logdog.ErrorLevel,
+	FatalLevel:  logdog.FatalLevel,
+}
+
+// textBackend is the adapter of logdog
+type textBackend struct {
+	logger *logdog.Logger
+}
+
+func newTextBackend() *textBackend {
+	return &textBackend{
+		// levels are filtered by loggers, logdog.Logger.Log and log are
+		// two more frames between runtime.Caller and the caller of logger
+		logger: logdog.NewLogger(
+			logdog.OptionHandlers(logdog.NewStreamHandler()),
+			logdog.OptionCallerStackDepth(CallerDepth+2),
+			logdog.DebugLevel,
+		),
+	}
+}
+
+func (b *textBackend) Write(level Level, name, msg string, fields Fields) {
+	if name != "" {
+		fields["logger"] = name
+	}
+	if len(fields) == 0 {
+		b.logger.Log(logdogLevels[level], msg)
+		return
+	}
+	b.logger.Log(logdogLevels[level], msg, logdog.Fields(fields))
+}
+
+// jsonBackend writes an entry per line in json
+type jsonBackend struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (b *jsonBackend) Write(level Level, name, msg string, fields Fields) {
+	entry := make(map[string]interface{}, len(fields)+5)
+	for k, v := range fields {
+		switch value := v.(type) {
+		case error:
+			entry[k] = value.Error()
+		case time.Duration:
+			entry[k] = value.String()
+		default:
+			entry[k] = v
+		}
+	}
+	entry["time"] = time.Now().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = msg
+	if name != "" {
+		entry["logger"] = name
+	}
+	if _, file, line, ok := runtime.Caller(CallerDepth); ok {
+		entry["caller"] = fmt.Sprintf("%s:%d", path.Base(file), line)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{
+			"time":  entry["time"],
+			"level": entry["level"],
+			"msg":   msg,
+			"error": fmt.Sprintf("marshal fields of entry error: %v", err),
+		})
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.out.Write(append(data, '\n'))
+}
+
+// glogBackend is the adapter of glog, fields are appended to message as key=value
+type glogBackend struct{}
+
+func (glogBackend) Write(level Level, name, msg string, fields Fields) {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	line := msg
+	if name != "" {
+		line = fmt.Sprintf("%s logger=%s", line, name)
+	}
+	for _, k := range keys {
+		line = fmt.Sprintf("%s %s=%v", line, k, fields[k])
+	}
+
+	switch level {
+	case DebugLevel, InfoLevel, NoticeLevel:
+		glog.InfoDepth(CallerDepth, line)
+	case WarnLevel:
+		glog.WarningDepth(CallerDepth, line)
+	default:
+		// glog.FatalDepth exits, the caller decides whether to exit
+		glog.ErrorDepth(CallerDepth, line)
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package log is the structured logger of controller and plugins. Entries are
+// written by a pluggable Backend, the adapter of a logging library, and each
+// plugin logs with its own named Logger whose level can be set separately
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Fields are the key-value pairs of a log entry, e.g. lb.ns and lb.name
+type Fields map[string]interface{}
+
+// Level is the severity of a log entry
+type Level int
+
+// These are the levels of log entries, from the least severe
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	NoticeLevel
+	WarnLevel
+	ErrorLevel
+	FatalLevel
+)
+
+var levelNames = []string{"debug", "info", "notice", "warn", "error", "fatal"}
+
+func (l Level) String() string {
+	if l < DebugLevel || l > FatalLevel {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level of name, case insensitive
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(n, name) {
+			return Level(i), nil
+		}
+	}
+	return DebugLevel, fmt.Errorf("unknown log level %q, must be one of %s", name, strings.Join(levelNames, ", "))
+}
+
+// ParseLevels parses a comma separated list of name=level, e.g. ipvsdr=debug,nginx=warn
+func ParseLevels(s string) (map[string]Level, error) {
+	levels := make(map[string]Level)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid log level %q, must be in the format of name=level", pair)
+		}
+		level, err := ParseLevel(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		levels[parts[0]] = level
+	}
+	return levels, nil
+}
+
+// Logger is a structured logger, an entry consists of a constant message and
+// optional fields. Fatal and Panic log at FatalLevel, Panic panics afterwards
+type Logger interface {
+	Debug(msg string, fields ...Fields)
+	Info(msg string, fields ...Fields)
+	Notice(msg string, fields ...Fields)
+	Warn(msg string, fields ...Fields)
+	Error(msg string, fields ...Fields)
+	Fatal(msg string, fields ...Fields)
+	Panic(msg string, fields ...Fields)
+}
+
+// Backend writes the log entries passed the level of logger. It is called by
+// the logger CallerDepth frames below the caller of logger
+type Backend interface {
+	Write(level Level, name, msg string, fields Fields)
+}
+
+// CallerDepth is the number of frames between Backend.Write and the caller of
+// logger, backends reporting the caller skip them
+const CallerDepth = 3
+
+var (
+	mu      sync.RWMutex
+	backend Backend = newTextBackend()
+	// level is the default level of loggers
+	level = InfoLevel
+	// levels are the levels of named loggers overriding the default level
+	levels = map[string]Level{}
+
+	std = &logger{}
+)
+
+// Options configures the backend and levels of loggers
+type Options struct {
+	// Format is the format of entries, one of text, json and glog
+	Format string
+	// Level is the default level of loggers
+	Level Level
+	// Levels are the levels of named loggers, e.g. plugins
+	Levels map[string]Level
+	// ForceColor forces text format to output with color
+	ForceColor bool
+}
+
+// Configure applies options to all the loggers
+func Configure(opts Options) error {
+	b, err := NewBackend(opts.Format, opts.ForceColor)
+	if err != nil {
+		return err
+	}
+	SetBackend(b)
+
+	mu.Lock()
+	defer mu.Unlock()
+	level = opts.Level
+	levels = make(map[string]Level, len(opts.Levels))
+	for name, l := range opts.Levels {
+		levels[name] = l
+	}
+	return nil
+}
+
+// SetBackend replaces the backend of all the loggers
+func SetBackend(b Backend) {
+	mu.Lock()
+	defer mu.Unlock()
+	backend = b
+}
+
+// For returns the logger named name, the name is added to fields of entries
+// and its level can be set by Options.Levels
+func For(name string) Logger {
+	return &logger{name: name}
+}
+
+type logger struct {
+	name string
+}
+
+func (l *logger) enabled(lv Level) (Backend, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	min, ok := levels[l.name]
+	if !ok {
+		min = level
+	}
+	return backend, lv >= min
+}
+
+func (l *logger) output(lv Level, msg string, fields []Fields) {
+	b, ok := l.enabled(lv)
+	if !ok {
+		return
+	}
+	merged := make(Fields)
+	for _, f := range fields {
+		for k, v := range f {
+			merged[k] = v
+		}
+	}
+	b.Write(lv, l.name, msg, merged)
+}
+
+func (l *logger) Debug(msg string, fields ...Fields)  { l.output(DebugLevel, msg, fields) }
+func (l *logger) Info(msg string, fields ...Fields)   { l.output(InfoLevel, msg, fields) }
+func (l *logger) Notice(msg string, fields ...Fields) { l.output(NoticeLevel, msg, fields) }
+func (l *logger) Warn(msg string, fields ...Fields)   { l.output(WarnLevel, msg, fields) }
+func (l *logger) Error(msg string, fields ...Fields)  { l.output(ErrorLevel, msg, fields) }
+func (l *logger) Fatal(msg string, fields ...Fields)  { l.output(FatalLevel, msg, fields) }
+
+func (l *logger) Panic(msg string, fields ...Fields) {
+	l.output(FatalLevel, msg, fields)
+	panic(msg)
+}
+
+// Debug logs with the default logger at DebugLevel
+func Debug(msg string, fields ...Fields) { std.output(DebugLevel, msg, fields) }
+
+// Info logs with the default logger at InfoLevel
+func Info(msg string, fields ...Fields) { std.output(InfoLevel, msg, fields) }
+
+// Notice logs with the default logger at NoticeLevel
+func Notice(msg string, fields ...Fields) { std.output(NoticeLevel, msg, fields) }
+
+// Warn logs with the default logger at WarnLevel
+func Warn(msg string, fields ...Fields) { std.output(WarnLevel, msg, fields) }
+
+// Error logs with the default logger at ErrorLevel
+func Error(msg string, fields ...Fields) { std.output(ErrorLevel, msg, fields) }
+
+// Fatal logs with the default logger at FatalLevel, the caller decides whether to exit
+func Fatal(msg string, fields ...Fields) { std.output(FatalLevel, msg, fields) }
+
+// Panic logs with the default logger at FatalLevel and panics
+func Panic(msg string, fields ...Fields) {
+	std.output(FatalLevel, msg, fields)
+	panic(msg)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"expvar"
+	"fmt"
+	"strings"
+)
+
+// Actions of ControllerRefManager
+const (
+	// ActionClaimed means the object is already owned by the controller
+	ActionClaimed = "claimed"
+	// ActionAdopted means the orphan object is adopted by the controller
+	ActionAdopted = "adopted"
+	// ActionReleased means the owned object is orphaned by the controller
+	ActionReleased = "released"
+	// ActionIgnored means the object matches selector but is owned by others
+	ActionIgnored = "ignored"
+)
+
+var (
+	// ControllerRef counts the decisions of ControllerRefManager,
+	// keyed by kind and action, e.g. deployment_adopted
+	ControllerRef = expvar.NewMap("loadbalancer_controller_ref")
+
+	// ScaledToZero counts the unexpected deployments scaled to zero, keyed by plugin
+	ScaledToZero = expvar.NewMap("loadbalancer_unexpected_deployments_scaled_to_zero")
+
+	// CanaryPaused is 1 if the rollout of canary image is paused, keyed by plugin
+	CanaryPaused = expvar.NewMap("loadbalancer_canary_paused")
+
+	// ImageUnavailable is 1 if the image of all pods of a loadbalancer can
+	// not be pulled, keyed by plugin and loadbalancer, e.g. ipvsdr_ns/name
+	ImageUnavailable = expvar.NewMap("loadbalancer_image_unavailable")
+
+	// GarbageCollected counts the resources orphaned by deleted loadbalancers
+	// and collected by the controller, keyed by kind
+	GarbageCollected = expvar.NewMap("loadbalancer_garbage_collected")
+
+	// IpvsdrFailovers counts the moves of VRRP master of ipvsdr provider
+	// between nodes, keyed by loadbalancer, e.g. ns/name
+	IpvsdrFailovers = expvar.NewMap("loadbalancer_ipvsdr_failovers")
+
+	// UnreconciledDiffs counts the fields where the desired object differs
+	// from the live one after the ensure logic, keyed by plugin, kind and
+	// field, e.g. nginx_deployment_spec.template.spec.containers[].env
+	UnreconciledDiffs = expvar.NewMap("loadbalancer_unreconciled_differences")
+
+	// IpvsdrQuarantined is the number of vips and VRIDs released by ipvsdr
+	// providers and not allocatable until the cool-down ends, keyed by vip
+	// and vrid
+	IpvsdrQuarantined = expvar.NewMap("loadbalancer_ipvsdr_quarantined")
+
+	// PluginChanges counts the objects written by plugins, keyed by plugin,
+	// kind and action, e.g. nginx_deployment_updated
+	PluginChanges = expvar.NewMap("loadbalancer_plugin_changes")
+
+	// PluginSyncs counts the reconciles of plugins, keyed by plugin and
+	// outcome, e.g. ipvsdr_failed
+	PluginSyncs = expvar.NewMap("loadbalancer_plugin_syncs")
+
+	// StatusWrites counts the status fragments published to the status writer
+	// and the patches of status, keyed by published, patched and conflicted
+	StatusWrites = expvar.NewMap("loadbalancer_status_writes")
+)
+
+// SetImageUnavailable records whether the image of pods of plugin for the
+// loadbalancer can be pulled
+func SetImageUnavailable(plugin, key string, unavailable bool) {
+	name := fmt.Sprintf("%s_%s", plugin, key)
+	if !unavailable {
+		ImageUnavailable.Delete(name)
+		return
+	}
+	v := new(expvar.Int)
+	v.Set(1)
+	ImageUnavailable.Set(name, v)
+}
+
+// IncUnreconciledDiff increases the counter of the unreconciled field of the
+// kind of object generated by plugin
+func IncUnreconciledDiff(plugin, kind, field string) {
+	UnreconciledDiffs.Add(fmt.Sprintf("%s_%s_%s", plugin, strings.ToLower(kind), field), 1)
+}
+
+// IncControllerRef increases the counter of the action on the kind of object
+func IncControllerRef(kind, action string) {
+	ControllerRef.Add(fmt.Sprintf("%s_%s", strings.ToLower(kind), action), 1)
+}
+
+// IncPluginChange increases the counter of the action of plugin on the kind
+// of object
+func IncPluginChange(plugin, kind, action string) {
+	PluginChanges.Add(fmt.Sprintf("%s_%s_%s", plugin, strings.ToLower(kind), action), 1)
+}
+
+// IncPluginSync increases the counter of the reconciles of plugin by outcome
+func IncPluginSync(plugin string, succeeded bool) {
+	outcome := "succeeded"
+	if !succeeded {
+		outcome = "failed"
+	}
+	PluginSyncs.Add(fmt.Sprintf("%s_%s", plugin, outcome), 1)
+}
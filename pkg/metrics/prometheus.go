@@ -0,0 +1,80 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// prefix is the prefix of the expvars of controller exposed to Prometheus
+const prefix = "loadbalancer_"
+
+// Handler serves the expvars of controller in Prometheus text format. Each
+// variable is a gauge, the entries of maps are labeled with their keys
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		expvar.Do(func(kv expvar.KeyValue) {
+			if !strings.HasPrefix(kv.Key, prefix) {
+				return
+			}
+			writeVar(&buf, kv.Key, kv.Value)
+		})
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(buf.Bytes())
+	})
+}
+
+// writeVar writes the samples of a numeric variable or a map of them, the
+// others are skipped
+func writeVar(buf *bytes.Buffer, name string, v expvar.Var) {
+	switch v := v.(type) {
+	case *expvar.Map:
+		var samples []string
+		v.Do(func(kv expvar.KeyValue) {
+			if value, ok := sampleValue(kv.Value); ok {
+				samples = append(samples, fmt.Sprintf("%s{key=%s} %s\n", name, strconv.Quote(kv.Key), value))
+			}
+		})
+		if len(samples) == 0 {
+			return
+		}
+		sort.Strings(samples)
+		fmt.Fprintf(buf, "# TYPE %s gauge\n", name)
+		for _, sample := range samples {
+			buf.WriteString(sample)
+		}
+	default:
+		if value, ok := sampleValue(v); ok {
+			fmt.Fprintf(buf, "# TYPE %s gauge\n%s %s\n", name, name, value)
+		}
+	}
+}
+
+func sampleValue(v expvar.Var) (string, bool) {
+	switch v := v.(type) {
+	case *expvar.Int, *expvar.Float:
+		return v.String(), true
+	}
+	return "", false
+}
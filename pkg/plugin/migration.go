@@ -0,0 +1,89 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"time"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// migrationCheckInterval is the interval a loadbalancer is synced again while
+// its pods are handed over from a legacy deployment
+const migrationCheckInterval = 5 * time.Second
+
+// migrationReplicas returns the replicas of the active deployment while the
+// pods are handed over from source, the total number of replicas is kept
+func migrationReplicas(desired int32, source *extensions.Deployment) int32 {
+	replicas := desired - *source.Spec.Replicas
+	if replicas < 0 {
+		return 0
+	}
+	return replicas
+}
+
+// deploymentSettled returns true if the latest spec of deployment is observed
+// and all its replicas are updated and available
+func deploymentSettled(d *extensions.Deployment) bool {
+	replicas := *d.Spec.Replicas
+	return d.Status.ObservedGeneration >= d.Generation &&
+		d.Status.Replicas == replicas &&
+		d.Status.UpdatedReplicas == replicas &&
+		d.Status.AvailableReplicas == replicas
+}
+
+// migrateDeployments hands the pods of lb over from the legacy deployments,
+// which are named with a random suffix by earlier versions, to the active one
+// named by lbutil.WorkloadName. The pods of lb can not run twice on a node
+// because of anti-affinity, so source is scaled down by one replica once both
+// deployments settle, and active takes it over by migrationReplicas in the
+// next sync. The legacy deployments are deleted once source has no replicas
+// left and active has all replicas available
+func (r *Reconciler) migrateDeployments(result *lbutil.Result, lb *netv1alpha1.LoadBalancer, active, source *extensions.Deployment, legacy []*extensions.Deployment) error {
+	logger := log.For(r.Name)
+
+	result.Requeue(migrationCheckInterval)
+	if !deploymentSettled(active) {
+		return nil
+	}
+
+	if source != nil {
+		if !deploymentSettled(source) {
+			return nil
+		}
+		replicas := *source.Spec.Replicas - 1
+		logger.Info("Hand over a replica from legacy deployment", log.Fields{"from": source.Name, "to": active.Name, "lb.name": lb.Name, "replicas": replicas})
+		if err := lbutil.ScaleDeployment(r.Client, lb.Namespace, source.Name, replicas); err != nil {
+			return err
+		}
+		result.Updated("Deployment", source.Name)
+		return nil
+	}
+
+	logger.Info("Delete legacy deployments", log.Fields{"lb.name": lb.Name, "count": len(legacy)})
+	if err := r.DeleteDeployments(legacy); err != nil {
+		return err
+	}
+	for _, dp := range legacy {
+		result.Deleted("Deployment", dp.Name)
+	}
+	return nil
+}
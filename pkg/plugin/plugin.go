@@ -0,0 +1,70 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugin is the SDK of the provider and proxy plugins running pods
+// for loadbalancers. A plugin renders the desired objects and extracts the
+// status, the workloads are claimed, created, corrected, scaled down and
+// cleaned up by Reconciler
+package plugin
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// DesiredObjects renders the desired objects of a plugin for loadbalancers
+type DesiredObjects interface {
+	// Deployment returns the desired deployment of lb
+	Deployment(lb *netv1alpha1.LoadBalancer) *extensions.Deployment
+	// DaemonSet returns the desired daemonset of lb
+	DaemonSet(lb *netv1alpha1.LoadBalancer) *extensions.DaemonSet
+	// EnsureDeployment corrects a copy of the existing deployment with the
+	// desired one, and returns the copy and whether it is changed. Only the
+	// difference between the copy and the existing one is patched
+	EnsureDeployment(desired, old *extensions.Deployment) (*extensions.Deployment, bool, error)
+	// EnsureDaemonSet corrects a copy of the existing daemonset with the
+	// desired one, and returns the copy and whether it is changed. Only the
+	// difference between the copy and the existing one is patched
+	EnsureDaemonSet(desired, old *extensions.DaemonSet) (*extensions.DaemonSet, bool, error)
+	// EnsureDependencies ensures the objects which pods depend on, e.g. the
+	// ConfigMaps mounted into them, it is called before pods are created
+	EnsureDependencies(result *lbutil.Result, lb *netv1alpha1.LoadBalancer) error
+}
+
+// StatusSyncer extracts the status of pods into loadbalancer
+type StatusSyncer interface {
+	// SyncStatus writes the status of the active workload into lb
+	SyncStatus(lb *netv1alpha1.LoadBalancer, workload Workload) error
+}
+
+// Renderer is implemented by the plugins reconciled by Reconciler
+type Renderer interface {
+	DesiredObjects
+	StatusSyncer
+}
+
+// Workload is the active workload of a loadbalancer, only one of Deployment
+// and DaemonSet is set
+type Workload struct {
+	// Replicas is the desired number of pods
+	Replicas int32
+	// Deployment is the name of deployment in Deployment mode
+	Deployment string
+	// DaemonSet is the name of daemonset in DaemonSet mode
+	DaemonSet string
+}
@@ -0,0 +1,401 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	"github.com/caicloud/loadbalancer-controller/pkg/tprclient"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	extensionslisters "k8s.io/client-go/listers/extensions/v1beta1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/kubernetes/pkg/controller"
+)
+
+var controllerKind = netv1alpha1.SchemeGroupVersion.WithKind(netv1alpha1.LoadBalancerKind)
+
+// Reconciler reconciles the workloads of a plugin for loadbalancers. It
+// claims the deployments and daemonsets selected for a loadbalancer, corrects
+// or creates the one generated by plugin, scales down or deletes the strays,
+// keeps a PodDisruptionBudget of deployment and syncs the status
+type Reconciler struct {
+	// Name is the name of plugin, e.g. nginx
+	Name string
+	// Component is the plugin with its kind, e.g. proxy-nginx. The workloads
+	// and PodDisruptionBudget of a loadbalancer are named after it with the
+	// component, the other workloads selected are strays
+	Component string
+	// Selector returns the labels selecting the pods of a loadbalancer
+	Selector func(lb *netv1alpha1.LoadBalancer) labels.Set
+	// Exclude returns the labels of workloads selected for a loadbalancer
+	// but reconciled by another Reconciler, e.g. the green proxy. They are
+	// neither claimed nor treated as strays. It is optional
+	Exclude func(lb *netv1alpha1.LoadBalancer) labels.Set
+	// Renderer renders the desired objects and extracts the status
+	Renderer Renderer
+
+	Client    kubernetes.Interface
+	TPRClient tprclient.Interface
+	DLister   extensionslisters.DeploymentLister
+	DSLister  extensionslisters.DaemonSetLister
+	Recorder  record.EventRecorder
+}
+
+// prefix returns the prefix of the names of workloads generated for lb
+func (r *Reconciler) prefix(lb *netv1alpha1.LoadBalancer) string {
+	return lb.Name + "-" + r.Component
+}
+
+// podDisruptionBudgetName returns the name of PodDisruptionBudget of lb
+func (r *Reconciler) podDisruptionBudgetName(lb *netv1alpha1.LoadBalancer) string {
+	return r.prefix(lb)
+}
+
+// canAdopt rechecks lb for deletion with an uncached quorum read before any
+// adoptions are attempted (see kubernetes#42639)
+func (r *Reconciler) canAdopt(lb *netv1alpha1.LoadBalancer) func() error {
+	return controller.RecheckDeletionTimestamp(func() (metav1.Object, error) {
+		fresh, err := r.TPRClient.NetworkingV1alpha1().LoadBalancers(lb.Namespace).Get(lb.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if fresh.UID != lb.UID {
+			return nil, fmt.Errorf("original LoadBalancer %v/%v is gone: got uid %v, wanted %v", lb.Namespace, lb.Name, fresh.UID, lb.UID)
+		}
+		return fresh, nil
+	})
+}
+
+// listSelector returns the selector listing the workloads of lb, the excluded
+// ones are left out before claiming, so they are not released either
+func (r *Reconciler) listSelector(lb *netv1alpha1.LoadBalancer) (labels.Selector, error) {
+	selector := r.Selector(lb).AsSelector()
+	if r.Exclude == nil {
+		return selector, nil
+	}
+	for k, v := range r.Exclude(lb) {
+		req, err := labels.NewRequirement(k, selection.NotEquals, []string{v})
+		if err != nil {
+			return nil, err
+		}
+		selector = selector.Add(*req)
+	}
+	return selector, nil
+}
+
+// ClaimDeployments returns the deployments of lb, the orphans selected are
+// adopted and the ones no longer selected are released
+func (r *Reconciler) ClaimDeployments(lb *netv1alpha1.LoadBalancer) ([]*extensions.Deployment, error) {
+	listSelector, err := r.listSelector(lb)
+	if err != nil {
+		return nil, err
+	}
+	dList, err := r.DLister.Deployments(lb.Namespace).List(listSelector)
+	if err != nil {
+		return nil, err
+	}
+	selector := r.Selector(lb).AsSelector()
+	cm := controllerutil.NewDeploymentControllerRefManager(r.Client, lb, selector, controllerKind, r.canAdopt(lb), r.Recorder)
+	return cm.Claim(dList)
+}
+
+// ClaimDaemonSets returns the daemonsets of lb, the orphans selected are
+// adopted and the ones no longer selected are released
+func (r *Reconciler) ClaimDaemonSets(lb *netv1alpha1.LoadBalancer) ([]*extensions.DaemonSet, error) {
+	listSelector, err := r.listSelector(lb)
+	if err != nil {
+		return nil, err
+	}
+	dsList, err := r.DSLister.DaemonSets(lb.Namespace).List(listSelector)
+	if err != nil {
+		return nil, err
+	}
+	selector := r.Selector(lb).AsSelector()
+	cm := controllerutil.NewDaemonSetControllerRefManager(r.Client, lb, selector, controllerKind, r.canAdopt(lb), r.Recorder)
+	return cm.Claim(dsList)
+}
+
+// Sync reconciles the claimed workloads of lb in its deploy mode, the
+// changes are recorded in result
+func (r *Reconciler) Sync(result *lbutil.Result, lb *netv1alpha1.LoadBalancer, dps []*extensions.Deployment, dss []*extensions.DaemonSet) error {
+	if lbutil.IsDaemonSetMode(lb) {
+		return r.syncDaemonSets(result, lb, dps, dss)
+	}
+	return r.syncDeployments(result, lb, dps, dss)
+}
+
+// syncDeployments generates the desired deployment from lb and compares it
+// with the existing ones
+func (r *Reconciler) syncDeployments(result *lbutil.Result, lb *netv1alpha1.LoadBalancer, dps []*extensions.Deployment, dss []*extensions.DaemonSet) error {
+	logger := log.For(r.Name)
+
+	// delete daemonsets left by DaemonSet mode first
+	if len(dss) != 0 {
+		if err := r.DeleteDaemonSets(dss); err != nil {
+			return err
+		}
+		return fmt.Errorf("waiting for %d %s daemonsets of %v/%v to be deleted", len(dss), r.Name, lb.Namespace, lb.Name)
+	}
+
+	desiredDeploy := r.Renderer.Deployment(lb)
+
+	// the deployment named by lbutil.WorkloadName is the active one, the ones
+	// named with the prefix and a random suffix are left by earlier versions,
+	// their pods are handed over to the active one, see migration.go
+	var active, source *extensions.Deployment
+	var legacy []*extensions.Deployment
+	for _, dp := range dps {
+		if dp.Name == desiredDeploy.Name {
+			active = dp
+			continue
+		}
+		if strings.HasPrefix(dp.Name, r.prefix(lb)) {
+			legacy = append(legacy, dp)
+			if *dp.Spec.Replicas > 0 && (source == nil || *dp.Spec.Replicas > *source.Spec.Replicas) {
+				source = dp
+			}
+		}
+	}
+
+	for _, dp := range dps {
+		// two conditions will trigger controller to scale down deployment
+		// 1. deployment does not have auto-generated prefix
+		// 2. there are more than one legacy deployments, the pods are only
+		//    handed over from the largest one
+		if dp == active || dp == source || *dp.Spec.Replicas == 0 {
+			continue
+		}
+		// scale unexpected deployment replicas to zero
+		logger.Info("Scale unexpected replicas to zero", log.Fields{"d.name": dp.Name, "lb.name": lb.Name})
+		if err := lbutil.ScaleDeployment(r.Client, lb.Namespace, dp.Name, 0); err == nil {
+			result.Scaled("Deployment", dp.Name)
+		}
+	}
+
+	// the replicas are shared with the legacy deployment during migration
+	if source != nil {
+		replicas := migrationReplicas(*desiredDeploy.Spec.Replicas, source)
+		desiredDeploy.Spec.Replicas = &replicas
+	}
+
+	activeDeploy := desiredDeploy
+	activeChanged := false
+	if active != nil {
+		copyDp, _, err := r.Renderer.EnsureDeployment(desiredDeploy, active)
+		if err != nil {
+			return err
+		}
+		// only the fields owned by plugin are patched, see lbutil.PatchDeployment
+		patched, changed, err := lbutil.PatchDeployment(r.Client, desiredDeploy, active, copyDp)
+		if err != nil {
+			return err
+		}
+		if changed {
+			logger.Info("Sync deployment for lb", log.Fields{"d.name": active.Name, "lb.name": lb.Name})
+			result.Updated("Deployment", active.Name)
+		}
+		activeDeploy, activeChanged = patched, changed
+	}
+
+	replicas := *activeDeploy.Spec.Replicas
+	if source != nil {
+		replicas += *source.Spec.Replicas
+	}
+
+	if err := r.Renderer.EnsureDependencies(result, lb); err != nil {
+		return err
+	}
+	if err := r.ensurePodDisruptionBudget(result, lb, replicas); err != nil {
+		return err
+	}
+
+	// len(dps) == 0 or no deployment's name match desired deployment
+	if active == nil {
+		logger.Info("Create deployment for lb", log.Fields{"d.name": desiredDeploy.Name, "lb.name": lb.Name})
+		if _, err := lbutil.CreateDeployment(r.Client, lb.Namespace, desiredDeploy); err != nil {
+			return err
+		}
+		result.Created("Deployment", desiredDeploy.Name)
+	}
+	if len(legacy) != 0 {
+		// the deployment created or patched is not settled in cache yet
+		if active == nil || activeChanged {
+			result.Requeue(migrationCheckInterval)
+		} else if err := r.migrateDeployments(result, lb, active, source, legacy); err != nil {
+			return err
+		}
+	}
+
+	return r.Renderer.SyncStatus(lb, Workload{Replicas: replicas, Deployment: activeDeploy.Name})
+}
+
+// syncDaemonSets runs pods in a daemonset on all nodes of lb, the deployments
+// are deleted first to avoid running two pods of lb on the same node
+func (r *Reconciler) syncDaemonSets(result *lbutil.Result, lb *netv1alpha1.LoadBalancer, dps []*extensions.Deployment, dss []*extensions.DaemonSet) error {
+	logger := log.For(r.Name)
+
+	if len(dps) != 0 {
+		if err := r.DeleteDeployments(dps); err != nil {
+			return err
+		}
+		return fmt.Errorf("waiting for %d %s deployments of %v/%v to be deleted", len(dps), r.Name, lb.Namespace, lb.Name)
+	}
+
+	desiredDs := r.Renderer.DaemonSet(lb)
+
+	// the daemonset named by lbutil.WorkloadName is preferred. A legacy one
+	// named with a random suffix is adopted rather than migrated, the pods of
+	// two daemonsets can not be handed over node by node
+	for i, ds := range dss {
+		if ds.Name == desiredDs.Name {
+			dss = append([]*extensions.DaemonSet{ds}, append(dss[:i:i], dss[i+1:]...)...)
+			break
+		}
+	}
+
+	updated := false
+	activeDs := desiredDs
+	for _, ds := range dss {
+		// daemonsets can not be scaled to zero, delete the unexpected ones
+		if !strings.HasPrefix(ds.Name, r.prefix(lb)) || updated {
+			logger.Info("Delete unexpected daemonset", log.Fields{"ds.name": ds.Name, "lb.name": lb.Name})
+			if err := r.DeleteDaemonSets([]*extensions.DaemonSet{ds}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		updated = true
+		copyDs, _, err := r.Renderer.EnsureDaemonSet(desiredDs, ds)
+		if err != nil {
+			return err
+		}
+		// only the fields owned by plugin are patched, see lbutil.PatchDaemonSet
+		patched, changed, err := lbutil.PatchDaemonSet(r.Client, desiredDs, ds, copyDs)
+		if err != nil {
+			return err
+		}
+		if changed {
+			logger.Info("Sync daemonset for lb", log.Fields{"ds.name": ds.Name, "lb.name": lb.Name})
+			result.Updated("DaemonSet", ds.Name)
+		}
+		activeDs = patched
+	}
+
+	if err := r.Renderer.EnsureDependencies(result, lb); err != nil {
+		return err
+	}
+	// daemonset pods are not evicted by drains
+	if err := lbutil.DeletePodDisruptionBudget(r.Client, lb.Namespace, r.podDisruptionBudgetName(lb)); err != nil {
+		return err
+	}
+
+	if !updated {
+		logger.Info("Create daemonset for lb", log.Fields{"ds.name": desiredDs.Name, "lb.name": lb.Name})
+		if _, err := lbutil.CreateDaemonSet(r.Client, lb.Namespace, desiredDs); err != nil {
+			return err
+		}
+		result.Created("DaemonSet", desiredDs.Name)
+	}
+
+	replicas, _ := lbutil.CalculateReplicas(lb)
+	return r.Renderer.SyncStatus(lb, Workload{Replicas: replicas, DaemonSet: activeDs.Name})
+}
+
+// ensurePodDisruptionBudget keeps node drains from evicting more than one
+// replica of deployment at a time
+func (r *Reconciler) ensurePodDisruptionBudget(result *lbutil.Result, lb *netv1alpha1.LoadBalancer, replicas int32) error {
+	name := r.podDisruptionBudgetName(lb)
+	labels := lbutil.WithArtifactLabels(r.Selector(lb), lb, r.Component)
+	action, err := lbutil.EnsurePodDisruptionBudget(r.Client, lb, name, labels, r.Selector(lb), replicas)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case lbutil.ActionCreated:
+		result.Created("PodDisruptionBudget", name)
+	case lbutil.ActionUpdated:
+		result.Updated("PodDisruptionBudget", name)
+	}
+	return nil
+}
+
+// Cleanup deletes the workloads and PodDisruptionBudget of lb
+func (r *Reconciler) Cleanup(lb *netv1alpha1.LoadBalancer) error {
+	dps, err := r.ClaimDeployments(lb)
+	if err != nil {
+		return err
+	}
+	if err := r.DeleteDeployments(dps); err != nil {
+		return err
+	}
+
+	dss, err := r.ClaimDaemonSets(lb)
+	if err != nil {
+		return err
+	}
+	if err := r.DeleteDaemonSets(dss); err != nil {
+		return err
+	}
+
+	return lbutil.DeletePodDisruptionBudget(r.Client, lb.Namespace, r.podDisruptionBudgetName(lb))
+}
+
+// DeleteDeployments deletes deployments in foreground
+func (r *Reconciler) DeleteDeployments(dps []*extensions.Deployment) error {
+	policy := metav1.DeletePropagationForeground
+	gracePeriodSeconds := int64(30)
+	for _, d := range dps {
+		err := r.Client.ExtensionsV1beta1().Deployments(d.Namespace).Delete(d.Name, &metav1.DeleteOptions{
+			GracePeriodSeconds: &gracePeriodSeconds,
+			PropagationPolicy:  &policy,
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			log.For(r.Name).Warn("Delete deployment error", log.Fields{"ns": d.Namespace, "d.name": d.Name, "err": err})
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteDaemonSets deletes daemonsets in foreground
+func (r *Reconciler) DeleteDaemonSets(dss []*extensions.DaemonSet) error {
+	policy := metav1.DeletePropagationForeground
+	gracePeriodSeconds := int64(30)
+	for _, ds := range dss {
+		err := r.Client.ExtensionsV1beta1().DaemonSets(ds.Namespace).Delete(ds.Name, &metav1.DeleteOptions{
+			GracePeriodSeconds: &gracePeriodSeconds,
+			PropagationPolicy:  &policy,
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			log.For(r.Name).Warn("Delete daemonset error", log.Fields{"ns": ds.Namespace, "ds.name": ds.Name, "err": err})
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,370 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugintest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/tprclient/fake"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	batchv1 "k8s.io/client-go/pkg/apis/batch/v1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	policy "k8s.io/client-go/pkg/apis/policy/v1beta1"
+	"k8s.io/client-go/rest"
+)
+
+// resource is a kind of object served by APIServer
+type resource struct {
+	gvk schema.GroupVersionKind
+	fake.ResourceType
+}
+
+func newResource(gv schema.GroupVersion, kind string, newObject, newList func() runtime.Object) resource {
+	return resource{
+		gvk: gv.WithKind(kind),
+		ResourceType: fake.ResourceType{
+			NewObject: newObject,
+			NewList: func(items []runtime.Object) runtime.Object {
+				list := newList()
+				if err := meta.SetList(list, items); err != nil {
+					panic(err)
+				}
+				return list
+			},
+		},
+	}
+}
+
+var (
+	coreV1       = schema.GroupVersion{Version: "v1"}
+	extensionsV1 = schema.GroupVersion{Group: "extensions", Version: "v1beta1"}
+	batchV1      = schema.GroupVersion{Group: "batch", Version: "v1"}
+	policyV1     = schema.GroupVersion{Group: "policy", Version: "v1beta1"}
+)
+
+// resources are the kinds of objects used by plugins, keyed by plural name
+var resources = map[string]resource{
+	"pods":                 newResource(coreV1, "Pod", func() runtime.Object { return &v1.Pod{} }, func() runtime.Object { return &v1.PodList{} }),
+	"services":             newResource(coreV1, "Service", func() runtime.Object { return &v1.Service{} }, func() runtime.Object { return &v1.ServiceList{} }),
+	"endpoints":            newResource(coreV1, "Endpoints", func() runtime.Object { return &v1.Endpoints{} }, func() runtime.Object { return &v1.EndpointsList{} }),
+	"configmaps":           newResource(coreV1, "ConfigMap", func() runtime.Object { return &v1.ConfigMap{} }, func() runtime.Object { return &v1.ConfigMapList{} }),
+	"secrets":              newResource(coreV1, "Secret", func() runtime.Object { return &v1.Secret{} }, func() runtime.Object { return &v1.SecretList{} }),
+	"nodes":                newResource(coreV1, "Node", func() runtime.Object { return &v1.Node{} }, func() runtime.Object { return &v1.NodeList{} }),
+	"events":               newResource(coreV1, "Event", func() runtime.Object { return &v1.Event{} }, func() runtime.Object { return &v1.EventList{} }),
+	"deployments":          newResource(extensionsV1, "Deployment", func() runtime.Object { return &extensions.Deployment{} }, func() runtime.Object { return &extensions.DeploymentList{} }),
+	"daemonsets":           newResource(extensionsV1, "DaemonSet", func() runtime.Object { return &extensions.DaemonSet{} }, func() runtime.Object { return &extensions.DaemonSetList{} }),
+	"replicasets":          newResource(extensionsV1, "ReplicaSet", func() runtime.Object { return &extensions.ReplicaSet{} }, func() runtime.Object { return &extensions.ReplicaSetList{} }),
+	"ingresses":            newResource(extensionsV1, "Ingress", func() runtime.Object { return &extensions.Ingress{} }, func() runtime.Object { return &extensions.IngressList{} }),
+	"jobs":                 newResource(batchV1, "Job", func() runtime.Object { return &batchv1.Job{} }, func() runtime.Object { return &batchv1.JobList{} }),
+	"poddisruptionbudgets": newResource(policyV1, "PodDisruptionBudget", func() runtime.Object { return &policy.PodDisruptionBudget{} }, func() runtime.Object { return &policy.PodDisruptionBudgetList{} }),
+}
+
+// resourceOf returns the plural name of resource of obj
+func resourceOf(obj runtime.Object) (string, error) {
+	for name, r := range resources {
+		if fmt.Sprintf("%T", r.NewObject()) == fmt.Sprintf("%T", obj) {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported object type %T", obj)
+}
+
+// APIServer serves the objects of plugins over http from memory, so that
+// the real clientset, informers and listers are used in tests. Requests are
+// recorded as actions like the fake tprclient
+type APIServer struct {
+	server  *httptest.Server
+	tracker *fake.ObjectTracker
+
+	lock    sync.Mutex
+	actions []fake.Action
+}
+
+// NewAPIServer starts an APIServer serving the given objects, it panics if an
+// object is of unsupported type
+func NewAPIServer(objects ...runtime.Object) *APIServer {
+	types := make(map[string]fake.ResourceType, len(resources))
+	for name, r := range resources {
+		types[name] = r.ResourceType
+	}
+	s := &APIServer{tracker: fake.NewObjectTracker(types)}
+	for _, obj := range objects {
+		name, err := resourceOf(obj)
+		if err != nil {
+			panic(err)
+		}
+		if err := s.tracker.Add(name, obj); err != nil {
+			panic(err)
+		}
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Close shuts down the server
+func (s *APIServer) Close() {
+	s.server.Close()
+}
+
+// Client returns a clientset talking to the server
+func (s *APIServer) Client() kubernetes.Interface {
+	return kubernetes.NewForConfigOrDie(&rest.Config{Host: s.server.URL})
+}
+
+// Tracker returns the object tracker of server, it is used to check or
+// modify the objects behind the back of plugins
+func (s *APIServer) Tracker() *fake.ObjectTracker {
+	return s.tracker
+}
+
+// Actions returns the recorded requests in order, watches are left out
+func (s *APIServer) Actions() []fake.Action {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]fake.Action(nil), s.actions...)
+}
+
+// ClearActions clears the recorded requests
+func (s *APIServer) ClearActions() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.actions = nil
+}
+
+// Writes returns the recorded requests changing objects
+func (s *APIServer) Writes() []fake.Action {
+	var writes []fake.Action
+	for _, action := range s.Actions() {
+		switch action.Verb {
+		case fake.VerbGet, fake.VerbList:
+			continue
+		}
+		writes = append(writes, action)
+	}
+	return writes
+}
+
+// parsePath parses /api/v1/... and /apis/group/version/... into resource,
+// namespace, name and subresource
+func parsePath(path string) (string, string, string, string, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) >= 2 && parts[0] == "api":
+		parts = parts[2:]
+	case len(parts) >= 3 && parts[0] == "apis":
+		parts = parts[3:]
+	default:
+		return "", "", "", "", fmt.Errorf("unknown path %s", path)
+	}
+
+	namespace := ""
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		namespace = parts[1]
+		parts = parts[2:]
+	}
+	if len(parts) == 0 || len(parts) > 3 {
+		return "", "", "", "", fmt.Errorf("unknown path %s", path)
+	}
+	parts = append(parts, "", "")
+	return parts[0], namespace, parts[1], parts[2], nil
+}
+
+func (s *APIServer) serve(w http.ResponseWriter, req *http.Request) {
+	name, namespace, objName, _, err := parsePath(req.URL.Path)
+	if err != nil {
+		s.writeError(w, errors.NewBadRequest(err.Error()))
+		return
+	}
+	r, ok := resources[name]
+	if !ok {
+		s.writeError(w, errors.NewNotFound(schema.GroupResource{Resource: name}, objName))
+		return
+	}
+	query := req.URL.Query()
+	listOptions := metav1.ListOptions{LabelSelector: query.Get("labelSelector")}
+
+	if req.Method == http.MethodGet && objName == "" && query.Get("watch") == "true" {
+		s.watch(w, name, namespace)
+		return
+	}
+
+	action := fake.Action{Resource: name, Namespace: namespace, Name: objName}
+	var obj runtime.Object
+	switch req.Method {
+	case http.MethodGet:
+		if objName == "" {
+			action.Verb = fake.VerbList
+			action.ListOptions = listOptions
+			obj, err = s.tracker.List(name, namespace, listOptions)
+		} else {
+			action.Verb = fake.VerbGet
+			obj, err = s.tracker.Get(name, namespace, objName)
+		}
+	case http.MethodPost:
+		action.Verb = fake.VerbCreate
+		if action.Object, err = decode(req, r); err == nil {
+			obj, err = s.tracker.Create(name, namespace, action.Object)
+		}
+	case http.MethodPut:
+		action.Verb = fake.VerbUpdate
+		if action.Object, err = decode(req, r); err == nil {
+			obj, err = s.tracker.Update(name, namespace, action.Object)
+		}
+	case http.MethodPatch:
+		action.Verb = fake.VerbPatch
+		action.PatchType = types.PatchType(req.Header.Get("Content-Type"))
+		if action.Patch, err = ioutil.ReadAll(req.Body); err == nil {
+			obj, err = s.tracker.Patch(name, namespace, objName, action.PatchType, action.Patch)
+		}
+	case http.MethodDelete:
+		if objName == "" {
+			action.Verb = fake.VerbDeleteCollection
+			action.ListOptions = listOptions
+			err = s.deleteCollection(name, namespace, listOptions)
+		} else {
+			action.Verb = fake.VerbDelete
+			err = s.tracker.Delete(name, namespace, objName)
+		}
+		if err == nil {
+			obj = &metav1.Status{Status: metav1.StatusSuccess}
+		}
+	default:
+		err = errors.NewMethodNotSupported(schema.GroupResource{Resource: name}, req.Method)
+	}
+
+	s.lock.Lock()
+	s.actions = append(s.actions, action)
+	s.lock.Unlock()
+
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeObject(w, http.StatusOK, r, obj)
+}
+
+// decode decodes the object in body of request
+func decode(req *http.Request, r resource) (runtime.Object, error) {
+	obj := r.NewObject()
+	if err := json.NewDecoder(req.Body).Decode(obj); err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+	return obj, nil
+}
+
+func (s *APIServer) deleteCollection(name, namespace string, opts metav1.ListOptions) error {
+	list, err := s.tracker.List(name, namespace, opts)
+	if err != nil {
+		return err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		accessor, err := meta.Accessor(item)
+		if err != nil {
+			return err
+		}
+		if err := s.tracker.Delete(name, accessor.GetNamespace(), accessor.GetName()); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// watch streams the changes of objects until the client goes away
+func (s *APIServer) watch(w http.ResponseWriter, name, namespace string) {
+	watcher := s.tracker.Watch(name, namespace)
+	defer watcher.Stop()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	closed := w.(http.CloseNotifier).CloseNotify()
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-closed:
+			return
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return
+			}
+			setKind(resources[name], event.Object, false)
+			if err := encoder.Encode(&metav1.WatchEvent{
+				Type:   string(event.Type),
+				Object: runtime.RawExtension{Object: event.Object},
+			}); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// setKind sets apiVersion and kind of obj, which are required by decoders
+func setKind(r resource, obj runtime.Object, list bool) {
+	gvk := r.gvk
+	if list {
+		gvk.Kind += "List"
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+}
+
+func (s *APIServer) writeObject(w http.ResponseWriter, code int, r resource, obj runtime.Object) {
+	if status, ok := obj.(*metav1.Status); ok {
+		status.APIVersion, status.Kind = "v1", "Status"
+	} else {
+		setKind(r, obj, meta.IsListType(obj))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(obj)
+}
+
+func (s *APIServer) writeError(w http.ResponseWriter, err error) {
+	status, ok := err.(errors.APIStatus)
+	if !ok {
+		status = errors.NewInternalError(err)
+	}
+	st := status.Status()
+	st.APIVersion, st.Kind = "v1", "Status"
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(int(st.Code))
+	json.NewEncoder(w).Encode(&st)
+}
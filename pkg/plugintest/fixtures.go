@@ -0,0 +1,127 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugintest
+
+import (
+	"time"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// CreationTime is the creation time of fixtures, it is fixed so that the
+// generated objects are comparable across runs
+var CreationTime = metav1.NewTime(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+
+// LoadBalancerOption modifies a fixture LoadBalancer
+type LoadBalancerOption func(lb *netv1alpha1.LoadBalancer)
+
+// WithIpvsdr uses the ipvsdr provider with the vip
+func WithIpvsdr(vip string) LoadBalancerOption {
+	return func(lb *netv1alpha1.LoadBalancer) {
+		lb.Spec.Providers.Ipvsdr = &netv1alpha1.IpvsdrProvider{
+			Vip:       vip,
+			Scheduler: netv1alpha1.IpvsSchedulerRR,
+		}
+	}
+}
+
+// WithNodes runs the loadbalancer on the named nodes
+func WithNodes(names ...string) LoadBalancerOption {
+	return func(lb *netv1alpha1.LoadBalancer) {
+		lb.Spec.Nodes.Names = names
+	}
+}
+
+// WithReplicas runs the loadbalancer on the number of nodes chosen by scheduler
+func WithReplicas(replicas int32) LoadBalancerOption {
+	return func(lb *netv1alpha1.LoadBalancer) {
+		lb.Spec.Nodes.Replicas = &replicas
+	}
+}
+
+// WithDaemonSet deploys the loadbalancer as DaemonSets
+func WithDaemonSet() LoadBalancerOption {
+	return func(lb *netv1alpha1.LoadBalancer) {
+		lb.Spec.DeployMode = netv1alpha1.DeployModeDaemonSet
+	}
+}
+
+// WithDeletion marks the loadbalancer as being deleted
+func WithDeletion() LoadBalancerOption {
+	return func(lb *netv1alpha1.LoadBalancer) {
+		lb.DeletionTimestamp = &CreationTime
+	}
+}
+
+// WithDryRun syncs the loadbalancer in dry run mode
+func WithDryRun() LoadBalancerOption {
+	return func(lb *netv1alpha1.LoadBalancer) {
+		if lb.Annotations == nil {
+			lb.Annotations = make(map[string]string)
+		}
+		lb.Annotations[netv1alpha1.AnnotationKeyDryRun] = "true"
+	}
+}
+
+// NewLoadBalancer returns a defaulted LoadBalancer with the options applied,
+// its uid is derived from the key
+func NewLoadBalancer(namespace, name string, options ...LoadBalancerOption) *netv1alpha1.LoadBalancer {
+	lb := &netv1alpha1.LoadBalancer{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: netv1alpha1.SchemeGroupVersion.String(),
+			Kind:       "LoadBalancer",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         namespace,
+			Name:              name,
+			UID:               types.UID("uid-" + namespace + "-" + name),
+			ResourceVersion:   "1",
+			CreationTimestamp: CreationTime,
+		},
+	}
+	for _, option := range options {
+		option(lb)
+	}
+	netv1alpha1.SetLoadBalancerDefaults(lb)
+	return lb
+}
+
+// NewNode returns a ready Node with the internal ip
+func NewNode(name, ip string) *v1.Node {
+	return &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			UID:               types.UID("uid-" + name),
+			CreationTimestamp: CreationTime,
+			Labels: map[string]string{
+				"kubernetes.io/hostname": name,
+			},
+		},
+		Status: v1.NodeStatus{
+			Addresses: []v1.NodeAddress{
+				{Type: v1.NodeInternalIP, Address: ip},
+			},
+			Conditions: []v1.NodeCondition{
+				{Type: v1.NodeReady, Status: v1.ConditionTrue},
+			},
+		},
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugintest runs provider and proxy plugins against in-memory
+// apiservers, with fixtures for the objects they sync.
+package plugintest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/caicloud/loadbalancer-controller/config"
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/informers"
+	"github.com/caicloud/loadbalancer-controller/pkg/tprclient/fake"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// Harness runs plugins against in-memory apiservers. Kubernetes objects are
+// served over http by APIServer and LoadBalancers by the fake tprclient,
+// both of them are shared by an informer factory like in the controller
+type Harness struct {
+	APIServer *APIServer
+	TPRClient *fake.Clientset
+	Factory   informers.SharedInformerFactory
+	Recorder  *record.FakeRecorder
+}
+
+// NewHarness returns a harness serving the objects, LoadBalancers go to the
+// tprclient and the others to the apiserver
+func NewHarness(objects ...runtime.Object) *Harness {
+	var lbs, others []runtime.Object
+	for _, obj := range objects {
+		if _, ok := obj.(*netv1alpha1.LoadBalancer); ok {
+			lbs = append(lbs, obj)
+			continue
+		}
+		others = append(others, obj)
+	}
+
+	h := &Harness{
+		APIServer: NewAPIServer(others...),
+		TPRClient: fake.NewSimpleClientset(lbs...),
+		Recorder:  record.NewFakeRecorder(100),
+	}
+	h.Factory = informers.NewSharedInformerFactory(h.APIServer.Client(), h.TPRClient, 0)
+	// results of plugins are applied as by the controller, without requeue
+	lbutil.SetAggregator(lbutil.NewAggregator(h.TPRClient, h.Recorder, nil))
+	return h
+}
+
+// Config returns cfg with the clients and recorder of harness
+func (h *Harness) Config(cfg config.Configuration) config.Configuration {
+	cfg.Client = h.Factory.Client()
+	cfg.TPRClient = h.TPRClient
+	cfg.Recorder = h.Recorder
+	return cfg
+}
+
+// Start starts the informers requested by plugins and waits until they are
+// synced, plugins must be initialized before
+func (h *Harness) Start(stopCh <-chan struct{}) error {
+	h.Factory.Start(stopCh)
+	for typ, synced := range h.Factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			return fmt.Errorf("informer of %v is not synced", typ)
+		}
+	}
+	return nil
+}
+
+// WaitFor polls until condition returns true or the timeout expires, it is
+// used to wait for the informers to observe writes
+func (h *Harness) WaitFor(timeout time.Duration, condition func() bool) error {
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v", timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// Events drains the events recorded so far
+func (h *Harness) Events() []string {
+	var events []string
+	for {
+		select {
+		case event := <-h.Recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// Close shuts down the apiserver
+func (h *Harness) Close() {
+	h.APIServer.Close()
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/tprclient"
+	tprnetv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/tprclient/networking/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+)
+
+var _ tprclient.Interface = &Clientset{}
+
+var resourceTypes = map[string]ResourceType{
+	netv1alpha1.LoadBalancerPlural: {
+		NewObject: func() runtime.Object { return &netv1alpha1.LoadBalancer{} },
+		NewList: func(items []runtime.Object) runtime.Object {
+			list := &netv1alpha1.LoadBalancerList{}
+			for _, item := range items {
+				list.Items = append(list.Items, *item.(*netv1alpha1.LoadBalancer))
+			}
+			return list
+		},
+	},
+	netv1alpha1.LoadBalancerStatusViewPlural: {
+		NewObject: func() runtime.Object { return &netv1alpha1.LoadBalancerStatusView{} },
+		NewList: func(items []runtime.Object) runtime.Object {
+			list := &netv1alpha1.LoadBalancerStatusViewList{}
+			for _, item := range items {
+				list.Items = append(list.Items, *item.(*netv1alpha1.LoadBalancerStatusView))
+			}
+			return list
+		},
+	},
+}
+
+// Clientset implements tprclient.Interface in memory. Actions are recorded and
+// passed through reactors, the default reactors serve them from the tracker
+type Clientset struct {
+	Fake
+	tracker *ObjectTracker
+}
+
+// NewSimpleClientset returns a clientset which serves the given LoadBalancers
+// and LoadBalancerStatusViews, it panics if an object is of other types
+func NewSimpleClientset(objects ...runtime.Object) *Clientset {
+	tracker := NewObjectTracker(resourceTypes)
+	for _, obj := range objects {
+		var err error
+		switch obj.(type) {
+		case *netv1alpha1.LoadBalancer:
+			err = tracker.Add(netv1alpha1.LoadBalancerPlural, obj)
+		case *netv1alpha1.LoadBalancerStatusView:
+			err = tracker.Add(netv1alpha1.LoadBalancerStatusViewPlural, obj)
+		default:
+			panic("unsupported object type " + obj.GetObjectKind().GroupVersionKind().String())
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	cs := &Clientset{tracker: tracker}
+	cs.AddReactor("*", "*", ObjectReaction(tracker))
+	cs.AddWatchReactor("*", WatchReaction(tracker))
+	return cs
+}
+
+// Tracker returns the object tracker of clientset
+func (c *Clientset) Tracker() *ObjectTracker {
+	return c.tracker
+}
+
+// NetworkingV1alpha1 retrieves the fake NetworkingV1alpha1Client
+func (c *Clientset) NetworkingV1alpha1() tprnetv1alpha1.NetworkingV1alpha1Interface {
+	return &networkingV1alpha1{&c.Fake}
+}
+
+type networkingV1alpha1 struct {
+	*Fake
+}
+
+// LoadBalancers returns a fake LoadBalancerInterface
+func (c *networkingV1alpha1) LoadBalancers(namespace string) tprnetv1alpha1.LoadBalancerInterface {
+	return &loadbalancers{c.Fake, namespace}
+}
+
+// LoadBalancerStatusViews returns a fake LoadBalancerStatusViewInterface
+func (c *networkingV1alpha1) LoadBalancerStatusViews(namespace string) tprnetv1alpha1.LoadBalancerStatusViewInterface {
+	return &loadbalancerstatusviews{c.Fake, namespace}
+}
+
+// RESTClient returns nil, there is no apiserver behind the fake clientset
+func (c *networkingV1alpha1) RESTClient() rest.Interface {
+	return nil
+}
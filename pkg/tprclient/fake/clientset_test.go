@@ -0,0 +1,109 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"fmt"
+	"testing"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestClientset(t *testing.T) {
+	lb := &netv1alpha1.LoadBalancer{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "test",
+			Labels:    map[string]string{"app": "test"},
+		},
+	}
+	client := NewSimpleClientset(lb).NetworkingV1alpha1().LoadBalancers("default")
+
+	got, err := client.Get("test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.ResourceVersion == "" {
+		t.Errorf("Get() resource version is empty")
+	}
+
+	w, err := client.Watch(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	defer w.Stop()
+
+	got.Spec.DeployMode = netv1alpha1.DeployModeDaemonSet
+	updated, err := client.Update(got)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if event := <-w.ResultChan(); event.Type != watch.Modified {
+		t.Errorf("Watch() event = %v, want %v", event.Type, watch.Modified)
+	}
+	// update with stale resource version
+	if _, err := client.Update(got); !errors.IsConflict(err) {
+		t.Errorf("Update() error = %v, want conflict", err)
+	}
+
+	patched, err := client.Patch("test", types.MergePatchType, []byte(`{"metadata":{"labels":{"app":"patched"}}}`))
+	if err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	if patched.Labels["app"] != "patched" || patched.Spec.DeployMode != updated.Spec.DeployMode {
+		t.Errorf("Patch() got %v", patched)
+	}
+
+	list, err := client.List(metav1.ListOptions{LabelSelector: "app=test"})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(list.Items) != 0 {
+		t.Errorf("List() got %d items, want 0", len(list.Items))
+	}
+
+	if err := client.Delete("test", nil); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := client.Get("test", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("Get() error = %v, want not found", err)
+	}
+}
+
+func TestPrependReactor(t *testing.T) {
+	cs := NewSimpleClientset()
+	cs.PrependReactor(VerbCreate, netv1alpha1.LoadBalancerPlural, func(action Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("injected")
+	})
+
+	_, err := cs.NetworkingV1alpha1().LoadBalancers("default").Create(&netv1alpha1.LoadBalancer{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+	})
+	if err == nil || err.Error() != "injected" {
+		t.Errorf("Create() error = %v, want injected", err)
+	}
+
+	actions := cs.Actions()
+	if len(actions) != 1 || !actions[0].Matches(VerbCreate, netv1alpha1.LoadBalancerPlural) || actions[0].Namespace != "default" {
+		t.Errorf("Actions() got %v", actions)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Verbs of actions
+const (
+	VerbCreate           = "create"
+	VerbUpdate           = "update"
+	VerbDelete           = "delete"
+	VerbDeleteCollection = "deletecollection"
+	VerbGet              = "get"
+	VerbList             = "list"
+	VerbWatch            = "watch"
+	VerbPatch            = "patch"
+)
+
+// Action is a request recorded by the fake clientset
+type Action struct {
+	Verb      string
+	Resource  string
+	Namespace string
+	Name      string
+	// Object is the object of create and update
+	Object runtime.Object
+	// PatchType and Patch are the patch of patch
+	PatchType types.PatchType
+	Patch     []byte
+	// ListOptions is the options of list, watch and deletecollection
+	ListOptions metav1.ListOptions
+}
+
+// Matches returns true if the verb and resource of action match, * matches all
+func (a Action) Matches(verb, resource string) bool {
+	return (verb == "*" || verb == a.Verb) && (resource == "*" || resource == a.Resource)
+}
+
+// ReactionFunc handles an action, the action is passed to the next reactor in
+// chain if handled is false
+type ReactionFunc func(action Action) (handled bool, ret runtime.Object, err error)
+
+// WatchReactionFunc handles a watch action, the action is passed to the next
+// reactor in chain if handled is false
+type WatchReactionFunc func(action Action) (handled bool, ret watch.Interface, err error)
+
+type reactor struct {
+	verb     string
+	resource string
+	reaction ReactionFunc
+}
+
+type watchReactor struct {
+	resource string
+	reaction WatchReactionFunc
+}
+
+// Fake records actions and passes them through chains of reactors, like the
+// fake clientsets of client-go
+type Fake struct {
+	lock               sync.RWMutex
+	actions            []Action
+	reactionChain      []reactor
+	watchReactionChain []watchReactor
+}
+
+// AddReactor appends a reactor to the end of chain
+func (c *Fake) AddReactor(verb, resource string, reaction ReactionFunc) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.reactionChain = append(c.reactionChain, reactor{verb, resource, reaction})
+}
+
+// PrependReactor adds a reactor to the beginning of chain, it is used to
+// intercept actions before the object tracker
+func (c *Fake) PrependReactor(verb, resource string, reaction ReactionFunc) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.reactionChain = append([]reactor{{verb, resource, reaction}}, c.reactionChain...)
+}
+
+// AddWatchReactor appends a watch reactor to the end of chain
+func (c *Fake) AddWatchReactor(resource string, reaction WatchReactionFunc) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.watchReactionChain = append(c.watchReactionChain, watchReactor{resource, reaction})
+}
+
+// PrependWatchReactor adds a watch reactor to the beginning of chain
+func (c *Fake) PrependWatchReactor(resource string, reaction WatchReactionFunc) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.watchReactionChain = append([]watchReactor{{resource, reaction}}, c.watchReactionChain...)
+}
+
+// Invokes records the action and passes it through the reactors, defaultReturnObj
+// is returned if no reactor handles it
+func (c *Fake) Invokes(action Action, defaultReturnObj runtime.Object) (runtime.Object, error) {
+	c.lock.Lock()
+	c.actions = append(c.actions, action)
+	chain := make([]reactor, len(c.reactionChain))
+	copy(chain, c.reactionChain)
+	c.lock.Unlock()
+
+	// reactors are called without lock, so that they can call the clientset
+	for _, r := range chain {
+		if !action.Matches(r.verb, r.resource) {
+			continue
+		}
+		handled, ret, err := r.reaction(action)
+		if !handled {
+			continue
+		}
+		return ret, err
+	}
+	return defaultReturnObj, nil
+}
+
+// InvokesWatch records the watch action and passes it through the watch reactors
+func (c *Fake) InvokesWatch(action Action) (watch.Interface, error) {
+	c.lock.Lock()
+	c.actions = append(c.actions, action)
+	chain := make([]watchReactor, len(c.watchReactionChain))
+	copy(chain, c.watchReactionChain)
+	c.lock.Unlock()
+
+	for _, r := range chain {
+		if !action.Matches(VerbWatch, r.resource) {
+			continue
+		}
+		handled, ret, err := r.reaction(action)
+		if !handled {
+			continue
+		}
+		return ret, err
+	}
+	return watch.NewEmptyWatch(), nil
+}
+
+// Actions returns the recorded actions in order
+func (c *Fake) Actions() []Action {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	actions := make([]Action, len(c.actions))
+	copy(actions, c.actions)
+	return actions
+}
+
+// ClearActions clears the recorded actions
+func (c *Fake) ClearActions() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.actions = nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	tprnetv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/tprclient/networking/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+var _ tprnetv1alpha1.LoadBalancerInterface = &loadbalancers{}
+
+type loadbalancers struct {
+	*Fake
+	ns string
+}
+
+func (c *loadbalancers) invokes(action Action) (*netv1alpha1.LoadBalancer, error) {
+	action.Resource = netv1alpha1.LoadBalancerPlural
+	action.Namespace = c.ns
+	obj, err := c.Invokes(action, &netv1alpha1.LoadBalancer{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*netv1alpha1.LoadBalancer), err
+}
+
+// Create records a create action
+func (c *loadbalancers) Create(obj *netv1alpha1.LoadBalancer) (*netv1alpha1.LoadBalancer, error) {
+	return c.invokes(Action{Verb: VerbCreate, Name: obj.Name, Object: obj})
+}
+
+// Update records an update action
+func (c *loadbalancers) Update(obj *netv1alpha1.LoadBalancer) (*netv1alpha1.LoadBalancer, error) {
+	return c.invokes(Action{Verb: VerbUpdate, Name: obj.Name, Object: obj})
+}
+
+// Delete records a delete action
+func (c *loadbalancers) Delete(name string, options *metav1.DeleteOptions) error {
+	_, err := c.invokes(Action{Verb: VerbDelete, Name: name})
+	return err
+}
+
+// DeleteCollection records a deletecollection action
+func (c *loadbalancers) DeleteCollection(options *metav1.DeleteOptions, listOptions metav1.ListOptions) error {
+	_, err := c.Invokes(Action{Verb: VerbDeleteCollection, Resource: netv1alpha1.LoadBalancerPlural, Namespace: c.ns, ListOptions: listOptions}, nil)
+	return err
+}
+
+// Get records a get action
+func (c *loadbalancers) Get(name string, options metav1.GetOptions) (*netv1alpha1.LoadBalancer, error) {
+	return c.invokes(Action{Verb: VerbGet, Name: name})
+}
+
+// List records a list action
+func (c *loadbalancers) List(opts metav1.ListOptions) (*netv1alpha1.LoadBalancerList, error) {
+	obj, err := c.Invokes(Action{Verb: VerbList, Resource: netv1alpha1.LoadBalancerPlural, Namespace: c.ns, ListOptions: opts}, &netv1alpha1.LoadBalancerList{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*netv1alpha1.LoadBalancerList), err
+}
+
+// Watch records a watch action
+func (c *loadbalancers) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	return c.InvokesWatch(Action{Verb: VerbWatch, Resource: netv1alpha1.LoadBalancerPlural, Namespace: c.ns, ListOptions: opts})
+}
+
+// Patch records a patch action
+func (c *loadbalancers) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (*netv1alpha1.LoadBalancer, error) {
+	return c.invokes(Action{Verb: VerbPatch, Name: name, PatchType: pt, Patch: data})
+}
@@ -0,0 +1,343 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// ResourceType creates the objects and lists of a resource
+type ResourceType struct {
+	NewObject func() runtime.Object
+	NewList   func(items []runtime.Object) runtime.Object
+}
+
+type watcher struct {
+	namespace string
+	*watch.RaceFreeFakeWatcher
+}
+
+// ObjectTracker keeps objects in memory like apiserver, it backs the default
+// reactors of fake clientset
+type ObjectTracker struct {
+	lock            sync.RWMutex
+	types           map[string]ResourceType
+	objects         map[string]map[string]runtime.Object
+	watchers        map[string][]watcher
+	resourceVersion uint64
+}
+
+// NewObjectTracker returns a tracker serving the resources in types, keyed by
+// the plural name of resource
+func NewObjectTracker(types map[string]ResourceType) *ObjectTracker {
+	return &ObjectTracker{
+		types:    types,
+		objects:  make(map[string]map[string]runtime.Object),
+		watchers: make(map[string][]watcher),
+	}
+}
+
+func key(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func deepCopy(obj runtime.Object) (runtime.Object, error) {
+	copied, err := scheme.Scheme.DeepCopy(obj)
+	if err != nil {
+		return nil, err
+	}
+	return copied.(runtime.Object), nil
+}
+
+// Get returns a copy of object
+func (t *ObjectTracker) Get(resource, namespace, name string) (runtime.Object, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	obj, ok := t.objects[resource][key(namespace, name)]
+	if !ok {
+		return nil, errors.NewNotFound(netv1alpha1.Resource(resource), name)
+	}
+	return deepCopy(obj)
+}
+
+// List returns the list of objects in namespace matching the label selector,
+// empty namespace means all namespaces
+func (t *ObjectTracker) List(resource, namespace string, opts metav1.ListOptions) (runtime.Object, error) {
+	rt, ok := t.types[resource]
+	if !ok {
+		return nil, fmt.Errorf("unknown resource %s", resource)
+	}
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	var items []runtime.Object
+	for _, obj := range t.objects[resource] {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		if namespace != "" && accessor.GetNamespace() != namespace {
+			continue
+		}
+		if !selector.Matches(labels.Set(accessor.GetLabels())) {
+			continue
+		}
+		copied, err := deepCopy(obj)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, copied)
+	}
+	return rt.NewList(items), nil
+}
+
+// Add adds or replaces an object without checking resource version
+func (t *ObjectTracker) Add(resource string, obj runtime.Object) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	_, err := t.store(resource, obj)
+	return err
+}
+
+// Create adds an object, it fails if the object exists
+func (t *ObjectTracker) Create(resource, namespace string, obj runtime.Object) (runtime.Object, error) {
+	// do not modify the object of caller
+	obj, err := deepCopy(obj)
+	if err != nil {
+		return nil, err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	if accessor.GetNamespace() == "" {
+		accessor.SetNamespace(namespace)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.objects[resource][key(namespace, accessor.GetName())]; ok {
+		return nil, errors.NewAlreadyExists(netv1alpha1.Resource(resource), accessor.GetName())
+	}
+	if accessor.GetUID() == "" {
+		accessor.SetUID(types.UID(fmt.Sprintf("%s-%s-%s", resource, namespace, accessor.GetName())))
+	}
+	stored, err := t.store(resource, obj)
+	if err != nil {
+		return nil, err
+	}
+	t.notify(resource, namespace, watch.Added, stored)
+	return deepCopy(stored)
+}
+
+// Update replaces an object, it fails with conflict if the resource version
+// of object is set and not equal to the stored one
+func (t *ObjectTracker) Update(resource, namespace string, obj runtime.Object) (runtime.Object, error) {
+	// do not modify the object of caller
+	obj, err := deepCopy(obj)
+	if err != nil {
+		return nil, err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	old, ok := t.objects[resource][key(namespace, accessor.GetName())]
+	if !ok {
+		return nil, errors.NewNotFound(netv1alpha1.Resource(resource), accessor.GetName())
+	}
+	oldAccessor, err := meta.Accessor(old)
+	if err != nil {
+		return nil, err
+	}
+	if rv := accessor.GetResourceVersion(); rv != "" && rv != oldAccessor.GetResourceVersion() {
+		return nil, errors.NewConflict(netv1alpha1.Resource(resource), accessor.GetName(),
+			fmt.Errorf("the object has been modified, resource version %s is stale", rv))
+	}
+	accessor.SetNamespace(namespace)
+	accessor.SetUID(oldAccessor.GetUID())
+	stored, err := t.store(resource, obj)
+	if err != nil {
+		return nil, err
+	}
+	t.notify(resource, namespace, watch.Modified, stored)
+	return deepCopy(stored)
+}
+
+// Patch applies a merge or strategic merge patch to an object
+func (t *ObjectTracker) Patch(resource, namespace, name string, pt types.PatchType, data []byte) (runtime.Object, error) {
+	if pt != types.MergePatchType && pt != types.StrategicMergePatchType {
+		return nil, errors.NewBadRequest(fmt.Sprintf("patch type %s is not supported", pt))
+	}
+	rt, ok := t.types[resource]
+	if !ok {
+		return nil, fmt.Errorf("unknown resource %s", resource)
+	}
+	old, err := t.Get(resource, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	original, err := json.Marshal(old)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := strategicpatch.StrategicMergePatch(original, data, rt.NewObject())
+	if err != nil {
+		return nil, errors.NewBadRequest(err.Error())
+	}
+	obj := rt.NewObject()
+	if err := json.Unmarshal(patched, obj); err != nil {
+		return nil, err
+	}
+	// the patch is applied to the latest object
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	accessor.SetResourceVersion("")
+	return t.Update(resource, namespace, obj)
+}
+
+// Delete removes an object
+func (t *ObjectTracker) Delete(resource, namespace, name string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	obj, ok := t.objects[resource][key(namespace, name)]
+	if !ok {
+		return errors.NewNotFound(netv1alpha1.Resource(resource), name)
+	}
+	delete(t.objects[resource], key(namespace, name))
+	t.notify(resource, namespace, watch.Deleted, obj)
+	return nil
+}
+
+// Watch returns a watcher receiving the changes of objects in namespace after
+// now, empty namespace means all namespaces
+func (t *ObjectTracker) Watch(resource, namespace string) watch.Interface {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	w := watcher{namespace, watch.NewRaceFreeFake()}
+	t.watchers[resource] = append(t.watchers[resource], w)
+	return w.RaceFreeFakeWatcher
+}
+
+// store saves a copy of object with a new resource version, lock must be held
+func (t *ObjectTracker) store(resource string, obj runtime.Object) (runtime.Object, error) {
+	copied, err := deepCopy(obj)
+	if err != nil {
+		return nil, err
+	}
+	accessor, err := meta.Accessor(copied)
+	if err != nil {
+		return nil, err
+	}
+	t.resourceVersion++
+	accessor.SetResourceVersion(strconv.FormatUint(t.resourceVersion, 10))
+	if t.objects[resource] == nil {
+		t.objects[resource] = make(map[string]runtime.Object)
+	}
+	t.objects[resource][key(accessor.GetNamespace(), accessor.GetName())] = copied
+	return copied, nil
+}
+
+// notify sends event to the watchers of namespace, lock must be held
+func (t *ObjectTracker) notify(resource, namespace string, eventType watch.EventType, obj runtime.Object) {
+	for _, w := range t.watchers[resource] {
+		if w.namespace != "" && w.namespace != namespace {
+			continue
+		}
+		copied, err := deepCopy(obj)
+		if err != nil {
+			continue
+		}
+		w.Action(eventType, copied)
+	}
+}
+
+// ObjectReaction returns a reaction handling all actions with tracker, it is
+// the last reactor of fake clientset
+func ObjectReaction(t *ObjectTracker) ReactionFunc {
+	return func(action Action) (bool, runtime.Object, error) {
+		switch action.Verb {
+		case VerbGet:
+			obj, err := t.Get(action.Resource, action.Namespace, action.Name)
+			return true, obj, err
+		case VerbList:
+			obj, err := t.List(action.Resource, action.Namespace, action.ListOptions)
+			return true, obj, err
+		case VerbCreate:
+			obj, err := t.Create(action.Resource, action.Namespace, action.Object)
+			return true, obj, err
+		case VerbUpdate:
+			obj, err := t.Update(action.Resource, action.Namespace, action.Object)
+			return true, obj, err
+		case VerbPatch:
+			obj, err := t.Patch(action.Resource, action.Namespace, action.Name, action.PatchType, action.Patch)
+			return true, obj, err
+		case VerbDelete:
+			return true, nil, t.Delete(action.Resource, action.Namespace, action.Name)
+		case VerbDeleteCollection:
+			list, err := t.List(action.Resource, action.Namespace, action.ListOptions)
+			if err != nil {
+				return true, nil, err
+			}
+			items, err := meta.ExtractList(list)
+			if err != nil {
+				return true, nil, err
+			}
+			for _, item := range items {
+				accessor, err := meta.Accessor(item)
+				if err != nil {
+					return true, nil, err
+				}
+				if err := t.Delete(action.Resource, accessor.GetNamespace(), accessor.GetName()); err != nil && !errors.IsNotFound(err) {
+					return true, nil, err
+				}
+			}
+			return true, nil, nil
+		}
+		return false, nil, nil
+	}
+}
+
+// WatchReaction returns a watch reaction handling watch actions with tracker
+func WatchReaction(t *ObjectTracker) WatchReactionFunc {
+	return func(action Action) (bool, watch.Interface, error) {
+		return true, t.Watch(action.Resource, action.Namespace), nil
+	}
+}
@@ -28,6 +28,7 @@ import (
 type NetworkingV1alpha1Interface interface {
 	RESTClient() rest.Interface
 	LoadBalacnersGetter
+	LoadBalancerStatusViewsGetter
 }
 
 var _ NetworkingV1alpha1Interface = &NetworkingV1alpha1Client{}
@@ -42,6 +43,11 @@ func (c *NetworkingV1alpha1Client) LoadBalancers(namespace string) LoadBalancerI
 	return newLoadBalancers(c, namespace)
 }
 
+// LoadBalancerStatusViews returns LoadBalancerStatusViewInterface
+func (c *NetworkingV1alpha1Client) LoadBalancerStatusViews(namespace string) LoadBalancerStatusViewInterface {
+	return newLoadBalancerStatusViews(c, namespace)
+}
+
 // NewForConfig creates a new NetworkingV1alpha1Client for the given config.
 func NewForConfig(c *rest.Config) (*NetworkingV1alpha1Client, error) {
 	config := *c
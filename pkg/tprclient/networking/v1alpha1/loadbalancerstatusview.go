@@ -0,0 +1,154 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// LoadBalancerStatusViewsGetter has a method to return a LoadBalancerStatusViewInterface.
+// A group's client should implement this interface.
+type LoadBalancerStatusViewsGetter interface {
+	LoadBalancerStatusViews(namespace string) LoadBalancerStatusViewInterface
+}
+
+// LoadBalancerStatusViewInterface ...
+type LoadBalancerStatusViewInterface interface {
+	Create(*netv1alpha1.LoadBalancerStatusView) (*netv1alpha1.LoadBalancerStatusView, error)
+	Update(*netv1alpha1.LoadBalancerStatusView) (*netv1alpha1.LoadBalancerStatusView, error)
+	Delete(name string, options *v1.DeleteOptions) error
+	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
+	Get(name string, options v1.GetOptions) (*netv1alpha1.LoadBalancerStatusView, error)
+	List(opts v1.ListOptions) (*netv1alpha1.LoadBalancerStatusViewList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *netv1alpha1.LoadBalancerStatusView, err error)
+}
+
+var _ LoadBalancerStatusViewInterface = &loadbalancerstatusviews{}
+
+type loadbalancerstatusviews struct {
+	client rest.Interface
+	ns     string
+}
+
+func newLoadBalancerStatusViews(c *NetworkingV1alpha1Client, namespace string) *loadbalancerstatusviews {
+	return &loadbalancerstatusviews{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Create takes the representation of a loadbalancer status view and creates it.  Returns the server's representation of the loadbalancer status view, and an error, if there is any.
+func (c *loadbalancerstatusviews) Create(view *netv1alpha1.LoadBalancerStatusView) (result *netv1alpha1.LoadBalancerStatusView, err error) {
+	result = &netv1alpha1.LoadBalancerStatusView{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource(netv1alpha1.LoadBalancerStatusViewPlural).
+		Body(view).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a loadbalancer status view and updates it. Returns the server's representation of the loadbalancer status view, and an error, if there is any.
+func (c *loadbalancerstatusviews) Update(view *netv1alpha1.LoadBalancerStatusView) (result *netv1alpha1.LoadBalancerStatusView, err error) {
+	result = &netv1alpha1.LoadBalancerStatusView{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource(netv1alpha1.LoadBalancerStatusViewPlural).
+		Name(view.Name).
+		Body(view).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the loadbalancer status view and deletes it. Returns an error if one occurs.
+func (c *loadbalancerstatusviews) Delete(name string, options *v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource(netv1alpha1.LoadBalancerStatusViewPlural).
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *loadbalancerstatusviews) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource(netv1alpha1.LoadBalancerStatusViewPlural).
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Get takes name of the loadbalancer status view, and returns the corresponding loadbalancer status view object, and an error if there is any.
+func (c *loadbalancerstatusviews) Get(name string, options v1.GetOptions) (result *netv1alpha1.LoadBalancerStatusView, err error) {
+	result = &netv1alpha1.LoadBalancerStatusView{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource(netv1alpha1.LoadBalancerStatusViewPlural).
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of LoadBalancerStatusViews that match those selectors.
+func (c *loadbalancerstatusviews) List(opts v1.ListOptions) (result *netv1alpha1.LoadBalancerStatusViewList, err error) {
+	result = &netv1alpha1.LoadBalancerStatusViewList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource(netv1alpha1.LoadBalancerStatusViewPlural).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested loadbalancer status views.
+func (c *loadbalancerstatusviews) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource(netv1alpha1.LoadBalancerStatusViewPlural).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Watch()
+}
+
+// Patch applies the patch and returns the patched loadbalancer status view.
+func (c *loadbalancerstatusviews) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *netv1alpha1.LoadBalancerStatusView, err error) {
+	result = &netv1alpha1.LoadBalancerStatusView{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource(netv1alpha1.LoadBalancerStatusViewPlural).
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit reports the differences between the desired objects and the
+// live ones left by the ensure logic of plugins, which reveals the fields
+// the controller generates but never reconciles
+package audit
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	"github.com/caicloud/loadbalancer-controller/pkg/metrics"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// enabled turns on the audit, it is set once at startup
+var enabled bool
+
+// SetEnabled turns on or off the audit
+func SetEnabled(on bool) {
+	enabled = on
+}
+
+// Enabled returns true if the audit is on
+func Enabled() bool {
+	return enabled
+}
+
+// Compare logs the fields where desired differs from live at debug level and
+// counts them, live is the object corrected by the ensure logic. It does
+// nothing if the audit is off
+func Compare(plugin, kind, name string, desired, live interface{}) {
+	if !enabled {
+		return
+	}
+	for _, field := range Diff(desired, live) {
+		log.Debug("Unreconciled difference", log.Fields{"plugin": plugin, "kind": kind, "name": name, "field": field})
+		metrics.IncUnreconciledDiff(plugin, kind, field)
+	}
+}
+
+// Diff returns the json paths of fields set in desired but different in live,
+// the index of list is omitted in path. The unset fields in desired are
+// skipped as they are defaulted by apiserver
+func Diff(desired, live interface{}) []string {
+	var fields []string
+	diff(reflect.ValueOf(desired), reflect.ValueOf(live), "", &fields)
+	return fields
+}
+
+// leafTypes are compared as a whole instead of field by field
+var leafTypes = map[reflect.Type]bool{
+	reflect.TypeOf(resource.Quantity{}):    true,
+	reflect.TypeOf(metav1.Time{}):          true,
+	reflect.TypeOf(intstr.IntOrString{}):   true,
+	reflect.TypeOf(metav1.LabelSelector{}): true,
+}
+
+func diff(desired, live reflect.Value, path string, fields *[]string) {
+	if !desired.IsValid() || isZero(desired) {
+		return
+	}
+	if !live.IsValid() {
+		*fields = append(*fields, path)
+		return
+	}
+	if apiequality.Semantic.DeepEqual(desired.Interface(), live.Interface()) {
+		return
+	}
+
+	switch desired.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if live.IsNil() {
+			*fields = append(*fields, path)
+			return
+		}
+		diff(desired.Elem(), live.Elem(), path, fields)
+	case reflect.Struct:
+		if leafTypes[desired.Type()] {
+			*fields = append(*fields, path)
+			return
+		}
+		for i := 0; i < desired.NumField(); i++ {
+			field := desired.Type().Field(i)
+			if field.PkgPath != "" {
+				// unexported
+				continue
+			}
+			diff(desired.Field(i), live.Field(i), join(path, field), fields)
+		}
+	case reflect.Slice, reflect.Array:
+		if desired.Len() != live.Len() {
+			*fields = append(*fields, path)
+			return
+		}
+		for i := 0; i < desired.Len(); i++ {
+			diff(desired.Index(i), live.Index(i), path+"[]", fields)
+		}
+	case reflect.Map:
+		for _, key := range desired.MapKeys() {
+			diff(desired.MapIndex(key), live.MapIndex(key), path+"["+key.String()+"]", fields)
+		}
+	default:
+		*fields = append(*fields, path)
+	}
+}
+
+// join appends the json name of field to path, the inline field is skipped
+func join(path string, field reflect.StructField) string {
+	tag := field.Tag.Get("json")
+	name := strings.Split(tag, ",")[0]
+	if field.Anonymous || strings.Contains(tag, ",inline") {
+		return path
+	}
+	if name == "" {
+		name = field.Name
+	}
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil() || (v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface && v.Len() == 0)
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package canary
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/caicloud/loadbalancer-controller/config"
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	"github.com/caicloud/loadbalancer-controller/pkg/metrics"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+var (
+	rolloutsLock sync.RWMutex
+	// rollouts are all rollouts keyed by plugin name, served by ServeCanary
+	rollouts = make(map[string]*Rollout)
+)
+
+// Rollout rolls the canary image of a plugin out to the canary loadbalancers
+// first, which are the annotated ones and a percentage of the others. The
+// rollout is paused if a canary workload does not become available before
+// progress deadline, the loadbalancers already running canary image are kept
+type Rollout struct {
+	name             string
+	stable           string
+	canary           string
+	percentage       int
+	progressDeadline time.Duration
+
+	lock   sync.Mutex
+	paused bool
+	// running records the loadbalancers running canary image and the time
+	// since when they are unavailable, zero means available
+	running map[string]time.Time
+}
+
+// NewRollout returns a rollout of plugin and registers it for ServeCanary
+func NewRollout(name, stable, canary string, cfg config.Rollout) *Rollout {
+	r := &Rollout{
+		name:             name,
+		stable:           stable,
+		canary:           canary,
+		percentage:       cfg.CanaryPercentage,
+		progressDeadline: time.Duration(cfg.CanaryProgressDeadline) * time.Second,
+		running:          make(map[string]time.Time),
+	}
+	metrics.CanaryPaused.Set(name, new(expvar.Int))
+
+	rolloutsLock.Lock()
+	defer rolloutsLock.Unlock()
+	rollouts[name] = r
+	return r
+}
+
+// Enabled returns true if there is a canary image different from the stable one
+func (r *Rollout) Enabled() bool {
+	return r.canary != "" && r.canary != r.stable
+}
+
+// Selected returns true if lb is a canary loadbalancer
+func (r *Rollout) Selected(lb *netv1alpha1.LoadBalancer) bool {
+	if lb.Annotations[netv1alpha1.AnnotationKeyCanary] == "true" {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(lb.Namespace + "/" + lb.Name))
+	return int(h.Sum32()%100) < r.percentage
+}
+
+// Image returns the image which lb should run
+func (r *Rollout) Image(lb *netv1alpha1.LoadBalancer) string {
+	if !r.Enabled() || !r.Selected(lb) {
+		return r.stable
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.running[key(lb)]; r.paused && !ok {
+		return r.stable
+	}
+	return r.canary
+}
+
+// Observe records the image and availability of the workload of lb, it returns
+// the duration after which lb should be observed again if the canary workload
+// is still progressing, and whether the rollout is paused by this observation
+func (r *Rollout) Observe(lb *netv1alpha1.LoadBalancer, image string, available bool) (time.Duration, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	k := key(lb)
+	if !r.Enabled() || image != r.canary {
+		delete(r.running, k)
+		return 0, false
+	}
+	if available {
+		r.running[k] = time.Time{}
+		return 0, false
+	}
+
+	since, ok := r.running[k]
+	if !ok || since.IsZero() {
+		since = time.Now()
+		r.running[k] = since
+	}
+	remaining := r.progressDeadline - time.Since(since)
+	if remaining > 0 {
+		return remaining, false
+	}
+	if r.paused {
+		return 0, false
+	}
+	r.setPaused(true)
+	log.Warn("Pause rollout of canary image, canary workload is not available in time", log.Fields{
+		"plugin": r.name, "image": r.canary, "lb.ns": lb.Namespace, "lb.name": lb.Name,
+	})
+	return 0, true
+}
+
+// Forget removes the records of lb when it is deleted
+func (r *Rollout) Forget(lb *netv1alpha1.LoadBalancer) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.running, key(lb))
+}
+
+// Paused returns true if the rollout is paused
+func (r *Rollout) Paused() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.paused
+}
+
+// Resume resumes the paused rollout
+func (r *Rollout) Resume() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.setPaused(false)
+	log.Info("Resume rollout of canary image", log.Fields{"plugin": r.name, "image": r.canary})
+}
+
+// setPaused sets the state of rollout, lock must be held
+func (r *Rollout) setPaused(paused bool) {
+	r.paused = paused
+	value := new(expvar.Int)
+	if paused {
+		value.Set(1)
+	}
+	metrics.CanaryPaused.Set(r.name, value)
+}
+
+type rolloutStatus struct {
+	Stable  string `json:"stable"`
+	Canary  string `json:"canary,omitempty"`
+	Paused  bool   `json:"paused"`
+	Running int    `json:"running"`
+}
+
+// ServeCanary serves the state of all rollouts on GET
+func ServeCanary(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "expect GET", http.StatusMethodNotAllowed)
+		return
+	}
+	rolloutsLock.RLock()
+	defer rolloutsLock.RUnlock()
+	writeRollouts(w)
+}
+
+// ServeCanaryResume resumes the rollout of plugin on POST with query
+// ?plugin=name&paused=false, it is served by the admin server
+func ServeCanaryResume(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "expect POST", http.StatusMethodNotAllowed)
+		return
+	}
+	rolloutsLock.RLock()
+	defer rolloutsLock.RUnlock()
+
+	r, ok := rollouts[req.URL.Query().Get("plugin")]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown plugin %q", req.URL.Query().Get("plugin")), http.StatusNotFound)
+		return
+	}
+	paused, err := strconv.ParseBool(req.URL.Query().Get("paused"))
+	if err != nil || paused {
+		http.Error(w, "only paused=false is supported, rollout is paused automatically", http.StatusBadRequest)
+		return
+	}
+	r.Resume()
+	writeRollouts(w)
+}
+
+// writeRollouts writes the state of all rollouts in json, the caller must
+// hold rolloutsLock
+func writeRollouts(w http.ResponseWriter) {
+	status := make(map[string]rolloutStatus, len(rollouts))
+	for name, r := range rollouts {
+		r.lock.Lock()
+		status[name] = rolloutStatus{
+			Stable:  r.stable,
+			Canary:  r.canary,
+			Paused:  r.paused,
+			Running: len(r.running),
+		}
+		r.lock.Unlock()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// DeploymentAvailable returns true if all replicas of the latest template of
+// deployment are available
+func DeploymentAvailable(d *extensions.Deployment) bool {
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	return d.Status.ObservedGeneration >= d.Generation &&
+		d.Status.UpdatedReplicas >= replicas &&
+		d.Status.AvailableReplicas >= replicas
+}
+
+// DaemonSetAvailable returns true if all pods of the latest template of
+// daemonset are available
+func DaemonSetAvailable(ds *extensions.DaemonSet) bool {
+	return ds.Status.ObservedGeneration >= ds.Generation &&
+		ds.Status.UpdatedNumberScheduled >= ds.Status.DesiredNumberScheduled &&
+		ds.Status.NumberUnavailable == 0
+}
+
+func key(lb *netv1alpha1.LoadBalancer) string {
+	return lb.Namespace + "/" + lb.Name
+}
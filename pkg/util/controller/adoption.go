@@ -0,0 +1,77 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+)
+
+// adoptionPaused is a cluster-scoped switch shared by all ControllerRefManagers,
+// 1 means orphans are not adopted and owned objects are not released
+var adoptionPaused int32
+
+// PauseAdoption stops all ControllerRefManagers from adopting orphans and
+// releasing owned objects, e.g. while LoadBalancers are moved between namespaces
+func PauseAdoption() {
+	atomic.StoreInt32(&adoptionPaused, 1)
+	log.Warn("Adoption of orphans paused")
+}
+
+// ResumeAdoption restores the claim behavior of ControllerRefManagers
+func ResumeAdoption() {
+	atomic.StoreInt32(&adoptionPaused, 0)
+	log.Info("Adoption of orphans resumed")
+}
+
+// AdoptionPaused returns true if adoption is paused
+func AdoptionPaused() bool {
+	return atomic.LoadInt32(&adoptionPaused) == 1
+}
+
+// ServeAdoption serves the state of adoption switch on GET
+func ServeAdoption(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "expect GET", http.StatusMethodNotAllowed)
+		return
+	}
+	fmt.Fprintf(w, "{\"paused\":%v}\n", AdoptionPaused())
+}
+
+// ServeAdoptionSwitch changes the adoption switch on POST with query
+// ?paused=true|false, it is served by the admin server
+func ServeAdoptionSwitch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "expect POST", http.StatusMethodNotAllowed)
+		return
+	}
+	paused, err := strconv.ParseBool(r.URL.Query().Get("paused"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid query paused: %v", err), http.StatusBadRequest)
+		return
+	}
+	if paused {
+		PauseAdoption()
+	} else {
+		ResumeAdoption()
+	}
+	fmt.Fprintf(w, "{\"paused\":%v}\n", AdoptionPaused())
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+var (
+	// DefaultBreaker is shared by all helpers, because they talk to the same api server
+	DefaultBreaker = NewCircuitBreaker(3, time.Second, 2*time.Minute)
+)
+
+// CircuitBreaker opens after api server is unavailable for threshold times
+// in a row, and then backs off exponentially until a success is reported
+type CircuitBreaker struct {
+	lock sync.Mutex
+
+	threshold int
+	baseDelay time.Duration
+	maxDelay  time.Duration
+
+	failures  int
+	openUntil time.Time
+}
+
+// NewCircuitBreaker returns a new CircuitBreaker
+func NewCircuitBreaker(threshold int, baseDelay, maxDelay time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		baseDelay: baseDelay,
+		maxDelay:  maxDelay,
+	}
+}
+
+// Remaining returns the remaining duration before the breaker closes,
+// zero means requests are allowed
+func (b *CircuitBreaker) Remaining() time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	remaining := b.openUntil.Sub(time.Now())
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Success closes the breaker
+func (b *CircuitBreaker) Success() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.failures >= b.threshold {
+		log.Info("Api server is available again, close circuit breaker")
+	}
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+// Failure records an unavailability of api server and returns the backoff
+func (b *CircuitBreaker) Failure() time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures++
+	if b.failures < b.threshold {
+		return 0
+	}
+
+	delay := b.baseDelay
+	for i := b.threshold; i < b.failures && delay < b.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > b.maxDelay {
+		delay = b.maxDelay
+	}
+	if b.failures == b.threshold {
+		log.Warn("Api server is unavailable, open circuit breaker", log.Fields{"failures": b.failures})
+	}
+	b.openUntil = time.Now().Add(delay)
+	return delay
+}
+
+// IsAPIUnavailable checks whether the error is caused by unavailability of api server
+func IsAPIUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.IsServerTimeout(err) || errors.IsTimeout(err) || errors.IsTooManyRequests(err) {
+		return true
+	}
+	if status, ok := err.(errors.APIStatus); ok && status.Status().Reason == metav1.StatusReasonServiceUnavailable {
+		return true
+	}
+	if utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err) {
+		return true
+	}
+	if uerr, ok := err.(*url.Error); ok {
+		err = uerr.Err
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return false
+}
@@ -20,23 +20,41 @@ import (
 	"fmt"
 	"sync"
 
-	log "github.com/zoumo/logdog"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	"github.com/caicloud/loadbalancer-controller/pkg/metrics"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
 	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/tools/record"
 
 	"k8s.io/kubernetes/pkg/controller"
 )
 
+// Reasons of events recorded on the controller by ControllerRefManager
+const (
+	// EventReasonAdopted is used when an orphan object is adopted
+	EventReasonAdopted = "Adopted"
+	// EventReasonReleased is used when an owned object is released
+	EventReasonReleased = "Released"
+	// EventReasonOwnedByOthers is used when an object matches the selector
+	// but is owned by another controller, it implies a label collision
+	EventReasonOwnedByOthers = "OwnedByOthers"
+)
+
 type baseControllerRefManager struct {
 	controller metav1.Object
 	selector   labels.Selector
+	// kind of objects managed
+	kind     string
+	recorder record.EventRecorder
 
 	canAdoptErr  error
 	canAdoptOnce sync.Once
@@ -52,11 +70,22 @@ func (m *baseControllerRefManager) canAdopt() error {
 	return m.canAdoptErr
 }
 
+func (m *baseControllerRefManager) eventf(eventtype, reason, messageFmt string, args ...interface{}) {
+	if m.recorder == nil {
+		return
+	}
+	obj, ok := m.controller.(runtime.Object)
+	if !ok {
+		return
+	}
+	m.recorder.Eventf(obj, eventtype, reason, messageFmt, args...)
+}
+
 // claimObject tries to take ownership of an object for this controller.
 //
 // It will reconcile the following:
-//   * Adopt orphans if the match function returns true.
-//   * Release owned objects if the match function returns false.
+//   - Adopt orphans if the match function returns true.
+//   - Release owned objects if the match function returns false.
 //
 // A non-nil error is returned if some form of reconciliation was attemped and
 // failed. Usually, controllers should try again later in case reconciliation
@@ -66,12 +95,17 @@ func (m *baseControllerRefManager) canAdopt() error {
 // reconciliation was necessary. The returned boolean indicates whether you now
 // own the object.
 //
-// No reconciliation will be attempted if the controller is being deleted.
+// No reconciliation will be attempted if the controller is being deleted or
+// adoption is paused.
 func (m *baseControllerRefManager) claimObject(obj metav1.Object, match func(metav1.Object) bool, adopt, release func(metav1.Object) error) (bool, error) {
 	controllerRef := controller.GetControllerOf(obj)
 	if controllerRef != nil {
 		if controllerRef.UID != m.controller.GetUID() {
 			// Owned by someone else. Ignore.
+			if match(obj) {
+				metrics.IncControllerRef(m.kind, metrics.ActionIgnored)
+				m.eventf(v1.EventTypeWarning, EventReasonOwnedByOthers, "%s %s/%s matches selector but is owned by %s %s", m.kind, obj.GetNamespace(), obj.GetName(), controllerRef.Kind, controllerRef.Name)
+			}
 			return false, nil
 		}
 		if match(obj) {
@@ -79,11 +113,12 @@ func (m *baseControllerRefManager) claimObject(obj metav1.Object, match func(met
 			// Return true (successfully claimed) before checking deletion timestamp.
 			// We're still allowed to claim things we already own while being deleted
 			// because doing so requires taking no actions.
+			metrics.IncControllerRef(m.kind, metrics.ActionClaimed)
 			return true, nil
 		}
 		// Owned by us but selector doesn't match.
-		// Try to release, unless we're being deleted.
-		if m.controller.GetDeletionTimestamp() != nil {
+		// Try to release, unless we're being deleted or adoption is paused.
+		if m.controller.GetDeletionTimestamp() != nil || AdoptionPaused() {
 			return false, nil
 		}
 		if err := release(obj); err != nil {
@@ -96,6 +131,8 @@ func (m *baseControllerRefManager) claimObject(obj metav1.Object, match func(met
 			return false, err
 		}
 		// Successfully released.
+		metrics.IncControllerRef(m.kind, metrics.ActionReleased)
+		m.eventf(v1.EventTypeNormal, EventReasonReleased, "Release %s %s/%s", m.kind, obj.GetNamespace(), obj.GetName())
 		return false, nil
 	}
 
@@ -108,6 +145,11 @@ func (m *baseControllerRefManager) claimObject(obj metav1.Object, match func(met
 		// Ignore if the object is being deleted
 		return false, nil
 	}
+	if AdoptionPaused() {
+		// Ignore orphans while adoption is paused, they may be in migration
+		metrics.IncControllerRef(m.kind, metrics.ActionIgnored)
+		return false, nil
+	}
 	// Selector matches. Try to adopt.
 	if err := adopt(obj); err != nil {
 		// If the pod no longer exists, ignore the error.
@@ -119,6 +161,8 @@ func (m *baseControllerRefManager) claimObject(obj metav1.Object, match func(met
 		return false, err
 	}
 	// Successfully adopted.
+	metrics.IncControllerRef(m.kind, metrics.ActionAdopted)
+	m.eventf(v1.EventTypeNormal, EventReasonAdopted, "Adopt %s %s/%s", m.kind, obj.GetNamespace(), obj.GetName())
 	return true, nil
 }
 
@@ -139,11 +183,14 @@ func NewDaemonSetControllerRefManager(
 	selector labels.Selector,
 	controllerKind schema.GroupVersionKind,
 	canAdopt func() error,
+	recorder record.EventRecorder,
 ) *DaemonSetControllerRefManager {
 	return &DaemonSetControllerRefManager{
 		baseControllerRefManager: baseControllerRefManager{
 			controller:   controller,
 			selector:     selector,
+			kind:         "DaemonSet",
+			recorder:     recorder,
 			canAdoptFunc: canAdopt,
 		},
 		controllerKind: controllerKind,
@@ -154,8 +201,8 @@ func NewDaemonSetControllerRefManager(
 // Claim tries to take ownership of a list of DaemonSets.
 //
 // It will reconcile the following:
-//   * Adopt orphans if the selector matches.
-//   * Release owned objects if the selector no longer matches.
+//   - Adopt orphans if the selector matches.
+//   - Release owned objects if the selector no longer matches.
 //
 // A non-nil error is returned if some form of reconciliation was attemped and
 // failed. Usually, controllers should try again later in case reconciliation
@@ -254,11 +301,14 @@ func NewDeploymentControllerRefManager(
 	selector labels.Selector,
 	controllerKind schema.GroupVersionKind,
 	canAdopt func() error,
+	recorder record.EventRecorder,
 ) *DeploymentControllerRefManager {
 	return &DeploymentControllerRefManager{
 		baseControllerRefManager: baseControllerRefManager{
 			controller:   controller,
 			selector:     selector,
+			kind:         "Deployment",
+			recorder:     recorder,
 			canAdoptFunc: canAdopt,
 		},
 		controllerKind: controllerKind,
@@ -269,8 +319,8 @@ func NewDeploymentControllerRefManager(
 // Claim tries to take ownership of a list of Deployments.
 //
 // It will reconcile the following:
-//   * Adopt orphans if the selector matches.
-//   * Release owned objects if the selector no longer matches.
+//   - Adopt orphans if the selector matches.
+//   - Release owned objects if the selector no longer matches.
 //
 // A non-nil error is returned if some form of reconciliation was attemped and
 // failed. Usually, controllers should try again later in case reconciliation
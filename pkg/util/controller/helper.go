@@ -20,9 +20,11 @@ import (
 	"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	log "github.com/zoumo/logdog"
+	"github.com/caicloud/loadbalancer-controller/pkg/health"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -32,7 +34,9 @@ import (
 )
 
 const (
-	maxRetries = 3
+	// stuckTimeout is how long the queue can wait without any item processed
+	// before the workers are considered as stuck
+	stuckTimeout = 5 * time.Minute
 )
 
 var (
@@ -44,8 +48,15 @@ var (
 type syncHandler func(key interface{}) error
 type keyFunc func(obj interface{}) (interface{}, error)
 
+// SyncFailureHandler is called with the failures of obj after each failed
+// sync, degraded is true for the failure which slows down the retries of obj.
+// It is called with nil failure once obj is synced again after failures
+type SyncFailureHandler func(obj interface{}, failure *Failure, degraded bool)
+
 // Helper is a helper for creating a k8s controller easily
 type Helper struct {
+	// Name scopes the keys in retry state
+	Name     string
 	SyncType reflect.Type
 	// queue is the work queue the worker polls
 	Queue workqueue.RateLimitingInterface
@@ -53,8 +64,18 @@ type Helper struct {
 	SyncHandler syncHandler
 	// KeyFunc is called to get key from obj
 	keyFunc keyFunc
+	// SyncFailureHandler surfaces the repeated failures of syncing, optional
+	SyncFailureHandler SyncFailureHandler
+
+	breaker    *CircuitBreaker
+	retryState *RetryState
 
 	waitGroup sync.WaitGroup
+	// lastActive is the unix nano time when workers last got or finished an item
+	lastActive int64
+
+	// inspection is the state of queue inspected on /debug/queues
+	inspection *inspection
 
 	Enqueue             func(obj interface{})
 	EnqueueRateLimited  func(obj interface{})
@@ -74,7 +95,10 @@ func NewHelperForKeyFunc(syncObject runtime.Object, queue workqueue.RateLimiting
 		Queue:       queue,
 		SyncHandler: syncHandler,
 		keyFunc:     keyFunc,
+		breaker:     DefaultBreaker,
+		retryState:  DefaultRetryState,
 		waitGroup:   sync.WaitGroup{},
+		inspection:  newInspection(),
 	}
 
 	helper.Enqueue = helper.enqueue
@@ -91,6 +115,9 @@ func NewHelperForKeyFunc(syncObject runtime.Object, queue workqueue.RateLimiting
 
 // Run starts n workers to sync
 func (helper *Helper) Run(workers int, stopCh <-chan struct{}) {
+	helper.active()
+	health.AddLivenessCheck("workqueue-"+helper.Name, helper.checkStuck)
+	registerHelper(helper)
 	for i := 0; i < workers; i++ {
 		go wait.Until(helper.worker, time.Second, stopCh)
 	}
@@ -116,6 +143,7 @@ func (helper *Helper) enqueue(obj interface{}) {
 		utilruntime.HandleError(fmt.Errorf("Couldn't get key for %v %#v: %v", helper.SyncType, obj, err))
 		return
 	}
+	helper.inspection.enqueued(shortKey(key))
 	helper.Queue.Add(key)
 }
 
@@ -132,6 +160,7 @@ func (helper *Helper) enqueueRateLimited(obj interface{}) {
 		utilruntime.HandleError(fmt.Errorf("Couldn't get key for %v %#v: %v", helper.SyncType, obj, err))
 		return
 	}
+	helper.inspection.enqueued(shortKey(key))
 	helper.Queue.AddRateLimited(key)
 }
 
@@ -147,6 +176,7 @@ func (helper *Helper) enqueueAfter(obj interface{}, after time.Duration) {
 		utilruntime.HandleError(fmt.Errorf("Couldn't get key for %v %#v: %v", helper.SyncType, obj, err))
 		return
 	}
+	helper.inspection.enqueued(shortKey(key))
 	helper.Queue.AddAfter(key, after)
 }
 
@@ -167,7 +197,17 @@ func (helper *Helper) processNextWorkItem() bool {
 	if quit {
 		return false
 	}
+	helper.active()
+	defer helper.active()
 	defer helper.Queue.Done(obj)
+	helper.inspection.dequeued(shortKey(obj))
+
+	// back off while api server is unavailable
+	if remaining := helper.breaker.Remaining(); remaining > 0 {
+		helper.inspection.enqueued(shortKey(obj))
+		helper.Queue.AddAfter(obj, remaining)
+		return true
+	}
 
 	err := helper.SyncHandler(obj)
 	helper.HandleSyncError(err, obj)
@@ -175,31 +215,74 @@ func (helper *Helper) processNextWorkItem() bool {
 	return true
 }
 
+func (helper *Helper) active() {
+	atomic.StoreInt64(&helper.lastActive, time.Now().UnixNano())
+}
+
+// checkStuck returns an error if items are waiting in queue but no worker
+// has been active for stuckTimeout
+func (helper *Helper) checkStuck() error {
+	if helper.IsShuttingDown() {
+		return nil
+	}
+	idle := time.Since(time.Unix(0, atomic.LoadInt64(&helper.lastActive)))
+	if n := helper.Queue.Len(); n > 0 && idle > stuckTimeout {
+		return fmt.Errorf("%d items waiting, workers idle for %v", n, idle)
+	}
+	return nil
+}
+
 // HandleSyncError handles error when sync obj error and retry n times
 func (helper *Helper) HandleSyncError(err error, obj interface{}) {
+	// get short key no matter what the keyfunc is
+	key := shortKey(obj)
+	stateKey := helper.Name + "/" + key
+	helper.inspection.synced(key, err)
+
 	if err == nil {
 		// no err
+		helper.breaker.Success()
 		helper.Queue.Forget(obj)
+		if helper.retryState.Forget(stateKey) && helper.SyncFailureHandler != nil {
+			helper.SyncFailureHandler(obj, nil, false)
+		}
 		return
 	}
 
-	var key interface{}
+	if IsAPIUnavailable(err) {
+		// the failure is not counted, retry after backoff
+		delay := helper.breaker.Failure()
+		log.Debug("Api server is unavailable, retry later", log.Fields{"type": helper.SyncType, "obj": key, "delay": delay, "err": err})
+		helper.inspection.enqueued(key)
+		if delay == 0 {
+			helper.Queue.AddRateLimited(obj)
+			return
+		}
+		helper.Queue.AddAfter(obj, delay)
+		return
+	}
 
-	// get short key no matter what the keyfunc is
-	key, kerr := KeyFunc(obj)
-	if kerr != nil {
-		key = obj
+	slow := DefaultSlowRetry
+	failure := helper.retryState.Failed(stateKey, err)
+	degraded := failure.Count == slow.Threshold
+	if helper.SyncFailureHandler != nil {
+		helper.SyncFailureHandler(obj, &failure, degraded)
 	}
 
-	if helper.Queue.NumRequeues(obj) < maxRetries {
-		log.Warn("Error syncing object, retry", log.Fields{"type": helper.SyncType, "obj": key, "err": err})
+	helper.inspection.enqueued(key)
+	if failure.Count < slow.Threshold {
+		log.Warn("Error syncing object, retry", log.Fields{"type": helper.SyncType, "obj": key, "failures": failure.Count, "err": err})
 		helper.Queue.AddRateLimited(obj)
 		return
 	}
 
-	utilruntime.HandleError(err)
-	log.Warn("Dropping object out of queue", log.Fields{"type": helper.SyncType, "obj": key, "err": err})
+	// the error is persistent, retry slowly until it is fixed
+	if degraded {
+		utilruntime.HandleError(err)
+		log.Warn("Object keeps failing, slow down retries", log.Fields{"type": helper.SyncType, "obj": key, "failures": failure.Count, "interval": slow.Interval, "err": err})
+	}
 	helper.Queue.Forget(obj)
+	helper.Queue.AddAfter(obj, slow.Interval)
 }
 
 // ShutDown shuts down the work queue and waits for the worker to ACK
@@ -0,0 +1,163 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// helpers are the running helpers inspected on /debug/queues, keyed by name
+var helpers = struct {
+	lock sync.Mutex
+	m    map[string]*Helper
+}{m: map[string]*Helper{}}
+
+func registerHelper(helper *Helper) {
+	helpers.lock.Lock()
+	defer helpers.lock.Unlock()
+	helpers.m[helper.Name] = helper
+}
+
+// shortKey returns the namespace/name key of obj no matter what the keyfunc is
+func shortKey(obj interface{}) string {
+	key, err := KeyFunc(obj)
+	if err != nil {
+		return fmt.Sprintf("%v", obj)
+	}
+	return key
+}
+
+// SyncError is the last error of syncing a key
+type SyncError struct {
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+// inspection records the keys waiting in queue, including the delayed and
+// rate limited ones which are invisible in queue, and the last sync errors
+// of keys which have not been synced successfully since then
+type inspection struct {
+	lock    sync.Mutex
+	pending map[string]time.Time
+	errors  map[string]SyncError
+}
+
+func newInspection() *inspection {
+	return &inspection{
+		pending: map[string]time.Time{},
+		errors:  map[string]SyncError{},
+	}
+}
+
+func (i *inspection) enqueued(key string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if _, ok := i.pending[key]; !ok {
+		i.pending[key] = time.Now()
+	}
+}
+
+func (i *inspection) dequeued(key string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	delete(i.pending, key)
+}
+
+func (i *inspection) synced(key string, err error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	if err == nil {
+		delete(i.errors, key)
+		return
+	}
+	i.errors[key] = SyncError{Error: err.Error(), Time: time.Now()}
+}
+
+// QueueState is the inspected state of the queue of a helper
+type QueueState struct {
+	// Length is the number of keys ready to be processed
+	Length int `json:"length"`
+	// Pending are the keys enqueued but not processed yet, sorted by key
+	Pending []PendingKey `json:"pending"`
+	// Errors are the last sync errors of keys keyed by key
+	Errors map[string]SyncError `json:"errors,omitempty"`
+}
+
+// PendingKey is a key waiting in queue
+type PendingKey struct {
+	Key   string    `json:"key"`
+	Since time.Time `json:"since"`
+}
+
+// State returns the inspected state of the queue
+func (helper *Helper) State() QueueState {
+	i := helper.inspection
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	state := QueueState{
+		Length:  helper.Queue.Len(),
+		Pending: make([]PendingKey, 0, len(i.pending)),
+		Errors:  make(map[string]SyncError, len(i.errors)),
+	}
+	for key, since := range i.pending {
+		state.Pending = append(state.Pending, PendingKey{Key: key, Since: since})
+	}
+	sort.Slice(state.Pending, func(a, b int) bool { return state.Pending[a].Key < state.Pending[b].Key })
+	for key, e := range i.errors {
+		state.Errors[key] = e
+	}
+	return state
+}
+
+// SyncErrors returns the last sync errors of key in all the running queues,
+// keyed by the name of helper
+func SyncErrors(key string) map[string]SyncError {
+	helpers.lock.Lock()
+	defer helpers.lock.Unlock()
+
+	errs := make(map[string]SyncError)
+	for name, helper := range helpers.m {
+		helper.inspection.lock.Lock()
+		if e, ok := helper.inspection.errors[key]; ok {
+			errs[name] = e
+		}
+		helper.inspection.lock.Unlock()
+	}
+	return errs
+}
+
+// ServeQueues prints the pending keys and last sync errors of all the running
+// queues on /debug/queues, keyed by the name of helper
+func ServeQueues(w http.ResponseWriter, r *http.Request) {
+	helpers.lock.Lock()
+	states := make(map[string]QueueState, len(helpers.m))
+	for name, helper := range helpers.m {
+		states[name] = helper.State()
+	}
+	helpers.lock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(states)
+}
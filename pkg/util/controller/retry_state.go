@@ -0,0 +1,148 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+)
+
+var (
+	// DefaultRetryState is shared by all helpers, it is persisted to file
+	// after LoadRetryState is called
+	DefaultRetryState = &RetryState{Failures: map[string]*Failure{}}
+)
+
+// Failure records the failures of syncing a key
+type Failure struct {
+	Count     int       `json:"count"`
+	LastError string    `json:"lastError"`
+	LastTime  time.Time `json:"lastTime"`
+}
+
+// SlowRetry degrades the retries of a key to a fixed slow interval once it
+// fails Threshold times in a row, instead of hot looping on a persistent error
+type SlowRetry struct {
+	Threshold int
+	Interval  time.Duration
+}
+
+// DefaultSlowRetry is shared by all helpers, it is set by SetSlowRetry at
+// startup before the helpers run
+var DefaultSlowRetry = SlowRetry{Threshold: 5, Interval: 5 * time.Minute}
+
+// SetSlowRetry sets the threshold and interval of DefaultSlowRetry
+func SetSlowRetry(threshold int, interval time.Duration) {
+	DefaultSlowRetry = SlowRetry{Threshold: threshold, Interval: interval}
+}
+
+// RetryState records the failures of keys, so that retries are stable
+// across restarts of controller
+type RetryState struct {
+	lock sync.Mutex
+	path string
+
+	Failures map[string]*Failure `json:"failures"`
+}
+
+// LoadRetryState loads the retry state from path into DefaultRetryState,
+// and persists the state to path when it changes
+func LoadRetryState(path string) error {
+	state := DefaultRetryState
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.path = path
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return err
+	}
+	if state.Failures == nil {
+		state.Failures = map[string]*Failure{}
+	}
+	log.Info("Load retry state", log.Fields{"path": path, "failures": len(state.Failures)})
+	return nil
+}
+
+// Failed records a failure of key and returns the failures of key so far
+func (s *RetryState) Failed(key string, err error) Failure {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	f, ok := s.Failures[key]
+	if !ok {
+		f = &Failure{}
+		s.Failures[key] = f
+	}
+	f.Count++
+	f.LastError = err.Error()
+	f.LastTime = time.Now()
+	s.persist()
+	return *f
+}
+
+// Forget clears the failures of key, it returns false if key has no failure
+func (s *RetryState) Forget(key string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.Failures[key]; !ok {
+		return false
+	}
+	delete(s.Failures, key)
+	s.persist()
+	return true
+}
+
+// persist writes state to a temporary file and renames it atomically
+func (s *RetryState) persist() {
+	if s.path == "" {
+		return
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		log.Error("Marshal retry state error", log.Fields{"err": err})
+		return
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path))
+	if err != nil {
+		log.Error("Create retry state file error", log.Fields{"err": err})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		log.Error("Write retry state error", log.Fields{"err": err})
+		return
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		log.Error("Rename retry state file error", log.Fields{"err": err})
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	stringsutil "github.com/caicloud/loadbalancer-controller/pkg/util/strings"
+)
+
+// ActiveProxyColor returns the color of proxy serving traffic of lb, it is
+// always blue without blue/green deployment
+func ActiveProxyColor(lb *netv1alpha1.LoadBalancer) netv1alpha1.ProxyColor {
+	if lb.Spec.Proxy.BlueGreen == nil || lb.Spec.Proxy.BlueGreen.Active == "" {
+		return netv1alpha1.ProxyColorBlue
+	}
+	return lb.Spec.Proxy.BlueGreen.Active
+}
+
+// ProxyNodeNames returns the active nodes of lb running the proxy of color,
+// all of them run the blue proxy without blue/green deployment
+func ProxyNodeNames(lb *netv1alpha1.LoadBalancer, color netv1alpha1.ProxyColor) []string {
+	names := ActiveNodeNames(lb)
+	if lb.Spec.Proxy.BlueGreen == nil {
+		if color == netv1alpha1.ProxyColorGreen {
+			return nil
+		}
+		return names
+	}
+
+	green := lb.Spec.Proxy.BlueGreen.Green.Nodes
+	picked := make([]string, 0, len(names))
+	for _, name := range names {
+		if stringsutil.StringInSlice(name, green) == (color == netv1alpha1.ProxyColorGreen) {
+			picked = append(picked, name)
+		}
+	}
+	return picked
+}
+
+// ServingNodeNames returns the active nodes of lb running the proxy serving
+// traffic, the other nodes are drained by providers
+func ServingNodeNames(lb *netv1alpha1.LoadBalancer) []string {
+	return ProxyNodeNames(lb, ActiveProxyColor(lb))
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	"fmt"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	netclient "github.com/caicloud/loadbalancer-controller/pkg/tprclient/networking/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// abnormalConditions contains the conditions which are healthy when they are false
+var abnormalConditions = map[netv1alpha1.LoadBalancerConditionType]bool{
+	netv1alpha1.LoadBalancerVIPConflict:          true,
+	netv1alpha1.LoadBalancerMissingReference:     true,
+	netv1alpha1.LoadBalancerImageUnavailable:     true,
+	netv1alpha1.LoadBalancerIngressClassConflict: true,
+	netv1alpha1.LoadBalancerQuotaExceeded:        true,
+	netv1alpha1.LoadBalancerDataplaneUnsupported: true,
+}
+
+// NewCondition creates a new loadbalancer condition
+func NewCondition(condType netv1alpha1.LoadBalancerConditionType, status v1.ConditionStatus, reason, message string) netv1alpha1.LoadBalancerCondition {
+	return netv1alpha1.LoadBalancerCondition{
+		Type:               condType,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+}
+
+// GetCondition returns the condition with the provided type
+func GetCondition(status netv1alpha1.LoadBalancerStatus, condType netv1alpha1.LoadBalancerConditionType) *netv1alpha1.LoadBalancerCondition {
+	for i := range status.Conditions {
+		c := status.Conditions[i]
+		if c.Type == condType {
+			return &c
+		}
+	}
+	return nil
+}
+
+// SetCondition updates the status to include the provided condition, and
+// the Ready condition is recomputed. It returns false if nothing changed
+func SetCondition(status *netv1alpha1.LoadBalancerStatus, condition netv1alpha1.LoadBalancerCondition) bool {
+	changed := setCondition(status, condition)
+	return setReadyCondition(status) || changed
+}
+
+// RemoveCondition removes the conditions with the provided types, and the
+// Ready condition is recomputed. It returns false if nothing changed
+func RemoveCondition(status *netv1alpha1.LoadBalancerStatus, condTypes ...netv1alpha1.LoadBalancerConditionType) bool {
+	changed := false
+	for _, condType := range condTypes {
+		if GetCondition(*status, condType) != nil {
+			status.Conditions = filterOutCondition(status.Conditions, condType)
+			changed = true
+		}
+	}
+	if !changed {
+		return false
+	}
+	setReadyCondition(status)
+	return true
+}
+
+// UpdateConditions sets the conditions of lb if any of them changed
+func UpdateConditions(lbClient netclient.LoadBalancerInterface, lb *netv1alpha1.LoadBalancer, conditions ...netv1alpha1.LoadBalancerCondition) error {
+	return WriteStatus(lbClient, lb, nil, conditions...)
+}
+
+// RemoveConditions removes the conditions of lb with the provided types
+func RemoveConditions(lbClient netclient.LoadBalancerInterface, lb *netv1alpha1.LoadBalancer, condTypes ...netv1alpha1.LoadBalancerConditionType) error {
+	// do not modify the status in cache
+	if !RemoveCondition(&netv1alpha1.LoadBalancerStatus{Conditions: lb.Status.Conditions}, condTypes...) {
+		return nil
+	}
+	_, err := UpdateLBWithRetries(lbClient, lb.Namespace, lb.Name, func(lb *netv1alpha1.LoadBalancer) error {
+		if !RemoveCondition(&lb.Status, condTypes...) {
+			return errors.ErrPreconditionViolated
+		}
+		return nil
+	})
+	return err
+}
+
+func setCondition(status *netv1alpha1.LoadBalancerStatus, condition netv1alpha1.LoadBalancerCondition) bool {
+	current := GetCondition(*status, condition.Type)
+	if current != nil && current.Status == condition.Status && current.Reason == condition.Reason && current.Message == condition.Message {
+		return false
+	}
+	// do not update lastTransitionTime if the status of the condition doesn't change
+	if current != nil && current.Status == condition.Status {
+		condition.LastTransitionTime = current.LastTransitionTime
+	}
+
+	status.Conditions = append(filterOutCondition(status.Conditions, condition.Type), condition)
+	return true
+}
+
+// setReadyCondition computes the Ready condition from the other conditions
+func setReadyCondition(status *netv1alpha1.LoadBalancerStatus) bool {
+	ready := NewCondition(netv1alpha1.LoadBalancerReady, v1.ConditionTrue, "Ready", "")
+	for _, c := range status.Conditions {
+		healthy := v1.ConditionTrue
+		if abnormalConditions[c.Type] {
+			healthy = v1.ConditionFalse
+		}
+		if c.Type == netv1alpha1.LoadBalancerReady || c.Status == healthy {
+			continue
+		}
+		ready = NewCondition(netv1alpha1.LoadBalancerReady, v1.ConditionFalse, string(c.Type), fmt.Sprintf("%s: %s", c.Reason, c.Message))
+		break
+	}
+	return setCondition(status, ready)
+}
+
+// filterOutCondition returns a new slice of conditions without conditions with the provided type
+func filterOutCondition(conditions []netv1alpha1.LoadBalancerCondition, condType netv1alpha1.LoadBalancerConditionType) []netv1alpha1.LoadBalancerCondition {
+	filtered := make([]netv1alpha1.LoadBalancerCondition, 0, len(conditions)+1)
+	for _, c := range conditions {
+		if c.Type != condType {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered
+}
@@ -23,8 +23,8 @@ import (
 
 	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
 	netlisters "github.com/caicloud/loadbalancer-controller/pkg/listers/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
 	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
-	log "github.com/zoumo/logdog"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -38,12 +38,14 @@ import (
 
 var _ cache.ResourceEventHandler = &EventHandlerForDeployment{}
 var _ cache.ResourceEventHandler = &EventHandlerForSyncStatusWithPod{}
+var _ cache.ResourceEventHandler = &EventHandlerForDaemonSet{}
 
 // controllerKind contains the schema.GroupVersionKind for this controller type.
 var controllerKind = netv1alpha1.SchemeGroupVersion.WithKind(netv1alpha1.LoadBalancerKind)
 
 type filterDeploymentFunc func(obj *extensions.Deployment) bool
 type filterPodFunc func(obj *v1.Pod) bool
+type filterDaemonSetFunc func(obj *extensions.DaemonSet) bool
 
 // EventHandlerForDeployment helps you create a event handler to handle with
 // deployments event quickly, makes you focus on you own code
@@ -223,12 +225,16 @@ func (eh *EventHandlerForDeployment) OnDelete(obj interface{}) {
 // or nil if the ControllerRef could not be resolved to a matching controller
 // of the corrrect Kind.
 func (eh *EventHandlerForDeployment) resolveControllerRef(namespace string, controllerRef *metav1.OwnerReference) *netv1alpha1.LoadBalancer {
+	return resolveControllerRef(eh.lbLister, namespace, controllerRef)
+}
+
+func resolveControllerRef(lbLister netlisters.LoadBalancerLister, namespace string, controllerRef *metav1.OwnerReference) *netv1alpha1.LoadBalancer {
 	// We can't look up by UID, so look up by Name and then verify UID.
 	// Don't even try to look up by Name if it's the wrong Kind.
 	if controllerRef.Kind != controllerKind.Kind {
 		return nil
 	}
-	lb, err := eh.lbLister.LoadBalancers(namespace).Get(controllerRef.Name)
+	lb, err := lbLister.LoadBalancers(namespace).Get(controllerRef.Name)
 	if err != nil {
 		return nil
 	}
@@ -397,3 +403,107 @@ func (eh *EventHandlerForSyncStatusWithPod) getLoadbalancerForPod(pod *v1.Pod) *
 	}
 	return lb
 }
+
+// EventHandlerForDaemonSet helps you create a event handler to handle with
+// daemonsets event quickly, it enqueues the loadbalancer controlling the
+// daemonset, or all the matching loadbalancers for an orphan
+type EventHandlerForDaemonSet struct {
+	helper *controllerutil.Helper
+
+	lbLister netlisters.LoadBalancerLister
+
+	filtered filterDaemonSetFunc
+}
+
+// NewEventHandlerForDaemonSet ...
+func NewEventHandlerForDaemonSet(
+	lbLister netlisters.LoadBalancerLister,
+	helper *controllerutil.Helper,
+	filterFunc filterDaemonSetFunc,
+) *EventHandlerForDaemonSet {
+	return &EventHandlerForDaemonSet{
+		helper:   helper,
+		lbLister: lbLister,
+		filtered: filterFunc,
+	}
+}
+
+// OnAdd ...
+func (eh *EventHandlerForDaemonSet) OnAdd(obj interface{}) {
+	ds := obj.(*extensions.DaemonSet)
+	if eh.filtered(ds) {
+		return
+	}
+	log.Info("DaemonSet added", log.Fields{"ds.name": ds.Name, "ns": ds.Namespace})
+	eh.enqueue(ds)
+}
+
+// OnUpdate ...
+func (eh *EventHandlerForDaemonSet) OnUpdate(oldObj, curObj interface{}) {
+	old := oldObj.(*extensions.DaemonSet)
+	cur := curObj.(*extensions.DaemonSet)
+
+	if old.ResourceVersion == cur.ResourceVersion {
+		// Periodic resync will send update events for all known DaemonSet.
+		return
+	}
+
+	if !eh.filtered(old) && !reflect.DeepEqual(controller.GetControllerOf(old), controller.GetControllerOf(cur)) {
+		// The ControllerRef was changed. Sync the old controller, if any.
+		eh.enqueue(old)
+	}
+	if !eh.filtered(cur) {
+		eh.enqueue(cur)
+	}
+}
+
+// OnDelete ...
+func (eh *EventHandlerForDaemonSet) OnDelete(obj interface{}) {
+	ds, ok := obj.(*extensions.DaemonSet)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("Couldn't get object from tombstone %#v", obj))
+			return
+		}
+		ds, ok = tombstone.Obj.(*extensions.DaemonSet)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("Tombstone contained object that is not a DaemonSet %#v", obj))
+			return
+		}
+	}
+
+	if eh.filtered(ds) {
+		return
+	}
+
+	// No controller should care about orphans being deleted.
+	controllerRef := controller.GetControllerOf(ds)
+	if controllerRef == nil {
+		return
+	}
+	if lb := resolveControllerRef(eh.lbLister, ds.Namespace, controllerRef); lb != nil {
+		log.Info("DaemonSet deleted", log.Fields{"ds.name": ds.Name, "lb.name": lb.Name})
+		eh.helper.Enqueue(lb)
+	}
+}
+
+// enqueue enqueues the controller of daemonset, or all matching
+// loadbalancers to see if anyone wants to adopt the orphan
+func (eh *EventHandlerForDaemonSet) enqueue(ds *extensions.DaemonSet) {
+	if controllerRef := controller.GetControllerOf(ds); controllerRef != nil {
+		if lb := resolveControllerRef(eh.lbLister, ds.Namespace, controllerRef); lb != nil {
+			eh.helper.Enqueue(lb)
+		}
+		return
+	}
+
+	lbs, err := eh.lbLister.GetLoadBalancersForControllee(ds)
+	if err != nil {
+		log.Debug("Can not get loadbalancer for orphan DaemonSet, ignore it", log.Fields{"ds.name": ds.Name, "ns": ds.Namespace, "labels": ds.Labels})
+		return
+	}
+	for _, lb := range lbs {
+		eh.helper.Enqueue(lb)
+	}
+}
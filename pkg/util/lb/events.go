@@ -0,0 +1,77 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+// Reasons of events recorded on LoadBalancer by controller and plugins
+const (
+	// EventReasonDefaulted is used when the defaults of spec are written back
+	EventReasonDefaulted = "Defaulted"
+	// EventReasonCreated is used when a resource is created for loadbalancer
+	EventReasonCreated = "Created"
+	// EventReasonUpdated is used when a resource of loadbalancer is updated
+	EventReasonUpdated = "Updated"
+	// EventReasonScaled is used when a deployment of loadbalancer is scaled
+	EventReasonScaled = "Scaled"
+	// EventReasonCleanedUp is used when resources of loadbalancer are deleted
+	EventReasonCleanedUp = "CleanedUp"
+	// EventReasonSyncFailed is used when syncing loadbalancer failed
+	EventReasonSyncFailed = "SyncFailed"
+	// EventReasonNodesChanged is used when the nodes picked or the unready nodes changed
+	EventReasonNodesChanged = "NodesChanged"
+	// EventReasonNodeAddressChanged is used when the address of node changed
+	EventReasonNodeAddressChanged = "NodeAddressChanged"
+	// EventReasonVRIDAllocationFailed is used when no VRID is available for ipvsdr provider
+	EventReasonVRIDAllocationFailed = "VRIDAllocationFailed"
+	// EventReasonVipAllocated is used when a vip is allocated from pools
+	EventReasonVipAllocated = "VipAllocated"
+	// EventReasonVipAllocationFailed is used when no vip is available in pools
+	EventReasonVipAllocationFailed = "VipAllocationFailed"
+	// EventReasonVipConflict is used when the vip is already in use on the network
+	EventReasonVipConflict = "VipConflict"
+	// EventReasonPortConflict is used when the forwarded ports overlap with another loadbalancer on the same nodes
+	EventReasonPortConflict = "PortConflict"
+	// EventReasonIngressClassConflict is used when the ingress class is used by another loadbalancer
+	EventReasonIngressClassConflict = "IngressClassConflict"
+	// EventReasonQuotaExceeded is used when the loadbalancer exceeds the quota of its namespace or cluster
+	EventReasonQuotaExceeded = "QuotaExceeded"
+	// EventReasonFailover is used when the VRRP master of ipvsdr provider moves to another node
+	EventReasonFailover = "Failover"
+	// EventReasonNodeFailover is used when provider pods are moved off a node which is not ready
+	EventReasonNodeFailover = "NodeFailover"
+	// EventReasonMissingReference is used when a resource referenced by spec does not exist
+	EventReasonMissingReference = "MissingReference"
+	// EventReasonCanaryPaused is used when a canary workload does not become available in time
+	EventReasonCanaryPaused = "CanaryPaused"
+	// EventReasonPaused is used when the reconciliation of loadbalancer is paused
+	EventReasonPaused = "Paused"
+	// EventReasonResumed is used when the reconciliation of loadbalancer is resumed
+	EventReasonResumed = "Resumed"
+	// EventReasonImagePinned is used when the images of loadbalancer are pinned or unpinned
+	EventReasonImagePinned = "ImagePinned"
+	// EventReasonClaimed is used when a controller claims the ownership of loadbalancer
+	EventReasonClaimed = "Claimed"
+	// EventReasonHandedOff is used when the ownership of loadbalancer is handed off to another controller
+	EventReasonHandedOff = "HandedOff"
+	// EventReasonSyncDegraded is used when the retries of loadbalancer are slowed down after repeated sync failures
+	EventReasonSyncDegraded = "SyncDegraded"
+	// EventReasonDryRun is used when the changes planned in dry run mode are recorded instead of made
+	EventReasonDryRun = "DryRun"
+	// EventReasonRolledBack is used when the spec of loadbalancer is rolled back to a revision
+	EventReasonRolledBack = "RolledBack"
+	// EventReasonRollbackFailed is used when the revision to roll back to is invalid or missing
+	EventReasonRollbackFailed = "RollbackFailed"
+)
@@ -0,0 +1,97 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	"reflect"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	"github.com/caicloud/loadbalancer-controller/pkg/tprclient"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// NewSyncFailureHandler returns a handler surfacing the sync failures of
+// loadbalancers by component in status, and recording a Warning event when
+// the retries are slowed down. The handler is used by the helpers of
+// controller and plugins whose key is the loadbalancer itself
+func NewSyncFailureHandler(component string, client tprclient.Interface, recorder record.EventRecorder) controllerutil.SyncFailureHandler {
+	return func(obj interface{}, failure *controllerutil.Failure, degraded bool) {
+		lb, ok := obj.(*netv1alpha1.LoadBalancer)
+		if !ok {
+			return
+		}
+
+		if degraded {
+			recorder.Eventf(lb, v1.EventTypeWarning, EventReasonSyncDegraded, "Sync of %s failed %d times in a row, retry slowly: %s",
+				component, failure.Count, failure.LastError)
+		}
+
+		if IsDryRun(lb) {
+			// nothing is written in dry run mode
+			return
+		}
+		err := WriteStatus(client.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, func(status *netv1alpha1.LoadBalancerStatus) bool {
+			return setSyncFailure(status, component, failure)
+		})
+		if err != nil {
+			log.Warn("Update sync failures of loadbalancer error", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "component": component, "err": err})
+		}
+	}
+}
+
+// setSyncFailure sets the failure of component in status, it is removed if
+// failure is nil. It returns false if nothing changed
+func setSyncFailure(status *netv1alpha1.LoadBalancerStatus, component string, failure *controllerutil.Failure) bool {
+	failures := make([]netv1alpha1.SyncFailure, 0, len(status.SyncFailures)+1)
+	found := false
+	for _, f := range status.SyncFailures {
+		if f.Component != component {
+			failures = append(failures, f)
+			continue
+		}
+		found = true
+		if failure != nil {
+			failures = append(failures, newSyncFailure(component, failure))
+		}
+	}
+	if !found && failure != nil {
+		failures = append(failures, newSyncFailure(component, failure))
+	}
+	if len(failures) == 0 {
+		failures = nil
+	}
+	if reflect.DeepEqual(failures, status.SyncFailures) {
+		return false
+	}
+	status.SyncFailures = failures
+	return true
+}
+
+func newSyncFailure(component string, failure *controllerutil.Failure) netv1alpha1.SyncFailure {
+	return netv1alpha1.SyncFailure{
+		Component:       component,
+		Count:           failure.Count,
+		LastError:       failure.LastError,
+		LastFailureTime: metav1.NewTime(failure.LastTime),
+		SlowRetry:       failure.Count >= controllerutil.DefaultSlowRetry.Threshold,
+	}
+}
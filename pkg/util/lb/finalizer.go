@@ -0,0 +1,75 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	netclient "github.com/caicloud/loadbalancer-controller/pkg/tprclient/networking/v1alpha1"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/errors"
+)
+
+// HasFinalizer checks whether the finalizer is in the finalizers of lb
+func HasFinalizer(lb *netv1alpha1.LoadBalancer, finalizer string) bool {
+	for _, f := range lb.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// AddFinalizer adds the finalizer to lb if it does not exist
+func AddFinalizer(lbClient netclient.LoadBalancerInterface, lb *netv1alpha1.LoadBalancer, finalizer string) error {
+	if HasFinalizer(lb, finalizer) {
+		return nil
+	}
+	_, err := UpdateLBWithRetries(lbClient, lb.Namespace, lb.Name, func(lb *netv1alpha1.LoadBalancer) error {
+		if HasFinalizer(lb, finalizer) {
+			return errors.ErrPreconditionViolated
+		}
+		lb.Finalizers = append(lb.Finalizers, finalizer)
+		return nil
+	})
+	return err
+}
+
+// RemoveFinalizer removes the finalizer from lb if it exists
+func RemoveFinalizer(lbClient netclient.LoadBalancerInterface, lb *netv1alpha1.LoadBalancer, finalizer string) error {
+	if !HasFinalizer(lb, finalizer) {
+		return nil
+	}
+	_, err := UpdateLBWithRetries(lbClient, lb.Namespace, lb.Name, func(lb *netv1alpha1.LoadBalancer) error {
+		if !HasFinalizer(lb, finalizer) {
+			return errors.ErrPreconditionViolated
+		}
+		finalizers := make([]string, 0, len(lb.Finalizers))
+		for _, f := range lb.Finalizers {
+			if f != finalizer {
+				finalizers = append(finalizers, f)
+			}
+		}
+		lb.Finalizers = finalizers
+		return nil
+	})
+	if apierrors.IsNotFound(err) {
+		// loadbalancer has gone
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	"fmt"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// imagePullFailureReasons are the waiting reasons of containers whose image
+// can not be pulled, e.g. it is missing or the registry is unauthorized
+var imagePullFailureReasons = map[string]bool{
+	"ErrImagePull":        true,
+	"ImagePullBackOff":    true,
+	"InvalidImageName":    true,
+	"ErrImageNeverPull":   true,
+	"RegistryUnavailable": true,
+}
+
+// ImagePullFailure returns the image and registry error of the first init
+// container or container of pod waiting for its image
+func ImagePullFailure(pod *v1.Pod) (string, string, bool) {
+	statuses := append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		waiting := status.State.Waiting
+		if waiting != nil && imagePullFailureReasons[waiting.Reason] {
+			return status.Image, waiting.Message, true
+		}
+	}
+	return "", "", false
+}
+
+// ComputeImageCondition returns ImageUnavailable condition which is true when
+// images of all the pods can not be pulled, that is usually caused by a
+// misconfigured image or registry rather than a broken node
+func ComputeImageCondition(pods []*v1.Pod) netv1alpha1.LoadBalancerCondition {
+	var image, message string
+	failed := 0
+	for _, pod := range pods {
+		if i, m, ok := ImagePullFailure(pod); ok {
+			image, message = i, m
+			failed++
+		}
+	}
+
+	if len(pods) == 0 || failed < len(pods) {
+		return NewCondition(netv1alpha1.LoadBalancerImageUnavailable, v1.ConditionFalse, "Pulled", "")
+	}
+	return NewCondition(netv1alpha1.LoadBalancerImageUnavailable, v1.ConditionTrue, "PullFailed",
+		fmt.Sprintf("image %s of all %d pods can not be pulled: %s", image, failed, message))
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+)
+
+// ArtifactLabels returns the versioned labels of objects generated by component
+// for lb, e.g. proxy-nginx or provider-ipvsdr
+func ArtifactLabels(lb *netv1alpha1.LoadBalancer, component string) map[string]string {
+	return artifactLabels(lb.Name, component)
+}
+
+func artifactLabels(name, component string) map[string]string {
+	return map[string]string{
+		netv1alpha1.LabelKeyAppName:      netv1alpha1.LabelValueAppName,
+		netv1alpha1.LabelKeyAppInstance:  name,
+		netv1alpha1.LabelKeyAppComponent: component,
+		netv1alpha1.LabelKeyAppManagedBy: netv1alpha1.LabelValueManagedBy,
+		netv1alpha1.LabelKeyVersion:      netv1alpha1.LabelVersion,
+	}
+}
+
+// WithArtifactLabels returns a copy of selector with the versioned labels of
+// component added, the selector itself is kept for selecting the objects
+func WithArtifactLabels(selector map[string]string, lb *netv1alpha1.LoadBalancer, component string) map[string]string {
+	ret := make(map[string]string, len(selector)+5)
+	for k, v := range selector {
+		ret[k] = v
+	}
+	for k, v := range ArtifactLabels(lb, component) {
+		ret[k] = v
+	}
+	return ret
+}
+
+// MissingArtifactLabels returns the versioned labels to be added to an object
+// generated before the labeling scheme is bumped, it is derived from the
+// created-by and proxy or provider labels. Nil is returned if the object is
+// up to date or not generated for a loadbalancer
+func MissingArtifactLabels(labels map[string]string) map[string]string {
+	if labels[netv1alpha1.LabelKeyVersion] == netv1alpha1.LabelVersion {
+		return nil
+	}
+	// namespace can not contain dot
+	parts := strings.SplitN(labels[netv1alpha1.LabelKeyCreatedBy], ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil
+	}
+
+	var component string
+	if proxy, ok := labels[netv1alpha1.LabelKeyProxy]; ok {
+		component = "proxy-" + proxy
+	} else if provider, ok := labels[netv1alpha1.LabelKeyProvider]; ok {
+		component = "provider-" + provider
+	} else {
+		return nil
+	}
+
+	missing := make(map[string]string)
+	for k, v := range artifactLabels(parts[1], component) {
+		if labels[k] != v {
+			missing[k] = v
+		}
+	}
+	return missing
+}
@@ -18,13 +18,13 @@ package lb
 
 import (
 	"fmt"
-	"math/rand"
+	"hash/fnv"
 	"reflect"
 	"strings"
-	"time"
 
 	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
 	netclient "github.com/caicloud/loadbalancer-controller/pkg/tprclient/networking/v1alpha1"
+	stringsutil "github.com/caicloud/loadbalancer-controller/pkg/util/strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/errors"
@@ -129,16 +129,99 @@ func CalculateReplicas(lb *netv1alpha1.LoadBalancer) (int32, bool) {
 	if lb.Spec.Type == netv1alpha1.LoadBalancerTypeInternal && lb.Spec.Nodes.Replicas != nil {
 		replicas = *lb.Spec.Nodes.Replicas
 	}
+	if autoscaled, ok := AutoscaledReplicas(lb); ok {
+		replicas = autoscaled
+	}
 
-	if len(lb.Spec.Nodes.Names) != 0 {
+	if len(NodeNames(lb)) != 0 {
 		// use nodes length override replicas
-		replicas = int32(len(lb.Spec.Nodes.Names))
+		replicas = int32(len(ActiveNodeNames(lb)))
 		needNodeAffinity = true
 	}
 
 	return replicas, needNodeAffinity
 }
 
+// ActiveNodeNames returns the names of nodes which proxies and providers run on.
+// The nodes in Names are surged with a standby node for each of them under maintenance,
+// and then picked in order up to the replicas desired by autoscaling
+func ActiveNodeNames(lb *netv1alpha1.LoadBalancer) []string {
+	return autoscaledNodeNames(lb, surgedNodeNames(lb))
+}
+
+// AutoscaledReplicas returns the replicas desired by autoscaling, it returns
+// false if autoscaling is disabled or has not observed any metric yet
+func AutoscaledReplicas(lb *netv1alpha1.LoadBalancer) (int32, bool) {
+	if lb.Spec.Autoscaling == nil || lb.Status.Autoscaling == nil {
+		return 0, false
+	}
+	return lb.Status.Autoscaling.DesiredReplicas, true
+}
+
+// autoscaledNodeNames picks nodes in order up to the replicas desired by
+// autoscaling, the nodes under maintenance are picked last
+func autoscaledNodeNames(lb *netv1alpha1.LoadBalancer, names []string) []string {
+	desired, ok := AutoscaledReplicas(lb)
+	if !ok || int(desired) >= len(names) {
+		return names
+	}
+
+	picked := make([]string, 0, desired)
+	for _, name := range names {
+		if int32(len(picked)) < desired && !stringsutil.StringInSlice(name, lb.Spec.Nodes.Maintenance) {
+			picked = append(picked, name)
+		}
+	}
+	for _, name := range names {
+		if int32(len(picked)) < desired && stringsutil.StringInSlice(name, lb.Spec.Nodes.Maintenance) {
+			picked = append(picked, name)
+		}
+	}
+	return picked
+}
+
+// NodeNames returns the names of nodes in spec, or the nodes picked by selector
+func NodeNames(lb *netv1alpha1.LoadBalancer) []string {
+	if len(lb.Spec.Nodes.Names) == 0 && len(lb.Spec.Nodes.Selector) != 0 {
+		return lb.Status.Nodes.Selected
+	}
+	return lb.Spec.Nodes.Names
+}
+
+// surgedNodeNames surges a standby node for each node under maintenance,
+// and replaces the unready nodes with standby nodes
+func surgedNodeNames(lb *netv1alpha1.LoadBalancer) []string {
+	names := NodeNames(lb)
+	unready := lb.Status.Nodes.Unready
+	surge := 0
+	for _, name := range names {
+		if stringsutil.StringInSlice(name, unready) || stringsutil.StringInSlice(name, lb.Spec.Nodes.Maintenance) {
+			surge++
+		}
+	}
+	if surge == 0 {
+		return names
+	}
+
+	active := make([]string, 0, len(names)+surge)
+	for _, name := range names {
+		if !stringsutil.StringInSlice(name, unready) {
+			active = append(active, name)
+		}
+	}
+	for _, name := range lb.Spec.Nodes.Standby {
+		if surge == 0 {
+			break
+		}
+		if stringsutil.StringInSlice(name, active) || stringsutil.StringInSlice(name, unready) {
+			continue
+		}
+		active = append(active, name)
+		surge--
+	}
+	return active
+}
+
 // DeploymentDeepCopy returns a deepcopy for given deployment
 func DeploymentDeepCopy(deployment *extensions.Deployment) (*extensions.Deployment, error) {
 	objCopy, err := scheme.Scheme.DeepCopy(deployment)
@@ -152,16 +235,156 @@ func DeploymentDeepCopy(deployment *extensions.Deployment) (*extensions.Deployme
 	return copied, nil
 }
 
-// RandStringBytesRmndr returns a randome string.
-func RandStringBytesRmndr(n int) string {
-	rand.Seed(int64(time.Now().Nanosecond()))
-	var letterBytes = "abcdefghijklmnopqrstuvwxyz1234567890"
-	b := make([]byte, n)
-	b[0] = letterBytes[rand.Int63()%26]
-	for i := 1; i < n; i++ {
-		b[i] = letterBytes[rand.Int63()%int64(len(letterBytes))]
+// DaemonSetDeepCopy returns a deepcopy for given daemonset
+func DaemonSetDeepCopy(ds *extensions.DaemonSet) (*extensions.DaemonSet, error) {
+	objCopy, err := scheme.Scheme.DeepCopy(ds)
+	if err != nil {
+		return nil, err
+	}
+	copied, ok := objCopy.(*extensions.DaemonSet)
+	if !ok {
+		return nil, fmt.Errorf("expected DaemonSet, got %#v", objCopy)
+	}
+	return copied, nil
+}
+
+// IsDaemonSetMode returns true if pods of lb run in daemonsets
+func IsDaemonSetMode(lb *netv1alpha1.LoadBalancer) bool {
+	return lb.Spec.DeployMode == netv1alpha1.DeployModeDaemonSet
+}
+
+// controllerID is the identity of this controller in AnnotationKeyController
+var controllerID string
+
+// SetControllerID sets the identity of this controller, it is called once at startup
+func SetControllerID(id string) {
+	controllerID = id
+}
+
+// ControllerID returns the identity of this controller
+func ControllerID() string {
+	return controllerID
+}
+
+// IsOwned returns true if lb is reconciled by this controller. The loadbalancers
+// without owner are reconciled by the controller without identity, the ones
+// owned by other controllers are never reconciled
+func IsOwned(lb *netv1alpha1.LoadBalancer) bool {
+	return lb.Annotations[netv1alpha1.AnnotationKeyController] == controllerID
+}
+
+// IngressClass returns the ingress class served by the proxy of lb
+func IngressClass(lb *netv1alpha1.LoadBalancer) string {
+	if lb.Spec.Proxy.IngressClass != "" {
+		return lb.Spec.Proxy.IngressClass
+	}
+	return fmt.Sprintf(netv1alpha1.LabelValueFormatCreateby, lb.Namespace, lb.Name)
+}
+
+// IsPaused returns true if the reconciliation of lb is paused
+func IsPaused(lb *netv1alpha1.LoadBalancer) bool {
+	return lb.Annotations[netv1alpha1.AnnotationKeyPaused] == "true"
+}
+
+// dryRun syncs all loadbalancers in dry run mode, it is set once at startup
+var dryRun bool
+
+// SetDryRun turns on or off the dry run mode of all loadbalancers
+func SetDryRun(on bool) {
+	dryRun = on
+}
+
+// DryRun returns true if the controller runs in dry run mode, the writers
+// not bound to a loadbalancer log the planned changes instead of making them
+func DryRun() bool {
+	return dryRun
+}
+
+// IsDryRun returns true if lb is synced in dry run mode, either by the
+// controller flag or by the annotation of lb
+func IsDryRun(lb *netv1alpha1.LoadBalancer) bool {
+	return dryRun || lb.Annotations[netv1alpha1.AnnotationKeyDryRun] == "true"
+}
+
+// IsQuotaExceeded returns true if lb exceeds the quota of its namespace or
+// cluster, it is not reconciled until the quota is available
+func IsQuotaExceeded(lb *netv1alpha1.LoadBalancer) bool {
+	c := GetCondition(lb.Status, netv1alpha1.LoadBalancerQuotaExceeded)
+	return c != nil && c.Status == v1.ConditionTrue
+}
+
+// ProxyHostNetwork returns true if proxy pods of lb run in host network
+func ProxyHostNetwork(lb *netv1alpha1.LoadBalancer) bool {
+	if lb.Spec.Proxy.NetworkMode == "" {
+		return lb.Spec.Type == netv1alpha1.LoadBalancerTypeExternal
+	}
+	return lb.Spec.Proxy.NetworkMode == netv1alpha1.NetworkModeHost
+}
+
+// ServiceDeepCopy returns a deepcopy for given service
+func ServiceDeepCopy(service *v1.Service) (*v1.Service, error) {
+	objCopy, err := scheme.Scheme.DeepCopy(service)
+	if err != nil {
+		return nil, err
+	}
+	copied, ok := objCopy.(*v1.Service)
+	if !ok {
+		return nil, fmt.Errorf("expected Service, got %#v", objCopy)
+	}
+	return copied, nil
+}
+
+// EndpointsDeepCopy returns a deepcopy for given endpoints
+func EndpointsDeepCopy(ep *v1.Endpoints) (*v1.Endpoints, error) {
+	objCopy, err := scheme.Scheme.DeepCopy(ep)
+	if err != nil {
+		return nil, err
+	}
+	copied, ok := objCopy.(*v1.Endpoints)
+	if !ok {
+		return nil, fmt.Errorf("expected Endpoints, got %#v", objCopy)
+	}
+	return copied, nil
+}
+
+// WorkloadName returns the name of workload of the plugin component for lb,
+// e.g. proxy-nginx. The suffix is a hash of the uid of lb and the component,
+// so the name is stable across syncs and controllers but differs between lbs
+// recreated with the same name
+func WorkloadName(lb *netv1alpha1.LoadBalancer, component string) string {
+	hasher := fnv.New32a()
+	hasher.Write([]byte(string(lb.UID) + "/" + component))
+	hash := hasher.Sum32()
+
+	const letterBytes = "abcdefghijklmnopqrstuvwxyz1234567890"
+	b := make([]byte, 5)
+	b[0] = letterBytes[hash%26]
+	hash /= 26
+	for i := 1; i < len(b); i++ {
+		b[i] = letterBytes[hash%uint32(len(letterBytes))]
+		hash /= uint32(len(letterBytes))
+	}
+	return lb.Name + "-" + component + "-" + string(b)
+}
+
+// GetNodeInternalIP returns the InternalIP of node, or empty string if not found
+func GetNodeInternalIP(node *v1.Node) string {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == v1.NodeInternalIP {
+			return addr.Address
+		}
+	}
+	return ""
+}
+
+// IsNodeReady returns true if the Ready condition of node is true
+func IsNodeReady(node *v1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1.NodeReady {
+			return c.Status == v1.ConditionTrue
+		}
 	}
-	return string(b)
+	return false
 }
 
 // ComputePodStatus computes the pod's current status
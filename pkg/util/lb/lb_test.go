@@ -17,9 +17,13 @@ limitations under the License.
 package lb
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
 
 	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+	"k8s.io/client-go/pkg/api/v1"
 )
 
 func TestProxyStatusEqual(t *testing.T) {
@@ -110,3 +114,295 @@ func TestPodStatusesEqual(t *testing.T) {
 		}
 	}
 }
+
+func TestActiveNodeNames(t *testing.T) {
+
+	tests := []struct {
+		nodes netv1alpha1.NodesSpec
+		want  []string
+	}{
+		{
+			netv1alpha1.NodesSpec{
+				Names:   []string{"n1", "n2"},
+				Standby: []string{"s1"},
+			},
+			[]string{"n1", "n2"},
+		},
+		{
+			netv1alpha1.NodesSpec{
+				Names:       []string{"n1", "n2"},
+				Standby:     []string{"s1", "s2"},
+				Maintenance: []string{"n2"},
+			},
+			[]string{"n1", "n2", "s1"},
+		},
+		{
+			netv1alpha1.NodesSpec{
+				Names:       []string{"n1", "n2"},
+				Standby:     []string{"s1"},
+				Maintenance: []string{"n1", "n2"},
+			},
+			[]string{"n1", "n2", "s1"},
+		},
+		{
+			netv1alpha1.NodesSpec{
+				Names:       []string{"n1"},
+				Standby:     []string{"s1"},
+				Maintenance: []string{"n3"},
+			},
+			[]string{"n1"},
+		},
+	}
+	for _, tt := range tests {
+		lb := &netv1alpha1.LoadBalancer{
+			Spec: netv1alpha1.LoadBalancerSpec{
+				Nodes: tt.nodes,
+			},
+		}
+		if got := ActiveNodeNames(lb); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ActiveNodeNames() = %v, want %v, nodes: %v", got, tt.want, tt.nodes)
+		}
+	}
+}
+
+func TestActiveNodeNamesAutoscaled(t *testing.T) {
+
+	tests := []struct {
+		nodes   netv1alpha1.NodesSpec
+		desired int32
+		want    []string
+	}{
+		{
+			netv1alpha1.NodesSpec{
+				Names: []string{"n1", "n2", "n3"},
+			},
+			2,
+			[]string{"n1", "n2"},
+		},
+		{
+			netv1alpha1.NodesSpec{
+				Names:       []string{"n1", "n2", "n3"},
+				Maintenance: []string{"n1"},
+			},
+			2,
+			[]string{"n2", "n3"},
+		},
+		{
+			netv1alpha1.NodesSpec{
+				Names: []string{"n1", "n2"},
+			},
+			3,
+			[]string{"n1", "n2"},
+		},
+	}
+	for _, tt := range tests {
+		lb := &netv1alpha1.LoadBalancer{
+			Spec: netv1alpha1.LoadBalancerSpec{
+				Nodes:       tt.nodes,
+				Autoscaling: &netv1alpha1.AutoscalingSpec{},
+			},
+			Status: netv1alpha1.LoadBalancerStatus{
+				Autoscaling: &netv1alpha1.AutoscalingStatus{
+					DesiredReplicas: tt.desired,
+				},
+			},
+		}
+		if got := ActiveNodeNames(lb); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ActiveNodeNames() = %v, want %v, nodes: %v, desired: %v", got, tt.want, tt.nodes, tt.desired)
+		}
+	}
+}
+
+func TestMergeAffinity(t *testing.T) {
+	lbNode := v1.NodeSelectorRequirement{Key: "lb", Operator: v1.NodeSelectorOpIn, Values: []string{"true"}}
+	zoneA := v1.NodeSelectorRequirement{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"a"}}
+	zoneB := v1.NodeSelectorRequirement{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"b"}}
+
+	lb := &netv1alpha1.LoadBalancer{
+		Spec: netv1alpha1.LoadBalancerSpec{
+			Template: &netv1alpha1.TemplateSpec{
+				Affinity: &v1.Affinity{
+					NodeAffinity: &v1.NodeAffinity{
+						RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+							NodeSelectorTerms: []v1.NodeSelectorTerm{
+								{MatchExpressions: []v1.NodeSelectorRequirement{zoneA}},
+								{MatchExpressions: []v1.NodeSelectorRequirement{zoneB}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	generated := &v1.Affinity{
+		NodeAffinity: &v1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+				NodeSelectorTerms: []v1.NodeSelectorTerm{
+					{MatchExpressions: []v1.NodeSelectorRequirement{lbNode}},
+				},
+			},
+		},
+	}
+
+	want := []v1.NodeSelectorTerm{
+		{MatchExpressions: []v1.NodeSelectorRequirement{lbNode, zoneA}},
+		{MatchExpressions: []v1.NodeSelectorRequirement{lbNode, zoneB}},
+	}
+	got := MergeAffinity(lb, generated).NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeAffinity() = %v, want %v", got, want)
+	}
+}
+
+func TestSetSyncFailure(t *testing.T) {
+	proxyFailure := netv1alpha1.SyncFailure{Component: "proxy-nginx", Count: 1, LastError: "proxy"}
+	failure := &controllerutil.Failure{Count: 2, LastError: "provider"}
+
+	tests := []struct {
+		name     string
+		failures []netv1alpha1.SyncFailure
+		failure  *controllerutil.Failure
+		changed  bool
+		want     []string
+	}{
+		{
+			name:    "add",
+			failure: failure,
+			changed: true,
+			want:    []string{"provider-ipvsdr"},
+		},
+		{
+			name:     "keep others in order",
+			failures: []netv1alpha1.SyncFailure{{Component: "provider-ipvsdr", Count: 1}, proxyFailure},
+			failure:  failure,
+			changed:  true,
+			want:     []string{"provider-ipvsdr", "proxy-nginx"},
+		},
+		{
+			name:     "remove on success",
+			failures: []netv1alpha1.SyncFailure{{Component: "provider-ipvsdr", Count: 1}, proxyFailure},
+			changed:  true,
+			want:     []string{"proxy-nginx"},
+		},
+		{
+			name:     "no failure",
+			failures: []netv1alpha1.SyncFailure{proxyFailure},
+			changed:  false,
+			want:     []string{"proxy-nginx"},
+		},
+	}
+
+	for _, tt := range tests {
+		status := &netv1alpha1.LoadBalancerStatus{SyncFailures: tt.failures}
+		if changed := setSyncFailure(status, "provider-ipvsdr", tt.failure); changed != tt.changed {
+			t.Errorf("%s: changed = %v, want %v", tt.name, changed, tt.changed)
+		}
+		var got []string
+		for _, f := range status.SyncFailures {
+			got = append(got, f.Component)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: components = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResultConditions(t *testing.T) {
+	missing := NewCondition(netv1alpha1.LoadBalancerProxyConfigured, v1.ConditionFalse, EventReasonMissingReference, "")
+	conflict := NewCondition(netv1alpha1.LoadBalancerIngressClassConflict, v1.ConditionTrue, "Conflict", "")
+
+	tests := []struct {
+		name   string
+		result func() *Result
+		want   map[netv1alpha1.LoadBalancerConditionType]v1.ConditionStatus
+	}{
+		{
+			name:   "synced",
+			result: func() *Result { return NewProxyResult("nginx") },
+			want:   map[netv1alpha1.LoadBalancerConditionType]v1.ConditionStatus{netv1alpha1.LoadBalancerProxyConfigured: v1.ConditionTrue},
+		},
+		{
+			name: "failed",
+			result: func() *Result {
+				r := NewProviderResult("ipvsdr")
+				r.Err = fmt.Errorf("failed")
+				return r
+			},
+			want: map[netv1alpha1.LoadBalancerConditionType]v1.ConditionStatus{netv1alpha1.LoadBalancerProviderConfigured: v1.ConditionFalse},
+		},
+		{
+			name: "set explicitly",
+			result: func() *Result {
+				r := NewProxyResult("nginx")
+				r.SetConditions(missing)
+				return r
+			},
+			want: map[netv1alpha1.LoadBalancerConditionType]v1.ConditionStatus{netv1alpha1.LoadBalancerProxyConfigured: v1.ConditionFalse},
+		},
+		{
+			name: "blocked",
+			result: func() *Result {
+				r := NewProxyResult("nginx")
+				r.Block(EventReasonIngressClassConflict, "conflict")
+				r.SetConditions(conflict)
+				return r
+			},
+			want: map[netv1alpha1.LoadBalancerConditionType]v1.ConditionStatus{netv1alpha1.LoadBalancerIngressClassConflict: v1.ConditionTrue},
+		},
+	}
+
+	for _, tt := range tests {
+		got := map[netv1alpha1.LoadBalancerConditionType]v1.ConditionStatus{}
+		for _, c := range tt.result().conditions() {
+			got[c.Type] = c.Status
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: conditions = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMinAvailable(t *testing.T) {
+	tests := []struct {
+		replicas int32
+		want     int32
+	}{
+		{0, 0},
+		{1, 0},
+		{2, 1},
+		{5, 4},
+	}
+	for _, tt := range tests {
+		if got := MinAvailable(tt.replicas); got != tt.want {
+			t.Errorf("MinAvailable(%d) = %d, want %d", tt.replicas, got, tt.want)
+		}
+	}
+}
+
+func TestSetPodPriority(t *testing.T) {
+	defer SetPriorityClassName("")
+	SetPriorityClassName("system-cluster-critical")
+
+	lb := &netv1alpha1.LoadBalancer{}
+	template := &v1.PodTemplateSpec{}
+	SetPodPriority(lb, template)
+	if got := template.Annotations[netv1alpha1.AnnotationKeyPriorityClass]; got != "system-cluster-critical" {
+		t.Errorf("default priority class = %q, want system-cluster-critical", got)
+	}
+	if _, ok := template.Annotations[criticalPodAnnotationKey]; !ok {
+		t.Errorf("system priority class is not marked critical")
+	}
+
+	lb.Spec.Template = &netv1alpha1.TemplateSpec{PriorityClassName: "lb-high"}
+	desired := &v1.PodTemplateSpec{}
+	SetPodPriority(lb, desired)
+	if !EnsurePodPriority(desired, template) {
+		t.Errorf("overridden priority class is not changed")
+	}
+	if !reflect.DeepEqual(template.Annotations, desired.Annotations) {
+		t.Errorf("annotations = %v, want %v", template.Annotations, desired.Annotations)
+	}
+	if EnsurePodPriority(desired, template) {
+		t.Errorf("ensured priority class is changed again")
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// networkPolicyAPIVersion is served since kubernetes 1.7, the vendored
+	// client only has the extensions one without egress
+	networkPolicyAPIVersion = "networking.k8s.io/v1"
+	networkPolicyKind       = "NetworkPolicy"
+	networkPolicyPath       = "/apis/" + networkPolicyAPIVersion + "/namespaces/%s/networkpolicies"
+)
+
+// NetworkPolicyPort is a port or a range of ports allowed by NetworkPolicy
+type NetworkPolicyPort struct {
+	Protocol v1.Protocol `json:"protocol,omitempty"`
+	Port     int32       `json:"port,omitempty"`
+	EndPort  int32       `json:"endPort,omitempty"`
+}
+
+type networkPolicyPeer struct {
+	IPBlock *networkPolicyIPBlock `json:"ipBlock,omitempty"`
+}
+
+type networkPolicyIPBlock struct {
+	CIDR string `json:"cidr"`
+}
+
+type networkPolicyRule struct {
+	Ports []NetworkPolicyPort `json:"ports,omitempty"`
+	To    []networkPolicyPeer `json:"to,omitempty"`
+}
+
+type networkPolicySpec struct {
+	PodSelector metav1.LabelSelector `json:"podSelector"`
+	Ingress     []networkPolicyRule  `json:"ingress"`
+	Egress      []networkPolicyRule  `json:"egress"`
+	PolicyTypes []string             `json:"policyTypes"`
+}
+
+type networkPolicy struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   metav1.ObjectMeta `json:"metadata"`
+	Spec       networkPolicySpec `json:"spec"`
+}
+
+// EnsureNetworkPolicy ensures the NetworkPolicy in meta selecting the pods,
+// it allows ingress from anywhere to the ports and egress to the CIDRs only.
+// It is ensured through REST API, there is no client of networking/v1.
+// The action taken is returned, empty if the NetworkPolicy is up to date or
+// not served
+func EnsureNetworkPolicy(client kubernetes.Interface, meta metav1.ObjectMeta, pods map[string]string, ports []NetworkPolicyPort, egressCIDRs []string) (string, error) {
+	// the protocol is defaulted by apiserver, which breaks the comparison
+	for i := range ports {
+		if ports[i].Protocol == "" {
+			ports[i].Protocol = v1.ProtocolTCP
+		}
+	}
+	spec := networkPolicySpec{
+		PodSelector: metav1.LabelSelector{MatchLabels: pods},
+		Ingress:     []networkPolicyRule{{Ports: ports}},
+		Egress:      []networkPolicyRule{{}},
+		PolicyTypes: []string{"Ingress", "Egress"},
+	}
+	for _, cidr := range egressCIDRs {
+		spec.Egress[0].To = append(spec.Egress[0].To, networkPolicyPeer{IPBlock: &networkPolicyIPBlock{CIDR: cidr}})
+	}
+
+	rest := client.CoreV1().RESTClient()
+	path := fmt.Sprintf(networkPolicyPath, meta.Namespace)
+	raw, err := rest.Get().AbsPath(path, meta.Name).Do().Raw()
+	if errors.IsNotFound(err) {
+		body, _ := json.Marshal(networkPolicy{
+			APIVersion: networkPolicyAPIVersion,
+			Kind:       networkPolicyKind,
+			Metadata:   meta,
+			Spec:       spec,
+		})
+		log.Info("Create NetworkPolicy", log.Fields{"np.ns": meta.Namespace, "np.name": meta.Name})
+		err = rest.Post().AbsPath(path).Body(body).Do().Error()
+		if errors.IsNotFound(err) {
+			log.Warn("NetworkPolicy is not served, skip generating it", log.Fields{"np.ns": meta.Namespace, "np.name": meta.Name})
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return ActionCreated, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var existing networkPolicy
+	if err := json.Unmarshal(raw, &existing); err != nil {
+		return "", err
+	}
+	if reflect.DeepEqual(existing.Spec, spec) && reflect.DeepEqual(existing.Metadata.Labels, meta.Labels) {
+		return "", nil
+	}
+
+	updated := existing
+	updated.Metadata.Labels = meta.Labels
+	updated.Spec = spec
+	body, _ := json.Marshal(updated)
+	log.Info("Update NetworkPolicy", log.Fields{"np.ns": meta.Namespace, "np.name": meta.Name})
+	if err := rest.Put().AbsPath(path, meta.Name).Body(body).Do().Error(); err != nil {
+		return "", err
+	}
+	return ActionUpdated, nil
+}
+
+// DeleteNetworkPolicy deletes the NetworkPolicy, it is not an error if the
+// NetworkPolicy does not exist or is not served
+func DeleteNetworkPolicy(client kubernetes.Interface, namespace, name string) error {
+	err := client.CoreV1().RESTClient().Delete().AbsPath(fmt.Sprintf(networkPolicyPath, namespace), name).Do().Error()
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// The workloads of plugins are shared with other actors, e.g. autoscalers
+// and admission webhooks injecting sidecars. Plugins correct them by strategic
+// merge patches computed from the live workload to the copy corrected by the
+// ensure logic, so only the fields the plugin changes are written, and the
+// changes made meanwhile by others are never overwritten by a stale copy.
+//
+// The field ownership policy is:
+//   - plugins own the labels and pod template annotations they render, the
+//     strategy, and the pod template fields corrected by their ensure logic,
+//     e.g. affinity, tolerations and node selector are owned as a whole
+//   - plugins own the containers, init containers and volumes they render,
+//     identified by name. The names are recorded in AnnotationKeyManagedEntries
+//     on the workload, so the ones no longer rendered are removed, while the
+//     ones added by others are kept even if the ensure logic replaces the list
+//   - plugins own the replicas of deployment, unless it is annotated with
+//     AnnotationKeyExternalReplicas, e.g. for a HorizontalPodAutoscaler
+//   - everything else, e.g. other labels and annotations, belongs to others
+
+// managedEntries is the names of entries of pod template rendered by plugin
+type managedEntries struct {
+	Containers     []string `json:"containers,omitempty"`
+	InitContainers []string `json:"initContainers,omitempty"`
+	Volumes        []string `json:"volumes,omitempty"`
+}
+
+// managedEntriesOf returns the names of entries in the pod template
+func managedEntriesOf(template *v1.PodTemplateSpec) managedEntries {
+	entries := managedEntries{}
+	for _, c := range template.Spec.Containers {
+		entries.Containers = append(entries.Containers, c.Name)
+	}
+	for _, c := range template.Spec.InitContainers {
+		entries.InitContainers = append(entries.InitContainers, c.Name)
+	}
+	for _, v := range template.Spec.Volumes {
+		entries.Volumes = append(entries.Volumes, v.Name)
+	}
+	return entries
+}
+
+// lastManagedEntries returns the entries recorded on the live workload, the
+// entries desired are used for the workloads created before they were recorded
+func lastManagedEntries(live metav1.Object, desired *v1.PodTemplateSpec) managedEntries {
+	entries := managedEntries{}
+	if raw, ok := live.GetAnnotations()[netv1alpha1.AnnotationKeyManagedEntries]; ok {
+		if err := json.Unmarshal([]byte(raw), &entries); err == nil {
+			return entries
+		}
+	}
+	return managedEntriesOf(desired)
+}
+
+// ExternalReplicas returns true if the replicas of deployment are managed by
+// another actor
+func ExternalReplicas(d *extensions.Deployment) bool {
+	return d.Annotations[netv1alpha1.AnnotationKeyExternalReplicas] == "true"
+}
+
+// retainUnmanaged adds the entries of live template which are neither in
+// modified nor managed by plugin back to modified
+func retainUnmanaged(last managedEntries, live, modified *v1.PodTemplateSpec) {
+	for _, c := range live.Spec.Containers {
+		if !containsName(last.Containers, c.Name) && !hasContainer(modified.Spec.Containers, c.Name) {
+			modified.Spec.Containers = append(modified.Spec.Containers, c)
+		}
+	}
+	for _, c := range live.Spec.InitContainers {
+		if !containsName(last.InitContainers, c.Name) && !hasContainer(modified.Spec.InitContainers, c.Name) {
+			modified.Spec.InitContainers = append(modified.Spec.InitContainers, c)
+		}
+	}
+	for _, v := range live.Spec.Volumes {
+		if containsName(last.Volumes, v.Name) {
+			continue
+		}
+		found := false
+		for _, mv := range modified.Spec.Volumes {
+			if mv.Name == v.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			modified.Spec.Volumes = append(modified.Spec.Volumes, v)
+		}
+	}
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasContainer(containers []v1.Container, name string) bool {
+	for _, c := range containers {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// applyOwnership applies the ownership policy to modified, the entries of live
+// not managed by plugin are kept and the entries of desired are recorded
+func applyOwnership(desired *v1.PodTemplateSpec, live metav1.Object, liveTemplate *v1.PodTemplateSpec, modified metav1.Object, modifiedTemplate *v1.PodTemplateSpec) error {
+	retainUnmanaged(lastManagedEntries(live, desired), liveTemplate, modifiedTemplate)
+
+	raw, err := json.Marshal(managedEntriesOf(desired))
+	if err != nil {
+		return err
+	}
+	annotations := modified.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[netv1alpha1.AnnotationKeyManagedEntries] = string(raw)
+	modified.SetAnnotations(annotations)
+	return nil
+}
+
+// workloadPatch returns the strategic merge patch from live to modified, the
+// priority class in the pod template is written into the pod spec. It returns
+// nil if nothing is changed
+func workloadPatch(live, modified interface{}, dataStruct interface{}, liveTemplate, modifiedTemplate *v1.PodTemplateSpec) ([]byte, error) {
+	original, err := json.Marshal(live)
+	if err != nil {
+		return nil, err
+	}
+	target, err := json.Marshal(modified)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := strategicpatch.CreateTwoWayMergePatch(original, target, dataStruct)
+	if err != nil {
+		return nil, err
+	}
+	patch := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		return nil, err
+	}
+
+	class := modifiedTemplate.Annotations[netv1alpha1.AnnotationKeyPriorityClass]
+	if class != liveTemplate.Annotations[netv1alpha1.AnnotationKeyPriorityClass] {
+		var value interface{}
+		if class != "" {
+			value = class
+		}
+		nestedMap(patch, "spec", "template", "spec")["priorityClassName"] = value
+	}
+
+	if len(patch) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(patch)
+}
+
+// nestedMap returns the map at path in object, the missing maps are created
+func nestedMap(object map[string]interface{}, path ...string) map[string]interface{} {
+	for _, key := range path {
+		next, ok := object[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			object[key] = next
+		}
+		object = next
+	}
+	return object
+}
+
+// PatchDeployment writes the fields of deployment owned by plugin, which are
+// corrected from live to modified, with a strategic merge patch. desired is
+// the deployment rendered by plugin. It returns the patched deployment and
+// whether it is changed, live is returned if nothing is changed
+func PatchDeployment(client kubernetes.Interface, desired, live, modified *extensions.Deployment) (*extensions.Deployment, bool, error) {
+	if ExternalReplicas(live) {
+		modified.Spec.Replicas = live.Spec.Replicas
+	}
+	if err := applyOwnership(&desired.Spec.Template, live, &live.Spec.Template, modified, &modified.Spec.Template); err != nil {
+		return nil, false, err
+	}
+	patch, err := workloadPatch(live, modified, extensions.Deployment{}, &live.Spec.Template, &modified.Spec.Template)
+	if err != nil {
+		return nil, false, fmt.Errorf("create patch of deployment %s/%s error: %v", live.Namespace, live.Name, err)
+	}
+	if patch == nil {
+		return live, false, nil
+	}
+	d, err := client.ExtensionsV1beta1().Deployments(live.Namespace).Patch(live.Name, types.StrategicMergePatchType, patch)
+	return d, err == nil, err
+}
+
+// PatchDaemonSet writes the fields of daemonset owned by plugin, which are
+// corrected from live to modified, with a strategic merge patch. desired is
+// the daemonset rendered by plugin. It returns the patched daemonset and
+// whether it is changed, live is returned if nothing is changed
+func PatchDaemonSet(client kubernetes.Interface, desired, live, modified *extensions.DaemonSet) (*extensions.DaemonSet, bool, error) {
+	if err := applyOwnership(&desired.Spec.Template, live, &live.Spec.Template, modified, &modified.Spec.Template); err != nil {
+		return nil, false, err
+	}
+	patch, err := workloadPatch(live, modified, extensions.DaemonSet{}, &live.Spec.Template, &modified.Spec.Template)
+	if err != nil {
+		return nil, false, fmt.Errorf("create patch of daemonset %s/%s error: %v", live.Namespace, live.Name, err)
+	}
+	if patch == nil {
+		return live, false, nil
+	}
+	ds, err := client.ExtensionsV1beta1().DaemonSets(live.Namespace).Patch(live.Name, types.StrategicMergePatchType, patch)
+	return ds, err == nil, err
+}
+
+// ScaleDeployment scales the deployment by a patch of its replicas
+func ScaleDeployment(client kubernetes.Interface, namespace, name string, replicas int32) error {
+	patch := fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas)
+	_, err := client.ExtensionsV1beta1().Deployments(namespace).Patch(name, types.StrategicMergePatchType, []byte(patch))
+	return err
+}
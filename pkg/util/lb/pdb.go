@@ -0,0 +1,107 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	"reflect"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	policy "k8s.io/client-go/pkg/apis/policy/v1beta1"
+)
+
+// MinAvailable returns the minAvailable of PodDisruptionBudget for replicas,
+// one replica is allowed to be disrupted at a time
+func MinAvailable(replicas int32) int32 {
+	if replicas <= 1 {
+		return 0
+	}
+	return replicas - 1
+}
+
+// EnsurePodDisruptionBudget ensures the PodDisruptionBudget owned by lb selecting
+// the pods keeps MinAvailable(replicas) of them available.
+// The spec of PodDisruptionBudget is immutable in policy/v1beta1, so it is
+// recreated on change. The action taken is returned, empty if the
+// PodDisruptionBudget is up to date
+func EnsurePodDisruptionBudget(client kubernetes.Interface, lb *netv1alpha1.LoadBalancer, name string, labels, pods map[string]string, replicas int32) (string, error) {
+	t := true
+	desired := &policy.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: lb.Namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion:         controllerKind.GroupVersion().String(),
+					Kind:               controllerKind.Kind,
+					Name:               lb.Name,
+					UID:                lb.UID,
+					Controller:         &t,
+					BlockOwnerDeletion: &t,
+				},
+			},
+		},
+		Spec: policy.PodDisruptionBudgetSpec{
+			MinAvailable: intstr.FromInt(int(MinAvailable(replicas))),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: pods,
+			},
+		},
+	}
+
+	pdbs := client.PolicyV1beta1().PodDisruptionBudgets(lb.Namespace)
+	pdb, err := pdbs.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		log.Info("Create PodDisruptionBudget", log.Fields{"pdb.ns": lb.Namespace, "pdb.name": name})
+		if _, err := pdbs.Create(desired); err != nil {
+			return "", err
+		}
+		return ActionCreated, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if reflect.DeepEqual(pdb.Spec, desired.Spec) && reflect.DeepEqual(pdb.Labels, desired.Labels) {
+		return "", nil
+	}
+
+	log.Info("Recreate PodDisruptionBudget", log.Fields{"pdb.ns": lb.Namespace, "pdb.name": name, "minAvailable": desired.Spec.MinAvailable.String()})
+	if err := pdbs.Delete(name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return "", err
+	}
+	if _, err := pdbs.Create(desired); err != nil {
+		return "", err
+	}
+	return ActionUpdated, nil
+}
+
+// DeletePodDisruptionBudget deletes the PodDisruptionBudget, it is not an
+// error if the PodDisruptionBudget does not exist
+func DeletePodDisruptionBudget(client kubernetes.Interface, namespace, name string) error {
+	err := client.PolicyV1beta1().PodDisruptionBudgets(namespace).Delete(name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
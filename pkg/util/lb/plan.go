@@ -0,0 +1,116 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	"github.com/caicloud/loadbalancer-controller/pkg/util/audit"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Plan collects the changes a plugin would make to the resources of a
+// loadbalancer in dry run mode
+type Plan struct {
+	plugin  string
+	lb      *netv1alpha1.LoadBalancer
+	changes []string
+}
+
+// NewPlan returns an empty plan of plugin for lb
+func NewPlan(plugin string, lb *netv1alpha1.LoadBalancer) *Plan {
+	return &Plan{plugin: plugin, lb: lb}
+}
+
+// Create plans the creation of a resource
+func (p *Plan) Create(kind, name string) {
+	p.changes = append(p.changes, fmt.Sprintf("create %s %s", kind, name))
+}
+
+// Delete plans the deletion of a resource
+func (p *Plan) Delete(kind, name string) {
+	p.changes = append(p.changes, fmt.Sprintf("delete %s %s", kind, name))
+}
+
+// Update plans the update of the fields of a resource
+func (p *Plan) Update(kind, name string, fields []string) {
+	p.changes = append(p.changes, fmt.Sprintf("update %s %s (%s)", kind, name, strings.Join(fields, ", ")))
+}
+
+// Diff plans the update of a resource from live to corrected, the object
+// corrected by the ensure logic of plugin. The fields cleared by the ensure
+// logic are not listed, the metadata is reported if no field is found
+func (p *Plan) Diff(kind, name string, corrected, live interface{}) {
+	fields := audit.Diff(corrected, live)
+	if len(fields) == 0 {
+		fields = []string{"metadata"}
+	}
+	p.Update(kind, name, fields)
+}
+
+// ConfigMap plans the creation or update of a ConfigMap containing data, the
+// live ConfigMap is got from apiserver
+func (p *Plan) ConfigMap(client kubernetes.Interface, namespace, name string, data map[string]string) error {
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		p.Create("ConfigMap", name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var fields []string
+	for k, v := range data {
+		if old, ok := cm.Data[k]; !ok || old != v {
+			fields = append(fields, "data["+k+"]")
+		}
+	}
+	for k := range cm.Data {
+		if _, ok := data[k]; !ok {
+			fields = append(fields, "data["+k+"]")
+		}
+	}
+	if len(fields) != 0 {
+		sort.Strings(fields)
+		p.Update("ConfigMap", name, fields)
+	}
+	return nil
+}
+
+// Report logs the planned changes and records them in an event of lb
+func (p *Plan) Report(recorder record.EventRecorder) {
+	fields := log.Fields{"plugin": p.plugin, "lb.ns": p.lb.Namespace, "lb.name": p.lb.Name}
+	if len(p.changes) == 0 {
+		log.Debug("Dry run, no change", fields)
+		return
+	}
+	for _, change := range p.changes {
+		fields["change"] = change
+		log.Info("Dry run, skip change", fields)
+	}
+	recorder.Eventf(p.lb, v1.EventTypeNormal, EventReasonDryRun, "Dry run of %s, would %s", p.plugin, strings.Join(p.changes, "; "))
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// podMonitorAPIVersion is the group version of PodMonitor of prometheus operator
+	podMonitorAPIVersion = "monitoring.coreos.com/v1"
+	podMonitorKind       = "PodMonitor"
+	podMonitorPath       = "/apis/" + podMonitorAPIVersion + "/namespaces/%s/podmonitors"
+)
+
+// PodMetricsEndpoint is an endpoint of pods scraped by Prometheus, the port
+// is referenced by name or by number if it is not named
+type PodMetricsEndpoint struct {
+	Port       string              `json:"port,omitempty"`
+	TargetPort *intstr.IntOrString `json:"targetPort,omitempty"`
+	Path       string              `json:"path,omitempty"`
+}
+
+type podMonitorSpec struct {
+	Selector            metav1.LabelSelector `json:"selector"`
+	PodMetricsEndpoints []PodMetricsEndpoint `json:"podMetricsEndpoints"`
+}
+
+type podMonitor struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   metav1.ObjectMeta `json:"metadata"`
+	Spec       podMonitorSpec    `json:"spec"`
+}
+
+// EnsurePodMonitor ensures the PodMonitor in meta scraping the endpoints of
+// the pods. It is ensured through REST API, there is no client of prometheus
+// operator. The action taken is returned, empty if the PodMonitor is up to
+// date or not served
+func EnsurePodMonitor(client kubernetes.Interface, meta metav1.ObjectMeta, pods map[string]string, endpoints []PodMetricsEndpoint) (string, error) {
+	spec := podMonitorSpec{
+		Selector:            metav1.LabelSelector{MatchLabels: pods},
+		PodMetricsEndpoints: endpoints,
+	}
+
+	rest := client.CoreV1().RESTClient()
+	path := fmt.Sprintf(podMonitorPath, meta.Namespace)
+	raw, err := rest.Get().AbsPath(path, meta.Name).Do().Raw()
+	if errors.IsNotFound(err) {
+		body, _ := json.Marshal(podMonitor{
+			APIVersion: podMonitorAPIVersion,
+			Kind:       podMonitorKind,
+			Metadata:   meta,
+			Spec:       spec,
+		})
+		log.Info("Create PodMonitor", log.Fields{"pm.ns": meta.Namespace, "pm.name": meta.Name})
+		err = rest.Post().AbsPath(path).Body(body).Do().Error()
+		if errors.IsNotFound(err) {
+			log.Warn("PodMonitor is not served, skip generating it", log.Fields{"pm.ns": meta.Namespace, "pm.name": meta.Name})
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return ActionCreated, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var existing podMonitor
+	if err := json.Unmarshal(raw, &existing); err != nil {
+		return "", err
+	}
+	if reflect.DeepEqual(existing.Spec, spec) && reflect.DeepEqual(existing.Metadata.Labels, meta.Labels) {
+		return "", nil
+	}
+
+	updated := existing
+	updated.Metadata.Labels = meta.Labels
+	updated.Spec = spec
+	body, _ := json.Marshal(updated)
+	log.Info("Update PodMonitor", log.Fields{"pm.ns": meta.Namespace, "pm.name": meta.Name})
+	if err := rest.Put().AbsPath(path, meta.Name).Body(body).Do().Error(); err != nil {
+		return "", err
+	}
+	return ActionUpdated, nil
+}
+
+// DeletePodMonitor deletes the PodMonitor, it is not an error if the
+// PodMonitor does not exist or is not served
+func DeletePodMonitor(client kubernetes.Interface, namespace, name string) error {
+	err := client.CoreV1().RESTClient().Delete().AbsPath(fmt.Sprintf(podMonitorPath, namespace), name).Do().Error()
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// MonitorMeta returns the meta of the PodMonitor of the pods of component of
+// lb, which is owned by lb and labeled for Prometheus with extra labels
+func MonitorMeta(lb *netv1alpha1.LoadBalancer, name string, selector map[string]string, component string, extra map[string]string) metav1.ObjectMeta {
+	objLabels := WithArtifactLabels(selector, lb, component)
+	for k, v := range extra {
+		objLabels[k] = v
+	}
+	return metav1.ObjectMeta{
+		Name:            name,
+		Namespace:       lb.Namespace,
+		Labels:          objLabels,
+		OwnerReferences: ownerReferences(lb),
+	}
+}
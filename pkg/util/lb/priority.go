@@ -0,0 +1,147 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	"encoding/json"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// criticalPodAnnotationKey marks the pods in kube-system as critical for the
+// clusters scheduling them by annotation rather than priority
+const criticalPodAnnotationKey = "scheduler.alpha.kubernetes.io/critical-pod"
+
+// priorityClassName is the default priority class of pods, it is set once at startup
+var priorityClassName string
+
+// SetPriorityClassName sets the default priority class of pods generated by plugins
+func SetPriorityClassName(name string) {
+	priorityClassName = name
+}
+
+// PriorityClassName returns the priority class of pods of lb, the one in lb
+// template overrides the default one
+func PriorityClassName(lb *netv1alpha1.LoadBalancer) string {
+	if lb.Spec.Template != nil && lb.Spec.Template.PriorityClassName != "" {
+		return lb.Spec.Template.PriorityClassName
+	}
+	return priorityClassName
+}
+
+// SetPodPriority renders the priority class of lb into the annotations of pod
+// template. The vendored PodSpec has no priorityClassName, it is written from
+// the annotation by the Create functions below and the patches of workloads
+func SetPodPriority(lb *netv1alpha1.LoadBalancer, template *v1.PodTemplateSpec) {
+	name := PriorityClassName(lb)
+	if name == "" {
+		delete(template.Annotations, netv1alpha1.AnnotationKeyPriorityClass)
+		delete(template.Annotations, criticalPodAnnotationKey)
+		return
+	}
+	if template.Annotations == nil {
+		template.Annotations = make(map[string]string)
+	}
+	template.Annotations[netv1alpha1.AnnotationKeyPriorityClass] = name
+	if strings.HasPrefix(name, "system-") {
+		template.Annotations[criticalPodAnnotationKey] = ""
+	} else {
+		delete(template.Annotations, criticalPodAnnotationKey)
+	}
+}
+
+// EnsurePodPriority corrects the priority of the pod template copied from the
+// existing workload with the desired one, and returns whether it is changed
+func EnsurePodPriority(desired, copied *v1.PodTemplateSpec) bool {
+	changed := false
+	for _, key := range []string{netv1alpha1.AnnotationKeyPriorityClass, criticalPodAnnotationKey} {
+		want, ok := desired.Annotations[key]
+		got, found := copied.Annotations[key]
+		if ok == found && want == got {
+			continue
+		}
+		changed = true
+		if !ok {
+			delete(copied.Annotations, key)
+			continue
+		}
+		if copied.Annotations == nil {
+			copied.Annotations = make(map[string]string)
+		}
+		copied.Annotations[key] = want
+	}
+	return changed
+}
+
+// CreateDeployment creates the deployment in namespace with the priority class in its pod template
+func CreateDeployment(client kubernetes.Interface, namespace string, d *extensions.Deployment) (*extensions.Deployment, error) {
+	class := d.Spec.Template.Annotations[netv1alpha1.AnnotationKeyPriorityClass]
+	if class == "" {
+		return client.ExtensionsV1beta1().Deployments(namespace).Create(d)
+	}
+	body, err := withPriorityClassName(d, "Deployment", class)
+	if err != nil {
+		return nil, err
+	}
+	result := &extensions.Deployment{}
+	err = client.ExtensionsV1beta1().RESTClient().Post().
+		Namespace(namespace).Resource("deployments").
+		Body(body).Do().Into(result)
+	return result, err
+}
+
+// CreateDaemonSet creates the daemonset in namespace with the priority class in its pod template
+func CreateDaemonSet(client kubernetes.Interface, namespace string, ds *extensions.DaemonSet) (*extensions.DaemonSet, error) {
+	class := ds.Spec.Template.Annotations[netv1alpha1.AnnotationKeyPriorityClass]
+	if class == "" {
+		return client.ExtensionsV1beta1().DaemonSets(namespace).Create(ds)
+	}
+	body, err := withPriorityClassName(ds, "DaemonSet", class)
+	if err != nil {
+		return nil, err
+	}
+	result := &extensions.DaemonSet{}
+	err = client.ExtensionsV1beta1().RESTClient().Post().
+		Namespace(namespace).Resource("daemonsets").
+		Body(body).Do().Into(result)
+	return result, err
+}
+
+// withPriorityClassName encodes the workload in json with priorityClassName
+// set in the spec of its pod template
+func withPriorityClassName(obj runtime.Object, kind, class string) ([]byte, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, err
+	}
+	object["apiVersion"] = extensions.SchemeGroupVersion.String()
+	object["kind"] = kind
+
+	podSpec := object["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	podSpec["priorityClassName"] = class
+	return json.Marshal(object)
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	"fmt"
+	"reflect"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	rbac "k8s.io/client-go/pkg/apis/rbac/v1beta1"
+)
+
+// defaultServiceAccountName is the ServiceAccount of pods when none is generated
+const defaultServiceAccountName = "default"
+
+// ServiceAccountName returns the ServiceAccount of the pods of component of lb,
+// it is the default one of namespace if ServiceAccounts are not generated.
+// The default one is set explicitly to be compared with the one defaulted by
+// apiserver
+func ServiceAccountName(lb *netv1alpha1.LoadBalancer, component string, generated bool) string {
+	if !generated {
+		return defaultServiceAccountName
+	}
+	return lb.Name + "-" + component
+}
+
+// ClusterRoleBindingName returns the name of ClusterRoleBinding of component
+// of lb, it is unique in cluster
+func ClusterRoleBindingName(lb *netv1alpha1.LoadBalancer, component string) string {
+	return fmt.Sprintf("loadbalancer:%s:%s:%s", lb.Namespace, lb.Name, component)
+}
+
+// ownerReferences returns the owner references making lb the controller of
+// the namespaced objects generated for it
+func ownerReferences(lb *netv1alpha1.LoadBalancer) []metav1.OwnerReference {
+	t := true
+	return []metav1.OwnerReference{
+		{
+			APIVersion:         controllerKind.GroupVersion().String(),
+			Kind:               controllerKind.Kind,
+			Name:               lb.Name,
+			UID:                lb.UID,
+			Controller:         &t,
+			BlockOwnerDeletion: &t,
+		},
+	}
+}
+
+// EnsureServiceAccount ensures the ServiceAccount of the pods of lb and a Role
+// of rules bound to it, all of them are named name and owned by lb. They are
+// deleted by DeleteServiceAccount in cleanup. The action taken is returned,
+// empty if they are up to date
+func EnsureServiceAccount(client kubernetes.Interface, lb *netv1alpha1.LoadBalancer, name string, labels map[string]string, rules []rbac.PolicyRule) (string, error) {
+	meta := metav1.ObjectMeta{
+		Name:            name,
+		Namespace:       lb.Namespace,
+		Labels:          labels,
+		OwnerReferences: ownerReferences(lb),
+	}
+	actions := make([]string, 0, 3)
+
+	sas := client.CoreV1().ServiceAccounts(lb.Namespace)
+	sa, err := sas.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		log.Info("Create ServiceAccount", log.Fields{"sa.ns": lb.Namespace, "sa.name": name})
+		if _, err := sas.Create(&v1.ServiceAccount{ObjectMeta: meta}); err != nil {
+			return "", err
+		}
+		actions = append(actions, ActionCreated)
+	} else if err != nil {
+		return "", err
+	} else if !reflect.DeepEqual(sa.Labels, labels) {
+		sa.Labels = labels
+		if _, err := sas.Update(sa); err != nil {
+			return "", err
+		}
+		actions = append(actions, ActionUpdated)
+	}
+
+	roles := client.RbacV1beta1().Roles(lb.Namespace)
+	role, err := roles.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		log.Info("Create Role", log.Fields{"role.ns": lb.Namespace, "role.name": name})
+		if _, err := roles.Create(&rbac.Role{ObjectMeta: meta, Rules: rules}); err != nil {
+			return "", err
+		}
+		actions = append(actions, ActionCreated)
+	} else if err != nil {
+		return "", err
+	} else if !reflect.DeepEqual(role.Rules, rules) || !reflect.DeepEqual(role.Labels, labels) {
+		role.Rules = rules
+		role.Labels = labels
+		log.Info("Update Role", log.Fields{"role.ns": lb.Namespace, "role.name": name})
+		if _, err := roles.Update(role); err != nil {
+			return "", err
+		}
+		actions = append(actions, ActionUpdated)
+	}
+
+	binding := &rbac.RoleBinding{
+		ObjectMeta: meta,
+		Subjects: []rbac.Subject{
+			{Kind: rbac.ServiceAccountKind, Name: name, Namespace: lb.Namespace},
+		},
+		RoleRef: rbac.RoleRef{APIGroup: rbac.GroupName, Kind: "Role", Name: name},
+	}
+	action, err := ensureRoleBinding(client, binding)
+	if err != nil {
+		return "", err
+	}
+	return mergeActions(append(actions, action)), nil
+}
+
+// ensureRoleBinding ensures the RoleBinding, it is recreated on change since
+// the role reference is immutable
+func ensureRoleBinding(client kubernetes.Interface, desired *rbac.RoleBinding) (string, error) {
+	bindings := client.RbacV1beta1().RoleBindings(desired.Namespace)
+	binding, err := bindings.Get(desired.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		log.Info("Create RoleBinding", log.Fields{"rb.ns": desired.Namespace, "rb.name": desired.Name})
+		if _, err := bindings.Create(desired); err != nil {
+			return "", err
+		}
+		return ActionCreated, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if reflect.DeepEqual(binding.Subjects, desired.Subjects) && reflect.DeepEqual(binding.RoleRef, desired.RoleRef) &&
+		reflect.DeepEqual(binding.Labels, desired.Labels) {
+		return "", nil
+	}
+
+	log.Info("Recreate RoleBinding", log.Fields{"rb.ns": desired.Namespace, "rb.name": desired.Name})
+	if err := bindings.Delete(desired.Name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return "", err
+	}
+	if _, err := bindings.Create(desired); err != nil {
+		return "", err
+	}
+	return ActionUpdated, nil
+}
+
+// EnsureClusterRoleBinding binds the ClusterRole to the ServiceAccount of lb.
+// It is cluster scoped and can not be owned by lb, it must be deleted by
+// DeleteClusterRoleBinding in cleanup. The action taken is returned, empty
+// if it is up to date
+func EnsureClusterRoleBinding(client kubernetes.Interface, lb *netv1alpha1.LoadBalancer, name, clusterRole, serviceAccount string, labels map[string]string) (string, error) {
+	desired := &rbac.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Subjects: []rbac.Subject{
+			{Kind: rbac.ServiceAccountKind, Name: serviceAccount, Namespace: lb.Namespace},
+		},
+		RoleRef: rbac.RoleRef{APIGroup: rbac.GroupName, Kind: "ClusterRole", Name: clusterRole},
+	}
+
+	bindings := client.RbacV1beta1().ClusterRoleBindings()
+	binding, err := bindings.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		log.Info("Create ClusterRoleBinding", log.Fields{"crb.name": name, "clusterRole": clusterRole})
+		if _, err := bindings.Create(desired); err != nil {
+			return "", err
+		}
+		return ActionCreated, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if reflect.DeepEqual(binding.Subjects, desired.Subjects) && reflect.DeepEqual(binding.RoleRef, desired.RoleRef) &&
+		reflect.DeepEqual(binding.Labels, desired.Labels) {
+		return "", nil
+	}
+
+	log.Info("Recreate ClusterRoleBinding", log.Fields{"crb.name": name, "clusterRole": clusterRole})
+	if err := bindings.Delete(name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return "", err
+	}
+	if _, err := bindings.Create(desired); err != nil {
+		return "", err
+	}
+	return ActionUpdated, nil
+}
+
+// DeleteServiceAccount deletes the ServiceAccount with its Role and
+// RoleBinding, it is not an error if they do not exist
+func DeleteServiceAccount(client kubernetes.Interface, namespace, name string) error {
+	err := client.RbacV1beta1().RoleBindings(namespace).Delete(name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	err = client.RbacV1beta1().Roles(namespace).Delete(name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	err = client.CoreV1().ServiceAccounts(namespace).Delete(name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// DeleteClusterRoleBinding deletes the ClusterRoleBinding, it is not an error
+// if it does not exist
+func DeleteClusterRoleBinding(client kubernetes.Interface, name string) error {
+	err := client.RbacV1beta1().ClusterRoleBindings().Delete(name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// mergeActions returns created if any object is created, otherwise updated
+// if any is updated
+func mergeActions(actions []string) string {
+	merged := ""
+	for _, action := range actions {
+		switch action {
+		case ActionCreated:
+			return ActionCreated
+		case ActionUpdated:
+			merged = ActionUpdated
+		}
+	}
+	return merged
+}
@@ -0,0 +1,254 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	"github.com/caicloud/loadbalancer-controller/pkg/metrics"
+	"github.com/caicloud/loadbalancer-controller/pkg/tprclient"
+
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Actions of the changes made by plugins
+const (
+	ActionCreated = "created"
+	ActionUpdated = "updated"
+	ActionScaled  = "scaled"
+	ActionDeleted = "deleted"
+)
+
+// Change is an object of loadbalancer written by a plugin
+type Change struct {
+	Action string
+	Kind   string
+	Name   string
+}
+
+// Warning is an abnormal state found by a plugin, it is recorded as a
+// Warning event
+type Warning struct {
+	Reason  string
+	Message string
+}
+
+// Result is the outcome of one reconcile of a loadbalancer by a plugin.
+// Plugins return it to the controller instead of recording events and
+// writing conditions themselves, so that all plugins are reported the same
+type Result struct {
+	// Plugin is the name of plugin, e.g. nginx
+	Plugin string
+	// Component is what the plugin is to loadbalancer, proxy or provider
+	Component string
+	// Configured is the condition type set from Err unless the plugin is
+	// blocked or sets it explicitly
+	Configured netv1alpha1.LoadBalancerConditionType
+
+	Changes           []Change
+	Warnings          []Warning
+	Conditions        []netv1alpha1.LoadBalancerCondition
+	RemovedConditions []netv1alpha1.LoadBalancerConditionType
+	// RequeueAfter asks the controller to sync loadbalancer again after
+	// the duration, zero means no requeue
+	RequeueAfter time.Duration
+	// Blocked is true if the plugin did not reconcile loadbalancer
+	Blocked bool
+	Err     error
+}
+
+// NewProxyResult returns an empty result of proxy plugin
+func NewProxyResult(plugin string) *Result {
+	return &Result{Plugin: plugin, Component: "proxy", Configured: netv1alpha1.LoadBalancerProxyConfigured}
+}
+
+// NewProviderResult returns an empty result of provider plugin
+func NewProviderResult(plugin string) *Result {
+	return &Result{Plugin: plugin, Component: "provider", Configured: netv1alpha1.LoadBalancerProviderConfigured}
+}
+
+// Created records that the object is created
+func (r *Result) Created(kind, name string) {
+	r.Changes = append(r.Changes, Change{Action: ActionCreated, Kind: kind, Name: name})
+}
+
+// Updated records that the object is updated
+func (r *Result) Updated(kind, name string) {
+	r.Changes = append(r.Changes, Change{Action: ActionUpdated, Kind: kind, Name: name})
+}
+
+// Scaled records that the unexpected workload is scaled to zero
+func (r *Result) Scaled(kind, name string) {
+	r.Changes = append(r.Changes, Change{Action: ActionScaled, Kind: kind, Name: name})
+}
+
+// Deleted records that the object is deleted
+func (r *Result) Deleted(kind, name string) {
+	r.Changes = append(r.Changes, Change{Action: ActionDeleted, Kind: kind, Name: name})
+}
+
+// Warn records an abnormal state of loadbalancer
+func (r *Result) Warn(reason, message string) {
+	r.Warnings = append(r.Warnings, Warning{Reason: reason, Message: message})
+}
+
+// Block records that the plugin stopped reconciling loadbalancer for reason,
+// the configured condition is left as is
+func (r *Result) Block(reason, message string) {
+	r.Blocked = true
+	r.Warn(reason, message)
+}
+
+// SetConditions records the conditions to set in status
+func (r *Result) SetConditions(conditions ...netv1alpha1.LoadBalancerCondition) {
+	r.Conditions = append(r.Conditions, conditions...)
+}
+
+// RemoveConditions records the conditions to remove from status
+func (r *Result) RemoveConditions(condTypes ...netv1alpha1.LoadBalancerConditionType) {
+	r.RemovedConditions = append(r.RemovedConditions, condTypes...)
+}
+
+// Requeue asks to sync loadbalancer again after the duration, the earliest
+// one wins
+func (r *Result) Requeue(after time.Duration) {
+	if r.RequeueAfter == 0 || after < r.RequeueAfter {
+		r.RequeueAfter = after
+	}
+}
+
+// conditions returns the conditions to set in status, including the
+// configured condition computed from Err
+func (r *Result) conditions() []netv1alpha1.LoadBalancerCondition {
+	conditions := r.Conditions
+	if r.Blocked || r.Configured == "" {
+		return conditions
+	}
+	for _, c := range conditions {
+		if c.Type == r.Configured {
+			return conditions
+		}
+	}
+	configured := NewCondition(r.Configured, v1.ConditionTrue, "Synced", "")
+	if r.Err != nil {
+		configured = NewCondition(r.Configured, v1.ConditionFalse, EventReasonSyncFailed, r.Err.Error())
+	}
+	return append(conditions, configured)
+}
+
+// RequeueFunc syncs loadbalancer again after the duration
+type RequeueFunc func(lb *netv1alpha1.LoadBalancer, after time.Duration)
+
+// Aggregator applies the results of all plugins to loadbalancers. Events,
+// metrics and conditions of plugins are written in one place
+type Aggregator struct {
+	client   tprclient.Interface
+	recorder record.EventRecorder
+	requeue  RequeueFunc
+}
+
+// NewAggregator returns an aggregator writing status by client and events by
+// recorder, the hints of requeue are passed to requeue if it is not nil
+func NewAggregator(client tprclient.Interface, recorder record.EventRecorder, requeue RequeueFunc) *Aggregator {
+	return &Aggregator{
+		client:   client,
+		recorder: recorder,
+		requeue:  requeue,
+	}
+}
+
+// Apply records the events and metrics of result and writes its conditions
+// to lb. It returns the error of result, so that plugins retry it
+func (a *Aggregator) Apply(lb *netv1alpha1.LoadBalancer, result *Result) error {
+	name := fmt.Sprintf("%s %s", result.Plugin, result.Component)
+	for _, c := range result.Changes {
+		metrics.IncPluginChange(result.Plugin, c.Kind, c.Action)
+		kind := strings.ToLower(c.Kind)
+		switch c.Action {
+		case ActionCreated:
+			a.recorder.Eventf(lb, v1.EventTypeNormal, EventReasonCreated, "Create %s %s %s", result.Plugin, kind, c.Name)
+		case ActionUpdated:
+			a.recorder.Eventf(lb, v1.EventTypeNormal, EventReasonUpdated, "Update %s %s %s", result.Plugin, kind, c.Name)
+		case ActionScaled:
+			metrics.ScaledToZero.Add(result.Plugin, 1)
+			a.recorder.Eventf(lb, v1.EventTypeWarning, EventReasonScaled, "Scale unexpected %s %s %s to zero", result.Plugin, kind, c.Name)
+		case ActionDeleted:
+			a.recorder.Eventf(lb, v1.EventTypeNormal, EventReasonCleanedUp, "Delete %s %s %s", result.Plugin, kind, c.Name)
+		}
+	}
+	for _, w := range result.Warnings {
+		a.recorder.Event(lb, v1.EventTypeWarning, w.Reason, w.Message)
+	}
+	if result.Err != nil {
+		metrics.IncPluginSync(result.Plugin, false)
+		a.recorder.Eventf(lb, v1.EventTypeWarning, EventReasonSyncFailed, "Sync %s failed: %v", name, result.Err)
+	} else if !result.Blocked {
+		metrics.IncPluginSync(result.Plugin, true)
+	}
+
+	if !IsDryRun(lb) {
+		conditions := result.conditions()
+		removed := result.RemovedConditions
+		err := WriteStatus(a.client.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, func(status *netv1alpha1.LoadBalancerStatus) bool {
+			return len(removed) != 0 && RemoveCondition(status, removed...)
+		}, conditions...)
+		if err != nil {
+			log.Error("Update conditions of plugin error", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "plugin": name, "err": err})
+			if result.Err == nil {
+				// retried by the plugin
+				return err
+			}
+		}
+	}
+
+	if result.RequeueAfter > 0 && a.requeue != nil {
+		a.requeue(lb, result.RequeueAfter)
+	}
+	return result.Err
+}
+
+var (
+	aggregatorLock sync.RWMutex
+	aggregator     *Aggregator
+)
+
+// SetAggregator sets the aggregator of the results reported by plugins, it
+// is set once by the controller at startup
+func SetAggregator(a *Aggregator) {
+	aggregatorLock.Lock()
+	defer aggregatorLock.Unlock()
+	aggregator = a
+}
+
+// ReportResult reports the result of plugin on lb to the aggregator, and
+// returns the error the plugin should retry on
+func ReportResult(lb *netv1alpha1.LoadBalancer, result *Result) error {
+	aggregatorLock.RLock()
+	a := aggregator
+	aggregatorLock.RUnlock()
+	if a == nil {
+		log.Warn("No aggregator of plugin results is set, drop the result", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "plugin": result.Plugin})
+		return result.Err
+	}
+	return a.Apply(lb, result)
+}
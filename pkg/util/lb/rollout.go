@@ -0,0 +1,128 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	"strconv"
+	"time"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// PodUpdatedFunc returns a func telling whether a pod runs the latest template
+// of the workload. Pods of daemonset are labeled with the template generation,
+// while the template hash of the newest pod is taken as the latest one of
+// deployment, ds is nil for deployment
+func PodUpdatedFunc(ds *extensions.DaemonSet, pods []*v1.Pod) func(*v1.Pod) bool {
+	if ds != nil {
+		generation := strconv.FormatInt(ds.Spec.TemplateGeneration, 10)
+		return func(pod *v1.Pod) bool {
+			return pod.Labels[extensions.DaemonSetTemplateGenerationKey] == generation
+		}
+	}
+
+	var newest *v1.Pod
+	for _, pod := range pods {
+		if newest == nil || newest.CreationTimestamp.Before(pod.CreationTimestamp) {
+			newest = pod
+		}
+	}
+	hash := ""
+	if newest != nil {
+		hash = newest.Labels[extensions.DefaultDeploymentUniqueLabelKey]
+	}
+	return func(pod *v1.Pod) bool {
+		return pod.Labels[extensions.DefaultDeploymentUniqueLabelKey] == hash
+	}
+}
+
+// podReadyTime returns the last time pod became ready
+func podReadyTime(pod *v1.Pod) (time.Time, bool) {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodReady && c.Status == v1.ConditionTrue {
+			return c.LastTransitionTime.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ComputeRolloutStatus returns the progress of the rollout of pods, replicas is
+// the number of desired pods. Nil is returned if all the desired pods run the
+// latest template and are ready, and no outdated pod is left.
+//
+// The completion is estimated from the last time an updated pod became ready
+// by the average startup time of updated pods, so that it does not change
+// between syncs until another pod becomes ready
+func ComputeRolloutStatus(replicas int32, pods []*v1.Pod, updated func(*v1.Pod) bool) *netv1alpha1.RolloutStatus {
+	status := &netv1alpha1.RolloutStatus{
+		Replicas: replicas,
+	}
+
+	var start, lastReady time.Time
+	var startup time.Duration
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		status.TotalReplicas++
+		if !updated(pod) {
+			continue
+		}
+		status.UpdatedReplicas++
+		created := pod.CreationTimestamp.Time
+		if start.IsZero() || created.Before(start) {
+			start = created
+		}
+		readyTime, ready := podReadyTime(pod)
+		if !ready {
+			continue
+		}
+		status.ReadyReplicas++
+		if readyTime.After(created) {
+			startup += readyTime.Sub(created)
+		}
+		if readyTime.After(lastReady) {
+			lastReady = readyTime
+		}
+	}
+
+	if status.ReadyReplicas >= replicas && status.TotalReplicas == status.UpdatedReplicas {
+		return nil
+	}
+
+	if replicas > 0 {
+		ready := status.ReadyReplicas
+		if ready > replicas {
+			ready = replicas
+		}
+		status.Percentage = ready * 100 / replicas
+	}
+	if !start.IsZero() {
+		status.StartTime = &metav1.Time{Time: start}
+	}
+	if status.ReadyReplicas > 0 && status.ReadyReplicas < replicas {
+		average := startup / time.Duration(status.ReadyReplicas)
+		remaining := time.Duration(replicas - status.ReadyReplicas)
+		eta := lastReady.Add(remaining * average).Truncate(time.Second)
+		status.EstimatedCompletionTime = &metav1.Time{Time: eta}
+	}
+	return status
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	netclient "github.com/caicloud/loadbalancer-controller/pkg/tprclient/networking/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/util/errors"
+)
+
+// StatusApplyFunc merges the section of status owned by a writer into status,
+// e.g. ProxyStatus for proxy and ProvidersStatuses.Ipvsdr for ipvsdr provider.
+// It returns false if the section is not changed
+type StatusApplyFunc func(status *netv1alpha1.LoadBalancerStatus) bool
+
+// WriteStatus is the status writer shared by controller and plugins. The section
+// set by apply and the conditions are merged into the status of the latest
+// LoadBalancer, and written with its resource version. The write is retried
+// with the latest LoadBalancer on conflicts, so concurrent writers of different
+// sections never overwrite each other. Nothing is written if neither the section
+// nor the conditions are changed.
+// If a StatusWriter is set, the section and conditions are published to it as
+// a fragment and batched with the others of lb, see StatusWriter
+func WriteStatus(lbClient netclient.LoadBalancerInterface, lb *netv1alpha1.LoadBalancer, apply StatusApplyFunc, conditions ...netv1alpha1.LoadBalancerCondition) error {
+	if w := getStatusWriter(); w != nil {
+		return w.Publish(lb, apply, conditions...)
+	}
+
+	fragment := statusFragment{apply: apply, conditions: conditions}
+	// do not modify the status in cache
+	status, err := copyStatus(&lb.Status)
+	if err != nil {
+		return err
+	}
+	if !fragment.merge(status) {
+		return nil
+	}
+
+	_, err = UpdateLBWithRetries(lbClient, lb.Namespace, lb.Name, func(lb *netv1alpha1.LoadBalancer) error {
+		if !fragment.merge(&lb.Status) {
+			return errors.ErrPreconditionViolated
+		}
+		return nil
+	})
+	return err
+}
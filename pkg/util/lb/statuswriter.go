@@ -0,0 +1,296 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	"github.com/caicloud/loadbalancer-controller/pkg/metrics"
+	"github.com/caicloud/loadbalancer-controller/pkg/tprclient"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/kubernetes/pkg/client/retry"
+)
+
+// statusFragment is a section of status and conditions published by a writer
+type statusFragment struct {
+	apply      StatusApplyFunc
+	conditions []netv1alpha1.LoadBalancerCondition
+}
+
+// merge merges the fragment into status, and returns whether it is changed
+func (f statusFragment) merge(status *netv1alpha1.LoadBalancerStatus) bool {
+	changed := false
+	if f.apply != nil && f.apply(status) {
+		changed = true
+	}
+	for _, c := range f.conditions {
+		if SetCondition(status, c) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// StatusWriter batches the status fragments published by controller and
+// plugins. The fragments of a loadbalancer published within the delay are
+// merged in order into its latest status, and written by a single merge
+// patch with its resource version, which is retried on conflicts
+type StatusWriter struct {
+	client tprclient.Interface
+	delay  time.Duration
+	helper *controllerutil.Helper
+
+	lock sync.Mutex
+	// pending is the fragments waiting to be written, keyed by loadbalancer
+	pending map[string][]statusFragment
+	// writing is the loadbalancers whose fragments are being written
+	writing map[string]bool
+}
+
+// NewStatusWriter returns a status writer patching loadbalancers by client,
+// the fragments are written delay after the first one is published
+func NewStatusWriter(client tprclient.Interface, rateLimiter workqueue.RateLimiter, delay time.Duration) *StatusWriter {
+	w := &StatusWriter{
+		client:  client,
+		delay:   delay,
+		pending: make(map[string][]statusFragment),
+		writing: make(map[string]bool),
+	}
+	w.helper = controllerutil.NewHelper(&netv1alpha1.LoadBalancer{}, workqueue.NewNamedRateLimitingQueue(rateLimiter, "loadbalancer-status"), w.sync)
+	w.helper.Name = "loadbalancer-status"
+	return w
+}
+
+// Run starts workers to write status until stopCh is closed
+func (w *StatusWriter) Run(workers int, stopCh <-chan struct{}) {
+	w.helper.Run(workers, stopCh)
+}
+
+// ShutDown shuts down the queue and waits for the workers, the fragments
+// not written yet are dropped
+func (w *StatusWriter) ShutDown() {
+	w.helper.ShutDown()
+}
+
+// Publish queues the section set by apply and the conditions to be written to
+// lb. The fragment is dropped if it changes nothing and no earlier fragment
+// of lb is waiting, otherwise it must be applied after the earlier ones
+func (w *StatusWriter) Publish(lb *netv1alpha1.LoadBalancer, apply StatusApplyFunc, conditions ...netv1alpha1.LoadBalancerCondition) error {
+	key, err := controllerutil.KeyFunc(lb)
+	if err != nil {
+		return err
+	}
+	fragment := statusFragment{apply: apply, conditions: conditions}
+
+	w.lock.Lock()
+	if len(w.pending[key]) == 0 && !w.writing[key] {
+		// do not modify the status in cache
+		status, err := copyStatus(&lb.Status)
+		if err != nil {
+			w.lock.Unlock()
+			return err
+		}
+		if !fragment.merge(status) {
+			w.lock.Unlock()
+			return nil
+		}
+	}
+	w.pending[key] = append(w.pending[key], fragment)
+	w.lock.Unlock()
+
+	metrics.StatusWrites.Add("published", 1)
+	w.helper.EnqueueAfter(lb, w.delay)
+	return nil
+}
+
+// sync writes the pending fragments of the loadbalancer, they are put back
+// before the ones published meanwhile if the write fails
+func (w *StatusWriter) sync(obj interface{}) error {
+	key := obj.(string)
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	fragments := w.pending[key]
+	delete(w.pending, key)
+	w.writing[key] = true
+	w.lock.Unlock()
+
+	defer func() {
+		w.lock.Lock()
+		delete(w.writing, key)
+		w.lock.Unlock()
+	}()
+
+	if len(fragments) == 0 {
+		return nil
+	}
+
+	err = w.write(namespace, name, fragments)
+	if errors.IsNotFound(err) {
+		log.Debug("LoadBalancer is deleted, drop its status", log.Fields{"lb.ns": namespace, "lb.name": name, "fragments": len(fragments)})
+		return nil
+	}
+	if err != nil {
+		w.lock.Lock()
+		w.pending[key] = append(fragments, w.pending[key]...)
+		w.lock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// write merges fragments into the status of the latest loadbalancer and
+// patches it, nothing is written if the status is not changed
+func (w *StatusWriter) write(namespace, name string, fragments []statusFragment) error {
+	lbClient := w.client.NetworkingV1alpha1().LoadBalancers(namespace)
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		lb, err := lbClient.Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		status, err := copyStatus(&lb.Status)
+		if err != nil {
+			return err
+		}
+		changed := false
+		for _, f := range fragments {
+			if f.merge(status) {
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+
+		patch, err := statusPatch(lb, status)
+		if err != nil {
+			return err
+		}
+		_, err = lbClient.Patch(name, types.MergePatchType, patch)
+		if errors.IsConflict(err) {
+			metrics.StatusWrites.Add("conflicted", 1)
+		} else if err == nil {
+			metrics.StatusWrites.Add("patched", 1)
+		}
+		return err
+	})
+}
+
+// copyStatus returns a deep copy of status
+func copyStatus(status *netv1alpha1.LoadBalancerStatus) (*netv1alpha1.LoadBalancerStatus, error) {
+	copied, err := scheme.Scheme.DeepCopy(status)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := copied.(*netv1alpha1.LoadBalancerStatus)
+	if !ok {
+		return nil, fmt.Errorf("expected LoadBalancerStatus, got %T", copied)
+	}
+	return s, nil
+}
+
+// statusPatch returns the json merge patch from the status of lb to status,
+// the resource version of lb is a precondition of the patch
+func statusPatch(lb *netv1alpha1.LoadBalancer, status *netv1alpha1.LoadBalancerStatus) ([]byte, error) {
+	original, err := toJSONObject(lb.Status)
+	if err != nil {
+		return nil, err
+	}
+	modified, err := toJSONObject(status)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": lb.ResourceVersion,
+		},
+		"status": mergePatch(original, modified),
+	})
+}
+
+func toJSONObject(obj interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	object := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// mergePatch returns the json merge patch (RFC 7386) from original to
+// modified, the removed keys are set to null and lists are replaced
+func mergePatch(original, modified map[string]interface{}) map[string]interface{} {
+	patch := make(map[string]interface{})
+	for k := range original {
+		if _, ok := modified[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	for k, m := range modified {
+		o, ok := original[k]
+		if ok && reflect.DeepEqual(o, m) {
+			continue
+		}
+		om, oIsMap := o.(map[string]interface{})
+		mm, mIsMap := m.(map[string]interface{})
+		if ok && oIsMap && mIsMap {
+			patch[k] = mergePatch(om, mm)
+			continue
+		}
+		patch[k] = m
+	}
+	return patch
+}
+
+var (
+	statusWriterLock sync.RWMutex
+	statusWriter     *StatusWriter
+)
+
+// SetStatusWriter sets the writer batching the status published by WriteStatus,
+// it is set once by the controller at startup. The status is written at once
+// if no writer is set
+func SetStatusWriter(w *StatusWriter) {
+	statusWriterLock.Lock()
+	defer statusWriterLock.Unlock()
+	statusWriter = w
+}
+
+func getStatusWriter() *StatusWriter {
+	statusWriterLock.RLock()
+	defer statusWriterLock.RUnlock()
+	return statusWriter
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// rollingUpdate returns the max unavailable and surge of lb, the defaults
+// are filled in explicitly to avoid being recognized as changed after defaulting
+func rollingUpdate(lb *netv1alpha1.LoadBalancer) (*intstr.IntOrString, *intstr.IntOrString) {
+	maxUnavailable := intstr.FromInt(1)
+	maxSurge := intstr.FromInt(1)
+	if s := lb.Spec.UpdateStrategy; s != nil && s.RollingUpdate != nil {
+		if s.RollingUpdate.MaxUnavailable != nil {
+			maxUnavailable = *s.RollingUpdate.MaxUnavailable
+		}
+		if s.RollingUpdate.MaxSurge != nil {
+			maxSurge = *s.RollingUpdate.MaxSurge
+		}
+	}
+	return &maxUnavailable, &maxSurge
+}
+
+// DeploymentStrategy returns the strategy of deployments generated for lb
+func DeploymentStrategy(lb *netv1alpha1.LoadBalancer) extensions.DeploymentStrategy {
+	maxUnavailable, maxSurge := rollingUpdate(lb)
+	return extensions.DeploymentStrategy{
+		Type: extensions.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &extensions.RollingUpdateDeployment{
+			MaxUnavailable: maxUnavailable,
+			MaxSurge:       maxSurge,
+		},
+	}
+}
+
+// DaemonSetUpdateStrategy returns the update strategy of daemonsets generated for lb
+func DaemonSetUpdateStrategy(lb *netv1alpha1.LoadBalancer) extensions.DaemonSetUpdateStrategy {
+	if s := lb.Spec.UpdateStrategy; s != nil && s.Type == netv1alpha1.UpdateStrategyOnDelete {
+		return extensions.DaemonSetUpdateStrategy{
+			Type: extensions.OnDeleteDaemonSetStrategyType,
+		}
+	}
+	maxUnavailable, _ := rollingUpdate(lb)
+	return extensions.DaemonSetUpdateStrategy{
+		Type: extensions.RollingUpdateDaemonSetStrategyType,
+		RollingUpdate: &extensions.RollingUpdateDaemonSet{
+			MaxUnavailable: maxUnavailable,
+		},
+	}
+}
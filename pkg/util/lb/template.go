@@ -0,0 +1,119 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lb
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/toleration"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Tolerations returns the tolerations of loadbalancer taints with the ones in lb template
+func Tolerations(lb *netv1alpha1.LoadBalancer) []v1.Toleration {
+	tolerations := toleration.GenerateTolerations()
+	if lb.Spec.Template != nil {
+		tolerations = append(tolerations, lb.Spec.Template.Tolerations...)
+	}
+	return tolerations
+}
+
+// NodeSelector returns the node selector in lb template
+func NodeSelector(lb *netv1alpha1.LoadBalancer) map[string]string {
+	if lb.Spec.Template == nil || len(lb.Spec.Template.NodeSelector) == 0 {
+		return nil
+	}
+	return lb.Spec.Template.NodeSelector
+}
+
+// MergeAffinity merges the affinity in lb template into the generated one.
+// The required node selector terms are ORed by scheduler, so each of the terms
+// in template is combined with the generated terms to keep pods on the nodes of lb
+func MergeAffinity(lb *netv1alpha1.LoadBalancer, affinity *v1.Affinity) *v1.Affinity {
+	if lb.Spec.Template == nil || lb.Spec.Template.Affinity == nil {
+		return affinity
+	}
+	extra := lb.Spec.Template.Affinity
+	if affinity == nil {
+		affinity = &v1.Affinity{}
+	}
+
+	if extra.NodeAffinity != nil {
+		affinity.NodeAffinity = mergeNodeAffinity(affinity.NodeAffinity, extra.NodeAffinity)
+	}
+
+	if extra.PodAffinity != nil {
+		if affinity.PodAffinity == nil {
+			affinity.PodAffinity = &v1.PodAffinity{}
+		}
+		affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+			affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+			extra.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution...,
+		)
+		affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+			affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+			extra.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution...,
+		)
+	}
+
+	if extra.PodAntiAffinity != nil {
+		if affinity.PodAntiAffinity == nil {
+			affinity.PodAntiAffinity = &v1.PodAntiAffinity{}
+		}
+		affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+			affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+			extra.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution...,
+		)
+		affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+			affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+			extra.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution...,
+		)
+	}
+
+	return affinity
+}
+
+func mergeNodeAffinity(generated, extra *v1.NodeAffinity) *v1.NodeAffinity {
+	if generated == nil {
+		generated = &v1.NodeAffinity{}
+	}
+	generated.PreferredDuringSchedulingIgnoredDuringExecution = append(
+		generated.PreferredDuringSchedulingIgnoredDuringExecution,
+		extra.PreferredDuringSchedulingIgnoredDuringExecution...,
+	)
+
+	required := extra.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) == 0 {
+		return generated
+	}
+	if generated.RequiredDuringSchedulingIgnoredDuringExecution == nil || len(generated.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms) == 0 {
+		generated.RequiredDuringSchedulingIgnoredDuringExecution = required
+		return generated
+	}
+
+	terms := make([]v1.NodeSelectorTerm, 0)
+	for _, g := range generated.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		for _, e := range required.NodeSelectorTerms {
+			expressions := make([]v1.NodeSelectorRequirement, 0, len(g.MatchExpressions)+len(e.MatchExpressions))
+			expressions = append(expressions, g.MatchExpressions...)
+			expressions = append(expressions, e.MatchExpressions...)
+			terms = append(terms, v1.NodeSelectorTerm{MatchExpressions: expressions})
+		}
+	}
+	generated.RequiredDuringSchedulingIgnoredDuringExecution = &v1.NodeSelector{NodeSelectorTerms: terms}
+	return generated
+}
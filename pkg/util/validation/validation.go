@@ -19,8 +19,14 @@ package validation
 import (
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 
 	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	stringsutil "github.com/caicloud/loadbalancer-controller/pkg/util/strings"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	apiv1 "k8s.io/client-go/pkg/api/v1"
 )
 
 // ValidateLoadBalancer validate loadbalancer
@@ -31,6 +37,102 @@ func ValidateLoadBalancer(lb *netv1alpha1.LoadBalancer) error {
 	// 	return fmt.Errorf("both replicas and nodes are not fill in")
 	// }
 
+	if err := validateNodes(lb.Spec.Nodes); err != nil {
+		return err
+	}
+
+	if err := validateAutoscaling(lb.Spec); err != nil {
+		return err
+	}
+
+	if err := validateDeployMode(lb.Spec); err != nil {
+		return err
+	}
+
+	if err := validateUpdateStrategy(lb.Spec); err != nil {
+		return err
+	}
+
+	if t := lb.Spec.Template; t != nil && t.PriorityClassName != "" {
+		if errs := validation.IsDNS1123Subdomain(t.PriorityClassName); len(errs) != 0 {
+			return fmt.Errorf("template: priority class %v is invalid: %s", t.PriorityClassName, strings.Join(errs, ", "))
+		}
+	}
+
+	if err := validateL4Rules("tcpRules", lb.Spec.TCPRules); err != nil {
+		return err
+	}
+
+	if err := validateL4Rules("udpRules", lb.Spec.UDPRules); err != nil {
+		return err
+	}
+
+	if err := validateNetworkMode("proxy", lb.Spec.Proxy.NetworkMode); err != nil {
+		return err
+	}
+
+	if err := validateProxySecurityContext(lb.Spec); err != nil {
+		return err
+	}
+
+	if class := lb.Spec.Proxy.IngressClass; class != "" {
+		if errs := validation.IsDNS1123Subdomain(class); len(errs) != 0 {
+			return fmt.Errorf("proxy: ingress class %v is invalid: %s", class, strings.Join(errs, ", "))
+		}
+	}
+
+	if err := validateProxyTLS(lb.Spec.Proxy.TLS); err != nil {
+		return err
+	}
+
+	switch lb.Spec.Proxy.Profile {
+	case "", netv1alpha1.ProxyProfileSmall, netv1alpha1.ProxyProfileStandard,
+		netv1alpha1.ProxyProfileLargeUploads, netv1alpha1.ProxyProfileWebsockets:
+	default:
+		return fmt.Errorf("proxy: profile %v is invalid", lb.Spec.Proxy.Profile)
+	}
+
+	if err := validateProxyLogging(lb.Spec.Proxy.Logging); err != nil {
+		return err
+	}
+
+	if err := validateProxyBlueGreen(lb.Spec); err != nil {
+		return err
+	}
+
+	if err := validateProxyAccessControl(lb.Spec.Proxy.AccessControl); err != nil {
+		return err
+	}
+
+	if waf := lb.Spec.Proxy.WAF; waf != nil {
+		switch waf.Mode {
+		case "", netv1alpha1.ProxyWAFModeOn, netv1alpha1.ProxyWAFModeDetectionOnly:
+		default:
+			return fmt.Errorf("proxy: waf mode %v is invalid", waf.Mode)
+		}
+		if waf.RulesConfigMap != "" {
+			if errs := validation.IsDNS1123Subdomain(waf.RulesConfigMap); len(errs) != 0 {
+				return fmt.Errorf("proxy: waf rules configmap %v is invalid: %s", waf.RulesConfigMap, strings.Join(errs, ", "))
+			}
+		}
+	}
+
+	if limits := lb.Spec.Proxy.Limits; limits != nil {
+		if limits.RequestsPerSecond < 0 || limits.Burst < 0 || limits.Connections < 0 {
+			return fmt.Errorf("proxy: limits must not be negative")
+		}
+		if limits.Burst > 0 && limits.RequestsPerSecond == 0 {
+			return fmt.Errorf("proxy: limits: burst requires requestsPerSecond")
+		}
+	}
+
+	switch lb.Spec.Proxy.SessionAffinity {
+	case "", netv1alpha1.ProxySessionAffinityNone, netv1alpha1.ProxySessionAffinityCookie,
+		netv1alpha1.ProxySessionAffinitySourceIP:
+	default:
+		return fmt.Errorf("proxy: session affinity %v is invalid", lb.Spec.Proxy.SessionAffinity)
+	}
+
 	switch lbType {
 	case netv1alpha1.LoadBalancerTypeInternal:
 		// internal lb must set service provider
@@ -40,9 +142,12 @@ func ValidateLoadBalancer(lb *netv1alpha1.LoadBalancer) error {
 	case netv1alpha1.LoadBalancerTypeExternal:
 		if lb.Spec.Providers.Ipvsdr != nil {
 			ipvsdr := lb.Spec.Providers.Ipvsdr
-			if net.ParseIP(ipvsdr.Vip) == nil {
+			if ipvsdr.Vip != "" && net.ParseIP(ipvsdr.Vip) == nil {
 				return fmt.Errorf("ipvsdr: vip is invalid")
 			}
+			if err := validateIpvsdrVips(ipvsdr.Vip, ipvsdr.Vips); err != nil {
+				return err
+			}
 			switch ipvsdr.Scheduler {
 			case netv1alpha1.IpvsSchedulerRR:
 			case netv1alpha1.IpvsSchedulerWRR:
@@ -55,6 +160,39 @@ func ValidateLoadBalancer(lb *netv1alpha1.LoadBalancer) error {
 			default:
 				return fmt.Errorf("ipvsdr: scheduler %v is invalid", ipvsdr.Scheduler)
 			}
+			if err := validateIpvsdrPorts(ipvsdr.Ports); err != nil {
+				return err
+			}
+			if err := validateIpvsParameters(ipvsdr.IPVS); err != nil {
+				return err
+			}
+			if err := validateVRRPParameters(ipvsdr.VRRP); err != nil {
+				return err
+			}
+			if ipvsdr.DSCP != nil && (*ipvsdr.DSCP < 0 || *ipvsdr.DSCP > maxDSCP) {
+				return fmt.Errorf("ipvsdr: dscp %v is out of range [0, %d]", *ipvsdr.DSCP, maxDSCP)
+			}
+			if err := validateNetworkMode("ipvsdr", ipvsdr.NetworkMode); err != nil {
+				return err
+			}
+			if err := ValidateDataplaneBackend(ipvsdr.DataplaneBackend); err != nil {
+				return fmt.Errorf("ipvsdr: %v", err)
+			}
+			if ipvsdr.NetworkMode == netv1alpha1.NetworkModePod {
+				return fmt.Errorf("ipvsdr: provider must run in host network to serve the vip")
+			}
+			if ipvsdr.Shared && len(ipvsdr.Ports) == 0 {
+				return fmt.Errorf("ipvsdr: ports must be set to share the vip")
+			}
+			if err := validateProviderQoS(ipvsdr.QoS, ipvsdr.Resources); err != nil {
+				return err
+			}
+			if err := validateIpvsdrMetrics(ipvsdr.Metrics, ipvsdr.Ports); err != nil {
+				return err
+			}
+		}
+		if external := lb.Spec.Providers.External; external != nil && external.Name == "" {
+			return fmt.Errorf("external: name must be set")
 		}
 	default:
 		return fmt.Errorf("Unknown loadbalancer type %v", lbType)
@@ -62,3 +200,523 @@ func ValidateLoadBalancer(lb *netv1alpha1.LoadBalancer) error {
 
 	return nil
 }
+
+func validateProxyAccessControl(ac *netv1alpha1.ProxyAccessControl) error {
+	if ac == nil {
+		return nil
+	}
+	for _, cidr := range append(append([]string{}, ac.Allow...), ac.Deny...) {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("proxy: access control: %v", err)
+		}
+	}
+	for _, country := range append(append([]string{}, ac.AllowCountries...), ac.DenyCountries...) {
+		if !isCountryCode(country) {
+			return fmt.Errorf("proxy: access control: country %v is not an ISO 3166 alpha-2 code", country)
+		}
+	}
+	for _, country := range ac.AllowCountries {
+		if stringsutil.StringInSlice(country, ac.DenyCountries) {
+			return fmt.Errorf("proxy: access control: country %v is both allowed and denied", country)
+		}
+	}
+	return nil
+}
+
+// isCountryCode returns true if code is two upper case letters
+func isCountryCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// validateProxyBlueGreen validates that the green nodes are a proper subset of
+// the names of nodes, so that both proxies have nodes to run on
+func validateProxyBlueGreen(spec netv1alpha1.LoadBalancerSpec) error {
+	blueGreen := spec.Proxy.BlueGreen
+	if blueGreen == nil {
+		return nil
+	}
+	switch blueGreen.Active {
+	case "", netv1alpha1.ProxyColorBlue, netv1alpha1.ProxyColorGreen:
+	default:
+		return fmt.Errorf("proxy: blueGreen: active %v is invalid", blueGreen.Active)
+	}
+	if spec.DeployMode == netv1alpha1.DeployModeDaemonSet {
+		return fmt.Errorf("proxy: blueGreen is not supported in DaemonSet mode")
+	}
+	if spec.Autoscaling != nil {
+		return fmt.Errorf("proxy: blueGreen can not be used with autoscaling")
+	}
+	if len(spec.Nodes.Names) == 0 {
+		return fmt.Errorf("proxy: blueGreen requires names of nodes")
+	}
+	if len(blueGreen.Green.Nodes) == 0 {
+		return fmt.Errorf("proxy: blueGreen: green nodes are empty")
+	}
+	seen := make(map[string]bool, len(blueGreen.Green.Nodes))
+	for _, name := range blueGreen.Green.Nodes {
+		if !stringsutil.StringInSlice(name, spec.Nodes.Names) {
+			return fmt.Errorf("proxy: blueGreen: green node %v is not in names", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("proxy: blueGreen: green node %v is duplicated", name)
+		}
+		seen[name] = true
+	}
+	if len(seen) == len(spec.Nodes.Names) {
+		return fmt.Errorf("proxy: blueGreen: no node is left for blue proxy")
+	}
+	return nil
+}
+
+func validateProxyLogging(logging *netv1alpha1.ProxyLogging) error {
+	if logging == nil {
+		return nil
+	}
+	switch logging.Format {
+	case "", netv1alpha1.ProxyLogFormatText, netv1alpha1.ProxyLogFormatJSON:
+	default:
+		return fmt.Errorf("proxy: log format %v is invalid", logging.Format)
+	}
+	if dest := logging.Destination; dest != "" && dest != "stdout" {
+		if !strings.HasPrefix(dest, "syslog://") {
+			return fmt.Errorf("proxy: log destination %v must be stdout or syslog://host:port", dest)
+		}
+		host, port, err := net.SplitHostPort(strings.TrimPrefix(dest, "syslog://"))
+		if err != nil || host == "" {
+			return fmt.Errorf("proxy: log destination %v must be stdout or syslog://host:port", dest)
+		}
+		if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+			return fmt.Errorf("proxy: port of log destination %v is invalid", dest)
+		}
+	}
+	if rate := logging.SamplingRate; rate != nil && (*rate < 1 || *rate > 100) {
+		return fmt.Errorf("proxy: log sampling rate %v is out of range [1, 100]", *rate)
+	}
+	switch logging.ErrorLogLevel {
+	case "", "debug", "info", "notice", "warn", "error", "crit":
+	default:
+		return fmt.Errorf("proxy: error log level %v is invalid", logging.ErrorLogLevel)
+	}
+	return nil
+}
+
+func validateProxyTLS(certs []netv1alpha1.ProxyTLS) error {
+	defaults := 0
+	refs := make(map[string]bool, len(certs))
+	for _, cert := range certs {
+		if (cert.SecretName == "") == (cert.Certificate == "") {
+			return fmt.Errorf("proxy: tls must set exactly one of secretName and certificate")
+		}
+		ref := "secret/" + cert.SecretName
+		name := cert.SecretName
+		if cert.Certificate != "" {
+			ref = "certificate/" + cert.Certificate
+			name = cert.Certificate
+		}
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) != 0 {
+			return fmt.Errorf("proxy: tls %v is invalid: %s", ref, strings.Join(errs, ", "))
+		}
+		if refs[ref] {
+			return fmt.Errorf("proxy: tls %v is duplicated", ref)
+		}
+		refs[ref] = true
+		if cert.Default {
+			defaults++
+		}
+	}
+	if defaults > 1 {
+		return fmt.Errorf("proxy: at most one tls certificate is default")
+	}
+	return nil
+}
+
+// validateProxySecurityContext rejects a non-root proxy which can not bind
+// the privileged ports it listens on, http and https are always listened
+func validateProxySecurityContext(spec netv1alpha1.LoadBalancerSpec) error {
+	sc := spec.Proxy.SecurityContext
+	if sc == nil {
+		return nil
+	}
+	if sc.RunAsUser != nil && *sc.RunAsUser < 0 {
+		return fmt.Errorf("proxy: runAsUser must be non-negative")
+	}
+	if !sc.RunAsNonRoot {
+		return nil
+	}
+	if sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+		return fmt.Errorf("proxy: runAsUser can not be 0 with runAsNonRoot")
+	}
+	if sc.NetBindService != nil && !*sc.NetBindService {
+		ports := []int32{80, 443}
+		for _, rule := range spec.TCPRules {
+			ports = append(ports, rule.Port)
+		}
+		for _, rule := range spec.UDPRules {
+			ports = append(ports, rule.Port)
+		}
+		for _, port := range ports {
+			if port < 1024 {
+				return fmt.Errorf("proxy: port %d below 1024 can not be listened by non-root proxy without netBindService", port)
+			}
+		}
+	}
+	return nil
+}
+
+func validateNetworkMode(component string, mode netv1alpha1.NetworkMode) error {
+	switch mode {
+	case "", netv1alpha1.NetworkModeHost, netv1alpha1.NetworkModePod:
+		return nil
+	default:
+		return fmt.Errorf("%s: network mode %v is invalid", component, mode)
+	}
+}
+
+// ValidateDataplaneBackend validates the dataplane backend of ipvsdr provider,
+// empty is valid and means the default
+func ValidateDataplaneBackend(backend netv1alpha1.DataplaneBackend) error {
+	switch backend {
+	case "", netv1alpha1.DataplaneBackendAuto, netv1alpha1.DataplaneBackendIPTables, netv1alpha1.DataplaneBackendNFTables:
+		return nil
+	default:
+		return fmt.Errorf("dataplane backend %v is invalid", backend)
+	}
+}
+
+func validateNodes(nodes netv1alpha1.NodesSpec) error {
+	if len(nodes.Names) != 0 && len(nodes.Selector) != 0 {
+		return fmt.Errorf("nodes: names and selector can not be used at the same time")
+	}
+	if len(nodes.Selector) != 0 && nodes.Replicas != nil && *nodes.Replicas < 1 {
+		return fmt.Errorf("nodes: replicas must be greater than 0 with selector")
+	}
+	for _, name := range nodes.Maintenance {
+		if !stringsutil.StringInSlice(name, nodes.Names) {
+			return fmt.Errorf("nodes: maintenance node %v is not in names", name)
+		}
+	}
+	for _, name := range nodes.Standby {
+		if stringsutil.StringInSlice(name, nodes.Names) {
+			return fmt.Errorf("nodes: standby node %v is already in names", name)
+		}
+	}
+	for name, weight := range nodes.Weights {
+		if err := ValidateNodeWeight(int64(weight)); err != nil {
+			return fmt.Errorf("nodes: node %v: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// maxNodeWeight is the largest weight of an IPVS real server
+const maxNodeWeight = 65535
+
+// ValidateNodeWeight validates the weight of node as real server, 0 is valid
+// and means the node is drained
+func ValidateNodeWeight(weight int64) error {
+	if weight < 0 || weight > maxNodeWeight {
+		return fmt.Errorf("weight %v is out of range [0, %d]", weight, maxNodeWeight)
+	}
+	return nil
+}
+
+func validateAutoscaling(spec netv1alpha1.LoadBalancerSpec) error {
+	autoscaling := spec.Autoscaling
+	if autoscaling == nil {
+		return nil
+	}
+	if autoscaling.MaxReplicas < 1 {
+		return fmt.Errorf("autoscaling: maxReplicas must be greater than 0")
+	}
+	if autoscaling.MinReplicas != nil && (*autoscaling.MinReplicas < 1 || *autoscaling.MinReplicas > autoscaling.MaxReplicas) {
+		return fmt.Errorf("autoscaling: minReplicas must be between 1 and maxReplicas")
+	}
+	if len(spec.Nodes.Names) != 0 && int(autoscaling.MaxReplicas) > len(spec.Nodes.Names) {
+		return fmt.Errorf("autoscaling: maxReplicas %v exceeds the number of nodes", autoscaling.MaxReplicas)
+	}
+	if autoscaling.Metric.TargetAverage <= 0 {
+		return fmt.Errorf("autoscaling: targetAverage must be greater than 0")
+	}
+	switch autoscaling.Metric.Type {
+	case netv1alpha1.AutoscalingMetricCPU:
+		_, hasRequest := spec.Proxy.Resources.Requests[apiv1.ResourceCPU]
+		_, hasLimit := spec.Proxy.Resources.Limits[apiv1.ResourceCPU]
+		if !hasRequest && !hasLimit {
+			return fmt.Errorf("autoscaling: cpu metric requires cpu resource of proxy")
+		}
+	case netv1alpha1.AutoscalingMetricConnections:
+	default:
+		return fmt.Errorf("autoscaling: metric type %v is invalid", autoscaling.Metric.Type)
+	}
+	return nil
+}
+
+func validateDeployMode(spec netv1alpha1.LoadBalancerSpec) error {
+	switch spec.DeployMode {
+	case "", netv1alpha1.DeployModeDeployment:
+		return nil
+	case netv1alpha1.DeployModeDaemonSet:
+	default:
+		return fmt.Errorf("deployMode %v is invalid", spec.DeployMode)
+	}
+	// daemonset runs on all the labeled nodes, they must be chosen
+	if len(spec.Nodes.Names) == 0 && len(spec.Nodes.Selector) == 0 {
+		return fmt.Errorf("deployMode: %v requires nodes names or selector", spec.DeployMode)
+	}
+	if spec.Autoscaling != nil {
+		return fmt.Errorf("deployMode: autoscaling is not supported by %v", spec.DeployMode)
+	}
+	return nil
+}
+
+func validateUpdateStrategy(spec netv1alpha1.LoadBalancerSpec) error {
+	strategy := spec.UpdateStrategy
+	if strategy == nil {
+		return nil
+	}
+	switch strategy.Type {
+	case "", netv1alpha1.UpdateStrategyRollingUpdate:
+	case netv1alpha1.UpdateStrategyOnDelete:
+		if spec.DeployMode != netv1alpha1.DeployModeDaemonSet {
+			return fmt.Errorf("updateStrategy: %v is only supported in %v mode", strategy.Type, netv1alpha1.DeployModeDaemonSet)
+		}
+		return nil
+	default:
+		return fmt.Errorf("updateStrategy: type %v is invalid", strategy.Type)
+	}
+	if strategy.RollingUpdate == nil {
+		return nil
+	}
+	for name, value := range map[string]*intstr.IntOrString{
+		"maxUnavailable": strategy.RollingUpdate.MaxUnavailable,
+		"maxSurge":       strategy.RollingUpdate.MaxSurge,
+	} {
+		if value == nil {
+			continue
+		}
+		if value.Type == intstr.Int && value.IntVal < 0 {
+			return fmt.Errorf("updateStrategy: %v must be non-negative", name)
+		}
+		if value.Type == intstr.String {
+			if _, err := strconv.Atoi(strings.TrimSuffix(value.StrVal, "%")); err != nil || !strings.HasSuffix(value.StrVal, "%") {
+				return fmt.Errorf("updateStrategy: %v %q is not a number or percentage", name, value.StrVal)
+			}
+		}
+	}
+	return nil
+}
+
+func validateProviderQoS(qos *netv1alpha1.ProviderQoS, resources apiv1.ResourceRequirements) error {
+	if qos == nil {
+		return nil
+	}
+	if qos.CPUPinning && !qos.Guaranteed {
+		return fmt.Errorf("ipvsdr: cpu pinning requires guaranteed qos")
+	}
+	if !qos.Guaranteed || (len(resources.Limits) == 0 && len(resources.Requests) == 0) {
+		// default resources are used
+		return nil
+	}
+	for _, name := range []apiv1.ResourceName{apiv1.ResourceCPU, apiv1.ResourceMemory} {
+		limit, hasLimit := resources.Limits[name]
+		request, hasRequest := resources.Requests[name]
+		if !hasLimit && !hasRequest {
+			return fmt.Errorf("ipvsdr: guaranteed qos requires %v resource", name)
+		}
+		if hasLimit && hasRequest && limit.Cmp(request) != 0 {
+			return fmt.Errorf("ipvsdr: guaranteed qos requires %v requests equal to limits", name)
+		}
+	}
+	if qos.CPUPinning {
+		cpu, ok := resources.Limits[apiv1.ResourceCPU]
+		if !ok {
+			cpu = resources.Requests[apiv1.ResourceCPU]
+		}
+		if cpu.MilliValue()%1000 != 0 {
+			return fmt.Errorf("ipvsdr: cpu pinning requires integral cpu, got %v", cpu.String())
+		}
+	}
+	return nil
+}
+
+func validateL4Rules(field string, rules []netv1alpha1.L4Rule) error {
+	seen := make(map[int32]bool)
+	for _, rule := range rules {
+		if rule.Port <= 0 || rule.Port > 65535 {
+			return fmt.Errorf("%s: port %v is invalid", field, rule.Port)
+		}
+		if rule.Port == 80 || rule.Port == 443 {
+			return fmt.Errorf("%s: port %v is reserved by http and https", field, rule.Port)
+		}
+		if seen[rule.Port] {
+			return fmt.Errorf("%s: port %v is duplicated", field, rule.Port)
+		}
+		seen[rule.Port] = true
+		if rule.ServiceName == "" {
+			return fmt.Errorf("%s: service of port %v is empty", field, rule.Port)
+		}
+		if rule.ServicePort.String() == "" || rule.ServicePort.String() == "0" {
+			return fmt.Errorf("%s: service port of port %v is empty", field, rule.Port)
+		}
+	}
+	return nil
+}
+
+func validateIpvsdrVips(vip string, vips []string) error {
+	seen := map[string]bool{vip: true}
+	for _, v := range vips {
+		if net.ParseIP(v) == nil {
+			return fmt.Errorf("ipvsdr: vip %v is invalid", v)
+		}
+		if seen[v] {
+			return fmt.Errorf("ipvsdr: vip %v is duplicated", v)
+		}
+		seen[v] = true
+	}
+	return nil
+}
+
+// maxPersistenceTimeout is the max persistence timeout accepted by ipvs
+const maxPersistenceTimeout = 2678400
+
+func validateIpvsParameters(params *netv1alpha1.IpvsParameters) error {
+	if params == nil {
+		return nil
+	}
+	if params.PersistenceTimeout < 0 || params.PersistenceTimeout > maxPersistenceTimeout {
+		return fmt.Errorf("ipvsdr: persistence timeout %v is out of range [0, %d]", params.PersistenceTimeout, maxPersistenceTimeout)
+	}
+	if params.TCPTimeout < 0 || params.TCPFinTimeout < 0 || params.UDPTimeout < 0 {
+		return fmt.Errorf("ipvsdr: ipvs timeouts must not be negative")
+	}
+	if params.MaxConnections < 0 {
+		return fmt.Errorf("ipvsdr: ipvs max connections must not be negative")
+	}
+	return nil
+}
+
+// The ranges of VRRP parameters, an interval shorter than 50ms floods the
+// network with adverts and a longer one than 10s makes failover meaningless
+const (
+	minAdvertInterval = 50
+	maxAdvertInterval = 10000
+	maxFallRise       = 10
+)
+
+// maxDSCP is the largest differentiated services code point of 6 bits
+const maxDSCP = 63
+
+func validateVRRPParameters(params *netv1alpha1.VRRPParameters) error {
+	if params == nil {
+		return nil
+	}
+	if i := params.AdvertInterval; i != 0 && (i < minAdvertInterval || i > maxAdvertInterval || i%10 != 0) {
+		return fmt.Errorf("ipvsdr: vrrp advert interval %vms must be a multiple of 10 in [%d, %d]", i, minAdvertInterval, maxAdvertInterval)
+	}
+	if params.Fall < 0 || params.Fall > maxFallRise {
+		return fmt.Errorf("ipvsdr: vrrp fall %v is out of range [0, %d]", params.Fall, maxFallRise)
+	}
+	if params.Rise < 0 || params.Rise > maxFallRise {
+		return fmt.Errorf("ipvsdr: vrrp rise %v is out of range [0, %d]", params.Rise, maxFallRise)
+	}
+	return nil
+}
+
+func validateIpvsdrMetrics(metrics *netv1alpha1.IpvsdrMetrics, ports []netv1alpha1.IpvsdrPort) error {
+	if metrics == nil || metrics.Port == 0 {
+		return nil
+	}
+	if metrics.Port < 0 || metrics.Port > 65535 {
+		return fmt.Errorf("ipvsdr: metrics port %v is invalid", metrics.Port)
+	}
+	// the exporter listens on all addresses of node including the vips
+	for _, port := range ports {
+		if IpvsdrPortsOverlap(port, netv1alpha1.IpvsdrPort{Port: metrics.Port, Protocol: apiv1.ProtocolTCP}) {
+			return fmt.Errorf("ipvsdr: metrics port %v overlaps with port %v", metrics.Port, port.Port)
+		}
+	}
+	return nil
+}
+
+func validateIpvsdrPorts(ports []netv1alpha1.IpvsdrPort) error {
+	var seen []netv1alpha1.IpvsdrPort
+	for _, port := range ports {
+		if port.Port <= 0 || port.Port > 65535 {
+			return fmt.Errorf("ipvsdr: port %v is invalid", port.Port)
+		}
+		if port.EndPort != 0 {
+			if port.EndPort <= port.Port || port.EndPort > 65535 {
+				return fmt.Errorf("ipvsdr: end port %v of port %v is invalid", port.EndPort, port.Port)
+			}
+			if port.HealthCheck != nil || port.Backend != nil {
+				return fmt.Errorf("ipvsdr: health check and backend are not supported by port range %v-%v", port.Port, port.EndPort)
+			}
+		}
+		switch port.Protocol {
+		case "", apiv1.ProtocolTCP, apiv1.ProtocolUDP:
+		default:
+			return fmt.Errorf("ipvsdr: protocol %v of port %v is invalid", port.Protocol, port.Port)
+		}
+		if port.Backend != nil {
+			if port.Backend.ServiceName == "" {
+				return fmt.Errorf("ipvsdr: backend service of port %v is empty", port.Port)
+			}
+			if port.Backend.ServicePort.String() == "" || port.Backend.ServicePort.String() == "0" {
+				return fmt.Errorf("ipvsdr: backend service port of port %v is empty", port.Port)
+			}
+		}
+		for _, other := range seen {
+			if IpvsdrPortsOverlap(port, other) {
+				return fmt.Errorf("ipvsdr: port %v overlaps with port %v", port.Port, other.Port)
+			}
+		}
+		seen = append(seen, port)
+
+		check := port.HealthCheck
+		if check == nil {
+			continue
+		}
+		switch check.Type {
+		case netv1alpha1.HealthCheckTypeTCP:
+		case netv1alpha1.HealthCheckTypeHTTP:
+			if port.Protocol == apiv1.ProtocolUDP {
+				return fmt.Errorf("ipvsdr: http health check is not supported by udp port %v", port.Port)
+			}
+			if check.StatusCode != 0 && (check.StatusCode < 100 || check.StatusCode > 599) {
+				return fmt.Errorf("ipvsdr: health check status code %v of port %v is invalid", check.StatusCode, port.Port)
+			}
+		default:
+			return fmt.Errorf("ipvsdr: health check type %v of port %v is invalid", check.Type, port.Port)
+		}
+		if check.TimeoutSeconds < 0 || check.Retry < 0 || check.DelayBeforeRetrySeconds < 0 {
+			return fmt.Errorf("ipvsdr: health check of port %v must not be negative", port.Port)
+		}
+	}
+	return nil
+}
+
+// IpvsdrPortsOverlap returns true if the ports or port ranges of the same
+// protocol overlap, an empty protocol is TCP
+func IpvsdrPortsOverlap(a, b netv1alpha1.IpvsdrPort) bool {
+	protocol := func(p netv1alpha1.IpvsdrPort) apiv1.Protocol {
+		if p.Protocol == "" {
+			return apiv1.ProtocolTCP
+		}
+		return p.Protocol
+	}
+	end := func(p netv1alpha1.IpvsdrPort) int32 {
+		if p.EndPort == 0 {
+			return p.Port
+		}
+		return p.EndPort
+	}
+	return protocol(a) == protocol(b) && a.Port <= end(b) && b.Port <= end(a)
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package provider
 
 import (
+	"fmt"
+
 	"github.com/caicloud/loadbalancer-controller/config"
 	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
 	"github.com/caicloud/loadbalancer-controller/pkg/informers"
@@ -32,6 +34,8 @@ type Plugin interface {
 	Init(config.Configuration, informers.SharedInformerFactory)
 	Run(stopCh <-chan struct{})
 	OnSync(*netv1alpha1.LoadBalancer)
+	// ForceResync re-reconciles the loadbalancer even if nothing is changed
+	ForceResync(namespace, name string) error
 }
 
 // RegisterPlugin registers a Plugin by name.
@@ -60,6 +64,26 @@ func Plugins() []string {
 	return plugins.Keys()
 }
 
+// ConfigValidator is implemented by plugins which validate their sections
+// of configuration at startup
+type ConfigValidator interface {
+	ValidateConfig(config.Configuration) error
+}
+
+// ValidateConfig validates configuration by all registered provider plugins
+func ValidateConfig(c config.Configuration) error {
+	for name, v := range plugins.Iter() {
+		validator, ok := v.(ConfigValidator)
+		if !ok {
+			continue
+		}
+		if err := validator.ValidateConfig(c); err != nil {
+			return fmt.Errorf("provider %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
 // Init calls all registered provider plugins Init func
 func Init(c config.Configuration, sif informers.SharedInformerFactory) {
 	for _, v := range plugins.Iter() {
@@ -84,3 +108,14 @@ func OnSync(lb *netv1alpha1.LoadBalancer) {
 		f.OnSync(lb)
 	}
 }
+
+// ForceResync calls all registered provider plugins ForceResync func
+func ForceResync(namespace, name string) error {
+	for pname, v := range plugins.Iter() {
+		f := v.(Plugin)
+		if err := f.ForceResync(namespace, name); err != nil {
+			return fmt.Errorf("provider %s: %v", pname, err)
+		}
+	}
+	return nil
+}
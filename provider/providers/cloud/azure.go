@@ -0,0 +1,80 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"github.com/caicloud/loadbalancer-controller/config"
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/provider"
+)
+
+const (
+	azureProviderName = "azure"
+
+	azureAnnotationInternal      = "service.beta.kubernetes.io/azure-load-balancer-internal"
+	azureAnnotationResourceGroup = "service.beta.kubernetes.io/azure-load-balancer-resource-group"
+)
+
+func init() {
+	provider.RegisterPlugin(azureProviderName, NewAzure())
+}
+
+// NewAzure creates a new azure provider plugin
+func NewAzure() provider.Plugin {
+	return newCloudProvider(&azure{})
+}
+
+type azure struct{}
+
+func (c *azure) name() string {
+	return azureProviderName
+}
+
+func (c *azure) settings(cfg config.Configuration) config.ProviderCloud {
+	return cfg.Providers.Azure
+}
+
+func (c *azure) spec(lb *netv1alpha1.LoadBalancer) (*options, bool) {
+	spec := lb.Spec.Providers.Azure
+	if spec == nil {
+		return nil, false
+	}
+
+	opts := &options{
+		annotations: map[string]string{},
+	}
+	if spec.Internal {
+		opts.annotations[azureAnnotationInternal] = "true"
+	}
+	if spec.ResourceGroup != "" {
+		opts.annotations[azureAnnotationResourceGroup] = spec.ResourceGroup
+	}
+	return opts, true
+}
+
+func (c *azure) status(lb *netv1alpha1.LoadBalancer) *netv1alpha1.CloudProviderStatus {
+	if lb.Status.ProvidersStatuses.Azure == nil {
+		return nil
+	}
+	return &lb.Status.ProvidersStatuses.Azure.CloudProviderStatus
+}
+
+func (c *azure) setStatus(lb *netv1alpha1.LoadBalancer, status netv1alpha1.CloudProviderStatus) {
+	lb.Status.ProvidersStatuses.Azure = &netv1alpha1.AzureProviderStatus{
+		CloudProviderStatus: status,
+	}
+}
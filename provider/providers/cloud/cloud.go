@@ -0,0 +1,598 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	"github.com/caicloud/loadbalancer-controller/config"
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/informers"
+	netlisters "github.com/caicloud/loadbalancer-controller/pkg/listers/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/tprclient"
+	"github.com/caicloud/loadbalancer-controller/pkg/util/audit"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+	"github.com/caicloud/loadbalancer-controller/pkg/util/validation"
+	"github.com/caicloud/loadbalancer-controller/provider"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	providerNameSuffix = "-provider-"
+)
+
+// controllerKind contains the schema.GroupVersionKind for this controller type.
+var controllerKind = netv1alpha1.SchemeGroupVersion.WithKind(netv1alpha1.LoadBalancerKind)
+
+// cloud describes the differences between cloud providers,
+// the common logic of requesting a cloud load balancer lives in cloudProvider
+type cloud interface {
+	// name returns the name of the cloud provider
+	name() string
+	// settings returns the global config of the cloud provider
+	settings(cfg config.Configuration) config.ProviderCloud
+	// spec returns the cloud options of lb, ok is false if lb does not use this cloud
+	spec(lb *netv1alpha1.LoadBalancer) (opts *options, ok bool)
+	// status returns the current status of this cloud in lb, may be nil
+	status(lb *netv1alpha1.LoadBalancer) *netv1alpha1.CloudProviderStatus
+	// setStatus sets the status of this cloud in lb
+	setStatus(lb *netv1alpha1.LoadBalancer, status netv1alpha1.CloudProviderStatus)
+}
+
+// options contains the cloud specified options of a load balancer
+type options struct {
+	// annotations are added to the service to configure the cloud load balancer
+	annotations map[string]string
+}
+
+var _ provider.Plugin = &cloudProvider{}
+
+// cloudProvider provisions a cloud load balancer for the proxy by creating
+// a service with type LoadBalancer, the cloud provider of kubernetes will
+// allocate the external ip with the credentials configured for the cluster
+type cloudProvider struct {
+	cloud
+
+	initialized bool
+	// workers is the number of loadbalancers synced concurrently
+	workers int
+
+	client    kubernetes.Interface
+	tprclient tprclient.Interface
+
+	helper *controllerutil.Helper
+
+	lbLister  netlisters.LoadBalancerLister
+	svcLister corelisters.ServiceLister
+
+	queue    workqueue.RateLimitingInterface
+	recorder record.EventRecorder
+	// logger logs with the level of this cloud
+	logger log.Logger
+}
+
+func newCloudProvider(c cloud) provider.Plugin {
+	return &cloudProvider{
+		cloud:  c,
+		logger: log.For(c.name()),
+	}
+}
+
+// ValidateConfig validates the section of this cloud in configuration
+func (f *cloudProvider) ValidateConfig(cfg config.Configuration) error {
+	settings := f.settings(cfg)
+	if settings.Workers <= 0 {
+		return fmt.Errorf("providers.%s.workers must be positive", f.name())
+	}
+	return nil
+}
+
+func (f *cloudProvider) Init(cfg config.Configuration, sif informers.SharedInformerFactory) {
+	if f.initialized {
+		return
+	}
+	f.initialized = true
+
+	f.logger.Info("Initialize the cloud provider", log.Fields{"cloud": f.name()})
+
+	// set config
+	f.workers = f.settings(cfg).Workers
+	f.client, f.tprclient = cfg.PluginClients(f.name())
+	f.recorder = cfg.Recorder
+
+	// initialize controller
+	lbInformer := sif.Networking().V1alpha1().LoadBalancer()
+	svcInformer := sif.Core().V1().Services()
+
+	f.lbLister = lbInformer.Lister()
+	f.svcLister = svcInformer.Lister()
+
+	f.queue = workqueue.NewNamedRateLimitingQueue(cfg.RateLimiter.New(), "provider-"+f.name())
+	f.helper = controllerutil.NewHelperForKeyFunc(&netv1alpha1.LoadBalancer{}, f.queue, f.syncLoadBalancer, controllerutil.PassthroughKeyFunc)
+	f.helper.Name = "provider-" + f.name()
+	f.helper.SyncFailureHandler = lbutil.NewSyncFailureHandler(f.helper.Name, f.tprclient, f.recorder)
+
+	svcInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: f.enqueueForService,
+		UpdateFunc: func(old, cur interface{}) {
+			if old.(*v1.Service).ResourceVersion == cur.(*v1.Service).ResourceVersion {
+				return
+			}
+			f.enqueueForService(cur)
+		},
+		DeleteFunc: f.enqueueForService,
+	})
+}
+
+func (f *cloudProvider) Run(stopCh <-chan struct{}) {
+
+	workers := f.workers
+
+	if !f.initialized {
+		f.logger.Panic("Please initialize provider before you run it")
+		return
+	}
+
+	defer utilruntime.HandleCrash()
+
+	f.logger.Info("Starting cloud provider", log.Fields{"cloud": f.name(), "workers": workers})
+
+	// lb controller has waited all the informer synced
+	// there is no need to wait again here
+
+	defer func() {
+		f.logger.Info("Shutting down cloud provider", log.Fields{"cloud": f.name()})
+		f.helper.ShutDown()
+	}()
+
+	f.helper.Run(workers, stopCh)
+
+	<-stopCh
+}
+
+func (f *cloudProvider) OnSync(lb *netv1alpha1.LoadBalancer) {
+	if lb.Spec.Type != netv1alpha1.LoadBalancerTypeExternal && !lbutil.HasFinalizer(lb, f.finalizer()) {
+		// It is not my responsible
+		return
+	}
+	if _, ok := f.spec(lb); !ok && f.status(lb) == nil && !lbutil.HasFinalizer(lb, f.finalizer()) {
+		// It is not my responsible
+		return
+	}
+	f.logger.Info("Syncing providers, triggered by lb controller", log.Fields{"lb": lb.Name, "namespace": lb.Namespace, "cloud": f.name()})
+	f.helper.Enqueue(lb)
+}
+
+// ForceResync re-reconciles the cloud load balancer of loadbalancer
+func (f *cloudProvider) ForceResync(namespace, name string) error {
+	lb, err := f.lbLister.LoadBalancers(namespace).Get(name)
+	if err != nil {
+		return err
+	}
+	f.OnSync(lb)
+	return nil
+}
+
+func (f *cloudProvider) selector(lb *netv1alpha1.LoadBalancer) labels.Set {
+	return labels.Set{
+		netv1alpha1.LabelKeyCreatedBy: fmt.Sprintf(netv1alpha1.LabelValueFormatCreateby, lb.Namespace, lb.Name),
+		netv1alpha1.LabelKeyProvider:  f.name(),
+	}
+}
+
+// finalizer blocks the deletion of loadbalancer until the cloud load balancer is released
+func (f *cloudProvider) finalizer() string {
+	return fmt.Sprintf(netv1alpha1.FinalizerFormat, f.name())
+}
+
+func (f *cloudProvider) serviceName(lb *netv1alpha1.LoadBalancer) string {
+	return lb.Name + providerNameSuffix + f.name()
+}
+
+func (f *cloudProvider) enqueueForService(obj interface{}) {
+	svc, ok := obj.(*v1.Service)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("Couldn't get object from tombstone %#v", obj))
+			return
+		}
+		svc, ok = tombstone.Obj.(*v1.Service)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("Tombstone contained object that is not a Service %#v", obj))
+			return
+		}
+	}
+
+	if svc.Labels[netv1alpha1.LabelKeyProvider] != f.name() {
+		return
+	}
+
+	v, ok := svc.Labels[netv1alpha1.LabelKeyCreatedBy]
+	if !ok {
+		return
+	}
+	namespace, name, err := lbutil.SplitNamespaceAndNameByDot(v)
+	if err != nil {
+		f.logger.Error("error get namespace and name", log.Fields{"err": err})
+		return
+	}
+
+	lb, err := f.lbLister.LoadBalancers(namespace).Get(name)
+	if err != nil {
+		return
+	}
+	f.helper.EnqueueAfter(lb, time.Second)
+}
+
+func (f *cloudProvider) syncLoadBalancer(obj interface{}) error {
+	lb, ok := obj.(*netv1alpha1.LoadBalancer)
+	if !ok {
+		return fmt.Errorf("expect loadbalancer, got %v", obj)
+	}
+
+	key, _ := controllerutil.KeyFunc(lb)
+
+	startTime := time.Now()
+	defer func() {
+		f.logger.Debug("Finished syncing cloud provider", log.Fields{"lb": key, "cloud": f.name(), "usedTime": time.Since(startTime)})
+	}()
+
+	nlb, err := f.lbLister.LoadBalancers(lb.Namespace).Get(lb.Name)
+	if errors.IsNotFound(err) {
+		if !lbutil.IsOwned(lb) {
+			return nil
+		}
+		if lbutil.IsDryRun(lb) {
+			return f.plan(lb, true)
+		}
+		f.logger.Warn("LoadBalancer has been deleted, clean up provider", log.Fields{"lb": key, "cloud": f.name()})
+		return f.cleanup(lb)
+	}
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("Unable to retrieve LoadBalancer %v from store: %v", key, err))
+		return err
+	}
+
+	// fresh lb
+	if lb.UID != nlb.UID {
+		return nil
+	}
+	lb = nlb
+
+	if !lbutil.IsOwned(lb) {
+		// reconciled by another controller
+		return nil
+	}
+
+	// loadbalancer is being deleted or provider has been removed from spec
+	opts, ok := f.spec(lb)
+	deleting := lb.DeletionTimestamp != nil || !ok
+	if !deleting {
+		// validate loadbalancer scheme, the cleanup of a loadbalancer being
+		// deleted never depends on a valid spec
+		if err := validation.ValidateLoadBalancer(lb); err != nil {
+			f.logger.Debug("invalid loadbalancer scheme", log.Fields{"err": err})
+			return err
+		}
+	}
+
+	if lbutil.IsDryRun(lb) {
+		return f.plan(lb, false)
+	}
+
+	if deleting {
+		return f.finalize(lb)
+	}
+
+	if lbutil.IsPaused(lb) {
+		f.logger.Debug("LoadBalancer is paused, skip syncing cloud provider", log.Fields{"lb": key, "cloud": f.name()})
+		return nil
+	}
+
+	if lbutil.IsQuotaExceeded(lb) {
+		f.logger.Debug("LoadBalancer exceeds quota, skip syncing cloud provider", log.Fields{"lb": key, "cloud": f.name()})
+		return nil
+	}
+
+	err = lbutil.AddFinalizer(f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, f.finalizer())
+	if err != nil {
+		f.logger.Error("Add cloud provider finalizer error", log.Fields{"lb": key, "cloud": f.name(), "err": err})
+		return err
+	}
+
+	result := lbutil.NewProviderResult(f.name())
+	result.Err = f.sync(result, lb, opts)
+	return lbutil.ReportResult(lb, result)
+}
+
+// sync generates desired service from lb and compare it with existing service
+func (f *cloudProvider) sync(result *lbutil.Result, lb *netv1alpha1.LoadBalancer, opts *options) error {
+	desiredSvc := f.generateService(lb, opts)
+
+	svc, err := f.svcLister.Services(lb.Namespace).Get(desiredSvc.Name)
+	if errors.IsNotFound(err) {
+		f.logger.Info("Create cloud load balancer service for lb", log.Fields{"svc.name": desiredSvc.Name, "lb.name": lb.Name, "cloud": f.name()})
+		svc, err = f.client.CoreV1().Services(lb.Namespace).Create(desiredSvc)
+		if err != nil {
+			return err
+		}
+		result.Created("Service", svc.Name)
+		return f.syncStatus(lb, svc)
+	}
+	if err != nil {
+		return err
+	}
+
+	copySvc, changed, err := f.ensureService(desiredSvc, svc)
+	if err != nil {
+		return err
+	}
+	if changed {
+		f.logger.Info("Sync cloud load balancer service for lb", log.Fields{"svc.name": svc.Name, "lb.name": lb.Name, "cloud": f.name()})
+		svc, err = f.client.CoreV1().Services(lb.Namespace).Update(copySvc)
+		if err != nil {
+			return err
+		}
+		result.Updated("Service", svc.Name)
+	}
+
+	return f.syncStatus(lb, svc)
+}
+
+func (f *cloudProvider) ensureService(desiredSvc, oldSvc *v1.Service) (*v1.Service, bool, error) {
+	copySvc, err := lbutil.ServiceDeepCopy(oldSvc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if copySvc.Labels == nil {
+		copySvc.Labels = map[string]string{}
+	}
+	if copySvc.Annotations == nil {
+		copySvc.Annotations = map[string]string{}
+	}
+
+	// ensure labels
+	for k, v := range desiredSvc.Labels {
+		copySvc.Labels[k] = v
+	}
+	// ensure annotations
+	for k, v := range desiredSvc.Annotations {
+		copySvc.Annotations[k] = v
+	}
+	// ensure spec, keep the cluster ip and node ports allocated by apiserver
+	copySvc.Spec.Type = desiredSvc.Spec.Type
+	copySvc.Spec.Selector = desiredSvc.Spec.Selector
+	copySvc.Spec.Ports = mergeServicePorts(desiredSvc.Spec.Ports, copySvc.Spec.Ports)
+
+	labelChanged := !reflect.DeepEqual(copySvc.Labels, oldSvc.Labels)
+	annotationChanged := !reflect.DeepEqual(copySvc.Annotations, oldSvc.Annotations)
+	specChanged := !reflect.DeepEqual(copySvc.Spec, oldSvc.Spec)
+
+	changed := labelChanged || annotationChanged || specChanged
+	if changed {
+		f.logger.Info("Abount to correct cloud provider", log.Fields{
+			"svc.name":          copySvc.Name,
+			"cloud":             f.name(),
+			"labelChanged":      labelChanged,
+			"annotationChanged": annotationChanged,
+			"specChanged":       specChanged,
+		})
+	}
+	audit.Compare(f.name(), "Service", copySvc.Namespace+"/"+copySvc.Name, desiredSvc.Spec, copySvc.Spec)
+
+	return copySvc, changed, nil
+}
+
+// cleanup service controlled by cloud provider
+func (f *cloudProvider) cleanup(lb *netv1alpha1.LoadBalancer) error {
+	err := f.client.CoreV1().Services(lb.Namespace).Delete(f.serviceName(lb), &metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		f.logger.Warn("Cleanup cloud provider error", log.Fields{"lb.name": lb.Name, "lb.ns": lb.Namespace, "cloud": f.name(), "err": err})
+		return err
+	}
+	f.recorder.Eventf(lb, v1.EventTypeNormal, lbutil.EventReasonCleanedUp, "Clean up %s provider", f.name())
+	return nil
+}
+
+// finalize cleans up cloud provider and removes the finalizer from lb after
+// the service has gone, the external ip is released along with the service
+func (f *cloudProvider) finalize(lb *netv1alpha1.LoadBalancer) error {
+	if err := f.cleanup(lb); err != nil {
+		return err
+	}
+
+	if !lbutil.HasFinalizer(lb, f.finalizer()) {
+		return nil
+	}
+
+	_, err := f.svcLister.Services(lb.Namespace).Get(f.serviceName(lb))
+	if err == nil {
+		return fmt.Errorf("waiting for service %v/%v to be deleted", lb.Namespace, f.serviceName(lb))
+	}
+	if !errors.IsNotFound(err) {
+		return err
+	}
+
+	if lb.DeletionTimestamp == nil {
+		// provider has been removed, the conditions are no longer reported by this cloud
+		err = lbutil.RemoveConditions(
+			f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
+			lb,
+			netv1alpha1.LoadBalancerProviderConfigured,
+			netv1alpha1.LoadBalancerVIPAssigned,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return lbutil.RemoveFinalizer(f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, f.finalizer())
+}
+
+// proxySelector selects the proxy pods of lb, only the pods of the active
+// proxy are selected in blue/green deployment
+func proxySelector(lb *netv1alpha1.LoadBalancer) map[string]string {
+	selector := map[string]string{
+		netv1alpha1.LabelKeyCreatedBy: fmt.Sprintf(netv1alpha1.LabelValueFormatCreateby, lb.Namespace, lb.Name),
+		netv1alpha1.LabelKeyProxy:     string(lb.Spec.Proxy.Type),
+	}
+	if lb.Spec.Proxy.BlueGreen != nil {
+		selector[netv1alpha1.LabelKeyProxyColor] = string(lbutil.ActiveProxyColor(lb))
+	}
+	return selector
+}
+
+func (f *cloudProvider) generateService(lb *netv1alpha1.LoadBalancer, opts *options) *v1.Service {
+	t := true
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        f.serviceName(lb),
+			Labels:      lbutil.WithArtifactLabels(f.selector(lb), lb, "provider-"+f.name()),
+			Annotations: opts.annotations,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion:         controllerKind.GroupVersion().String(),
+					Kind:               controllerKind.Kind,
+					Name:               lb.Name,
+					UID:                lb.UID,
+					Controller:         &t,
+					BlockOwnerDeletion: &t,
+				},
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Type: v1.ServiceTypeLoadBalancer,
+			// route traffic to proxy
+			Selector: proxySelector(lb),
+			Ports:    servicePorts(lb),
+		},
+	}
+
+	return svc
+}
+
+// servicePorts returns the ports listened by the proxy of lb, http, https
+// and the ports of tcp rules. The cloud load balancers can not mix protocols
+// in a service, so the ports of udp rules are not exposed
+func servicePorts(lb *netv1alpha1.LoadBalancer) []v1.ServicePort {
+	ports := []v1.ServicePort{
+		{
+			Name:       "http",
+			Port:       80,
+			TargetPort: intstr.FromInt(80),
+			Protocol:   v1.ProtocolTCP,
+		},
+		{
+			Name:       "https",
+			Port:       443,
+			TargetPort: intstr.FromInt(443),
+			Protocol:   v1.ProtocolTCP,
+		},
+	}
+	for _, rule := range lb.Spec.TCPRules {
+		ports = append(ports, v1.ServicePort{
+			Name:       fmt.Sprintf("tcp-%d", rule.Port),
+			Port:       rule.Port,
+			TargetPort: intstr.FromInt(int(rule.Port)),
+			Protocol:   v1.ProtocolTCP,
+		})
+	}
+	return ports
+}
+
+// mergeServicePorts returns the desired ports with the node ports allocated
+// by apiserver for the existing ones of the same name and port
+func mergeServicePorts(desired, existing []v1.ServicePort) []v1.ServicePort {
+	ports := make([]v1.ServicePort, 0, len(desired))
+	for _, port := range desired {
+		for _, old := range existing {
+			if old.Name == port.Name && old.Port == port.Port && old.Protocol == port.Protocol {
+				port.NodePort = old.NodePort
+				break
+			}
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+func (f *cloudProvider) syncStatus(lb *netv1alpha1.LoadBalancer, svc *v1.Service) error {
+	status := netv1alpha1.CloudProviderStatus{
+		Service: svc.Name,
+	}
+
+	for _, ingress := range svc.Status.LoadBalancer.Ingress {
+		if ingress.IP != "" {
+			status.ExternalIP = ingress.IP
+			break
+		}
+		if ingress.Hostname != "" {
+			status.ExternalIP = ingress.Hostname
+			break
+		}
+	}
+
+	condition := lbutil.NewCondition(netv1alpha1.LoadBalancerVIPAssigned, v1.ConditionTrue, "Assigned",
+		fmt.Sprintf("external ip %s is assigned by %s", status.ExternalIP, f.name()))
+	if status.ExternalIP == "" {
+		condition = lbutil.NewCondition(netv1alpha1.LoadBalancerVIPAssigned, v1.ConditionFalse, "Pending",
+			fmt.Sprintf("waiting for %s to assign an external ip to service %s", f.name(), svc.Name))
+	}
+	// write the section of this cloud in status
+	err := lbutil.WriteStatus(
+		f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
+		lb,
+		func(s *netv1alpha1.LoadBalancerStatus) bool {
+			section := &netv1alpha1.LoadBalancer{Status: *s}
+			if old := f.status(section); old != nil && reflect.DeepEqual(*old, status) {
+				return false
+			}
+			f.logger.Notice("update cloud provider status", log.Fields{"lb.name": lb.Name, "lb.ns": lb.Namespace, "cloud": f.name(), "externalIP": status.ExternalIP})
+			f.setStatus(section, status)
+			*s = section.Status
+			return true
+		},
+		condition,
+	)
+	if err != nil {
+		f.logger.Error("Update loadbalancer status error", log.Fields{"err": err})
+		return err
+	}
+	return nil
+}
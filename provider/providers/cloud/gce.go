@@ -0,0 +1,76 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	"github.com/caicloud/loadbalancer-controller/config"
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/provider"
+)
+
+const (
+	gceProviderName = "gce"
+
+	gceAnnotationLoadBalancerType = "cloud.google.com/load-balancer-type"
+)
+
+func init() {
+	provider.RegisterPlugin(gceProviderName, NewGCE())
+}
+
+// NewGCE creates a new gce provider plugin
+func NewGCE() provider.Plugin {
+	return newCloudProvider(&gce{})
+}
+
+type gce struct{}
+
+func (c *gce) name() string {
+	return gceProviderName
+}
+
+func (c *gce) settings(cfg config.Configuration) config.ProviderCloud {
+	return cfg.Providers.GCE
+}
+
+func (c *gce) spec(lb *netv1alpha1.LoadBalancer) (*options, bool) {
+	spec := lb.Spec.Providers.GCE
+	if spec == nil {
+		return nil, false
+	}
+
+	opts := &options{
+		annotations: map[string]string{},
+	}
+	if spec.Internal {
+		opts.annotations[gceAnnotationLoadBalancerType] = "Internal"
+	}
+	return opts, true
+}
+
+func (c *gce) status(lb *netv1alpha1.LoadBalancer) *netv1alpha1.CloudProviderStatus {
+	if lb.Status.ProvidersStatuses.GCE == nil {
+		return nil
+	}
+	return &lb.Status.ProvidersStatuses.GCE.CloudProviderStatus
+}
+
+func (c *gce) setStatus(lb *netv1alpha1.LoadBalancer, status netv1alpha1.CloudProviderStatus) {
+	lb.Status.ProvidersStatuses.GCE = &netv1alpha1.GCEProviderStatus{
+		CloudProviderStatus: status,
+	}
+}
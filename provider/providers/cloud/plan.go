@@ -0,0 +1,61 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloud
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// plan computes the changes the sync would make to the service of lb and
+// reports them instead of writing, the service is compared with the one in cache
+func (f *cloudProvider) plan(lb *netv1alpha1.LoadBalancer, deleted bool) error {
+	plan := lbutil.NewPlan(f.name(), lb)
+
+	svc, err := f.svcLister.Services(lb.Namespace).Get(f.serviceName(lb))
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	opts, ok := f.spec(lb)
+	if deleted || lb.DeletionTimestamp != nil || !ok {
+		if err == nil {
+			plan.Delete("Service", svc.Name)
+		}
+		plan.Report(f.recorder)
+		return nil
+	}
+
+	desiredSvc := f.generateService(lb, opts)
+	if errors.IsNotFound(err) {
+		plan.Create("Service", desiredSvc.Name)
+		plan.Report(f.recorder)
+		return nil
+	}
+
+	copySvc, changed, err := f.ensureService(desiredSvc, svc)
+	if err != nil {
+		return err
+	}
+	if changed {
+		plan.Diff("Service", svc.Name, copySvc, svc)
+	}
+	plan.Report(f.recorder)
+	return nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package external
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxErrorBytes limits the body of a failed call read into the error
+const maxErrorBytes = 4096
+
+// client calls the Provider service of an external plugin
+type client struct {
+	name     string
+	endpoint string
+	http     *http.Client
+}
+
+func newClient(name, endpoint string, timeout time.Duration) *client {
+	return &client{
+		name:     name,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		http:     &http.Client{Timeout: timeout},
+	}
+}
+
+func (c *client) init(req *InitRequest) (*InitResponse, error) {
+	resp := &InitResponse{}
+	return resp, c.call(MethodInit, req, resp)
+}
+
+func (c *client) sync(req *SyncRequest) (*SyncResponse, error) {
+	resp := &SyncResponse{}
+	return resp, c.call(MethodOnSync, req, resp)
+}
+
+func (c *client) status(req *StatusRequest) (*StatusResponse, error) {
+	resp := &StatusResponse{}
+	return resp, c.call(MethodStatus, req, resp)
+}
+
+// call posts the request to method of plugin and decodes the response into out
+func (c *client) call(method string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	url := c.endpoint + "/" + Service + "/" + method
+	resp, err := c.http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("call %s of plugin %s error: %v", method, c.name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBytes))
+		errResp := ErrorResponse{}
+		if json.Unmarshal(data, &errResp) != nil || errResp.Error == "" {
+			errResp.Error = strings.TrimSpace(string(data))
+		}
+		return fmt.Errorf("call %s of plugin %s error: %s: %s", method, c.name, resp.Status, errResp.Error)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s response of plugin %s error: %v", method, c.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,454 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package external
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/caicloud/loadbalancer-controller/config"
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/informers"
+	netlisters "github.com/caicloud/loadbalancer-controller/pkg/listers/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	"github.com/caicloud/loadbalancer-controller/pkg/tprclient"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+	"github.com/caicloud/loadbalancer-controller/pkg/util/validation"
+	"github.com/caicloud/loadbalancer-controller/provider"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	providerName = "external"
+
+	// pendingResyncPeriod is how often the status of a load balancer is
+	// polled until the plugin reports it is ready
+	pendingResyncPeriod = 15 * time.Second
+)
+
+func init() {
+	provider.RegisterPlugin(providerName, NewExternal())
+}
+
+var _ provider.Plugin = &externalProvider{}
+
+// externalProvider proxies the reconciliation of loadbalancers to the external
+// plugins registered in configuration, the plugin is chosen by name in spec
+type externalProvider struct {
+	initialized bool
+	// workers is the number of loadbalancers synced concurrently
+	workers int
+	// plugins are the clients of external plugins indexed by name
+	plugins map[string]*client
+
+	// lock guards ready
+	lock sync.Mutex
+	// ready records the plugins which have been initialized
+	ready map[string]bool
+
+	tprclient tprclient.Interface
+
+	helper *controllerutil.Helper
+
+	lbLister netlisters.LoadBalancerLister
+
+	queue    workqueue.RateLimitingInterface
+	recorder record.EventRecorder
+	logger   log.Logger
+}
+
+// NewExternal creates a new external provider plugin
+func NewExternal() provider.Plugin {
+	return &externalProvider{
+		ready:  make(map[string]bool),
+		logger: log.For(providerName),
+	}
+}
+
+// ValidateConfig validates the endpoints of external plugins
+func (f *externalProvider) ValidateConfig(cfg config.Configuration) error {
+	settings := cfg.Providers.External
+	if settings.Workers <= 0 {
+		return fmt.Errorf("providers.external.workers must be positive")
+	}
+	if settings.Timeout <= 0 {
+		return fmt.Errorf("providers.external.timeout must be positive")
+	}
+	plugins, err := settings.Plugins()
+	if err != nil {
+		return fmt.Errorf("providers.external.endpoints: %v", err)
+	}
+	for name, endpoint := range plugins {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return fmt.Errorf("providers.external.endpoints: plugin %v: %v", name, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("providers.external.endpoints: plugin %v: %q is not a http or https url", name, endpoint)
+		}
+	}
+	return nil
+}
+
+func (f *externalProvider) Init(cfg config.Configuration, sif informers.SharedInformerFactory) {
+	if f.initialized {
+		return
+	}
+	f.initialized = true
+
+	f.logger.Info("Initialize the external provider")
+
+	// set config, endpoints have been validated
+	settings := cfg.Providers.External
+	plugins, _ := settings.Plugins()
+	f.plugins = make(map[string]*client, len(plugins))
+	for name, endpoint := range plugins {
+		f.plugins[name] = newClient(name, endpoint, time.Duration(settings.Timeout)*time.Second)
+	}
+	f.workers = settings.Workers
+	_, f.tprclient = cfg.PluginClients(providerName)
+	f.recorder = cfg.Recorder
+
+	// initialize controller
+	lbInformer := sif.Networking().V1alpha1().LoadBalancer()
+	f.lbLister = lbInformer.Lister()
+
+	f.queue = workqueue.NewNamedRateLimitingQueue(cfg.RateLimiter.New(), "provider-"+providerName)
+	f.helper = controllerutil.NewHelperForKeyFunc(&netv1alpha1.LoadBalancer{}, f.queue, f.syncLoadBalancer, controllerutil.PassthroughKeyFunc)
+	f.helper.Name = "provider-" + providerName
+	f.helper.SyncFailureHandler = lbutil.NewSyncFailureHandler(f.helper.Name, f.tprclient, f.recorder)
+}
+
+func (f *externalProvider) Run(stopCh <-chan struct{}) {
+
+	workers := f.workers
+
+	if !f.initialized {
+		f.logger.Panic("Please initialize provider before you run it")
+		return
+	}
+
+	defer utilruntime.HandleCrash()
+
+	f.logger.Info("Starting external provider", log.Fields{"workers": workers, "plugins": len(f.plugins)})
+
+	// plugins failed to initialize here are initialized again on sync
+	for _, c := range f.plugins {
+		if err := f.initPlugin(c); err != nil {
+			f.logger.Warn("Initialize external plugin error", log.Fields{"plugin": c.name, "err": err})
+		}
+	}
+
+	defer func() {
+		f.logger.Info("Shutting down external provider")
+		f.helper.ShutDown()
+	}()
+
+	f.helper.Run(workers, stopCh)
+
+	<-stopCh
+}
+
+func (f *externalProvider) OnSync(lb *netv1alpha1.LoadBalancer) {
+	if lb.Spec.Type != netv1alpha1.LoadBalancerTypeExternal && !lbutil.HasFinalizer(lb, f.finalizer()) {
+		// It is not my responsible
+		return
+	}
+	if lb.Spec.Providers.External == nil && lb.Status.ProvidersStatuses.External == nil && !lbutil.HasFinalizer(lb, f.finalizer()) {
+		// It is not my responsible
+		return
+	}
+	f.logger.Info("Syncing providers, triggered by lb controller", log.Fields{"lb": lb.Name, "namespace": lb.Namespace})
+	f.helper.Enqueue(lb)
+}
+
+// ForceResync re-reconciles the external load balancer of loadbalancer
+func (f *externalProvider) ForceResync(namespace, name string) error {
+	lb, err := f.lbLister.LoadBalancers(namespace).Get(name)
+	if err != nil {
+		return err
+	}
+	f.OnSync(lb)
+	return nil
+}
+
+// finalizer blocks the deletion of loadbalancer until the plugin released the load balancer
+func (f *externalProvider) finalizer() string {
+	return fmt.Sprintf(netv1alpha1.FinalizerFormat, providerName)
+}
+
+// pluginName returns the name of plugin which provisioned the load balancer
+// of lb, the one in status wins since spec may have been changed
+func (f *externalProvider) pluginName(lb *netv1alpha1.LoadBalancer) string {
+	if status := lb.Status.ProvidersStatuses.External; status != nil && status.Name != "" {
+		return status.Name
+	}
+	if spec := lb.Spec.Providers.External; spec != nil {
+		return spec.Name
+	}
+	return ""
+}
+
+// initPlugin calls Init of plugin once
+func (f *externalProvider) initPlugin(c *client) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.ready[c.name] {
+		return nil
+	}
+	resp, err := c.init(&InitRequest{ControllerID: lbutil.ControllerID()})
+	if err != nil {
+		return err
+	}
+	f.logger.Info("External plugin initialized", log.Fields{"plugin": c.name, "version": resp.Version})
+	f.ready[c.name] = true
+	return nil
+}
+
+func (f *externalProvider) syncLoadBalancer(obj interface{}) error {
+	lb, ok := obj.(*netv1alpha1.LoadBalancer)
+	if !ok {
+		return fmt.Errorf("expect loadbalancer, got %v", obj)
+	}
+
+	key, _ := controllerutil.KeyFunc(lb)
+
+	startTime := time.Now()
+	defer func() {
+		f.logger.Debug("Finished syncing external provider", log.Fields{"lb": key, "usedTime": time.Since(startTime)})
+	}()
+
+	nlb, err := f.lbLister.LoadBalancers(lb.Namespace).Get(lb.Name)
+	if errors.IsNotFound(err) {
+		if !lbutil.IsOwned(lb) || lbutil.IsDryRun(lb) {
+			return nil
+		}
+		f.logger.Warn("LoadBalancer has been deleted, clean up provider", log.Fields{"lb": key})
+		return f.cleanup(lb)
+	}
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("Unable to retrieve LoadBalancer %v from store: %v", key, err))
+		return err
+	}
+
+	// fresh lb
+	if lb.UID != nlb.UID {
+		return nil
+	}
+	lb = nlb
+
+	if !lbutil.IsOwned(lb) {
+		// reconciled by another controller
+		return nil
+	}
+
+	// loadbalancer is being deleted or provider has been removed from spec
+	deleting := lb.DeletionTimestamp != nil || lb.Spec.Providers.External == nil
+	if !deleting {
+		// validate loadbalancer scheme, the cleanup of a loadbalancer being
+		// deleted never depends on a valid spec
+		if err := validation.ValidateLoadBalancer(lb); err != nil {
+			f.logger.Debug("invalid loadbalancer scheme", log.Fields{"err": err})
+			return err
+		}
+	}
+
+	if lbutil.IsDryRun(lb) {
+		// the changes are made by plugin, they can not be planned here
+		f.logger.Debug("LoadBalancer is in dry run, skip syncing external provider", log.Fields{"lb": key})
+		return nil
+	}
+
+	if deleting {
+		return f.finalize(lb)
+	}
+
+	if lbutil.IsPaused(lb) {
+		f.logger.Debug("LoadBalancer is paused, skip syncing external provider", log.Fields{"lb": key})
+		return nil
+	}
+
+	if lbutil.IsQuotaExceeded(lb) {
+		f.logger.Debug("LoadBalancer exceeds quota, skip syncing external provider", log.Fields{"lb": key})
+		return nil
+	}
+
+	err = lbutil.AddFinalizer(f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, f.finalizer())
+	if err != nil {
+		f.logger.Error("Add external provider finalizer error", log.Fields{"lb": key, "err": err})
+		return err
+	}
+
+	result := lbutil.NewProviderResult(providerName)
+	result.Err = f.sync(result, lb)
+	return lbutil.ReportResult(lb, result)
+}
+
+// sync proxies the reconciliation of lb to its plugin and writes the status
+// reported by plugin into lb
+func (f *externalProvider) sync(result *lbutil.Result, lb *netv1alpha1.LoadBalancer) error {
+	name := lb.Spec.Providers.External.Name
+	c, ok := f.plugins[name]
+	if !ok {
+		// the plugins can only be changed by restarting controller, there is
+		// no need to retry
+		message := fmt.Sprintf("external plugin %s is not registered in controller", name)
+		result.Warn("PluginNotFound", message)
+		result.SetConditions(lbutil.NewCondition(netv1alpha1.LoadBalancerProviderConfigured, v1.ConditionFalse, "PluginNotFound", message))
+		return nil
+	}
+	if err := f.initPlugin(c); err != nil {
+		return err
+	}
+
+	resp, err := c.sync(&SyncRequest{LoadBalancer: lb})
+	if err != nil {
+		return err
+	}
+	for _, change := range resp.Changes {
+		switch change.Action {
+		case lbutil.ActionCreated, lbutil.ActionUpdated, lbutil.ActionScaled, lbutil.ActionDeleted:
+			result.Changes = append(result.Changes, lbutil.Change{Action: change.Action, Kind: change.Kind, Name: change.Name})
+		default:
+			f.logger.Warn("Unknown action of change reported by external plugin", log.Fields{"plugin": name, "action": change.Action})
+		}
+	}
+	for _, w := range resp.Warnings {
+		result.Warn(w.Reason, w.Message)
+	}
+	if resp.RequeueAfterSeconds > 0 {
+		result.Requeue(time.Duration(resp.RequeueAfterSeconds) * time.Second)
+	}
+
+	status, err := c.status(&StatusRequest{LoadBalancer: lb})
+	if err != nil {
+		return err
+	}
+	if !status.Ready {
+		// provisioning of hardware load balancers is asynchronous, poll
+		// the status until it is ready
+		result.Requeue(pendingResyncPeriod)
+	}
+	return f.syncStatus(lb, name, status)
+}
+
+// cleanup asks the plugin to release the load balancer of lb
+func (f *externalProvider) cleanup(lb *netv1alpha1.LoadBalancer) error {
+	name := f.pluginName(lb)
+	if name == "" {
+		return nil
+	}
+	c, ok := f.plugins[name]
+	if !ok {
+		f.logger.Warn("External plugin is not registered, the load balancer may be leaked", log.Fields{"lb.name": lb.Name, "lb.ns": lb.Namespace, "plugin": name})
+		return nil
+	}
+	if err := f.initPlugin(c); err != nil {
+		return err
+	}
+	if _, err := c.sync(&SyncRequest{LoadBalancer: lb, Deleted: true}); err != nil {
+		f.logger.Warn("Cleanup external provider error", log.Fields{"lb.name": lb.Name, "lb.ns": lb.Namespace, "plugin": name, "err": err})
+		return err
+	}
+	f.recorder.Eventf(lb, v1.EventTypeNormal, lbutil.EventReasonCleanedUp, "Clean up %s provider %s", providerName, name)
+	return nil
+}
+
+// finalize releases the load balancer by plugin and removes the finalizer
+// from lb after the plugin succeeded
+func (f *externalProvider) finalize(lb *netv1alpha1.LoadBalancer) error {
+	if !lbutil.HasFinalizer(lb, f.finalizer()) {
+		return nil
+	}
+
+	if err := f.cleanup(lb); err != nil {
+		return err
+	}
+
+	if lb.DeletionTimestamp == nil {
+		// provider has been removed, the conditions and status are no longer
+		// reported by external provider
+		err := lbutil.WriteStatus(
+			f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
+			lb,
+			func(s *netv1alpha1.LoadBalancerStatus) bool {
+				if s.ProvidersStatuses.External == nil {
+					return false
+				}
+				s.ProvidersStatuses.External = nil
+				return true
+			},
+		)
+		if err != nil {
+			return err
+		}
+		err = lbutil.RemoveConditions(
+			f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
+			lb,
+			netv1alpha1.LoadBalancerProviderConfigured,
+			netv1alpha1.LoadBalancerVIPAssigned,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return lbutil.RemoveFinalizer(f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, f.finalizer())
+}
+
+func (f *externalProvider) syncStatus(lb *netv1alpha1.LoadBalancer, name string, resp *StatusResponse) error {
+	status := netv1alpha1.ExternalProviderStatus{
+		Name:      name,
+		Addresses: resp.Addresses,
+		Ready:     resp.Ready,
+		Message:   resp.Message,
+	}
+
+	condition := lbutil.NewCondition(netv1alpha1.LoadBalancerVIPAssigned, v1.ConditionTrue, "Assigned",
+		fmt.Sprintf("addresses %v are assigned by external plugin %s", status.Addresses, name))
+	if len(status.Addresses) == 0 {
+		condition = lbutil.NewCondition(netv1alpha1.LoadBalancerVIPAssigned, v1.ConditionFalse, "Pending",
+			fmt.Sprintf("waiting for external plugin %s to assign addresses", name))
+	}
+	err := lbutil.WriteStatus(
+		f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
+		lb,
+		func(s *netv1alpha1.LoadBalancerStatus) bool {
+			if old := s.ProvidersStatuses.External; old != nil && reflect.DeepEqual(*old, status) {
+				return false
+			}
+			f.logger.Notice("update external provider status", log.Fields{"lb.name": lb.Name, "lb.ns": lb.Namespace, "plugin": name, "addresses": status.Addresses, "ready": status.Ready})
+			s.ProvidersStatuses.External = &status
+			return true
+		},
+		condition,
+	)
+	if err != nil {
+		f.logger.Error("Update loadbalancer status error", log.Fields{"err": err})
+		return err
+	}
+	return nil
+}
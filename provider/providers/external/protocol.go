@@ -0,0 +1,105 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package external proxies the reconciliation of loadbalancers to plugins
+// running out of the controller, so that vendors integrate their load
+// balancers, e.g. F5 and Citrix, without forking the controller.
+//
+// A plugin serves the Provider service below, each RPC is a POST of the JSON
+// encoded request to /<Service>/<Method> and the response is the JSON encoded
+// reply. A non 2xx status is an error, its body is an ErrorResponse
+package external
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+)
+
+// Service is the name of the service served by external plugins
+const Service = "loadbalancer.provider.v1alpha1.Provider"
+
+// Methods of the Provider service, they mirror provider.Plugin
+const (
+	// MethodInit is called once before the plugin is used
+	MethodInit = "Init"
+	// MethodOnSync reconciles the load balancer of a loadbalancer, or releases
+	// it if the loadbalancer is deleted
+	MethodOnSync = "OnSync"
+	// MethodStatus returns the current status of the load balancer
+	MethodStatus = "Status"
+)
+
+// InitRequest is the request of Init
+type InitRequest struct {
+	// ControllerID is the identity of the controller, empty if not set
+	ControllerID string `json:"controllerID,omitempty"`
+}
+
+// InitResponse is the response of Init
+type InitResponse struct {
+	// Version is the version of plugin, it is logged only
+	Version string `json:"version,omitempty"`
+}
+
+// SyncRequest is the request of OnSync
+type SyncRequest struct {
+	LoadBalancer *netv1alpha1.LoadBalancer `json:"loadBalancer"`
+	// Deleted is true if the load balancer must be released
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// SyncResponse is the response of OnSync
+type SyncResponse struct {
+	// Changes are the objects written by plugin, they are recorded as events
+	Changes []Change `json:"changes,omitempty"`
+	// Warnings are the abnormal states found by plugin
+	Warnings []Warning `json:"warnings,omitempty"`
+	// RequeueAfterSeconds asks to sync the loadbalancer again, 0 means no requeue
+	RequeueAfterSeconds int `json:"requeueAfterSeconds,omitempty"`
+}
+
+// Change is an object of the load balancer written by plugin
+type Change struct {
+	// Action is one of created, updated, scaled and deleted
+	Action string `json:"action"`
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+}
+
+// Warning is an abnormal state found by plugin
+type Warning struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// StatusRequest is the request of Status
+type StatusRequest struct {
+	LoadBalancer *netv1alpha1.LoadBalancer `json:"loadBalancer"`
+}
+
+// StatusResponse is the response of Status
+type StatusResponse struct {
+	// Addresses are the addresses served by the load balancer
+	Addresses []string `json:"addresses,omitempty"`
+	// Ready is true if the load balancer has been provisioned
+	Ready bool `json:"ready"`
+	// Message is the human readable status of the load balancer
+	Message string `json:"message,omitempty"`
+}
+
+// ErrorResponse is the body of a failed call
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
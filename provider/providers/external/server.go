@@ -0,0 +1,82 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package external
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Server is implemented by external plugins written in go, NewHandler
+// serves it as the Provider service
+type Server interface {
+	Init(*InitRequest) (*InitResponse, error)
+	OnSync(*SyncRequest) (*SyncResponse, error)
+	Status(*StatusRequest) (*StatusResponse, error)
+}
+
+// NewHandler returns a http handler serving the Provider service by server
+func NewHandler(server Server) http.Handler {
+	mux := http.NewServeMux()
+	prefix := "/" + Service + "/"
+	mux.HandleFunc(prefix, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, &ErrorResponse{Error: "method must be POST"})
+			return
+		}
+
+		var (
+			out interface{}
+			err error
+		)
+		decoder := json.NewDecoder(r.Body)
+		switch strings.TrimPrefix(r.URL.Path, prefix) {
+		case MethodInit:
+			in := &InitRequest{}
+			if err = decoder.Decode(in); err == nil {
+				out, err = server.Init(in)
+			}
+		case MethodOnSync:
+			in := &SyncRequest{}
+			if err = decoder.Decode(in); err == nil {
+				out, err = server.OnSync(in)
+			}
+		case MethodStatus:
+			in := &StatusRequest{}
+			if err = decoder.Decode(in); err == nil {
+				out, err = server.Status(in)
+			}
+		default:
+			writeJSON(w, http.StatusNotFound, &ErrorResponse{Error: "unknown method " + r.URL.Path})
+			return
+		}
+
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, &ErrorResponse{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, out)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
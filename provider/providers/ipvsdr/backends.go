@@ -0,0 +1,202 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// backendsConfigMapName is the name of ConfigMap containing the real servers
+	// of ports forwarding to services directly, one key per port in the format
+	// of port-protocol, and one "ip port" per line. Provider pods watch it
+	// through api server instead of volume to converge in sub-second
+	backendsConfigMapName = "%s-provider-ipvsdr-backends"
+)
+
+// generateBackends resolves the ready endpoints of backend services
+func (f *ipvsdr) generateBackends(lb *netv1alpha1.LoadBalancer) (map[string]string, error) {
+	backends := make(map[string]string)
+
+	for _, port := range lb.Spec.Providers.Ipvsdr.Ports {
+		if port.Backend == nil {
+			continue
+		}
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = v1.ProtocolTCP
+		}
+		key := fmt.Sprintf("%d-%s", port.Port, protocol)
+
+		servers, err := f.resolveBackend(lb, port.Backend)
+		if err != nil {
+			return nil, err
+		}
+		backends[key] = strings.Join(servers, "\n")
+	}
+
+	return backends, nil
+}
+
+// resolveBackend returns the "ip port" of ready endpoints of backend service
+func (f *ipvsdr) resolveBackend(lb *netv1alpha1.LoadBalancer, backend *netv1alpha1.IpvsdrBackend) ([]string, error) {
+	namespace := backend.Namespace
+	if namespace == "" {
+		namespace = lb.Namespace
+	}
+
+	// endpoints ports are named after service ports
+	portName := backend.ServicePort.StrVal
+	if backend.ServicePort.Type == intstr.Int {
+		svc, err := f.svcLister.Services(namespace).Get(backend.ServiceName)
+		if errors.IsNotFound(err) {
+			return []string{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, p := range svc.Spec.Ports {
+			if p.Port == backend.ServicePort.IntVal {
+				portName = p.Name
+				found = true
+				break
+			}
+		}
+		if !found {
+			return []string{}, nil
+		}
+	}
+
+	eps, err := f.epLister.Endpoints(namespace).Get(backend.ServiceName)
+	if errors.IsNotFound(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make([]string, 0)
+	for _, subset := range eps.Subsets {
+		for _, p := range subset.Ports {
+			if p.Name != portName {
+				continue
+			}
+			for _, addr := range subset.Addresses {
+				servers = append(servers, fmt.Sprintf("%s %d", addr.IP, p.Port))
+			}
+		}
+	}
+	sort.Strings(servers)
+	return servers, nil
+}
+
+// ensureBackends ensures the ConfigMap of backends is up to date
+func (f *ipvsdr) ensureBackends(lb *netv1alpha1.LoadBalancer) error {
+	data, err := f.generateBackends(lb)
+	if err != nil {
+		return err
+	}
+	return f.ensureConfigMap(lb, fmt.Sprintf(backendsConfigMapName, lb.Name), data)
+}
+
+// syncBackends is the fast path of endpoints changes, only the ConfigMap of
+// backends is updated
+func (f *ipvsdr) syncBackends(obj interface{}) error {
+	lb, ok := obj.(*netv1alpha1.LoadBalancer)
+	if !ok {
+		return fmt.Errorf("expect loadbalancer, got %v", obj)
+	}
+
+	nlb, err := f.lbLister.LoadBalancers(lb.Namespace).Get(lb.Name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if nlb.UID != lb.UID || nlb.DeletionTimestamp != nil || !lbutil.IsOwned(nlb) || lbutil.IsDryRun(nlb) || !f.responsible(nlb) || !lbutil.HasFinalizer(nlb, finalizer) {
+		// the backends are ensured along with provider
+		return nil
+	}
+
+	return f.ensureBackends(nlb)
+}
+
+// backendServiceKeys returns the namespace/name of services referred by ports of lb
+func backendServiceKeys(lb *netv1alpha1.LoadBalancer) []string {
+	keys := make([]string, 0)
+	if lb.Spec.Providers.Ipvsdr == nil {
+		return keys
+	}
+	for _, port := range lb.Spec.Providers.Ipvsdr.Ports {
+		if port.Backend == nil {
+			continue
+		}
+		namespace := port.Backend.Namespace
+		if namespace == "" {
+			namespace = lb.Namespace
+		}
+		keys = append(keys, namespace+"/"+port.Backend.ServiceName)
+	}
+	return keys
+}
+
+// enqueueBackendsForEndpoints enqueues the loadbalancers whose ports
+// forward to the service of endpoints
+func (f *ipvsdr) enqueueBackendsForEndpoints(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+
+	lbs, err := f.lbLister.List(labels.Everything())
+	if err != nil {
+		return
+	}
+	for _, lb := range lbs {
+		for _, k := range backendServiceKeys(lb) {
+			if k == key {
+				logger.Debug("Backend endpoints changed, sync ipvsdr backends", log.Fields{"endpoints": key, "lb": lb.Name})
+				f.backendsHelper.Enqueue(lb)
+				break
+			}
+		}
+	}
+}
+
+func (f *ipvsdr) updateEndpoints(oldObj, curObj interface{}) {
+	old := oldObj.(*v1.Endpoints)
+	cur := curObj.(*v1.Endpoints)
+	if old.ResourceVersion == cur.ResourceVersion {
+		return
+	}
+	f.enqueueBackendsForEndpoints(cur)
+}
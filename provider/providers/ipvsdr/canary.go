@@ -0,0 +1,68 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/util/canary"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+	"k8s.io/client-go/pkg/api/v1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// observeCanary reports the image and availability of the active workload of
+// lb to the rollout of canary image, lb is synced again before progress deadline
+// if the canary workload is still progressing
+func (f *ipvsdr) observeCanary(result *lbutil.Result, lb *netv1alpha1.LoadBalancer, dps []*extensions.Deployment, dss []*extensions.DaemonSet) {
+	if !f.rollout.Enabled() {
+		return
+	}
+	image, available := "", true
+	for _, dp := range dps {
+		if strings.HasPrefix(dp.Name, lb.Name+providerNameSuffix) {
+			image, available = f.containerImage(dp.Spec.Template), canary.DeploymentAvailable(dp)
+			break
+		}
+	}
+	for _, ds := range dss {
+		if strings.HasPrefix(ds.Name, lb.Name+providerNameSuffix) {
+			image, available = f.containerImage(ds.Spec.Template), canary.DaemonSetAvailable(ds)
+			break
+		}
+	}
+
+	after, paused := f.rollout.Observe(lb, image, available)
+	if paused {
+		result.Warn(lbutil.EventReasonCanaryPaused, fmt.Sprintf("Ipvsdr provider with canary image %s is not available in time, rollout of canary image is paused", image))
+	}
+	if after > 0 {
+		result.Requeue(after)
+	}
+}
+
+// containerImage returns the image of provider container in template
+func (f *ipvsdr) containerImage(template v1.PodTemplateSpec) string {
+	for _, c := range template.Spec.Containers {
+		if c.Name == providerName {
+			return c.Image
+		}
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// checksConfigMapName is the name of ConfigMap containing the keepalived
+	// real server checks, one key per port in the format of port-protocol
+	checksConfigMapName = "%s-provider-ipvsdr-checks"
+	checksVolumeName    = "checks"
+	checksMountPath     = "/etc/keepalived/checks.d"
+
+	defaultCheckTimeoutSeconds          = 3
+	defaultCheckRetry                   = 3
+	defaultCheckDelayBeforeRetrySeconds = 3
+	defaultCheckStatusCode              = 200
+)
+
+// generateChecks renders the keepalived check block of each port,
+// the provider puts them into the real_server blocks of the port
+func generateChecks(lb *netv1alpha1.LoadBalancer) map[string]string {
+	checks := make(map[string]string)
+	if lb.Spec.Providers.Ipvsdr == nil {
+		return checks
+	}
+
+	for _, port := range lb.Spec.Providers.Ipvsdr.Ports {
+		if port.HealthCheck == nil {
+			continue
+		}
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = v1.ProtocolTCP
+		}
+		key := fmt.Sprintf("%d-%s", port.Port, protocol)
+		checks[key] = renderCheck(port.Port, port.HealthCheck)
+	}
+
+	return checks
+}
+
+func renderCheck(port int32, check *netv1alpha1.HealthCheck) string {
+	timeout := check.TimeoutSeconds
+	if timeout == 0 {
+		timeout = defaultCheckTimeoutSeconds
+	}
+	retry := check.Retry
+	if retry == 0 {
+		retry = defaultCheckRetry
+	}
+	delay := check.DelayBeforeRetrySeconds
+	if delay == 0 {
+		delay = defaultCheckDelayBeforeRetrySeconds
+	}
+
+	buf := bytes.NewBuffer(nil)
+	switch check.Type {
+	case netv1alpha1.HealthCheckTypeHTTP:
+		path := check.Path
+		if path == "" {
+			path = "/"
+		}
+		code := check.StatusCode
+		if code == 0 {
+			code = defaultCheckStatusCode
+		}
+		fmt.Fprintf(buf, "HTTP_GET {\n")
+		fmt.Fprintf(buf, "    url {\n")
+		fmt.Fprintf(buf, "        path %s\n", path)
+		fmt.Fprintf(buf, "        status_code %d\n", code)
+		fmt.Fprintf(buf, "    }\n")
+	default:
+		fmt.Fprintf(buf, "TCP_CHECK {\n")
+	}
+	fmt.Fprintf(buf, "    connect_port %d\n", port)
+	fmt.Fprintf(buf, "    connect_timeout %d\n", timeout)
+	fmt.Fprintf(buf, "    retry %d\n", retry)
+	fmt.Fprintf(buf, "    delay_before_retry %d\n", delay)
+	fmt.Fprintf(buf, "}\n")
+
+	return buf.String()
+}
+
+// ensureChecks ensures the ConfigMap of checks is up to date
+func (f *ipvsdr) ensureChecks(lb *netv1alpha1.LoadBalancer) error {
+	return f.ensureConfigMap(lb, fmt.Sprintf(checksConfigMapName, lb.Name), generateChecks(lb))
+}
+
+// ensureConfigMap ensures the ConfigMap owned by lb contains data
+func (f *ipvsdr) ensureConfigMap(lb *netv1alpha1.LoadBalancer, name string, data map[string]string) error {
+	cm, err := f.client.CoreV1().ConfigMaps(lb.Namespace).Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		t := true
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: lbutil.WithArtifactLabels(f.selector(lb), lb, "provider-"+providerName),
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						APIVersion:         controllerKind.GroupVersion().String(),
+						Kind:               controllerKind.Kind,
+						Name:               lb.Name,
+						UID:                lb.UID,
+						Controller:         &t,
+						BlockOwnerDeletion: &t,
+					},
+				},
+			},
+			Data: data,
+		}
+		logger.Info("About to create ConfigMap for ipvsdr", log.Fields{"cm.ns": lb.Namespace, "cm.name": name})
+		_, err = f.client.CoreV1().ConfigMaps(lb.Namespace).Create(cm)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(cm.Data) == 0 && len(data) == 0 || reflect.DeepEqual(cm.Data, data) {
+		return nil
+	}
+
+	cm.Data = data
+	logger.Info("About to update ConfigMap for ipvsdr", log.Fields{"cm.ns": lb.Namespace, "cm.name": name})
+	_, err = f.client.CoreV1().ConfigMaps(lb.Namespace).Update(cm)
+	return err
+}
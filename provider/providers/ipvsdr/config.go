@@ -0,0 +1,53 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+)
+
+const (
+	// configConfigMapName is the name of ConfigMap containing the config of
+	// provider rendered from spec. Provider pods watch it through api server
+	// and reload without restart when it is changed
+	configConfigMapName = "%s-provider-ipvsdr-config"
+)
+
+// generateConfig renders the config of provider pods from spec of lb
+func (f *ipvsdr) generateConfig(lb *netv1alpha1.LoadBalancer) map[string]string {
+	data := map[string]string{
+		"scheduler": string(lb.Spec.Providers.Ipvsdr.Scheduler),
+		// each vip runs its own VRRP instance with the vrid in status of lb
+		"vips": strings.Join(allVips(lb), ","),
+	}
+	ipvsConfig(lb, data)
+	portsConfig(lb, data)
+	vrrpConfig(lb, data)
+	dscpConfig(lb, data)
+	f.weightsConfig(lb, data)
+	data["dataplane-backend"] = string(f.effectiveDataplaneBackend(lb))
+	f.shareConfig(lb, data)
+	return data
+}
+
+// ensureConfig ensures the ConfigMap of config is up to date
+func (f *ipvsdr) ensureConfig(lb *netv1alpha1.LoadBalancer) error {
+	return f.ensureConfigMap(lb, fmt.Sprintf(configConfigMapName, lb.Name), f.generateConfig(lb))
+}
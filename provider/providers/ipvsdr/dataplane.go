@@ -0,0 +1,75 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// effectiveDataplaneBackend returns the netfilter backend of lb, the one in
+// spec overrides the default of controller. The existing loadbalancers keep
+// the default iptables until they are switched one by one
+func (f *ipvsdr) effectiveDataplaneBackend(lb *netv1alpha1.LoadBalancer) netv1alpha1.DataplaneBackend {
+	if backend := lb.Spec.Providers.Ipvsdr.DataplaneBackend; backend != "" {
+		return backend
+	}
+	if f.dataplaneBackend != "" {
+		return f.dataplaneBackend
+	}
+	return netv1alpha1.DataplaneBackendIPTables
+}
+
+// dataplaneCondition reports the nodes whose kernel does not support the
+// backend of lb, by the capabilities published by provider pods. The pods
+// of old image publish nothing and are not reported
+func (f *ipvsdr) dataplaneCondition(lb *netv1alpha1.LoadBalancer, instances []netv1alpha1.IpvsdrInstanceStatus) netv1alpha1.LoadBalancerCondition {
+	backend := f.effectiveDataplaneBackend(lb)
+	if backend == netv1alpha1.DataplaneBackendAuto {
+		return lbutil.NewCondition(netv1alpha1.LoadBalancerDataplaneUnsupported, v1.ConditionFalse, "Detected",
+			"dataplane backend is detected by each ipvsdr pod")
+	}
+
+	unsupported := []string{}
+	for _, instance := range instances {
+		if len(instance.DataplaneCapabilities) == 0 || supports(instance.DataplaneCapabilities, backend) {
+			continue
+		}
+		unsupported = append(unsupported, instance.NodeName)
+	}
+	if len(unsupported) != 0 {
+		return lbutil.NewCondition(netv1alpha1.LoadBalancerDataplaneUnsupported, v1.ConditionTrue, "Unsupported",
+			fmt.Sprintf("dataplane backend %s is not supported by nodes %s", backend, strings.Join(unsupported, ", ")))
+	}
+	return lbutil.NewCondition(netv1alpha1.LoadBalancerDataplaneUnsupported, v1.ConditionFalse, "Supported",
+		fmt.Sprintf("dataplane backend %s is supported by all nodes", backend))
+}
+
+// supports returns true if backend is in capabilities
+func supports(capabilities []netv1alpha1.DataplaneBackend, backend netv1alpha1.DataplaneBackend) bool {
+	for _, c := range capabilities {
+		if c == backend {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// drainFile is created in provider container when the pod is going to be
+	// stopped, the provider gives up the vip to other replicas once it exists
+	// and keeps forwarding the established connections until drain timeout
+	drainFile = "/tmp/ipvsdr-draining"
+	// drainGracePeriod is the extra seconds for provider to stop after draining
+	drainGracePeriod = 10
+)
+
+// lifecycle returns the hooks of provider container, the preStop hook signals
+// provider to drain and blocks until drain timeout, kubernetes runs it before
+// sending SIGTERM, both when scaling down and when deleting or relocating pods
+func (f *ipvsdr) lifecycle() *v1.Lifecycle {
+	if f.drainTimeout <= 0 {
+		return nil
+	}
+	return &v1.Lifecycle{
+		PreStop: &v1.Handler{
+			Exec: &v1.ExecAction{
+				Command: []string{
+					"/bin/sh",
+					"-c",
+					fmt.Sprintf("touch %s && sleep %d", drainFile, f.drainTimeout),
+				},
+			},
+		},
+	}
+}
+
+// terminationGracePeriodSeconds returns the grace period of provider pods,
+// which must be longer than drain timeout otherwise the preStop hook is killed
+func (f *ipvsdr) terminationGracePeriodSeconds() int64 {
+	if f.drainTimeout <= 0 {
+		return 30
+	}
+	return int64(f.drainTimeout + drainGracePeriod)
+}
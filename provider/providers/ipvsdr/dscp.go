@@ -0,0 +1,69 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// dscpConfig passes the DSCP mark set in spec to provider pods, which mark
+// the traffic egressing the vips in the mangle table of iptables
+func dscpConfig(lb *netv1alpha1.LoadBalancer, data map[string]string) {
+	if dscp := lb.Spec.Providers.Ipvsdr.DSCP; dscp != nil {
+		data["dscp"] = strconv.Itoa(int(*dscp))
+	}
+}
+
+// dscpCondition verifies the DSCP mark published by the instances of ready
+// pods against spec, ok is false if no mark is set in spec
+func dscpCondition(lb *netv1alpha1.LoadBalancer, instances []netv1alpha1.IpvsdrInstanceStatus, ready map[string]bool) (netv1alpha1.LoadBalancerCondition, bool) {
+	dscp := lb.Spec.Providers.Ipvsdr.DSCP
+	if dscp == nil {
+		return netv1alpha1.LoadBalancerCondition{}, false
+	}
+
+	if len(ready) == 0 {
+		return lbutil.NewCondition(netv1alpha1.LoadBalancerDSCPApplied, v1.ConditionFalse, "NoReadyPods",
+			fmt.Sprintf("dscp %d is not applied by any ready ipvsdr pod", *dscp)), true
+	}
+
+	published := make(map[string]*int32, len(instances))
+	for _, instance := range instances {
+		published[instance.PodName] = instance.DSCP
+	}
+	pending := []string{}
+	for pod := range ready {
+		if mark := published[pod]; mark == nil || *mark != *dscp {
+			pending = append(pending, pod)
+		}
+	}
+	if len(pending) != 0 {
+		sort.Strings(pending)
+		return lbutil.NewCondition(netv1alpha1.LoadBalancerDSCPApplied, v1.ConditionFalse, "Pending",
+			fmt.Sprintf("dscp %d is not applied by ipvsdr pods %s", *dscp, strings.Join(pending, ", "))), true
+	}
+	return lbutil.NewCondition(netv1alpha1.LoadBalancerDSCPApplied, v1.ConditionTrue, "Applied",
+		fmt.Sprintf("dscp %d is applied by %d ipvsdr pods", *dscp, len(ready))), true
+}
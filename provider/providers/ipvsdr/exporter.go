@@ -0,0 +1,158 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	exporterContainerName = "ipvs-exporter"
+	exporterPortName      = "metrics"
+	// scrape annotations discovered by prometheus
+	scrapeAnnotationKey = "prometheus.io/scrape"
+	portAnnotationKey   = "prometheus.io/port"
+)
+
+// metricsPort returns the port of ipvs exporter of lb, ok is false if the
+// exporter is not run in provider pods
+func (f *ipvsdr) metricsPort(lb *netv1alpha1.LoadBalancer) (int32, bool) {
+	metrics := lb.Spec.Providers.Ipvsdr.Metrics
+	if metrics == nil || f.exporterImage == "" {
+		return 0, false
+	}
+	if metrics.Port == 0 {
+		return netv1alpha1.DefaultIpvsdrMetricsPort, true
+	}
+	return metrics.Port, true
+}
+
+// exporterContainers returns the ipvs exporter sidecar which exports the
+// traffic of the virtual and real servers of vips, the ones of other
+// loadbalancers on the same nodes are filtered out. It reads ipvs by netlink
+// in host network, which needs NET_ADMIN only
+func (f *ipvsdr) exporterContainers(lb *netv1alpha1.LoadBalancer) []v1.Container {
+	port, ok := f.metricsPort(lb)
+	if !ok {
+		return nil
+	}
+	return []v1.Container{
+		{
+			Name:            exporterContainerName,
+			Image:           f.exporterImage,
+			ImagePullPolicy: v1.PullIfNotPresent,
+			Args: []string{
+				"--web.listen-address=:" + strconv.Itoa(int(port)),
+				"--ipvs.vips=" + strings.Join(allVips(lb), ","),
+			},
+			Ports: []v1.ContainerPort{
+				{
+					Name:          exporterPortName,
+					ContainerPort: port,
+					HostPort:      port,
+					Protocol:      v1.ProtocolTCP,
+				},
+			},
+			Resources: v1.ResourceRequirements{
+				Limits: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse("50m"),
+					v1.ResourceMemory: resource.MustParse("30Mi"),
+				},
+			},
+			SecurityContext: &v1.SecurityContext{
+				Capabilities: &v1.Capabilities{
+					Add: []v1.Capability{"NET_ADMIN"},
+				},
+			},
+		},
+	}
+}
+
+// setScrapeAnnotations annotates the pod template to be scraped if the
+// exporter is run, otherwise the annotations are removed
+func (f *ipvsdr) setScrapeAnnotations(lb *netv1alpha1.LoadBalancer, template *v1.PodTemplateSpec) {
+	port, ok := f.metricsPort(lb)
+	if !ok {
+		delete(template.Annotations, scrapeAnnotationKey)
+		delete(template.Annotations, portAnnotationKey)
+		return
+	}
+	if template.Annotations == nil {
+		template.Annotations = make(map[string]string)
+	}
+	template.Annotations[scrapeAnnotationKey] = "true"
+	template.Annotations[portAnnotationKey] = strconv.Itoa(int(port))
+}
+
+// ensureExporter corrects the sidecars and scrape annotations of the pod
+// template copied from the existing workload, and returns whether they are
+// changed. The containers other than the exporter are kept in place
+func ensureExporter(desired, copied, old *v1.PodTemplateSpec) bool {
+	containers := make([]v1.Container, 0, len(copied.Spec.Containers))
+	for _, c := range copied.Spec.Containers {
+		if c.Name != exporterContainerName {
+			containers = append(containers, c)
+		}
+	}
+	copied.Spec.Containers = append(containers, exporters(desired.Spec.Containers)...)
+	for _, key := range []string{scrapeAnnotationKey, portAnnotationKey} {
+		if value, ok := desired.Annotations[key]; ok {
+			copied.Annotations[key] = value
+		} else {
+			delete(copied.Annotations, key)
+		}
+	}
+	return sidecarsChanged(exporters(copied.Spec.Containers), exporters(old.Spec.Containers)) ||
+		copied.Annotations[scrapeAnnotationKey] != old.Annotations[scrapeAnnotationKey] ||
+		copied.Annotations[portAnnotationKey] != old.Annotations[portAnnotationKey]
+}
+
+// exporters returns the exporter sidecars in containers
+func exporters(containers []v1.Container) []v1.Container {
+	var sidecars []v1.Container
+	for _, c := range containers {
+		if c.Name == exporterContainerName {
+			sidecars = append(sidecars, c)
+		}
+	}
+	return sidecars
+}
+
+// sidecarsChanged compares the fields of sidecars set by controller, the
+// others are defaulted by apiserver
+func sidecarsChanged(desired, old []v1.Container) bool {
+	if len(desired) != len(old) {
+		return true
+	}
+	for i := range desired {
+		if desired[i].Name != old[i].Name ||
+			desired[i].Image != old[i].Image ||
+			!reflect.DeepEqual(desired[i].Args, old[i].Args) ||
+			!reflect.DeepEqual(desired[i].Ports, old[i].Ports) ||
+			!reflect.DeepEqual(desired[i].SecurityContext, old[i].SecurityContext) {
+			return true
+		}
+	}
+	return false
+}
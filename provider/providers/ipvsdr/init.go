@@ -0,0 +1,123 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+	"reflect"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	initContainerName = "init-modules"
+)
+
+// images returns the provider and init images of lb, which can be overridden
+// in spec, otherwise the provider image is picked by the rollout of canary
+// image. Empty init image means that modules are loaded by the privileged
+// provider container
+func (f *ipvsdr) images(lb *netv1alpha1.LoadBalancer) (string, string) {
+	image, initImage := f.rollout.Image(lb), f.initImage
+	if spec := lb.Spec.Providers.Ipvsdr; spec != nil {
+		if spec.Image != "" {
+			image = spec.Image
+		}
+		if spec.InitImage != "" {
+			initImage = spec.InitImage
+		}
+	}
+	return image, initImage
+}
+
+// initContainers returns the privileged init container which loads ipvs modules
+// of the scheduler and enables ip forwarding on the node. It stays privileged
+// in unprivileged pods, since the sysctls of node are read only otherwise
+func (f *ipvsdr) initContainers(lb *netv1alpha1.LoadBalancer) []v1.Container {
+	_, image := f.images(lb)
+	if image == "" {
+		return nil
+	}
+	scheduler := netv1alpha1.IpvsSchedulerRR
+	if lb.Spec.Providers.Ipvsdr != nil && lb.Spec.Providers.Ipvsdr.Scheduler != "" {
+		scheduler = lb.Spec.Providers.Ipvsdr.Scheduler
+	}
+	privileged := true
+	return []v1.Container{
+		{
+			Name:            initContainerName,
+			Image:           image,
+			ImagePullPolicy: v1.PullIfNotPresent,
+			Command: []string{
+				"/bin/sh",
+				"-c",
+				fmt.Sprintf("modprobe ip_vs && modprobe ip_vs_%s && sysctl -w net.ipv4.ip_forward=1", scheduler),
+			},
+			SecurityContext: &v1.SecurityContext{
+				Privileged: &privileged,
+			},
+			VolumeMounts: []v1.VolumeMount{
+				{
+					Name:      "modules",
+					MountPath: "/lib/modules",
+					ReadOnly:  true,
+				},
+			},
+		},
+	}
+}
+
+// securityContext returns the security context of provider container, it keeps
+// only the capabilities of managing ipvs and sending vrrp adverts when modules
+// are loaded by init container. Unprivileged pods load the modules with
+// SYS_MODULE capability instead of privileged mode
+func (f *ipvsdr) securityContext(lb *netv1alpha1.LoadBalancer) *v1.SecurityContext {
+	capabilities := []v1.Capability{"NET_ADMIN", "NET_RAW"}
+	if _, initImage := f.images(lb); initImage == "" {
+		if !f.security.Unprivileged {
+			privileged := true
+			return &v1.SecurityContext{
+				Privileged: &privileged,
+			}
+		}
+		capabilities = append(capabilities, "SYS_MODULE")
+	}
+	return &v1.SecurityContext{
+		Capabilities: &v1.Capabilities{
+			Add: capabilities,
+		},
+	}
+}
+
+// initContainersChanged compares the fields of init containers set by
+// controller, the others are defaulted by apiserver
+func initContainersChanged(desired, old []v1.Container) bool {
+	if len(desired) != len(old) {
+		return true
+	}
+	for i := range desired {
+		if desired[i].Name != old[i].Name ||
+			desired[i].Image != old[i].Image ||
+			!reflect.DeepEqual(desired[i].Command, old[i].Command) ||
+			!reflect.DeepEqual(desired[i].SecurityContext, old[i].SecurityContext) ||
+			!reflect.DeepEqual(desired[i].VolumeMounts, old[i].VolumeMounts) {
+			return true
+		}
+	}
+	return false
+}
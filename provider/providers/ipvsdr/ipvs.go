@@ -0,0 +1,55 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"strconv"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+)
+
+// persistenceTimeout returns the persistence timeout of ipvs in spec, 0 if
+// persistence is disabled
+func persistenceTimeout(lb *netv1alpha1.LoadBalancer) int32 {
+	if params := lb.Spec.Providers.Ipvsdr.IPVS; params != nil {
+		return params.PersistenceTimeout
+	}
+	return 0
+}
+
+// ipvsConfig passes the ipvs parameters set in spec to provider pods, the
+// sync daemon uses the vrid of vip as sync id
+func ipvsConfig(lb *netv1alpha1.LoadBalancer, data map[string]string) {
+	params := lb.Spec.Providers.Ipvsdr.IPVS
+	if params == nil {
+		return
+	}
+
+	add := func(key string, value int32) {
+		if value > 0 {
+			data[key] = strconv.Itoa(int(value))
+		}
+	}
+	add("persistence-timeout", params.PersistenceTimeout)
+	if params.SyncDaemon {
+		data["sync-daemon"] = "true"
+	}
+	add("tcp-timeout", params.TCPTimeout)
+	add("tcpfin-timeout", params.TCPFinTimeout)
+	add("udp-timeout", params.UDPTimeout)
+	add("max-connections", params.MaxConnections)
+}
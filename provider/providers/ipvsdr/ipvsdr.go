@@ -17,37 +17,44 @@ limitations under the License.
 package ipvsdr
 
 import (
+	"expvar"
 	"fmt"
-	"math/rand"
 	"reflect"
-	"strings"
 	"time"
 
-	log "github.com/zoumo/logdog"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
 
 	"github.com/caicloud/loadbalancer-controller/config"
 	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/custommetrics"
 	"github.com/caicloud/loadbalancer-controller/pkg/informers"
+	"github.com/caicloud/loadbalancer-controller/pkg/ipam"
 	netlisters "github.com/caicloud/loadbalancer-controller/pkg/listers/networking/v1alpha1"
-	"github.com/caicloud/loadbalancer-controller/pkg/toleration"
+	"github.com/caicloud/loadbalancer-controller/pkg/metrics"
+	"github.com/caicloud/loadbalancer-controller/pkg/plugin"
 	"github.com/caicloud/loadbalancer-controller/pkg/tprclient"
+	"github.com/caicloud/loadbalancer-controller/pkg/util/audit"
+	"github.com/caicloud/loadbalancer-controller/pkg/util/canary"
 	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
 	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
 	"github.com/caicloud/loadbalancer-controller/pkg/util/validation"
 	"github.com/caicloud/loadbalancer-controller/provider"
 
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
 	corelisters "k8s.io/client-go/listers/core/v1"
 	extensionslisters "k8s.io/client-go/listers/extensions/v1beta1"
 	"k8s.io/client-go/pkg/api/v1"
 	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
-	"k8s.io/kubernetes/pkg/controller"
 )
 
 const (
@@ -55,9 +62,15 @@ const (
 	providerName       = "ipvsdr"
 )
 
+// finalizer blocks the deletion of loadbalancer until ipvsdr provider is cleaned up
+var finalizer = fmt.Sprintf(netv1alpha1.FinalizerFormat, providerName)
+
 // controllerKind contains the schema.GroupVersionKind for this controller type.
 var controllerKind = netv1alpha1.SchemeGroupVersion.WithKind(netv1alpha1.LoadBalancerKind)
 
+// logger logs with the level of ipvsdr provider
+var logger = log.For(providerName)
+
 func init() {
 	provider.RegisterPlugin(providerName, NewIpvsdr())
 }
@@ -67,18 +80,48 @@ var _ provider.Plugin = &ipvsdr{}
 type ipvsdr struct {
 	initialized bool
 
-	image string
+	image        string
+	rollout      *canary.Rollout
+	initImage    string
+	probeImage   string
+	antiAffinity string
+	drainTimeout int
+	workers      int
+	// dataplaneBackend is the default netfilter backend of provider pods
+	dataplaneBackend netv1alpha1.DataplaneBackend
+	// exporterImage is the image of ipvs exporter sidecar, which is not run
+	// if it is empty
+	exporterImage string
+	// security configures the ServiceAccount and privileges of provider pods
+	security config.Security
+	// monitoring generates the PodMonitor of provider pods if enabled
+	monitoring config.Monitoring
 
 	client    kubernetes.Interface
 	tprclient tprclient.Interface
 
 	helper *controllerutil.Helper
-
-	lbLister  netlisters.LoadBalancerLister
-	dLister   extensionslisters.DeploymentLister
-	podLister corelisters.PodLister
-
-	queue workqueue.RateLimitingInterface
+	// workloads reconciles the deployments and daemonsets of provider
+	workloads *plugin.Reconciler
+
+	lbLister   netlisters.LoadBalancerLister
+	dLister    extensionslisters.DeploymentLister
+	dsLister   extensionslisters.DaemonSetLister
+	podLister  corelisters.PodLister
+	nodeLister corelisters.NodeLister
+	jobLister  batchlisters.JobLister
+	epLister   corelisters.EndpointsLister
+	svcLister  corelisters.ServiceLister
+
+	queue    workqueue.RateLimitingInterface
+	recorder record.EventRecorder
+
+	// backends are synced in a separate queue as the fast path of endpoints changes
+	backendsQueue  workqueue.RateLimitingInterface
+	backendsHelper *controllerutil.Helper
+
+	vrids *vridAllocator
+	vips  *ipam.Allocator
 }
 
 // NewIpvsdr creates a new ipvsdr provider plugin
@@ -86,58 +129,152 @@ func NewIpvsdr() provider.Plugin {
 	return &ipvsdr{}
 }
 
+// ValidateConfig validates the ipvsdr section of configuration
+func (f *ipvsdr) ValidateConfig(cfg config.Configuration) error {
+	c := cfg.Providers.Ipvsdr
+	if c.Image == "" {
+		return fmt.Errorf("providers.ipvsdr.image is empty")
+	}
+	if _, err := parseVRIDs(c.ReservedVRIDs); err != nil {
+		return fmt.Errorf("providers.ipvsdr.reservedVRIDs: %v", err)
+	}
+	if _, err := ipam.ParsePools(c.VipPools); err != nil {
+		return fmt.Errorf("providers.ipvsdr.vipPools: %v", err)
+	}
+	if c.DrainTimeout < 0 {
+		return fmt.Errorf("providers.ipvsdr.drainTimeout must be non-negative")
+	}
+	if c.Workers <= 0 {
+		return fmt.Errorf("providers.ipvsdr.workers must be positive")
+	}
+	if c.ReleaseCooldown < 0 {
+		return fmt.Errorf("providers.ipvsdr.releaseCooldown must be non-negative")
+	}
+	if err := validation.ValidateDataplaneBackend(netv1alpha1.DataplaneBackend(c.DataplaneBackend)); err != nil {
+		return fmt.Errorf("providers.ipvsdr.dataplaneBackend: %v", err)
+	}
+	return nil
+}
+
 func (f *ipvsdr) Init(cfg config.Configuration, sif informers.SharedInformerFactory) {
 	if f.initialized {
 		return
 	}
 	f.initialized = true
 
-	log.Info("Initialize the ipvsdr provider")
+	logger.Info("Initialize the ipvsdr provider")
 
 	// set config
 	f.image = cfg.Providers.Ipvsdr.Image
-	f.client = cfg.Client
-	f.tprclient = cfg.TPRClient
+	f.rollout = canary.NewRollout(providerName, cfg.Providers.Ipvsdr.Image, cfg.Providers.Ipvsdr.CanaryImage, cfg.Rollout)
+	f.initImage = cfg.Providers.Ipvsdr.InitImage
+	f.probeImage = cfg.Providers.Ipvsdr.ProbeImage
+	f.exporterImage = cfg.Providers.Ipvsdr.ExporterImage
+	f.antiAffinity = cfg.Providers.AntiAffinity
+	f.drainTimeout = cfg.Providers.Ipvsdr.DrainTimeout
+	f.workers = cfg.Providers.Ipvsdr.Workers
+	f.dataplaneBackend = netv1alpha1.DataplaneBackend(cfg.Providers.Ipvsdr.DataplaneBackend)
+	f.security = cfg.Security
+	f.monitoring = cfg.Monitoring
+	f.client, f.tprclient = cfg.PluginClients(providerName)
+	f.recorder = cfg.Recorder
 
 	// initialize controller
 	lbInformer := sif.Networking().V1alpha1().LoadBalancer()
 	dInformer := sif.Extensions().V1beta1().Deployments()
+	dsInformer := sif.Extensions().V1beta1().DaemonSets()
 	podInfomer := sif.Core().V1().Pods()
+	nodeInformer := sif.Core().V1().Nodes()
+	jobInformer := sif.Batch().V1().Jobs()
+	epInformer := sif.Core().V1().Endpoints()
 
 	f.lbLister = lbInformer.Lister()
 	f.dLister = dInformer.Lister()
+	f.dsLister = dsInformer.Lister()
 	f.podLister = podInfomer.Lister()
+	f.nodeLister = nodeInformer.Lister()
+	f.jobLister = jobInformer.Lister()
+	f.epLister = epInformer.Lister()
+	f.svcLister = sif.Core().V1().Services().Lister()
+
+	f.workloads = &plugin.Reconciler{
+		Name:      providerName,
+		Component: "provider-" + providerName,
+		Selector:  f.selector,
+		Renderer:  renderer{f},
+		Client:    f.client,
+		TPRClient: f.tprclient,
+		DLister:   f.dLister,
+		DSLister:  f.dsLister,
+		Recorder:  f.recorder,
+	}
+
+	reserved, err := parseVRIDs(cfg.Providers.Ipvsdr.ReservedVRIDs)
+	if err != nil {
+		logger.Fatal("Invalid reserved vrids of ipvsdr provider", log.Fields{"err": err})
+	}
+	cooldown := time.Duration(cfg.Providers.Ipvsdr.ReleaseCooldown) * time.Second
+	f.vrids = newVRIDAllocator(f.lbLister, reserved, cooldown)
+
+	pools, err := ipam.ParsePools(cfg.Providers.Ipvsdr.VipPools)
+	if err != nil {
+		logger.Fatal("Invalid vip pools of ipvsdr provider", log.Fields{"err": err})
+	}
+	f.vips = ipam.NewAllocator(pools, cooldown)
+
+	metrics.IpvsdrQuarantined.Set("vip", expvar.Func(func() interface{} { return f.vips.Quarantined() }))
+	metrics.IpvsdrQuarantined.Set("vrid", expvar.Func(func() interface{} { return f.vrids.quarantined() }))
 
-	f.queue = workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "provider-ipvsdr")
+	f.queue = workqueue.NewNamedRateLimitingQueue(cfg.RateLimiter.New(), "provider-ipvsdr")
 	f.helper = controllerutil.NewHelperForKeyFunc(&netv1alpha1.LoadBalancer{}, f.queue, f.syncLoadBalancer, controllerutil.PassthroughKeyFunc)
+	f.helper.Name = "provider-ipvsdr"
+	f.helper.SyncFailureHandler = lbutil.NewSyncFailureHandler(f.helper.Name, f.tprclient, f.recorder)
+
+	f.backendsQueue = workqueue.NewNamedRateLimitingQueue(cfg.RateLimiter.New(), "provider-ipvsdr-backends")
+	f.backendsHelper = controllerutil.NewHelperForKeyFunc(&netv1alpha1.LoadBalancer{}, f.backendsQueue, f.syncBackends, controllerutil.PassthroughKeyFunc)
+	f.backendsHelper.Name = "provider-ipvsdr-backends"
 
 	dInformer.Informer().AddEventHandler(lbutil.NewEventHandlerForDeployment(f.lbLister, f.dLister, f.helper, f.deploymentFiltered))
+	dsInformer.Informer().AddEventHandler(lbutil.NewEventHandlerForDaemonSet(f.lbLister, f.helper, f.daemonSetFiltered))
 	podInfomer.Informer().AddEventHandler(lbutil.NewEventHandlerForSyncStatusWithPod(f.lbLister, f.podLister, f.helper, f.podFiltered))
+	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: f.updateNode,
+	})
+	jobInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: f.updateProbeJob,
+	})
+	epInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    f.enqueueBackendsForEndpoints,
+		UpdateFunc: f.updateEndpoints,
+		DeleteFunc: f.enqueueBackendsForEndpoints,
+	})
 }
 
 func (f *ipvsdr) Run(stopCh <-chan struct{}) {
 
-	workers := 1
+	workers := f.workers
 
 	if !f.initialized {
-		log.Panic("Please initialize provider before you run it")
+		logger.Panic("Please initialize provider before you run it")
 		return
 	}
 
 	defer utilruntime.HandleCrash()
 
-	log.Info("Starting ipvsdr provider", log.Fields{"workers": workers, "image": f.image})
-	defer log.Info("Shutting down ipvsdr provider")
+	logger.Info("Starting ipvsdr provider", log.Fields{"workers": workers, "image": f.image, "initImage": f.initImage})
+	defer logger.Info("Shutting down ipvsdr provider")
 
 	// lb controller has waited all the informer synced
 	// there is no need to wait again here
 
 	defer func() {
-		log.Info("Shutting down ipvsdr provider")
+		logger.Info("Shutting down ipvsdr provider")
 		f.helper.ShutDown()
+		f.backendsHelper.ShutDown()
 	}()
 
 	f.helper.Run(workers, stopCh)
+	f.backendsHelper.Run(workers, stopCh)
 
 	<-stopCh
 }
@@ -167,12 +304,30 @@ func (f *ipvsdr) filteredByLabel(obj metav1.ObjectMetaAccessor) bool {
 }
 
 func (f *ipvsdr) OnSync(lb *netv1alpha1.LoadBalancer) {
-	if lb.Spec.Type != netv1alpha1.LoadBalancerTypeExternal && lb.Spec.Providers.Ipvsdr != nil {
+	if !f.responsible(lb) && !lbutil.HasFinalizer(lb, finalizer) {
 		// It is not my responsible
 		return
 	}
-	log.Info("Syncing providers, triggered by lb controller", log.Fields{"lb": lb.Name, "namespace": lb.Namespace})
+	logger.Info("Syncing providers, triggered by lb controller", log.Fields{"lb": lb.Name, "namespace": lb.Namespace})
 	f.helper.Enqueue(lb)
+	f.enqueueVipUsers(lb)
+}
+
+// ForceResync re-reconciles the provider and backends of loadbalancer
+func (f *ipvsdr) ForceResync(namespace, name string) error {
+	lb, err := f.lbLister.LoadBalancers(namespace).Get(name)
+	if err != nil {
+		return err
+	}
+	f.OnSync(lb)
+	if f.responsible(lb) {
+		f.backendsHelper.Enqueue(lb)
+	}
+	return nil
+}
+
+func (f *ipvsdr) responsible(lb *netv1alpha1.LoadBalancer) bool {
+	return lb.Spec.Type == netv1alpha1.LoadBalancerTypeExternal && lb.Spec.Providers.Ipvsdr != nil
 }
 
 func (f *ipvsdr) syncLoadBalancer(obj interface{}) error {
@@ -181,22 +336,22 @@ func (f *ipvsdr) syncLoadBalancer(obj interface{}) error {
 		return fmt.Errorf("expect loadbalancer, got %v", obj)
 	}
 
-	// Validate loadbalancer scheme
-	if err := validation.ValidateLoadBalancer(lb); err != nil {
-		log.Debug("invalid loadbalancer scheme", log.Fields{"err": err})
-		return err
-	}
-
 	key, _ := controllerutil.KeyFunc(lb)
 
 	startTime := time.Now()
 	defer func() {
-		log.Debug("Finished syncing ipvsdr provider", log.Fields{"lb": key, "usedTime": time.Since(startTime)})
+		logger.Debug("Finished syncing ipvsdr provider", log.Fields{"lb": key, "usedTime": time.Since(startTime)})
 	}()
 
 	nlb, err := f.lbLister.LoadBalancers(lb.Namespace).Get(lb.Name)
 	if errors.IsNotFound(err) {
-		log.Warn("LoadBalancer has been deleted, clean up provider", log.Fields{"lb": key})
+		if !lbutil.IsOwned(lb) {
+			return nil
+		}
+		if lbutil.IsDryRun(lb) {
+			return f.plan(lb, true)
+		}
+		logger.Warn("LoadBalancer has been deleted, clean up provider", log.Fields{"lb": key})
 
 		return f.cleanup(lb)
 	}
@@ -211,102 +366,93 @@ func (f *ipvsdr) syncLoadBalancer(obj interface{}) error {
 	}
 	lb = nlb
 
-	ds, err := f.getDeploymentsForLoadBalancer(lb)
-	if err != nil {
-		return err
-	}
-
-	if lb.DeletionTimestamp != nil {
-		// TODO sync status only
+	if !lbutil.IsOwned(lb) {
+		// reconciled by another controller
 		return nil
 	}
 
-	return f.sync(lb, ds)
-}
-
-func (f *ipvsdr) getDeploymentsForLoadBalancer(lb *netv1alpha1.LoadBalancer) ([]*extensions.Deployment, error) {
+	// loadbalancer is being deleted or provider has been removed from spec
+	deleting := lb.DeletionTimestamp != nil || !f.responsible(lb)
+	if !deleting {
+		// validate loadbalancer scheme, the cleanup of a loadbalancer being
+		// deleted never depends on a valid spec
+		if err := validation.ValidateLoadBalancer(lb); err != nil {
+			logger.Debug("invalid loadbalancer scheme", log.Fields{"err": err})
+			return err
+		}
+	}
 
-	// construct selector
-	selector := f.selector(lb).AsSelector()
+	if lbutil.IsDryRun(lb) {
+		return f.plan(lb, false)
+	}
 
-	// list all
-	dList, err := f.dLister.Deployments(lb.Namespace).List(selector)
-	if err != nil {
-		return nil, err
+	if deleting {
+		return f.finalize(lb)
 	}
 
-	// If any adoptions are attempted, we should first recheck for deletion with
-	// an uncached quorum read sometime after listing deployment (see kubernetes#42639).
-	canAdoptFunc := controller.RecheckDeletionTimestamp(func() (metav1.Object, error) {
-		// fresh lb
-		fresh, err := f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace).Get(lb.Name, metav1.GetOptions{})
-		if err != nil {
-			return nil, err
-		}
+	if lbutil.IsPaused(lb) {
+		logger.Debug("LoadBalancer is paused, skip syncing ipvsdr provider", log.Fields{"lb": key})
+		return nil
+	}
 
-		if fresh.UID != lb.UID {
-			return nil, fmt.Errorf("original LoadBalancer %v/%v is gone: got uid %v, wanted %v", lb.Namespace, lb.Name, fresh.UID, lb.UID)
-		}
-		return fresh, nil
-	})
+	if lbutil.IsQuotaExceeded(lb) {
+		logger.Debug("LoadBalancer exceeds quota, skip syncing ipvsdr provider", log.Fields{"lb": key})
+		return nil
+	}
 
-	cm := controllerutil.NewDeploymentControllerRefManager(f.client, lb, selector, controllerKind, canAdoptFunc)
-	return cm.Claim(dList)
-}
+	err = lbutil.AddFinalizer(f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, finalizer)
+	if err != nil {
+		logger.Error("Add ipvsdr finalizer error", log.Fields{"lb": key, "err": err})
+		return err
+	}
 
-// sync generate desired deployment from lb and compare it with existing deployment
-func (f *ipvsdr) sync(lb *netv1alpha1.LoadBalancer, dps []*extensions.Deployment) error {
-	desiredDeploy := f.generateDeployment(lb)
-
-	// update
-	updated := false
-	activeDeploy := desiredDeploy
-
-	for _, dp := range dps {
-		// two conditions will trigger controller to scale down deployment
-		// 1. deployment does not have auto-generated prefix
-		// 2. if there are more than one active controllers, there may be many valid deployments.
-		//    But we only need one.
-		if !strings.HasPrefix(dp.Name, lb.Name+providerNameSuffix) || updated {
-			if *dp.Spec.Replicas == 0 {
-				continue
-			}
-			// scale unexpected deployment replicas to zero
-			log.Info("Scale unexpected provider replicas to zero", log.Fields{"d.name": dp.Name, "lb.name": lb.Name})
-			copy, _ := lbutil.DeploymentDeepCopy(dp)
-			replica := int32(0)
-			copy.Spec.Replicas = &replica
-			f.client.ExtensionsV1beta1().Deployments(lb.Namespace).Update(copy)
-			continue
-		}
+	if lb.Spec.Providers.Ipvsdr.Vip == "" {
+		// lb will be resynced after the vip is written back to spec
+		return f.allocateVip(lb)
+	}
 
-		updated = true
-		copyDp, changed, err := f.ensureDeployment(desiredDeploy, dp)
-		if err != nil {
-			continue
-		}
-		if changed {
-			log.Info("Sync ipvsdr for lb", log.Fields{"d.name": dp.Name, "lb.name": lb.Name})
-			_, err = f.client.ExtensionsV1beta1().Deployments(lb.Namespace).Update(copyDp)
-			if err != nil {
-				return err
-			}
-		}
+	result := lbutil.NewProviderResult(providerName)
+	share, err := f.vipShare(lb)
+	if err != nil {
+		// provisioning is blocked until the conflict is resolved
+		logger.Warn("Vip sharing conflict detected, provisioning is blocked", log.Fields{"lb": key, "err": err})
+		result.Block(lbutil.EventReasonVipConflict, err.Error())
+		result.SetConditions(lbutil.NewCondition(netv1alpha1.LoadBalancerVIPConflict, v1.ConditionTrue, reasonSharingConflict, err.Error()))
+		return lbutil.ReportResult(lb, result)
+	}
+	if err = f.syncShareCondition(lb, share); err != nil {
+		return err
+	}
+	if err := f.nodePortConflict(lb); err != nil {
+		// provisioning is blocked until the conflict is resolved
+		logger.Warn("Port conflict detected on nodes, provisioning is blocked", log.Fields{"lb": key, "err": err})
+		result.Warn(lbutil.EventReasonPortConflict, err.Error())
+		result.SetConditions(lbutil.NewCondition(netv1alpha1.LoadBalancerProviderConfigured, v1.ConditionFalse, lbutil.EventReasonPortConflict, err.Error()))
+		return lbutil.ReportResult(lb, result)
+	}
 
-		activeDeploy = copyDp
+	dps, err := f.workloads.ClaimDeployments(lb)
+	if err != nil {
+		return err
+	}
+	dss, err := f.workloads.ClaimDaemonSets(lb)
+	if err != nil {
+		return err
 	}
 
-	// len(dps) == 0 or no deployment's name match desired deployment
-	if !updated {
-		// create deployment
-		log.Info("Create ipvsdr for lb", log.Fields{"d.name": desiredDeploy.Name, "lb.name": lb.Name})
-		_, err := f.client.ExtensionsV1beta1().Deployments(lb.Namespace).Create(desiredDeploy)
-		if err != nil {
-			return err
+	if len(dps) == 0 && len(dss) == 0 && share.isOwner(lb) {
+		// make sure the vip is not in use before provisioning, it is
+		// answered by the owner if lb is sharing the vip with others
+		free, perr := f.probeVip(lb)
+		if perr != nil || !free {
+			return perr
 		}
 	}
 
-	return f.syncStatus(lb, activeDeploy)
+	f.observeCanary(result, lb, dps, dss)
+
+	result.Err = f.workloads.Sync(result, lb, dps, dss)
+	return lbutil.ReportResult(lb, result)
 }
 
 func (f *ipvsdr) ensureDeployment(desiredDeploy, oldDeploy *extensions.Deployment) (*extensions.Deployment, bool, error) {
@@ -321,61 +467,239 @@ func (f *ipvsdr) ensureDeployment(desiredDeploy, oldDeploy *extensions.Deploymen
 	}
 	// ensure replicas
 	copyDp.Spec.Replicas = desiredDeploy.Spec.Replicas
-	// ensure image
-	copyDp.Spec.Template.Spec.Containers[0].Image = desiredDeploy.Spec.Template.Spec.Containers[0].Image
-	// ensure nodeaffinity
-	copyDp.Spec.Template.Spec.Affinity.NodeAffinity = desiredDeploy.Spec.Template.Spec.Affinity.NodeAffinity
+	// ensure strategy
+	copyDp.Spec.Strategy = desiredDeploy.Spec.Strategy
+	// ensure pod template
+	changes := f.ensurePodTemplate(&desiredDeploy.Spec.Template, &copyDp.Spec.Template, &oldDeploy.Spec.Template)
 
 	// check if changed
-	nodeAffinityChanged := !reflect.DeepEqual(copyDp.Spec.Template.Spec.Affinity.NodeAffinity, oldDeploy.Spec.Template.Spec.Affinity.NodeAffinity)
-	imageChanged := copyDp.Spec.Template.Spec.Containers[0].Image != oldDeploy.Spec.Template.Spec.Containers[0].Image
-	labelChanged := !reflect.DeepEqual(copyDp.Labels, oldDeploy.Labels)
-	replicasChanged := *(copyDp.Spec.Replicas) != *(oldDeploy.Spec.Replicas)
+	changes["labelChanged"] = !reflect.DeepEqual(copyDp.Labels, oldDeploy.Labels)
+	changes["replicasChanged"] = *(copyDp.Spec.Replicas) != *(oldDeploy.Spec.Replicas)
+	changes["strategyChanged"] = !reflect.DeepEqual(copyDp.Spec.Strategy, oldDeploy.Spec.Strategy)
 
-	changed := labelChanged || replicasChanged || nodeAffinityChanged || imageChanged
+	changed := anyChanged(changes)
 	if changed {
-		log.Info("Abount to correct ipvsdr provider", log.Fields{
-			"dp.name":             copyDp.Name,
-			"labelChanged":        labelChanged,
-			"replicasChanged":     replicasChanged,
-			"nodeAffinityChanged": nodeAffinityChanged,
-			"imageChanged":        imageChanged,
-		})
+		fields := log.Fields{"dp.name": copyDp.Name}
+		for k, v := range changes {
+			fields[k] = v
+		}
+		logger.Info("Abount to correct ipvsdr provider", fields)
 	}
+	audit.Compare(providerName, "Deployment", copyDp.Namespace+"/"+copyDp.Name, desiredDeploy.Spec, copyDp.Spec)
 
 	return copyDp, changed, nil
 }
 
+// ensurePodTemplate corrects the pod template copied from the existing workload
+// with the desired one, and returns which parts of the template are changed.
+// The provider container is found by name, the containers injected by others
+// may come before it
+func (f *ipvsdr) ensurePodTemplate(desired, copied, old *v1.PodTemplateSpec) map[string]bool {
+	want := providerContainer(desired)
+	container := providerContainer(copied)
+	if container == nil {
+		// removed by others, it is added back as a whole
+		copied.Spec.Containers = append([]v1.Container{*want}, copied.Spec.Containers...)
+		container = &copied.Spec.Containers[0]
+	}
+	// ensure image
+	container.Image = want.Image
+	// ensure init containers and privileges, the init containers in annotations
+	// override the field in apiserver, so they are removed
+	copied.Spec.InitContainers = desired.Spec.InitContainers
+	delete(copied.Annotations, v1.PodInitContainersBetaAnnotationKey)
+	delete(copied.Annotations, v1.PodInitContainersAnnotationKey)
+	container.SecurityContext = want.SecurityContext
+	copied.Spec.ServiceAccountName = desired.Spec.ServiceAccountName
+	copied.Spec.DeprecatedServiceAccount = desired.Spec.ServiceAccountName
+	// ensure resources
+	container.Resources = want.Resources
+	// ensure env
+	container.Env = want.Env
+	// ensure draining
+	container.Lifecycle = want.Lifecycle
+	copied.Spec.TerminationGracePeriodSeconds = desired.Spec.TerminationGracePeriodSeconds
+	// ensure nodeaffinity
+	copied.Spec.Affinity.NodeAffinity = desired.Spec.Affinity.NodeAffinity
+	// ensure podantiaffinity
+	copied.Spec.Affinity.PodAntiAffinity = desired.Spec.Affinity.PodAntiAffinity
+	// ensure placement in lb template
+	copied.Spec.Affinity.PodAffinity = desired.Spec.Affinity.PodAffinity
+	copied.Spec.NodeSelector = desired.Spec.NodeSelector
+	copied.Spec.Tolerations = desired.Spec.Tolerations
+	// ensure node addresses, pods will be recreated to reload if changed
+	if copied.Annotations == nil {
+		copied.Annotations = map[string]string{}
+	}
+	copied.Annotations[netv1alpha1.AnnotationKeyNodeAddresses] = desired.Annotations[netv1alpha1.AnnotationKeyNodeAddresses]
+	// ensure volumes
+	copied.Spec.Volumes = desired.Spec.Volumes
+	container.VolumeMounts = want.VolumeMounts
+	// ensure priority
+	priorityChanged := lbutil.EnsurePodPriority(desired, copied)
+	// ensure metrics exporter, it rebuilds the list of containers
+	exporterChanged := ensureExporter(desired, copied, old)
+
+	cur, last := providerContainer(copied), providerContainer(old)
+	if last == nil {
+		last = &v1.Container{}
+	}
+	changes := map[string]bool{
+		"priorityChanged":        priorityChanged,
+		"exporterChanged":        exporterChanged,
+		"nodeAffinityChanged":    !reflect.DeepEqual(copied.Spec.Affinity.NodeAffinity, old.Spec.Affinity.NodeAffinity),
+		"podAntiAffinityChanged": !reflect.DeepEqual(copied.Spec.Affinity.PodAntiAffinity, old.Spec.Affinity.PodAntiAffinity),
+		"placementChanged": !reflect.DeepEqual(copied.Spec.Affinity.PodAffinity, old.Spec.Affinity.PodAffinity) ||
+			!reflect.DeepEqual(copied.Spec.NodeSelector, old.Spec.NodeSelector) ||
+			!reflect.DeepEqual(copied.Spec.Tolerations, old.Spec.Tolerations),
+		"imageChanged": cur.Image != last.Image,
+		"initChanged": initContainersChanged(copied.Spec.InitContainers, old.Spec.InitContainers) ||
+			!reflect.DeepEqual(cur.SecurityContext, last.SecurityContext),
+		"envChanged":           !reflect.DeepEqual(cur.Env, last.Env),
+		"resourcesChanged":     !apiequality.Semantic.DeepEqual(cur.Resources, last.Resources),
+		"nodeAddressesChanged": copied.Annotations[netv1alpha1.AnnotationKeyNodeAddresses] != old.Annotations[netv1alpha1.AnnotationKeyNodeAddresses],
+		"volumesChanged": !reflect.DeepEqual(copied.Spec.Volumes, old.Spec.Volumes) ||
+			!reflect.DeepEqual(cur.VolumeMounts, last.VolumeMounts),
+		"drainChanged": !reflect.DeepEqual(cur.Lifecycle, last.Lifecycle) ||
+			!reflect.DeepEqual(copied.Spec.TerminationGracePeriodSeconds, old.Spec.TerminationGracePeriodSeconds),
+		"serviceAccountChanged": copied.Spec.ServiceAccountName != old.Spec.ServiceAccountName,
+	}
+	if anyChanged(changes) {
+		// relabel pods along with the rollout, the selector is not changed
+		for k, v := range desired.Labels {
+			copied.Labels[k] = v
+		}
+	}
+	return changes
+}
+
+// providerContainer returns the provider container in template, or nil if
+// there is none
+func providerContainer(template *v1.PodTemplateSpec) *v1.Container {
+	for i := range template.Spec.Containers {
+		if template.Spec.Containers[i].Name == providerName {
+			return &template.Spec.Containers[i]
+		}
+	}
+	return nil
+}
+
+// anyChanged returns true if any of the changes is true
+func anyChanged(changes map[string]bool) bool {
+	for _, changed := range changes {
+		if changed {
+			return true
+		}
+	}
+	return false
+}
+
 // cleanup deployment and other resource controlled by ipvsdr provider
 func (f *ipvsdr) cleanup(lb *netv1alpha1.LoadBalancer) error {
+	f.rollout.Forget(lb)
 
-	ds, err := f.getDeploymentsForLoadBalancer(lb)
+	err := f.workloads.Cleanup(lb)
 	if err != nil {
 		return err
 	}
 
-	policy := metav1.DeletePropagationForeground
-	gracePeriodSeconds := int64(30)
-	for _, d := range ds {
-		f.client.ExtensionsV1beta1().Deployments(d.Namespace).Delete(d.Name, &metav1.DeleteOptions{
-			GracePeriodSeconds: &gracePeriodSeconds,
-			PropagationPolicy:  &policy,
-		})
+	if err = f.cleanupProbeJobs(lb); err != nil {
+		logger.Warn("Cleanup arp probe jobs error", log.Fields{"err": err})
+		return err
 	}
 
+	// clean up config map
+	err = f.client.CoreV1().ConfigMaps(lb.Namespace).DeleteCollection(nil, metav1.ListOptions{
+		LabelSelector: f.selector(lb).String(),
+	})
+	if err != nil {
+		logger.Warn("Cleanup ConfigMap error", log.Fields{"err": err})
+		return err
+	}
+
+	if err = f.deleteVipEndpoints(lb); err != nil {
+		logger.Warn("Cleanup vip endpoints error", log.Fields{"err": err})
+		return err
+	}
+
+	if err = lbutil.DeletePodMonitor(f.client, lb.Namespace, fmt.Sprintf(podMonitorName, lb.Name)); err != nil {
+		logger.Warn("Cleanup PodMonitor error", log.Fields{"err": err})
+		return err
+	}
+
+	if f.security.ServiceAccounts {
+		if err = lbutil.DeleteServiceAccount(f.client, lb.Namespace, f.serviceAccountName(lb)); err != nil {
+			logger.Warn("Cleanup ServiceAccount error", log.Fields{"err": err})
+			return err
+		}
+	}
+
+	// release the allocations in memory, the vip and vrid in use are
+	// recovered from loadbalancers, so they are gone along with lb
+	key, _ := controllerutil.KeyFunc(lb)
+	f.vrids.release(lb)
+	f.vips.Release(key, allVips(lb)...)
+	metrics.SetImageUnavailable(providerName, key, false)
+	custommetrics.Delete(lb.Namespace, lb.Name)
+
+	f.recorder.Event(lb, v1.EventTypeNormal, lbutil.EventReasonCleanedUp, "Clean up ipvsdr provider")
 	return nil
 }
 
-func (f *ipvsdr) generateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.Deployment {
-	terminationGracePeriodSeconds := int64(30)
-	hostNetwork := true
-	replicas, _ := lbutil.CalculateReplicas(lb)
-	privileged := true
+// finalize cleans up ipvsdr provider and removes the finalizer from lb after
+// all deployments have gone, the vips are released along with the pods
+func (f *ipvsdr) finalize(lb *netv1alpha1.LoadBalancer) error {
+	if !lbutil.HasFinalizer(lb, finalizer) {
+		// not managed by ipvsdr provider
+		return nil
+	}
 
-	labels := f.selector(lb)
+	if err := f.cleanup(lb); err != nil {
+		return err
+	}
 
-	// run in this node
-	nodeAffinity := &v1.NodeAffinity{
+	// deployments and daemonsets are deleted in foreground, wait until they disappear
+	dps, err := f.dLister.Deployments(lb.Namespace).List(f.selector(lb).AsSelector())
+	if err != nil {
+		return err
+	}
+	if len(dps) != 0 {
+		return fmt.Errorf("waiting for %d ipvsdr deployments of %v/%v to be deleted", len(dps), lb.Namespace, lb.Name)
+	}
+	dss, err := f.dsLister.DaemonSets(lb.Namespace).List(f.selector(lb).AsSelector())
+	if err != nil {
+		return err
+	}
+	if len(dss) != 0 {
+		return fmt.Errorf("waiting for %d ipvsdr daemonsets of %v/%v to be deleted", len(dss), lb.Namespace, lb.Name)
+	}
+
+	if lb.DeletionTimestamp == nil {
+		// provider has been changed, the conditions are no longer reported by ipvsdr
+		err = lbutil.RemoveConditions(
+			f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
+			lb,
+			netv1alpha1.LoadBalancerProviderConfigured,
+			netv1alpha1.LoadBalancerProviderAvailable,
+			netv1alpha1.LoadBalancerVIPAssigned,
+			netv1alpha1.LoadBalancerVRIDAllocated,
+			netv1alpha1.LoadBalancerVipAllocated,
+			netv1alpha1.LoadBalancerVIPConflict,
+			netv1alpha1.LoadBalancerImageUnavailable,
+			netv1alpha1.LoadBalancerDSCPApplied,
+			netv1alpha1.LoadBalancerDataplaneUnsupported,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return lbutil.RemoveFinalizer(f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, finalizer)
+}
+
+// nodeAffinity runs pods on the nodes labeled for lb
+func (f *ipvsdr) nodeAffinity(lb *netv1alpha1.LoadBalancer) *v1.NodeAffinity {
+	return &v1.NodeAffinity{
 		RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
 			NodeSelectorTerms: []v1.NodeSelectorTerm{
 				{
@@ -390,26 +714,66 @@ func (f *ipvsdr) generateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.De
 			},
 		},
 	}
+}
 
-	// do not run with this pod
-	podAffinity := &v1.PodAntiAffinity{
+// podAntiAffinity keeps pods of lb on distinct nodes, and spreads them from
+// provider pods of other loadbalancers according to the cluster policy
+func (f *ipvsdr) podAntiAffinity(lb *netv1alpha1.LoadBalancer) *v1.PodAntiAffinity {
+	affinity := &v1.PodAntiAffinity{
 		RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{
 			{
 				LabelSelector: &metav1.LabelSelector{
-					MatchLabels: map[string]string{
-						netv1alpha1.LabelKeyProvider: providerName,
-					},
+					MatchLabels: f.selector(lb),
 				},
 				TopologyKey: metav1.LabelHostname,
 			},
 		},
 	}
 
+	// pods of all providers, regardless of the loadbalancer
+	term := v1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{
+					Key:      netv1alpha1.LabelKeyProvider,
+					Operator: metav1.LabelSelectorOpExists,
+				},
+			},
+		},
+		TopologyKey: metav1.LabelHostname,
+	}
+
+	switch f.antiAffinity {
+	case config.AntiAffinityRequired:
+		affinity.RequiredDuringSchedulingIgnoredDuringExecution = append(affinity.RequiredDuringSchedulingIgnoredDuringExecution, term)
+	case config.AntiAffinityPreferred:
+		affinity.PreferredDuringSchedulingIgnoredDuringExecution = []v1.WeightedPodAffinityTerm{
+			{
+				Weight:          100,
+				PodAffinityTerm: term,
+			},
+		}
+	}
+	return affinity
+}
+
+func (f *ipvsdr) generateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.Deployment {
+	terminationGracePeriodSeconds := f.terminationGracePeriodSeconds()
+	hostNetwork := lb.Spec.Providers.Ipvsdr.NetworkMode != netv1alpha1.NetworkModePod
+	replicas, _ := lbutil.CalculateReplicas(lb)
+	image, _ := f.images(lb)
+	defaultMode := v1.ConfigMapVolumeSourceDefaultMode
+
+	labels := lbutil.WithArtifactLabels(f.selector(lb), lb, "provider-"+providerName)
+
+	// do not run with this pod
+	podAffinity := f.podAntiAffinity(lb)
+
 	t := true
 
 	deploy := &extensions.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   lb.Name + providerNameSuffix + "-" + lbutil.RandStringBytesRmndr(5),
+			Name:   lbutil.WorkloadName(lb, "provider-"+providerName),
 			Labels: labels,
 			OwnerReferences: []metav1.OwnerReference{
 				{
@@ -424,43 +788,51 @@ func (f *ipvsdr) generateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.De
 		},
 		Spec: extensions.DeploymentSpec{
 			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: f.selector(lb),
+			},
+			Strategy: lbutil.DeploymentStrategy(lb),
 			Template: v1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
+					Annotations: map[string]string{
+						netv1alpha1.AnnotationKeyNodeAddresses: f.nodeAddresses(lb),
+					},
 				},
 				Spec: v1.PodSpec{
+					ServiceAccountName: f.serviceAccountName(lb),
 					// host network ?
 					HostNetwork: hostNetwork,
-					// TODO
+					// wait for draining
 					TerminationGracePeriodSeconds: &terminationGracePeriodSeconds,
-					Affinity: &v1.Affinity{
+					Affinity: lbutil.MergeAffinity(lb, &v1.Affinity{
 						// decide running on which node
-						NodeAffinity: nodeAffinity,
+						NodeAffinity: f.nodeAffinity(lb),
 						// don't co-locate pods of this deployment in same node
 						PodAntiAffinity: podAffinity,
-					},
+					}),
+					NodeSelector: lbutil.NodeSelector(lb),
 					// tolerate taints
-					Tolerations: toleration.GenerateTolerations(),
+					Tolerations: lbutil.Tolerations(lb),
+					// load modules before provider starts
+					InitContainers: f.initContainers(lb),
 					Containers: []v1.Container{
 						{
 							Name:            providerName,
-							Image:           f.image,
+							Image:           image,
 							ImagePullPolicy: v1.PullAlways,
-							Resources: v1.ResourceRequirements{
-								Limits: v1.ResourceList{
-									v1.ResourceCPU:    resource.MustParse("200m"),
-									v1.ResourceMemory: resource.MustParse("50Mi"),
-								},
-							},
-							SecurityContext: &v1.SecurityContext{
-								Privileged: &privileged,
-							},
+							Resources:       f.resources(lb),
+							Lifecycle:       f.lifecycle(),
+							SecurityContext: f.securityContext(lb),
 							Env: []v1.EnvVar{
 								{
 									Name: "POD_NAME",
 									ValueFrom: &v1.EnvVarSource{
 										FieldRef: &v1.ObjectFieldSelector{
-											FieldPath: "metadata.name",
+											// set api version explicitly to avoid being
+											// recognized as changed after defaulting
+											APIVersion: "v1",
+											FieldPath:  "metadata.name",
 										},
 									},
 								},
@@ -468,7 +840,10 @@ func (f *ipvsdr) generateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.De
 									Name: "POD_NAMESPACE",
 									ValueFrom: &v1.EnvVarSource{
 										FieldRef: &v1.ObjectFieldSelector{
-											FieldPath: "metadata.namespace",
+											// set api version explicitly to avoid being
+											// recognized as changed after defaulting
+											APIVersion: "v1",
+											FieldPath:  "metadata.namespace",
 										},
 									},
 								},
@@ -480,6 +855,18 @@ func (f *ipvsdr) generateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.De
 									Name:  "LOADBALANCER_NAME",
 									Value: lb.Name,
 								},
+								{
+									Name:  "BACKENDS_CONFIGMAP",
+									Value: fmt.Sprintf(backendsConfigMapName, lb.Name),
+								},
+								{
+									Name:  "DRAIN_FILE",
+									Value: drainFile,
+								},
+								{
+									Name:  "CONFIG_CONFIGMAP",
+									Value: fmt.Sprintf(configConfigMapName, lb.Name),
+								},
 							},
 							VolumeMounts: []v1.VolumeMount{
 								{
@@ -487,6 +874,11 @@ func (f *ipvsdr) generateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.De
 									MountPath: "/lib/modules",
 									ReadOnly:  true,
 								},
+								{
+									Name:      checksVolumeName,
+									MountPath: checksMountPath,
+									ReadOnly:  true,
+								},
 							},
 						},
 					},
@@ -499,15 +891,66 @@ func (f *ipvsdr) generateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.De
 								},
 							},
 						},
+						{
+							Name: checksVolumeName,
+							VolumeSource: v1.VolumeSource{
+								ConfigMap: &v1.ConfigMapVolumeSource{
+									LocalObjectReference: v1.LocalObjectReference{
+										Name: fmt.Sprintf(checksConfigMapName, lb.Name),
+									},
+									// set default mode explicitly to avoid being
+									// recognized as changed after defaulting
+									DefaultMode: &defaultMode,
+								},
+							},
+						},
 					},
 				},
 			},
 		},
 	}
+	deploy.Spec.Template.Spec.Containers = append(deploy.Spec.Template.Spec.Containers, f.exporterContainers(lb)...)
+	f.setScrapeAnnotations(lb, &deploy.Spec.Template)
+	lbutil.SetPodPriority(lb, &deploy.Spec.Template)
 
 	return deploy
 }
 
-func (f *ipvsdr) getValidVRID() int {
-	return rand.Intn(254) + 1
+// resources returns the compute resources of provider container in lb spec,
+// or the default limits if not specified
+func (f *ipvsdr) resources(lb *netv1alpha1.LoadBalancer) v1.ResourceRequirements {
+	spec := lb.Spec.Providers.Ipvsdr
+	resources := v1.ResourceRequirements{
+		Limits: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("200m"),
+			v1.ResourceMemory: resource.MustParse("50Mi"),
+		},
+	}
+	if len(spec.Resources.Limits) != 0 || len(spec.Resources.Requests) != 0 {
+		resources = spec.Resources
+	}
+
+	if spec.QoS == nil || !spec.QoS.Guaranteed {
+		return resources
+	}
+
+	// enforce requests equal to limits for cpu and memory
+	guaranteed := v1.ResourceRequirements{
+		Limits:   v1.ResourceList{},
+		Requests: v1.ResourceList{},
+	}
+	for name, quantity := range resources.Requests {
+		guaranteed.Requests[name] = quantity
+	}
+	for name, quantity := range resources.Limits {
+		guaranteed.Limits[name] = quantity
+	}
+	for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+		if quantity, ok := guaranteed.Limits[name]; ok {
+			guaranteed.Requests[name] = quantity
+		} else if quantity, ok := guaranteed.Requests[name]; ok {
+			guaranteed.Limits[name] = quantity
+		}
+	}
+	return guaranteed
 }
@@ -0,0 +1,457 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caicloud/loadbalancer-controller/config"
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/plugintest"
+	"github.com/caicloud/loadbalancer-controller/pkg/tprclient/fake"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+const testImage = "ipvsdr:test"
+
+// newTestIpvsdr returns an initialized ipvsdr provider running against a
+// harness serving the objects, the informers are started and synced
+func newTestIpvsdr(t *testing.T, objects ...runtime.Object) (*ipvsdr, *plugintest.Harness, func()) {
+	h := plugintest.NewHarness(objects...)
+
+	cfg := config.Configuration{}
+	cfg.Providers.Ipvsdr.Image = testImage
+	cfg.Providers.Ipvsdr.Workers = 1
+	cfg.RateLimiter = config.RateLimiter{BaseDelay: 5, MaxDelay: 1, QPS: 10, Burst: 100}
+
+	f := &ipvsdr{}
+	f.Init(h.Config(cfg), h.Factory)
+
+	stopCh := make(chan struct{})
+	if err := h.Start(stopCh); err != nil {
+		t.Fatal(err)
+	}
+	return f, h, func() {
+		close(stopCh)
+		h.Close()
+	}
+}
+
+// newTestDeployment returns a deployment of lb with the labels, it is owned
+// by owner if not nil
+func newTestDeployment(lb *netv1alpha1.LoadBalancer, name string, labels map[string]string, owner *netv1alpha1.LoadBalancer) *extensions.Deployment {
+	replicas := int32(1)
+	d := &extensions.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: lb.Namespace,
+			Name:      name,
+			UID:       types.UID("uid-" + name),
+			Labels:    labels,
+		},
+		Spec: extensions.DeploymentSpec{
+			Replicas: &replicas,
+		},
+	}
+	if owner != nil {
+		t := true
+		d.OwnerReferences = []metav1.OwnerReference{
+			{
+				APIVersion: controllerKind.GroupVersion().String(),
+				Kind:       controllerKind.Kind,
+				Name:       owner.Name,
+				UID:        owner.UID,
+				Controller: &t,
+			},
+		}
+	}
+	return d
+}
+
+func TestGenerateDeployment(t *testing.T) {
+	f, _, stop := newTestIpvsdr(t)
+	defer stop()
+
+	maintenance := plugintest.NewLoadBalancer("default", "lb", plugintest.WithIpvsdr("10.0.0.100"), plugintest.WithNodes("node1", "node2"))
+	maintenance.Spec.Nodes.Maintenance = []string{"node1"}
+	maintenance.Spec.Nodes.Standby = []string{"node3"}
+
+	tests := []struct {
+		name     string
+		lb       *netv1alpha1.LoadBalancer
+		replicas int32
+	}{
+		{
+			name:     "named nodes",
+			lb:       plugintest.NewLoadBalancer("default", "lb", plugintest.WithIpvsdr("10.0.0.100"), plugintest.WithNodes("node1", "node2")),
+			replicas: 2,
+		},
+		{
+			name:     "standby surges for maintenance",
+			lb:       maintenance,
+			replicas: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		d := f.generateDeployment(tt.lb)
+
+		if *d.Spec.Replicas != tt.replicas {
+			t.Errorf("%s: replicas = %d, want %d", tt.name, *d.Spec.Replicas, tt.replicas)
+		}
+		if len(d.OwnerReferences) != 1 || d.OwnerReferences[0].UID != tt.lb.UID || !*d.OwnerReferences[0].Controller {
+			t.Errorf("%s: owner references = %v, want controlled by lb", tt.name, d.OwnerReferences)
+		}
+		for k, v := range f.selector(tt.lb) {
+			if d.Labels[k] != v || d.Spec.Template.Labels[k] != v || d.Spec.Selector.MatchLabels[k] != v {
+				t.Errorf("%s: label %s=%s is missing", tt.name, k, v)
+			}
+		}
+		if !d.Spec.Template.Spec.HostNetwork {
+			t.Errorf("%s: host network is disabled", tt.name)
+		}
+		expr := d.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions[0]
+		if want := fmt.Sprintf(netv1alpha1.UniqueLabelKeyFormat, tt.lb.Namespace, tt.lb.Name); expr.Key != want {
+			t.Errorf("%s: node affinity key = %s, want %s", tt.name, expr.Key, want)
+		}
+	}
+}
+
+func TestEnsureDeployment(t *testing.T) {
+	lb := plugintest.NewLoadBalancer("default", "lb", plugintest.WithIpvsdr("10.0.0.100"), plugintest.WithNodes("node1"))
+	f, _, stop := newTestIpvsdr(t, lb)
+	defer stop()
+
+	injected := v1.Container{Name: "injected", Image: "injected:v1", Args: []string{"--injected"}}
+
+	tests := []struct {
+		name    string
+		drift   func(d *extensions.Deployment)
+		changed bool
+	}{
+		{
+			name:    "no drift",
+			drift:   func(d *extensions.Deployment) {},
+			changed: false,
+		},
+		{
+			name: "image",
+			drift: func(d *extensions.Deployment) {
+				d.Spec.Template.Spec.Containers[0].Image = "ipvsdr:old"
+			},
+			changed: true,
+		},
+		{
+			name: "replicas",
+			drift: func(d *extensions.Deployment) {
+				replicas := int32(5)
+				d.Spec.Replicas = &replicas
+			},
+			changed: true,
+		},
+		{
+			name: "env",
+			drift: func(d *extensions.Deployment) {
+				d.Spec.Template.Spec.Containers[0].Env = nil
+			},
+			changed: true,
+		},
+		{
+			name: "node affinity",
+			drift: func(d *extensions.Deployment) {
+				d.Spec.Template.Spec.Affinity.NodeAffinity = nil
+			},
+			changed: true,
+		},
+		{
+			name: "extra label is kept",
+			drift: func(d *extensions.Deployment) {
+				d.Labels["extra"] = "true"
+			},
+			changed: false,
+		},
+		{
+			name: "injected container before provider is kept",
+			drift: func(d *extensions.Deployment) {
+				d.Spec.Template.Spec.Containers = append([]v1.Container{injected}, d.Spec.Template.Spec.Containers...)
+			},
+			changed: false,
+		},
+		{
+			name: "image behind injected container",
+			drift: func(d *extensions.Deployment) {
+				d.Spec.Template.Spec.Containers[0].Image = "ipvsdr:old"
+				d.Spec.Template.Spec.Containers = append([]v1.Container{injected}, d.Spec.Template.Spec.Containers...)
+			},
+			changed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		desired := f.generateDeployment(lb)
+		old, err := lbutil.DeploymentDeepCopy(desired)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.drift(old)
+
+		copied, changed, err := f.ensureDeployment(desired, old)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if changed != tt.changed {
+			t.Errorf("%s: changed = %v, want %v", tt.name, changed, tt.changed)
+		}
+		if *copied.Spec.Replicas != *desired.Spec.Replicas {
+			t.Errorf("%s: replicas = %d, want %d", tt.name, *copied.Spec.Replicas, *desired.Spec.Replicas)
+		}
+		if c := providerContainer(&copied.Spec.Template); c == nil || c.Image != testImage {
+			t.Errorf("%s: provider container = %+v, want image %s", tt.name, c, testImage)
+		}
+		for _, c := range copied.Spec.Template.Spec.Containers {
+			if c.Name == injected.Name && !reflect.DeepEqual(c, injected) {
+				t.Errorf("%s: injected container = %+v, want %+v", tt.name, c, injected)
+			}
+		}
+		if copied.Spec.Template.Spec.Affinity.NodeAffinity == nil {
+			t.Errorf("%s: node affinity is not corrected", tt.name)
+		}
+	}
+}
+
+func TestClaimDeployments(t *testing.T) {
+	lb := plugintest.NewLoadBalancer("default", "lb", plugintest.WithIpvsdr("10.0.0.100"), plugintest.WithNodes("node1"))
+	other := plugintest.NewLoadBalancer("default", "other", plugintest.WithIpvsdr("10.0.0.101"), plugintest.WithNodes("node2"))
+	f := &ipvsdr{}
+	selector := f.selector(lb)
+
+	tests := []struct {
+		name    string
+		d       *extensions.Deployment
+		claimed bool
+		owner   types.UID
+	}{
+		{
+			name:    "owned",
+			d:       newTestDeployment(lb, "owned", selector, lb),
+			claimed: true,
+			owner:   lb.UID,
+		},
+		{
+			name:    "orphan is adopted",
+			d:       newTestDeployment(lb, "orphan", selector, nil),
+			claimed: true,
+			owner:   lb.UID,
+		},
+		{
+			name:    "owned by other is ignored",
+			d:       newTestDeployment(lb, "foreign", selector, other),
+			claimed: false,
+			owner:   other.UID,
+		},
+	}
+
+	for _, tt := range tests {
+		f, h, stop := newTestIpvsdr(t, lb, other, tt.d)
+
+		dps, err := f.workloads.ClaimDeployments(lb)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if claimed := len(dps) == 1; claimed != tt.claimed {
+			t.Errorf("%s: claimed = %v, want %v", tt.name, claimed, tt.claimed)
+		}
+
+		obj, err := h.APIServer.Tracker().Get("deployments", tt.d.Namespace, tt.d.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		owner := types.UID("")
+		if ref := controllerRef(obj.(*extensions.Deployment)); ref != nil {
+			owner = ref.UID
+		}
+		if owner != tt.owner {
+			t.Errorf("%s: owner = %q, want %q", tt.name, owner, tt.owner)
+		}
+		stop()
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	lb := plugintest.NewLoadBalancer("default", "lb", plugintest.WithIpvsdr("10.0.0.100"), plugintest.WithNodes("node1"))
+	f := &ipvsdr{}
+	selector := f.selector(lb)
+
+	config := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: lb.Namespace, Name: "lb-ipvsdr-config", Labels: selector},
+	}
+	unrelated := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: lb.Namespace, Name: "unrelated"},
+	}
+	f, h, stop := newTestIpvsdr(t, lb, newTestDeployment(lb, "lb-ipvsdr-abcde", selector, lb), config, unrelated)
+	defer stop()
+
+	if err := f.cleanup(lb); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	tests := []struct {
+		resource string
+		name     string
+		exists   bool
+	}{
+		{"deployments", "lb-ipvsdr-abcde", false},
+		{"configmaps", "lb-ipvsdr-config", false},
+		{"configmaps", "unrelated", true},
+	}
+	for _, tt := range tests {
+		_, err := h.APIServer.Tracker().Get(tt.resource, lb.Namespace, tt.name)
+		if exists := err == nil; exists != tt.exists {
+			t.Errorf("%s %s: exists = %v, want %v", tt.resource, tt.name, exists, tt.exists)
+		}
+	}
+
+	if err := h.WaitFor(time.Second, func() bool {
+		dps, _ := f.dLister.Deployments(lb.Namespace).List(selector.AsSelector())
+		return len(dps) == 0
+	}); err != nil {
+		t.Errorf("deployments are not observed deleted: %v", err)
+	}
+}
+
+func TestSyncDryRun(t *testing.T) {
+	lb := plugintest.NewLoadBalancer("default", "lb", plugintest.WithIpvsdr("10.0.0.100"), plugintest.WithNodes("node1"), plugintest.WithDryRun())
+	f, h, stop := newTestIpvsdr(t, lb)
+	defer stop()
+
+	stale := f.generateDeployment(lb)
+	stale.Spec.Template.Spec.Containers[0].Image = "ipvsdr:old"
+	if err := h.APIServer.Tracker().Add("deployments", stale); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.WaitFor(time.Second, func() bool {
+		dps, _ := f.dLister.Deployments(lb.Namespace).List(f.selector(lb).AsSelector())
+		return len(dps) == 1
+	}); err != nil {
+		t.Fatalf("deployment is not observed: %v", err)
+	}
+	h.APIServer.ClearActions()
+
+	if err := f.syncLoadBalancer(lb); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if writes := h.APIServer.Writes(); len(writes) != 0 {
+		t.Errorf("writes = %v, want none", writes)
+	}
+	for _, action := range h.TPRClient.Actions() {
+		if action.Verb != fake.VerbGet && action.Verb != fake.VerbList && action.Verb != fake.VerbWatch {
+			t.Errorf("loadbalancer is written by %v", action)
+		}
+	}
+	events := h.Events()
+	if len(events) != 1 || !strings.Contains(events[0], lbutil.EventReasonDryRun) || !strings.Contains(events[0], "update Deployment "+stale.Name) {
+		t.Errorf("events = %v, want the planned update of deployment", events)
+	}
+}
+
+func TestSyncDeletedInvalid(t *testing.T) {
+	// the spec no longer passes validation, e.g. it was tightened after creation
+	lb := plugintest.NewLoadBalancer("default", "lb", plugintest.WithIpvsdr("not-an-ip"), plugintest.WithNodes("node1"), plugintest.WithDeletion())
+	lb.Finalizers = []string{finalizer}
+	f, h, stop := newTestIpvsdr(t, lb)
+	defer stop()
+
+	if err := f.syncLoadBalancer(lb); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	updated, err := h.TPRClient.NetworkingV1alpha1().LoadBalancers(lb.Namespace).Get(lb.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lbutil.HasFinalizer(updated, finalizer) {
+		t.Errorf("finalizers = %v, want %s removed", updated.Finalizers, finalizer)
+	}
+}
+
+func TestNodePortConflict(t *testing.T) {
+	withPorts := func(ports ...netv1alpha1.IpvsdrPort) plugintest.LoadBalancerOption {
+		return func(lb *netv1alpha1.LoadBalancer) {
+			lb.Spec.Providers.Ipvsdr.Ports = ports
+		}
+	}
+	older := plugintest.NewLoadBalancer("default", "older", plugintest.WithIpvsdr("10.0.0.100"), plugintest.WithNodes("node1", "node2"),
+		withPorts(netv1alpha1.IpvsdrPort{Port: 8000, EndPort: 8100}))
+
+	tests := []struct {
+		name     string
+		lb       *netv1alpha1.LoadBalancer
+		conflict bool
+	}{
+		{
+			name: "overlapping range on shared node",
+			lb: plugintest.NewLoadBalancer("default", "range", plugintest.WithIpvsdr("10.0.0.101"), plugintest.WithNodes("node2"),
+				withPorts(netv1alpha1.IpvsdrPort{Port: 8050})),
+			conflict: true,
+		},
+		{
+			name: "other protocol",
+			lb: plugintest.NewLoadBalancer("default", "udp", plugintest.WithIpvsdr("10.0.0.101"), plugintest.WithNodes("node2"),
+				withPorts(netv1alpha1.IpvsdrPort{Port: 8050, Protocol: v1.ProtocolUDP})),
+		},
+		{
+			name: "other nodes",
+			lb: plugintest.NewLoadBalancer("default", "nodes", plugintest.WithIpvsdr("10.0.0.101"), plugintest.WithNodes("node3"),
+				withPorts(netv1alpha1.IpvsdrPort{Port: 8050})),
+		},
+		{
+			name: "all ports",
+			lb:   plugintest.NewLoadBalancer("default", "all", plugintest.WithIpvsdr("10.0.0.101"), plugintest.WithNodes("node1")),
+		},
+	}
+
+	for _, tt := range tests {
+		f, _, stop := newTestIpvsdr(t, older, tt.lb)
+		err := f.nodePortConflict(tt.lb)
+		stop()
+		if conflict := err != nil; conflict != tt.conflict {
+			t.Errorf("%s: conflict = %v, want %v: %v", tt.name, conflict, tt.conflict, err)
+		}
+	}
+}
+
+// controllerRef returns the controller reference of d
+func controllerRef(d *extensions.Deployment) *metav1.OwnerReference {
+	for i := range d.OwnerReferences {
+		ref := &d.OwnerReferences[i]
+		if ref.Controller != nil && *ref.Controller {
+			return ref
+		}
+	}
+	return nil
+}
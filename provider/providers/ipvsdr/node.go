@@ -0,0 +1,200 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+	stringsutil "github.com/caicloud/loadbalancer-controller/pkg/util/strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// updateNode enqueues the loadbalancers running on the node when
+// the InternalIP of node changed, the unicast peers and real servers
+// of provider are stale now, or when the weight annotated on node changed.
+// It fails over the provider pods when the node becomes not ready
+func (f *ipvsdr) updateNode(oldObj, curObj interface{}) {
+	old := oldObj.(*v1.Node)
+	cur := curObj.(*v1.Node)
+
+	if old.ResourceVersion == cur.ResourceVersion {
+		return
+	}
+
+	if lbutil.IsNodeReady(old) && !lbutil.IsNodeReady(cur) {
+		f.failoverNode(cur)
+	}
+
+	oldWeight := old.Annotations[netv1alpha1.AnnotationKeyNodeWeight]
+	curWeight := cur.Annotations[netv1alpha1.AnnotationKeyNodeWeight]
+	if oldWeight != curWeight {
+		for _, lb := range f.loadBalancersOnNode(cur) {
+			logger.Info("Node weight changed, resync ipvsdr provider", log.Fields{
+				"node":    cur.Name,
+				"old":     oldWeight,
+				"cur":     curWeight,
+				"lb.name": lb.Name,
+				"lb.ns":   lb.Namespace,
+			})
+			f.helper.Enqueue(lb)
+		}
+	}
+
+	oldIP := lbutil.GetNodeInternalIP(old)
+	curIP := lbutil.GetNodeInternalIP(cur)
+	if oldIP == curIP {
+		return
+	}
+
+	for _, lb := range f.loadBalancersOnNode(cur) {
+		logger.Info("Node address changed, resync ipvsdr provider", log.Fields{
+			"node":    cur.Name,
+			"old":     oldIP,
+			"cur":     curIP,
+			"lb.name": lb.Name,
+			"lb.ns":   lb.Namespace,
+		})
+		f.recorder.Eventf(lb, v1.EventTypeNormal, lbutil.EventReasonNodeAddressChanged, "InternalIP of node %s changed from %s to %s, reload provider", cur.Name, oldIP, curIP)
+		f.helper.Enqueue(lb)
+	}
+}
+
+// loadBalancersOnNode returns the ipvsdr loadbalancers whose label is on node
+func (f *ipvsdr) loadBalancersOnNode(node *v1.Node) []*netv1alpha1.LoadBalancer {
+	var lbs []*netv1alpha1.LoadBalancer
+	prefix := netv1alpha1.LoadBalancerName + "." + netv1alpha1.AlphaGroupName + "/"
+	for key, value := range node.Labels {
+		if !strings.HasPrefix(key, prefix) || value != "true" {
+			continue
+		}
+		namespace, name, err := lbutil.SplitNamespaceAndNameByDot(strings.TrimPrefix(key, prefix))
+		if err != nil {
+			continue
+		}
+		lb, err := f.lbLister.LoadBalancers(namespace).Get(name)
+		if err != nil || lb.Spec.Providers.Ipvsdr == nil {
+			continue
+		}
+		lbs = append(lbs, lb)
+	}
+	return lbs
+}
+
+// failoverNode moves the provider pods off the node which is not ready. The
+// vip moves only if keepalived of backup notices the missing adverts, and the
+// pods stay bound to the node until they are evicted by node controller, so
+// they are deleted at once and rescheduled onto the healthy labeled nodes
+func (f *ipvsdr) failoverNode(node *v1.Node) {
+	for _, lb := range f.loadBalancersOnNode(node) {
+		if !lbutil.IsOwned(lb) || lbutil.IsPaused(lb) || lbutil.IsDryRun(lb) || lb.DeletionTimestamp != nil {
+			continue
+		}
+
+		pods, err := f.podLister.Pods(lb.Namespace).List(f.selector(lb).AsSelector())
+		if err != nil {
+			continue
+		}
+		var moved []string
+		for _, pod := range pods {
+			// pods of daemonset are bound to the node, they are left to node controller
+			if pod.Spec.NodeName != node.Name || pod.DeletionTimestamp != nil || lbutil.IsDaemonSetMode(lb) {
+				continue
+			}
+			zero := int64(0)
+			err := f.client.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{GracePeriodSeconds: &zero})
+			if err != nil && !errors.IsNotFound(err) {
+				logger.Error("Delete provider pod on failed node error", log.Fields{"pod.name": pod.Name, "node": node.Name, "err": err})
+				continue
+			}
+			moved = append(moved, pod.Name)
+		}
+
+		role := "backup"
+		if status := lb.Status.ProvidersStatuses.Ipvsdr; status != nil && stringsutil.StringInSlice(node.Name, strings.Split(status.Master, ",")) {
+			role = "master"
+		}
+		targets := f.failoverTargets(lb, node)
+
+		logger.Warn("Node is not ready, fail over ipvsdr provider", log.Fields{
+			"node":    node.Name,
+			"role":    role,
+			"pods":    moved,
+			"targets": targets,
+			"lb.name": lb.Name,
+			"lb.ns":   lb.Namespace,
+		})
+		switch {
+		case len(moved) == 0:
+			f.recorder.Eventf(lb, v1.EventTypeWarning, lbutil.EventReasonNodeFailover, "Node %s of VRRP %s is not ready, no provider pod to reschedule", node.Name, role)
+		case len(targets) == 0:
+			f.recorder.Eventf(lb, v1.EventTypeWarning, lbutil.EventReasonNodeFailover, "Node %s of VRRP %s is not ready, deleted provider pods %s but no healthy labeled node is available", node.Name, role, strings.Join(moved, ","))
+		default:
+			f.recorder.Eventf(lb, v1.EventTypeWarning, lbutil.EventReasonNodeFailover, "Node %s of VRRP %s is not ready, rescheduling provider pods %s onto %s", node.Name, role, strings.Join(moved, ","), strings.Join(targets, ","))
+		}
+		f.helper.Enqueue(lb)
+	}
+}
+
+// failoverTargets returns the ready nodes selected by lb without a provider
+// pod, which the pods on failed node are rescheduled onto
+func (f *ipvsdr) failoverTargets(lb *netv1alpha1.LoadBalancer, failed *v1.Node) []string {
+	occupied := make(map[string]bool)
+	pods, _ := f.podLister.Pods(lb.Namespace).List(f.selector(lb).AsSelector())
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil && pod.Spec.NodeName != failed.Name {
+			occupied[pod.Spec.NodeName] = true
+		}
+	}
+
+	var targets []string
+	for _, name := range lbutil.ActiveNodeNames(lb) {
+		if name == failed.Name || occupied[name] {
+			continue
+		}
+		node, err := f.nodeLister.Get(name)
+		if err != nil || !lbutil.IsNodeReady(node) || node.Spec.Unschedulable {
+			continue
+		}
+		targets = append(targets, name)
+	}
+	return targets
+}
+
+// nodeAddresses returns the sorted addresses of nodes selected by lb
+// in the format of name=ip
+func (f *ipvsdr) nodeAddresses(lb *netv1alpha1.LoadBalancer) string {
+	names := lbutil.ActiveNodeNames(lb)
+	addresses := make([]string, 0, len(names))
+	for _, name := range names {
+		node, err := f.nodeLister.Get(name)
+		if err != nil {
+			continue
+		}
+		addresses = append(addresses, fmt.Sprintf("%s=%s", node.Name, lbutil.GetNodeInternalIP(node)))
+	}
+	sort.Strings(addresses)
+	return strings.Join(addresses, ",")
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/client-go/kubernetes/scheme"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// plan computes the changes the sync would make to the resources of lb and
+// reports them instead of writing, the workloads are compared with the ones
+// in cache and the ConfigMaps with the ones in apiserver
+func (f *ipvsdr) plan(lb *netv1alpha1.LoadBalancer, deleted bool) error {
+	plan := lbutil.NewPlan(providerName, lb)
+
+	selector := f.selector(lb).AsSelector()
+	dps, err := f.dLister.Deployments(lb.Namespace).List(selector)
+	if err != nil {
+		return err
+	}
+	dss, err := f.dsLister.DaemonSets(lb.Namespace).List(selector)
+	if err != nil {
+		return err
+	}
+
+	if deleted || lb.DeletionTimestamp != nil || !f.responsible(lb) {
+		if !deleted && !lbutil.HasFinalizer(lb, finalizer) {
+			// not managed by ipvsdr provider
+			return nil
+		}
+		for _, dp := range dps {
+			plan.Delete("Deployment", dp.Name)
+		}
+		for _, ds := range dss {
+			plan.Delete("DaemonSet", ds.Name)
+		}
+		plan.Report(f.recorder)
+		return nil
+	}
+
+	// the defaults are not written back to spec in dry run mode
+	obj, err := scheme.Scheme.DeepCopy(lb)
+	if err != nil {
+		return err
+	}
+	lb = obj.(*netv1alpha1.LoadBalancer)
+	netv1alpha1.SetLoadBalancerDefaults(lb)
+
+	if lb.Spec.Providers.Ipvsdr.Vip == "" {
+		// nothing is provisioned before the vip is allocated
+		plan.Update("LoadBalancer", lb.Name, []string{"spec.providers.ipvsdr.vip"})
+		plan.Report(f.recorder)
+		return nil
+	}
+
+	if lbutil.IsDaemonSetMode(lb) {
+		f.planDaemonSets(plan, lb, dps, dss)
+	} else {
+		f.planDeployments(plan, lb, dps, dss)
+	}
+
+	data, err := f.generateBackends(lb)
+	if err != nil {
+		return err
+	}
+	configMaps := map[string]map[string]string{
+		fmt.Sprintf(configConfigMapName, lb.Name):   f.generateConfig(lb),
+		fmt.Sprintf(checksConfigMapName, lb.Name):   generateChecks(lb),
+		fmt.Sprintf(backendsConfigMapName, lb.Name): data,
+	}
+	for name, data := range configMaps {
+		if err := plan.ConfigMap(f.client, lb.Namespace, name, data); err != nil {
+			return err
+		}
+	}
+
+	plan.Report(f.recorder)
+	return nil
+}
+
+// planDeployments plans the changes of sync to the deployments of lb
+func (f *ipvsdr) planDeployments(plan *lbutil.Plan, lb *netv1alpha1.LoadBalancer, dps []*extensions.Deployment, dss []*extensions.DaemonSet) {
+	for _, ds := range dss {
+		plan.Delete("DaemonSet", ds.Name)
+	}
+
+	desiredDeploy := f.generateDeployment(lb)
+	updated := false
+	for _, dp := range dps {
+		// the pods of legacy deployments are handed over to the one named
+		// by lbutil.WorkloadName
+		if dp.Name != desiredDeploy.Name || updated {
+			if *dp.Spec.Replicas != 0 {
+				plan.Update("Deployment", dp.Name, []string{"spec.replicas"})
+			}
+			continue
+		}
+		updated = true
+		copyDp, changed, err := f.ensureDeployment(desiredDeploy, dp)
+		if err == nil && changed {
+			plan.Diff("Deployment", dp.Name, copyDp, dp)
+		}
+	}
+	if !updated {
+		plan.Create("Deployment", desiredDeploy.Name)
+	}
+}
+
+// planDaemonSets plans the changes of sync to the daemonsets of lb
+func (f *ipvsdr) planDaemonSets(plan *lbutil.Plan, lb *netv1alpha1.LoadBalancer, dps []*extensions.Deployment, dss []*extensions.DaemonSet) {
+	for _, dp := range dps {
+		plan.Delete("Deployment", dp.Name)
+	}
+
+	desiredDs := f.generateDaemonSet(lb)
+	updated := false
+	for _, ds := range dss {
+		if !strings.HasPrefix(ds.Name, lb.Name+providerNameSuffix) || updated {
+			plan.Delete("DaemonSet", ds.Name)
+			continue
+		}
+		updated = true
+		copyDs, changed, err := f.ensureDaemonSet(desiredDs, ds)
+		if err == nil && changed {
+			plan.Diff("DaemonSet", ds.Name, copyDs, ds)
+		}
+	}
+	if !updated {
+		plan.Create("DaemonSet", desiredDs.Name)
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+)
+
+// podMonitorName is the name of PodMonitor of provider pods
+const podMonitorName = "%s-provider-ipvsdr"
+
+// ensurePodMonitor scrapes the traffic of vips from the ipvs exporter of
+// provider pods, the PodMonitor is deleted if the exporter is not run.
+// Nothing is generated if it is disabled
+func (f *ipvsdr) ensurePodMonitor(result *lbutil.Result, lb *netv1alpha1.LoadBalancer) error {
+	if !f.monitoring.PodMonitors {
+		return nil
+	}
+
+	name := fmt.Sprintf(podMonitorName, lb.Name)
+	if _, ok := f.metricsPort(lb); !ok {
+		return lbutil.DeletePodMonitor(f.client, lb.Namespace, name)
+	}
+
+	meta := lbutil.MonitorMeta(lb, name, f.selector(lb), "provider-"+providerName, f.monitoring.PodMonitorLabelSet())
+	endpoints := []lbutil.PodMetricsEndpoint{
+		{Port: exporterPortName, Path: "/metrics"},
+	}
+
+	action, err := lbutil.EnsurePodMonitor(f.client, meta, f.selector(lb), endpoints)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case lbutil.ActionCreated:
+		result.Created("PodMonitor", name)
+	case lbutil.ActionUpdated:
+		result.Updated("PodMonitor", name)
+	}
+	return nil
+}
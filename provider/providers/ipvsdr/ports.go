@@ -0,0 +1,122 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+	"github.com/caicloud/loadbalancer-controller/pkg/util/validation"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// formatPort returns the port or port range in the format of port/protocol,
+// e.g. 80/TCP or 8000-8100/UDP
+func formatPort(port netv1alpha1.IpvsdrPort) string {
+	protocol := port.Protocol
+	if protocol == "" {
+		protocol = v1.ProtocolTCP
+	}
+	if port.EndPort != 0 {
+		return fmt.Sprintf("%d-%d/%s", port.Port, port.EndPort, protocol)
+	}
+	return fmt.Sprintf("%d/%s", port.Port, protocol)
+}
+
+// portsConfig tells provider pods the ports and port ranges to forward, all
+// ports of the vips are forwarded if none is specified
+func portsConfig(lb *netv1alpha1.LoadBalancer, data map[string]string) {
+	ports := make([]string, 0, len(lb.Spec.Providers.Ipvsdr.Ports))
+	for _, port := range lb.Spec.Providers.Ipvsdr.Ports {
+		ports = append(ports, formatPort(port))
+	}
+	if len(ports) != 0 {
+		data["ports"] = strings.Join(ports, ",")
+	}
+}
+
+// overlappingPort returns the first port of a which overlaps with a port of b
+func overlappingPort(a, b *netv1alpha1.LoadBalancer) (string, bool) {
+	for _, pa := range a.Spec.Providers.Ipvsdr.Ports {
+		for _, pb := range b.Spec.Providers.Ipvsdr.Ports {
+			if validation.IpvsdrPortsOverlap(pa, pb) {
+				return formatPort(pa), true
+			}
+		}
+	}
+	return "", false
+}
+
+// nodePortConflict returns an error if the ports of lb overlap with an older
+// loadbalancer running on the same nodes with another vip. The ports are
+// marked on nodes by destination, so the running one is never disturbed by a
+// newcomer. Loadbalancers sharing the vip are admitted by vipShare instead
+func (f *ipvsdr) nodePortConflict(lb *netv1alpha1.LoadBalancer) error {
+	if len(lb.Spec.Providers.Ipvsdr.Ports) == 0 {
+		return nil
+	}
+	lbs, err := f.lbLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	nodes := sets.NewString(lbutil.ActiveNodeNames(lb)...)
+	var others []*netv1alpha1.LoadBalancer
+	for _, l := range lbs {
+		if l.UID == lb.UID || l.DeletionTimestamp != nil || !f.responsible(l) {
+			continue
+		}
+		if l.Spec.Providers.Ipvsdr.Vip == lb.Spec.Providers.Ipvsdr.Vip && l.Spec.Providers.Ipvsdr.Network == lb.Spec.Providers.Ipvsdr.Network {
+			continue
+		}
+		if !olderThan(l, lb) {
+			continue
+		}
+		others = append(others, l)
+	}
+	sort.Slice(others, func(i, j int) bool { return olderThan(others[i], others[j]) })
+
+	for _, l := range others {
+		shared := nodes.Intersection(sets.NewString(lbutil.ActiveNodeNames(l)...))
+		if shared.Len() == 0 {
+			continue
+		}
+		if port, ok := overlappingPort(lb, l); ok {
+			return fmt.Errorf("port %s is forwarded by loadbalancer %s/%s on nodes %s",
+				port, l.Namespace, l.Name, strings.Join(shared.List(), ","))
+		}
+	}
+	return nil
+}
+
+// olderThan returns true if a is created before b, the keys break the tie
+func olderThan(a, b *netv1alpha1.LoadBalancer) bool {
+	ta, tb := a.CreationTimestamp, b.CreationTimestamp
+	if !ta.Equal(tb) {
+		return ta.Before(tb)
+	}
+	ka, _ := controllerutil.KeyFunc(a)
+	kb, _ := controllerutil.KeyFunc(b)
+	return ka < kb
+}
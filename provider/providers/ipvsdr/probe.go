@@ -0,0 +1,233 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+	"sort"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/pkg/api/v1"
+	batchv1 "k8s.io/client-go/pkg/apis/batch/v1"
+	"k8s.io/kubernetes/pkg/controller"
+)
+
+const (
+	probeNameSuffix = "-ipvsdr-arp-probe"
+	// arping exits with 1 if any host answers the duplicate address detection
+	probeScript = `iface=$(ip -o route get "$VIP" | sed -n 's/.* dev \([^ ]*\).*/\1/p')
+exec arping -D -q -c 3 -w 3 -I "$iface" "$VIP"`
+)
+
+var probeDeadlineSeconds = int64(60)
+
+func (f *ipvsdr) probeSelector(lb *netv1alpha1.LoadBalancer) labels.Set {
+	return labels.Set{
+		netv1alpha1.LabelKeyCreatedBy: fmt.Sprintf(netv1alpha1.LabelValueFormatCreateby, lb.Namespace, lb.Name),
+		netv1alpha1.LabelKeyProvider:  providerName + "-arp-probe",
+	}
+}
+
+// probeVip runs an arp probe job on one of the loadbalancer nodes before the
+// provider is provisioned, it returns true if the vip is free to use. The job
+// is kept as a record of the result, delete it to probe again.
+func (f *ipvsdr) probeVip(lb *netv1alpha1.LoadBalancer) (bool, error) {
+	if f.probeImage == "" {
+		return true, nil
+	}
+
+	nodes := lbutil.ActiveNodeNames(lb)
+	if len(nodes) == 0 {
+		// nothing will be provisioned
+		return true, nil
+	}
+	sort.Strings(nodes)
+
+	key, _ := controllerutil.KeyFunc(lb)
+	vip := lb.Spec.Providers.Ipvsdr.Vip
+	lbClient := f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace)
+
+	job, err := f.jobLister.Jobs(lb.Namespace).Get(lb.Name + probeNameSuffix)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	if job != nil && job.Annotations[netv1alpha1.AnnotationKeyProbedVip] != vip {
+		// vip has been changed, probe again
+		if err := f.deleteProbeJob(job); err != nil {
+			return false, err
+		}
+		job = nil
+	}
+
+	if job == nil {
+		job = f.generateProbeJob(lb, nodes[0])
+		if _, err := f.client.BatchV1().Jobs(lb.Namespace).Create(job); err != nil && !errors.IsAlreadyExists(err) {
+			logger.Error("Create arp probe job error", log.Fields{"lb": key, "vip": vip, "err": err})
+			return false, err
+		}
+		logger.Info("Probe vip before provisioning ipvsdr provider", log.Fields{"lb": key, "vip": vip, "node": nodes[0]})
+		condition := lbutil.NewCondition(netv1alpha1.LoadBalancerVIPConflict, v1.ConditionUnknown, "Probing",
+			fmt.Sprintf("probing vip %s on node %s", vip, nodes[0]))
+		return false, lbutil.UpdateConditions(lbClient, lb, condition)
+	}
+
+	for _, c := range job.Status.Conditions {
+		if c.Status != v1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			condition := lbutil.NewCondition(netv1alpha1.LoadBalancerVIPConflict, v1.ConditionFalse, "NotInUse",
+				fmt.Sprintf("vip %s is not answering on the network", vip))
+			return true, lbutil.UpdateConditions(lbClient, lb, condition)
+		case batchv1.JobFailed:
+			message := fmt.Sprintf("vip %s is already answering on the network, delete job %s to probe again", vip, job.Name)
+			if job.Status.Failed == 0 {
+				// the probe pod never ran
+				message = fmt.Sprintf("failed to probe vip %s: %s, delete job %s to probe again", vip, c.Message, job.Name)
+			}
+			logger.Warn("Vip conflict detected, provisioning is blocked", log.Fields{"lb": key, "vip": vip})
+			f.recorder.Event(lb, v1.EventTypeWarning, lbutil.EventReasonVipConflict, message)
+			condition := lbutil.NewCondition(netv1alpha1.LoadBalancerVIPConflict, v1.ConditionTrue, "InUse", message)
+			return false, lbutil.UpdateConditions(lbClient, lb, condition)
+		}
+	}
+
+	// the job is still running, lb will be resynced when it finishes
+	return false, nil
+}
+
+func (f *ipvsdr) deleteProbeJob(job *batchv1.Job) error {
+	policy := metav1.DeletePropagationBackground
+	err := f.client.BatchV1().Jobs(job.Namespace).Delete(job.Name, &metav1.DeleteOptions{
+		PropagationPolicy: &policy,
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// cleanupProbeJobs deletes all the arp probe jobs of lb
+func (f *ipvsdr) cleanupProbeJobs(lb *netv1alpha1.LoadBalancer) error {
+	jobs, err := f.jobLister.Jobs(lb.Namespace).List(f.probeSelector(lb).AsSelector())
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if err := f.deleteProbeJob(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *ipvsdr) generateProbeJob(lb *netv1alpha1.LoadBalancer, node string) *batchv1.Job {
+	t := true
+	parallelism := int32(1)
+	labels := f.probeSelector(lb)
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   lb.Name + probeNameSuffix,
+			Labels: lbutil.WithArtifactLabels(labels, lb, "provider-"+providerName+"-arp-probe"),
+			Annotations: map[string]string{
+				netv1alpha1.AnnotationKeyProbedVip: lb.Spec.Providers.Ipvsdr.Vip,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion:         controllerKind.GroupVersion().String(),
+					Kind:               controllerKind.Kind,
+					Name:               lb.Name,
+					UID:                lb.UID,
+					Controller:         &t,
+					BlockOwnerDeletion: &t,
+				},
+			},
+		},
+		Spec: batchv1.JobSpec{
+			Parallelism:           &parallelism,
+			Completions:           &parallelism,
+			ActiveDeadlineSeconds: &probeDeadlineSeconds,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: v1.PodSpec{
+					// probe on the network of node
+					HostNetwork:   true,
+					NodeName:      node,
+					RestartPolicy: v1.RestartPolicyNever,
+					Tolerations:   lbutil.Tolerations(lb),
+					Containers: []v1.Container{
+						{
+							Name:    "arp-probe",
+							Image:   f.probeImage,
+							Command: []string{"/bin/sh", "-c", probeScript},
+							Env: []v1.EnvVar{
+								{
+									Name:  "VIP",
+									Value: lb.Spec.Providers.Ipvsdr.Vip,
+								},
+							},
+							SecurityContext: &v1.SecurityContext{
+								Capabilities: &v1.Capabilities{
+									Add: []v1.Capability{"NET_RAW"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// updateProbeJob resyncs the loadbalancer when its arp probe job finishes
+func (f *ipvsdr) updateProbeJob(oldObj, curObj interface{}) {
+	old := oldObj.(*batchv1.Job)
+	cur := curObj.(*batchv1.Job)
+
+	if old.ResourceVersion == cur.ResourceVersion {
+		return
+	}
+
+	selector := labels.Set{netv1alpha1.LabelKeyProvider: providerName + "-arp-probe"}.AsSelector()
+	if !selector.Matches(labels.Set(cur.Labels)) {
+		return
+	}
+
+	ref := controller.GetControllerOf(cur)
+	if ref == nil || ref.Kind != controllerKind.Kind {
+		return
+	}
+	lb, err := f.lbLister.LoadBalancers(cur.Namespace).Get(ref.Name)
+	if err != nil || lb.UID != ref.UID {
+		return
+	}
+
+	logger.Debug("Arp probe job updated, resync loadbalancer", log.Fields{"job": cur.Name, "lb": lb.Name})
+	f.helper.Enqueue(lb)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	rbac "k8s.io/client-go/pkg/apis/rbac/v1beta1"
+)
+
+// providerRules are the permissions of provider pods in the namespace of lb,
+// they read lb and the ConfigMaps of config, backends and checks rendered by
+// controller, and elect the master among pods
+var providerRules = []rbac.PolicyRule{
+	{
+		APIGroups: []string{netv1alpha1.AlphaGroupName},
+		Resources: []string{netv1alpha1.LoadBalancerPlural},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"configmaps"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"pods"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"events"},
+		Verbs:     []string{"create", "patch"},
+	},
+}
+
+// serviceAccountName returns the ServiceAccount of provider pods
+func (f *ipvsdr) serviceAccountName(lb *netv1alpha1.LoadBalancer) string {
+	return lbutil.ServiceAccountName(lb, "provider-"+providerName, f.security.ServiceAccounts)
+}
+
+// ensureServiceAccount ensures the ServiceAccount of provider pods with its
+// Role, nothing is generated if it is disabled
+func (f *ipvsdr) ensureServiceAccount(result *lbutil.Result, lb *netv1alpha1.LoadBalancer) error {
+	if !f.security.ServiceAccounts {
+		return nil
+	}
+
+	name := f.serviceAccountName(lb)
+	labels := lbutil.WithArtifactLabels(f.selector(lb), lb, "provider-"+providerName)
+	action, err := lbutil.EnsureServiceAccount(f.client, lb, name, labels, providerRules)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case lbutil.ActionCreated:
+		result.Created("ServiceAccount", name)
+	case lbutil.ActionUpdated:
+		result.Updated("ServiceAccount", name)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// instanceStatus returns the runtime status published in annotations of pod
+// by the provider container, false is returned if nothing is published
+func instanceStatus(pod *v1.Pod) (netv1alpha1.IpvsdrInstanceStatus, bool) {
+	status := netv1alpha1.IpvsdrInstanceStatus{
+		PodName:  pod.Name,
+		NodeName: pod.Spec.NodeName,
+	}
+	published := false
+
+	if state, ok := pod.Annotations[netv1alpha1.AnnotationKeyVRRPState]; ok {
+		published = true
+		status.State = netv1alpha1.VRRPState(strings.ToUpper(state))
+	}
+
+	if conns, ok := pod.Annotations[netv1alpha1.AnnotationKeyActiveConnections]; ok {
+		published = true
+		n, err := strconv.ParseInt(conns, 10, 64)
+		if err != nil {
+			logger.Warn("Invalid active connections published by pod", log.Fields{"pod.ns": pod.Namespace, "pod.name": pod.Name, "value": conns})
+		}
+		status.ActiveConnections = n
+	}
+
+	if conns, ok := pod.Annotations[netv1alpha1.AnnotationKeyInactiveConnections]; ok {
+		published = true
+		n, err := strconv.ParseInt(conns, 10, 64)
+		if err != nil {
+			logger.Warn("Invalid inactive connections published by pod", log.Fields{"pod.ns": pod.Namespace, "pod.name": pod.Name, "value": conns})
+		}
+		status.InactiveConnections = n
+	}
+
+	if checked, ok := pod.Annotations[netv1alpha1.AnnotationKeyLastHealthCheck]; ok {
+		published = true
+		t, err := time.Parse(time.RFC3339, checked)
+		if err != nil {
+			logger.Warn("Invalid last health check time published by pod", log.Fields{"pod.ns": pod.Namespace, "pod.name": pod.Name, "value": checked})
+		} else {
+			mt := metav1.NewTime(t)
+			status.LastHealthCheckTime = &mt
+		}
+	}
+
+	if mark, ok := pod.Annotations[netv1alpha1.AnnotationKeyDSCP]; ok {
+		published = true
+		n, err := strconv.ParseInt(mark, 10, 32)
+		if err != nil {
+			logger.Warn("Invalid dscp published by pod", log.Fields{"pod.ns": pod.Namespace, "pod.name": pod.Name, "value": mark})
+		} else {
+			dscp := int32(n)
+			status.DSCP = &dscp
+		}
+	}
+
+	if backend, ok := pod.Annotations[netv1alpha1.AnnotationKeyDataplaneBackend]; ok {
+		published = true
+		status.DataplaneBackend = netv1alpha1.DataplaneBackend(backend)
+	}
+
+	if capabilities := pod.Annotations[netv1alpha1.AnnotationKeyDataplaneCapabilities]; capabilities != "" {
+		published = true
+		for _, backend := range strings.Split(capabilities, ",") {
+			status.DataplaneCapabilities = append(status.DataplaneCapabilities, netv1alpha1.DataplaneBackend(strings.TrimSpace(backend)))
+		}
+	}
+
+	return status, published
+}
+
+// aggregateRuntimeStatus aggregates the runtime status of instances into
+// provider status, only the instances of ready pods are counted
+func aggregateRuntimeStatus(status *netv1alpha1.IpvsdrProviderStatus, instances []netv1alpha1.IpvsdrInstanceStatus, ready map[string]bool) {
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].PodName < instances[j].PodName
+	})
+	status.Instances = instances
+
+	masters := []string{}
+	for _, instance := range instances {
+		if !ready[instance.PodName] {
+			continue
+		}
+		if instance.State == netv1alpha1.VRRPStateMaster {
+			masters = append(masters, instance.NodeName)
+		}
+		status.ActiveConnections += instance.ActiveConnections
+		status.InactiveConnections += instance.InactiveConnections
+		if instance.LastHealthCheckTime != nil &&
+			(status.LastHealthCheckTime == nil || status.LastHealthCheckTime.Before(*instance.LastHealthCheckTime)) {
+			status.LastHealthCheckTime = instance.LastHealthCheckTime
+		}
+	}
+	sort.Strings(masters)
+	if len(masters) > 1 {
+		logger.Warn("More than one ipvsdr instances are VRRP MASTER", log.Fields{"vip": status.Vip, "nodes": masters})
+	}
+	status.Master = strings.Join(masters, ",")
+}
@@ -0,0 +1,224 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// reasonSharingConflict is the reason of VIPConflict condition when the vip
+// is used by other loadbalancers which can not share it with lb
+const reasonSharingConflict = "SharingConflict"
+
+// vipShare is a vip shared by loadbalancers in the same network
+type vipShare struct {
+	// owner runs the VRRP instance of vip and forwards the ports of all members
+	owner *netv1alpha1.LoadBalancer
+	// members are loadbalancers admitted to use the vip, including owner
+	members []*netv1alpha1.LoadBalancer
+}
+
+// isOwner returns true if lb runs the VRRP instance of vip
+func (s *vipShare) isOwner(lb *netv1alpha1.LoadBalancer) bool {
+	return s.owner.UID == lb.UID
+}
+
+// peers returns the keys of members except lb
+func (s *vipShare) peers(lb *netv1alpha1.LoadBalancer) []string {
+	keys := make([]string, 0)
+	for _, m := range s.members {
+		if m.UID == lb.UID {
+			continue
+		}
+		key, _ := controllerutil.KeyFunc(m)
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// vipShare returns the share of the vip of lb. The loadbalancers using the vip
+// are admitted from the oldest one, an error is returned if lb conflicts with
+// the admitted ones, so the running one is never disturbed by a newcomer
+func (f *ipvsdr) vipShare(lb *netv1alpha1.LoadBalancer) (*vipShare, error) {
+	users, err := f.vipUsers(lb)
+	if err != nil {
+		return nil, err
+	}
+
+	share := &vipShare{members: make([]*netv1alpha1.LoadBalancer, 0, len(users))}
+	for _, u := range users {
+		if err := admitVipUser(share.members, u); err != nil {
+			if u.UID == lb.UID {
+				return nil, err
+			}
+			continue
+		}
+		share.members = append(share.members, u)
+	}
+	share.owner = share.members[0]
+	return share, nil
+}
+
+// vipUsers returns loadbalancers using the vip of lb in the same network,
+// sorted by creation time, lb itself is included
+func (f *ipvsdr) vipUsers(lb *netv1alpha1.LoadBalancer) ([]*netv1alpha1.LoadBalancer, error) {
+	lbs, err := f.lbLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	vip := lb.Spec.Providers.Ipvsdr.Vip
+	network := lb.Spec.Providers.Ipvsdr.Network
+	users := []*netv1alpha1.LoadBalancer{lb}
+	for _, l := range lbs {
+		if l.UID == lb.UID || l.DeletionTimestamp != nil || !f.responsible(l) {
+			continue
+		}
+		if l.Spec.Providers.Ipvsdr.Vip == vip && l.Spec.Providers.Ipvsdr.Network == network {
+			users = append(users, l)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		ti, tj := users[i].CreationTimestamp, users[j].CreationTimestamp
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		ki, _ := controllerutil.KeyFunc(users[i])
+		kj, _ := controllerutil.KeyFunc(users[j])
+		return ki < kj
+	})
+	return users, nil
+}
+
+// admitVipUser returns an error if lb can not share the vip with members
+func admitVipUser(members []*netv1alpha1.LoadBalancer, lb *netv1alpha1.LoadBalancer) error {
+	for _, m := range members {
+		if !lb.Spec.Providers.Ipvsdr.Shared || !m.Spec.Providers.Ipvsdr.Shared {
+			return fmt.Errorf("vip %s is used by loadbalancer %s/%s, both must enable sharing",
+				lb.Spec.Providers.Ipvsdr.Vip, m.Namespace, m.Name)
+		}
+		if port, ok := overlappingPort(lb, m); ok {
+			return fmt.Errorf("port %s of vip %s is used by loadbalancer %s/%s",
+				port, lb.Spec.Providers.Ipvsdr.Vip, m.Namespace, m.Name)
+		}
+	}
+	return nil
+}
+
+// shareConfig tells provider pods how the vip is shared. The pods of owner
+// run the VRRP instance and forward the ports of loadbalancers in shared-with,
+// which are listed in shared-ports so that the pods do not read the config of
+// other namespaces. The pods of the other members leave the vip to vrrp-owner
+func (f *ipvsdr) shareConfig(lb *netv1alpha1.LoadBalancer, data map[string]string) {
+	if !lb.Spec.Providers.Ipvsdr.Shared {
+		return
+	}
+	share, err := f.vipShare(lb)
+	if err != nil || len(share.members) == 1 {
+		return
+	}
+
+	if share.isOwner(lb) {
+		var ports []string
+		for _, m := range share.members {
+			if m.UID == lb.UID {
+				continue
+			}
+			for _, port := range m.Spec.Providers.Ipvsdr.Ports {
+				ports = append(ports, formatPort(port))
+			}
+		}
+		data["shared-with"] = strings.Join(share.peers(lb), ",")
+		data["shared-ports"] = strings.Join(ports, ",")
+		return
+	}
+	owner, _ := controllerutil.KeyFunc(share.owner)
+	data["vrrp-owner"] = owner
+}
+
+// enqueueVipUsers enqueues the other loadbalancers using the vip of lb, so
+// that the share is rebuilt when a member joins, changes or leaves
+func (f *ipvsdr) enqueueVipUsers(lb *netv1alpha1.LoadBalancer) {
+	if lb.Spec.Providers.Ipvsdr == nil || lb.Spec.Providers.Ipvsdr.Vip == "" {
+		return
+	}
+	users, err := f.vipUsers(lb)
+	if err != nil {
+		return
+	}
+	for _, u := range users {
+		if u.UID != lb.UID {
+			f.helper.Enqueue(u)
+		}
+	}
+}
+
+// allocateVRID allocates the vrid of primary vip of lb, the members sharing
+// the vip join the VRRP instance of owner with the vrid of it
+func (f *ipvsdr) allocateVRID(lb *netv1alpha1.LoadBalancer) (int, error) {
+	vip := lb.Spec.Providers.Ipvsdr.Vip
+	if !lb.Spec.Providers.Ipvsdr.Shared {
+		return f.vrids.allocate(lb, vip)
+	}
+	share, err := f.vipShare(lb)
+	if err != nil {
+		return 0, err
+	}
+	if share.isOwner(lb) {
+		return f.vrids.allocate(lb, vip)
+	}
+
+	f.vrids.releaseVip(lb, vip)
+	status := share.owner.Status.ProvidersStatuses.Ipvsdr
+	if status == nil || status.Vrid == nil || *status.Vrid < 0 {
+		return 0, fmt.Errorf("vrid of owner %s/%s is not allocated yet", share.owner.Namespace, share.owner.Name)
+	}
+	return *status.Vrid, nil
+}
+
+// syncShareCondition reports the share of vip in VIPConflict condition
+func (f *ipvsdr) syncShareCondition(lb *netv1alpha1.LoadBalancer, share *vipShare) error {
+	lbClient := f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace)
+	vip := lb.Spec.Providers.Ipvsdr.Vip
+
+	if len(share.members) > 1 {
+		owner, _ := controllerutil.KeyFunc(share.owner)
+		condition := lbutil.NewCondition(netv1alpha1.LoadBalancerVIPConflict, v1.ConditionFalse, "Shared",
+			fmt.Sprintf("vip %s is shared with %s, VRRP instance is run by %s", vip, strings.Join(share.peers(lb), ","), owner))
+		return lbutil.UpdateConditions(lbClient, lb, condition)
+	}
+
+	current := lbutil.GetCondition(lb.Status, netv1alpha1.LoadBalancerVIPConflict)
+	if current != nil && current.Reason == reasonSharingConflict {
+		// the conflicting loadbalancers have gone
+		condition := lbutil.NewCondition(netv1alpha1.LoadBalancerVIPConflict, v1.ConditionFalse, "NotShared",
+			fmt.Sprintf("vip %s is used by this loadbalancer only", vip))
+		return lbutil.UpdateConditions(lbClient, lb, condition)
+	}
+	return nil
+}
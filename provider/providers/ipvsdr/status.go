@@ -17,51 +17,89 @@ limitations under the License.
 package ipvsdr
 
 import (
+	"fmt"
 	"sort"
+	"strings"
 
-	log "github.com/zoumo/logdog"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
 
 	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/custommetrics"
+	"github.com/caicloud/loadbalancer-controller/pkg/metrics"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
 	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
 	stringsutil "github.com/caicloud/loadbalancer-controller/pkg/util/strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/pkg/api/v1"
-	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
 )
 
-func (f *ipvsdr) syncStatus(lb *netv1alpha1.LoadBalancer, activeDeploy *extensions.Deployment) error {
+// syncStatus syncs the status of provider pods running in the active
+// deployment or daemonset, replicas is the number of desired pods
+func (f *ipvsdr) syncStatus(lb *netv1alpha1.LoadBalancer, replicas int32, deployment, daemonSet string) error {
 
 	// caculate proxy status
 	providerStatus := netv1alpha1.IpvsdrProviderStatus{
 		PodStatuses: netv1alpha1.PodStatuses{
-			Replicas:      *activeDeploy.Spec.Replicas,
+			Replicas:      replicas,
 			ReadyReplicas: 0,
 			TotalReplicas: 0,
 			Statuses:      make([]netv1alpha1.PodStatus, 0),
 		},
-		Vip:        lb.Spec.Providers.Ipvsdr.Vip,
-		Deployment: activeDeploy.Name,
+		Vip:                lb.Spec.Providers.Ipvsdr.Vip,
+		Deployment:         deployment,
+		DaemonSet:          daemonSet,
+		PersistenceTimeout: persistenceTimeout(lb),
 	}
 
-	// the following loadbalancer need to get a valid vrid
-	// 1. a new lb need to get a valid vrid
-	// 2. a old lb didn't have a valid vrid
-	ipvsdrstatus := lb.Status.ProvidersStatuses.Ipvsdr
-	if ipvsdrstatus == nil || ipvsdrstatus.Vrid == nil || *ipvsdrstatus.Vrid == -1 {
-		// keepalived use unicast now. so vrid will not be conflict
-		vrid := f.getValidVRID()
-		providerStatus.Vrid = &vrid
+	// allocate a vrid unique in the network for each vip, the current one
+	// is kept unless it conflicts with other loadbalancers
+	var condition netv1alpha1.LoadBalancerCondition
+	vips := allVips(lb)
+	f.vrids.retain(lb, vips)
+	allocated := make([]string, 0, len(vips))
+	var allocErr error
+	for _, vip := range vips {
+		var vrid int
+		var err error
+		if vip == lb.Spec.Providers.Ipvsdr.Vip {
+			vrid, err = f.allocateVRID(lb)
+		} else {
+			vrid, err = f.vrids.allocate(lb, vip)
+		}
+		vipStatus := netv1alpha1.IpvsdrVipStatus{Vip: vip}
+		if err != nil {
+			logger.Error("Allocate vrid error", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "vip": vip, "err": err})
+			f.recorder.Eventf(lb, v1.EventTypeWarning, lbutil.EventReasonVRIDAllocationFailed, "Allocate vrid of vip %s failed: %v", vip, err)
+			vrid = -1
+			vipStatus.Message = err.Error()
+			if allocErr == nil {
+				allocErr = err
+			}
+		} else {
+			allocated = append(allocated, fmt.Sprintf("%d (%s)", vrid, vip))
+		}
+		vipStatus.Vrid = &vrid
+		providerStatus.Vips = append(providerStatus.Vips, vipStatus)
+		if vip == lb.Spec.Providers.Ipvsdr.Vip {
+			providerStatus.Vrid = vipStatus.Vrid
+		}
+	}
+	if allocErr != nil {
+		condition = lbutil.NewCondition(netv1alpha1.LoadBalancerVRIDAllocated, v1.ConditionFalse, "Exhausted", allocErr.Error())
 	} else {
-		providerStatus.Vrid = ipvsdrstatus.Vrid
+		condition = lbutil.NewCondition(netv1alpha1.LoadBalancerVRIDAllocated, v1.ConditionTrue, "Allocated",
+			fmt.Sprintf("vrid %s is allocated in network %q", strings.Join(allocated, ", "), lb.Spec.Providers.Ipvsdr.Network))
 	}
 
 	podList, err := f.podLister.List(f.selector(lb).AsSelector())
 	if err != nil {
-		log.Error("get pod list error", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "err": err})
+		logger.Error("get pod list error", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "err": err})
 		return err
 	}
 
+	instances := make([]netv1alpha1.IpvsdrInstanceStatus, 0)
+	ready := make(map[string]bool)
 	for _, pod := range podList {
 		f.evictPod(lb, pod)
 
@@ -69,40 +107,93 @@ func (f *ipvsdr) syncStatus(lb *netv1alpha1.LoadBalancer, activeDeploy *extensio
 		providerStatus.TotalReplicas++
 		if status.Ready {
 			providerStatus.ReadyReplicas++
+			ready[pod.Name] = true
 		}
 		providerStatus.Statuses = append(providerStatus.Statuses, status)
+
+		// runtime status published by provider container
+		if instance, ok := instanceStatus(pod); ok {
+			instances = append(instances, instance)
+		}
 	}
 
 	sort.Sort(lbutil.SortPodStatusByName(providerStatus.Statuses))
+	providerStatus.Rollout = lbutil.ComputeRolloutStatus(replicas, podList, f.podUpdatedFunc(lb, daemonSet, podList))
+	aggregateRuntimeStatus(&providerStatus, instances, ready)
+	custommetrics.Set(lb.Namespace, lb.Name, providerStatus.ActiveConnections, providerStatus.InactiveConnections)
+
+	key, _ := controllerutil.KeyFunc(lb)
+	if old := lb.Status.ProvidersStatuses.Ipvsdr; old != nil && old.Master != "" &&
+		providerStatus.Master != "" && old.Master != providerStatus.Master {
+		metrics.IpvsdrFailovers.Add(key, 1)
+		f.recorder.Eventf(lb, v1.EventTypeNormal, lbutil.EventReasonFailover, "VRRP master moved from %s to %s", old.Master, providerStatus.Master)
+	}
 
-	// check whether the statuses are equal
-	if ipvsdrstatus == nil || !lbutil.IpvsdrProviderStatusEqual(*ipvsdrstatus, providerStatus) {
-		// js, _ := json.Marshal(providerStatus)
-		// replacePatch := fmt.Sprintf(`{"status":{"providersStatuses":{"ipvsdr": %s}}}`, string(js))
-		log.Notice("update ipvsdr status", log.Fields{"lb.name": lb.Name, "lb.ns": lb.Namespace})
-		_, err := lbutil.UpdateLBWithRetries(
-			f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
-			lb.Namespace,
-			lb.Name,
-			func(lb *netv1alpha1.LoadBalancer) error {
-				lb.Status.ProvidersStatuses.Ipvsdr = &providerStatus
-				return nil
-			},
-		)
-
-		// _, err = f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace).Patch(lb.Name, types.MergePatchType, []byte(replacePatch))
-		if err != nil {
-			log.Error("Update loadbalancer status error", log.Fields{"err": err})
-			return err
-		}
+	// a misconfigured image or registry fails all the pods
+	imageCondition := lbutil.ComputeImageCondition(podList)
+	metrics.SetImageUnavailable(providerName, key, imageCondition.Status == v1.ConditionTrue)
+
+	conditions := []netv1alpha1.LoadBalancerCondition{condition, imageCondition}
+	if providerStatus.ReadyReplicas < providerStatus.Replicas {
+		conditions = append(conditions, lbutil.NewCondition(
+			netv1alpha1.LoadBalancerProviderAvailable,
+			v1.ConditionFalse,
+			"PodsNotReady",
+			fmt.Sprintf("%d/%d ipvsdr pods are ready", providerStatus.ReadyReplicas, providerStatus.Replicas),
+		))
+	} else {
+		conditions = append(conditions, lbutil.NewCondition(netv1alpha1.LoadBalancerProviderAvailable, v1.ConditionTrue, "PodsReady", ""))
+	}
+	if providerStatus.Vip == "" || providerStatus.ReadyReplicas == 0 {
+		conditions = append(conditions, lbutil.NewCondition(
+			netv1alpha1.LoadBalancerVIPAssigned,
+			v1.ConditionFalse,
+			"NotServing",
+			fmt.Sprintf("vip %q is not served by any ready ipvsdr pod", providerStatus.Vip),
+		))
+	} else {
+		conditions = append(conditions, lbutil.NewCondition(
+			netv1alpha1.LoadBalancerVIPAssigned,
+			v1.ConditionTrue,
+			"Serving",
+			fmt.Sprintf("vip %s is served by %d ipvsdr pods", strings.Join(vips, ", "), providerStatus.ReadyReplicas),
+		))
+	}
+
+	conditions = append(conditions, f.dataplaneCondition(lb, instances))
 
+	// the marks are verified only if they are set in spec
+	dscp, marked := dscpCondition(lb, instances, ready)
+	if marked {
+		conditions = append(conditions, dscp)
+	}
+
+	// write ipvsdr section of status
+	err = lbutil.WriteStatus(
+		f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
+		lb,
+		func(status *netv1alpha1.LoadBalancerStatus) bool {
+			removed := !marked && lbutil.RemoveCondition(status, netv1alpha1.LoadBalancerDSCPApplied)
+			current := status.ProvidersStatuses.Ipvsdr
+			if current != nil && lbutil.IpvsdrProviderStatusEqual(*current, providerStatus) {
+				return removed
+			}
+			logger.Notice("update ipvsdr status", log.Fields{"lb.name": lb.Name, "lb.ns": lb.Namespace})
+			status.ProvidersStatuses.Ipvsdr = &providerStatus
+			return true
+		},
+		conditions...,
+	)
+	if err != nil {
+		logger.Error("Update loadbalancer status error", log.Fields{"lb.name": lb.Name, "lb.ns": lb.Namespace, "err": err})
+		return err
 	}
-	return nil
+	return allocErr
 }
 
 func (f *ipvsdr) evictPod(lb *netv1alpha1.LoadBalancer, pod *v1.Pod) {
 
-	if len(lb.Spec.Nodes.Names) == 0 {
+	if len(lbutil.NodeNames(lb)) == 0 {
 		return
 	}
 	// FIXME: when RequiredDuringSchedulingRequiredDuringExecution finished
@@ -111,7 +202,7 @@ func (f *ipvsdr) evictPod(lb *netv1alpha1.LoadBalancer, pod *v1.Pod) {
 	// According to nodeAffinity RequiredDuringSchedulingIgnoredDuringExecution,
 	// the system may or may not try to eventually evict the pod from its node.
 	// the pod may still running on the wrong node, so we evict it manually
-	if !stringsutil.StringInSlice(pod.Spec.NodeName, lb.Spec.Nodes.Names) &&
+	if !stringsutil.StringInSlice(pod.Spec.NodeName, lbutil.ActiveNodeNames(lb)) &&
 		pod.DeletionTimestamp == nil {
 		f.client.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{})
 	}
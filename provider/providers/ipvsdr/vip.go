@@ -0,0 +1,115 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// allocateVip allocates a vip from pools for lb and writes it back to spec,
+// so that the provider pods pick it up as the same as a hand-picked one
+func (f *ipvsdr) allocateVip(lb *netv1alpha1.LoadBalancer) error {
+	key, _ := controllerutil.KeyFunc(lb)
+
+	used, err := f.usedVips(lb)
+	if err != nil {
+		return err
+	}
+
+	lbClient := f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace)
+
+	vip, allocErr := f.vips.Allocate(key, used)
+	if allocErr != nil {
+		logger.Error("Allocate vip error", log.Fields{"lb": key, "err": allocErr})
+		f.recorder.Eventf(lb, v1.EventTypeWarning, lbutil.EventReasonVipAllocationFailed, "Allocate vip failed: %v", allocErr)
+		condition := lbutil.NewCondition(netv1alpha1.LoadBalancerVipAllocated, v1.ConditionFalse, "Exhausted", allocErr.Error())
+		_, err = lbutil.UpdateLBWithRetries(lbClient, lb.Namespace, lb.Name, func(lb *netv1alpha1.LoadBalancer) error {
+			if !lbutil.SetCondition(&lb.Status, condition) {
+				return errors.ErrPreconditionViolated
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return allocErr
+	}
+
+	condition := lbutil.NewCondition(netv1alpha1.LoadBalancerVipAllocated, v1.ConditionTrue, "Allocated", fmt.Sprintf("vip %s is allocated from pools", vip))
+	_, err = lbutil.UpdateLBWithRetries(lbClient, lb.Namespace, lb.Name, func(lb *netv1alpha1.LoadBalancer) error {
+		if lb.Spec.Providers.Ipvsdr == nil || lb.Spec.Providers.Ipvsdr.Vip != "" {
+			// vip has been filled in
+			return errors.ErrPreconditionViolated
+		}
+		lb.Spec.Providers.Ipvsdr.Vip = vip
+		if lb.Annotations == nil {
+			lb.Annotations = map[string]string{}
+		}
+		lb.Annotations[netv1alpha1.AnnotationKeyAllocatedVip] = vip
+		lbutil.SetCondition(&lb.Status, condition)
+		return nil
+	})
+	if err != nil {
+		logger.Error("Update allocated vip error", log.Fields{"lb": key, "vip": vip, "err": err})
+		return err
+	}
+
+	logger.Info("Allocate vip for ipvsdr provider", log.Fields{"lb": key, "vip": vip})
+	f.recorder.Eventf(lb, v1.EventTypeNormal, lbutil.EventReasonVipAllocated, "Allocate vip %s from pools", vip)
+	return nil
+}
+
+// usedVips returns the vips used by other loadbalancers
+func (f *ipvsdr) usedVips(lb *netv1alpha1.LoadBalancer) (sets.String, error) {
+	lbs, err := f.lbLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	used := sets.NewString()
+	for _, l := range lbs {
+		if l.Spec.Providers.Ipvsdr == nil {
+			continue
+		}
+		if l.UID == lb.UID {
+			// additional vips of lb itself
+			used.Insert(l.Spec.Providers.Ipvsdr.Vips...)
+			continue
+		}
+		used.Insert(allVips(l)...)
+	}
+	return used, nil
+}
+
+// allVips returns the primary vip and additional vips of lb
+func allVips(lb *netv1alpha1.LoadBalancer) []string {
+	vips := make([]string, 0, len(lb.Spec.Providers.Ipvsdr.Vips)+1)
+	if lb.Spec.Providers.Ipvsdr.Vip != "" {
+		vips = append(vips, lb.Spec.Providers.Ipvsdr.Vip)
+	}
+	return append(vips, lb.Spec.Providers.Ipvsdr.Vips...)
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// vipServiceName is the name of headless Service and Endpoints
+	// representing the vips of lb
+	vipServiceName = "%s-vip"
+)
+
+// vipPorts returns the ports served on the vips sorted by name, they are the
+// forwarded ports of ipvsdr except the ranges, or the http, https and l4 ports of proxy if none
+// is specified
+func vipPorts(lb *netv1alpha1.LoadBalancer) []v1.EndpointPort {
+	var ports []v1.EndpointPort
+	add := func(port int32, protocol v1.Protocol) {
+		if protocol == "" {
+			protocol = v1.ProtocolTCP
+		}
+		name := fmt.Sprintf("%s-%d", strings.ToLower(string(protocol)), port)
+		for _, p := range ports {
+			if p.Name == name {
+				return
+			}
+		}
+		ports = append(ports, v1.EndpointPort{Name: name, Port: port, Protocol: protocol})
+	}
+
+	if len(lb.Spec.Providers.Ipvsdr.Ports) != 0 {
+		for _, port := range lb.Spec.Providers.Ipvsdr.Ports {
+			if port.EndPort != 0 {
+				// a range may span thousands of ports, it is not published
+				continue
+			}
+			add(port.Port, port.Protocol)
+		}
+	} else {
+		add(80, v1.ProtocolTCP)
+		add(443, v1.ProtocolTCP)
+		for _, rule := range lb.Spec.TCPRules {
+			add(rule.Port, v1.ProtocolTCP)
+		}
+		for _, rule := range lb.Spec.UDPRules {
+			add(rule.Port, v1.ProtocolUDP)
+		}
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i].Name < ports[j].Name
+	})
+	return ports
+}
+
+// generateVipEndpoints generates the headless Service and Endpoints of vips
+func (f *ipvsdr) generateVipEndpoints(lb *netv1alpha1.LoadBalancer) (*v1.Service, *v1.Endpoints) {
+	t := true
+	meta := metav1.ObjectMeta{
+		Name:      fmt.Sprintf(vipServiceName, lb.Name),
+		Namespace: lb.Namespace,
+		Labels:    lbutil.WithArtifactLabels(f.selector(lb), lb, "provider-"+providerName),
+		OwnerReferences: []metav1.OwnerReference{
+			{
+				APIVersion:         controllerKind.GroupVersion().String(),
+				Kind:               controllerKind.Kind,
+				Name:               lb.Name,
+				UID:                lb.UID,
+				Controller:         &t,
+				BlockOwnerDeletion: &t,
+			},
+		},
+	}
+
+	ports := vipPorts(lb)
+	svc := &v1.Service{
+		ObjectMeta: meta,
+		Spec: v1.ServiceSpec{
+			Type:      v1.ServiceTypeClusterIP,
+			ClusterIP: v1.ClusterIPNone,
+		},
+	}
+	for _, port := range ports {
+		svc.Spec.Ports = append(svc.Spec.Ports, v1.ServicePort{
+			Name:     port.Name,
+			Port:     port.Port,
+			Protocol: port.Protocol,
+		})
+	}
+
+	subset := v1.EndpointSubset{Ports: ports}
+	for _, vip := range allVips(lb) {
+		subset.Addresses = append(subset.Addresses, v1.EndpointAddress{IP: vip})
+	}
+	ep := &v1.Endpoints{ObjectMeta: meta}
+	// an Endpoints without addresses is invalid, leave it empty until the
+	// vip is allocated
+	if len(subset.Addresses) != 0 {
+		ep.Subsets = []v1.EndpointSubset{subset}
+	}
+	return svc, ep
+}
+
+// ensureVipEndpoints ensures the headless Service and Endpoints of vips are up
+// to date if VipEndpoints is enabled, or deletes them otherwise
+func (f *ipvsdr) ensureVipEndpoints(lb *netv1alpha1.LoadBalancer) error {
+	if !lb.Spec.Providers.Ipvsdr.VipEndpoints {
+		return f.deleteVipEndpoints(lb)
+	}
+
+	desiredSvc, desiredEp := f.generateVipEndpoints(lb)
+	ports := vipPorts(lb)
+
+	svc, err := f.svcLister.Services(lb.Namespace).Get(desiredSvc.Name)
+	if errors.IsNotFound(err) {
+		logger.Info("About to create vip Service for ipvsdr", log.Fields{"svc.ns": lb.Namespace, "svc.name": desiredSvc.Name})
+		if _, err = f.client.CoreV1().Services(lb.Namespace).Create(desiredSvc); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if !reflect.DeepEqual(vipServicePorts(svc), ports) {
+		svc, _ = lbutil.ServiceDeepCopy(svc)
+		svc.Spec.Ports = desiredSvc.Spec.Ports
+		logger.Info("About to update vip Service for ipvsdr", log.Fields{"svc.ns": lb.Namespace, "svc.name": svc.Name})
+		if _, err = f.client.CoreV1().Services(lb.Namespace).Update(svc); err != nil {
+			return err
+		}
+	}
+
+	ep, err := f.epLister.Endpoints(lb.Namespace).Get(desiredEp.Name)
+	if errors.IsNotFound(err) {
+		logger.Info("About to create vip Endpoints for ipvsdr", log.Fields{"ep.ns": lb.Namespace, "ep.name": desiredEp.Name})
+		_, err = f.client.CoreV1().Endpoints(lb.Namespace).Create(desiredEp)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	vips := sets.NewString(allVips(lb)...)
+	if vipAddresses(ep).Equal(vips) && (vips.Len() == 0 || reflect.DeepEqual(vipEndpointsPorts(ep), ports)) {
+		return nil
+	}
+	ep, _ = lbutil.EndpointsDeepCopy(ep)
+	ep.Subsets = desiredEp.Subsets
+	logger.Info("About to update vip Endpoints for ipvsdr", log.Fields{"ep.ns": lb.Namespace, "ep.name": ep.Name})
+	_, err = f.client.CoreV1().Endpoints(lb.Namespace).Update(ep)
+	return err
+}
+
+// vipServicePorts returns the ports of svc without the fields defaulted by
+// api server, e.g. target port, so that they are comparable with vipPorts
+func vipServicePorts(svc *v1.Service) []v1.EndpointPort {
+	var ports []v1.EndpointPort
+	for _, port := range svc.Spec.Ports {
+		ports = append(ports, v1.EndpointPort{Name: port.Name, Port: port.Port, Protocol: port.Protocol})
+	}
+	return ports
+}
+
+// vipEndpointsPorts returns the ports of ep sorted by name as vipPorts, api
+// server repacks the subsets of endpoints and sorts the ports by hash
+func vipEndpointsPorts(ep *v1.Endpoints) []v1.EndpointPort {
+	var ports []v1.EndpointPort
+	for _, subset := range ep.Subsets {
+		ports = append(ports, subset.Ports...)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i].Name < ports[j].Name
+	})
+	return ports
+}
+
+// vipAddresses returns the addresses of ep
+func vipAddresses(ep *v1.Endpoints) sets.String {
+	addresses := sets.NewString()
+	for _, subset := range ep.Subsets {
+		for _, address := range subset.Addresses {
+			addresses.Insert(address.IP)
+		}
+	}
+	return addresses
+}
+
+// deleteVipEndpoints deletes the headless Service of vips if it exists, the
+// Endpoints of it is deleted explicitly as it has no selector
+func (f *ipvsdr) deleteVipEndpoints(lb *netv1alpha1.LoadBalancer) error {
+	name := fmt.Sprintf(vipServiceName, lb.Name)
+	if _, err := f.svcLister.Services(lb.Namespace).Get(name); err == nil {
+		err = f.client.CoreV1().Services(lb.Namespace).Delete(name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	if _, err := f.epLister.Endpoints(lb.Namespace).Get(name); err == nil {
+		err = f.client.CoreV1().Endpoints(lb.Namespace).Delete(name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	netlisters "github.com/caicloud/loadbalancer-controller/pkg/listers/networking/v1alpha1"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	minVRID = 1
+	maxVRID = 255
+)
+
+// allocation is a VRID allocated in the network
+type allocation struct {
+	network string
+	vrid    int
+}
+
+// vridAllocator allocates VRIDs which are unique among loadbalancers in the
+// same network. The VRIDs in use are recovered from status of loadbalancers,
+// allocations not yet observed by lister are recorded in memory. The released
+// VRIDs are quarantined for a cool-down, so that VRRP peers of the previous
+// instance do not take adverts of a new instance as their own
+type vridAllocator struct {
+	lock     sync.Mutex
+	lbLister netlisters.LoadBalancerLister
+	reserved sets.Int
+	cooldown time.Duration
+	// allocated is keyed by loadbalancer key
+	allocated map[string]allocation
+	// coolingDown is the time when the cool-down of VRID ends
+	coolingDown map[allocation]time.Time
+}
+
+func newVRIDAllocator(lbLister netlisters.LoadBalancerLister, reserved sets.Int, cooldown time.Duration) *vridAllocator {
+	return &vridAllocator{
+		lbLister:    lbLister,
+		reserved:    reserved,
+		cooldown:    cooldown,
+		allocated:   make(map[string]allocation),
+		coolingDown: make(map[allocation]time.Time),
+	}
+}
+
+// parseVRIDs parses a comma separated list of VRIDs or VRID ranges, e.g. 1-10,100
+func parseVRIDs(value string) (sets.Int, error) {
+	vrids := sets.NewInt()
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid vrid %q", part)
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid vrid range %q", part)
+			}
+		}
+		if start < minVRID || end > maxVRID || start > end {
+			return nil, fmt.Errorf("vrid %q out of range [%d, %d]", part, minVRID, maxVRID)
+		}
+		for i := start; i <= end; i++ {
+			vrids.Insert(i)
+		}
+	}
+	return vrids, nil
+}
+
+// allocate returns the VRID of vip of lb, the current one is kept if it does
+// not conflict with others, otherwise the lowest available VRID is allocated
+func (a *vridAllocator) allocate(lb *netv1alpha1.LoadBalancer, vip string) (int, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	key, err := controllerutil.KeyFunc(lb)
+	if err != nil {
+		return 0, err
+	}
+	key = allocationKey(lb, key, vip)
+	network := lb.Spec.Providers.Ipvsdr.Network
+	sharedVip := ""
+	if lb.Spec.Providers.Ipvsdr.Shared && vip == lb.Spec.Providers.Ipvsdr.Vip {
+		sharedVip = vip
+	}
+
+	used, err := a.used(key, network, sharedVip)
+	if err != nil {
+		return 0, err
+	}
+
+	if alloc, ok := a.allocated[key]; ok && alloc.network == network && !used.Has(alloc.vrid) {
+		return alloc.vrid, nil
+	}
+
+	current := vridsInStatus(lb)[vip]
+	if current != nil && a.available(*current, used) {
+		a.allocated[key] = allocation{network: network, vrid: *current}
+		return *current, nil
+	}
+
+	// the VRIDs in cool-down are kept by their current holders, e.g. the
+	// owner of a shared vip, but never allocated to others
+	used.Insert(a.coolingDownIn(network).List()...)
+	for vrid := minVRID; vrid <= maxVRID; vrid++ {
+		if a.available(vrid, used) {
+			a.allocated[key] = allocation{network: network, vrid: vrid}
+			return vrid, nil
+		}
+	}
+
+	delete(a.allocated, key)
+	return 0, fmt.Errorf("no available vrid in network %q", network)
+}
+
+// release forgets the VRIDs allocated to lb, they are quarantined along with
+// the VRIDs in status of lb
+func (a *vridAllocator) release(lb *netv1alpha1.LoadBalancer) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	key, _ := controllerutil.KeyFunc(lb)
+	for k, alloc := range a.allocated {
+		if k == key || strings.HasPrefix(k, key+"@") {
+			a.quarantine(alloc)
+			delete(a.allocated, k)
+		}
+	}
+	if lb.Spec.Providers.Ipvsdr != nil {
+		for _, vrid := range vridsInStatus(lb) {
+			a.quarantine(allocation{network: lb.Spec.Providers.Ipvsdr.Network, vrid: *vrid})
+		}
+	}
+}
+
+// releaseVip forgets the VRID allocated to vip of lb
+func (a *vridAllocator) releaseVip(lb *netv1alpha1.LoadBalancer, vip string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	key, _ := controllerutil.KeyFunc(lb)
+	delete(a.allocated, allocationKey(lb, key, vip))
+}
+
+// retain forgets the VRIDs allocated to vips of lb which are not in vips
+func (a *vridAllocator) retain(lb *netv1alpha1.LoadBalancer, vips []string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	key, _ := controllerutil.KeyFunc(lb)
+	keep := sets.NewString(key)
+	for _, vip := range vips {
+		keep.Insert(allocationKey(lb, key, vip))
+	}
+	for k, alloc := range a.allocated {
+		if strings.HasPrefix(k, key+"@") && !keep.Has(k) {
+			a.quarantine(alloc)
+			delete(a.allocated, k)
+		}
+	}
+}
+
+// quarantine keeps alloc from being allocated until the cool-down ends
+func (a *vridAllocator) quarantine(alloc allocation) {
+	if a.cooldown <= 0 {
+		return
+	}
+	a.coolingDown[alloc] = time.Now().Add(a.cooldown)
+}
+
+// quarantined returns the number of VRIDs in cool-down
+func (a *vridAllocator) quarantined() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.expire()
+	return len(a.coolingDown)
+}
+
+// coolingDownIn returns the VRIDs in cool-down in network
+func (a *vridAllocator) coolingDownIn(network string) sets.Int {
+	a.expire()
+	vrids := sets.NewInt()
+	for alloc := range a.coolingDown {
+		if alloc.network == network {
+			vrids.Insert(alloc.vrid)
+		}
+	}
+	return vrids
+}
+
+// expire forgets the VRIDs whose cool-down ended
+func (a *vridAllocator) expire() {
+	now := time.Now()
+	for alloc, until := range a.coolingDown {
+		if !now.Before(until) {
+			delete(a.coolingDown, alloc)
+		}
+	}
+}
+
+func (a *vridAllocator) available(vrid int, used sets.Int) bool {
+	return vrid >= minVRID && vrid <= maxVRID && !a.reserved.Has(vrid) && !used.Has(vrid)
+}
+
+// used returns the VRIDs used by other vips in the network, the loadbalancers
+// sharing the vip use the same VRID and are not counted
+func (a *vridAllocator) used(key, network, sharedVip string) (sets.Int, error) {
+	lbs, err := a.lbLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	used := sets.NewInt()
+	for _, lb := range lbs {
+		if lb.Spec.Providers.Ipvsdr == nil || lb.Spec.Providers.Ipvsdr.Network != network {
+			continue
+		}
+		k, _ := controllerutil.KeyFunc(lb)
+		for vip, vrid := range vridsInStatus(lb) {
+			ak := allocationKey(lb, k, vip)
+			if ak == key || vrid == nil {
+				continue
+			}
+			if _, ok := a.allocated[ak]; ok {
+				// in memory allocation is newer than status
+				continue
+			}
+			if sharedVip != "" && lb.Spec.Providers.Ipvsdr.Shared && vip == sharedVip {
+				continue
+			}
+			used.Insert(*vrid)
+		}
+	}
+	for k, alloc := range a.allocated {
+		if k != key && alloc.network == network {
+			used.Insert(alloc.vrid)
+		}
+	}
+	return used, nil
+}
+
+// allocationKey returns the key of allocation of vip, the primary vip is
+// keyed by lb key to keep allocations stable
+func allocationKey(lb *netv1alpha1.LoadBalancer, key, vip string) string {
+	if vip == lb.Spec.Providers.Ipvsdr.Vip {
+		return key
+	}
+	return key + "@" + vip
+}
+
+// vridsInStatus returns the VRIDs of vips recorded in status of lb
+func vridsInStatus(lb *netv1alpha1.LoadBalancer) map[string]*int {
+	vrids := make(map[string]*int)
+	status := lb.Status.ProvidersStatuses.Ipvsdr
+	if status == nil {
+		return vrids
+	}
+	if status.Vrid != nil && *status.Vrid >= 0 {
+		vrids[status.Vip] = status.Vrid
+	}
+	for _, s := range status.Vips {
+		if s.Vrid != nil && *s.Vrid >= 0 {
+			vrids[s.Vip] = s.Vrid
+		}
+	}
+	return vrids
+}
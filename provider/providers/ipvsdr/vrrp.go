@@ -0,0 +1,42 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"strconv"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+)
+
+// vrrpConfig passes the vrrp parameters set in spec to provider pods, the
+// advert interval is rendered in seconds as advert_int of keepalived
+func vrrpConfig(lb *netv1alpha1.LoadBalancer, data map[string]string) {
+	params := lb.Spec.Providers.Ipvsdr.VRRP
+	if params == nil {
+		return
+	}
+
+	if params.AdvertInterval > 0 {
+		data["advert-int"] = strconv.FormatFloat(float64(params.AdvertInterval)/1000, 'f', 2, 64)
+	}
+	if params.Fall > 0 {
+		data["fall"] = strconv.Itoa(int(params.Fall))
+	}
+	if params.Rise > 0 {
+		data["rise"] = strconv.Itoa(int(params.Rise))
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ipvsdr
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+	stringsutil "github.com/caicloud/loadbalancer-controller/pkg/util/strings"
+	"github.com/caicloud/loadbalancer-controller/pkg/util/validation"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// defaultNodeWeight is the weight of real servers without weight in spec or annotation
+const defaultNodeWeight = 1
+
+// nodeWeight returns the weight of node as real server of lb, the one in spec
+// overrides the one annotated on node. An invalid annotation is ignored
+func nodeWeight(lb *netv1alpha1.LoadBalancer, node *v1.Node) int32 {
+	if weight, ok := lb.Spec.Nodes.Weights[node.Name]; ok {
+		return weight
+	}
+	value, ok := node.Annotations[netv1alpha1.AnnotationKeyNodeWeight]
+	if !ok {
+		return defaultNodeWeight
+	}
+	weight, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+	if err == nil {
+		err = validation.ValidateNodeWeight(weight)
+	}
+	if err != nil {
+		logger.Warn("Invalid weight annotated on node, use the default one", log.Fields{"node": node.Name, "weight": value, "err": err})
+		return defaultNodeWeight
+	}
+	return int32(weight)
+}
+
+// weightsConfig passes the weights of nodes selected by lb to provider pods in
+// the format of name=weight, the nodes with default weight are omitted. The
+// weights are applied to real servers on reload, so that traffic is shifted
+// without restarting pods. The nodes of the idle proxy in blue/green
+// deployment are drained by zero weight
+func (f *ipvsdr) weightsConfig(lb *netv1alpha1.LoadBalancer, data map[string]string) {
+	var weights []string
+	serving := lbutil.ServingNodeNames(lb)
+	for _, name := range lbutil.ActiveNodeNames(lb) {
+		if !stringsutil.StringInSlice(name, serving) {
+			weights = append(weights, name+"=0")
+			continue
+		}
+		node, err := f.nodeLister.Get(name)
+		if err != nil {
+			continue
+		}
+		if weight := nodeWeight(lb, node); weight != defaultNodeWeight {
+			weights = append(weights, fmt.Sprintf("%s=%d", name, weight))
+		}
+	}
+	if len(weights) == 0 {
+		return
+	}
+	sort.Strings(weights)
+	data["weights"] = strings.Join(weights, ",")
+}
@@ -17,6 +17,10 @@ limitations under the License.
 package providers
 
 import (
+	// azure and gce provider
+	_ "github.com/caicloud/loadbalancer-controller/provider/providers/cloud"
+	// out-of-tree providers
+	_ "github.com/caicloud/loadbalancer-controller/provider/providers/external"
 	// ipvsdr proxy
 	_ "github.com/caicloud/loadbalancer-controller/provider/providers/ipvsdr"
 )
@@ -0,0 +1,103 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+)
+
+const (
+	// configKeyHTTPSnippet is inserted into the http block of nginx.conf
+	configKeyHTTPSnippet = "http-snippet"
+	// configKeyServerSnippet is inserted into every server block of nginx.conf
+	configKeyServerSnippet = "server-snippet"
+
+	// accessDeniedVariable is 1 for the requests denied by access control
+	accessDeniedVariable = "$loadbalancer_access_denied"
+)
+
+// accessControlConfig returns the nginx settings of access control in spec of
+// lb. Each list is evaluated into a variable which is 1 if the request is
+// denied by it, and the request is responded with 403 unless all are 0
+func accessControlConfig(lb *netv1alpha1.LoadBalancer) map[string]string {
+	ac := lb.Spec.Proxy.AccessControl
+	if ac == nil || len(ac.Allow)+len(ac.Deny)+len(ac.AllowCountries)+len(ac.DenyCountries) == 0 {
+		return nil
+	}
+
+	config := make(map[string]string)
+	var snippet bytes.Buffer
+	var checks []string
+	if len(ac.Deny) != 0 {
+		checks = append(checks, "$loadbalancer_source_denied")
+		writeLookup(&snippet, "geo $remote_addr", "$loadbalancer_source_denied", "0", ac.Deny, "1", nil, "")
+	}
+	if len(ac.Allow) != 0 {
+		checks = append(checks, "$loadbalancer_source_not_allowed")
+		writeLookup(&snippet, "geo $remote_addr", "$loadbalancer_source_not_allowed", "1", ac.Allow, "0", nil, "")
+	}
+	if len(ac.AllowCountries)+len(ac.DenyCountries) != 0 {
+		// the country of client is resolved by the GeoIP database of proxy,
+		// a client of unknown country is denied if AllowCountries is set
+		config["use-geoip"] = "true"
+		checks = append(checks, "$loadbalancer_country_denied")
+		fallback := "0"
+		if len(ac.AllowCountries) != 0 {
+			fallback = "1"
+		}
+		writeLookup(&snippet, "map $geoip_country_code", "$loadbalancer_country_denied", fallback, ac.AllowCountries, "0", ac.DenyCountries, "1")
+	}
+
+	// nginx has no boolean operators, the checks are joined into a string
+	// which must be all zeros
+	fmt.Fprintf(&snippet, "map \"%s\" %s {\n    default 1;\n    \"%s\" 0;\n}\n",
+		strings.Join(checks, ""), accessDeniedVariable, strings.Repeat("0", len(checks)))
+
+	config[configKeyHTTPSnippet] = snippet.String()
+	config[configKeyServerSnippet] = fmt.Sprintf("if (%s) {\n    return 403;\n}\n", accessDeniedVariable)
+	return config
+}
+
+// writeLookup writes a geo or map block which sets variable to value for keys,
+// to other for otherKeys and to fallback for the rest
+func writeLookup(w *bytes.Buffer, block, variable, fallback string, keys []string, value string, otherKeys []string, other string) {
+	fmt.Fprintf(w, "%s %s {\n    default %s;\n", block, variable, fallback)
+	for _, key := range keys {
+		fmt.Fprintf(w, "    %s %s;\n", key, value)
+	}
+	for _, key := range otherKeys {
+		fmt.Fprintf(w, "    %s %s;\n", key, other)
+	}
+	w.WriteString("}\n")
+}
+
+// mergeSnippets merges src into dst like merge, but the snippets of both are
+// concatenated instead of overridden
+func mergeSnippets(dst, src map[string]string) map[string]string {
+	ret := merge(dst, src)
+	for _, key := range []string{configKeyHTTPSnippet, configKeyServerSnippet} {
+		ret[key] = dst[key] + src[key]
+		if ret[key] == "" {
+			delete(ret, key)
+		}
+	}
+	return ret
+}
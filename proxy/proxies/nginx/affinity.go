@@ -0,0 +1,56 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+)
+
+const (
+	// configKeyStickySessions enables the cookie based affinity of upstreams
+	configKeyStickySessions = "enable-sticky-sessions"
+	// configKeyUpstreamHashBy balances upstreams by the hash of the variable
+	configKeyUpstreamHashBy = "upstream-hash-by"
+)
+
+// affinityConfig returns the nginx settings of session affinity, the cookie
+// based affinity is enabled in defaults
+func affinityConfig(affinity netv1alpha1.ProxySessionAffinity) map[string]string {
+	switch affinity {
+	case netv1alpha1.ProxySessionAffinityNone:
+		return map[string]string{
+			configKeyStickySessions: "false",
+		}
+	case netv1alpha1.ProxySessionAffinitySourceIP:
+		return map[string]string{
+			configKeyStickySessions: "false",
+			configKeyUpstreamHashBy: "$binary_remote_addr",
+		}
+	}
+	return nil
+}
+
+// effectiveAffinity returns the session affinity in effect with the config
+func effectiveAffinity(config map[string]string) netv1alpha1.ProxySessionAffinity {
+	if config[configKeyUpstreamHashBy] != "" {
+		return netv1alpha1.ProxySessionAffinitySourceIP
+	}
+	if config[configKeyStickySessions] == "true" {
+		return netv1alpha1.ProxySessionAffinityCookie
+	}
+	return netv1alpha1.ProxySessionAffinityNone
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	"github.com/caicloud/loadbalancer-controller/pkg/plugin"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/pkg/api/v1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+const (
+	greenComponent       = "proxy-" + proxyName + "-green"
+	greenConfigMapName   = "%s-proxy-nginx-green-config"
+	configMapArgPrefix   = "--configmap="
+	greenColorLabelValue = string(netv1alpha1.ProxyColorGreen)
+)
+
+// greenLabels returns the labels of green proxy besides the selector of proxy,
+// the selector of blue proxy is not changed, only its pods are labeled blue
+func (f *nginx) greenLabels(lb *netv1alpha1.LoadBalancer) labels.Set {
+	return labels.Set{netv1alpha1.LabelKeyProxyColor: greenColorLabelValue}
+}
+
+// greenSelector returns the labels selecting the pods of green proxy
+func (f *nginx) greenSelector(lb *netv1alpha1.LoadBalancer) labels.Set {
+	return labels.Merge(f.selector(lb), f.greenLabels(lb))
+}
+
+// blueSelector returns the selector of the pods of blue proxy, which are the
+// pods of proxy not labeled green
+func (f *nginx) blueSelector(lb *netv1alpha1.LoadBalancer) labels.Selector {
+	selector := f.selector(lb).AsSelector()
+	req, err := labels.NewRequirement(netv1alpha1.LabelKeyProxyColor, selection.NotEquals, []string{greenColorLabelValue})
+	if err != nil {
+		return selector
+	}
+	return selector.Add(*req)
+}
+
+// isGreen returns true if the workload is the green proxy
+func isGreen(obj metav1.Object) bool {
+	return obj.GetLabels()[netv1alpha1.LabelKeyProxyColor] == greenColorLabelValue
+}
+
+// placeColor labels the pods of deploy with color and runs them on the nodes
+// of the proxy of color only, one pod on each node
+func placeColor(lb *netv1alpha1.LoadBalancer, deploy *extensions.Deployment, color netv1alpha1.ProxyColor) {
+	names := lbutil.ProxyNodeNames(lb, color)
+	replicas := int32(len(names))
+	deploy.Spec.Replicas = &replicas
+	deploy.Spec.Template.Labels[netv1alpha1.LabelKeyProxyColor] = string(color)
+
+	hostname := v1.NodeSelectorRequirement{
+		Key:      metav1.LabelHostname,
+		Operator: v1.NodeSelectorOpIn,
+		Values:   names,
+	}
+	affinity := deploy.Spec.Template.Spec.Affinity
+	if affinity.NodeAffinity == nil {
+		affinity.NodeAffinity = &v1.NodeAffinity{}
+	}
+	required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) == 0 {
+		required = &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{{}}}
+	}
+	// the terms may be shared with the template of lb, copy them
+	terms := make([]v1.NodeSelectorTerm, 0, len(required.NodeSelectorTerms))
+	for _, term := range required.NodeSelectorTerms {
+		expressions := make([]v1.NodeSelectorRequirement, 0, len(term.MatchExpressions)+1)
+		expressions = append(expressions, term.MatchExpressions...)
+		expressions = append(expressions, hostname)
+		terms = append(terms, v1.NodeSelectorTerm{MatchExpressions: expressions})
+	}
+	affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &v1.NodeSelector{NodeSelectorTerms: terms}
+}
+
+// generateGreenDeployment generates the deployment of green proxy, it differs
+// from the blue one in labels, nodes, image and nginx config
+func (f *nginx) generateGreenDeployment(lb *netv1alpha1.LoadBalancer) *extensions.Deployment {
+	green := lb.Spec.Proxy.BlueGreen.Green
+	deploy := f.generateDeployment(lb)
+
+	podLabels := lbutil.WithArtifactLabels(f.greenSelector(lb), lb, greenComponent)
+	deploy.Name = lbutil.WorkloadName(lb, greenComponent)
+	deploy.Labels = podLabels
+	deploy.Spec.Selector.MatchLabels = f.greenSelector(lb)
+	deploy.Spec.Template.Labels = podLabels
+
+	container := &deploy.Spec.Template.Spec.Containers[0]
+	if green.Image != "" {
+		container.Image = green.Image
+	}
+	for i, arg := range container.Args {
+		if strings.HasPrefix(arg, configMapArgPrefix) {
+			container.Args[i] = configMapArgPrefix + lb.Namespace + "/" + fmt.Sprintf(greenConfigMapName, lb.Name)
+		}
+	}
+
+	placeColor(lb, deploy, netv1alpha1.ProxyColorGreen)
+	return deploy
+}
+
+// greenConfig returns the nginx config of green proxy
+func (f *nginx) greenConfig(lb *netv1alpha1.LoadBalancer) map[string]string {
+	return merge(f.proxyConfig(lb), lb.Spec.Proxy.BlueGreen.Green.Config)
+}
+
+// syncGreen reconciles the green proxy of lb, it is cleaned up once
+// blue/green deployment is disabled
+func (f *nginx) syncGreen(result *lbutil.Result, lb *netv1alpha1.LoadBalancer) error {
+	if lb.Spec.Proxy.BlueGreen == nil {
+		return f.cleanupGreen(lb)
+	}
+	dps, err := f.greenWorkloads.ClaimDeployments(lb)
+	if err != nil {
+		return err
+	}
+	// blue/green deployment is not supported in DaemonSet mode
+	return f.greenWorkloads.Sync(result, lb, dps, nil)
+}
+
+// cleanupGreen deletes the workloads and ConfigMap of green proxy if any
+func (f *nginx) cleanupGreen(lb *netv1alpha1.LoadBalancer) error {
+	cmName := fmt.Sprintf(greenConfigMapName, lb.Name)
+	dps, err := f.dLister.Deployments(lb.Namespace).List(labels.SelectorFromSet(f.greenSelector(lb)))
+	if err != nil {
+		return err
+	}
+	_, err = f.cmLister.ConfigMaps(lb.Namespace).Get(cmName)
+	if len(dps) == 0 && errors.IsNotFound(err) {
+		return nil
+	}
+
+	logger.Info("Blue/green deployment is disabled, clean up green proxy", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name})
+	if err := f.greenWorkloads.Cleanup(lb); err != nil {
+		return err
+	}
+	err = f.client.CoreV1().ConfigMaps(lb.Namespace).Delete(cmName, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// syncGreenStatus writes the pods of green proxy into the blue/green section
+// of proxy status, the rest is written by the blue proxy
+func (f *nginx) syncGreenStatus(lb *netv1alpha1.LoadBalancer, replicas int32, deployment string) error {
+	blueGreen := &netv1alpha1.ProxyBlueGreenStatus{
+		Active: lbutil.ActiveProxyColor(lb),
+		Green: netv1alpha1.PodStatuses{
+			Replicas: replicas,
+			Statuses: make([]netv1alpha1.PodStatus, 0),
+		},
+		GreenDeployment: deployment,
+		GreenConfigMap:  fmt.Sprintf(greenConfigMapName, lb.Name),
+	}
+
+	podList, err := f.podLister.List(labels.SelectorFromSet(f.greenSelector(lb)))
+	if err != nil {
+		logger.Error("get pod list error", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "err": err})
+		return err
+	}
+	for _, pod := range podList {
+		status := lbutil.ComputePodStatus(pod)
+		blueGreen.Green.TotalReplicas++
+		if status.Ready {
+			blueGreen.Green.ReadyReplicas++
+		}
+		blueGreen.Green.Statuses = append(blueGreen.Green.Statuses, status)
+	}
+	sort.Sort(lbutil.SortPodStatusByName(blueGreen.Green.Statuses))
+
+	return lbutil.WriteStatus(
+		f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
+		lb,
+		func(status *netv1alpha1.LoadBalancerStatus) bool {
+			if proxyBlueGreenStatusEqual(status.ProxyStatus.BlueGreen, blueGreen) {
+				return false
+			}
+			status.ProxyStatus.BlueGreen = blueGreen
+			return true
+		},
+	)
+}
+
+// proxyBlueGreenStatusEqual checks whether the given two statuses are equal
+func proxyBlueGreenStatusEqual(a, b *netv1alpha1.ProxyBlueGreenStatus) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if !lbutil.PodStatusesEqual(a.Green, b.Green) {
+		return false
+	}
+	x, y := *a, *b
+	x.Green, y.Green = netv1alpha1.PodStatuses{}, netv1alpha1.PodStatuses{}
+	return reflect.DeepEqual(x, y)
+}
+
+// planGreen plans the changes of sync to the green proxy of lb, dps are all
+// deployments of proxy
+func (f *nginx) planGreen(plan *lbutil.Plan, lb *netv1alpha1.LoadBalancer, dps []*extensions.Deployment) error {
+	cmName := fmt.Sprintf(greenConfigMapName, lb.Name)
+	if lb.Spec.Proxy.BlueGreen == nil {
+		for _, dp := range dps {
+			if isGreen(dp) {
+				plan.Delete("Deployment", dp.Name)
+			}
+		}
+		if _, err := f.cmLister.ConfigMaps(lb.Namespace).Get(cmName); err == nil {
+			plan.Delete("ConfigMap", cmName)
+		}
+		return nil
+	}
+
+	desiredDeploy := f.generateGreenDeployment(lb)
+	updated := false
+	for _, dp := range dps {
+		if !isGreen(dp) {
+			continue
+		}
+		// the pods of legacy deployments are handed over to the one named
+		// by lbutil.WorkloadName
+		if dp.Name != desiredDeploy.Name || updated {
+			if *dp.Spec.Replicas != 0 {
+				plan.Update("Deployment", dp.Name, []string{"spec.replicas"})
+			}
+			continue
+		}
+		updated = true
+		copyDp, changed, err := f.ensureDeployment(desiredDeploy, dp)
+		if err == nil && changed {
+			plan.Diff("Deployment", dp.Name, copyDp, dp)
+		}
+	}
+	if !updated {
+		plan.Create("Deployment", desiredDeploy.Name)
+	}
+	return plan.ConfigMap(f.client, lb.Namespace, cmName, f.greenConfig(lb))
+}
+
+var _ plugin.Renderer = greenRenderer{}
+
+// greenRenderer renders the objects of green proxy for the workload reconciler
+type greenRenderer struct {
+	*nginx
+}
+
+func (r greenRenderer) Deployment(lb *netv1alpha1.LoadBalancer) *extensions.Deployment {
+	return r.generateGreenDeployment(lb)
+}
+
+// DaemonSet is never called, blue/green deployment is rejected in DaemonSet mode
+func (r greenRenderer) DaemonSet(lb *netv1alpha1.LoadBalancer) *extensions.DaemonSet {
+	return nil
+}
+
+func (r greenRenderer) EnsureDeployment(desired, old *extensions.Deployment) (*extensions.Deployment, bool, error) {
+	return r.ensureDeployment(desired, old)
+}
+
+func (r greenRenderer) EnsureDaemonSet(desired, old *extensions.DaemonSet) (*extensions.DaemonSet, bool, error) {
+	return r.ensureDaemonSet(desired, old)
+}
+
+// EnsureDependencies ensures the nginx config of green proxy, the tcp and
+// udp services are shared with the blue one
+func (r greenRenderer) EnsureDependencies(result *lbutil.Result, lb *netv1alpha1.LoadBalancer) error {
+	podLabels := lbutil.WithArtifactLabels(r.selector(lb), lb, greenComponent)
+	return r.ensureConfigMap(fmt.Sprintf(greenConfigMapName, lb.Name), lb.Namespace, podLabels, r.greenConfig(lb))
+}
+
+func (r greenRenderer) SyncStatus(lb *netv1alpha1.LoadBalancer, workload plugin.Workload) error {
+	return r.syncGreenStatus(lb, workload.Replicas, workload.Deployment)
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"fmt"
+	"sort"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// reasonClassConflict is the reason of IngressClassConflict condition when
+// the ingress class is used by an earlier loadbalancer
+const reasonClassConflict = "UsedByOthers"
+
+// ingressClassConflict returns an error if the ingress class of lb is used by
+// an earlier loadbalancer, so that the Ingresses are never served by two
+// proxies and the running one is never disturbed by a newcomer
+func (f *nginx) ingressClassConflict(lb *netv1alpha1.LoadBalancer) error {
+	users, err := f.classUsers(lb)
+	if err != nil {
+		return err
+	}
+	if first := users[0]; first.UID != lb.UID {
+		return fmt.Errorf("ingress class %s is used by loadbalancer %s/%s", lbutil.IngressClass(lb), first.Namespace, first.Name)
+	}
+	return nil
+}
+
+// classUsers returns nginx loadbalancers using the ingress class of lb, sorted
+// by creation time, lb itself is included
+func (f *nginx) classUsers(lb *netv1alpha1.LoadBalancer) ([]*netv1alpha1.LoadBalancer, error) {
+	lbs, err := f.lbLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	class := lbutil.IngressClass(lb)
+	users := []*netv1alpha1.LoadBalancer{lb}
+	for _, l := range lbs {
+		if l.UID == lb.UID || l.DeletionTimestamp != nil || l.Spec.Proxy.Type != netv1alpha1.ProxyTypeNginx {
+			continue
+		}
+		if lbutil.IngressClass(l) == class {
+			users = append(users, l)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		ti, tj := users[i].CreationTimestamp, users[j].CreationTimestamp
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		ki, _ := controllerutil.KeyFunc(users[i])
+		kj, _ := controllerutil.KeyFunc(users[j])
+		return ki < kj
+	})
+	return users, nil
+}
+
+// enqueueClassUsers enqueues the other loadbalancers using the ingress class
+// of lb, a blocked one is synced once the earlier one changes its class or
+// is deleted
+func (f *nginx) enqueueClassUsers(lb *netv1alpha1.LoadBalancer) {
+	users, err := f.classUsers(lb)
+	if err != nil {
+		return
+	}
+	for _, u := range users {
+		if u.UID != lb.UID {
+			f.helper.Enqueue(u)
+		}
+	}
+}
+
+// ingressClassCondition returns the IngressClassConflict condition of err
+// returned by ingressClassConflict
+func ingressClassCondition(err error) netv1alpha1.LoadBalancerCondition {
+	if err != nil {
+		return lbutil.NewCondition(netv1alpha1.LoadBalancerIngressClassConflict, v1.ConditionTrue, reasonClassConflict, err.Error())
+	}
+	return lbutil.NewCondition(netv1alpha1.LoadBalancerIngressClassConflict, v1.ConditionFalse, "Unique", "")
+}
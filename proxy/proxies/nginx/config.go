@@ -19,9 +19,13 @@ package nginx
 import (
 	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 
 	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
-	log "github.com/zoumo/logdog"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/pkg/api/v1"
@@ -49,22 +53,35 @@ func merge(dst, src map[string]string) map[string]string {
 	return ret
 }
 
+// proxyConfig returns the config of nginx, the settings in spec override the
+// ones of waf, limits, access control, logging, session affinity, profile and
+// defaults in order. The snippets of logging, access control and limits are
+// concatenated
+func (f *nginx) proxyConfig(lb *netv1alpha1.LoadBalancer) map[string]string {
+	config := merge(merge(defaultConfig, f.shutdownConfig()), profiles[lb.Spec.Proxy.Profile])
+	config = merge(config, affinityConfig(lb.Spec.Proxy.SessionAffinity))
+	config = merge(config, loggingConfig(lb))
+	config = mergeSnippets(config, accessControlConfig(lb))
+	config = mergeSnippets(config, limitsConfig(lb))
+	config = merge(config, wafConfig(lb))
+	return merge(config, lb.Spec.Proxy.Config)
+}
+
 func (f *nginx) ensureConfigMaps(lb *netv1alpha1.LoadBalancer) error {
-	labels := f.selector(lb)
+	labels := lbutil.WithArtifactLabels(f.selector(lb), lb, "proxy-"+proxyName)
 
 	cmName := fmt.Sprintf(configMapName, lb.Name)
-	config := merge(defaultConfig, lb.Spec.Proxy.Config)
-	err := f.ensureConfigMap(cmName, lb.Namespace, labels, config)
+	err := f.ensureConfigMap(cmName, lb.Namespace, labels, f.proxyConfig(lb))
 	if err != nil {
 		return err
 	}
 	tcpcmName := fmt.Sprintf(tcpConfigMapName, lb.Name)
-	err = f.ensureConfigMap(tcpcmName, lb.Namespace, labels, nil)
+	err = f.ensureServicesConfigMap(tcpcmName, lb.Namespace, labels, l4Services(lb, lb.Spec.TCPRules))
 	if err != nil {
 		return err
 	}
 	udpcmName := fmt.Sprintf(udpConfigMapName, lb.Name)
-	err = f.ensureConfigMap(udpcmName, lb.Namespace, labels, nil)
+	err = f.ensureServicesConfigMap(udpcmName, lb.Namespace, labels, l4Services(lb, lb.Spec.UDPRules))
 	if err != nil {
 		return err
 	}
@@ -72,6 +89,79 @@ func (f *nginx) ensureConfigMaps(lb *netv1alpha1.LoadBalancer) error {
 	return nil
 }
 
+// l4Services converts rules to the data of tcp or udp services ConfigMap,
+// in which the key is port and the value is namespace/service:port
+func l4Services(lb *netv1alpha1.LoadBalancer, rules []netv1alpha1.L4Rule) map[string]string {
+	services := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		namespace := rule.Namespace
+		if namespace == "" {
+			namespace = lb.Namespace
+		}
+		services[strconv.Itoa(int(rule.Port))] = fmt.Sprintf("%s/%s:%s", namespace, rule.ServiceName, rule.ServicePort.String())
+	}
+	return services
+}
+
+// ensureServicesConfigMap writes services into tcp or udp services ConfigMap.
+// The ConfigMap may be changed by other apps, so only the ports recorded in
+// annotation are managed by controller, others are left untouched
+func (f *nginx) ensureServicesConfigMap(name, namespace string, labels, services map[string]string) error {
+	err := f.ensureConfigMap(name, namespace, labels, nil)
+	if err != nil {
+		return err
+	}
+	cm, err := f.client.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	data, managed, changed := servicesData(cm, services)
+	if !changed {
+		return nil
+	}
+
+	cm.Data = data
+	if cm.Annotations == nil {
+		cm.Annotations = make(map[string]string)
+	}
+	if managed == "" {
+		delete(cm.Annotations, netv1alpha1.AnnotationKeyManagedPorts)
+	} else {
+		cm.Annotations[netv1alpha1.AnnotationKeyManagedPorts] = managed
+	}
+	logger.Info("About to update services in ConfigMap", log.Fields{"cm.ns": namespace, "cm.name": cm.Name, "ports": managed})
+	_, err = f.client.CoreV1().ConfigMaps(namespace).Update(cm)
+
+	return err
+}
+
+// servicesData returns the data of services ConfigMap cm with the managed
+// ports replaced by services, the managed ports and whether cm is changed
+func servicesData(cm *v1.ConfigMap, services map[string]string) (map[string]string, string, bool) {
+	data := make(map[string]string)
+	for k, v := range cm.Data {
+		data[k] = v
+	}
+	// remove ports managed before
+	if managed := cm.Annotations[netv1alpha1.AnnotationKeyManagedPorts]; managed != "" {
+		for _, port := range strings.Split(managed, ",") {
+			delete(data, port)
+		}
+	}
+	ports := make([]string, 0, len(services))
+	for port, service := range services {
+		data[port] = service
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+	managed := strings.Join(ports, ",")
+
+	// nil and empty data are treated as the same
+	dataChanged := !reflect.DeepEqual(cm.Data, data) && (len(cm.Data) != 0 || len(data) != 0)
+	return data, managed, dataChanged || cm.Annotations[netv1alpha1.AnnotationKeyManagedPorts] != managed
+}
+
 func (f *nginx) ensureConfigMap(name, namespace string, labels, data map[string]string) error {
 	cm, err := f.client.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
 
@@ -87,7 +177,7 @@ func (f *nginx) ensureConfigMap(name, namespace string, labels, data map[string]
 			},
 			Data: data,
 		}
-		log.Info("About to craete ConfigMap for proxy", log.Fields{"cm.ns": namespace, "cm.name": cm.Name})
+		logger.Info("About to craete ConfigMap for proxy", log.Fields{"cm.ns": namespace, "cm.name": cm.Name})
 		_, nerr := f.client.CoreV1().ConfigMaps(namespace).Create(cm)
 		if nerr != nil {
 			return nerr
@@ -106,7 +196,7 @@ func (f *nginx) ensureConfigMap(name, namespace string, labels, data map[string]
 	}
 
 	cm.Data = data
-	log.Info("About to update ConfigMap data", log.Fields{"cm.ns": namespace, "cm.name": cm.Name})
+	logger.Info("About to update ConfigMap data", log.Fields{"cm.ns": namespace, "cm.name": cm.Name})
 	_, err = f.client.CoreV1().ConfigMaps(namespace).Update(cm)
 
 	return err
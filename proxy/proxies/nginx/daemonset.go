@@ -0,0 +1,103 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"reflect"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/util/audit"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// filter DaemonSet that controller does not care
+func (f *nginx) daemonSetFiltered(obj *extensions.DaemonSet) bool {
+	return f.filteredByLabel(obj)
+}
+
+func (f *nginx) ensureDaemonSet(desiredDs, oldDs *extensions.DaemonSet) (*extensions.DaemonSet, bool, error) {
+	copyDs, err := lbutil.DaemonSetDeepCopy(oldDs)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// ensure labels
+	for k, v := range desiredDs.Labels {
+		copyDs.Labels[k] = v
+	}
+	// ensure update strategy
+	copyDs.Spec.UpdateStrategy = desiredDs.Spec.UpdateStrategy
+	// ensure pod template
+	containersChanged, nodeAffinityChanged := f.ensurePodTemplate(&desiredDs.Spec.Template, &copyDs.Spec.Template, &oldDs.Spec.Template)
+
+	// check if changed
+	labelChanged := !reflect.DeepEqual(copyDs.Labels, oldDs.Labels)
+	updateStrategyChanged := !reflect.DeepEqual(copyDs.Spec.UpdateStrategy, oldDs.Spec.UpdateStrategy)
+
+	changed := labelChanged || updateStrategyChanged || nodeAffinityChanged || containersChanged
+	if changed {
+		logger.Info("Abount to correct nginx proxy daemonset", log.Fields{
+			"ds.name":               copyDs.Name,
+			"labelChanged":          labelChanged,
+			"updateStrategyChanged": updateStrategyChanged,
+			"nodeAffinityChanged":   nodeAffinityChanged,
+			"containersChanged":     containersChanged,
+		})
+	}
+	audit.Compare(proxyName, "DaemonSet", copyDs.Namespace+"/"+copyDs.Name, desiredDs.Spec, copyDs.Spec)
+
+	return copyDs, changed, nil
+}
+
+// generateDaemonSet generates a daemonset running the same pods as deployment,
+// the pods are always placed on nodes of lb by node affinity, otherwise they
+// would run on every node in cluster
+func (f *nginx) generateDaemonSet(lb *netv1alpha1.LoadBalancer) *extensions.DaemonSet {
+	deploy := f.GenerateDeployment(lb)
+	template := deploy.Spec.Template
+	// there is only one pod of daemonset on each node, no need to keep them apart
+	template.Spec.Affinity = lbutil.MergeAffinity(lb, &v1.Affinity{
+		NodeAffinity: f.nodeAffinity(lb),
+	})
+
+	return &extensions.DaemonSet{
+		ObjectMeta: deploy.ObjectMeta,
+		Spec: extensions.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: f.selector(lb),
+			},
+			Template:       template,
+			UpdateStrategy: lbutil.DaemonSetUpdateStrategy(lb),
+		},
+	}
+}
+
+// podUpdatedFunc returns a func telling whether a pod runs the latest template
+// of the active deployment or daemonset
+func (f *nginx) podUpdatedFunc(lb *netv1alpha1.LoadBalancer, daemonSet string, pods []*v1.Pod) func(*v1.Pod) bool {
+	var ds *extensions.DaemonSet
+	if daemonSet != "" {
+		ds, _ = f.dsLister.DaemonSets(lb.Namespace).Get(daemonSet)
+	}
+	return lbutil.PodUpdatedFunc(ds, pods)
+}
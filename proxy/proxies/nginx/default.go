@@ -17,7 +17,7 @@ limitations under the License.
 package nginx
 
 import (
-	log "github.com/zoumo/logdog"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -96,16 +96,16 @@ func (f *nginx) ensureDefaultHTTPBackend() error {
 	}
 
 	if _, err := f.client.ExtensionsV1beta1().Deployments(defaultHTTPBackendNamespace).Create(dp); err != nil && !errors.IsAlreadyExists(err) {
-		log.Error("Cannot create Deployments", log.Fields{"name": defaultHTTPBackendName, "ns": defaultHTTPBackendNamespace, "err": err})
+		logger.Error("Cannot create Deployments", log.Fields{"name": defaultHTTPBackendName, "ns": defaultHTTPBackendNamespace, "err": err})
 		return err
 	}
 
 	if _, err := f.client.CoreV1().Services(defaultHTTPBackendNamespace).Create(svc); err != nil && !errors.IsAlreadyExists(err) {
-		log.Error("Cannot create Service", log.Fields{"name": defaultHTTPBackendName, "ns": defaultHTTPBackendNamespace, "err": err})
+		logger.Error("Cannot create Service", log.Fields{"name": defaultHTTPBackendName, "ns": defaultHTTPBackendNamespace, "err": err})
 		return err
 	}
 
-	log.Infof("Ensure default-http-backend service for ingress controller success", log.Fields{"name": defaultHTTPBackendName, "ns": defaultHTTPBackendNamespace})
+	logger.Info("Ensure default-http-backend service for ingress controller success", log.Fields{"name": defaultHTTPBackendName, "ns": defaultHTTPBackendNamespace})
 
 	return nil
 }
@@ -0,0 +1,117 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The API of Ingress watched by nginx ingress controller. The extensions one
+// is removed since kubernetes 1.22, the networking one is served since 1.19
+const (
+	ingressAPIAuto       = "auto"
+	ingressAPIExtensions = "extensions/v1beta1"
+	ingressAPINetworking = "networking.k8s.io/v1"
+)
+
+// detectIngressAPI returns the API of Ingress to watch, the networking one
+// is selected automatically if it is served by the cluster
+func detectIngressAPI(client kubernetes.Interface, configured string) string {
+	if configured != ingressAPIAuto {
+		return configured
+	}
+
+	resources, err := client.Discovery().ServerResourcesForGroupVersion(ingressAPINetworking)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			logger.Warn("Discover ingress api error, fall back to extensions", log.Fields{"err": err})
+		}
+		return ingressAPIExtensions
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == "ingresses" {
+			return ingressAPINetworking
+		}
+	}
+	return ingressAPIExtensions
+}
+
+// ingressArgs returns the args of nginx ingress controller for the API of
+// Ingress, the controller watching networking Ingress also matches the
+// IngressClass named after ingress class besides the annotation
+func (f *nginx) ingressArgs() []string {
+	if f.ingressAPI != ingressAPINetworking {
+		return nil
+	}
+	return []string{
+		"--ingress-class-by-name=true",
+	}
+}
+
+// deleteIngresses deletes Ingresses matched by selector in all namespaces
+func (f *nginx) deleteIngresses(selector string) error {
+	if f.ingressAPI != ingressAPINetworking {
+		ingresses, err := f.client.ExtensionsV1beta1().Ingresses(metav1.NamespaceAll).List(metav1.ListOptions{
+			LabelSelector: selector,
+		})
+		if err != nil {
+			return err
+		}
+		for _, ingress := range ingresses.Items {
+			err = f.client.ExtensionsV1beta1().Ingresses(ingress.Namespace).Delete(ingress.Name, &metav1.DeleteOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// the vendored client does not know networking Ingress, only metadata is needed
+	restClient := f.client.ExtensionsV1beta1().RESTClient()
+	raw, err := restClient.Get().
+		AbsPath("/apis", ingressAPINetworking, "ingresses").
+		Param("labelSelector", selector).
+		DoRaw()
+	if err != nil {
+		return err
+	}
+	list := struct {
+		Items []struct {
+			metav1.ObjectMeta `json:"metadata"`
+		} `json:"items"`
+	}{}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return fmt.Errorf("decode ingress list error: %v", err)
+	}
+	for _, ingress := range list.Items {
+		err = restClient.Delete().
+			AbsPath("/apis", ingressAPINetworking, "namespaces", ingress.Namespace, "ingresses", ingress.Name).
+			Do().
+			Error()
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
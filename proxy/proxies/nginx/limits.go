@@ -0,0 +1,60 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"fmt"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+)
+
+const (
+	// rateLimitZone is the shared memory zone counting requests of clients
+	rateLimitZone = "loadbalancer_requests"
+	// connLimitZone is the shared memory zone counting connections of clients
+	connLimitZone = "loadbalancer_connections"
+	// limitZoneSize holds the states of about 160 thousands client addresses
+	limitZoneSize = "10m"
+	// limitStatusCode is the status of requests exceeding limits
+	limitStatusCode = "429"
+)
+
+// limitsConfig returns the nginx settings of limits in spec of lb, the limits
+// are applied to every server by the binary address of client
+func limitsConfig(lb *netv1alpha1.LoadBalancer) map[string]string {
+	limits := lb.Spec.Proxy.Limits
+	if limits == nil || (limits.RequestsPerSecond == 0 && limits.Connections == 0) {
+		return nil
+	}
+
+	var httpSnippet, serverSnippet string
+	if limits.RequestsPerSecond > 0 {
+		httpSnippet += fmt.Sprintf("limit_req_zone $binary_remote_addr zone=%s:%s rate=%dr/s;\n",
+			rateLimitZone, limitZoneSize, limits.RequestsPerSecond)
+		serverSnippet += fmt.Sprintf("limit_req zone=%s burst=%d nodelay;\n", rateLimitZone, limits.Burst)
+	}
+	if limits.Connections > 0 {
+		httpSnippet += fmt.Sprintf("limit_conn_zone $binary_remote_addr zone=%s:%s;\n", connLimitZone, limitZoneSize)
+		serverSnippet += fmt.Sprintf("limit_conn %s %d;\n", connLimitZone, limits.Connections)
+	}
+	return map[string]string{
+		configKeyHTTPSnippet:     httpSnippet,
+		configKeyServerSnippet:   serverSnippet,
+		"limit-req-status-code":  limitStatusCode,
+		"limit-conn-status-code": limitStatusCode,
+	}
+}
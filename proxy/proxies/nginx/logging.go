@@ -0,0 +1,69 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+)
+
+// jsonLogFormat is the access log format of nginx writing a json object per request
+const jsonLogFormat = `{"time": "$time_iso8601", "remote_addr": "$remote_addr", "request_id": "$request_id", ` +
+	`"host": "$host", "method": "$request_method", "uri": "$request_uri", "protocol": "$server_protocol", ` +
+	`"status": $status, "bytes_sent": $bytes_sent, "request_time": $request_time, "referer": "$http_referer", ` +
+	`"user_agent": "$http_user_agent", "upstream_addr": "$upstream_addr", "upstream_status": "$upstream_status", ` +
+	`"upstream_response_time": "$upstream_response_time", "proxy_upstream_name": "$proxy_upstream_name"}`
+
+// samplingVariable is 1 for the requests sampled into access log
+const samplingVariable = "$loadbalancer_access_log_sampled"
+
+// loggingConfig returns the nginx settings of logging in spec of lb
+func loggingConfig(lb *netv1alpha1.LoadBalancer) map[string]string {
+	logging := lb.Spec.Proxy.Logging
+	if logging == nil {
+		return nil
+	}
+
+	config := make(map[string]string)
+	if logging.Format == netv1alpha1.ProxyLogFormatJSON {
+		config["log-format-escape-json"] = "true"
+		config["log-format-upstream"] = jsonLogFormat
+	}
+
+	if strings.HasPrefix(logging.Destination, "syslog://") {
+		// nginx writes logs to syslog natively, the logs are tagged with lb
+		server := strings.TrimPrefix(logging.Destination, "syslog://")
+		tag := strings.Replace(fmt.Sprintf("%s_%s", lb.Namespace, lb.Name), "-", "_", -1)
+		config["access-log-path"] = fmt.Sprintf("syslog:server=%s,tag=%s", server, tag)
+		config["error-log-path"] = fmt.Sprintf("syslog:server=%s,tag=%s", server, tag)
+	}
+
+	if rate := logging.SamplingRate; rate != nil && *rate < 100 {
+		// requests are sampled by the hash of request id
+		config[configKeyHTTPSnippet] = fmt.Sprintf("split_clients $request_id %s {\n    %s%% 1;\n    * 0;\n}\n",
+			samplingVariable, strconv.Itoa(int(*rate)))
+		config["access-log-params"] = "if=" + samplingVariable
+	}
+
+	if logging.ErrorLogLevel != "" {
+		config["error-log-level"] = logging.ErrorLogLevel
+	}
+	return config
+}
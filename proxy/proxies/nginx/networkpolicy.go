@@ -0,0 +1,61 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"fmt"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// networkPolicyName is the name of NetworkPolicy of proxy pods
+const networkPolicyName = "%s-proxy-nginx"
+
+// ensureNetworkPolicy restricts the ingress of proxy pods to the declared
+// ports and the egress to the CIDRs of controller, nothing is generated if
+// it is disabled
+func (f *nginx) ensureNetworkPolicy(result *lbutil.Result, lb *netv1alpha1.LoadBalancer) error {
+	if !f.networkPolicy.Enabled {
+		return nil
+	}
+
+	var ports []lbutil.NetworkPolicyPort
+	for _, p := range f.containerPorts(lb, false) {
+		ports = append(ports, lbutil.NetworkPolicyPort{Protocol: p.Protocol, Port: p.ContainerPort})
+	}
+	name := fmt.Sprintf(networkPolicyName, lb.Name)
+	meta := metav1.ObjectMeta{
+		Name:      name,
+		Namespace: lb.Namespace,
+		Labels:    lbutil.WithArtifactLabels(f.selector(lb), lb, "proxy-"+proxyName),
+	}
+
+	action, err := lbutil.EnsureNetworkPolicy(f.client, meta, f.selector(lb), ports, f.networkPolicy.CIDRs())
+	if err != nil {
+		return err
+	}
+	switch action {
+	case lbutil.ActionCreated:
+		result.Created("NetworkPolicy", name)
+	case lbutil.ActionUpdated:
+		result.Updated("NetworkPolicy", name)
+	}
+	return nil
+}
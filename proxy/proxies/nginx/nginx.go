@@ -20,21 +20,23 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/caicloud/loadbalancer-controller/config"
 	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
 	"github.com/caicloud/loadbalancer-controller/pkg/informers"
 	netlisters "github.com/caicloud/loadbalancer-controller/pkg/listers/networking/v1alpha1"
-	"github.com/caicloud/loadbalancer-controller/pkg/toleration"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+	"github.com/caicloud/loadbalancer-controller/pkg/plugin"
 	"github.com/caicloud/loadbalancer-controller/pkg/tprclient"
+	"github.com/caicloud/loadbalancer-controller/pkg/util/audit"
+	"github.com/caicloud/loadbalancer-controller/pkg/util/canary"
 	controllerutil "github.com/caicloud/loadbalancer-controller/pkg/util/controller"
 	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
 	"github.com/caicloud/loadbalancer-controller/pkg/util/validation"
 	"github.com/caicloud/loadbalancer-controller/proxy"
-	log "github.com/zoumo/logdog"
 
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -48,8 +50,8 @@ import (
 	"k8s.io/client-go/pkg/api/v1"
 	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
-	"k8s.io/kubernetes/pkg/controller"
 )
 
 const (
@@ -65,6 +67,10 @@ const (
 var (
 	// controllerKind contains the schema.GroupVersionKind for this controller type.
 	controllerKind = netv1alpha1.SchemeGroupVersion.WithKind(netv1alpha1.LoadBalancerKind)
+	// finalizer blocks the deletion of loadbalancer until nginx proxy is cleaned up
+	finalizer = fmt.Sprintf(netv1alpha1.FinalizerFormat, proxyName)
+	// logger logs with the level of nginx proxy
+	logger = log.For(proxyName)
 )
 
 func init() {
@@ -76,23 +82,44 @@ var _ proxy.Plugin = &nginx{}
 type nginx struct {
 	initialized           bool
 	image                 string
+	rollout               *canary.Rollout
 	sidecar               string
 	defaultHTTPbackend    string
 	defaultSSLCertificate string
+	shutdownTimeout       int
+	workers               int
+	// ingressAPI is the API of Ingress watched by nginx ingress controller
+	ingressAPI string
+	// networkPolicy restricts the ingress and egress of proxy pods if enabled
+	networkPolicy config.NetworkPolicy
+	// security configures the ServiceAccount and privileges of proxy pods
+	security config.Security
+	// monitoring generates the PodMonitor of proxy pods if enabled
+	monitoring config.Monitoring
+	// wafImage replaces image for loadbalancers enabling WAF if it is set
+	wafImage string
 
 	client    kubernetes.Interface
 	tprclient tprclient.Interface
 
 	helper *controllerutil.Helper
+	// workloads reconciles the deployments and daemonsets of proxy
+	workloads *plugin.Reconciler
+	// greenWorkloads reconciles the deployment of green proxy
+	greenWorkloads *plugin.Reconciler
 
 	lbLister        netlisters.LoadBalancerLister
 	dLister         extensionslisters.DeploymentLister
+	dsLister        extensionslisters.DaemonSetLister
 	podLister       corelisters.PodLister
+	secretLister    corelisters.SecretLister
+	cmLister        corelisters.ConfigMapLister
 	lbListerSynced  cache.InformerSynced
 	dListerSynced   cache.InformerSynced
 	podListerSynced cache.InformerSynced
 
-	queue workqueue.RateLimitingInterface
+	queue    workqueue.RateLimitingInterface
+	recorder record.EventRecorder
 }
 
 // NewNginx creates a new nginx proxy plugin
@@ -100,56 +127,144 @@ func NewNginx() proxy.Plugin {
 	return &nginx{}
 }
 
+// ValidateConfig validates the nginx section of configuration
+func (f *nginx) ValidateConfig(cfg config.Configuration) error {
+	if cfg.Proxies.Nginx.Image == "" {
+		return fmt.Errorf("proxies.nginx.image is empty")
+	}
+	if cfg.Proxies.Sidecar.Image == "" {
+		return fmt.Errorf("proxies.sidecar.image is empty")
+	}
+	if cfg.Proxies.DefaultHTTPBackend == "" {
+		return fmt.Errorf("proxies.defaultHTTPBackend is empty")
+	}
+	if cfg.Proxies.Nginx.Workers <= 0 {
+		return fmt.Errorf("proxies.nginx.workers must be positive")
+	}
+	if cfg.Proxies.Nginx.ShutdownTimeout < 0 {
+		return fmt.Errorf("proxies.nginx.shutdownTimeout must be non-negative")
+	}
+	switch cfg.Proxies.Nginx.IngressAPI {
+	case ingressAPIAuto, ingressAPIExtensions:
+	case ingressAPINetworking:
+		if cfg.Proxies.Nginx.IngressV1Image == "" {
+			return fmt.Errorf("proxies.nginx.ingressV1Image is empty")
+		}
+	default:
+		return fmt.Errorf("proxies.nginx.ingressAPI %q is invalid", cfg.Proxies.Nginx.IngressAPI)
+	}
+	return nil
+}
+
 func (f *nginx) Init(cfg config.Configuration, sif informers.SharedInformerFactory) {
 	if f.initialized {
 		return
 	}
 	f.initialized = true
 
-	log.Info("Initialize the nginx proxy")
+	logger.Info("Initialize the nginx proxy")
 	// set config
 	f.defaultHTTPbackend = cfg.Proxies.DefaultHTTPBackend
 	f.defaultSSLCertificate = cfg.Proxies.DefaultSSLCertificate
 	f.sidecar = cfg.Proxies.Sidecar.Image
-	f.image = cfg.Proxies.Nginx.Image
-	f.client = cfg.Client
-	f.tprclient = cfg.TPRClient
+	f.shutdownTimeout = cfg.Proxies.Nginx.ShutdownTimeout
+	f.workers = cfg.Proxies.Nginx.Workers
+	f.networkPolicy = cfg.NetworkPolicy
+	f.security = cfg.Security
+	f.monitoring = cfg.Monitoring
+	f.client, f.tprclient = cfg.PluginClients(proxyName)
+	// the controller watching extensions Ingress stops working on modern
+	// clusters, its image is replaced and the canary image is left out
+	f.ingressAPI = detectIngressAPI(f.client, cfg.Proxies.Nginx.IngressAPI)
+	if f.ingressAPI == ingressAPINetworking && cfg.Proxies.Nginx.IngressV1Image != "" {
+		f.image = cfg.Proxies.Nginx.IngressV1Image
+		f.rollout = canary.NewRollout(proxyName, f.image, "", cfg.Rollout)
+	} else {
+		f.image = cfg.Proxies.Nginx.Image
+		f.rollout = canary.NewRollout(proxyName, cfg.Proxies.Nginx.Image, cfg.Proxies.Nginx.CanaryImage, cfg.Rollout)
+	}
+	f.wafImage = cfg.Proxies.Nginx.WAFImage
+	f.recorder = cfg.Recorder
 
 	// initialize controller
 	lbInformer := sif.Networking().V1alpha1().LoadBalancer()
 	dInformer := sif.Extensions().V1beta1().Deployments()
+	dsInformer := sif.Extensions().V1beta1().DaemonSets()
 	podInfomer := sif.Core().V1().Pods()
+	secretInformer := sif.Core().V1().Secrets()
+	cmInformer := sif.Core().V1().ConfigMaps()
 
 	f.lbLister = lbInformer.Lister()
 	f.dLister = dInformer.Lister()
+	f.dsLister = dsInformer.Lister()
 	f.podLister = podInfomer.Lister()
-
-	f.queue = workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "proxy-nginx")
+	f.secretLister = secretInformer.Lister()
+	f.cmLister = cmInformer.Lister()
+
+	f.workloads = &plugin.Reconciler{
+		Name:      proxyName,
+		Component: "proxy-" + proxyName,
+		Selector:  f.selector,
+		Exclude:   f.greenLabels,
+		Renderer:  renderer{f},
+		Client:    f.client,
+		TPRClient: f.tprclient,
+		DLister:   f.dLister,
+		DSLister:  f.dsLister,
+		Recorder:  f.recorder,
+	}
+	f.greenWorkloads = &plugin.Reconciler{
+		Name:      proxyName,
+		Component: greenComponent,
+		Selector:  f.greenSelector,
+		Renderer:  greenRenderer{f},
+		Client:    f.client,
+		TPRClient: f.tprclient,
+		DLister:   f.dLister,
+		DSLister:  f.dsLister,
+		Recorder:  f.recorder,
+	}
+
+	f.queue = workqueue.NewNamedRateLimitingQueue(cfg.RateLimiter.New(), "proxy-nginx")
 	f.helper = controllerutil.NewHelperForKeyFunc(&netv1alpha1.LoadBalancer{}, f.queue, f.syncLoadBalancer, controllerutil.PassthroughKeyFunc)
+	f.helper.Name = "proxy-nginx"
+	f.helper.SyncFailureHandler = lbutil.NewSyncFailureHandler(f.helper.Name, f.tprclient, f.recorder)
 
 	dInformer.Informer().AddEventHandler(lbutil.NewEventHandlerForDeployment(f.lbLister, f.dLister, f.helper, f.deploymentFiltered))
+	dsInformer.Informer().AddEventHandler(lbutil.NewEventHandlerForDaemonSet(f.lbLister, f.helper, f.daemonSetFiltered))
 	podInfomer.Informer().AddEventHandler(lbutil.NewEventHandlerForSyncStatusWithPod(f.lbLister, f.podLister, f.helper, f.podFiltered))
+	secretInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    f.enqueueForSecret,
+		UpdateFunc: f.updateSecret,
+		DeleteFunc: f.enqueueForSecret,
+	})
+	cmInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    f.enqueueForConfigMap,
+		UpdateFunc: f.updateConfigMap,
+		DeleteFunc: f.enqueueForConfigMap,
+	})
 }
 
 func (f *nginx) Run(stopCh <-chan struct{}) {
-	workers := 1
+	workers := f.workers
 	if !f.initialized {
-		log.Panic("Please initialize proxy before you run it")
+		logger.Panic("Please initialize proxy before you run it")
 		return
 	}
 
 	defer utilruntime.HandleCrash()
 
-	log.Info("Starting nginx proxy", log.Fields{
+	logger.Info("Starting nginx proxy", log.Fields{
 		"workers":              workers,
 		"image":                f.image,
+		"ingressAPI":           f.ingressAPI,
 		"default-http-backend": f.defaultHTTPbackend,
 		"sidecar":              f.sidecar,
 	})
-	defer log.Info("Shutting down nginx proxy")
+	defer logger.Info("Shutting down nginx proxy")
 
 	if err := f.ensureDefaultHTTPBackend(); err != nil {
-		log.Error("ensure default http backend service error", log.Fields{"err": err})
+		logger.Error("ensure default http backend service error", log.Fields{"err": err})
 		return
 	}
 
@@ -157,7 +272,7 @@ func (f *nginx) Run(stopCh <-chan struct{}) {
 	// there is no need to wait again here
 
 	defer func() {
-		log.Info("Shutting down nginx proxy")
+		logger.Info("Shutting down nginx proxy")
 		f.helper.ShutDown()
 	}()
 
@@ -192,12 +307,23 @@ func (f *nginx) filteredByLabel(obj metav1.ObjectMetaAccessor) bool {
 }
 
 func (f *nginx) OnSync(lb *netv1alpha1.LoadBalancer) {
-	if lb.Spec.Proxy.Type != netv1alpha1.ProxyTypeNginx {
+	if lb.Spec.Proxy.Type != netv1alpha1.ProxyTypeNginx && !lbutil.HasFinalizer(lb, finalizer) {
 		// It is not my responsible
 		return
 	}
-	log.Info("Syncing proxy, triggered by lb controller", log.Fields{"lb": lb.Name, "namespace": lb.Namespace})
+	logger.Info("Syncing proxy, triggered by lb controller", log.Fields{"lb": lb.Name, "namespace": lb.Namespace})
 	f.helper.Enqueue(lb)
+	f.enqueueClassUsers(lb)
+}
+
+// ForceResync re-reconciles the proxy of loadbalancer
+func (f *nginx) ForceResync(namespace, name string) error {
+	lb, err := f.lbLister.LoadBalancers(namespace).Get(name)
+	if err != nil {
+		return err
+	}
+	f.OnSync(lb)
+	return nil
 }
 
 // TODO use event
@@ -209,22 +335,22 @@ func (f *nginx) syncLoadBalancer(obj interface{}) error {
 		return fmt.Errorf("expect loadbalancer, got %v", obj)
 	}
 
-	// Validate loadbalancer scheme
-	if err := validation.ValidateLoadBalancer(lb); err != nil {
-		log.Debug("invalid loadbalancer scheme", log.Fields{"err": err})
-		return err
-	}
-
 	key, _ := controllerutil.KeyFunc(lb)
 
 	startTime := time.Now()
 	defer func() {
-		log.Debug("Finished syncing nginx proxy", log.Fields{"lb": key, "usedTime": time.Since(startTime)})
+		logger.Debug("Finished syncing nginx proxy", log.Fields{"lb": key, "usedTime": time.Since(startTime)})
 	}()
 
 	nlb, err := f.lbLister.LoadBalancers(lb.Namespace).Get(lb.Name)
 	if errors.IsNotFound(err) {
-		log.Warn("LoadBalancer has been deleted, clean up proxy", log.Fields{"lb": key})
+		if !lbutil.IsOwned(lb) {
+			return nil
+		}
+		if lbutil.IsDryRun(lb) {
+			return f.plan(lb, true)
+		}
+		logger.Warn("LoadBalancer has been deleted, clean up proxy", log.Fields{"lb": key})
 
 		return f.cleanup(lb)
 	}
@@ -244,111 +370,90 @@ func (f *nginx) syncLoadBalancer(obj interface{}) error {
 		return err
 	}
 
-	ds, err := f.getDeploymentsForLoadBalancer(lb)
-	if err != nil {
-		return err
+	if !lbutil.IsOwned(lb) {
+		// reconciled by another controller
+		return nil
 	}
 
-	if lb.DeletionTimestamp != nil {
-		// TODO sync status only
-		return nil
+	// loadbalancer is being deleted or proxy has been changed
+	deleting := lb.DeletionTimestamp != nil || lb.Spec.Proxy.Type != netv1alpha1.ProxyTypeNginx
+	if !deleting {
+		// validate loadbalancer scheme, the cleanup of a loadbalancer being
+		// deleted never depends on a valid spec
+		if err := validation.ValidateLoadBalancer(lb); err != nil {
+			logger.Debug("invalid loadbalancer scheme", log.Fields{"err": err})
+			return err
+		}
 	}
 
-	return f.sync(lb, ds)
+	if lbutil.IsDryRun(lb) {
+		return f.plan(lb, false)
+	}
 
-}
+	if deleting {
+		return f.finalize(lb)
+	}
 
-func (f *nginx) getDeploymentsForLoadBalancer(lb *netv1alpha1.LoadBalancer) ([]*extensions.Deployment, error) {
+	if lbutil.IsPaused(lb) {
+		logger.Debug("LoadBalancer is paused, skip syncing nginx proxy", log.Fields{"lb": key})
+		return nil
+	}
 
-	// construct selector
-	selector := f.selector(lb).AsSelector()
+	if lbutil.IsQuotaExceeded(lb) {
+		logger.Debug("LoadBalancer exceeds quota, skip syncing nginx proxy", log.Fields{"lb": key})
+		return nil
+	}
 
-	// list all
-	dList, err := f.dLister.Deployments(lb.Namespace).List(selector)
+	err = lbutil.AddFinalizer(f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, finalizer)
 	if err != nil {
-		return nil, err
+		logger.Error("Add nginx finalizer error", log.Fields{"lb": key, "err": err})
+		return err
 	}
 
-	// If any adoptions are attempted, we should first recheck for deletion with
-	// an uncached quorum read sometime after listing deployment (see kubernetes#42639).
-	canAdoptFunc := controller.RecheckDeletionTimestamp(func() (metav1.Object, error) {
-		// fresh lb
-		fresh, err := f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace).Get(lb.Name, metav1.GetOptions{})
-		if err != nil {
-			return nil, err
-		}
-
-		if fresh.UID != lb.UID {
-			return nil, fmt.Errorf("original LoadBalancer %v/%v is gone: got uid %v, wanted %v", lb.Namespace, lb.Name, fresh.UID, lb.UID)
-		}
-		return fresh, nil
-	})
-
-	cm := controllerutil.NewDeploymentControllerRefManager(f.client, lb, selector, controllerKind, canAdoptFunc)
-	return cm.Claim(dList)
-}
-
-// sync generate desired deployment from lb and compare it with existing deployment
-func (f *nginx) sync(lb *netv1alpha1.LoadBalancer, dps []*extensions.Deployment) error {
-	desiredDeploy := f.GenerateDeployment(lb)
-
-	// update
-	var err error
-	updated := false
-	activeDeploy := desiredDeploy
-
-	for _, dp := range dps {
-
-		// two conditions will trigger controller to scale down deployment
-		// 1. deployment does not have auto-generated prefix
-		// 2. if there are more than one active controllers, there may be many valid deployments.
-		//    But we only need one.
-		if !strings.HasPrefix(dp.Name, lb.Name+proxyNameSuffix) || updated {
-			if *dp.Spec.Replicas == 0 {
-				continue
-			}
-			// scale unexpected deployment replicas to zero
-			log.Info("Scale unexpected proxy replicas to zero", log.Fields{"d.name": dp.Name, "lb.name": lb.Name})
-			copy, _ := lbutil.DeploymentDeepCopy(dp)
-			replica := int32(0)
-			copy.Spec.Replicas = &replica
-			f.client.ExtensionsV1beta1().Deployments(lb.Namespace).Update(copy)
-			continue
-		}
-
-		updated = true
-		copyDp, changed, newErr := f.ensureDeployment(desiredDeploy, dp)
-		if newErr != nil {
-			err = newErr
-			continue
-		}
-		if changed {
-			log.Info("Sync nginx for lb", log.Fields{"d.name": dp.Name, "lb.name": lb.Name})
-			_, err = f.client.ExtensionsV1beta1().Deployments(lb.Namespace).Update(copyDp)
-			if err != nil {
-				return err
-			}
-		}
-		activeDeploy = copyDp
+	result := lbutil.NewProxyResult(proxyName)
+	if err := f.ingressClassConflict(lb); err != nil {
+		// proxy is not synced until the conflict is resolved
+		logger.Warn("Ingress class conflict detected, syncing proxy is blocked", log.Fields{"lb": key, "err": err})
+		result.Block(lbutil.EventReasonIngressClassConflict, err.Error())
+		result.SetConditions(ingressClassCondition(err))
+		return lbutil.ReportResult(lb, result)
 	}
 
-	// len(dps) == 0 or no deployment's name match desired deployment
-	if !updated {
-		// create deployment
-		log.Info("Create nginx for lb", log.Fields{"d.name": desiredDeploy.Name, "lb.name": lb.Name})
-		_, err = f.client.ExtensionsV1beta1().Deployments(lb.Namespace).Create(desiredDeploy)
+	message, err := f.resolveCertificates(lb)
+	if err != nil {
+		return err
+	}
+	if message == "" {
+		message, err = f.resolveWAF(lb)
 		if err != nil {
 			return err
 		}
 	}
+	if message != "" {
+		// syncing is resumed by the secret and configmap watch once the reference is created
+		logger.Warn("Missing reference of nginx proxy", log.Fields{"lb": key, "message": message})
+		result.Warn(lbutil.EventReasonMissingReference, message)
+		result.SetConditions(lbutil.NewCondition(netv1alpha1.LoadBalancerProxyConfigured, v1.ConditionFalse, lbutil.EventReasonMissingReference, message))
+		return lbutil.ReportResult(lb, result)
+	}
 
-	err = f.ensureConfigMaps(lb)
+	dps, err := f.workloads.ClaimDeployments(lb)
+	if err != nil {
+		return err
+	}
+	dss, err := f.workloads.ClaimDaemonSets(lb)
 	if err != nil {
 		return err
 	}
 
-	// update status
-	return f.syncStatus(lb, activeDeploy)
+	f.observeCanary(result, lb, dps, dss)
+
+	result.Err = f.workloads.Sync(result, lb, dps, dss)
+	if result.Err == nil {
+		result.Err = f.syncGreen(result, lb)
+	}
+	result.SetConditions(ingressClassCondition(nil))
+	return lbutil.ReportResult(lb, result)
 }
 
 func (f *nginx) ensureDeployment(desiredDeploy, oldDeploy *extensions.Deployment) (*extensions.Deployment, bool, error) {
@@ -363,10 +468,39 @@ func (f *nginx) ensureDeployment(desiredDeploy, oldDeploy *extensions.Deployment
 	}
 	// ensure replicas
 	copyDp.Spec.Replicas = desiredDeploy.Spec.Replicas
+	// ensure strategy
+	copyDp.Spec.Strategy = desiredDeploy.Spec.Strategy
+	// ensure pod template
+	containersChanged, nodeAffinityChanged := f.ensurePodTemplate(&desiredDeploy.Spec.Template, &copyDp.Spec.Template, &oldDeploy.Spec.Template)
+
+	// check if changed
+	labelChanged := !reflect.DeepEqual(copyDp.Labels, oldDeploy.Labels)
+	replicasChanged := *(copyDp.Spec.Replicas) != *(oldDeploy.Spec.Replicas)
+	strategyChanged := !reflect.DeepEqual(copyDp.Spec.Strategy, oldDeploy.Spec.Strategy)
+
+	changed := labelChanged || replicasChanged || strategyChanged || nodeAffinityChanged || containersChanged
+	if changed {
+		logger.Info("Abount to correct nginx proxy", log.Fields{
+			"dp.name":             copyDp.Name,
+			"labelChanged":        labelChanged,
+			"replicasChanged":     replicasChanged,
+			"strategyChanged":     strategyChanged,
+			"nodeAffinityChanged": nodeAffinityChanged,
+			"containersChanged":   containersChanged,
+		})
+	}
+	audit.Compare(proxyName, "Deployment", copyDp.Namespace+"/"+copyDp.Name, desiredDeploy.Spec, copyDp.Spec)
+
+	return copyDp, changed, nil
+}
+
+// ensurePodTemplate corrects the containers and placement of the pod template
+// copied from the existing workload, and returns whether they are changed
+func (f *nginx) ensurePodTemplate(desired, copied, old *v1.PodTemplateSpec) (bool, bool) {
 	// ensure containers
 	var containersChanged = false
-	copyContainers := copyDp.Spec.Template.Spec.Containers
-	desiredContainers := desiredDeploy.Spec.Template.Spec.Containers
+	copyContainers := copied.Spec.Containers
+	desiredContainers := desired.Spec.Containers
 	if len(copyContainers) != len(desiredContainers) {
 		containersChanged = true
 	} else {
@@ -375,7 +509,10 @@ func (f *nginx) ensureDeployment(desiredDeploy, oldDeploy *extensions.Deployment
 			for _, c2 := range copyContainers {
 				if c1.Name == c2.Name {
 					found = true
-					if c1.Image != c2.Image {
+					if c1.Image != c2.Image || !apiequality.Semantic.DeepEqual(c1.Resources, c2.Resources) || !reflect.DeepEqual(c1.Lifecycle, c2.Lifecycle) ||
+						!apiequality.Semantic.DeepEqual(c1.Ports, c2.Ports) || !reflect.DeepEqual(c1.Args, c2.Args) ||
+						!apiequality.Semantic.DeepEqual(c1.SecurityContext, c2.SecurityContext) ||
+						!apiequality.Semantic.DeepEqual(c1.VolumeMounts, c2.VolumeMounts) {
 						containersChanged = true
 					}
 					break
@@ -387,54 +524,83 @@ func (f *nginx) ensureDeployment(desiredDeploy, oldDeploy *extensions.Deployment
 		}
 	}
 
-	if containersChanged {
-		copyDp.Spec.Template.Spec.Containers = desiredContainers
+	if copied.Spec.HostNetwork != desired.Spec.HostNetwork || copied.Spec.ServiceAccountName != desired.Spec.ServiceAccountName {
+		containersChanged = true
 	}
 
-	// ensure nodeaffinity
-	copyDp.Spec.Template.Spec.Affinity.NodeAffinity = desiredDeploy.Spec.Template.Spec.Affinity.NodeAffinity
+	// pods are relabeled when blue/green deployment is toggled
+	if copied.Labels[netv1alpha1.LabelKeyProxyColor] != desired.Labels[netv1alpha1.LabelKeyProxyColor] {
+		containersChanged = true
+	}
 
-	// check if changed
-	nodeAffinityChanged := !reflect.DeepEqual(copyDp.Spec.Template.Spec.Affinity.NodeAffinity, oldDeploy.Spec.Template.Spec.Affinity.NodeAffinity)
-	labelChanged := !reflect.DeepEqual(copyDp.Labels, oldDeploy.Labels)
-	replicasChanged := *(copyDp.Spec.Replicas) != *(oldDeploy.Spec.Replicas)
+	// the certificates and waf rules are reloaded by rolling pods
+	if !apiequality.Semantic.DeepEqual(copied.Spec.Volumes, desired.Spec.Volumes) ||
+		copied.Annotations[netv1alpha1.AnnotationKeyTLSChecksum] != desired.Annotations[netv1alpha1.AnnotationKeyTLSChecksum] ||
+		copied.Annotations[netv1alpha1.AnnotationKeyWAFChecksum] != desired.Annotations[netv1alpha1.AnnotationKeyWAFChecksum] {
+		containersChanged = true
+	}
 
-	changed := labelChanged || replicasChanged || nodeAffinityChanged || containersChanged
-	if changed {
-		log.Info("Abount to correct nginx proxy", log.Fields{
-			"dp.name":             copyDp.Name,
-			"labelChanged":        labelChanged,
-			"replicasChanged":     replicasChanged,
-			"nodeAffinityChanged": nodeAffinityChanged,
-			"containersChanged":   containersChanged,
-		})
+	if containersChanged {
+		copied.Spec.Containers = desiredContainers
+		copied.Spec.HostNetwork = desired.Spec.HostNetwork
+		copied.Spec.ServiceAccountName = desired.Spec.ServiceAccountName
+		copied.Spec.DeprecatedServiceAccount = desired.Spec.ServiceAccountName
+		copied.Spec.Volumes = desired.Spec.Volumes
+		for _, key := range []string{netv1alpha1.AnnotationKeyTLSChecksum, netv1alpha1.AnnotationKeyWAFChecksum} {
+			if checksum, ok := desired.Annotations[key]; ok {
+				if copied.Annotations == nil {
+					copied.Annotations = make(map[string]string)
+				}
+				copied.Annotations[key] = checksum
+			} else {
+				delete(copied.Annotations, key)
+			}
+		}
+		// relabel pods along with the rollout, the selector is not changed
+		for k, v := range desired.Labels {
+			copied.Labels[k] = v
+		}
+		if _, ok := desired.Labels[netv1alpha1.LabelKeyProxyColor]; !ok {
+			delete(copied.Labels, netv1alpha1.LabelKeyProxyColor)
+		}
 	}
 
-	return copyDp, changed, nil
+	// ensure nodeaffinity
+	copied.Spec.Affinity.NodeAffinity = desired.Spec.Affinity.NodeAffinity
+	nodeAffinityChanged := !reflect.DeepEqual(copied.Spec.Affinity.NodeAffinity, old.Spec.Affinity.NodeAffinity)
+
+	// ensure grace period of shutdown
+	copied.Spec.TerminationGracePeriodSeconds = desired.Spec.TerminationGracePeriodSeconds
+	gracePeriodChanged := !reflect.DeepEqual(copied.Spec.TerminationGracePeriodSeconds, old.Spec.TerminationGracePeriodSeconds)
+
+	// ensure placement in lb template
+	copied.Spec.Affinity.PodAffinity = desired.Spec.Affinity.PodAffinity
+	copied.Spec.Affinity.PodAntiAffinity = desired.Spec.Affinity.PodAntiAffinity
+	copied.Spec.NodeSelector = desired.Spec.NodeSelector
+	copied.Spec.Tolerations = desired.Spec.Tolerations
+	placementChanged := !reflect.DeepEqual(copied.Spec.Affinity.PodAffinity, old.Spec.Affinity.PodAffinity) ||
+		!reflect.DeepEqual(copied.Spec.Affinity.PodAntiAffinity, old.Spec.Affinity.PodAntiAffinity) ||
+		!reflect.DeepEqual(copied.Spec.NodeSelector, old.Spec.NodeSelector) ||
+		!reflect.DeepEqual(copied.Spec.Tolerations, old.Spec.Tolerations)
+
+	// ensure priority
+	priorityChanged := lbutil.EnsurePodPriority(desired, copied)
+
+	return containersChanged || gracePeriodChanged, nodeAffinityChanged || placementChanged || priorityChanged
 }
 
 // cleanup deployment and other resource controlled by lb proxy
 func (f *nginx) cleanup(lb *netv1alpha1.LoadBalancer) error {
 
 	selector := f.selector(lb)
+	f.rollout.Forget(lb)
 
-	ds, err := f.getDeploymentsForLoadBalancer(lb)
+	err := f.workloads.Cleanup(lb)
 	if err != nil {
 		return err
 	}
-
-	policy := metav1.DeletePropagationForeground
-	gracePeriodSeconds := int64(30)
-
-	for _, d := range ds {
-		err = f.client.ExtensionsV1beta1().Deployments(d.Namespace).Delete(d.Name, &metav1.DeleteOptions{
-			GracePeriodSeconds: &gracePeriodSeconds,
-			PropagationPolicy:  &policy,
-		})
-		if err != nil {
-			log.Warn("Cleanup proxy error", log.Fields{"ns": d.Namespace, "d.name": d.Name, "err": err})
-			return err
-		}
+	if err = f.greenWorkloads.Cleanup(lb); err != nil {
+		return err
 	}
 
 	// clean up config map
@@ -442,7 +608,22 @@ func (f *nginx) cleanup(lb *netv1alpha1.LoadBalancer) error {
 		LabelSelector: selector.String(),
 	})
 	if err != nil {
-		log.Warn("Cleanup ConfigMap error", log.Fields{"err": err})
+		logger.Warn("Cleanup ConfigMap error", log.Fields{"err": err})
+		return err
+	}
+
+	if err = lbutil.DeleteNetworkPolicy(f.client, lb.Namespace, fmt.Sprintf(networkPolicyName, lb.Name)); err != nil {
+		logger.Warn("Cleanup NetworkPolicy error", log.Fields{"err": err})
+		return err
+	}
+
+	if err = lbutil.DeletePodMonitor(f.client, lb.Namespace, fmt.Sprintf(podMonitorName, lb.Name)); err != nil {
+		logger.Warn("Cleanup PodMonitor error", log.Fields{"err": err})
+		return err
+	}
+
+	if err = f.deleteServiceAccount(lb); err != nil {
+		logger.Warn("Cleanup ServiceAccount error", log.Fields{"err": err})
 		return err
 	}
 
@@ -451,53 +632,78 @@ func (f *nginx) cleanup(lb *netv1alpha1.LoadBalancer) error {
 		// createdby ingressClass
 		netv1alpha1.LabelKeyCreatedBy: fmt.Sprintf(netv1alpha1.LabelValueFormatCreateby, lb.Namespace, lb.Name),
 	}
-	ingresses, err := f.client.ExtensionsV1beta1().Ingresses(metav1.NamespaceAll).List(metav1.ListOptions{
-		LabelSelector: selector.String(),
-	})
+	if err = f.deleteIngresses(selector.String()); err != nil {
+		logger.Warn("Cleanup Ingress error", log.Fields{"err": err})
+		return err
+	}
+
+	f.recorder.Event(lb, v1.EventTypeNormal, lbutil.EventReasonCleanedUp, "Clean up nginx proxy")
+	return nil
+}
 
+// finalize cleans up nginx proxy and removes the finalizer from lb after
+// all deployments have gone
+func (f *nginx) finalize(lb *netv1alpha1.LoadBalancer) error {
+	if !lbutil.HasFinalizer(lb, finalizer) {
+		// not managed by nginx proxy
+		return nil
+	}
+
+	if err := f.cleanup(lb); err != nil {
+		return err
+	}
+
+	// deployments and daemonsets are deleted in foreground, wait until they disappear
+	dps, err := f.dLister.Deployments(lb.Namespace).List(f.selector(lb).AsSelector())
+	if err != nil {
+		return err
+	}
+	if len(dps) != 0 {
+		return fmt.Errorf("waiting for %d nginx deployments of %v/%v to be deleted", len(dps), lb.Namespace, lb.Name)
+	}
+	dss, err := f.dsLister.DaemonSets(lb.Namespace).List(f.selector(lb).AsSelector())
 	if err != nil {
-		log.Warn("Cleanup Ingress error", log.Fields{"err": err})
 		return err
 	}
+	if len(dss) != 0 {
+		return fmt.Errorf("waiting for %d nginx daemonsets of %v/%v to be deleted", len(dss), lb.Namespace, lb.Name)
+	}
 
-	for _, ingress := range ingresses.Items {
-		err = f.client.ExtensionsV1beta1().Ingresses(ingress.Namespace).Delete(ingress.Name, &metav1.DeleteOptions{})
+	if lb.DeletionTimestamp == nil {
+		// proxy has been changed, the conditions are no longer reported by nginx
+		err = lbutil.RemoveConditions(
+			f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
+			lb,
+			netv1alpha1.LoadBalancerProxyConfigured,
+			netv1alpha1.LoadBalancerProxyAvailable,
+			netv1alpha1.LoadBalancerIngressClassConflict,
+		)
 		if err != nil {
-			log.Warn("Cleanup Ingress error", log.Fields{"err": err})
 			return err
 		}
 	}
 
-	return nil
+	return lbutil.RemoveFinalizer(f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace), lb, finalizer)
 }
 
+// GenerateDeployment generates the deployment of proxy, which runs on the
+// nodes of blue proxy in blue/green deployment
 func (f *nginx) GenerateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.Deployment {
-	terminationGracePeriodSeconds := int64(30)
-	hostNetwork := false
-	replicas, needNodeAffinity := lbutil.CalculateReplicas(lb)
-
-	if lb.Spec.Type == netv1alpha1.LoadBalancerTypeExternal {
-		hostNetwork = true
+	deploy := f.generateDeployment(lb)
+	if lb.Spec.Proxy.BlueGreen != nil {
+		placeColor(lb, deploy, netv1alpha1.ProxyColorBlue)
 	}
+	return deploy
+}
 
-	labels := f.selector(lb)
+func (f *nginx) generateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.Deployment {
+	terminationGracePeriodSeconds := f.terminationGracePeriodSeconds()
+	hostNetwork := lbutil.ProxyHostNetwork(lb)
+	// external proxy in pod network is still reached on the node by host ports
+	hostPort := hostNetwork || lb.Spec.Type == netv1alpha1.LoadBalancerTypeExternal
+	replicas, needNodeAffinity := lbutil.CalculateReplicas(lb)
 
-	// run on this node
-	nodeAffinity := &v1.NodeAffinity{
-		RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
-			NodeSelectorTerms: []v1.NodeSelectorTerm{
-				{
-					MatchExpressions: []v1.NodeSelectorRequirement{
-						{
-							Key:      fmt.Sprintf(netv1alpha1.UniqueLabelKeyFormat, lb.Namespace, lb.Name),
-							Operator: v1.NodeSelectorOpIn,
-							Values:   []string{"true"},
-						},
-					},
-				},
-			},
-		},
-	}
+	labels := lbutil.WithArtifactLabels(f.selector(lb), lb, "proxy-"+proxyName)
 
 	// do not run with this pod
 	podAffinity := &v1.PodAntiAffinity{
@@ -517,7 +723,7 @@ func (f *nginx) GenerateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.Dep
 
 	deploy := &extensions.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   lb.Name + proxyNameSuffix + "-" + lbutil.RandStringBytesRmndr(5),
+			Name:   lbutil.WorkloadName(lb, "proxy-"+proxyName),
 			Labels: labels,
 
 			OwnerReferences: []metav1.OwnerReference{
@@ -533,6 +739,10 @@ func (f *nginx) GenerateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.Dep
 		},
 		Spec: extensions.DeploymentSpec{
 			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: f.selector(lb),
+			},
+			Strategy: lbutil.DeploymentStrategy(lb),
 			Template: v1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
@@ -542,32 +752,26 @@ func (f *nginx) GenerateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.Dep
 					},
 				},
 				Spec: v1.PodSpec{
+					ServiceAccountName: f.serviceAccountName(lb),
 					// host network ?
 					HostNetwork: hostNetwork,
-					// TODO
+					// wait for long-lived connections
 					TerminationGracePeriodSeconds: &terminationGracePeriodSeconds,
 					Affinity: &v1.Affinity{
 						// don't co-locate pods of this deployment in same node
 						PodAntiAffinity: podAffinity,
 					},
-					Tolerations: toleration.GenerateTolerations(),
+					NodeSelector: lbutil.NodeSelector(lb),
+					Tolerations:  lbutil.Tolerations(lb),
 					Containers: []v1.Container{
 						{
 							Name:            "ingress-nginx-controller",
-							Image:           f.image,
+							Image:           f.proxyImage(lb),
 							ImagePullPolicy: v1.PullAlways,
 							Resources:       lb.Spec.Proxy.Resources,
-							Ports: []v1.ContainerPort{
-								{
-									ContainerPort: 80,
-								},
-								{
-									ContainerPort: 443,
-								},
-								{
-									ContainerPort: ingressControllerPort,
-								},
-							},
+							Lifecycle:       f.lifecycle(),
+							SecurityContext: f.securityContext(lb),
+							Ports:           f.containerPorts(lb, hostPort),
 							Env: []v1.EnvVar{
 								{
 									Name: "POD_NAME",
@@ -590,8 +794,8 @@ func (f *nginx) GenerateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.Dep
 							Args: []string{
 								"/nginx-ingress-controller",
 								"--default-backend-service=" + fmt.Sprintf("%s/%s", defaultHTTPBackendNamespace, defaultHTTPBackendName),
-								"--ingress-class=" + fmt.Sprintf(netv1alpha1.LabelValueFormatCreateby, lb.Namespace, lb.Name),
-								"--configmap=" + fmt.Sprintf("%s/"+configMapName, lb.Namespace, lb.Name),
+								"--ingress-class=" + lbutil.IngressClass(lb),
+								configMapArgPrefix + fmt.Sprintf("%s/"+configMapName, lb.Namespace, lb.Name),
 								"--tcp-services-configmap=" + fmt.Sprintf("%s/"+tcpConfigMapName, lb.Namespace, lb.Name),
 								"--udp-services-configmap=" + fmt.Sprintf("%s/"+udpConfigMapName, lb.Namespace, lb.Name),
 								"--healthz-port=" + strconv.Itoa(ingressControllerPort),
@@ -626,10 +830,8 @@ func (f *nginx) GenerateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.Dep
 									v1.ResourceMemory: resource.MustParse("50Mi"),
 								},
 							},
-							SecurityContext: &v1.SecurityContext{
-								// ingress controller sidecar need provileged to change sysctl settings
-								Privileged: &t,
-							},
+							// ingress controller sidecar changes sysctl settings of pod
+							SecurityContext: f.sidecarSecurityContext(),
 							Env: []v1.EnvVar{
 								{
 									Name: "POD_NAME",
@@ -665,30 +867,110 @@ func (f *nginx) GenerateDeployment(lb *netv1alpha1.LoadBalancer) *extensions.Dep
 
 	if needNodeAffinity {
 		// decide running on which node
-		deploy.Spec.Template.Spec.Affinity.NodeAffinity = nodeAffinity
+		deploy.Spec.Template.Spec.Affinity.NodeAffinity = f.nodeAffinity(lb)
 	}
+	deploy.Spec.Template.Spec.Affinity = lbutil.MergeAffinity(lb, deploy.Spec.Template.Spec.Affinity)
 
-	if f.defaultSSLCertificate != "" {
+	deploy.Spec.Template.Spec.Containers[0].Args = append(deploy.Spec.Template.Spec.Containers[0].Args, f.ingressArgs()...)
+
+	// the default certificate is watched and reloaded by nginx ingress controller
+	if certificate := f.defaultCertificate(lb); certificate != "" {
 		deploy.Spec.Template.Spec.Containers[0].Args = append(
 			deploy.Spec.Template.Spec.Containers[0].Args,
-			"--default-ssl-certificate="+f.defaultSSLCertificate,
+			"--default-ssl-certificate="+certificate,
 		)
 	}
 
+	volumes, mounts := tlsVolumes(lb)
+	wafVolumes, wafMounts := wafVolumes(lb)
+	deploy.Spec.Template.Spec.Volumes = append(volumes, wafVolumes...)
+	deploy.Spec.Template.Spec.Containers[0].VolumeMounts = append(mounts, wafMounts...)
+	if checksum := f.tlsChecksum(lb); checksum != "" {
+		deploy.Spec.Template.Annotations[netv1alpha1.AnnotationKeyTLSChecksum] = checksum
+	}
+	if checksum := f.wafChecksum(lb); checksum != "" {
+		deploy.Spec.Template.Annotations[netv1alpha1.AnnotationKeyWAFChecksum] = checksum
+	}
+	lbutil.SetPodPriority(lb, &deploy.Spec.Template)
+
 	return deploy
 }
 
+// proxyImage returns the nginx image of lb, which can be overridden in spec,
+// then the image built with ModSecurity is used if WAF is enabled, otherwise
+// it is picked by the rollout of canary image
+func (f *nginx) proxyImage(lb *netv1alpha1.LoadBalancer) string {
+	if lb.Spec.Proxy.Image != "" {
+		return lb.Spec.Proxy.Image
+	}
+	if lb.Spec.Proxy.WAF != nil && f.wafImage != "" {
+		return f.wafImage
+	}
+	return f.rollout.Image(lb)
+}
+
+// containerPorts declares http, https, healthz and the ports of tcp and udp rules,
+// protocol and host port are set explicitly to be compared with the ones
+// defaulted by apiserver
+func (f *nginx) containerPorts(lb *netv1alpha1.LoadBalancer, hostPort bool) []v1.ContainerPort {
+	ports := []v1.ContainerPort{
+		{
+			ContainerPort: 80,
+			Protocol:      v1.ProtocolTCP,
+		},
+		{
+			ContainerPort: 443,
+			Protocol:      v1.ProtocolTCP,
+		},
+		{
+			ContainerPort: ingressControllerPort,
+			Protocol:      v1.ProtocolTCP,
+		},
+	}
+	for _, rule := range lb.Spec.TCPRules {
+		ports = append(ports, v1.ContainerPort{ContainerPort: rule.Port, Protocol: v1.ProtocolTCP})
+	}
+	for _, rule := range lb.Spec.UDPRules {
+		ports = append(ports, v1.ContainerPort{ContainerPort: rule.Port, Protocol: v1.ProtocolUDP})
+	}
+	if hostPort {
+		for i := range ports {
+			ports[i].HostPort = ports[i].ContainerPort
+		}
+	}
+	return ports
+}
+
+// nodeAffinity runs pods on the nodes labeled for lb
+func (f *nginx) nodeAffinity(lb *netv1alpha1.LoadBalancer) *v1.NodeAffinity {
+	return &v1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{
+				{
+					MatchExpressions: []v1.NodeSelectorRequirement{
+						{
+							Key:      fmt.Sprintf(netv1alpha1.UniqueLabelKeyFormat, lb.Namespace, lb.Name),
+							Operator: v1.NodeSelectorOpIn,
+							Values:   []string{"true"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
 func (f *nginx) clone(lb *netv1alpha1.LoadBalancer) (*netv1alpha1.LoadBalancer, error) {
 	lbi, err := scheme.Scheme.DeepCopy(lb)
 	if err != nil {
-		log.Error("Unable to deepcopy loadbalancer", log.Fields{"lb.name": lb.Name, "err": err})
+		logger.Error("Unable to deepcopy loadbalancer", log.Fields{"lb.name": lb.Name, "err": err})
 		return nil, err
 	}
 
 	nlb, ok := lbi.(*netv1alpha1.LoadBalancer)
 	if !ok {
 		nerr := fmt.Errorf("expected loadbalancer, got %#v", lbi)
-		log.Error(nerr)
+		logger.Error("Unexpected type of copied loadbalancer", log.Fields{"lb.name": lb.Name, "err": nerr})
 		return nil, err
 	}
 	return nlb, nil
@@ -0,0 +1,191 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"fmt"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// plan computes the changes the sync would make to the resources of lb and
+// reports them instead of writing. The workloads are not claimed, only the
+// ones labeled for lb in cache are compared, lb must be a copy
+func (f *nginx) plan(lb *netv1alpha1.LoadBalancer, deleted bool) error {
+	plan := lbutil.NewPlan(proxyName, lb)
+
+	selector := f.selector(lb).AsSelector()
+	dps, err := f.dLister.Deployments(lb.Namespace).List(selector)
+	if err != nil {
+		return err
+	}
+	dss, err := f.dsLister.DaemonSets(lb.Namespace).List(selector)
+	if err != nil {
+		return err
+	}
+
+	if deleted || lb.DeletionTimestamp != nil || lb.Spec.Proxy.Type != netv1alpha1.ProxyTypeNginx {
+		if !deleted && !lbutil.HasFinalizer(lb, finalizer) {
+			// not managed by nginx proxy
+			return nil
+		}
+		for _, dp := range dps {
+			plan.Delete("Deployment", dp.Name)
+		}
+		for _, ds := range dss {
+			plan.Delete("DaemonSet", ds.Name)
+		}
+		cms, err := f.client.CoreV1().ConfigMaps(lb.Namespace).List(metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return err
+		}
+		for _, cm := range cms.Items {
+			plan.Delete("ConfigMap", cm.Name)
+		}
+		plan.Report(f.recorder)
+		return nil
+	}
+
+	if err := f.ingressClassConflict(lb); err != nil {
+		// proxy is not synced until the conflict is resolved
+		plan.Update("LoadBalancer", lb.Name, []string{"status.conditions"})
+		plan.Report(f.recorder)
+		return nil
+	}
+
+	message, err := f.resolveCertificates(lb)
+	if err != nil {
+		return err
+	}
+	if message == "" {
+		message, err = f.resolveWAF(lb)
+		if err != nil {
+			return err
+		}
+	}
+	if message != "" {
+		plan.Update("LoadBalancer", lb.Name, []string{"status.conditions"})
+		plan.Report(f.recorder)
+		return nil
+	}
+
+	if lbutil.IsDaemonSetMode(lb) {
+		f.planDaemonSets(plan, lb, dps, dss)
+	} else {
+		blue := make([]*extensions.Deployment, 0, len(dps))
+		for _, dp := range dps {
+			if !isGreen(dp) {
+				blue = append(blue, dp)
+			}
+		}
+		f.planDeployments(plan, lb, blue, dss)
+		if err := f.planGreen(plan, lb, dps); err != nil {
+			return err
+		}
+	}
+
+	if err := plan.ConfigMap(f.client, lb.Namespace, fmt.Sprintf(configMapName, lb.Name), f.proxyConfig(lb)); err != nil {
+		return err
+	}
+	services := map[string]map[string]string{
+		fmt.Sprintf(tcpConfigMapName, lb.Name): l4Services(lb, lb.Spec.TCPRules),
+		fmt.Sprintf(udpConfigMapName, lb.Name): l4Services(lb, lb.Spec.UDPRules),
+	}
+	for name, data := range services {
+		if err := f.planServicesConfigMap(plan, lb.Namespace, name, data); err != nil {
+			return err
+		}
+	}
+
+	plan.Report(f.recorder)
+	return nil
+}
+
+// planDeployments plans the changes of sync to the deployments of lb
+func (f *nginx) planDeployments(plan *lbutil.Plan, lb *netv1alpha1.LoadBalancer, dps []*extensions.Deployment, dss []*extensions.DaemonSet) {
+	for _, ds := range dss {
+		plan.Delete("DaemonSet", ds.Name)
+	}
+
+	desiredDeploy := f.GenerateDeployment(lb)
+	updated := false
+	for _, dp := range dps {
+		// the pods of legacy deployments are handed over to the one named
+		// by lbutil.WorkloadName
+		if dp.Name != desiredDeploy.Name || updated {
+			if *dp.Spec.Replicas != 0 {
+				plan.Update("Deployment", dp.Name, []string{"spec.replicas"})
+			}
+			continue
+		}
+		updated = true
+		copyDp, changed, err := f.ensureDeployment(desiredDeploy, dp)
+		if err == nil && changed {
+			plan.Diff("Deployment", dp.Name, copyDp, dp)
+		}
+	}
+	if !updated {
+		plan.Create("Deployment", desiredDeploy.Name)
+	}
+}
+
+// planDaemonSets plans the changes of sync to the daemonsets of lb
+func (f *nginx) planDaemonSets(plan *lbutil.Plan, lb *netv1alpha1.LoadBalancer, dps []*extensions.Deployment, dss []*extensions.DaemonSet) {
+	for _, dp := range dps {
+		plan.Delete("Deployment", dp.Name)
+	}
+
+	desiredDs := f.generateDaemonSet(lb)
+	updated := false
+	for _, ds := range dss {
+		if !strings.HasPrefix(ds.Name, lb.Name+proxyNameSuffix) || updated {
+			plan.Delete("DaemonSet", ds.Name)
+			continue
+		}
+		updated = true
+		copyDs, changed, err := f.ensureDaemonSet(desiredDs, ds)
+		if err == nil && changed {
+			plan.Diff("DaemonSet", ds.Name, copyDs, ds)
+		}
+	}
+	if !updated {
+		plan.Create("DaemonSet", desiredDs.Name)
+	}
+}
+
+// planServicesConfigMap plans the changes of the ports managed by controller
+// in tcp or udp services ConfigMap
+func (f *nginx) planServicesConfigMap(plan *lbutil.Plan, namespace, name string, services map[string]string) error {
+	cm, err := f.client.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		plan.Create("ConfigMap", name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, _, changed := servicesData(cm, services); changed {
+		plan.Update("ConfigMap", name, []string{"data"})
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"fmt"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// podMonitorName is the name of PodMonitor of proxy pods
+const podMonitorName = "%s-proxy-nginx"
+
+// ensurePodMonitor scrapes the metrics of ingress controller on the health
+// port of proxy pods of both colors, nothing is generated if it is disabled
+func (f *nginx) ensurePodMonitor(result *lbutil.Result, lb *netv1alpha1.LoadBalancer) error {
+	if !f.monitoring.PodMonitors {
+		return nil
+	}
+
+	name := fmt.Sprintf(podMonitorName, lb.Name)
+	meta := lbutil.MonitorMeta(lb, name, f.selector(lb), "proxy-"+proxyName, f.monitoring.PodMonitorLabelSet())
+	port := intstr.FromInt(ingressControllerPort)
+	endpoints := []lbutil.PodMetricsEndpoint{
+		{TargetPort: &port, Path: "/metrics"},
+	}
+
+	action, err := lbutil.EnsurePodMonitor(f.client, meta, f.selector(lb), endpoints)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case lbutil.ActionCreated:
+		result.Created("PodMonitor", name)
+	case lbutil.ActionUpdated:
+		result.Updated("PodMonitor", name)
+	}
+	return nil
+}
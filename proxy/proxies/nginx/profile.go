@@ -0,0 +1,62 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+)
+
+// profiles are the bundles of nginx settings for common classes of workloads,
+// the sizes are in nginx format and the timeouts are in seconds
+var profiles = map[netv1alpha1.ProxyProfile]map[string]string{
+	netv1alpha1.ProxyProfileSmall: {
+		"proxy-body-size":         "1m",
+		"client-body-buffer-size": "8k",
+		"proxy-buffer-size":       "4k",
+		"proxy-connect-timeout":   "5",
+		"proxy-read-timeout":      "30",
+		"proxy-send-timeout":      "30",
+		"keep-alive":              "30",
+	},
+	netv1alpha1.ProxyProfileStandard: {
+		"proxy-body-size":         "10m",
+		"client-body-buffer-size": "16k",
+		"proxy-buffer-size":       "8k",
+		"proxy-connect-timeout":   "5",
+		"proxy-read-timeout":      "60",
+		"proxy-send-timeout":      "60",
+		"keep-alive":              "75",
+	},
+	netv1alpha1.ProxyProfileLargeUploads: {
+		"proxy-body-size":         "1g",
+		"client-body-buffer-size": "1m",
+		"proxy-buffer-size":       "16k",
+		"proxy-connect-timeout":   "10",
+		"proxy-read-timeout":      "600",
+		"proxy-send-timeout":      "600",
+		"keep-alive":              "75",
+	},
+	netv1alpha1.ProxyProfileWebsockets: {
+		"proxy-body-size":         "10m",
+		"client-body-buffer-size": "16k",
+		"proxy-buffer-size":       "8k",
+		"proxy-connect-timeout":   "10",
+		"proxy-read-timeout":      "3600",
+		"proxy-send-timeout":      "3600",
+		"keep-alive":              "75",
+	},
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	rbac "k8s.io/client-go/pkg/apis/rbac/v1beta1"
+)
+
+// proxyRules are the permissions of proxy pods in the namespace of lb, the
+// ingress controller maintains its ConfigMaps and elects leader with them,
+// the sidecar watches lb. The ingresses, services and endpoints in cluster
+// are watched with the ClusterRole bound by controller
+var proxyRules = []rbac.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"configmaps"},
+		Verbs:     []string{"get", "list", "watch", "create", "update"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"pods"},
+		Verbs:     []string{"get"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"events"},
+		Verbs:     []string{"create", "patch"},
+	},
+	{
+		APIGroups: []string{netv1alpha1.AlphaGroupName},
+		Resources: []string{netv1alpha1.LoadBalancerPlural},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+}
+
+// serviceAccountName returns the ServiceAccount of proxy pods
+func (f *nginx) serviceAccountName(lb *netv1alpha1.LoadBalancer) string {
+	return lbutil.ServiceAccountName(lb, "proxy-"+proxyName, f.security.ServiceAccounts)
+}
+
+// ensureServiceAccount ensures the ServiceAccount of proxy pods with its Role
+// and the binding to the ClusterRole of proxies, nothing is generated if it
+// is disabled
+func (f *nginx) ensureServiceAccount(result *lbutil.Result, lb *netv1alpha1.LoadBalancer) error {
+	if !f.security.ServiceAccounts {
+		return nil
+	}
+
+	name := f.serviceAccountName(lb)
+	labels := lbutil.WithArtifactLabels(f.selector(lb), lb, "proxy-"+proxyName)
+	action, err := lbutil.EnsureServiceAccount(f.client, lb, name, labels, proxyRules)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case lbutil.ActionCreated:
+		result.Created("ServiceAccount", name)
+	case lbutil.ActionUpdated:
+		result.Updated("ServiceAccount", name)
+	}
+
+	if f.security.ProxyClusterRole == "" {
+		return nil
+	}
+	bindingName := lbutil.ClusterRoleBindingName(lb, "proxy-"+proxyName)
+	action, err = lbutil.EnsureClusterRoleBinding(f.client, lb, bindingName, f.security.ProxyClusterRole, name, labels)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case lbutil.ActionCreated:
+		result.Created("ClusterRoleBinding", bindingName)
+	case lbutil.ActionUpdated:
+		result.Updated("ClusterRoleBinding", bindingName)
+	}
+	return nil
+}
+
+// deleteServiceAccount deletes the ServiceAccount of proxy pods and the
+// ClusterRoleBinding, which is not garbage collected along with lb
+func (f *nginx) deleteServiceAccount(lb *netv1alpha1.LoadBalancer) error {
+	if !f.security.ServiceAccounts {
+		return nil
+	}
+	if err := lbutil.DeleteClusterRoleBinding(f.client, lbutil.ClusterRoleBindingName(lb, "proxy-"+proxyName)); err != nil {
+		return err
+	}
+	return lbutil.DeleteServiceAccount(f.client, lb.Namespace, f.serviceAccountName(lb))
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/plugin"
+	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
+
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+var _ plugin.Renderer = renderer{}
+
+// renderer renders the objects of nginx proxy for the workload reconciler
+type renderer struct {
+	*nginx
+}
+
+func (r renderer) Deployment(lb *netv1alpha1.LoadBalancer) *extensions.Deployment {
+	return r.GenerateDeployment(lb)
+}
+
+func (r renderer) DaemonSet(lb *netv1alpha1.LoadBalancer) *extensions.DaemonSet {
+	return r.generateDaemonSet(lb)
+}
+
+func (r renderer) EnsureDeployment(desired, old *extensions.Deployment) (*extensions.Deployment, bool, error) {
+	return r.ensureDeployment(desired, old)
+}
+
+func (r renderer) EnsureDaemonSet(desired, old *extensions.DaemonSet) (*extensions.DaemonSet, bool, error) {
+	return r.ensureDaemonSet(desired, old)
+}
+
+// EnsureDependencies ensures the ConfigMaps read by proxy pods, the
+// ServiceAccount they run as, the NetworkPolicy restricting them and the
+// PodMonitor scraping them
+func (r renderer) EnsureDependencies(result *lbutil.Result, lb *netv1alpha1.LoadBalancer) error {
+	if err := r.ensureConfigMaps(lb); err != nil {
+		return err
+	}
+	if err := r.ensureServiceAccount(result, lb); err != nil {
+		return err
+	}
+	if err := r.ensureNetworkPolicy(result, lb); err != nil {
+		return err
+	}
+	return r.ensurePodMonitor(result, lb)
+}
+
+func (r renderer) SyncStatus(lb *netv1alpha1.LoadBalancer, workload plugin.Workload) error {
+	return r.syncStatus(lb, workload.Replicas, workload.Deployment, workload.DaemonSet)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// securityContext returns the security context of nginx container, it runs as
+// root if lb does not require non-root. The sidecar tuning sysctls of the pod
+// has its own security context
+func (f *nginx) securityContext(lb *netv1alpha1.LoadBalancer) *v1.SecurityContext {
+	sc := lb.Spec.Proxy.SecurityContext
+	if sc == nil || !sc.RunAsNonRoot {
+		return nil
+	}
+
+	nonRoot := true
+	uid := netv1alpha1.DefaultProxyUser
+	if sc.RunAsUser != nil {
+		uid = *sc.RunAsUser
+	}
+	context := &v1.SecurityContext{
+		RunAsNonRoot: &nonRoot,
+		RunAsUser:    &uid,
+	}
+	if sc.NetBindService == nil || *sc.NetBindService {
+		context.Capabilities = &v1.Capabilities{
+			Add:  []v1.Capability{"NET_BIND_SERVICE"},
+			Drop: []v1.Capability{"ALL"},
+		}
+	}
+	return context
+}
+
+// sidecarSecurityContext returns the security context of sidecar, which
+// tunes the sysctls of pod. It runs privileged unless pods are unprivileged,
+// then it only has the capabilities to tune the network namespace of pod
+func (f *nginx) sidecarSecurityContext() *v1.SecurityContext {
+	if !f.security.Unprivileged {
+		t := true
+		return &v1.SecurityContext{
+			Privileged: &t,
+		}
+	}
+	return &v1.SecurityContext{
+		Capabilities: &v1.Capabilities{
+			Add: []v1.Capability{"NET_ADMIN", "NET_RAW"},
+		},
+	}
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// preStopDelay is the seconds a stopping proxy keeps serving before nginx
+	// quits, so that providers stop sending new connections to it
+	preStopDelay = 5
+	// shutdownGracePeriod is the extra seconds for nginx to exit after workers shut down
+	shutdownGracePeriod = 10
+)
+
+// shutdownConfig returns the nginx config of graceful shutdown, nginx workers
+// keep serving the established connections until the timeout after quit
+func (f *nginx) shutdownConfig() map[string]string {
+	if f.shutdownTimeout <= 0 {
+		return nil
+	}
+	return map[string]string{
+		"worker-shutdown-timeout": fmt.Sprintf("%ds", f.shutdownTimeout),
+	}
+}
+
+// lifecycle returns the hooks of nginx container, the preStop hook delays
+// SIGTERM both when scaling down and when deleting or relocating pods
+func (f *nginx) lifecycle() *v1.Lifecycle {
+	if f.shutdownTimeout <= 0 {
+		return nil
+	}
+	return &v1.Lifecycle{
+		PreStop: &v1.Handler{
+			Exec: &v1.ExecAction{
+				Command: []string{"/bin/sh", "-c", fmt.Sprintf("sleep %d", preStopDelay)},
+			},
+		},
+	}
+}
+
+// terminationGracePeriodSeconds returns the grace period of proxy pods, which
+// must cover the preStop hook and worker shutdown otherwise nginx is killed
+func (f *nginx) terminationGracePeriodSeconds() int64 {
+	if f.shutdownTimeout <= 0 {
+		return 30
+	}
+	return int64(preStopDelay + f.shutdownTimeout + shutdownGracePeriod)
+}
@@ -20,7 +20,7 @@ import (
 	"fmt"
 	"sort"
 
-	log "github.com/zoumo/logdog"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
 
 	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
 	lbutil "github.com/caicloud/loadbalancer-controller/pkg/util/lb"
@@ -28,29 +28,35 @@ import (
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/pkg/api/v1"
-	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
 )
 
-func (f *nginx) syncStatus(lb *netv1alpha1.LoadBalancer, activeDeploy *extensions.Deployment) error {
+// syncStatus syncs the status of proxy pods running in the active
+// deployment or daemonset, replicas is the number of desired pods
+func (f *nginx) syncStatus(lb *netv1alpha1.LoadBalancer, replicas int32, deployment, daemonSet string) error {
 
 	// caculate proxy status
 	proxyStatus := netv1alpha1.ProxyStatus{
 		PodStatuses: netv1alpha1.PodStatuses{
-			Replicas:      *activeDeploy.Spec.Replicas,
+			Replicas:      replicas,
 			ReadyReplicas: 0,
 			TotalReplicas: 0,
 			Statuses:      make([]netv1alpha1.PodStatus, 0),
 		},
-		Deployment:   activeDeploy.Name,
-		IngressClass: fmt.Sprintf(netv1alpha1.LabelValueFormatCreateby, lb.Namespace, lb.Name),
+		Deployment:   deployment,
+		DaemonSet:    daemonSet,
+		IngressClass: lbutil.IngressClass(lb),
 		ConfigMap:    fmt.Sprintf(configMapName, lb.Name),
 		TCPConfigMap: fmt.Sprintf(tcpConfigMapName, lb.Name),
 		UDPConfigMap: fmt.Sprintf(udpConfigMapName, lb.Name),
+		TLS:          f.tlsStatus(lb),
+		// the affinity may be overridden by config in spec
+		SessionAffinity: effectiveAffinity(f.proxyConfig(lb)),
+		WAF:             f.wafStatus(lb),
 	}
 
-	podList, err := f.podLister.List(f.selector(lb).AsSelector())
+	podList, err := f.podLister.List(f.blueSelector(lb))
 	if err != nil {
-		log.Error("get pod list error", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "err": err})
+		logger.Error("get pod list error", log.Fields{"lb.ns": lb.Namespace, "lb.name": lb.Name, "err": err})
 		return err
 	}
 
@@ -66,34 +72,46 @@ func (f *nginx) syncStatus(lb *netv1alpha1.LoadBalancer, activeDeploy *extension
 	}
 
 	sort.Sort(lbutil.SortPodStatusByName(proxyStatus.Statuses))
-
-	// check whether the statuses are equal
-	if !lbutil.ProxyStatusEqual(lb.Status.ProxyStatus, proxyStatus) {
-		// js, _ := json.Marshal(proxyStatus)
-		// replacePatch := fmt.Sprintf(`{"status":{"proxyStatus": %s }}`, string(js))
-		log.Notice("update nginx proxy status", log.Fields{"lb.name": lb.Name, "lb.ns": lb.Namespace})
-		// _, err := f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace).Patch(lb.Name, types.MergePatchType, []byte(replacePatch))
-		_, err := lbutil.UpdateLBWithRetries(
-			f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
-			lb.Namespace,
-			lb.Name,
-			func(lb *netv1alpha1.LoadBalancer) error {
-				lb.Status.ProxyStatus = proxyStatus
-				return nil
-			},
+	proxyStatus.Rollout = lbutil.ComputeRolloutStatus(replicas, podList, f.podUpdatedFunc(lb, daemonSet, podList))
+
+	available := lbutil.NewCondition(netv1alpha1.LoadBalancerProxyAvailable, v1.ConditionTrue, "PodsReady", "")
+	if proxyStatus.ReadyReplicas < proxyStatus.Replicas {
+		available = lbutil.NewCondition(
+			netv1alpha1.LoadBalancerProxyAvailable,
+			v1.ConditionFalse,
+			"PodsNotReady",
+			fmt.Sprintf("%d/%d nginx pods are ready", proxyStatus.ReadyReplicas, proxyStatus.Replicas),
 		)
-
-		if err != nil {
-			log.Error("Update loadbalancer status error", log.Fields{"err": err})
-			return err
-		}
+	}
+	// write proxy section of status
+	err = lbutil.WriteStatus(
+		f.tprclient.NetworkingV1alpha1().LoadBalancers(lb.Namespace),
+		lb,
+		func(status *netv1alpha1.LoadBalancerStatus) bool {
+			// the green proxy is reported by itself
+			proxyStatus.BlueGreen = nil
+			if lb.Spec.Proxy.BlueGreen != nil {
+				proxyStatus.BlueGreen = status.ProxyStatus.BlueGreen
+			}
+			if lbutil.ProxyStatusEqual(status.ProxyStatus, proxyStatus) {
+				return false
+			}
+			logger.Notice("update nginx proxy status", log.Fields{"lb.name": lb.Name, "lb.ns": lb.Namespace})
+			status.ProxyStatus = proxyStatus
+			return true
+		},
+		available,
+	)
+	if err != nil {
+		logger.Error("Update loadbalancer status error", log.Fields{"lb.name": lb.Name, "lb.ns": lb.Namespace, "err": err})
+		return err
 	}
 	return nil
 }
 
 func (f *nginx) evictPod(lb *netv1alpha1.LoadBalancer, pod *v1.Pod) {
 
-	if len(lb.Spec.Nodes.Names) == 0 {
+	if len(lbutil.NodeNames(lb)) == 0 {
 		return
 	}
 	// FIXME: when RequiredDuringSchedulingRequiredDuringExecution finished
@@ -102,7 +120,7 @@ func (f *nginx) evictPod(lb *netv1alpha1.LoadBalancer, pod *v1.Pod) {
 	// According to nodeAffinity RequiredDuringSchedulingIgnoredDuringExecution,
 	// the system may or may not try to eventually evict the pod from its node.
 	// the pod may still running on the wrong node, so we evict it manually
-	if !stringsutil.StringInSlice(pod.Spec.NodeName, lb.Spec.Nodes.Names) &&
+	if !stringsutil.StringInSlice(pod.Spec.NodeName, lbutil.ActiveNodeNames(lb)) &&
 		pod.DeletionTimestamp == nil {
 		f.client.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{})
 	}
@@ -0,0 +1,244 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"path"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// tlsMountPath is the directory in proxy container where the secret of
+	// each certificate is mounted in a sub directory named after it
+	tlsMountPath = "/etc/nginx/tls"
+	// certificateAPI is the API of cert-manager Certificate
+	certificateAPI = "cert-manager.io/v1"
+	// annotationKeyCertificateName is set by cert-manager on the secrets issued
+	// for Certificates
+	annotationKeyCertificateName = "cert-manager.io/certificate-name"
+)
+
+// resolveCertificates fills in the secret names of cert-manager Certificates
+// in the tls of lb, lb must be a copy as its spec is modified. It returns a
+// message if a certificate or secret does not exist
+func (f *nginx) resolveCertificates(lb *netv1alpha1.LoadBalancer) (string, error) {
+	for i := range lb.Spec.Proxy.TLS {
+		cert := &lb.Spec.Proxy.TLS[i]
+		if cert.Certificate != "" {
+			secretName, err := f.certificateSecret(lb.Namespace, cert.Certificate)
+			if errors.IsNotFound(err) {
+				return fmt.Sprintf("certificate %s/%s does not exist", lb.Namespace, cert.Certificate), nil
+			}
+			if err != nil {
+				return "", err
+			}
+			cert.SecretName = secretName
+		}
+
+		_, err := f.secretLister.Secrets(lb.Namespace).Get(cert.SecretName)
+		if errors.IsNotFound(err) {
+			return fmt.Sprintf("tls secret %s/%s does not exist", lb.Namespace, cert.SecretName), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// certificateSecret returns the name of secret issued for the cert-manager
+// Certificate, the vendored client does not know it, only spec is needed
+func (f *nginx) certificateSecret(namespace, name string) (string, error) {
+	raw, err := f.client.CoreV1().RESTClient().Get().
+		AbsPath("/apis", certificateAPI, "namespaces", namespace, "certificates", name).
+		DoRaw()
+	if err != nil {
+		return "", err
+	}
+	certificate := struct {
+		Spec struct {
+			SecretName string `json:"secretName"`
+		} `json:"spec"`
+	}{}
+	if err := json.Unmarshal(raw, &certificate); err != nil {
+		return "", fmt.Errorf("decode certificate %s/%s error: %v", namespace, name, err)
+	}
+	if certificate.Spec.SecretName == "" {
+		return "", fmt.Errorf("certificate %s/%s has no secretName", namespace, name)
+	}
+	return certificate.Spec.SecretName, nil
+}
+
+// defaultCertificate returns the namespace/name of the default certificate of
+// lb, or the one of controller if none is default in spec
+func (f *nginx) defaultCertificate(lb *netv1alpha1.LoadBalancer) string {
+	for _, cert := range lb.Spec.Proxy.TLS {
+		if cert.Default && cert.SecretName != "" {
+			return lb.Namespace + "/" + cert.SecretName
+		}
+	}
+	return f.defaultSSLCertificate
+}
+
+// tlsVolumes returns the volumes and mounts of the certificates of lb
+func tlsVolumes(lb *netv1alpha1.LoadBalancer) ([]v1.Volume, []v1.VolumeMount) {
+	var volumes []v1.Volume
+	var mounts []v1.VolumeMount
+	// set explicitly to be compared with the defaulted one
+	mode := v1.SecretVolumeSourceDefaultMode
+	for _, cert := range lb.Spec.Proxy.TLS {
+		if cert.SecretName == "" {
+			continue
+		}
+		name := "tls-" + cert.SecretName
+		volumes = append(volumes, v1.Volume{
+			Name: name,
+			VolumeSource: v1.VolumeSource{
+				Secret: &v1.SecretVolumeSource{
+					SecretName:  cert.SecretName,
+					DefaultMode: &mode,
+				},
+			},
+		})
+		mounts = append(mounts, v1.VolumeMount{
+			Name:      name,
+			MountPath: path.Join(tlsMountPath, cert.SecretName),
+			ReadOnly:  true,
+		})
+	}
+	return volumes, mounts
+}
+
+// tlsChecksum returns the checksum of certificates of lb, it is empty if lb
+// has no certificate
+func (f *nginx) tlsChecksum(lb *netv1alpha1.LoadBalancer) string {
+	if len(lb.Spec.Proxy.TLS) == 0 {
+		return ""
+	}
+	hash := sha256.New()
+	for _, cert := range lb.Spec.Proxy.TLS {
+		hash.Write([]byte(cert.SecretName))
+		secret, err := f.secretLister.Secrets(lb.Namespace).Get(cert.SecretName)
+		if err != nil {
+			continue
+		}
+		hash.Write(secret.Data[v1.TLSCertKey])
+		hash.Write(secret.Data[v1.TLSPrivateKeyKey])
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// tlsStatus reports the certificates of lb with their expiry
+func (f *nginx) tlsStatus(lb *netv1alpha1.LoadBalancer) []netv1alpha1.ProxyTLSStatus {
+	if len(lb.Spec.Proxy.TLS) == 0 {
+		return nil
+	}
+	statuses := make([]netv1alpha1.ProxyTLSStatus, 0, len(lb.Spec.Proxy.TLS))
+	for _, cert := range lb.Spec.Proxy.TLS {
+		status := netv1alpha1.ProxyTLSStatus{
+			SecretName:  cert.SecretName,
+			Certificate: cert.Certificate,
+		}
+		x509Cert, err := f.parseCertificate(lb.Namespace, cert.SecretName)
+		if err != nil {
+			status.Message = err.Error()
+		} else {
+			// the time decoded from status is local
+			notAfter := metav1.NewTime(x509Cert.NotAfter.Local())
+			status.NotAfter = &notAfter
+			status.DNSNames = x509Cert.DNSNames
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// parseCertificate parses the leaf certificate in the tls secret
+func (f *nginx) parseCertificate(namespace, name string) (*x509.Certificate, error) {
+	if name == "" {
+		return nil, fmt.Errorf("secret is not issued")
+	}
+	secret, err := f.secretLister.Secrets(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(secret.Data[v1.TLSCertKey])
+	if block == nil {
+		return nil, fmt.Errorf("no certificate found in %s of secret %s/%s", v1.TLSCertKey, namespace, name)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// enqueueForSecret syncs the loadbalancers referencing the secret, directly
+// or by the cert-manager Certificate issuing it, so that the proxy pods are
+// rolled on rotation and the missing reference is resumed
+func (f *nginx) enqueueForSecret(obj interface{}) {
+	secret, ok := obj.(*v1.Secret)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("Couldn't get object from tombstone %#v", obj))
+			return
+		}
+		secret, ok = tombstone.Obj.(*v1.Secret)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("Tombstone contained object that is not a Secret %#v", obj))
+			return
+		}
+	}
+
+	lbs, err := f.lbLister.LoadBalancers(secret.Namespace).List(labels.Everything())
+	if err != nil {
+		return
+	}
+	certificate := secret.Annotations[annotationKeyCertificateName]
+	for _, lb := range lbs {
+		for _, cert := range lb.Spec.Proxy.TLS {
+			if (cert.SecretName != "" && cert.SecretName == secret.Name) ||
+				(cert.Certificate != "" && cert.Certificate == certificate) {
+				logger.Info("Referenced tls secret changed", log.Fields{"secret": secret.Namespace + "/" + secret.Name, "lb.name": lb.Name})
+				f.helper.Enqueue(lb)
+				break
+			}
+		}
+	}
+}
+
+// updateSecret syncs the loadbalancers only if the certificate is rotated
+func (f *nginx) updateSecret(oldObj, curObj interface{}) {
+	old := oldObj.(*v1.Secret)
+	cur := curObj.(*v1.Secret)
+	if old.ResourceVersion == cur.ResourceVersion || cur.Type != v1.SecretTypeTLS {
+		return
+	}
+	f.enqueueForSecret(cur)
+}
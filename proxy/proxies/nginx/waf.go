@@ -0,0 +1,213 @@
+/*
+Copyright 2017 Caicloud authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nginx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	netv1alpha1 "github.com/caicloud/loadbalancer-controller/pkg/apis/networking/v1alpha1"
+	"github.com/caicloud/loadbalancer-controller/pkg/log"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// wafRulesMountPath is the directory in proxy container where the custom
+	// rules of ModSecurity are mounted
+	wafRulesMountPath = "/etc/nginx/modsecurity/rules"
+	// wafRulesVolumeName is the name of volume of custom rules
+	wafRulesVolumeName = "waf-rules"
+	// wafRuleSuffix is the suffix of keys of rule files in rules ConfigMap
+	wafRuleSuffix = ".conf"
+)
+
+// wafMode returns the effective engine mode of ModSecurity of lb
+func wafMode(waf *netv1alpha1.ProxyWAF) netv1alpha1.ProxyWAFMode {
+	if waf.Mode == "" {
+		return netv1alpha1.ProxyWAFModeOn
+	}
+	return waf.Mode
+}
+
+// wafConfig returns the nginx settings of ModSecurity in spec of lb
+func wafConfig(lb *netv1alpha1.LoadBalancer) map[string]string {
+	waf := lb.Spec.Proxy.WAF
+	if waf == nil {
+		return nil
+	}
+
+	snippet := fmt.Sprintf("SecRuleEngine %s\n", wafMode(waf))
+	if waf.RulesConfigMap != "" {
+		snippet += fmt.Sprintf("Include %s/*%s\n", wafRulesMountPath, wafRuleSuffix)
+	}
+	return map[string]string{
+		"enable-modsecurity":           "true",
+		"enable-owasp-modsecurity-crs": fmt.Sprintf("%t", waf.CoreRuleSet),
+		"modsecurity-snippet":          snippet,
+	}
+}
+
+// resolveWAF returns a message if the rules ConfigMap of lb does not exist
+func (f *nginx) resolveWAF(lb *netv1alpha1.LoadBalancer) (string, error) {
+	waf := lb.Spec.Proxy.WAF
+	if waf == nil || waf.RulesConfigMap == "" {
+		return "", nil
+	}
+	_, err := f.cmLister.ConfigMaps(lb.Namespace).Get(waf.RulesConfigMap)
+	if errors.IsNotFound(err) {
+		return fmt.Sprintf("waf rules configmap %s/%s does not exist", lb.Namespace, waf.RulesConfigMap), nil
+	}
+	return "", err
+}
+
+// wafVolumes returns the volumes and mounts of the custom rules of lb
+func wafVolumes(lb *netv1alpha1.LoadBalancer) ([]v1.Volume, []v1.VolumeMount) {
+	waf := lb.Spec.Proxy.WAF
+	if waf == nil || waf.RulesConfigMap == "" {
+		return nil, nil
+	}
+	// set explicitly to be compared with the defaulted one
+	mode := v1.ConfigMapVolumeSourceDefaultMode
+	volumes := []v1.Volume{
+		{
+			Name: wafRulesVolumeName,
+			VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{
+						Name: waf.RulesConfigMap,
+					},
+					DefaultMode: &mode,
+				},
+			},
+		},
+	}
+	mounts := []v1.VolumeMount{
+		{
+			Name:      wafRulesVolumeName,
+			MountPath: wafRulesMountPath,
+			ReadOnly:  true,
+		},
+	}
+	return volumes, mounts
+}
+
+// wafRules returns the sorted rule files in the rules ConfigMap of lb
+func (f *nginx) wafRules(lb *netv1alpha1.LoadBalancer) (*v1.ConfigMap, []string, error) {
+	cm, err := f.cmLister.ConfigMaps(lb.Namespace).Get(lb.Spec.Proxy.WAF.RulesConfigMap)
+	if err != nil {
+		return nil, nil, err
+	}
+	var rules []string
+	for key := range cm.Data {
+		if strings.HasSuffix(key, wafRuleSuffix) {
+			rules = append(rules, key)
+		}
+	}
+	sort.Strings(rules)
+	return cm, rules, nil
+}
+
+// wafChecksum returns the checksum of custom rules of lb, it is empty if lb
+// has no custom rules
+func (f *nginx) wafChecksum(lb *netv1alpha1.LoadBalancer) string {
+	waf := lb.Spec.Proxy.WAF
+	if waf == nil || waf.RulesConfigMap == "" {
+		return ""
+	}
+	hash := sha256.New()
+	hash.Write([]byte(waf.RulesConfigMap))
+	if cm, rules, err := f.wafRules(lb); err == nil {
+		for _, rule := range rules {
+			hash.Write([]byte(rule))
+			hash.Write([]byte(cm.Data[rule]))
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// wafStatus reports the web application firewall of lb, nil if it is disabled
+func (f *nginx) wafStatus(lb *netv1alpha1.LoadBalancer) *netv1alpha1.ProxyWAFStatus {
+	waf := lb.Spec.Proxy.WAF
+	if waf == nil {
+		return nil
+	}
+	status := &netv1alpha1.ProxyWAFStatus{
+		Mode:        wafMode(waf),
+		CoreRuleSet: waf.CoreRuleSet,
+	}
+	if waf.RulesConfigMap == "" {
+		return status
+	}
+	_, rules, err := f.wafRules(lb)
+	switch {
+	case err != nil:
+		status.Message = err.Error()
+	case len(rules) == 0:
+		status.Message = fmt.Sprintf("no rule file ending with %s found in configmap %s/%s", wafRuleSuffix, lb.Namespace, waf.RulesConfigMap)
+	default:
+		status.Rules = rules
+	}
+	return status
+}
+
+// enqueueForConfigMap syncs the loadbalancers loading custom WAF rules from
+// the ConfigMap, so that the proxy pods are rolled on change and the missing
+// reference is resumed
+func (f *nginx) enqueueForConfigMap(obj interface{}) {
+	cm, ok := obj.(*v1.ConfigMap)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("Couldn't get object from tombstone %#v", obj))
+			return
+		}
+		cm, ok = tombstone.Obj.(*v1.ConfigMap)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("Tombstone contained object that is not a ConfigMap %#v", obj))
+			return
+		}
+	}
+
+	lbs, err := f.lbLister.LoadBalancers(cm.Namespace).List(labels.Everything())
+	if err != nil {
+		return
+	}
+	for _, lb := range lbs {
+		if waf := lb.Spec.Proxy.WAF; waf != nil && waf.RulesConfigMap == cm.Name {
+			logger.Info("Referenced waf rules changed", log.Fields{"cm": cm.Namespace + "/" + cm.Name, "lb.name": lb.Name})
+			f.helper.Enqueue(lb)
+		}
+	}
+}
+
+// updateConfigMap syncs the loadbalancers only if the data of ConfigMap is changed
+func (f *nginx) updateConfigMap(oldObj, curObj interface{}) {
+	old := oldObj.(*v1.ConfigMap)
+	cur := curObj.(*v1.ConfigMap)
+	if old.ResourceVersion == cur.ResourceVersion {
+		return
+	}
+	f.enqueueForConfigMap(cur)
+}